@@ -0,0 +1,305 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "sync"
+    "syscall"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/database"
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/metrics"
+    "github.com/alim08/fin_line/pkg/models"
+    "github.com/alim08/fin_line/pkg/redisclient"
+    "github.com/cenkalti/backoff/v4"
+    "go.uber.org/zap"
+)
+
+const (
+    anomaliesStream        = "anomalies:stream"
+    // consumerGroup is the Redis consumer group the alerter reads
+    // anomalies:stream with, so a restart resumes after the last anomaly
+    // delivered rather than skipping those detected meanwhile
+    consumerGroup          = "alerter"
+    webhookRefreshInterval = 30 * time.Second
+    deliveryWorkers        = 8
+    deliveryQueueSize      = 1000
+    deliveryTimeout        = 10 * time.Second
+    maxDeliveryRetries     = 5
+
+    // signatureHeader carries "sha256=<hex HMAC of timestamp.body>" keyed by the webhook secret
+    signatureHeader = "X-FinLine-Signature"
+    timestampHeader = "X-FinLine-Timestamp"
+)
+
+// alertPayload is the JSON body POSTed to webhook subscribers
+type alertPayload struct {
+    Event     string         `json:"event"`
+    WebhookID int64          `json:"webhook_id"`
+    Severity  string         `json:"severity"`
+    Anomaly   models.Anomaly `json:"anomaly"`
+    SentAt    int64          `json:"sent_at"`
+}
+
+// delivery is one anomaly queued for one webhook
+type delivery struct {
+    webhook *models.Webhook
+    anomaly models.Anomaly
+    // done is marked once the delivery succeeded or was given up on
+    done *sync.WaitGroup
+}
+
+// errNonPublicAddress refuses connections to addresses webhooks may not reach
+var errNonPublicAddress = errors.New("webhook address is not public")
+
+// newDeliveryClient returns the client alerts are POSTed with. It only
+// connects to public addresses, checked on each address dialed after DNS
+// resolution and redirects, so a webhook host that resolves to an internal
+// address, whenever it starts doing so, is refused.
+func newDeliveryClient() *http.Client {
+    dialer := &net.Dialer{
+        Timeout: deliveryTimeout,
+        Control: func(network, address string, _ syscall.RawConn) error {
+            host, _, err := net.SplitHostPort(address)
+            if err != nil {
+                return err
+            }
+            if ip := net.ParseIP(host); ip == nil || !models.IsPublicIP(ip) {
+                return fmt.Errorf("%w: %s", errNonPublicAddress, host)
+            }
+            return nil
+        },
+    }
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    // A proxy would be dialed instead of the webhook's own address
+    transport.Proxy = nil
+    transport.DialContext = dialer.DialContext
+    return &http.Client{Timeout: deliveryTimeout, Transport: transport}
+}
+
+// webhookSet caches active subscriptions between refreshes
+type webhookSet struct {
+    mu    sync.RWMutex
+    hooks []*models.Webhook
+}
+
+// refresh reloads active webhooks; on error the previous set is kept.
+func (s *webhookSet) refresh(ctx context.Context, repo database.WebhookRepository) error {
+    hooks, err := repo.GetActiveWebhooks(ctx)
+    if err != nil {
+        return err
+    }
+    s.mu.Lock()
+    s.hooks = hooks
+    s.mu.Unlock()
+    return nil
+}
+
+// matching returns the webhooks whose filters accept a.
+func (s *webhookSet) matching(a models.Anomaly) []*models.Webhook {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    var out []*models.Webhook
+    for _, wh := range s.hooks {
+        if wh.Matches(a) {
+            out = append(out, wh)
+        }
+    }
+    return out
+}
+
+// runDispatcher reads the anomalies stream as the alerter consumer group and
+// fans each anomaly out to matching webhooks. Anomalies are delivered at
+// least once: those read but not yet delivered when the alerter stops are
+// delivered after it restarts.
+func runDispatcher(ctx context.Context, rdb *redisclient.Client, repo database.WebhookRepository) {
+    logger.Log.Info("alert dispatcher started")
+
+    hooks := &webhookSet{}
+    if err := hooks.refresh(ctx, repo); err != nil {
+        logger.Log.Warn("initial webhook load failed", zap.Error(err))
+    }
+    go func() {
+        ticker := time.NewTicker(webhookRefreshInterval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                if err := hooks.refresh(ctx, repo); err != nil {
+                    logger.Log.Warn("webhook refresh failed", zap.Error(err))
+                }
+            }
+        }
+    }()
+
+    queue := make(chan delivery, deliveryQueueSize)
+    client := newDeliveryClient()
+    for i := 0; i < deliveryWorkers; i++ {
+        go func() {
+            for {
+                select {
+                case <-ctx.Done():
+                    return
+                case d := <-queue:
+                    deliver(ctx, client, d)
+                    d.done.Done()
+                }
+            }
+        }()
+    }
+
+    // A new group alerts on anomalies detected from now on; entries are
+    // acknowledged once every delivery of their batch is done
+    consumer, _ := os.Hostname()
+    reader := redisclient.NewStreamReader(rdb, redisclient.StreamReaderConfig[models.Anomaly]{
+        Stream:   anomaliesStream,
+        Group:    consumerGroup,
+        Consumer: consumer,
+        // A batch stays pending while its deliveries are retried
+        ClaimIdle: 5 * time.Minute,
+        FromMap: func(values map[string]interface{}) (models.Anomaly, error) {
+            return parseAnomaly(values), nil
+        },
+    })
+    err := reader.Run(ctx, func(ctx context.Context, entries []redisclient.StreamEntry[models.Anomaly]) error {
+        var done sync.WaitGroup
+        for _, entry := range entries {
+            for _, wh := range hooks.matching(entry.Value) {
+                done.Add(1)
+                select {
+                case queue <- delivery{webhook: wh, anomaly: entry.Value, done: &done}:
+                case <-ctx.Done():
+                    return ctx.Err()
+                }
+            }
+        }
+
+        // Workers stop taking deliveries once ctx is done
+        delivered := make(chan struct{})
+        go func() {
+            done.Wait()
+            close(delivered)
+        }()
+        select {
+        case <-delivered:
+            return nil
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    })
+    if err != nil {
+        logger.Log.Fatal("failed to create consumer group", zap.Error(err))
+    }
+    logger.Log.Info("runDispatcher: context cancelled")
+}
+
+// parseAnomaly decodes an anomalies:stream entry as written by the anomaly service.
+func parseAnomaly(values map[string]interface{}) models.Anomaly {
+    var a models.Anomaly
+    if ticker, ok := values["ticker"].(string); ok {
+        a.Ticker = ticker
+    }
+    if priceStr, ok := values["price"].(string); ok {
+        if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
+            a.Price = price
+        }
+    }
+    if zStr, ok := values["z"].(string); ok {
+        if z, err := strconv.ParseFloat(zStr, 64); err == nil {
+            a.ZScore = z
+        }
+    }
+    if tsMs, ok := values["ts_ms"].(string); ok {
+        if ts, err := strconv.ParseInt(tsMs, 10, 64); err == nil {
+            a.Timestamp = ts
+        }
+    }
+    return a
+}
+
+// deliver POSTs a signed alert, retrying with exponential backoff on network
+// errors, 408/429 and 5xx responses. Other 4xx responses are not retried.
+func deliver(ctx context.Context, client *http.Client, d delivery) {
+    start := time.Now()
+    defer func() {
+        metrics.AlertDeliveryLatency.Observe(time.Since(start).Seconds())
+    }()
+
+    body, err := json.Marshal(alertPayload{
+        Event:     "anomaly.detected",
+        WebhookID: d.webhook.ID,
+        Severity:  d.anomaly.Severity(),
+        Anomaly:   d.anomaly,
+        SentAt:    time.Now().UnixMilli(),
+    })
+    if err != nil {
+        logger.Log.Error("failed to encode alert", zap.Error(err))
+        metrics.AlertDeliveries.WithLabelValues("error").Inc()
+        return
+    }
+
+    bo := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxDeliveryRetries), ctx)
+
+    err = backoff.Retry(func() error {
+        ts := strconv.FormatInt(time.Now().Unix(), 10)
+        req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhook.URL, bytes.NewReader(body))
+        if err != nil {
+            return backoff.Permanent(err)
+        }
+        req.Header.Set("Content-Type", "application/json")
+        req.Header.Set(timestampHeader, ts)
+        req.Header.Set(signatureHeader, "sha256="+signPayload(d.webhook.Secret, ts, body))
+
+        resp, err := client.Do(req)
+        if errors.Is(err, errNonPublicAddress) {
+            return backoff.Permanent(err)
+        }
+        if err != nil {
+            return err
+        }
+        resp.Body.Close()
+
+        switch {
+        case resp.StatusCode >= 200 && resp.StatusCode < 300:
+            return nil
+        case resp.StatusCode == http.StatusRequestTimeout,
+            resp.StatusCode == http.StatusTooManyRequests,
+            resp.StatusCode >= 500:
+            return fmt.Errorf("webhook responded %d", resp.StatusCode)
+        default:
+            return backoff.Permanent(fmt.Errorf("webhook responded %d", resp.StatusCode))
+        }
+    }, bo)
+
+    if err != nil {
+        logger.Log.Warn("webhook delivery failed",
+            zap.Int64("webhook_id", d.webhook.ID),
+            zap.String("ticker", d.anomaly.Ticker),
+            zap.Error(err))
+        metrics.AlertDeliveries.WithLabelValues("failed").Inc()
+        return
+    }
+    metrics.AlertDeliveries.WithLabelValues("delivered").Inc()
+}
+
+// signPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret.
+func signPayload(secret, timestamp string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp))
+    mac.Write([]byte("."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/config"
+    "github.com/alim08/fin_line/pkg/database"
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/redisclient"
+    "go.uber.org/zap"
+)
+
+func main() {
+    // 1. Load configuration
+    cfg, err := config.Load()
+    if err != nil {
+        panic("config load error: " + err.Error())
+    }
+
+    // 2. Initialize structured logging
+    if err := logger.Init(); err != nil {
+        panic("logger init error: " + err.Error())
+    }
+    defer logger.Log.Sync()
+
+    // 3. Connect to Redis
+    rdb := redisclient.New(cfg.RedisURL)
+    defer rdb.Close()
+
+    // 4. Connect to Postgres for webhook subscriptions (migrations are run by the API)
+    dbConfig := database.NewConfig()
+    if err := database.WaitForReady(context.Background(), dbConfig); err != nil {
+        logger.Log.Fatal("failed to connect to database", zap.Error(err))
+    }
+    db, err := database.New(dbConfig)
+    if err != nil {
+        logger.Log.Fatal("failed to connect to database", zap.Error(err))
+    }
+    defer db.Close()
+
+    // 5. Launch alert dispatcher
+    ctx, cancel := context.WithCancel(context.Background())
+    go runDispatcher(ctx, rdb, database.NewWebhookRepository(db))
+
+    // 6. Graceful shutdown on SIGINT/SIGTERM
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+    <-stop
+
+    logger.Log.Info("shutdown signal received, exiting")
+    cancel()
+    // allow in-flight deliveries to observe cancellation
+    time.Sleep(200 * time.Millisecond)
+}
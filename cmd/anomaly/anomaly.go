@@ -61,12 +61,23 @@ func (w *rollingWindow) stats() (mean, std float64) {
 
 func runAnomalyDetector(ctx context.Context, rdb *redisclient.Client, cfg *config.Config) {
   logger.Log.Info("anomaly detector started")
-  pubsub := rdb.Client().Subscribe(ctx, "quotes:pubsub")
-  defer pubsub.Close()
+
+  // Detector parameters, updated live from the API via the control channel
+  settings := newDetectorSettings(cfg)
+  if err := settings.load(ctx, rdb); err != nil {
+    logger.Log.Warn("failed to load detector config, using env defaults", zap.Error(err))
+  }
+
+  sub, err := rdb.SubscribeManaged(ctx, "quotes:pubsub", detectorControlChannel)
+  if err != nil {
+    logger.Log.Fatal("failed to subscribe to quotes", zap.Error(err))
+  }
+  defer sub.Close()
 
   // One window per ticker, synchronized
   windows := make(map[string]*rollingWindow)
   mu := sync.Mutex{}
+  seqs := redisclient.NewSequenceTracker("quotes:pubsub")
 
   for {
     select {
@@ -74,24 +85,52 @@ func runAnomalyDetector(ctx context.Context, rdb *redisclient.Client, cfg *confi
       logger.Log.Info("anomaly detector stopping")
       return
 
-    case msg, ok := <-pubsub.Channel():
+    case msg, ok := <-sub.Channel():
       if !ok {
         logger.Log.Warn("quotes:pubsub closed")
         return
       }
 
+      if msg.Gap {
+        // Config updates may have been missed; ticks missed only thin the windows
+        if msg.Channel == detectorControlChannel {
+          if err := settings.load(ctx, rdb); err != nil {
+            logger.Log.Warn("failed to reload detector config", zap.Error(err))
+          }
+        } else {
+          seqs.Reset()
+        }
+        continue
+      }
+
+      if msg.Channel == detectorControlChannel {
+        if err := settings.applyJSON(msg.Payload); err != nil {
+          logger.Log.Warn("invalid detector config", zap.Error(err))
+          metrics.AnomalyErrors.Inc()
+        } else {
+          logger.Log.Info("detector config updated", zap.Int("overrides", len(settings.overrides)))
+        }
+        continue
+      }
+
       var tick models.NormalizedTick
       if err := json.Unmarshal([]byte(msg.Payload), &tick); err != nil {
         logger.Log.Warn("invalid tick JSON", zap.Error(err))
         metrics.AnomalyErrors.Inc()
         continue
       }
+      // A stale tick would count twice in the window; missed ones are
+      // counted by the tracker's metric
+      if seqs.Observe(tick.Ticker, redisclient.QuoteSeq(msg.Payload)) < 0 {
+        continue
+      }
 
-      // Ensure window exists
+      // Ensure window exists with the configured size
+      params := settings.forTicker(tick.Ticker)
       mu.Lock()
       w, exists := windows[tick.Ticker]
-      if !exists {
-        w = newWindow(cfg.AnomalyWindowSize)
+      if !exists || len(w.buf) != params.windowSize {
+        w = newWindow(params.windowSize)
         windows[tick.Ticker] = w
       }
       mu.Unlock()
@@ -103,7 +142,7 @@ func runAnomalyDetector(ctx context.Context, rdb *redisclient.Client, cfg *confi
         continue // no variation yet
       }
       z := math.Abs((tick.Price - mean) / std)
-      if z >= cfg.AnomalyThreshold {
+      if z >= params.threshold {
         // Build event
         event := models.Anomaly{
           Ticker:    tick.Ticker,
@@ -133,8 +172,8 @@ func emitAnomaly(ctx context.Context, rdb *redisclient.Client, a models.Anomaly)
   // 2) Sorted set (for range queries)
   score := float64(a.Timestamp)
   if err := rdb.Client().ZAdd(ctx,
-    "anomalies:"+a.Ticker,
-    &redis.Z{Score: score, Member: toJSON(val)},
+    redisclient.AnomalyKey(a.Ticker),
+    &redis.Z{Score: score, Member: redisclient.EncodeAnomaly(a)},
   ).Err(); err != nil {
     logger.Log.Error("ZADD anomalies set failed", zap.Error(err))
     metrics.AnomalyErrors.Inc()
@@ -142,8 +181,3 @@ func emitAnomaly(ctx context.Context, rdb *redisclient.Client, a models.Anomaly)
     metrics.AnomalyCounter.Inc()
   }
 }
-
-func toJSON(v interface{}) string {
-  b, _ := json.Marshal(v)
-  return string(b)
-}
@@ -0,0 +1,89 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+
+  "github.com/alim08/fin_line/pkg/config"
+  "github.com/alim08/fin_line/pkg/models"
+  "github.com/alim08/fin_line/pkg/redisclient"
+  "github.com/go-redis/redis/v8"
+)
+
+const (
+  // detectorConfigKey holds the configuration snapshot written by the API
+  detectorConfigKey = "anomaly:config"
+  // detectorControlChannel carries configuration snapshots published by the API
+  detectorControlChannel = "anomaly:control"
+)
+
+// detectorParams are the effective parameters for one ticker.
+type detectorParams struct {
+  windowSize int
+  threshold  float64
+}
+
+// detectorSettings resolves detector parameters per ticker. Env configuration
+// provides the defaults; the API-managed global config replaces them and
+// per-ticker overrides take precedence over both.
+type detectorSettings struct {
+  defaults  detectorParams
+  global    detectorParams
+  overrides map[string]detectorParams
+}
+
+func newDetectorSettings(cfg *config.Config) *detectorSettings {
+  defaults := detectorParams{windowSize: cfg.AnomalyWindowSize, threshold: cfg.AnomalyThreshold}
+  return &detectorSettings{
+    defaults:  defaults,
+    global:    defaults,
+    overrides: make(map[string]detectorParams),
+  }
+}
+
+// forTicker returns the parameters that apply to ticker.
+func (s *detectorSettings) forTicker(ticker string) detectorParams {
+  if p, ok := s.overrides[ticker]; ok {
+    return p
+  }
+  return s.global
+}
+
+// apply replaces the current settings with a full configuration snapshot.
+func (s *detectorSettings) apply(configs []models.DetectorConfig) {
+  s.global = s.defaults
+  s.overrides = make(map[string]detectorParams, len(configs))
+  for _, c := range configs {
+    if err := c.Validate(); err != nil {
+      continue
+    }
+    p := detectorParams{windowSize: c.WindowSize, threshold: c.Threshold}
+    if c.Ticker == "" {
+      s.global = p
+    } else {
+      s.overrides[c.Ticker] = p
+    }
+  }
+}
+
+// applyJSON decodes and applies a snapshot as published on the control channel.
+func (s *detectorSettings) applyJSON(payload string) error {
+  var configs []models.DetectorConfig
+  if err := json.Unmarshal([]byte(payload), &configs); err != nil {
+    return err
+  }
+  s.apply(configs)
+  return nil
+}
+
+// load applies the last snapshot stored by the API, if any.
+func (s *detectorSettings) load(ctx context.Context, rdb *redisclient.Client) error {
+  payload, err := rdb.Client().Get(ctx, detectorConfigKey).Result()
+  if err == redis.Nil {
+    return nil
+  }
+  if err != nil {
+    return err
+  }
+  return s.applyJSON(payload)
+}
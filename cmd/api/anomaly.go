@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// manualAnomalyChannel carries manually created anomalies to real-time subscribers
+const manualAnomalyChannel = "anomalies"
+
+// Create anomaly handler. The creator is taken from the auth claims.
+func createAnomalyHandler(manualRepo database.ManualAnomalyRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var anomaly models.ManualAnomaly
+		if err := json.NewDecoder(r.Body).Decode(&anomaly); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		anomaly.ID = 0
+		anomaly.CreatedBy = user.Username
+		anomaly.DeletedAt = nil
+		anomaly.DeletedBy = ""
+		if anomaly.Timestamp == 0 {
+			anomaly.Timestamp = time.Now().UnixMilli()
+		}
+
+		anomaly.Sanitize()
+		if err := anomaly.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := manualRepo.CreateManualAnomaly(ctx, &anomaly); err != nil {
+			logger.Log.Error("failed to create anomaly", zap.Error(err), zap.String("ticker", anomaly.Ticker))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		if payload, err := json.Marshal(anomaly); err == nil {
+			if err := redisClient.Client().Publish(ctx, manualAnomalyChannel, payload).Err(); err != nil {
+				logger.Log.Warn("failed to publish anomaly", zap.Error(err))
+			}
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: anomaly})
+	}
+}
+
+// Delete anomaly handler. Only the creator or an admin may soft-delete a manual anomaly.
+func deleteAnomalyHandler(manualRepo database.ManualAnomalyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid anomaly id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		anomaly, err := manualRepo.GetManualAnomaly(ctx, id)
+		if err != nil {
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+		if anomaly.CreatedBy != user.Username && !user.HasPermission(auth.PermAdminAnomalies) {
+			writeError(w, http.StatusForbidden, "Only the creator or an admin can delete this anomaly")
+			return
+		}
+
+		if err := manualRepo.SoftDeleteAnomaly(ctx, id, user.Username); err != nil {
+			logger.Log.Error("failed to delete anomaly", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// Restore anomaly handler (admin only)
+func restoreAnomalyHandler(manualRepo database.ManualAnomalyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid anomaly id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := manualRepo.RestoreAnomaly(ctx, id, user.Username); err != nil {
+			logger.Log.Error("failed to restore anomaly", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		anomaly, err := manualRepo.GetManualAnomaly(ctx, id)
+		if err != nil {
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: anomaly})
+	}
+}
+
+// Acknowledge anomaly handler (admin only). Detected and manual anomalies can be acknowledged once.
+func acknowledgeAnomalyHandler(manualRepo database.ManualAnomalyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid anomaly id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := manualRepo.AcknowledgeAnomaly(ctx, id, user.Username); err != nil {
+			logger.Log.Error("failed to acknowledge anomaly", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// Anomaly audit log handler (admin only)
+func getAnomalyAuditLogHandler(manualRepo database.ManualAnomalyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid anomaly id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		entries, err := manualRepo.GetAnomalyAuditLog(ctx, id)
+		if err != nil {
+			logger.Log.Error("failed to get anomaly audit log", zap.Error(err), zap.Int64("id", id))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: entries})
+	}
+}
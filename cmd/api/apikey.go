@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// apiKeyRequest is the payload for creating or updating an API key
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// createdAPIKey is the response to creating an API key, the only one that
+// carries the key itself
+type createdAPIKey struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// List API keys handler (admin only)
+func listAPIKeysHandler(apiKeyRepo database.APIKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		keys, err := apiKeyRepo.ListAPIKeys(ctx)
+		if err != nil {
+			logger.Log.Error("failed to list api keys", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: keys})
+	}
+}
+
+// Create API key handler (admin only). The key is only returned in this response.
+func createAPIKeyHandler(apiKeyRepo database.APIKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		key, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			logger.Log.Error("failed to generate api key", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		apiKey := models.APIKey{
+			Name:      req.Name,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			Scopes:    req.Scopes,
+			CreatedBy: user.UserID,
+			ExpiresAt: req.ExpiresAt,
+		}
+
+		apiKey.Sanitize()
+		if err := apiKey.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// A key never carries rights its creator does not hold
+		if err := user.CanGrant(apiKey.Scopes...); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := apiKeyRepo.CreateAPIKey(ctx, &apiKey); err != nil {
+			logger.Log.Error("failed to create api key", zap.Error(err))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		logger.Log.Info("api key created",
+			zap.String("prefix", apiKey.Prefix),
+			zap.Strings("scopes", apiKey.Scopes),
+			zap.String("created_by", user.UserID))
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: createdAPIKey{APIKey: &apiKey, Key: key}})
+	}
+}
+
+// Get API key handler (admin only)
+func getAPIKeyHandler(apiKeyRepo database.APIKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid api key id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		apiKey, err := apiKeyRepo.GetAPIKey(ctx, id)
+		if err != nil {
+			logger.Log.Error("failed to get api key", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: apiKey})
+	}
+}
+
+// Update API key handler (admin only). Omitted fields keep their current
+// values; new scopes must be held by the caller.
+func updateAPIKeyHandler(apiKeyRepo database.APIKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid api key id")
+			return
+		}
+
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		apiKey, err := apiKeyRepo.GetAPIKey(ctx, id)
+		if err != nil {
+			logger.Log.Error("failed to get api key", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		if req.Name != "" {
+			apiKey.Name = req.Name
+		}
+		if req.Scopes != nil {
+			apiKey.Scopes = req.Scopes
+		}
+		if req.ExpiresAt != nil {
+			apiKey.ExpiresAt = req.ExpiresAt
+		}
+
+		apiKey.Sanitize()
+		if err := apiKey.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Scopes != nil {
+			if err := user.CanGrant(apiKey.Scopes...); err != nil {
+				writeError(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+
+		if err := apiKeyRepo.UpdateAPIKey(ctx, apiKey); err != nil {
+			logger.Log.Error("failed to update api key", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: apiKey})
+	}
+}
+
+// Revoke API key handler (admin only). The key stops working immediately.
+func revokeAPIKeyHandler(apiKeyRepo database.APIKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid api key id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := apiKeyRepo.RevokeAPIKey(ctx, id); err != nil {
+			logger.Log.Error("failed to revoke api key", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// fakeAPIKeyRepo keeps API keys in memory
+type fakeAPIKeyRepo struct {
+	keys    map[int64]*models.APIKey
+	created []*models.APIKey
+	updated []*models.APIKey
+}
+
+func newFakeAPIKeyRepo(keys ...*models.APIKey) *fakeAPIKeyRepo {
+	repo := &fakeAPIKeyRepo{keys: make(map[int64]*models.APIKey)}
+	for _, key := range keys {
+		repo.keys[key.ID] = key
+	}
+	return repo
+}
+
+func (f *fakeAPIKeyRepo) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.ID = int64(len(f.keys) + 1)
+	f.keys[key.ID] = key
+	f.created = append(f.created, key)
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	key, ok := f.keys[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	copied := *key
+	copied.Scopes = append([]string(nil), key.Scopes...)
+	return &copied, nil
+}
+
+func (f *fakeAPIKeyRepo) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	for _, key := range f.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (f *fakeAPIKeyRepo) UpdateAPIKey(ctx context.Context, key *models.APIKey) error {
+	f.keys[key.ID] = key
+	f.updated = append(f.updated, key)
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) RevokeAPIKey(ctx context.Context, id int64) error {
+	delete(f.keys, id)
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	return nil, database.ErrNotFound
+}
+
+// asUser attaches claims holding permissions to r
+func asUser(r *http.Request, userID string, permissions ...string) *http.Request {
+	return r.WithContext(auth.SetUser(r.Context(), &auth.Claims{UserID: userID, Permissions: permissions}))
+}
+
+func TestCreateAPIKey_RejectsScopesNotHeld(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := newFakeAPIKeyRepo()
+
+	body := `{"name":"escalate","scopes":["quotes:read","*"]}`
+	r := asUser(httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(body)), "u1", auth.PermAdminAuth, auth.PermQuotesRead)
+	w := httptest.NewRecorder()
+	createAPIKeyHandler(repo)(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusForbidden, w.Body)
+	}
+	if len(repo.created) != 0 {
+		t.Errorf("created %d keys; want none", len(repo.created))
+	}
+}
+
+func TestCreateAPIKey_AllowsHeldScopes(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := newFakeAPIKeyRepo()
+
+	body := `{"name":"reader","scopes":["quotes:read","anomalies:read"]}`
+	r := asUser(httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(body)), "u1", auth.PermAdminAuth, "quotes:*", auth.PermAnomaliesRead)
+	w := httptest.NewRecorder()
+	createAPIKeyHandler(repo)(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusCreated, w.Body)
+	}
+	if len(repo.created) != 1 {
+		t.Fatalf("created %d keys; want 1", len(repo.created))
+	}
+}
+
+func TestUpdateAPIKey_RejectsScopesNotHeld(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := newFakeAPIKeyRepo(&models.APIKey{ID: 1, Name: "reader", Prefix: "fl_00000000", Scopes: []string{"quotes:read"}})
+
+	body := `{"scopes":["admin:auth"]}`
+	r := asUser(httptest.NewRequest(http.MethodPut, "/api-keys/1", strings.NewReader(body)), "u1", auth.PermQuotesRead, "admin:users")
+	r = mux.SetURLVars(r, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	updateAPIKeyHandler(repo)(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusForbidden, w.Body)
+	}
+	if len(repo.updated) != 0 {
+		t.Errorf("updated %d keys; want none", len(repo.updated))
+	}
+}
+
+func TestUpdateAPIKey_RenameKeepsScopes(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := newFakeAPIKeyRepo(&models.APIKey{ID: 1, Name: "reader", Prefix: "fl_00000000", Scopes: []string{"quotes:read"}})
+
+	body := `{"name":"renamed"}`
+	r := asUser(httptest.NewRequest(http.MethodPut, "/api-keys/1", strings.NewReader(body)), "u1", auth.PermAdminAuth)
+	r = mux.SetURLVars(r, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	updateAPIKeyHandler(repo)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	if len(repo.updated) != 1 || repo.updated[0].Name != "renamed" {
+		t.Errorf("updated = %+v; want the key renamed", repo.updated)
+	}
+}
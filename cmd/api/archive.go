@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// archiveStreamTimeout bounds a single archived records download
+	archiveStreamTimeout = 5 * time.Minute
+	// defaultArchivePage is the page size when no limit is given
+	defaultArchivePage = 10000
+	// archiveFlushEvery is how many lines are written between flushes
+	archiveFlushEvery = 1000
+)
+
+// archiveDatasets are the datasets the archival service moves out of Redis
+var archiveDatasets = []string{database.ArchiveDatasetQuotes, database.ArchiveDatasetAnomalies, database.ArchiveDatasetRawEvents}
+
+// Archive partitions handler (admin only). Lists, per dataset and UTC day,
+// how many records the archival service moved from Redis to the
+// redis_archive_* tables and their time span; dataset limits it to one.
+func listArchivePartitionsHandler(archiveRepo database.RedisArchiveRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		datasets := archiveDatasets
+		if dataset := r.URL.Query().Get("dataset"); dataset != "" {
+			if !isArchiveDataset(dataset) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown dataset %q", dataset))
+				return
+			}
+			datasets = []string{dataset}
+		}
+
+		partitions := []*database.ArchivePartition{}
+		for _, dataset := range datasets {
+			datasetPartitions, err := archiveRepo.ListArchivePartitions(r.Context(), dataset)
+			if err != nil {
+				logger.Log.Error("failed to list archive partitions", zap.String("dataset", dataset), zap.Error(err))
+				writeError(w, repositoryErrorStatus(err), "Failed to list archive partitions")
+				return
+			}
+			partitions = append(partitions, datasetPartitions...)
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: partitions})
+	}
+}
+
+// Archived records handler (admin only). Streams the records of a dataset
+// archived from Redis as NDJSON, one {id, ticker, timestamp, payload} object
+// per line in timestamp and id order. Query parameters:
+//
+//	since, until   time bounds (ms or RFC3339); since defaults to 24h ago
+//	ticker         exact-match filter
+//	cursor         resume after this record (the X-Next-Cursor of the previous page)
+//	limit          page size (default 10000, max 100000)
+//
+// The cursor for the next page is sent in the X-Next-Cursor trailer and is
+// empty once the window is exhausted.
+func getArchivedRecordsHandler(archiveRepo database.RedisArchiveRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseArchiveFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), archiveStreamTimeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Trailer", nextCursorTrailer)
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		var last *database.ArchivedRecord
+		count := 0
+
+		err = archiveRepo.ReadArchivedRecords(ctx, filter, func(record *database.ArchivedRecord) error {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+			last = record
+			count++
+			if flusher != nil && count%archiveFlushEvery == 0 {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Log.Error("failed to stream archived records", zap.String("dataset", filter.Dataset), zap.Error(err), zap.Int("written", count))
+			if count == 0 {
+				w.Header().Del("Trailer")
+				writeError(w, repositoryErrorStatus(err), "Failed to retrieve archived records")
+			}
+			// Headers are already sent; the client sees a truncated stream without a cursor
+			return
+		}
+
+		if count == filter.Limit {
+			w.Header().Set(nextCursorTrailer, strconv.FormatInt(last.Timestamp, 10)+":"+last.ID)
+		} else {
+			w.Header().Set(nextCursorTrailer, "")
+		}
+	}
+}
+
+// parseArchiveFilter reads the dataset path variable and the archived
+// records query parameters
+func parseArchiveFilter(r *http.Request) (database.ArchiveFilter, error) {
+	q := r.URL.Query()
+	filter := database.ArchiveFilter{
+		Dataset: mux.Vars(r)["dataset"],
+		Ticker:  q.Get("ticker"),
+		From:    time.Now().Add(-24 * time.Hour).UnixMilli(),
+		Until:   time.Now().UnixMilli(),
+		Limit:   defaultArchivePage,
+	}
+	if !isArchiveDataset(filter.Dataset) {
+		return filter, fmt.Errorf("unknown dataset %q", filter.Dataset)
+	}
+
+	if v := q.Get("since"); v != "" {
+		ms, err := parseTimestampParam(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.From = ms
+	}
+	if v := q.Get("until"); v != "" {
+		ms, err := parseTimestampParam(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Until = ms
+	}
+	if filter.Until < filter.From {
+		return filter, fmt.Errorf("until must not be before since")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		ts, id, ok := strings.Cut(v, ":")
+		timestamp, err := strconv.ParseInt(ts, 10, 64)
+		if !ok || err != nil || id == "" {
+			return filter, fmt.Errorf("invalid cursor %q", v)
+		}
+		filter.AfterTimestamp, filter.AfterID = timestamp, id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > database.MaxArchivePage {
+			return filter, fmt.Errorf("invalid limit %q: must be between 1 and %d", v, database.MaxArchivePage)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+// isArchiveDataset reports whether dataset is archived from Redis
+func isArchiveDataset(dataset string) bool {
+	for _, d := range archiveDatasets {
+		if d == dataset {
+			return true
+		}
+	}
+	return false
+}
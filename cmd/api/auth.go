@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+// loginRequest is the payload of /auth/login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// refreshRequest is the payload of /auth/refresh and /auth/logout
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// revokeTokenRequest is the payload of /admin/tokens/revoke
+type revokeTokenRequest struct {
+	JTI string `json:"jti"`
+}
+
+// serviceTokenRequest is the payload of /admin/service-tokens. TTL is a
+// duration such as "15m".
+type serviceTokenRequest struct {
+	Service     string   `json:"service"`
+	Permissions []string `json:"permissions"`
+	TTL         string   `json:"ttl"`
+}
+
+// serviceTokenResponse carries a minted service token; JTI identifies it for
+// /admin/tokens/revoke
+type serviceTokenResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	JTI         string    `json:"jti"`
+	Principal   string    `json:"principal"`
+	Permissions []string  `json:"permissions"`
+}
+
+// tokenResponse carries a freshly issued access and refresh token pair
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Login handler. Unknown users, inactive users and wrong passwords get the same 401.
+// Repeated failures lock the account and the client IP out with 429.
+func loginHandler(userRepo database.UserRepository, authService *auth.AuthService, throttle *loginThrottle) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req loginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if req.Username == "" || req.Password == "" {
+			writeError(w, http.StatusBadRequest, "username and password are required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		// Checked before the password so a locked out guesser learns nothing
+		if retryAfter := throttle.locked(ctx, req.Username, r); retryAfter > 0 {
+			authService.Audit(r, models.AuthEventLoginThrottled, req.Username, "", fmt.Sprintf("locked out for %s", retryAfter.Round(time.Second)))
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "Too many failed login attempts; try again later")
+			return
+		}
+
+		user, err := userRepo.GetUserByUsername(ctx, strings.ToLower(req.Username))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			logger.Log.Error("failed to get user", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		passwordHash := ""
+		if user != nil {
+			passwordHash = user.PasswordHash
+		}
+		if !auth.CheckPassword(passwordHash, req.Password) || !user.Active {
+			logger.Log.Warn("login failed", zap.String("username", req.Username), zap.String("ip", r.RemoteAddr))
+			authService.Audit(r, models.AuthEventLoginFailure, req.Username, "", "invalid credentials or inactive user")
+			throttle.recordFailure(ctx, req.Username, r)
+			writeError(w, http.StatusUnauthorized, "Invalid username or password")
+			return
+		}
+
+		refreshToken, refreshHash, err := auth.NewRefreshToken()
+		if err != nil {
+			logger.Log.Error("failed to generate refresh token", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := userRepo.CreateRefreshToken(ctx, user.ID, refreshHash, time.Now().Add(authService.RefreshTokenTTL())); err != nil {
+			logger.Log.Error("failed to store refresh token", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		throttle.reset(ctx, req.Username)
+		authService.Audit(r, models.AuthEventLoginSuccess, strconv.FormatInt(user.ID, 10), user.TenantID, "")
+		writeTokens(w, authService, user, refreshToken)
+	}
+}
+
+// Refresh handler. The presented refresh token is rotated: it stops working
+// and a new one is returned with the access token. Presenting a rotated
+// token again revokes all of the user's refresh tokens.
+func refreshTokenHandler(userRepo database.UserRepository, authService *auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			writeError(w, http.StatusBadRequest, "refresh_token is required")
+			return
+		}
+
+		refreshToken, refreshHash, err := auth.NewRefreshToken()
+		if err != nil {
+			logger.Log.Error("failed to generate refresh token", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		user, err := userRepo.RotateRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken), refreshHash, time.Now().Add(authService.RefreshTokenTTL()))
+		if errors.Is(err, database.ErrTokenReused) {
+			logger.Log.Warn("refresh token reused; revoked the user's sessions", zap.String("ip", r.RemoteAddr))
+			authService.Audit(r, models.AuthEventTokenReuse, "", "", "rotated refresh token presented; sessions revoked")
+			writeError(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			writeError(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		if err != nil {
+			logger.Log.Error("failed to rotate refresh token", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		authService.Audit(r, models.AuthEventTokenRefresh, strconv.FormatInt(user.ID, 10), user.TenantID, "")
+		writeTokens(w, authService, user, refreshToken)
+	}
+}
+
+// Logout handler. Revokes the presented refresh token and, when the request
+// carries one, the bearer access token.
+func logoutHandler(userRepo database.UserRepository, authService *auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			writeError(w, http.StatusBadRequest, "refresh_token is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		// Logging out twice is not an error
+		err := userRepo.RevokeRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			logger.Log.Error("failed to revoke refresh token", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		var principal, tenantID string
+		if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+			if claims, err := authService.ValidateToken(strings.TrimPrefix(bearer, "Bearer ")); err == nil {
+				if err := authService.RevokeToken(ctx, claims); err != nil {
+					logger.Log.Error("failed to revoke access token", zap.Error(err))
+					writeError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				principal, tenantID = claims.UserID, claims.Tenant()
+			}
+		}
+
+		authService.Audit(r, models.AuthEventLogout, principal, tenantID, "")
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// List auth events handler (admin only). Filters by type, principal and time
+// range, newest first; pass the last id seen as cursor for the next page.
+// Events are those of the request's tenant; only callers holding
+// PermAdminTenants may pick another tenant, or all of them, with the tenant
+// parameter.
+func listAuthEventsHandler(auditRepo database.AuthAuditRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := database.AuthEventFilter{
+			Type:      q.Get("type"),
+			Principal: q.Get("principal"),
+			TenantID:  tenant.FromContext(r.Context()),
+			Limit:     100,
+		}
+		if user, ok := auth.FromContext(r.Context()); ok && user.HasPermission(auth.PermAdminTenants) {
+			filter.TenantID = q.Get("tenant")
+		} else if v := q.Get("tenant"); v != "" && v != filter.TenantID {
+			writeError(w, http.StatusForbidden, "Insufficient permissions to read other tenants' events")
+			return
+		}
+
+		if v := q.Get("since"); v != "" {
+			ms, err := parseTimestampParam(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			filter.Since = time.UnixMilli(ms)
+		}
+		if v := q.Get("until"); v != "" {
+			ms, err := parseTimestampParam(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			filter.Until = time.UnixMilli(ms)
+		}
+		if v := q.Get("cursor"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				writeError(w, http.StatusBadRequest, "cursor must be a positive integer")
+				return
+			}
+			filter.BeforeID = id
+		}
+		if v := q.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > database.MaxAuthEventPage {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", database.MaxAuthEventPage))
+				return
+			}
+			filter.Limit = limit
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		events, err := auditRepo.ListAuthEvents(ctx, filter)
+		if err != nil {
+			logger.Log.Error("failed to list auth events", zap.Error(err))
+			writeError(w, repositoryErrorStatus(err), "Failed to list auth events")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: events})
+	}
+}
+
+// Revoke token handler (admin only). Kills a compromised access token by its jti claim.
+func revokeTokenHandler(authService *auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req revokeTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.JTI == "" {
+			writeError(w, http.StatusBadRequest, "jti is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := authService.RevokeTokenID(ctx, req.JTI); err != nil {
+			logger.Log.Error("failed to revoke token", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// Mint service token handler (admin only). Issues a short-lived token scoped
+// to the requested permissions for an internal component; callers can only
+// grant permissions they hold themselves.
+func mintServiceTokenHandler(authService *auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req serviceTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "ttl must be a positive duration such as 15m")
+				return
+			}
+			ttl = d
+		}
+
+		token, claims, err := authService.GenerateServiceToken(user, req.Service, req.Permissions, ttl)
+		if errors.Is(err, auth.ErrPermissionNotHeld) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, auth.ErrLocalTokensDisabled) {
+			writeError(w, http.StatusServiceUnavailable, "Local token issuance is disabled")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		authService.Audit(r, models.AuthEventServiceToken, user.UserID, user.Tenant(),
+			fmt.Sprintf("%s granted %s until %s (jti %s)", claims.UserID, strings.Join(claims.Permissions, ", "), claims.ExpiresAt.Format(time.RFC3339), claims.ID))
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: serviceTokenResponse{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresAt:   claims.ExpiresAt.Time,
+			JTI:         claims.ID,
+			Principal:   claims.UserID,
+			Permissions: claims.Permissions,
+		}})
+	}
+}
+
+// writeTokens issues an access token for user and responds with it and refreshToken
+func writeTokens(w http.ResponseWriter, authService *auth.AuthService, user *models.User, refreshToken string) {
+	accessToken, err := authService.GenerateTenantToken(user.TenantID, strconv.FormatInt(user.ID, 10), user.Username, user.Email, user.Roles)
+	if err != nil {
+		logger.Log.Error("failed to generate access token", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(authService.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
+	}})
+}
+
+// bootstrapAdmin creates the admin account named by ADMIN_USERNAME with
+// ADMIN_PASSWORD if it does not exist yet, so a fresh deployment can log in
+func bootstrapAdmin(ctx context.Context, userRepo database.UserRepository) error {
+	username, password := os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		return nil
+	}
+
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = userRepo.CreateUser(ctx, &models.User{
+		Username:     username,
+		PasswordHash: passwordHash,
+		Roles:        []string{"admin"},
+		TenantID:     tenant.Default,
+		Active:       true,
+	})
+	if errors.Is(err, database.ErrConflict) {
+		return nil
+	}
+	return err
+}
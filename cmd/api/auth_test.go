@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// fakeAuthAuditRepo records the filters events are listed with
+type fakeAuthAuditRepo struct {
+	filters []database.AuthEventFilter
+}
+
+func (f *fakeAuthAuditRepo) RecordAuthEvent(ctx context.Context, event *models.AuthEvent) error {
+	return nil
+}
+
+func (f *fakeAuthAuditRepo) ListAuthEvents(ctx context.Context, filter database.AuthEventFilter) ([]*models.AuthEvent, error) {
+	f.filters = append(f.filters, filter)
+	return nil, nil
+}
+
+// listAuthEvents calls listAuthEventsHandler as a caller of tenant acme
+// holding permissions
+func listAuthEvents(repo *fakeAuthAuditRepo, target string, permissions ...string) *httptest.ResponseRecorder {
+	r := asUser(httptest.NewRequest(http.MethodGet, target, nil), "1", permissions...)
+	r = r.WithContext(tenant.WithTenant(r.Context(), "acme"))
+	w := httptest.NewRecorder()
+	listAuthEventsHandler(repo)(w, r)
+	return w
+}
+
+func TestListAuthEvents_ScopedToCallerTenant(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := &fakeAuthAuditRepo{}
+
+	if w := listAuthEvents(repo, "/audit/auth", auth.PermAdminAuth); w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	if len(repo.filters) != 1 || repo.filters[0].TenantID != "acme" {
+		t.Errorf("filters = %+v; want tenant acme", repo.filters)
+	}
+}
+
+func TestListAuthEvents_RejectsOtherTenantWithoutPermission(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := &fakeAuthAuditRepo{}
+
+	if w := listAuthEvents(repo, "/audit/auth?tenant=globex", auth.PermAdminAuth); w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusForbidden, w.Body)
+	}
+	if len(repo.filters) != 0 {
+		t.Errorf("listed events with %+v; want none", repo.filters)
+	}
+}
+
+func TestListAuthEvents_TenantAdminPicksTenant(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := &fakeAuthAuditRepo{}
+
+	if w := listAuthEvents(repo, "/audit/auth?tenant=globex", auth.PermAdminAuth, auth.PermAdminTenants); w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	if len(repo.filters) != 1 || repo.filters[0].TenantID != "globex" {
+		t.Errorf("filters = %+v; want tenant globex", repo.filters)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/gorilla/mux"
+)
+
+// processStart is reported as uptime by the debug stats endpoint
+var processStart = time.Now()
+
+// registerDebugRoutes mounts net/http/pprof and runtime stats under /debug on
+// router, which is expected to be admin-protected.
+func registerDebugRoutes(router *mux.Router, db store, redisClient *redisclient.Client) {
+	debugRouter := router.PathPrefix("/debug").Subrouter()
+
+	debugRouter.HandleFunc("/stats", debugStatsHandler(db, redisClient)).Methods("GET")
+
+	// pprof.Index only resolves profiles under the literal /debug/pprof/
+	// prefix, so named profiles are routed explicitly.
+	debugRouter.HandleFunc("/pprof/", pprof.Index).Methods("GET")
+	debugRouter.HandleFunc("/pprof/cmdline", pprof.Cmdline).Methods("GET")
+	debugRouter.HandleFunc("/pprof/profile", pprof.Profile).Methods("GET")
+	debugRouter.HandleFunc("/pprof/symbol", pprof.Symbol).Methods("GET", "POST")
+	debugRouter.HandleFunc("/pprof/trace", pprof.Trace).Methods("GET")
+	debugRouter.HandleFunc("/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(mux.Vars(r)["profile"]).ServeHTTP(w, r)
+	}).Methods("GET")
+}
+
+// debugStats is the /debug/stats response body
+type debugStats struct {
+	UptimeSeconds int64       `json:"uptime_seconds"`
+	Goroutines    int         `json:"goroutines"`
+	GOMAXPROCS    int         `json:"gomaxprocs"`
+	Memory        memoryStats `json:"memory"`
+	Database      dbStats     `json:"database"`
+	Redis         redisStats  `json:"redis"`
+}
+
+type memoryStats struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	PauseTotalNs   uint64 `json:"pause_total_ns"`
+}
+
+type dbStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	AcquireDurationMs  int64 `json:"acquire_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+type redisStats struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+// Debug stats handler (admin only): connection pools, goroutines and memory
+func debugStatsHandler(db store, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		poolStats := redisClient.Client().PoolStats()
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: debugStats{
+			UptimeSeconds: int64(time.Since(processStart).Seconds()),
+			Goroutines:    runtime.NumGoroutine(),
+			GOMAXPROCS:    runtime.GOMAXPROCS(0),
+			Memory: memoryStats{
+				HeapAllocBytes: mem.HeapAlloc,
+				HeapInuseBytes: mem.HeapInuse,
+				SysBytes:       mem.Sys,
+				NumGC:          mem.NumGC,
+				PauseTotalNs:   mem.PauseTotalNs,
+			},
+			Database: databaseStats(db),
+			Redis: redisStats{
+				Hits:       poolStats.Hits,
+				Misses:     poolStats.Misses,
+				Timeouts:   poolStats.Timeouts,
+				TotalConns: poolStats.TotalConns,
+				IdleConns:  poolStats.IdleConns,
+				StaleConns: poolStats.StaleConns,
+			},
+		}})
+	}
+}
+
+// databaseStats reports the connection pool of db
+func databaseStats(db store) dbStats {
+	stats := db.PoolStats()
+	return dbStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		AcquireDurationMs:  stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
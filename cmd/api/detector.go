@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// detectorConfigKey holds the latest detector configuration snapshot for anomaly service startup
+	detectorConfigKey = "anomaly:config"
+	// detectorControlChannel broadcasts detector configuration snapshots to running anomaly services
+	detectorControlChannel = "anomaly:control"
+)
+
+// Get detector config handler (admin only)
+func getDetectorConfigHandler(configRepo database.DetectorConfigRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		configs, err := configRepo.GetDetectorConfigs(ctx)
+		if err != nil {
+			logger.Log.Error("failed to get detector config", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: configs})
+	}
+}
+
+// Update detector config handler (admin only). Without a {ticker} route
+// variable the global configuration is updated.
+func updateDetectorConfigHandler(configRepo database.DetectorConfigRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var config models.DetectorConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		config.Ticker = mux.Vars(r)["ticker"]
+		if user, ok := auth.FromContext(r.Context()); ok {
+			config.UpdatedBy = user.Username
+		}
+
+		config.Sanitize()
+		if err := config.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := configRepo.SaveDetectorConfig(ctx, &config); err != nil {
+			logger.Log.Error("failed to save detector config", zap.Error(err), zap.String("ticker", config.Ticker))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		if err := publishDetectorConfig(ctx, configRepo, redisClient); err != nil {
+			logger.Log.Warn("failed to publish detector config", zap.Error(err))
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: config})
+	}
+}
+
+// Delete detector override handler (admin only)
+func deleteDetectorConfigHandler(configRepo database.DetectorConfigRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := mux.Vars(r)["ticker"]
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := configRepo.DeleteDetectorConfig(ctx, ticker); err != nil {
+			logger.Log.Error("failed to delete detector config", zap.Error(err), zap.String("ticker", ticker))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		if err := publishDetectorConfig(ctx, configRepo, redisClient); err != nil {
+			logger.Log.Warn("failed to publish detector config", zap.Error(err))
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// publishDetectorConfig stores the full detector configuration in Redis and
+// broadcasts it on the control channel so anomaly services apply it live.
+func publishDetectorConfig(ctx context.Context, configRepo database.DetectorConfigRepository, redisClient *redisclient.Client) error {
+	configs, err := configRepo.GetDetectorConfigs(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(configs)
+	if err != nil {
+		return err
+	}
+
+	pipe := redisClient.Client().TxPipeline()
+	pipe.Set(ctx, detectorConfigKey, payload, 0)
+	pipe.Publish(ctx, detectorControlChannel, payload)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// parseFieldsParam returns the JSON field names requested via ?fields=a,b,
+// or nil when the parameter is absent and every field should be returned.
+func parseFieldsParam(r *http.Request) []string {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// sparseList projects each element of the slice items onto the given JSON
+// field names. With no fields the slice is returned unchanged. Unknown field
+// names are rejected so typos don't silently produce empty objects.
+func sparseList(items interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+
+	allowed := jsonFieldNames(reflect.TypeOf(items).Elem())
+	for _, f := range fields {
+		if !allowed[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+	}
+
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var full []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &full); err != nil {
+		return nil, err
+	}
+
+	sparse := make([]map[string]json.RawMessage, len(full))
+	for i, item := range full {
+		sparse[i] = make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := item[f]; ok {
+				sparse[i][f] = v
+			}
+		}
+	}
+	return sparse, nil
+}
+
+// jsonFieldNames returns the JSON names of the exported fields of t (or *t)
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	names := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// writeList writes items in the standard envelope, honouring ?fields=
+func writeList(w http.ResponseWriter, r *http.Request, items interface{}) {
+	data, err := sparseList(items, parseFieldsParam(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+}
@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/auth"
+)
+
+// requireUser returns the auth claims of the operation
+func requireUser(ctx context.Context) (*auth.Claims, error) {
+	user, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return user, nil
+}
+
+// requirePermission returns the auth claims of the operation if they were
+// granted permission
+func requirePermission(ctx context.Context, permission string) (*auth.Claims, error) {
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !user.HasPermission(permission) {
+		return nil, fmt.Errorf("%w: requires permission %s", ErrForbidden, permission)
+	}
+	return user, nil
+}
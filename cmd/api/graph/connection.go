@@ -0,0 +1,233 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// defaultPageSize is used when first is omitted
+	defaultPageSize = 100
+	// MaxPageSize caps first
+	MaxPageSize = 1000
+	// maxStreamScan bounds how many stream entries one page may examine
+	// while applying filters; a page cut short still reports hasNextPage
+	maxStreamScan = 10000
+	// streamScanChunk is the number of entries fetched per XRANGE call
+	streamScanChunk = 500
+)
+
+// SortOrder orders connection results by time
+type SortOrder string
+
+const (
+	SortOrderAsc  SortOrder = "ASC"
+	SortOrderDesc SortOrder = "DESC"
+)
+
+func (e SortOrder) IsValid() bool {
+	switch e {
+	case SortOrderAsc, SortOrderDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortOrder) String() string {
+	return string(e)
+}
+
+func (e *SortOrder) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortOrder", str)
+	}
+	return nil
+}
+
+func (e SortOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
+type QuoteEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Quote `json:"node"`
+}
+
+type QuoteConnection struct {
+	Edges    []*QuoteEdge `json:"edges"`
+	PageInfo *PageInfo    `json:"pageInfo"`
+}
+
+type AnomalyEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Anomaly `json:"node"`
+}
+
+type AnomalyConnection struct {
+	Edges    []*AnomalyEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type QuoteFilter struct {
+	Ticker   *string    `json:"ticker,omitempty"`
+	Sector   *string    `json:"sector,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+	MinPrice *float64   `json:"minPrice,omitempty"`
+	MaxPrice *float64   `json:"maxPrice,omitempty"`
+}
+
+type AnomalyFilter struct {
+	Ticker    *string    `json:"ticker,omitempty"`
+	Severity  *string    `json:"severity,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	MinZScore *float64   `json:"minZScore,omitempty"`
+	MaxZScore *float64   `json:"maxZScore,omitempty"`
+}
+
+// streamIDPattern matches a Redis stream entry ID
+var streamIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// encodeCursor makes a stream entry ID opaque to clients
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// decodeCursor recovers the stream entry ID of a cursor
+func decodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !streamIDPattern.Match(raw) {
+		return "", inputErrorf("invalid cursor %q", cursor)
+	}
+	return string(raw), nil
+}
+
+// pageSize validates first, defaulting to defaultPageSize
+func pageSize(first *int) (int, error) {
+	if first == nil {
+		return defaultPageSize, nil
+	}
+	if *first < 1 || *first > MaxPageSize {
+		return 0, inputErrorf("first must be between 1 and %d", MaxPageSize)
+	}
+	return *first, nil
+}
+
+// streamPage is one page of stream entries that passed a filter
+type streamPage struct {
+	entries []redis.XMessage
+	// hasNext is set when more entries may follow the page
+	hasNext bool
+	// endID is the last entry examined, which may lie past the last kept
+	// entry when the scan budget ran out
+	endID string
+}
+
+// scanStream walks stream in order from the entry after the after cursor,
+// within [since, until], keeping entries accepted by keep until first are
+// kept or maxStreamScan have been examined.
+func (r *Resolver) scanStream(ctx context.Context, stream string, first int, after *string, since, until *time.Time, order SortOrder, keep func(redis.XMessage) bool) (*streamPage, error) {
+	// Incomplete IDs: a bare millisecond timestamp covers every entry in it
+	low, high := "-", "+"
+	if since != nil {
+		low = strconv.FormatInt(since.UnixMilli(), 10)
+	}
+	if until != nil {
+		high = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+	if after != nil {
+		id, err := decodeCursor(*after)
+		if err != nil {
+			return nil, err
+		}
+		if order == SortOrderAsc {
+			low = "(" + id
+		} else {
+			high = "(" + id
+		}
+	}
+
+	page := &streamPage{}
+	scanned := 0
+	for {
+		var (
+			chunk []redis.XMessage
+			err   error
+		)
+		if order == SortOrderAsc {
+			chunk, err = r.redis.Client().XRangeN(ctx, stream, low, high, streamScanChunk).Result()
+		} else {
+			chunk, err = r.redis.Client().XRevRangeN(ctx, stream, high, low, streamScanChunk).Result()
+		}
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		for _, msg := range chunk {
+			if len(page.entries) == first {
+				// Further entries follow the page
+				page.hasNext = true
+				return page, nil
+			}
+			scanned++
+			page.endID = msg.ID
+			if keep(msg) {
+				page.entries = append(page.entries, msg)
+			}
+		}
+
+		if len(chunk) < streamScanChunk {
+			return page, nil
+		}
+		if scanned >= maxStreamScan {
+			page.hasNext = true
+			return page, nil
+		}
+
+		// Continue after the last entry examined
+		if order == SortOrderAsc {
+			low = "(" + page.endID
+		} else {
+			high = "(" + page.endID
+		}
+	}
+}
+
+// pageInfo builds the PageInfo of a page whose edges carry cursors
+func (p *streamPage) pageInfo(after *string, cursors []string) *PageInfo {
+	info := &PageInfo{
+		HasNextPage:     p.hasNext,
+		HasPreviousPage: after != nil,
+	}
+	if len(cursors) > 0 {
+		info.StartCursor = &cursors[0]
+	}
+	// When the scan budget ran out the next page resumes past the entries
+	// examined, not just past the last one kept
+	if p.endID != "" {
+		end := encodeCursor(p.endID)
+		info.EndCursor = &end
+	}
+	return info
+}
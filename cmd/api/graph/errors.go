@@ -0,0 +1,27 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors resolvers wrap so the API's error presenter can give them a stable
+// code; database.ErrNotFound and database.ErrConflict are classified as well.
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("permission denied")
+)
+
+// InputError reports an argument the client has to correct
+type InputError struct {
+	Message string
+}
+
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+// inputErrorf formats an InputError
+func inputErrorf(format string, args ...interface{}) error {
+	return &InputError{Message: fmt.Sprintf(format, args...)}
+}
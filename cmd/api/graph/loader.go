@@ -0,0 +1,188 @@
+package graph
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// loaderWait is how long a batch stays open for further keys after the
+	// first load; sibling fields resolve concurrently well within it
+	loaderWait = time.Millisecond
+	// loaderMaxBatch dispatches a batch early once it holds this many keys
+	loaderMaxBatch = 100
+)
+
+// batchLoader collects the keys requested while resolving one operation and
+// fetches them together. Loads arriving within loaderWait of the first
+// pending one share a single fetch, and each key is fetched at most once per
+// operation. Keys missing from the fetch result load as the zero value.
+type batchLoader[T any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, keys []string) (map[string]T, error)
+
+	mu      sync.Mutex
+	cache   map[string]*loaderEntry[T]
+	pending map[string]*loaderEntry[T]
+}
+
+type loaderEntry[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func newBatchLoader[T any](ctx context.Context, fetch func(ctx context.Context, keys []string) (map[string]T, error)) *batchLoader[T] {
+	return &batchLoader[T]{
+		ctx:     ctx,
+		fetch:   fetch,
+		cache:   make(map[string]*loaderEntry[T]),
+		pending: make(map[string]*loaderEntry[T]),
+	}
+}
+
+// Load returns the value for key, waiting for the batch it joins
+func (l *batchLoader[T]) Load(ctx context.Context, key string) (T, error) {
+	l.mu.Lock()
+	entry, ok := l.cache[key]
+	if !ok {
+		entry = &loaderEntry[T]{done: make(chan struct{})}
+		l.cache[key] = entry
+		l.pending[key] = entry
+		switch len(l.pending) {
+		case 1:
+			time.AfterFunc(loaderWait, l.dispatch)
+		case loaderMaxBatch:
+			go l.dispatch()
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.value, entry.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Prime caches a value fetched elsewhere so later loads of key don't refetch it
+func (l *batchLoader[T]) Prime(key string, value T) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.cache[key]; ok {
+		return
+	}
+	entry := &loaderEntry[T]{done: make(chan struct{}), value: value}
+	close(entry.done)
+	l.cache[key] = entry
+}
+
+// dispatch fetches every pending key and releases their waiters
+func (l *batchLoader[T]) dispatch() {
+	l.mu.Lock()
+	batch := l.pending
+	l.pending = make(map[string]*loaderEntry[T])
+	l.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+
+	values, err := l.fetch(l.ctx, keys)
+	for key, entry := range batch {
+		entry.value = values[key]
+		entry.err = err
+		close(entry.done)
+	}
+}
+
+// loaders are the batch loaders of one GraphQL operation
+type loaders struct {
+	quotes    *batchLoader[*Quote]
+	anomalies *batchLoader[[]*Anomaly]
+}
+
+type loadersKey struct{}
+
+// WithLoaders returns a copy of ctx carrying fresh batch loaders. It is
+// called once per operation so cached values never outlive a request.
+func (r *Resolver) WithLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		quotes:    newBatchLoader(ctx, r.fetchLatestQuotes),
+		anomalies: newBatchLoader(ctx, r.fetchAnomaliesByTicker),
+	})
+}
+
+// loaders returns the operation's batch loaders, or unshared ones when the
+// resolver is invoked outside an operation
+func (r *Resolver) loaders(ctx context.Context) *loaders {
+	if l, ok := ctx.Value(loadersKey{}).(*loaders); ok {
+		return l
+	}
+	return r.WithLoaders(ctx).Value(loadersKey{}).(*loaders)
+}
+
+// fetchLatestQuotes reads the latest-quote hashes of tickers in one
+// pipelined round trip. Tickers without a usable quote are omitted.
+func (r *Resolver) fetchLatestQuotes(ctx context.Context, tickers []string) (map[string]*Quote, error) {
+	hashes, err := r.redis.LatestQuoteHashes(ctx, tickers...)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]*Quote, len(hashes))
+	for ticker, hash := range hashes {
+		if quote, ok := quoteFromHash(ticker, hash); ok {
+			quotes[ticker] = quote
+		}
+	}
+	return quotes, nil
+}
+
+// fetchAnomaliesByTicker reads the most recent anomalies of each ticker in
+// one pipelined round trip
+func (r *Resolver) fetchAnomaliesByTicker(ctx context.Context, tickers []string) (map[string][]*Anomaly, error) {
+	pipe := r.redis.Client().Pipeline()
+	cmds := make(map[string]*redis.StringSliceCmd, len(tickers))
+	for _, ticker := range tickers {
+		cmds[ticker] = pipe.ZRange(ctx, redisclient.AnomalyKey(ticker), -MaxAnomaliesByTicker, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	anomalies := make(map[string][]*Anomaly, len(tickers))
+	for ticker, cmd := range cmds {
+		anomalies[ticker] = anomaliesFromSet(ticker, cmd.Val())
+	}
+	return anomalies, nil
+}
+
+// quoteFromHash parses a quotes:latest:<ticker> hash
+func quoteFromHash(ticker string, data map[string]string) (*Quote, bool) {
+	price, err := strconv.ParseFloat(data["price"], 64)
+	if err != nil {
+		return nil, false
+	}
+	tsMs, err := strconv.ParseInt(data["ts_ms"], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &Quote{
+		Ticker:    ticker,
+		Price:     price,
+		Timestamp: time.UnixMilli(tsMs),
+	}, true
+}
@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"go.uber.org/zap"
 )
 
 // Input types for mutations
@@ -25,16 +30,55 @@ type UpdateAnomalyInput struct {
 	Severity  *string  `json:"severity,omitempty"`
 }
 
+// DetectorConfigInput updates the global detector configuration, or the
+// override of a single ticker when Ticker is set
+type DetectorConfigInput struct {
+	Ticker     *string `json:"ticker,omitempty"`
+	Threshold  float64 `json:"threshold"`
+	WindowSize int     `json:"windowSize"`
+}
+
+type CreateWebhookInput struct {
+	URL        string   `json:"url"`
+	Tickers    []string `json:"tickers,omitempty"`
+	Severities []string `json:"severities,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+type DetectorConfig struct {
+	Ticker     *string   `json:"ticker,omitempty"`
+	Threshold  float64   `json:"threshold"`
+	WindowSize int       `json:"windowSize"`
+	UpdatedBy  *string   `json:"updatedBy,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Webhook is a caller's webhook subscription. Secret is only set in the
+// createWebhook response.
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Tickers    []string  `json:"tickers"`
+	Severities []string  `json:"severities"`
+	Active     bool      `json:"active"`
+	Secret     *string   `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
 func (r *Resolver) CreateAnomaly(ctx context.Context, input CreateAnomalyInput) (*Anomaly, error) {
+	if _, err := requirePermission(ctx, auth.PermAnomaliesWrite); err != nil {
+		return nil, err
+	}
+
 	// Validate required fields
 	if input.Ticker == "" {
-		return nil, fmt.Errorf("ticker is required")
+		return nil, inputErrorf("ticker is required")
 	}
 	if input.Price <= 0 {
-		return nil, fmt.Errorf("price must be positive")
+		return nil, inputErrorf("price must be positive")
 	}
 	if input.Type == "" {
-		return nil, fmt.Errorf("type is required")
+		return nil, inputErrorf("type is required")
 	}
 
 	// Set default values
@@ -85,20 +129,18 @@ func (r *Resolver) CreateAnomaly(ctx context.Context, input CreateAnomalyInput)
 }
 
 func (r *Resolver) UpdateAnomaly(ctx context.Context, id string, input UpdateAnomalyInput) (*Anomaly, error) {
-	// Get all anomalies and find the one to update
-	anomalies, err := r.redis.Client().LRange(ctx, "anomalies", 0, -1).Result()
-	if err != nil && err != redis.Nil {
+	if _, err := requirePermission(ctx, auth.PermAnomaliesWrite); err != nil {
 		return nil, err
 	}
 
 	var updatedAnomaly *Anomaly
 	var anomalyIndex int64 = -1
 
-	// Find the anomaly to update
-	for i, anomalyStr := range anomalies {
+	// Walk the anomalies in chunks to find the one to update
+	err := r.redis.ScanList(ctx, "anomalies", func(i int64, anomalyStr string) error {
 		var anomalyData map[string]interface{}
 		if err := json.Unmarshal([]byte(anomalyStr), &anomalyData); err != nil {
-			continue
+			return nil
 		}
 
 		if anomalyData["id"] == id {
@@ -126,13 +168,17 @@ func (r *Resolver) UpdateAnomaly(ctx context.Context, id string, input UpdateAno
 				Timestamp: time.UnixMilli(int64(anomalyData["timestamp"].(float64))),
 				Severity:  anomalyData["severity"].(string),
 			}
-			anomalyIndex = int64(i)
-			break
+			anomalyIndex = i
+			return redisclient.ErrStopScan
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	if updatedAnomaly == nil {
-		return nil, fmt.Errorf("anomaly not found")
+		return nil, fmt.Errorf("anomaly %s: %w", id, database.ErrNotFound)
 	}
 
 	// Update the anomaly in Redis
@@ -153,33 +199,34 @@ func (r *Resolver) UpdateAnomaly(ctx context.Context, id string, input UpdateAno
 }
 
 func (r *Resolver) DeleteAnomaly(ctx context.Context, id string) (bool, error) {
-	// Get all anomalies and find the one to delete
-	anomalies, err := r.redis.Client().LRange(ctx, "anomalies", 0, -1).Result()
-	if err != nil && err != redis.Nil {
+	if _, err := requirePermission(ctx, auth.PermAnomaliesWrite); err != nil {
 		return false, err
 	}
 
-	var anomalyIndex int64 = -1
-
-	// Find the anomaly to delete
-	for i, anomalyStr := range anomalies {
+	// Walk the anomalies in chunks to find the one to delete
+	var found string
+	err := r.redis.ScanList(ctx, "anomalies", func(_ int64, anomalyStr string) error {
 		var anomalyData map[string]interface{}
 		if err := json.Unmarshal([]byte(anomalyStr), &anomalyData); err != nil {
-			continue
+			return nil
 		}
 
 		if anomalyData["id"] == id {
-			anomalyIndex = int64(i)
-			break
+			found = anomalyStr
+			return redisclient.ErrStopScan
 		}
+		return nil
+	})
+	if err != nil {
+		return false, err
 	}
 
-	if anomalyIndex == -1 {
-		return false, fmt.Errorf("anomaly not found")
+	if found == "" {
+		return false, fmt.Errorf("anomaly %s: %w", id, database.ErrNotFound)
 	}
 
 	// Remove the anomaly from Redis
-	err = r.redis.Client().LRem(ctx, "anomalies", 1, anomalies[anomalyIndex]).Err()
+	err = r.redis.Client().LRem(ctx, "anomalies", 1, found).Err()
 	if err != nil {
 		return false, err
 	}
@@ -193,4 +240,130 @@ func (r *Resolver) DeleteAnomaly(ctx context.Context, id string) (bool, error) {
 	r.redis.Publish(ctx, "anomalies", deletionJSON)
 
 	return true, nil
-} 
\ No newline at end of file
+} 
+
+// UpdateDetectorConfig saves detector configuration (requires admin:detector) and pushes
+// it to running anomaly services
+func (r *Resolver) UpdateDetectorConfig(ctx context.Context, input DetectorConfigInput) (*DetectorConfig, error) {
+	user, err := requirePermission(ctx, auth.PermAdminDetector)
+	if err != nil {
+		return nil, err
+	}
+
+	config := models.DetectorConfig{
+		Threshold:  input.Threshold,
+		WindowSize: input.WindowSize,
+		UpdatedBy:  user.Username,
+	}
+	if input.Ticker != nil {
+		config.Ticker = *input.Ticker
+	}
+
+	config.Sanitize()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.detectorConfigs.SaveDetectorConfig(ctx, &config); err != nil {
+		logger.Log.Error("failed to save detector config", zap.Error(err), zap.String("ticker", config.Ticker))
+		return nil, err
+	}
+
+	if err := r.publishDetectorConfig(ctx); err != nil {
+		logger.Log.Warn("failed to publish detector config", zap.Error(err))
+	}
+
+	result := &DetectorConfig{
+		Threshold:  config.Threshold,
+		WindowSize: config.WindowSize,
+		UpdatedAt:  config.UpdatedAt,
+	}
+	if config.Ticker != "" {
+		result.Ticker = &config.Ticker
+	}
+	if config.UpdatedBy != "" {
+		result.UpdatedBy = &config.UpdatedBy
+	}
+	return result, nil
+}
+
+// CreateWebhook registers a webhook owned by the caller. The signing secret
+// is only returned here.
+func (r *Resolver) CreateWebhook(ctx context.Context, input CreateWebhookInput) (*Webhook, error) {
+	user, err := requirePermission(ctx, auth.PermWebhooksWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := models.NewWebhookSecret()
+	if err != nil {
+		logger.Log.Error("failed to generate webhook secret", zap.Error(err))
+		return nil, err
+	}
+
+	webhook := models.Webhook{
+		OwnerID:    user.UserID,
+		URL:        input.URL,
+		Secret:     secret,
+		Tickers:    input.Tickers,
+		Severities: input.Severities,
+		Active:     input.Active == nil || *input.Active,
+	}
+
+	webhook.Sanitize()
+	if err := webhook.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.webhooks.CreateWebhook(ctx, &webhook); err != nil {
+		logger.Log.Error("failed to create webhook", zap.Error(err))
+		return nil, err
+	}
+
+	return &Webhook{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		Tickers:    webhook.Tickers,
+		Severities: webhook.Severities,
+		Active:     webhook.Active,
+		Secret:     &webhook.Secret,
+		CreatedAt:  webhook.CreatedAt,
+	}, nil
+}
+
+// AcknowledgeAnomaly marks an anomaly as handled (requires admin:anomalies).
+// id is the Anomaly id returned by anomalies and anomalyDetected, the
+// anomaly's stream entry, which is resolved to its stored row by ticker and
+// timestamp.
+func (r *Resolver) AcknowledgeAnomaly(ctx context.Context, id string) (bool, error) {
+	user, err := requirePermission(ctx, auth.PermAdminAnomalies)
+	if err != nil {
+		return false, err
+	}
+
+	if !streamIDPattern.MatchString(id) {
+		return false, inputErrorf("invalid anomaly id %q", id)
+	}
+	entries, err := r.redis.Client().XRangeN(ctx, anomaliesStream, id, id, 1).Result()
+	if err != nil {
+		logger.Log.Error("failed to read anomaly", zap.Error(err), zap.String("id", id))
+		return false, err
+	}
+	if len(entries) == 0 {
+		return false, fmt.Errorf("anomaly %s: %w", id, database.ErrNotFound)
+	}
+	anomaly, err := models.AnomalyFromMap(entries[0].Values)
+	if err != nil {
+		return false, fmt.Errorf("anomaly %s: %w", id, err)
+	}
+
+	anomalyID, err := r.manualAnomalies.GetAnomalyIDAt(ctx, anomaly.Ticker, anomaly.Timestamp)
+	if err != nil {
+		return false, err
+	}
+	if err := r.manualAnomalies.AcknowledgeAnomaly(ctx, anomalyID, user.Username); err != nil {
+		logger.Log.Error("failed to acknowledge anomaly", zap.Error(err), zap.String("id", id), zap.Int64("row", anomalyID))
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// fakeDetectorConfigRepo records saved detector configs; other methods
+// panic through the nil embedded interface
+type fakeDetectorConfigRepo struct {
+	database.DetectorConfigRepository
+	saved []*models.DetectorConfig
+}
+
+func (f *fakeDetectorConfigRepo) SaveDetectorConfig(ctx context.Context, config *models.DetectorConfig) error {
+	f.saved = append(f.saved, config)
+	return nil
+}
+
+// fakeWebhookRepo records created webhooks
+type fakeWebhookRepo struct {
+	database.WebhookRepository
+	created []*models.Webhook
+}
+
+func (f *fakeWebhookRepo) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.ID = int64(len(f.created) + 1)
+	f.created = append(f.created, webhook)
+	return nil
+}
+
+// asUser returns ctx carrying claims of user holding permissions
+func asUser(userID string, permissions ...string) context.Context {
+	return auth.SetUser(context.Background(), &auth.Claims{UserID: userID, Username: "user" + userID, Permissions: permissions})
+}
+
+func TestUpdateDetectorConfig_RequiresAdminDetector(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := &fakeDetectorConfigRepo{}
+	published := 0
+	r := &Resolver{detectorConfigs: repo, publishDetectorConfig: func(ctx context.Context) error {
+		published++
+		return nil
+	}}
+	input := DetectorConfigInput{Threshold: 3.5, WindowSize: 100}
+
+	if _, err := r.UpdateDetectorConfig(context.Background(), input); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("anonymous err = %v; want %v", err, ErrUnauthenticated)
+	}
+	if _, err := r.UpdateDetectorConfig(asUser("1", auth.PermAnomaliesRead, auth.PermAdminUsers), input); !errors.Is(err, ErrForbidden) {
+		t.Errorf("non-admin err = %v; want %v", err, ErrForbidden)
+	}
+	if len(repo.saved) != 0 || published != 0 {
+		t.Fatalf("saved %d configs and published %d times without permission", len(repo.saved), published)
+	}
+
+	config, err := r.UpdateDetectorConfig(asUser("2", "admin:*"), input)
+	if err != nil {
+		t.Fatalf("UpdateDetectorConfig: %v", err)
+	}
+	if len(repo.saved) != 1 || published != 1 {
+		t.Errorf("saved %d configs and published %d times; want 1 and 1", len(repo.saved), published)
+	}
+	if config.UpdatedBy == nil || *config.UpdatedBy != "user2" {
+		t.Errorf("updatedBy = %v; want user2", config.UpdatedBy)
+	}
+}
+
+func TestCreateWebhook_OwnedByCaller(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := &fakeWebhookRepo{}
+	r := &Resolver{webhooks: repo}
+
+	if _, err := r.CreateWebhook(asUser("1", auth.PermQuotesRead), CreateWebhookInput{URL: "https://hooks.example.com/a"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("without webhooks:write err = %v; want %v", err, ErrForbidden)
+	}
+	if _, err := r.CreateWebhook(asUser("1", auth.PermWebhooksWrite), CreateWebhookInput{URL: "https://169.254.169.254/latest"}); err == nil {
+		t.Error("CreateWebhook accepted a link-local URL")
+	}
+	if len(repo.created) != 0 {
+		t.Fatalf("created %d webhooks; want none", len(repo.created))
+	}
+
+	webhook, err := r.CreateWebhook(asUser("7", auth.PermWebhooksWrite), CreateWebhookInput{URL: "https://hooks.example.com/a"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if len(repo.created) != 1 || repo.created[0].OwnerID != "7" {
+		t.Errorf("created = %+v; want one webhook owned by 7", repo.created)
+	}
+	if webhook.Secret == nil || *webhook.Secret == "" {
+		t.Error("secret not returned on creation")
+	}
+}
+
+func TestAcknowledgeAnomaly_RequiresAdminAnomalies(t *testing.T) {
+	logger.Log = zap.NewNop()
+	r := &Resolver{}
+
+	if _, err := r.AcknowledgeAnomaly(asUser("1", auth.PermAnomaliesRead, auth.PermAnomaliesWrite), "1700000000000-0"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("without admin:anomalies err = %v; want %v", err, ErrForbidden)
+	}
+
+	var inputErr *InputError
+	if _, err := r.AcknowledgeAnomaly(asUser("2", auth.PermAdminAnomalies), "42"); !errors.As(err, &inputErr) {
+		t.Errorf("Postgres id err = %v; want an InputError", err)
+	}
+}
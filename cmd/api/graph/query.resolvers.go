@@ -2,11 +2,13 @@ package graph
 
 import (
 	"context"
-	"encoding/json"
-	"strconv"
+	"errors"
 	"time"
 
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
 	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
 	"github.com/go-redis/redis/v8"
 	"github.com/alim08/fin_line/pkg/metrics"
 	"github.com/alim08/fin_line/pkg/logger"
@@ -31,6 +33,19 @@ type Anomaly struct {
 	Severity  string    `json:"severity"`
 }
 
+// Ticker is an entry of the tickers reference table
+type Ticker struct {
+	Symbol string  `json:"symbol"`
+	Name   *string `json:"name,omitempty"`
+	Sector string  `json:"sector"`
+	Active bool    `json:"active"`
+}
+
+type Sector struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+}
+
 type MarketStats struct {
 	TotalTickers int       `json:"total_tickers"`
 	TotalQuotes  int       `json:"total_quotes"`
@@ -38,116 +53,104 @@ type MarketStats struct {
 	LastUpdate   time.Time `json:"last_update"`
 }
 
-func (r *Resolver) Quotes(ctx context.Context, limit *int, ticker *string, sector *string) ([]*Quote, error) {
+func (r *Resolver) Quotes(ctx context.Context, first *int, after *string, filter *QuoteFilter, order SortOrder) (*QuoteConnection, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/quotes", "200").Observe(time.Since(start).Seconds())
 		metrics.APIRequestTotal.WithLabelValues("GET", "/quotes", "200").Inc()
 	}()
 
-	// Set default limit
-	queryLimit := 100
-	if limit != nil && *limit > 0 && *limit <= 1000 {
-		queryLimit = *limit
+	size, err := pageSize(first)
+	if err != nil {
+		return nil, err
 	}
-
-	// Get quotes from Redis stream
-	streamKey := "normalized:events"
-	args := &redis.XReadArgs{
-		Streams: []string{streamKey, "0"},
-		Count:   int64(queryLimit),
-		Block:   100 * time.Millisecond,
+	if filter == nil {
+		filter = &QuoteFilter{}
 	}
 
-	streams, err := r.redis.Client().XRead(ctx, args).Result()
-	if err != nil && err != redis.Nil {
+	// Page through the normalized quote stream, newest first by default
+	ticks := make(map[string]models.NormalizedTick)
+	page, err := r.scanStream(ctx, "normalized:events", size, after, filter.Since, filter.Until, order, func(msg redis.XMessage) bool {
+		normalizedTick, err := models.NormalizedTickFromMap(msg.Values)
+		if err != nil {
+			logger.Log.Warn("failed to parse normalized tick", zap.Error(err), zap.String("id", msg.ID))
+			return false
+		}
+
+		// Apply filters
+		if filter.Ticker != nil && normalizedTick.Ticker != *filter.Ticker {
+			return false
+		}
+		if filter.Sector != nil && normalizedTick.Sector != *filter.Sector {
+			return false
+		}
+		if filter.MinPrice != nil && normalizedTick.Price < *filter.MinPrice {
+			return false
+		}
+		if filter.MaxPrice != nil && normalizedTick.Price > *filter.MaxPrice {
+			return false
+		}
+
+		ticks[msg.ID] = normalizedTick
+		return true
+	})
+	if err != nil {
 		logger.Log.Error("failed to read quotes stream", zap.Error(err))
 		return nil, err
 	}
 
-	var quotes []*Quote
-	if len(streams) > 0 && len(streams[0].Messages) > 0 {
-		for _, msg := range streams[0].Messages {
-			// Use the enhanced model parsing
-			normalizedTick, err := models.NormalizedTickFromMap(msg.Values)
-			if err != nil {
-				logger.Log.Warn("failed to parse normalized tick", zap.Error(err), zap.String("id", msg.ID))
-				continue
-			}
-
-			// Apply filters
-			if ticker != nil && normalizedTick.Ticker != *ticker {
-				continue
-			}
-			if sector != nil && normalizedTick.Sector != *sector {
-				continue
-			}
-
-			quotes = append(quotes, &Quote{
+	conn := &QuoteConnection{Edges: make([]*QuoteEdge, 0, len(page.entries))}
+	cursors := make([]string, 0, len(page.entries))
+	for _, msg := range page.entries {
+		normalizedTick := ticks[msg.ID]
+		cursor := encodeCursor(msg.ID)
+		cursors = append(cursors, cursor)
+		conn.Edges = append(conn.Edges, &QuoteEdge{
+			Cursor: cursor,
+			Node: &Quote{
 				Ticker:    normalizedTick.Ticker,
 				Price:     normalizedTick.Price,
 				Timestamp: time.UnixMilli(normalizedTick.Timestamp),
 				Sector:    &normalizedTick.Sector,
-			})
-		}
+			},
+		})
 	}
+	conn.PageInfo = page.pageInfo(after, cursors)
 
-	return quotes, nil
+	return conn, nil
 }
 
 func (r *Resolver) Quote(ctx context.Context, ticker string) (*Quote, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/quote", "200").Observe(time.Since(start).Seconds())
 		metrics.APIRequestTotal.WithLabelValues("GET", "/quote", "200").Inc()
 	}()
 
-	// Get the latest quote for this ticker from Redis hash
-	hashKey := "quotes:latest:" + ticker
-	data, err := r.redis.HGetAll(ctx, hashKey).Result()
+	// Get the latest quote for this ticker; lookups from sibling fields are
+	// batched into one pipelined round trip
+	quote, err := r.loaders(ctx).quotes.Load(ctx, ticker)
 	if err != nil {
 		logger.Log.Error("failed to get quote hash", zap.Error(err), zap.String("ticker", ticker))
 		return nil, err
 	}
 
-	if len(data) == 0 {
-		return nil, nil // Not found
-	}
-
-	// Parse price and timestamp
-	priceStr, ok := data["price"]
-	if !ok {
-		logger.Log.Warn("missing price in quote hash", zap.String("ticker", ticker))
-		return nil, nil
-	}
-
-	price, err := strconv.ParseFloat(priceStr, 64)
-	if err != nil {
-		logger.Log.Warn("invalid price in quote hash", zap.Error(err), zap.String("ticker", ticker))
-		return nil, nil
-	}
-
-	tsMsStr, ok := data["ts_ms"]
-	if !ok {
-		logger.Log.Warn("missing timestamp in quote hash", zap.String("ticker", ticker))
-		return nil, nil
-	}
-
-	tsMs, err := strconv.ParseInt(tsMsStr, 10, 64)
-	if err != nil {
-		logger.Log.Warn("invalid timestamp in quote hash", zap.Error(err), zap.String("ticker", ticker))
-		return nil, nil
-	}
-
-	return &Quote{
-		Ticker:    ticker,
-		Price:     price,
-		Timestamp: time.UnixMilli(tsMs),
-		Sector:    nil, // Would need to get from separate lookup
-	}, nil
+	return quote, nil // nil when not found
 }
 
 func (r *Resolver) LatestQuotes(ctx context.Context) ([]*Quote, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/latest-quotes", "200").Observe(time.Since(start).Seconds())
@@ -155,213 +158,242 @@ func (r *Resolver) LatestQuotes(ctx context.Context) ([]*Quote, error) {
 	}()
 
 	// Get all quote hashes
-	pattern := "quotes:latest:*"
-	keys, err := r.redis.Client().Keys(ctx, pattern).Result()
+	pattern := redisclient.LatestQuoteKeyPrefix + "*"
+	keys, err := r.redis.Keys(ctx, pattern)
 	if err != nil {
 		logger.Log.Error("failed to get quote keys", zap.Error(err))
 		return nil, err
 	}
 
-	var quotes []*Quote
+	tickers := make([]string, 0, len(keys))
 	for _, key := range keys {
-		// Extract ticker from key
-		ticker := key[len("quotes:latest:"):]
-		
-		// Get quote data
-		data, err := r.redis.HGetAll(ctx, key).Result()
-		if err != nil {
-			logger.Log.Warn("failed to get quote hash", zap.Error(err), zap.String("key", key))
-			continue
-		}
-
-		if len(data) == 0 {
-			continue
-		}
-
-		// Parse data
-		priceStr, ok := data["price"]
-		if !ok {
-			continue
-		}
+		tickers = append(tickers, key[len(redisclient.LatestQuoteKeyPrefix):])
+	}
 
-		price, err := strconv.ParseFloat(priceStr, 64)
-		if err != nil {
-			continue
-		}
+	// Fetch every hash in one pipelined round trip
+	latest, err := r.fetchLatestQuotes(ctx, tickers)
+	if err != nil {
+		logger.Log.Error("failed to get quote hashes", zap.Error(err))
+		return nil, err
+	}
 
-		tsMsStr, ok := data["ts_ms"]
+	quoteLoader := r.loaders(ctx).quotes
+	var quotes []*Quote
+	for _, ticker := range tickers {
+		quote, ok := latest[ticker]
 		if !ok {
 			continue
 		}
-
-		tsMs, err := strconv.ParseInt(tsMsStr, 10, 64)
-		if err != nil {
-			continue
-		}
-
-		quotes = append(quotes, &Quote{
-			Ticker:    ticker,
-			Price:     price,
-			Timestamp: time.UnixMilli(tsMs),
-			Sector:    nil,
-		})
+		quoteLoader.Prime(ticker, quote)
+		quotes = append(quotes, quote)
 	}
 
 	return quotes, nil
 }
 
-func (r *Resolver) Anomalies(ctx context.Context, limit *int, severity *string, typeArg *string) ([]*Anomaly, error) {
+func (r *Resolver) Anomalies(ctx context.Context, first *int, after *string, filter *AnomalyFilter, order SortOrder) (*AnomalyConnection, error) {
+	if _, err := requirePermission(ctx, auth.PermAnomaliesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/anomalies", "200").Observe(time.Since(start).Seconds())
 		metrics.APIRequestTotal.WithLabelValues("GET", "/anomalies", "200").Inc()
 	}()
 
-	// Set default limit
-	queryLimit := 100
-	if limit != nil && *limit > 0 && *limit <= 1000 {
-		queryLimit = *limit
+	size, err := pageSize(first)
+	if err != nil {
+		return nil, err
 	}
-
-	// Get anomalies from Redis stream
-	streamKey := "anomalies:stream"
-	args := &redis.XReadArgs{
-		Streams: []string{streamKey, "0"},
-		Count:   int64(queryLimit),
-		Block:   100 * time.Millisecond,
+	if filter == nil {
+		filter = &AnomalyFilter{}
 	}
 
-	streams, err := r.redis.Client().XRead(ctx, args).Result()
-	if err != nil && err != redis.Nil {
+	// Page through the detector's anomaly stream, newest first by default
+	anomalies := make(map[string]models.Anomaly)
+	page, err := r.scanStream(ctx, "anomalies:stream", size, after, filter.Since, filter.Until, order, func(msg redis.XMessage) bool {
+		anomaly, err := models.AnomalyFromMap(msg.Values)
+		if err != nil {
+			logger.Log.Warn("failed to parse anomaly", zap.Error(err), zap.String("id", msg.ID))
+			return false
+		}
+
+		// Apply filters
+		if filter.Ticker != nil && anomaly.Ticker != *filter.Ticker {
+			return false
+		}
+		if filter.Severity != nil && anomaly.Severity() != *filter.Severity {
+			return false
+		}
+		if filter.MinZScore != nil && anomaly.ZScore < *filter.MinZScore {
+			return false
+		}
+		if filter.MaxZScore != nil && anomaly.ZScore > *filter.MaxZScore {
+			return false
+		}
+
+		anomalies[msg.ID] = anomaly
+		return true
+	})
+	if err != nil {
 		logger.Log.Error("failed to read anomalies stream", zap.Error(err))
 		return nil, err
 	}
 
-	var result []*Anomaly
-	if len(streams) > 0 && len(streams[0].Messages) > 0 {
-		for _, msg := range streams[0].Messages {
-			// Parse anomaly data
-			anomaly, err := models.AnomalyFromMap(msg.Values)
-			if err != nil {
-				logger.Log.Warn("failed to parse anomaly", zap.Error(err), zap.String("id", msg.ID))
-				continue
-			}
-
-			// Apply filters
-			if severity != nil {
-				// Would need severity field in Anomaly model
-				// For now, skip filtering
-			}
-			if typeArg != nil {
-				// Would need type field in Anomaly model
-				// For now, skip filtering
-			}
-
-			result = append(result, &Anomaly{
+	conn := &AnomalyConnection{Edges: make([]*AnomalyEdge, 0, len(page.entries))}
+	cursors := make([]string, 0, len(page.entries))
+	for _, msg := range page.entries {
+		anomaly := anomalies[msg.ID]
+		cursor := encodeCursor(msg.ID)
+		cursors = append(cursors, cursor)
+		conn.Edges = append(conn.Edges, &AnomalyEdge{
+			Cursor: cursor,
+			Node: &Anomaly{
 				ID:        msg.ID,
 				Ticker:    anomaly.Ticker,
 				Price:     anomaly.Price,
 				Threshold: anomaly.ZScore,
 				Type:      "price_spike", // Default type
 				Timestamp: time.UnixMilli(anomaly.Timestamp),
-				Severity:  "medium", // Default severity
-			})
-		}
+				Severity:  anomaly.Severity(),
+			},
+		})
 	}
+	conn.PageInfo = page.pageInfo(after, cursors)
 
-	return result, nil
+	return conn, nil
 }
 
+// MaxAnomaliesByTicker caps how many of a ticker's most recent anomalies
+// anomaliesByTicker returns, so one query cannot read an unbounded set
+const MaxAnomaliesByTicker = 1000
+
 func (r *Resolver) AnomaliesByTicker(ctx context.Context, ticker string) ([]*Anomaly, error) {
+	if _, err := requirePermission(ctx, auth.PermAnomaliesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/anomalies-by-ticker", "200").Observe(time.Since(start).Seconds())
 		metrics.APIRequestTotal.WithLabelValues("GET", "/anomalies-by-ticker", "200").Inc()
 	}()
 
-	// Get anomalies from sorted set for specific ticker
-	key := "anomalies:" + ticker
-	anomalies, err := r.redis.Client().ZRange(ctx, key, 0, -1).Result()
-	if err != nil && err != redis.Nil {
+	// Get the most recent anomalies from sorted set for specific ticker;
+	// lookups from sibling fields are batched into one pipelined round trip
+	anomalies, err := r.loaders(ctx).anomalies.Load(ctx, ticker)
+	if err != nil {
 		logger.Log.Error("failed to get anomalies by ticker", zap.Error(err), zap.String("ticker", ticker))
 		return nil, err
 	}
 
+	return anomalies, nil
+}
+
+// anomaliesFromSet parses the members of an anomalies:<ticker> sorted set
+func anomaliesFromSet(ticker string, members []string) []*Anomaly {
 	var result []*Anomaly
-	for _, anomalyStr := range anomalies {
-		var anomalyData map[string]interface{}
-		if err := json.Unmarshal([]byte(anomalyStr), &anomalyData); err != nil {
+	for _, member := range members {
+		a, err := redisclient.DecodeAnomaly(ticker, member)
+		if err != nil {
 			logger.Log.Warn("failed to unmarshal anomaly", zap.Error(err))
 			continue
 		}
 
-		// Parse fields
-		price, ok := anomalyData["price"].(float64)
-		if !ok {
-			continue
-		}
-
-		zScore, ok := anomalyData["z"].(float64)
-		if !ok {
-			continue
-		}
-
-		tsMs, ok := anomalyData["ts_ms"].(float64)
-		if !ok {
-			continue
-		}
-
 		result = append(result, &Anomaly{
 			ID:        "generated", // Would need proper ID
-			Ticker:    ticker,
-			Price:     price,
-			Threshold: zScore,
+			Ticker:    a.Ticker,
+			Price:     a.Price,
+			Threshold: a.ZScore,
 			Type:      "price_spike",
-			Timestamp: time.UnixMilli(int64(tsMs)),
+			Timestamp: time.UnixMilli(a.Timestamp),
 			Severity:  "medium",
 		})
 	}
 
-	return result, nil
+	return result
 }
 
-func (r *Resolver) Tickers(ctx context.Context) ([]string, error) {
+func (r *Resolver) Tickers(ctx context.Context, activeOnly bool, sector *string) ([]*Ticker, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/tickers", "200").Observe(time.Since(start).Seconds())
 		metrics.APIRequestTotal.WithLabelValues("GET", "/tickers", "200").Inc()
 	}()
 
-	// Get all ticker keys
-	pattern := "quotes:latest:*"
-	keys, err := r.redis.Client().Keys(ctx, pattern).Result()
+	tickers, err := r.tickers.GetTickers(ctx, activeOnly)
 	if err != nil {
-		logger.Log.Error("failed to get ticker keys", zap.Error(err))
+		logger.Log.Error("failed to get tickers", zap.Error(err))
 		return nil, err
 	}
 
-	var tickers []string
-	for _, key := range keys {
-		ticker := key[len("quotes:latest:"):]
-		tickers = append(tickers, ticker)
+	result := make([]*Ticker, 0, len(tickers))
+	for _, ticker := range tickers {
+		if sector != nil && ticker.Sector != *sector {
+			continue
+		}
+		t := &Ticker{
+			Symbol: ticker.Symbol,
+			Sector: ticker.Sector,
+			Active: ticker.Active,
+		}
+		if ticker.Name != "" {
+			t.Name = &ticker.Name
+		}
+		result = append(result, t)
 	}
+	return result, nil
+}
 
-	return tickers, nil
+// LatestQuote resolves Ticker.latestQuote through the operation's quote
+// loader, so listing tickers costs one Redis round trip per batch
+func (r *Resolver) LatestQuote(ctx context.Context, obj *Ticker) (*Quote, error) {
+	quote, err := r.loaders(ctx).quotes.Load(ctx, obj.Symbol)
+	if err != nil {
+		logger.Log.Error("failed to get latest quote", zap.Error(err), zap.String("ticker", obj.Symbol))
+		return nil, err
+	}
+	return quote, nil
 }
 
-func (r *Resolver) Sectors(ctx context.Context) ([]string, error) {
+func (r *Resolver) Sectors(ctx context.Context) ([]*Sector, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/sectors", "200").Observe(time.Since(start).Seconds())
 		metrics.APIRequestTotal.WithLabelValues("GET", "/sectors", "200").Inc()
 	}()
 
-	// This would need to be implemented based on your sector data
-	// For now, return a static list
-	return []string{"crypto", "stocks", "forex", "commodities"}, nil
+	sectors, err := r.sectors.GetSectors(ctx)
+	if err != nil {
+		logger.Log.Error("failed to get sectors", zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]*Sector, 0, len(sectors))
+	for _, sector := range sectors {
+		s := &Sector{Name: sector.Name}
+		if sector.Description != "" {
+			s.Description = &sector.Description
+		}
+		result = append(result, s)
+	}
+	return result, nil
 }
 
 func (r *Resolver) MarketStats(ctx context.Context) (*MarketStats, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		metrics.APIRequestDuration.WithLabelValues("GET", "/market-stats", "200").Observe(time.Since(start).Seconds())
@@ -369,8 +401,8 @@ func (r *Resolver) MarketStats(ctx context.Context) (*MarketStats, error) {
 	}()
 
 	// Get all ticker keys
-	pattern := "quotes:latest:*"
-	keys, err := r.redis.Client().Keys(ctx, pattern).Result()
+	pattern := redisclient.LatestQuoteKeyPrefix + "*"
+	keys, err := r.redis.Keys(ctx, pattern)
 	if err != nil {
 		logger.Log.Error("failed to get market stats", zap.Error(err))
 		return nil, err
@@ -381,30 +413,25 @@ func (r *Resolver) MarketStats(ctx context.Context) (*MarketStats, error) {
 	var totalPrice float64
 	var lastUpdate time.Time
 
-	// Calculate stats from all quotes
+	tickers := make([]string, 0, len(keys))
 	for _, key := range keys {
-		data, err := r.redis.HGetAll(ctx, key).Result()
-		if err != nil {
-			continue
-		}
+		tickers = append(tickers, key[len(redisclient.LatestQuoteKeyPrefix):])
+	}
 
-		if len(data) > 0 {
-			totalQuotes++
-			
-			if priceStr, ok := data["price"]; ok {
-				if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-					totalPrice += price
-				}
-			}
+	// Fetch every hash in one pipelined round trip. The loader cache is
+	// bypassed: marketUpdate recomputes stats within one long-lived operation.
+	latest, err := r.fetchLatestQuotes(ctx, tickers)
+	if err != nil {
+		logger.Log.Error("failed to get market stats", zap.Error(err))
+		return nil, err
+	}
 
-			if tsMsStr, ok := data["ts_ms"]; ok {
-				if tsMs, err := strconv.ParseInt(tsMsStr, 10, 64); err == nil {
-					ts := time.UnixMilli(tsMs)
-					if ts.After(lastUpdate) {
-						lastUpdate = ts
-					}
-				}
-			}
+	// Calculate stats from all quotes
+	for _, quote := range latest {
+		totalQuotes++
+		totalPrice += quote.Price
+		if quote.Timestamp.After(lastUpdate) {
+			lastUpdate = quote.Timestamp
 		}
 	}
 
@@ -420,4 +447,157 @@ func (r *Resolver) MarketStats(ctx context.Context) (*MarketStats, error) {
 		AvgPrice:     avgPrice,
 		LastUpdate:   lastUpdate,
 	}, nil
-} 
\ No newline at end of file
+} 
+// Candle is an OHLC summary of a ticker's quotes over [Start, End)
+type Candle struct {
+	Ticker string    `json:"ticker"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Count  int       `json:"count"`
+}
+
+// candleIntervals are the bucket widths accepted by candles and quoteHistory
+var candleIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// ParseInterval resolves a candle interval name such as "5m"
+func ParseInterval(name string) (time.Duration, error) {
+	interval, ok := candleIntervals[name]
+	if !ok {
+		return 0, inputErrorf("invalid interval %q: use 1m, 5m, 15m, 30m, 1h, 4h or 1d", name)
+	}
+	return interval, nil
+}
+
+// historyRange converts the start/end arguments to milliseconds, defaulting end to now
+func historyRange(start time.Time, end *time.Time) (int64, int64) {
+	endTime := time.Now()
+	if end != nil {
+		endTime = *end
+	}
+	return start.UnixMilli(), endTime.UnixMilli()
+}
+
+func (r *Resolver) QuoteHistory(ctx context.Context, ticker string, start time.Time, end *time.Time, interval *string, limit *int) ([]*Quote, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	defer func() {
+		metrics.APIRequestDuration.WithLabelValues("GET", "/quote-history", "200").Observe(time.Since(startTime).Seconds())
+		metrics.APIRequestTotal.WithLabelValues("GET", "/quote-history", "200").Inc()
+	}()
+
+	since, until := historyRange(start, end)
+
+	// Sampled history: the close of each candle
+	if interval != nil {
+		width, err := ParseInterval(*interval)
+		if err != nil {
+			return nil, err
+		}
+
+		candles, err := r.quotes.GetCandles(ctx, ticker, since, until, width)
+		if err != nil {
+			if !errors.Is(err, database.ErrInvalidRange) {
+				logger.Log.Error("failed to get quote history", zap.Error(err), zap.String("ticker", ticker))
+			}
+			return nil, err
+		}
+
+		quotes := make([]*Quote, 0, len(candles))
+		for _, candle := range candles {
+			quotes = append(quotes, &Quote{
+				Ticker:    ticker,
+				Price:     candle.Close,
+				Timestamp: time.UnixMilli(candle.Start),
+			})
+		}
+		return quotes, nil
+	}
+
+	// Raw history, oldest first
+	queryLimit := 1000
+	if limit != nil && *limit > 0 && *limit <= 1000 {
+		queryLimit = *limit
+	}
+
+	ticks, err := r.quotes.ListQuotes(ctx, database.QuoteFilter{
+		Ticker: ticker,
+		ListOptions: database.ListOptions{
+			SortBy: "timestamp",
+			Since:  &since,
+			Until:  &until,
+			Limit:  queryLimit,
+		},
+	})
+	if err != nil {
+		logger.Log.Error("failed to get quote history", zap.Error(err), zap.String("ticker", ticker))
+		return nil, err
+	}
+
+	quotes := make([]*Quote, 0, len(ticks))
+	for _, tick := range ticks {
+		sector := tick.Sector
+		quotes = append(quotes, &Quote{
+			Ticker:    tick.Ticker,
+			Price:     tick.Price,
+			Timestamp: time.UnixMilli(tick.Timestamp),
+			Sector:    &sector,
+		})
+	}
+	return quotes, nil
+}
+
+func (r *Resolver) Candles(ctx context.Context, ticker string, start time.Time, end *time.Time, interval string) ([]*Candle, error) {
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	defer func() {
+		metrics.APIRequestDuration.WithLabelValues("GET", "/candles", "200").Observe(time.Since(startTime).Seconds())
+		metrics.APIRequestTotal.WithLabelValues("GET", "/candles", "200").Inc()
+	}()
+
+	width, err := ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	since, until := historyRange(start, end)
+	candles, err := r.quotes.GetCandles(ctx, ticker, since, until, width)
+	if err != nil {
+		if !errors.Is(err, database.ErrInvalidRange) {
+			logger.Log.Error("failed to get candles", zap.Error(err), zap.String("ticker", ticker))
+		}
+		return nil, err
+	}
+
+	result := make([]*Candle, 0, len(candles))
+	for _, candle := range candles {
+		result = append(result, &Candle{
+			Ticker: candle.Ticker,
+			Start:  time.UnixMilli(candle.Start),
+			End:    time.UnixMilli(candle.End),
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Count:  int(candle.Count),
+		})
+	}
+	return result, nil
+}
@@ -1,15 +1,43 @@
 package graph
 
 import (
+	"context"
+
+	"github.com/alim08/fin_line/pkg/database"
 	"github.com/alim08/fin_line/pkg/redisclient"
 )
 
 type Resolver struct {
-	redis *redisclient.Client
+	redis           *redisclient.Client
+	quotes          database.QuoteRepository
+	tickers         database.TickerRepository
+	sectors         database.SectorRepository
+	detectorConfigs database.DetectorConfigRepository
+	webhooks        database.WebhookRepository
+	manualAnomalies database.ManualAnomalyRepository
+	// publishDetectorConfig pushes the saved detector configuration to
+	// running anomaly services
+	publishDetectorConfig func(ctx context.Context) error
 }
 
-func NewResolver(redis *redisclient.Client) *Resolver {
+func NewResolver(
+	redis *redisclient.Client,
+	quotes database.QuoteRepository,
+	tickers database.TickerRepository,
+	sectors database.SectorRepository,
+	detectorConfigs database.DetectorConfigRepository,
+	webhooks database.WebhookRepository,
+	manualAnomalies database.ManualAnomalyRepository,
+	publishDetectorConfig func(ctx context.Context) error,
+) *Resolver {
 	return &Resolver{
-		redis: redis,
+		redis:                 redis,
+		quotes:                quotes,
+		tickers:               tickers,
+		sectors:               sectors,
+		detectorConfigs:       detectorConfigs,
+		webhooks:              webhooks,
+		manualAnomalies:       manualAnomalies,
+		publishDetectorConfig: publishDetectorConfig,
 	}
-} 
\ No newline at end of file
+}
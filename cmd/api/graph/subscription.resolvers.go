@@ -1,58 +1,85 @@
 package graph
 
-// This file will be automatically regenerated based on the schema, DO NOT EDIT.
-// Add custom subscription resolvers in this file.
+// Subscription resolvers. Each returns a channel that is closed once the
+// subscription's context is cancelled, i.e. when the client unsubscribes or
+// the websocket connection drops.
 
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// quotesChannel carries every normalized tick published by cachepub
+	quotesChannel = "quotes:pubsub"
+	// anomaliesChannel carries anomalies created or updated through the API
+	anomaliesChannel = "anomalies"
+	// anomaliesStream is appended to by the anomaly detector
+	anomaliesStream = "anomalies:stream"
+	// anomaliesStreamBlock bounds each blocking XREAD so cancellation is noticed
+	anomaliesStreamBlock = 5 * time.Second
+	// marketUpdateInterval is how often marketUpdate recomputes market stats
+	marketUpdateInterval = 5 * time.Second
 )
 
 func (r *Resolver) QuoteUpdated(ctx context.Context, ticker *string) (<-chan *Quote, error) {
-	// Create a channel for the subscription
-	quoteChan := make(chan *Quote)
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
 
-	// Subscribe to Redis channel for quote updates
-	pubsub := r.redis.Client().Subscribe(ctx, "quotes")
-	defer pubsub.Close()
+	// Subscribe to Redis channel for quote updates; the subscription is
+	// confirmed before returning so a Redis failure is reported to the client
+	sub, err := r.redis.SubscribeManaged(ctx, quotesChannel)
+	if err != nil {
+		logger.Log.Error("failed to subscribe to quotes", zap.Error(err))
+		return nil, fmt.Errorf("quote updates unavailable")
+	}
 
+	quoteChan := make(chan *Quote)
 	go func() {
 		defer close(quoteChan)
+		defer sub.Close()
+
+		messages := sub.Channel()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			default:
-				msg, err := pubsub.ReceiveMessage(ctx)
-				if err != nil {
+			case msg, ok := <-messages:
+				if !ok {
 					return
 				}
+				if msg.Gap {
+					// Ticks missed while Redis was unreachable are superseded by the next ones
+					continue
+				}
 
-				// Parse the quote data
-				var quoteData map[string]interface{}
-				if err := json.Unmarshal([]byte(msg.Payload), &quoteData); err != nil {
+				var tick models.NormalizedTick
+				if err := json.Unmarshal([]byte(msg.Payload), &tick); err != nil {
 					continue
 				}
 
 				// Apply ticker filter if specified
-				if ticker != nil {
-					if quoteTicker, ok := quoteData["ticker"].(string); !ok || quoteTicker != *ticker {
-						continue
-					}
+				if ticker != nil && tick.Ticker != *ticker {
+					continue
 				}
 
-				// Convert to model
-				price, _ := quoteData["price"].(float64)
-				timestamp, _ := quoteData["timestamp"].(float64)
-				quoteTicker, _ := quoteData["ticker"].(string)
-				sector, _ := quoteData["sector"].(string)
-
 				quote := &Quote{
-					Ticker:    quoteTicker,
-					Price:     price,
-					Timestamp: time.UnixMilli(int64(timestamp)),
-					Sector:    &sector,
+					Ticker:    tick.Ticker,
+					Price:     tick.Price,
+					Timestamp: time.UnixMilli(tick.Timestamp),
+				}
+				if tick.Sector != "" {
+					sector := tick.Sector
+					quote.Sector = &sector
 				}
 
 				select {
@@ -68,24 +95,58 @@ func (r *Resolver) QuoteUpdated(ctx context.Context, ticker *string) (<-chan *Qu
 }
 
 func (r *Resolver) AnomalyDetected(ctx context.Context, severity *string) (<-chan *Anomaly, error) {
-	// Create a channel for the subscription
+	if _, err := requirePermission(ctx, auth.PermAnomaliesRead); err != nil {
+		return nil, err
+	}
+
+	// Anomalies reach subscribers from two sources: the detector appends to
+	// anomaliesStream, while API-created anomalies are published on anomaliesChannel
+	sub, err := r.redis.SubscribeManaged(ctx, anomaliesChannel)
+	if err != nil {
+		logger.Log.Error("failed to subscribe to anomalies", zap.Error(err))
+		return nil, fmt.Errorf("anomaly updates unavailable")
+	}
+
 	anomalyChan := make(chan *Anomaly)
+	send := func(anomaly *Anomaly) bool {
+		// Apply severity filter if specified
+		if severity != nil && anomaly.Severity != *severity {
+			return true
+		}
+		select {
+		case anomalyChan <- anomaly:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
 
-	// Subscribe to Redis channel for anomaly updates
-	pubsub := r.redis.Client().Subscribe(ctx, "anomalies")
-	defer pubsub.Close()
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		r.tailAnomalyStream(ctx, send)
+	}()
 
 	go func() {
-		defer close(anomalyChan)
+		// The stream reader must stop sending before the channel is closed
+		defer func() {
+			<-streamDone
+			close(anomalyChan)
+		}()
+		defer sub.Close()
+
+		messages := sub.Channel()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			default:
-				msg, err := pubsub.ReceiveMessage(ctx)
-				if err != nil {
+			case msg, ok := <-messages:
+				if !ok {
 					return
 				}
+				if msg.Gap {
+					continue
+				}
 
 				// Parse the anomaly data
 				var anomalyData map[string]interface{}
@@ -98,13 +159,6 @@ func (r *Resolver) AnomalyDetected(ctx context.Context, severity *string) (<-cha
 					continue // Skip deletion messages for now
 				}
 
-				// Apply severity filter if specified
-				if severity != nil {
-					if anomalySeverity, ok := anomalyData["severity"].(string); !ok || anomalySeverity != *severity {
-						continue
-					}
-				}
-
 				// Convert to model
 				id, _ := anomalyData["id"].(string)
 				anomalyTicker, _ := anomalyData["ticker"].(string)
@@ -124,9 +178,7 @@ func (r *Resolver) AnomalyDetected(ctx context.Context, severity *string) (<-cha
 					Severity:  anomalySeverity,
 				}
 
-				select {
-				case anomalyChan <- anomaly:
-				case <-ctx.Done():
+				if !send(anomaly) {
 					return
 				}
 			}
@@ -136,52 +188,100 @@ func (r *Resolver) AnomalyDetected(ctx context.Context, severity *string) (<-cha
 	return anomalyChan, nil
 }
 
+// tailAnomalyStream delivers detector anomalies appended to anomaliesStream
+// after the call, until ctx is cancelled or send reports the subscriber gone
+func (r *Resolver) tailAnomalyStream(ctx context.Context, send func(*Anomaly) bool) {
+	lastID := "$"
+	for ctx.Err() == nil {
+		streams, err := r.redis.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{anomaliesStream, lastID},
+			Block:   anomaliesStreamBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Warn("failed to read anomalies stream", zap.Error(err))
+				// Back off before retrying so a Redis outage doesn't spin
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				lastID = msg.ID
+
+				anomaly, err := models.AnomalyFromMap(msg.Values)
+				if err != nil {
+					logger.Log.Warn("failed to parse anomaly", zap.Error(err), zap.String("id", msg.ID))
+					continue
+				}
+
+				if !send(&Anomaly{
+					ID:        msg.ID,
+					Ticker:    anomaly.Ticker,
+					Price:     anomaly.Price,
+					Threshold: anomaly.ZScore,
+					Type:      "price_spike",
+					Timestamp: time.UnixMilli(anomaly.Timestamp),
+					Severity:  anomaly.Severity(),
+				}) {
+					return
+				}
+			}
+		}
+	}
+}
+
 func (r *Resolver) MarketUpdate(ctx context.Context) (<-chan *MarketStats, error) {
-	// Create a channel for the subscription
-	statsChan := make(chan *MarketStats)
+	if _, err := requirePermission(ctx, auth.PermQuotesRead); err != nil {
+		return nil, err
+	}
 
-	// Subscribe to Redis channel for market updates
-	pubsub := r.redis.Client().Subscribe(ctx, "market_updates")
-	defer pubsub.Close()
+	// Nothing publishes aggregate stats, so they are recomputed from the
+	// latest-quote cache on a fixed interval, starting immediately
+	stats, err := r.MarketStats(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	statsChan := make(chan *MarketStats)
 	go func() {
 		defer close(statsChan)
+
+		ticker := time.NewTicker(marketUpdateInterval)
+		defer ticker.Stop()
+
 		for {
 			select {
+			case statsChan <- stats:
 			case <-ctx.Done():
 				return
-			default:
-				msg, err := pubsub.ReceiveMessage(ctx)
-				if err != nil {
-					return
-				}
-
-				// Parse the market stats data
-				var statsData map[string]interface{}
-				if err := json.Unmarshal([]byte(msg.Payload), &statsData); err != nil {
-					continue
-				}
-
-				// Convert to model
-				totalTickers, _ := statsData["total_tickers"].(float64)
-				totalQuotes, _ := statsData["total_quotes"].(float64)
-				avgPrice, _ := statsData["avg_price"].(float64)
+			}
 
-				stats := &MarketStats{
-					TotalTickers: int(totalTickers),
-					TotalQuotes:  int(totalQuotes),
-					AvgPrice:     &avgPrice,
-					LastUpdate:   time.Now(),
-				}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
 
-				select {
-				case statsChan <- stats:
-				case <-ctx.Done():
+			next, err := r.MarketStats(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
 					return
 				}
+				// Keep the subscription alive and resend the last stats
+				logger.Log.Warn("failed to refresh market stats", zap.Error(err))
+				continue
 			}
+			stats = next
 		}
 	}()
 
 	return statsChan, nil
-} 
\ No newline at end of file
+}
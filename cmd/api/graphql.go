@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/alim08/fin_line/cmd/api/graph"
+	"github.com/alim08/fin_line/cmd/api/graph/generated"
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// graphQLInitTimeout bounds how long a websocket client may take to send
+	// connection_init before it is disconnected
+	graphQLInitTimeout = 10 * time.Second
+	// graphQLKeepAlive is the interval between ping messages on idle
+	// subscription connections
+	graphQLKeepAlive = 15 * time.Second
+)
+
+// graphResolverRoot exposes the single hand-written graph.Resolver as every
+// root operation type expected by the generated executable schema.
+type graphResolverRoot struct {
+	*graph.Resolver
+}
+
+func (r graphResolverRoot) Query() generated.QueryResolver               { return r.Resolver }
+func (r graphResolverRoot) Mutation() generated.MutationResolver         { return r.Resolver }
+func (r graphResolverRoot) Subscription() generated.SubscriptionResolver { return r.Resolver }
+func (r graphResolverRoot) Ticker() generated.TickerResolver             { return r.Resolver }
+
+// newGraphQLServer builds a GraphQL server for the schema with the
+// operation cost limits of costCfg applied; callers add the transports. Each
+// operation gets its own batch loaders so Redis lookups from sibling fields
+// are pipelined and never cached across requests. Errors are reported with
+// stable codes by presentGraphQLError.
+func newGraphQLServer(resolver *graph.Resolver, costCfg *graphQLCostConfig) *handler.Server {
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers:  graphResolverRoot{resolver},
+		Complexity: costCfg.complexityRoot(),
+	}))
+	srv.SetErrorPresenter(presentGraphQLError)
+	srv.Use(extension.FixedComplexityLimit(costCfg.maxComplexity))
+	srv.Use(depthLimit{max: costCfg.maxDepth})
+	srv.AroundOperations(func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return next(resolver.WithLoaders(ctx))
+	})
+	return srv
+}
+
+// newGraphQLHandler builds the GraphQL query handler. Queries and mutations
+// are accepted over POST and resolved with the incoming request context, so
+// client cancellation and route deadlines reach the resolvers.
+func newGraphQLHandler(resolver *graph.Resolver, costCfg *graphQLCostConfig, introspection bool) http.Handler {
+	srv := newGraphQLServer(resolver, costCfg)
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.POST{})
+	if introspection {
+		srv.Use(extension.Introspection{})
+	}
+	return srv
+}
+
+// newGraphQLSubscriptionHandler serves subscriptions over websockets. Both
+// the graphql-transport-ws and legacy graphql-ws subprotocols are accepted;
+// the bearer token is read from the connection_init payload because browsers
+// cannot attach headers to the upgrade request.
+func newGraphQLSubscriptionHandler(resolver *graph.Resolver, costCfg *graphQLCostConfig, authService *auth.AuthService) http.Handler {
+	srv := newGraphQLServer(resolver, costCfg)
+	srv.AddTransport(transport.Websocket{
+		InitFunc:              graphQLWebsocketInit(authService),
+		InitTimeout:           graphQLInitTimeout,
+		KeepAlivePingInterval: graphQLKeepAlive,
+	})
+	return srv
+}
+
+// graphQLWebsocketInit authenticates a websocket connection from its
+// connection_init payload, e.g. {"Authorization": "Bearer <token>"} with an
+// optional X-Tenant-ID, and scopes the connection context the same way
+// AuthMiddleware and TenantMiddleware scope a request.
+func graphQLWebsocketInit(authService *auth.AuthService) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		authorization := payload.Authorization()
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return nil, nil, errors.New("authorization required")
+		}
+
+		claims, err := authService.Authenticate(ctx, strings.TrimPrefix(authorization, "Bearer "))
+		if err != nil {
+			logger.Log.Warn("graphql websocket token validation failed", zap.Error(err))
+			return nil, nil, errors.New("invalid token")
+		}
+
+		tenantID, err := auth.ResolveTenant(claims, payload.GetString(auth.TenantHeader))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return tenant.WithTenant(auth.SetUser(ctx, claims), tenantID), nil, nil
+	}
+}
+
+// registerGraphQLRoutes mounts the GraphQL endpoint on router:
+//
+//	GET  /graphql (websocket upgrade)  subscriptions, authenticated on connection_init
+//	GET  /graphql                      playground, outside production only
+//	POST /graphql                      queries and mutations, behind AuthMiddleware and quota
+//
+// The playground sits in front of the authenticated subrouter because
+// browsers cannot attach a bearer token to the page load; queries issued
+// from the playground still need one.
+func registerGraphQLRoutes(router *mux.Router, resolver *graph.Resolver, costCfg *graphQLCostConfig, authService *auth.AuthService, quota func(http.Handler) http.Handler, playgroundEnabled bool) {
+	router.Handle("/graphql", newGraphQLSubscriptionHandler(resolver, costCfg, authService)).
+		Methods("GET").
+		HeadersRegexp("Upgrade", "(?i)^websocket$")
+	if playgroundEnabled {
+		router.Handle("/graphql", playground.Handler("fin-line GraphQL", "/graphql")).Methods("GET")
+	}
+
+	graphQLRouter := router.PathPrefix("/graphql").Subrouter()
+	graphQLRouter.Use(authService.AuthMiddleware)
+	graphQLRouter.Use(auth.TenantMiddleware)
+	graphQLRouter.Use(quota)
+	graphQLRouter.Handle("", newGraphQLHandler(resolver, costCfg, playgroundEnabled)).Methods("POST", "OPTIONS")
+}
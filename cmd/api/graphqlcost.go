@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/alim08/fin_line/cmd/api/graph"
+	"github.com/alim08/fin_line/cmd/api/graph/generated"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// graphQLCostConfig bounds the cost of a single GraphQL operation. Complexity
+// is the sum of field costs, with list fields multiplying their selection's
+// cost by the number of items they may return; depth is the deepest nesting
+// of field selections.
+type graphQLCostConfig struct {
+	maxComplexity int
+	maxDepth      int
+	fieldCosts    map[string]int
+}
+
+// defaultGraphQLFieldCosts are the base costs of fields that do more than a
+// single key lookup, keyed by "Type.field". Fields not listed cost 1.
+var defaultGraphQLFieldCosts = map[string]int{
+	// KEYS quotes:latest:* plus an HGETALL per ticker
+	"Query.latestQuotes": 25,
+	"Query.marketStats":  50,
+	// XRANGE scans over normalized:events and anomalies:stream
+	"Query.quotes":    10,
+	"Query.anomalies": 10,
+	// ZRANGE over a ticker's anomaly set
+	"Query.anomaliesByTicker": 10,
+	"Query.tickers":           5,
+	// Postgres range scans
+	"Query.quoteHistory": 10,
+	"Query.candles":      20,
+	// Long-lived subscriptions hold a Redis connection each
+	"Subscription.quoteUpdated":    10,
+	"Subscription.anomalyDetected": 20,
+	"Subscription.marketUpdate":    50,
+}
+
+const (
+	// graphQLDefaultListSize is assumed for list fields without a limit argument
+	graphQLDefaultListSize = 100
+	// graphQLMaxListSize mirrors the resolvers' cap on limit and first arguments
+	graphQLMaxListSize = graph.MaxPageSize
+)
+
+// loadGraphQLCostConfig reads GraphQL limits from the environment:
+//
+//	GRAPHQL_MAX_COMPLEXITY  maximum operation complexity (5000)
+//	GRAPHQL_MAX_DEPTH       maximum selection depth (6)
+//	GRAPHQL_FIELD_COSTS     cost overrides, e.g. "Query.anomalies=20,Query.marketStats=100"
+func loadGraphQLCostConfig() (*graphQLCostConfig, error) {
+	cfg := &graphQLCostConfig{
+		maxComplexity: 5000,
+		maxDepth:      6,
+		fieldCosts:    make(map[string]int, len(defaultGraphQLFieldCosts)),
+	}
+	for field, cost := range defaultGraphQLFieldCosts {
+		cfg.fieldCosts[field] = cost
+	}
+
+	if v := os.Getenv("GRAPHQL_MAX_COMPLEXITY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid GRAPHQL_MAX_COMPLEXITY: %q", v)
+		}
+		cfg.maxComplexity = n
+	}
+	if v := os.Getenv("GRAPHQL_MAX_DEPTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid GRAPHQL_MAX_DEPTH: %q", v)
+		}
+		cfg.maxDepth = n
+	}
+
+	err := parseRouteOverrides(os.Getenv("GRAPHQL_FIELD_COSTS"), func(field, value string) error {
+		if !strings.Contains(field, ".") {
+			return fmt.Errorf("field must be of the form Type.field")
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid cost %q", value)
+		}
+		cfg.fieldCosts[field] = n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid GRAPHQL_FIELD_COSTS: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// cost returns the base cost of a "Type.field"
+func (c *graphQLCostConfig) cost(field string) int {
+	if cost, ok := c.fieldCosts[field]; ok {
+		return cost
+	}
+	return 1
+}
+
+// listSize returns how many items a list field may return for limit
+func listSize(limit *int) int {
+	if limit == nil || *limit <= 0 {
+		return graphQLDefaultListSize
+	}
+	if *limit > graphQLMaxListSize {
+		return graphQLMaxListSize
+	}
+	return *limit
+}
+
+// candleCount returns how many candles of interval fit between start and
+// end, at most database.MaxCandles. Unknown intervals are rejected by the
+// resolver, so they are costed as the maximum.
+func candleCount(start time.Time, end *time.Time, interval string) int {
+	width, err := graph.ParseInterval(interval)
+	if err != nil {
+		return database.MaxCandles
+	}
+	endTime := time.Now()
+	if end != nil {
+		endTime = *end
+	}
+	n := int(endTime.Sub(start) / width)
+	if n < 1 {
+		return 1
+	}
+	if n > database.MaxCandles {
+		return database.MaxCandles
+	}
+	return n
+}
+
+// complexityRoot returns the per-field complexity functions for the schema.
+// Fields without a function are costed by gqlgen as 1 plus their selection.
+func (c *graphQLCostConfig) complexityRoot() generated.ComplexityRoot {
+	var root generated.ComplexityRoot
+
+	root.Query.Quotes = func(child int, first *int, _ *string, _ *graph.QuoteFilter, _ graph.SortOrder) int {
+		return c.cost("Query.quotes") + listSize(first)*child
+	}
+	root.Query.LatestQuotes = func(child int) int {
+		return c.cost("Query.latestQuotes") + graphQLDefaultListSize*child
+	}
+	root.Query.Anomalies = func(child int, first *int, _ *string, _ *graph.AnomalyFilter, _ graph.SortOrder) int {
+		return c.cost("Query.anomalies") + listSize(first)*child
+	}
+	root.Query.AnomaliesByTicker = func(child int, _ string) int {
+		return c.cost("Query.anomaliesByTicker") + graph.MaxAnomaliesByTicker*child
+	}
+	root.Query.Tickers = func(child int, _ bool, _ *string) int {
+		return c.cost("Query.tickers") + graphQLDefaultListSize*child
+	}
+	root.Query.QuoteHistory = func(child int, _ string, start time.Time, end *time.Time, interval *string, limit *int) int {
+		if interval != nil {
+			return c.cost("Query.quoteHistory") + candleCount(start, end, *interval)*child
+		}
+		return c.cost("Query.quoteHistory") + listSize(limit)*child
+	}
+	root.Query.Candles = func(child int, _ string, start time.Time, end *time.Time, interval string) int {
+		return c.cost("Query.candles") + candleCount(start, end, interval)*child
+	}
+	root.Query.MarketStats = func(child int) int {
+		return c.cost("Query.marketStats") + child
+	}
+
+	root.Subscription.QuoteUpdated = func(child int, _ *string) int {
+		return c.cost("Subscription.quoteUpdated") + child
+	}
+	root.Subscription.AnomalyDetected = func(child int, _ *string) int {
+		return c.cost("Subscription.anomalyDetected") + child
+	}
+	root.Subscription.MarketUpdate = func(child int) int {
+		return c.cost("Subscription.marketUpdate") + child
+	}
+
+	return root
+}
+
+const errDepthLimit = "DEPTH_LIMIT_EXCEEDED"
+
+// depthLimit rejects operations whose selections nest deeper than max.
+// Introspection fields are not counted so tooling such as the playground
+// keeps working.
+type depthLimit struct {
+	max int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = depthLimit{}
+
+func (d depthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (d depthLimit) Validate(graphql.ExecutableSchema) error {
+	if d.max <= 0 {
+		return fmt.Errorf("depth limit must be positive")
+	}
+	return nil
+}
+
+func (d depthLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	if depth := selectionDepth(op.SelectionSet); depth > d.max {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.max)
+		errcode.Set(err, errDepthLimit)
+		return err
+	}
+	return nil
+}
+
+// selectionDepth returns the field nesting depth of set, following fragments.
+// Validation has already rejected fragment cycles.
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, selection := range set {
+		var d int
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name, "__") {
+				continue
+			}
+			d = 1 + selectionDepth(s.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				d = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+		if d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
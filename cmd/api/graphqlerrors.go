@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/alim08/fin_line/cmd/api/graph"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/validation"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.uber.org/zap"
+)
+
+// Stable GraphQL error codes, reported in the "code" extension alongside
+// gqlgen's own GRAPHQL_PARSE_FAILED, GRAPHQL_VALIDATION_FAILED and
+// COMPLEXITY_LIMIT_EXCEEDED
+const (
+	errCodeBadUserInput    = "BAD_USER_INPUT"
+	errCodeUnauthenticated = "UNAUTHENTICATED"
+	errCodeForbidden       = "FORBIDDEN"
+	errCodeNotFound        = "NOT_FOUND"
+	errCodeConflict        = "CONFLICT"
+	errCodeTimeout         = "TIMEOUT"
+	errCodeInternal        = "INTERNAL_SERVER_ERROR"
+)
+
+// presentGraphQLError gives every error of an operation a code and the path
+// of the field it came from. Validation failures also list the offending
+// fields. Unclassified resolver errors are logged and reported as internal
+// errors so Redis and Postgres details do not leak to clients.
+func presentGraphQLError(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	if _, ok := gqlErr.Extensions["code"]; ok {
+		return gqlErr
+	}
+
+	var (
+		validationErrs validation.ValidationErrors
+		inputErr       *graph.InputError
+		frameworkErr   *gqlerror.Error
+	)
+	switch {
+	case errors.As(err, &validationErrs):
+		errcode.Set(gqlErr, errCodeBadUserInput)
+		fields := make([]map[string]interface{}, 0, len(validationErrs))
+		for _, v := range validationErrs {
+			fields = append(fields, map[string]interface{}{"field": v.Field, "message": v.Message})
+		}
+		gqlErr.Extensions["fields"] = fields
+	case errors.As(err, &inputErr), errors.Is(err, database.ErrInvalidRange):
+		errcode.Set(gqlErr, errCodeBadUserInput)
+	case errors.Is(err, graph.ErrUnauthenticated):
+		errcode.Set(gqlErr, errCodeUnauthenticated)
+	case errors.Is(err, graph.ErrForbidden):
+		errcode.Set(gqlErr, errCodeForbidden)
+	case errors.Is(err, database.ErrNotFound):
+		errcode.Set(gqlErr, errCodeNotFound)
+	case errors.Is(err, database.ErrConflict):
+		errcode.Set(gqlErr, errCodeConflict)
+	case errors.Is(err, context.DeadlineExceeded), database.IsStatementTimeout(err):
+		gqlErr.Message = "Request timed out"
+		errcode.Set(gqlErr, errCodeTimeout)
+	case errors.As(err, &frameworkErr):
+		// Raised by gqlgen itself while coercing arguments
+		errcode.Set(gqlErr, errCodeBadUserInput)
+	default:
+		logger.Log.Error("graphql resolver error", zap.Error(err), zap.String("path", gqlErr.Path.String()))
+		gqlErr.Message = "Internal server error"
+		errcode.Set(gqlErr, errCodeInternal)
+	}
+	return gqlErr
+}
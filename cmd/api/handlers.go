@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/redisclient"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
@@ -22,13 +23,14 @@ type Response struct {
 	Meta    *Meta       `json:"meta,omitempty"`
 }
 
-// Meta contains pagination and metadata information
+// Meta contains pagination and metadata information. Total is left out of
+// lists too large to count on every request.
 type Meta struct {
-	Total    int64 `json:"total"`
-	Page     int   `json:"page"`
-	PerPage  int   `json:"per_page"`
-	HasMore  bool  `json:"has_more"`
-	Duration int64 `json:"duration_ms"`
+	Total    *int64 `json:"total,omitempty"`
+	Page     int    `json:"page"`
+	PerPage  int    `json:"per_page"`
+	HasMore  bool   `json:"has_more"`
+	Duration int64  `json:"duration_ms"`
 }
 
 // Quote represents a market quote
@@ -58,22 +60,20 @@ type MarketStats struct {
 	LastUpdate   int64   `json:"last_update"`
 }
 
+// Server serves the chi handlers reading quotes and anomalies straight from
+// Redis. main routes the Postgres-backed handlers instead.
+type Server struct {
+	redis *redisclient.Client
+}
+
 // writeJSON writes a JSON response with proper headers
 func (s *Server) writeJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		logger.Log.Error("JSON encoding error", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	writeJSON(w, status, data)
 }
 
 // writeError writes an error response
 func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
-	s.writeJSON(w, status, Response{
-		Success: false,
-		Error:   message,
-	})
+	writeError(w, status, message)
 }
 
 // healthHandler returns server health status
@@ -99,6 +99,8 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // getQuotesHandler retrieves quotes with pagination and filtering
+//
+// Deprecated: scans the normalized stream on every request; use GET /api/v2/quotes.
 func (s *Server) getQuotesHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	ctx := r.Context()
@@ -173,7 +175,7 @@ func (s *Server) getQuotesHandler(w http.ResponseWriter, r *http.Request) {
 		Success: true,
 		Data:    quotes,
 		Meta: &Meta{
-			Total:    total,
+			Total:    &total,
 			Page:     page,
 			PerPage:  perPage,
 			HasMore:  hasMore,
@@ -183,6 +185,8 @@ func (s *Server) getQuotesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // getQuoteByTickerHandler retrieves the latest quote for a specific ticker
+//
+// Deprecated: scans the normalized stream on every request; use GET /api/v2/quotes/{ticker}.
 func (s *Server) getQuoteByTickerHandler(w http.ResponseWriter, r *http.Request) {
 	ticker := chi.URLParam(r, "ticker")
 	if ticker == "" {
@@ -245,6 +249,8 @@ func (s *Server) getQuoteByTickerHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // getLatestQuotesHandler retrieves the latest quotes for all tickers
+//
+// Deprecated: scans the normalized stream on every request; use GET /api/v2/quotes/latest.
 func (s *Server) getLatestQuotesHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -354,25 +360,24 @@ func (s *Server) getAnomaliesByTickerHandler(w http.ResponseWriter, r *http.Requ
 
 	ctx := r.Context()
 
-	// Get all anomalies and filter by ticker
-	anomalies, err := s.redis.Client().LRange(ctx, "anomalies", 0, -1).Result()
-	if err != nil && err != redis.Nil {
-		logger.Log.Error("Redis LRange error", zap.Error(err))
-		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve anomalies")
-		return
-	}
-
+	// Walk the anomalies in chunks and filter by ticker
 	var result []Anomaly
-	for _, anomalyStr := range anomalies {
+	err := s.redis.ScanList(ctx, "anomalies", func(_ int64, anomalyStr string) error {
 		var anomaly Anomaly
 		if err := json.Unmarshal([]byte(anomalyStr), &anomaly); err != nil {
 			logger.Log.Warn("Failed to unmarshal anomaly", zap.Error(err))
-			continue
+			return nil
 		}
 
 		if anomaly.Ticker == ticker {
 			result = append(result, anomaly)
 		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Redis LRANGE error", zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve anomalies")
+		return
 	}
 
 	s.writeJSON(w, http.StatusOK, Response{
@@ -382,6 +387,9 @@ func (s *Server) getAnomaliesByTickerHandler(w http.ResponseWriter, r *http.Requ
 }
 
 // createAnomalyHandler creates a new anomaly
+//
+// Deprecated: stores anomalies without attribution; use POST /api/v1/anomalies,
+// which records the creator and an audit trail in Postgres.
 func (s *Server) createAnomalyHandler(w http.ResponseWriter, r *http.Request) {
 	var anomaly Anomaly
 	if err := json.NewDecoder(r.Body).Decode(&anomaly); err != nil {
@@ -445,9 +453,9 @@ func (s *Server) getTickersHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Get unique tickers from Redis
-	tickers, err := s.redis.Client().SMembers(ctx, "tickers").Result()
-	if err != nil && err != redis.Nil {
-		logger.Log.Error("Redis SMembers error", zap.Error(err))
+	tickers, err := s.setMembers(ctx, "tickers")
+	if err != nil {
+		logger.Log.Error("Redis SSCAN error", zap.Error(err))
 		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve tickers")
 		return
 	}
@@ -463,9 +471,9 @@ func (s *Server) getSectorsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Get unique sectors from Redis
-	sectors, err := s.redis.Client().SMembers(ctx, "sectors").Result()
-	if err != nil && err != redis.Nil {
-		logger.Log.Error("Redis SMembers error", zap.Error(err))
+	sectors, err := s.setMembers(ctx, "sectors")
+	if err != nil {
+		logger.Log.Error("Redis SSCAN error", zap.Error(err))
 		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve sectors")
 		return
 	}
@@ -476,7 +484,25 @@ func (s *Server) getSectorsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// setMembers returns the members of the set at key. SSCAN may return a
+// member more than once while the set is rehashed, so repeats are dropped.
+func (s *Server) setMembers(ctx context.Context, key string) ([]string, error) {
+	var members []string
+	seen := make(map[string]struct{})
+	err := s.redis.SScan(ctx, key, "", func(member string) error {
+		if _, ok := seen[member]; !ok {
+			seen[member] = struct{}{}
+			members = append(members, member)
+		}
+		return nil
+	})
+	return members, err
+}
+
 // getMarketStatsHandler retrieves market statistics
+//
+// Deprecated: reports the stream length as the quote count and no prices; use
+// GET /api/v1/stats, which aggregates Postgres with per-sector breakdowns.
 func (s *Server) getMarketStatsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+)
+
+// Health levels, from best to worst
+const (
+	healthHealthy   = "healthy"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+)
+
+const (
+	// feedHealthKey is the hash of feed URL -> last ingested event (ms) written by ingest
+	feedHealthKey = "feeds:health"
+	// streamLagDegraded is how far normalization may trail ingestion before the pipeline is degraded
+	streamLagDegraded = 30 * time.Second
+	// feedStaleAfter is how long a feed may go without events before it counts as stale
+	feedStaleAfter = 60 * time.Second
+)
+
+// componentHealth is the status of a single dependency
+type componentHealth struct {
+	Status    string                 `json:"status"`
+	LatencyMs int64                  `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// healthReport is the /health response body
+type healthReport struct {
+	Status     string                      `json:"status"`
+	Timestamp  int64                       `json:"timestamp"`
+	DurationMs int64                       `json:"duration_ms"`
+	Components map[string]*componentHealth `json:"components"`
+}
+
+// Health check handler. Database or Redis failures make the service unhealthy
+// (503); stream lag and stale feeds only degrade it (200).
+func healthHandler(db store, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		report := &healthReport{
+			Status:    healthHealthy,
+			Timestamp: start.Unix(),
+			Components: map[string]*componentHealth{
+				"redis":      checkComponent(func() (string, map[string]interface{}, error) { return redisHealth(ctx, redisClient) }),
+				"stream_lag": checkComponent(func() (string, map[string]interface{}, error) { return streamLagHealth(ctx, redisClient) }),
+				"feeds":      checkComponent(func() (string, map[string]interface{}, error) { return feedHealth(ctx, redisClient) }),
+			},
+		}
+		report.Components[storeDriver(db)] = checkComponent(func() (string, map[string]interface{}, error) { return databaseHealth(ctx, db) })
+
+		for _, c := range report.Components {
+			report.Status = worseHealth(report.Status, c.Status)
+		}
+		report.DurationMs = time.Since(start).Milliseconds()
+
+		status := http.StatusOK
+		if report.Status == healthUnhealthy {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	}
+}
+
+// checkComponent times a check and records its outcome
+func checkComponent(check func() (string, map[string]interface{}, error)) *componentHealth {
+	start := time.Now()
+	status, details, err := check()
+	c := &componentHealth{
+		Status:    status,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
+
+// worseHealth returns the more severe of two health levels
+func worseHealth(a, b string) string {
+	rank := map[string]int{healthHealthy: 0, healthDegraded: 1, healthUnhealthy: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// databaseHealth checks db and reports its connection pool. A pool with
+// every connection in use degrades the service, since queries queue for one.
+func databaseHealth(ctx context.Context, db store) (string, map[string]interface{}, error) {
+	if err := db.HealthCheck(ctx); err != nil {
+		return healthUnhealthy, nil, err
+	}
+	stats := db.PoolStats()
+	status := healthHealthy
+	if stats.Exhausted() {
+		status = healthDegraded
+	}
+	return status, map[string]interface{}{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+	}, nil
+}
+
+func redisHealth(ctx context.Context, redisClient *redisclient.Client) (string, map[string]interface{}, error) {
+	if err := redisClient.Client().Ping(ctx).Err(); err != nil {
+		return healthUnhealthy, nil, err
+	}
+	return healthHealthy, nil, nil
+}
+
+// streamLagHealth compares the newest raw and normalized stream entries
+func streamLagHealth(ctx context.Context, redisClient *redisclient.Client) (string, map[string]interface{}, error) {
+	rawMs, err := newestStreamEntryMs(ctx, redisClient, "raw:events")
+	if err != nil {
+		return healthDegraded, nil, err
+	}
+	normalizedMs, err := newestStreamEntryMs(ctx, redisClient, "normalized:events")
+	if err != nil {
+		return healthDegraded, nil, err
+	}
+
+	lag := rawMs - normalizedMs
+	if lag < 0 || rawMs == 0 {
+		lag = 0
+	}
+
+	status := healthHealthy
+	if time.Duration(lag)*time.Millisecond > streamLagDegraded {
+		status = healthDegraded
+	}
+	return status, map[string]interface{}{"lag_ms": lag}, nil
+}
+
+// newestStreamEntryMs returns the millisecond part of the stream's last ID, or 0 if empty
+func newestStreamEntryMs(ctx context.Context, redisClient *redisclient.Client, stream string) (int64, error) {
+	msgs, err := redisClient.Client().XRevRangeN(ctx, stream, "+", "-", 1).Result()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	ms, _, _ := strings.Cut(msgs[0].ID, "-")
+	return strconv.ParseInt(ms, 10, 64)
+}
+
+// feedHealth reports how long ago each feed delivered an event
+func feedHealth(ctx context.Context, redisClient *redisclient.Client) (string, map[string]interface{}, error) {
+	beats, err := redisClient.Client().HGetAll(ctx, feedHealthKey).Result()
+	if err != nil {
+		return healthDegraded, nil, err
+	}
+	if len(beats) == 0 {
+		return healthDegraded, map[string]interface{}{"reason": "no feed heartbeats"}, nil
+	}
+
+	now := time.Now().UnixMilli()
+	ages := make(map[string]interface{}, len(beats))
+	status := healthHealthy
+	for feed, value := range beats {
+		last, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		age := now - last
+		ages[feed] = age
+		if time.Duration(age)*time.Millisecond > feedStaleAfter {
+			status = healthDegraded
+		}
+	}
+	return status, map[string]interface{}{"age_ms": ages}, nil
+}
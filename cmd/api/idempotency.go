@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// idempotencyHeader is the request header clients set to make a POST safely retryable
+	idempotencyHeader = "Idempotency-Key"
+	// idempotencyReplayHeader marks responses served from a stored result
+	idempotencyReplayHeader = "Idempotent-Replayed"
+	// idempotencyKeyPrefix namespaces stored results in Redis
+	idempotencyKeyPrefix = "idempotency:"
+	// idempotencyTTL is how long a key and its result are remembered
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL bounds how long an in-flight request holds its key
+	idempotencyLockTTL      = time.Minute
+	maxIdempotencyKeyLength = 255
+)
+
+// credentialRoutes are the templates of the POST routes whose responses hold
+// a secret shown only once: a webhook signing secret, a service token or an
+// API key. Their responses are never stored, so Idempotency-Key is ignored
+// on them and a retry mints a new credential.
+var credentialRoutes = map[string]bool{
+	"/api/v1/webhooks":             true,
+	"/api/v1/admin/service-tokens": true,
+	"/api/v1/admin/api-keys":       true,
+}
+
+// idempotencyRecord is the stored state of a keyed request
+type idempotencyRecord struct {
+	RequestHash string `json:"request_hash"`
+	Complete    bool   `json:"complete"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// idempotencyMiddleware makes POST requests carrying an Idempotency-Key
+// header replay-safe. The first request with a key runs and its response is
+// stored; retries with the same key and body get the stored response, a
+// different body is rejected with 422 and a concurrent retry with 409.
+// Keys are scoped to the tenant, authenticated user and route. 5xx responses
+// are not stored so the client can retry them, and neither are the responses
+// of credentialRoutes, which hold secrets.
+func idempotencyMiddleware(redisClient *redisclient.Client) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if r.Method != http.MethodPost || key == "" || mintsCredentials(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusRequestEntityTooLarge, "Failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			bodyHash := sha256.Sum256(body)
+			record := idempotencyRecord{RequestHash: hex.EncodeToString(bodyHash[:])}
+			storeKey := idempotencyStoreKey(r, key)
+
+			ctx := r.Context()
+			pending, _ := json.Marshal(record)
+			acquired, err := redisClient.Client().SetNX(ctx, storeKey, pending, idempotencyLockTTL).Result()
+			if err != nil {
+				// Fail open: without Redis the request runs as if no key was sent
+				logger.Log.Warn("idempotency store unavailable", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !acquired {
+				replayIdempotentResponse(ctx, w, redisClient, storeKey, record.RequestHash)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Use a fresh context so a cancelled request still releases or stores its key
+			storeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			if rec.status >= 500 {
+				if err := redisClient.Client().Del(storeCtx, storeKey).Err(); err != nil {
+					logger.Log.Warn("failed to release idempotency key", zap.Error(err))
+				}
+				return
+			}
+
+			record.Complete = true
+			record.Status = rec.status
+			record.ContentType = rec.Header().Get("Content-Type")
+			record.Body = rec.body.Bytes()
+			payload, _ := json.Marshal(record)
+			if err := redisClient.Client().Set(storeCtx, storeKey, payload, idempotencyTTL).Err(); err != nil {
+				logger.Log.Warn("failed to store idempotent response", zap.Error(err))
+			}
+		})
+	}
+}
+
+// mintsCredentials reports whether r was routed to one of credentialRoutes
+func mintsCredentials(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, err := route.GetPathTemplate()
+	return err == nil && credentialRoutes[template]
+}
+
+// replayIdempotentResponse answers a request whose key is already in use
+func replayIdempotentResponse(ctx context.Context, w http.ResponseWriter, redisClient *redisclient.Client, storeKey, requestHash string) {
+	payload, err := redisClient.Client().Get(ctx, storeKey).Bytes()
+	if err == redis.Nil {
+		// The first request failed and released the key between SETNX and GET
+		writeError(w, http.StatusConflict, "Request with this Idempotency-Key was not completed; retry")
+		return
+	}
+	if err != nil {
+		logger.Log.Error("failed to read idempotency record", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	var stored idempotencyRecord
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		logger.Log.Error("corrupt idempotency record", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	switch {
+	case stored.RequestHash != requestHash:
+		writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+	case !stored.Complete:
+		writeError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+	default:
+		if stored.ContentType != "" {
+			w.Header().Set("Content-Type", stored.ContentType)
+		}
+		w.Header().Set(idempotencyReplayHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// idempotencyStoreKey scopes a client key to the caller, tenant and route
+func idempotencyStoreKey(r *http.Request, key string) string {
+	subject := "anonymous"
+	if user, ok := auth.FromContext(r.Context()); ok {
+		subject = user.UserID
+	}
+	sum := sha256.Sum256([]byte(tenant.FromContext(r.Context()) + "\x00" + subject + "\x00" + r.Method + "\x00" + r.URL.Path + "\x00" + key))
+	return idempotencyKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.wroteHeader = true
+	}
+	rr.body.Write(p)
+	return rr.ResponseWriter.Write(p)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMintsCredentials_MatchesSecretBearingRoutes(t *testing.T) {
+	// Mirror main's nesting: the routes hang off PathPrefix("") subrouters
+	router := mux.NewRouter()
+	protected := router.PathPrefix("/api/v1").Subrouter().PathPrefix("").Subrouter()
+	admin := protected.PathPrefix("/admin").Subrouter()
+
+	var minted bool
+	record := func(w http.ResponseWriter, r *http.Request) { minted = mintsCredentials(r) }
+	protected.HandleFunc("/webhooks", record).Methods("POST")
+	protected.HandleFunc("/watchlists", record).Methods("POST")
+	admin.HandleFunc("/service-tokens", record).Methods("POST")
+	admin.HandleFunc("/api-keys", record).Methods("POST")
+	admin.HandleFunc("/users", record).Methods("POST")
+
+	for target, want := range map[string]bool{
+		"/api/v1/webhooks":             true,
+		"/api/v1/admin/service-tokens": true,
+		"/api/v1/admin/api-keys":       true,
+		"/api/v1/watchlists":           false,
+		"/api/v1/admin/users":          false,
+	} {
+		minted = !want
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+		if minted != want {
+			t.Errorf("mintsCredentials(%s) = %v; want %v", target, minted, want)
+		}
+	}
+}
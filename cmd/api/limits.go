@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// routeLimits bounds how long a route may run and how large a request body it accepts.
+// A zero timeout disables the deadline (e.g. for streaming routes).
+type routeLimits struct {
+	timeout      time.Duration
+	maxBodyBytes int64
+}
+
+// limitsConfig resolves limits per mux path template
+type limitsConfig struct {
+	defaults  routeLimits
+	overrides map[string]routeLimits
+}
+
+// loadLimitsConfig reads limits from the environment:
+//
+//	API_ROUTE_TIMEOUT       default per-route timeout (10s)
+//	API_MAX_BODY_BYTES      default maximum request body size (1 MiB)
+//	API_ROUTE_TIMEOUTS      overrides, e.g. "/api/v1/admin/migrations/status=60s,/api/v2/quotes=2s"
+//	API_ROUTE_BODY_LIMITS   overrides, e.g. "/api/v1/webhooks=16384"
+func loadLimitsConfig() (*limitsConfig, error) {
+	cfg := &limitsConfig{
+		defaults: routeLimits{timeout: 10 * time.Second, maxBodyBytes: 1 << 20},
+		overrides: map[string]routeLimits{
+			"/graphql": {timeout: 30 * time.Second, maxBodyBytes: 1 << 20},
+			// CPU profiles and traces run for ?seconds= and stream their output
+			"/api/v1/admin/debug/pprof/profile": {maxBodyBytes: 1 << 20},
+			"/api/v1/admin/debug/pprof/trace":   {maxBodyBytes: 1 << 20},
+			// NDJSON downloads stream under their own deadline
+			"/api/v1/admin/raw-events": {maxBodyBytes: 1 << 20},
+			// Server-Sent Events stay open until the client disconnects
+			"/api/v1/watchlists/{id:[0-9]+}/stream": {maxBodyBytes: 1 << 20},
+		},
+	}
+
+	if v := os.Getenv("API_ROUTE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_ROUTE_TIMEOUT: %w", err)
+		}
+		cfg.defaults.timeout = d
+	}
+	if v := os.Getenv("API_MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid API_MAX_BODY_BYTES: %q", v)
+		}
+		cfg.defaults.maxBodyBytes = n
+	}
+
+	err := parseRouteOverrides(os.Getenv("API_ROUTE_TIMEOUTS"), func(route, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		limits := cfg.forTemplate(route)
+		limits.timeout = d
+		cfg.overrides[route] = limits
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_ROUTE_TIMEOUTS: %w", err)
+	}
+
+	err = parseRouteOverrides(os.Getenv("API_ROUTE_BODY_LIMITS"), func(route, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid size %q", value)
+		}
+		limits := cfg.forTemplate(route)
+		limits.maxBodyBytes = n
+		cfg.overrides[route] = limits
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_ROUTE_BODY_LIMITS: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// parseRouteOverrides splits "route=value,route=value" and calls set for each pair
+func parseRouteOverrides(raw string, set func(route, value string) error) error {
+	if raw == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || route == "" {
+			return fmt.Errorf("malformed entry %q", pair)
+		}
+		if err := set(route, value); err != nil {
+			return fmt.Errorf("%s: %w", route, err)
+		}
+	}
+	return nil
+}
+
+// forTemplate returns the limits for a mux path template
+func (c *limitsConfig) forTemplate(template string) routeLimits {
+	if limits, ok := c.overrides[template]; ok {
+		return limits
+	}
+	return c.defaults
+}
+
+// limitsMiddleware applies the matched route's body limit and timeout. Bodies
+// over the limit are rejected with 413; handlers still running at the deadline
+// get their context cancelled and the client receives 504.
+func limitsMiddleware(cfg *limitsConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			template := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if t, err := route.GetPathTemplate(); err == nil {
+					template = t
+				}
+			}
+			limits := cfg.forTemplate(template)
+
+			// Upgraded connections are hijacked and outlive any request
+			// deadline; the buffering timeoutWriter cannot be hijacked anyway
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Body != nil && limits.maxBodyBytes > 0 {
+				if r.ContentLength > limits.maxBodyBytes {
+					writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", limits.maxBodyBytes))
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, limits.maxBodyBytes)
+			}
+
+			if limits.timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), limits.timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for k, v := range tw.header {
+					w.Header()[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				logger.Log.Warn("request timed out",
+					zap.String("method", r.Method),
+					zap.String("route", template),
+					zap.Duration("timeout", limits.timeout))
+				writeError(w, http.StatusGatewayTimeout, "Request timed out")
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a handler's response so it can be discarded if the
+// deadline fires first
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// loginFailurePrefix and loginLockPrefix namespace the failed login
+	// counters and lockouts in Redis, followed by "account:" or "ip:"
+	loginFailurePrefix = "login:failures:"
+	loginLockPrefix    = "login:lock:"
+)
+
+// loginThrottleConfig bounds failed logins per account and per client IP.
+// Reaching a limit locks the account or IP out for baseLockout, doubling
+// with every further failure up to maxLockout.
+type loginThrottleConfig struct {
+	maxAccountFailures int64
+	maxIPFailures      int64
+	baseLockout        time.Duration
+	maxLockout         time.Duration
+	// failureWindow is how long failures are remembered after the last one
+	failureWindow time.Duration
+}
+
+// loadLoginThrottleConfig reads login throttling from the environment:
+//
+//	LOGIN_MAX_ACCOUNT_FAILURES  failures before an account is locked (5)
+//	LOGIN_MAX_IP_FAILURES       failures before a client IP is locked (20)
+//	LOGIN_LOCKOUT_BASE          first lockout (1m)
+//	LOGIN_LOCKOUT_MAX           longest lockout (1h)
+//	LOGIN_FAILURE_WINDOW        how long failures are remembered (24h)
+func loadLoginThrottleConfig() (*loginThrottleConfig, error) {
+	cfg := &loginThrottleConfig{
+		maxAccountFailures: 5,
+		maxIPFailures:      20,
+		baseLockout:        time.Minute,
+		maxLockout:         time.Hour,
+		failureWindow:      24 * time.Hour,
+	}
+
+	for name, dst := range map[string]*int64{
+		"LOGIN_MAX_ACCOUNT_FAILURES": &cfg.maxAccountFailures,
+		"LOGIN_MAX_IP_FAILURES":      &cfg.maxIPFailures,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*time.Duration{
+		"LOGIN_LOCKOUT_BASE":   &cfg.baseLockout,
+		"LOGIN_LOCKOUT_MAX":    &cfg.maxLockout,
+		"LOGIN_FAILURE_WINDOW": &cfg.failureWindow,
+	} {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*dst = d
+		}
+	}
+	if cfg.maxLockout < cfg.baseLockout {
+		return nil, fmt.Errorf("LOGIN_LOCKOUT_MAX must not be shorter than LOGIN_LOCKOUT_BASE")
+	}
+
+	return cfg, nil
+}
+
+// lockout returns how long to lock out after failures, given limit
+func (c *loginThrottleConfig) lockout(failures, limit int64) time.Duration {
+	lockout := c.baseLockout
+	for i := limit; i < failures && lockout < c.maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > c.maxLockout {
+		lockout = c.maxLockout
+	}
+	return lockout
+}
+
+// loginThrottle tracks failed logins in Redis. Like the other Redis backed
+// guards it fails open: while Redis is unavailable logins are not throttled.
+type loginThrottle struct {
+	redis *redisclient.Client
+	cfg   *loginThrottleConfig
+}
+
+// newLoginThrottle creates a login throttle backed by redisClient
+func newLoginThrottle(redisClient *redisclient.Client, cfg *loginThrottleConfig) *loginThrottle {
+	return &loginThrottle{redis: redisClient, cfg: cfg}
+}
+
+// loginScope is a subject failed logins are counted for
+type loginScope struct {
+	name  string
+	key   string
+	limit int64
+}
+
+// scopes returns the account and client IP scopes of a login attempt
+func (t *loginThrottle) scopes(username string, r *http.Request) []loginScope {
+	return []loginScope{
+		{name: "account", key: "account:" + strings.ToLower(username), limit: t.cfg.maxAccountFailures},
+		{name: "ip", key: "ip:" + clientIP(r), limit: t.cfg.maxIPFailures},
+	}
+}
+
+// locked returns how much longer username or the client of r is locked
+// out, or zero when neither is
+func (t *loginThrottle) locked(ctx context.Context, username string, r *http.Request) time.Duration {
+	scopes := t.scopes(username, r)
+	ttls := make([]*redis.DurationCmd, len(scopes))
+	_, err := t.redis.Client().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, scope := range scopes {
+			ttls[i] = pipe.PTTL(ctx, loginLockPrefix+scope.key)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Warn("login throttle unavailable", zap.Error(err))
+		return 0
+	}
+
+	var remaining time.Duration
+	for i, scope := range scopes {
+		ttl := ttls[i].Val()
+		if ttl <= 0 {
+			continue
+		}
+		metrics.LoginThrottled.WithLabelValues(scope.name).Inc()
+		if ttl > remaining {
+			remaining = ttl
+		}
+	}
+	return remaining
+}
+
+// recordFailure counts a failed login for username and the client of r,
+// locking either out once it reaches its limit
+func (t *loginThrottle) recordFailure(ctx context.Context, username string, r *http.Request) {
+	metrics.LoginFailures.Inc()
+
+	scopes := t.scopes(username, r)
+	counts := make([]*redis.IntCmd, len(scopes))
+	_, err := t.redis.Client().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, scope := range scopes {
+			counts[i] = pipe.Incr(ctx, loginFailurePrefix+scope.key)
+			pipe.Expire(ctx, loginFailurePrefix+scope.key, t.cfg.failureWindow)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Warn("login throttle unavailable", zap.Error(err))
+		return
+	}
+
+	for i, scope := range scopes {
+		failures := counts[i].Val()
+		if failures < scope.limit {
+			continue
+		}
+		lockout := t.cfg.lockout(failures, scope.limit)
+		if err := t.redis.Client().Set(ctx, loginLockPrefix+scope.key, failures, lockout).Err(); err != nil {
+			logger.Log.Warn("failed to lock out login", zap.String("scope", scope.name), zap.Error(err))
+			continue
+		}
+		metrics.LoginLockouts.WithLabelValues(scope.name).Inc()
+		logger.Log.Warn("login locked out",
+			zap.String("scope", scope.key),
+			zap.Int64("failures", failures),
+			zap.Duration("lockout", lockout))
+	}
+}
+
+// reset forgets the failed logins of username after a successful login.
+// The client IP keeps its count, so one valid account does not unlock
+// guessing against others.
+func (t *loginThrottle) reset(ctx context.Context, username string) {
+	key := "account:" + strings.ToLower(username)
+	if err := t.redis.Client().Del(ctx, loginFailurePrefix+key).Err(); err != nil {
+		logger.Log.Warn("failed to reset login failures", zap.Error(err))
+	}
+}
+
+// clientIP returns the host part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
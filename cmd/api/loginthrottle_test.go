@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLockout_DoublesUpToMax(t *testing.T) {
+	cfg := &loginThrottleConfig{baseLockout: time.Minute, maxLockout: 5 * time.Minute}
+
+	for failures, want := range map[int64]time.Duration{
+		5:  time.Minute,
+		6:  2 * time.Minute,
+		7:  4 * time.Minute,
+		8:  5 * time.Minute,
+		50: 5 * time.Minute,
+	} {
+		if got := cfg.lockout(failures, 5); got != want {
+			t.Errorf("lockout(%d) = %s; want %s", failures, got, want)
+		}
+	}
+}
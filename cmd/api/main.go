@@ -6,16 +6,21 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/alim08/fin_line/cmd/api/graph"
 	"github.com/alim08/fin_line/pkg/auth"
 	"github.com/alim08/fin_line/pkg/config"
 	"github.com/alim08/fin_line/pkg/database"
 	"github.com/alim08/fin_line/pkg/logger"
 	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
 	"github.com/alim08/fin_line/pkg/redisclient"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
@@ -27,37 +32,92 @@ func main() {
 	log.Info("starting fin-line API server")
 
 	// Load configuration
-	cfg := config.Load()
-	log.Info("configuration loaded", zap.String("environment", cfg.Environment))
-
-	// Initialize database
-	dbConfig := database.NewConfig()
-	db, err := database.New(dbConfig)
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("failed to connect to database", zap.Error(err))
+		log.Fatal("failed to load configuration", zap.Error(err))
 	}
-	defer db.Close()
+	environment := os.Getenv("ENVIRONMENT")
+	log.Info("configuration loaded", zap.String("environment", environment))
 
-	// Run database migrations
+	// Initialize database
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	
-	if err := db.RunMigrations(ctx); err != nil {
-		log.Fatal("failed to run database migrations", zap.Error(err))
+
+	db, repos, err := openStore(ctx)
+	if err != nil {
+		log.Fatal("failed to open database", zap.Error(err))
 	}
-	log.Info("database migrations completed")
+	defer db.Close()
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	// Export connection pool statistics as Prometheus gauges
+	go database.NewPoolStatsExporter(db).Run(jobsCtx)
 
 	// Initialize repositories
-	quoteRepo := database.NewQuoteRepository(db)
-	anomalyRepo := database.NewAnomalyRepository(db)
-	rawEventRepo := database.NewRawEventRepository(db)
+	quoteRepo := repos.quotes
+	anomalyRepo := repos.anomalies
+	rawEventRepo := repos.rawEvents
+	tickerRepo := repos.tickers
+	sectorRepo := repos.sectors
+	detectorConfigRepo := repos.detectorConfig
+	webhookRepo := repos.webhooks
+	watchlistRepo := repos.watchlists
+	manualAnomalyRepo := repos.manualAnomaly
+	userRepo := repos.users
+	apiKeyRepo := repos.apiKeys
+	authAuditRepo := repos.authAudit
 
 	// Initialize Redis client
-	redisClient, err := redisclient.New(cfg.Redis)
+	redisClient := redisclient.New(cfg.RedisURL)
+	defer redisClient.Close()
+	// Export Redis memory, client and stream length gauges
+	go redisclient.NewStatsExporter(redisClient).Run(jobsCtx)
+	redisClient.StartClientCache(jobsCtx, redisclient.NewClientCacheConfig())
+
+	// Cold data archived out of Redis lives in the redis_archive_* tables,
+	// which only the Postgres store has
+	var archiveRepo database.RedisArchiveRepository
+	if pg, ok := db.(*database.DB); ok {
+		archiveRepo = database.NewRedisArchiveRepository(pg)
+
+		// Keep quotes_partitioned partitions ahead of time and within retention
+		partitionConfig := database.NewPartitionConfig()
+		if err := partitionConfig.Validate(); err != nil {
+			log.Fatal("invalid partition configuration", zap.Error(err))
+		}
+
+		// Only the replica holding the maintenance lock manages partitions
+		// and refreshes the OHLC candle views the candles endpoints roll up.
+		// Both are idempotent, so a stale leader needs no fencing.
+		go redisClient.RunAsLeader(jobsCtx, "api-maintenance", redisclient.DefaultLeaseTTL, func(ctx context.Context, token int64) {
+			partitionsDone := make(chan struct{})
+			go func() {
+				defer close(partitionsDone)
+				database.NewPartitionManager(pg, partitionConfig).Run(ctx)
+			}()
+			database.NewCandleRefresher(pg).Run(ctx)
+			<-partitionsDone
+		})
+	}
+
+	// Publish reference data so the normalize service starts from Postgres
+	if err := publishReferenceData(ctx, tickerRepo, redisClient); err != nil {
+		log.Warn("failed to publish reference data", zap.Error(err))
+	}
+	if err := publishDetectorConfig(ctx, detectorConfigRepo, redisClient); err != nil {
+		log.Warn("failed to publish detector config", zap.Error(err))
+	}
+	if err := bootstrapAdmin(ctx, userRepo); err != nil {
+		log.Warn("failed to create admin user", zap.Error(err))
+	}
+
+	// Relay events committed to the outbox to Redis streams
+	outboxCfg, err := loadOutboxRelayConfig()
 	if err != nil {
-		log.Fatal("failed to connect to Redis", zap.Error(err))
+		log.Fatal("failed to load outbox relay configuration", zap.Error(err))
 	}
-	defer redisClient.Close()
+	go newOutboxRelay(repos.outbox, db, tickerRepo, redisClient, outboxCfg).Run(jobsCtx)
 
 	// Initialize authentication service
 	authConfig := auth.NewConfig()
@@ -65,6 +125,27 @@ func main() {
 	if err != nil {
 		log.Fatal("failed to initialize authentication service", zap.Error(err))
 	}
+	authService.SetRevocationStore(auth.NewRedisRevocationStore(redisClient))
+	authService.SetAPIKeyStore(apiKeyRepo)
+	authService.SetAuditSink(authAuditRepo)
+
+	// Load per-route timeout and body size limits
+	limitsCfg, err := loadLimitsConfig()
+	if err != nil {
+		log.Fatal("failed to load route limits", zap.Error(err))
+	}
+
+	// Load failed login limits
+	loginThrottleCfg, err := loadLoginThrottleConfig()
+	if err != nil {
+		log.Fatal("failed to load login throttling", zap.Error(err))
+	}
+
+	// Load per-principal request quotas
+	quotaCfg, err := loadQuotaConfig()
+	if err != nil {
+		log.Fatal("failed to load request quotas", zap.Error(err))
+	}
 
 	// Create router
 	router := mux.NewRouter()
@@ -73,6 +154,7 @@ func main() {
 	router.Use(loggingMiddleware)
 	router.Use(corsMiddleware)
 	router.Use(metricsMiddleware)
+	router.Use(limitsMiddleware(limitsCfg))
 
 	// Health check endpoint (no auth required)
 	router.HandleFunc("/health", healthHandler(db, redisClient)).Methods("GET")
@@ -80,49 +162,202 @@ func main() {
 
 	// API routes with authentication
 	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	// v1 quote routes replaced by v2 point clients at their successor
+	apiRouter.Use(deprecationMiddleware)
 	
 	// Public endpoints (no auth required)
 	apiRouter.HandleFunc("/quotes/latest", getLatestQuotesHandler(quoteRepo)).Methods("GET")
 	apiRouter.HandleFunc("/quotes/{ticker}", getQuotesByTickerHandler(quoteRepo)).Methods("GET")
-	apiRouter.HandleFunc("/stats", getStatsHandler(quoteRepo)).Methods("GET")
+	apiRouter.HandleFunc("/stats", getStatsHandler(quoteRepo, redisClient)).Methods("GET")
+	apiRouter.HandleFunc("/search", searchTickersHandler(tickerRepo)).Methods("GET")
+
+	// Token issuance (no auth required)
+	apiRouter.HandleFunc("/auth/login", loginHandler(userRepo, authService, newLoginThrottle(redisClient, loginThrottleCfg))).Methods("POST")
+	apiRouter.HandleFunc("/auth/refresh", refreshTokenHandler(userRepo, authService)).Methods("POST")
+	apiRouter.HandleFunc("/auth/logout", logoutHandler(userRepo, authService)).Methods("POST")
+
+	// Quota usage of the caller; not itself counted, so it stays reachable
+	// once the quota is used up
+	usageRouter := apiRouter.PathPrefix("/usage").Subrouter()
+	usageRouter.Use(authService.AuthMiddleware)
+	usageRouter.Use(auth.TenantMiddleware)
+	usageRouter.HandleFunc("", usageHandler(redisClient, quotaCfg)).Methods("GET")
 
 	// Protected endpoints (auth required)
 	protectedRouter := apiRouter.PathPrefix("").Subrouter()
 	protectedRouter.Use(authService.AuthMiddleware)
+	protectedRouter.Use(auth.TenantMiddleware)
+	protectedRouter.Use(quotaMiddleware(redisClient, quotaCfg))
+	protectedRouter.Use(idempotencyMiddleware(redisClient))
+
+	// User-level endpoints, grouped by the permission they require
+	quotesRouter := protectedRouter.PathPrefix("").Subrouter()
+	quotesRouter.Use(authService.PermissionMiddleware(auth.PermQuotesRead))
+	quotesRouter.HandleFunc("/quotes/sector/{sector}", getQuotesBySectorHandler(quoteRepo)).Methods("GET")
+	quotesRouter.HandleFunc("/quotes/{ticker}/history", getQuoteHistoryHandler(quoteRepo)).Methods("GET")
+	quotesRouter.HandleFunc("/quotes/{ticker}/at", getQuoteAtHandler(quoteRepo)).Methods("GET")
+	quotesRouter.HandleFunc("/quotes/{ticker}/performance", getQuotePerformanceHandler(quoteRepo)).Methods("GET")
+
+	anomalyReadRouter := protectedRouter.PathPrefix("").Subrouter()
+	anomalyReadRouter.Use(authService.PermissionMiddleware(auth.PermAnomaliesRead))
+	anomalyReadRouter.HandleFunc("/anomalies", getAnomaliesHandler(anomalyRepo)).Methods("GET")
+	anomalyReadRouter.HandleFunc("/anomalies/{ticker}", getAnomaliesByTickerHandler(anomalyRepo)).Methods("GET")
+	anomalyReadRouter.HandleFunc("/anomalies/{ticker}/range", getAnomalyRangeHandler(redisClient)).Methods("GET")
+
+	anomalyWriteRouter := protectedRouter.PathPrefix("").Subrouter()
+	anomalyWriteRouter.Use(authService.PermissionMiddleware(auth.PermAnomaliesWrite))
+	anomalyWriteRouter.HandleFunc("/anomalies", createAnomalyHandler(manualAnomalyRepo, redisClient)).Methods("POST")
+	anomalyWriteRouter.HandleFunc("/anomalies/{id:[0-9]+}", deleteAnomalyHandler(manualAnomalyRepo)).Methods("DELETE")
+
+	// Webhook subscriptions
+	webhookReadRouter := protectedRouter.PathPrefix("").Subrouter()
+	webhookReadRouter.Use(authService.PermissionMiddleware(auth.PermWebhooksRead))
+	webhookReadRouter.HandleFunc("/webhooks", listWebhooksHandler(webhookRepo)).Methods("GET")
+	webhookReadRouter.HandleFunc("/webhooks/{id:[0-9]+}", getWebhookHandler(webhookRepo)).Methods("GET")
+
+	webhookWriteRouter := protectedRouter.PathPrefix("").Subrouter()
+	webhookWriteRouter.Use(authService.PermissionMiddleware(auth.PermWebhooksWrite))
+	webhookWriteRouter.HandleFunc("/webhooks", createWebhookHandler(webhookRepo)).Methods("POST")
+	webhookWriteRouter.HandleFunc("/webhooks/{id:[0-9]+}", updateWebhookHandler(webhookRepo)).Methods("PUT")
+	webhookWriteRouter.HandleFunc("/webhooks/{id:[0-9]+}", deleteWebhookHandler(webhookRepo)).Methods("DELETE")
+
+	// Watchlists
+	watchlistReadRouter := protectedRouter.PathPrefix("").Subrouter()
+	watchlistReadRouter.Use(authService.PermissionMiddleware(auth.PermWatchlistsRead))
+	watchlistReadRouter.HandleFunc("/watchlists", listWatchlistsHandler(watchlistRepo)).Methods("GET")
+	watchlistReadRouter.HandleFunc("/watchlists/{id:[0-9]+}", getWatchlistHandler(watchlistRepo)).Methods("GET")
+	watchlistReadRouter.HandleFunc("/watchlists/{id:[0-9]+}/quotes", getWatchlistQuotesHandler(watchlistRepo, quoteRepo, redisClient)).Methods("GET")
+	watchlistReadRouter.HandleFunc("/watchlists/{id:[0-9]+}/stream", streamWatchlistHandler(watchlistRepo, redisClient)).Methods("GET")
+
+	watchlistWriteRouter := protectedRouter.PathPrefix("").Subrouter()
+	watchlistWriteRouter.Use(authService.PermissionMiddleware(auth.PermWatchlistsWrite))
+	watchlistWriteRouter.HandleFunc("/watchlists", createWatchlistHandler(watchlistRepo)).Methods("POST")
+	watchlistWriteRouter.HandleFunc("/watchlists/{id:[0-9]+}", updateWatchlistHandler(watchlistRepo)).Methods("PUT")
+	watchlistWriteRouter.HandleFunc("/watchlists/{id:[0-9]+}", deleteWatchlistHandler(watchlistRepo)).Methods("DELETE")
+
+	// Admin endpoints, one subrouter per admin permission
+	adminRouter := protectedRouter.PathPrefix("/admin").Subrouter()
 
-	// User-level endpoints
-	protectedRouter.HandleFunc("/quotes/sector/{sector}", getQuotesBySectorHandler(quoteRepo)).Methods("GET")
-	protectedRouter.HandleFunc("/quotes/{ticker}/history", getQuoteHistoryHandler(quoteRepo)).Methods("GET")
-	protectedRouter.HandleFunc("/anomalies", getAnomaliesHandler(anomalyRepo)).Methods("GET")
-	protectedRouter.HandleFunc("/anomalies/{ticker}", getAnomaliesByTickerHandler(anomalyRepo)).Methods("GET")
+	systemRouter := adminRouter.PathPrefix("").Subrouter()
+	systemRouter.Use(authService.PermissionMiddleware(auth.PermAdminSystem))
+	systemRouter.HandleFunc("/migrations/status", getMigrationStatusHandler(db)).Methods("GET")
+
+	// Token revocation and API keys for machine clients
+	authAdminRouter := adminRouter.PathPrefix("").Subrouter()
+	authAdminRouter.Use(authService.PermissionMiddleware(auth.PermAdminAuth))
+	authAdminRouter.HandleFunc("/tokens/revoke", revokeTokenHandler(authService)).Methods("POST")
+	authAdminRouter.HandleFunc("/service-tokens", mintServiceTokenHandler(authService)).Methods("POST")
+	authAdminRouter.HandleFunc("/audit/auth", listAuthEventsHandler(authAuditRepo)).Methods("GET")
+	authAdminRouter.HandleFunc("/api-keys", listAPIKeysHandler(apiKeyRepo)).Methods("GET")
+	authAdminRouter.HandleFunc("/api-keys", createAPIKeyHandler(apiKeyRepo)).Methods("POST")
+	authAdminRouter.HandleFunc("/api-keys/{id:[0-9]+}", getAPIKeyHandler(apiKeyRepo)).Methods("GET")
+	authAdminRouter.HandleFunc("/api-keys/{id:[0-9]+}", updateAPIKeyHandler(apiKeyRepo)).Methods("PUT")
+	authAdminRouter.HandleFunc("/api-keys/{id:[0-9]+}", revokeAPIKeyHandler(apiKeyRepo)).Methods("DELETE")
+
+	// User accounts, roles and sessions
+	usersRouter := adminRouter.PathPrefix("").Subrouter()
+	usersRouter.Use(authService.PermissionMiddleware(auth.PermAdminUsers))
+	usersRouter.HandleFunc("/users", listUsersHandler(userRepo)).Methods("GET")
+	usersRouter.HandleFunc("/users", createUserHandler(userRepo, authService)).Methods("POST")
+	usersRouter.HandleFunc("/users/{id:[0-9]+}", getUserHandler(userRepo)).Methods("GET")
+	usersRouter.HandleFunc("/users/{id:[0-9]+}/disable", setUserActiveHandler(userRepo, false)).Methods("POST")
+	usersRouter.HandleFunc("/users/{id:[0-9]+}/enable", setUserActiveHandler(userRepo, true)).Methods("POST")
+	usersRouter.HandleFunc("/users/{id:[0-9]+}/roles", setUserRolesHandler(userRepo, authService)).Methods("PUT")
+	usersRouter.HandleFunc("/users/{id:[0-9]+}/password", resetPasswordHandler(userRepo)).Methods("POST")
+	usersRouter.HandleFunc("/users/{id:[0-9]+}/sessions", listSessionsHandler(userRepo)).Methods("GET")
+	usersRouter.HandleFunc("/roles", listRolesHandler(userRepo)).Methods("GET")
+	usersRouter.HandleFunc("/roles", createRoleHandler(userRepo)).Methods("POST")
+
+	anomalyAdminRouter := adminRouter.PathPrefix("").Subrouter()
+	anomalyAdminRouter.Use(authService.PermissionMiddleware(auth.PermAdminAnomalies))
+	anomalyAdminRouter.HandleFunc("/anomalies/{id:[0-9]+}/restore", restoreAnomalyHandler(manualAnomalyRepo)).Methods("POST")
+	anomalyAdminRouter.HandleFunc("/anomalies/{id:[0-9]+}/acknowledge", acknowledgeAnomalyHandler(manualAnomalyRepo)).Methods("POST")
+	anomalyAdminRouter.HandleFunc("/anomalies/{id:[0-9]+}/audit", getAnomalyAuditLogHandler(manualAnomalyRepo)).Methods("GET")
+
+	// Raw feed events and reference data management
+	feedsRouter := adminRouter.PathPrefix("").Subrouter()
+	feedsRouter.Use(authService.PermissionMiddleware(auth.PermAdminFeeds))
+	feedsRouter.HandleFunc("/raw-events", getRawEventsHandler(rawEventRepo)).Methods("GET")
+	feedsRouter.HandleFunc("/raw-events/source/{source}", getRawEventsBySourceHandler(rawEventRepo)).Methods("GET")
+	feedsRouter.HandleFunc("/tickers", listTickersHandler(tickerRepo)).Methods("GET")
+	feedsRouter.HandleFunc("/tickers", createTickerHandler(tickerRepo)).Methods("POST")
+	feedsRouter.HandleFunc("/tickers/{symbol}", getTickerHandler(tickerRepo)).Methods("GET")
+	feedsRouter.HandleFunc("/tickers/{symbol}/sector", assignSectorHandler(tickerRepo)).Methods("PUT")
+	feedsRouter.HandleFunc("/tickers/{symbol}", deactivateTickerHandler(tickerRepo)).Methods("DELETE")
+	feedsRouter.HandleFunc("/sectors", listSectorsHandler(sectorRepo)).Methods("GET")
+	feedsRouter.HandleFunc("/sectors", createSectorHandler(sectorRepo)).Methods("POST")
+	feedsRouter.HandleFunc("/sectors/{name}", getSectorHandler(sectorRepo)).Methods("GET")
+	feedsRouter.HandleFunc("/sectors/{name}", updateSectorHandler(sectorRepo)).Methods("PUT")
+	feedsRouter.HandleFunc("/sectors/{name}", deleteSectorHandler(sectorRepo)).Methods("DELETE")
+
+	// Anomaly detector configuration
+	detectorRouter := adminRouter.PathPrefix("").Subrouter()
+	detectorRouter.Use(authService.PermissionMiddleware(auth.PermAdminDetector))
+	detectorRouter.HandleFunc("/detector/config", getDetectorConfigHandler(detectorConfigRepo)).Methods("GET")
+	detectorRouter.HandleFunc("/detector/config", updateDetectorConfigHandler(detectorConfigRepo, redisClient)).Methods("PUT")
+	detectorRouter.HandleFunc("/detector/config/{ticker}", updateDetectorConfigHandler(detectorConfigRepo, redisClient)).Methods("PUT")
+	detectorRouter.HandleFunc("/detector/config/{ticker}", deleteDetectorConfigHandler(detectorConfigRepo, redisClient)).Methods("DELETE")
+
+	// Cold data archived out of Redis
+	if archiveRepo != nil {
+		archiveRouter := adminRouter.PathPrefix("").Subrouter()
+		archiveRouter.Use(authService.PermissionMiddleware(auth.PermAdminArchive))
+		archiveRouter.HandleFunc("/archive/partitions", listArchivePartitionsHandler(archiveRepo)).Methods("GET")
+		archiveRouter.HandleFunc("/archive/{dataset}", getArchivedRecordsHandler(archiveRepo)).Methods("GET")
+	}
 
-	// Admin endpoints (admin role required)
-	adminRouter := protectedRouter.PathPrefix("/admin").Subrouter()
-	adminRouter.Use(authService.RoleMiddleware("admin"))
-	
-	adminRouter.HandleFunc("/raw-events", getRawEventsHandler(rawEventRepo)).Methods("GET")
-	adminRouter.HandleFunc("/raw-events/source/{source}", getRawEventsBySourceHandler(rawEventRepo)).Methods("GET")
-	adminRouter.HandleFunc("/migrations/status", getMigrationStatusHandler(db)).Methods("GET")
+	// Profiling and runtime diagnostics
+	registerDebugRoutes(systemRouter, db, redisClient)
+
+	// API v2: Postgres- and cache-backed quote reads (public)
+	apiV2Router := router.PathPrefix("/api/v2").Subrouter()
+	apiV2Router.HandleFunc("/quotes", listQuotesV2Handler(quoteRepo)).Methods("GET")
+	apiV2Router.HandleFunc("/quotes/latest", latestQuotesV2Handler(quoteRepo, redisClient)).Methods("GET")
+	apiV2Router.HandleFunc("/quotes/{ticker}", quoteByTickerV2Handler(quoteRepo, redisClient)).Methods("GET")
+	apiV2Router.HandleFunc("/quotes/{ticker}/sparkline", quoteSparklineV2Handler(quoteRepo, redisClient, redisclient.NewTimeSeriesConfig())).Methods("GET")
 
-	// GraphQL endpoint (auth required)
-	graphQLRouter := router.PathPrefix("/graphql").Subrouter()
-	graphQLRouter.Use(authService.AuthMiddleware)
-	// GraphQL handler setup would go here
+	// GraphQL endpoint (auth required; playground outside production)
+	graphQLCostCfg, err := loadGraphQLCostConfig()
+	if err != nil {
+		log.Fatal("failed to load GraphQL limits", zap.Error(err))
+	}
+	graphResolver := graph.NewResolver(redisClient, quoteRepo, tickerRepo, sectorRepo, detectorConfigRepo, webhookRepo, manualAnomalyRepo, func(ctx context.Context) error {
+		return publishDetectorConfig(ctx, detectorConfigRepo, redisClient)
+	})
+	registerGraphQLRoutes(router, graphResolver, graphQLCostCfg, authService, quotaMiddleware(redisClient, quotaCfg), environment != "production")
 
 	// Metrics endpoint (no auth required)
-	router.Handle("/metrics", metrics.Handler())
+	router.Handle("/metrics", promhttp.Handler())
 
 	// Create HTTP server
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.API.Port),
+		Addr:         fmt.Sprintf(":%d", cfg.HTTPPort),
 		Handler:      router,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		// Per-route deadlines are enforced by limitsMiddleware; WriteTimeout is
+		// left unset so routes configured without a timeout can stream.
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	// Serve TLS, optionally verifying client certificates of internal services
+	if authConfig.MTLS.Enabled() {
+		server.TLSConfig, err = authConfig.MTLS.ServerTLSConfig()
+		if err != nil {
+			log.Fatal("failed to configure TLS", zap.Error(err))
+		}
 	}
 
 	// Start server in goroutine
 	go func() {
+		if server.TLSConfig != nil {
+			log.Info("starting HTTPS server", zap.String("addr", server.Addr), zap.Bool("client_certs", server.TLSConfig.ClientCAs != nil))
+			err := server.ListenAndServeTLS(authConfig.MTLS.CertFile, authConfig.MTLS.KeyFile)
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal("failed to start server", zap.Error(err))
+			}
+			return
+		}
 		log.Info("starting HTTP server", zap.String("addr", server.Addr))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal("failed to start server", zap.Error(err))
@@ -147,31 +382,8 @@ func main() {
 	log.Info("server exited")
 }
 
-// Health check handler
-func healthHandler(db *database.DB, redisClient *redisclient.Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-
-		// Check database health
-		if err := db.HealthCheck(ctx); err != nil {
-			http.Error(w, "Database health check failed", http.StatusServiceUnavailable)
-			return
-		}
-
-		// Check Redis health
-		if err := redisClient.Ping(ctx); err != nil {
-			http.Error(w, "Redis health check failed", http.StatusServiceUnavailable)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
-	}
-}
-
 // Readiness check handler
-func readyHandler(db *database.DB, redisClient *redisclient.Client) http.HandlerFunc {
+func readyHandler(db store, redisClient *redisclient.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
@@ -183,7 +395,7 @@ func readyHandler(db *database.DB, redisClient *redisclient.Client) http.Handler
 		}
 
 		// Check Redis readiness
-		if err := redisClient.Ping(ctx); err != nil {
+		if err := redisClient.Client().Ping(ctx).Err(); err != nil {
 			http.Error(w, "Redis not ready", http.StatusServiceUnavailable)
 			return
 		}
@@ -196,20 +408,32 @@ func readyHandler(db *database.DB, redisClient *redisclient.Client) http.Handler
 // Latest quotes handler
 func getLatestQuotesHandler(quoteRepo database.QuoteRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseListOptions(r, "price", "timestamp")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if opts.SortBy == "" {
+			// Keep the historical alphabetical ordering unless a sort is requested
+			opts.SortBy = "ticker"
+			opts.SortDesc = opts.OrderSet && opts.SortDesc
+		}
+		if opts.Limit == 0 {
+			// One row per ticker; return the whole universe by default
+			opts.Limit = 1000
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		quotes, err := quoteRepo.GetLatestQuotes(ctx)
+		quotes, err := quoteRepo.ListQuotes(ctx, database.QuoteFilter{Latest: true, ListOptions: opts})
 		if err != nil {
 			logger.Log.Error("failed to get latest quotes", zap.Error(err))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, quotes)
 	}
 }
 
@@ -225,40 +449,23 @@ func getQuotesByTickerHandler(quoteRepo database.QuoteRepository) http.HandlerFu
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-		defer cancel()
-
-		quotes, err := quoteRepo.GetQuotesByTicker(ctx, ticker, 100)
+		opts, err := parseListOptions(r, "price", "timestamp")
 		if err != nil {
-			logger.Log.Error("failed to get quotes by ticker", zap.Error(err), zap.String("ticker", ticker))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
-	}
-}
-
-// Stats handler
-func getStatsHandler(quoteRepo database.QuoteRepository) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		stats, err := quoteRepo.GetQuoteStats(ctx)
+		quotes, err := quoteRepo.ListQuotes(ctx, database.QuoteFilter{Ticker: ticker, ListOptions: opts})
 		if err != nil {
-			logger.Log.Error("failed to get quote stats", zap.Error(err))
+			logger.Log.Error("failed to get quotes by ticker", zap.Error(err), zap.String("ticker", ticker))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, quotes)
 	}
 }
 
@@ -274,32 +481,38 @@ func getQuotesBySectorHandler(quoteRepo database.QuoteRepository) http.HandlerFu
 			return
 		}
 
+		opts, err := parseListOptions(r, "price", "timestamp")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		quotes, err := quoteRepo.GetQuotesBySector(ctx, sector, 100)
+		quotes, err := quoteRepo.ListQuotes(ctx, database.QuoteFilter{Sector: sector, ListOptions: opts})
 		if err != nil {
 			logger.Log.Error("failed to get quotes by sector", zap.Error(err), zap.String("sector", sector))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, quotes)
 	}
 }
 
-// Quote history handler
+// Quote history handler. With ?resolution= (a duration) or ?max_points=,
+// quotes are downsampled in Postgres to the first, last, lowest and highest
+// quote of each bucket.
 func getQuoteHistoryHandler(quoteRepo database.QuoteRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		ticker := vars["ticker"]
 
 		// Parse query parameters for time range
-		startStr := r.URL.Query().Get("start")
-		endStr := r.URL.Query().Get("end")
+		q := r.URL.Query()
+		startStr := q.Get("start")
+		endStr := q.Get("end")
 
 		// Validate parameters
 		if ticker == "" || startStr == "" || endStr == "" {
@@ -307,52 +520,131 @@ func getQuoteHistoryHandler(quoteRepo database.QuoteRepository) http.HandlerFunc
 			return
 		}
 
-		// Parse timestamps (simplified)
-		start := int64(0) // Parse from startStr
-		end := int64(0)   // Parse from endStr
+		start, err := parseTimestampParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		end, err := parseTimestampParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var resolution time.Duration
+		if v := q.Get("resolution"); v != "" {
+			resolution, err = time.ParseDuration(v)
+			if err != nil || resolution < time.Millisecond {
+				writeError(w, http.StatusBadRequest, "resolution must be a duration of at least 1ms")
+				return
+			}
+		} else if v := q.Get("max_points"); v != "" {
+			maxPoints, err := strconv.Atoi(v)
+			if err != nil || maxPoints < 4 {
+				writeError(w, http.StatusBadRequest, "max_points must be an integer of at least 4")
+				return
+			}
+			resolution = database.DownsampleResolution(start, end, maxPoints)
+		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		quotes, err := quoteRepo.GetQuotesByTimeRange(ctx, ticker, start, end)
+		var quotes []*models.NormalizedTick
+		if resolution > 0 {
+			quotes, err = quoteRepo.GetQuotesByTimeRangeDownsampled(ctx, ticker, start, end, resolution)
+		} else {
+			quotes, err = quoteRepo.GetQuotesByTimeRange(ctx, ticker, start, end)
+		}
 		if err != nil {
 			logger.Log.Error("failed to get quote history", zap.Error(err), zap.String("ticker", ticker))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, repositoryErrorStatus(err), err.Error())
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, quotes)
+	}
+}
+
+// Quote snapshot handler: last known quote at or before ?ts=
+func getQuoteAtHandler(quoteRepo database.QuoteRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(mux.Vars(r)["ticker"])
+
+		tsStr := r.URL.Query().Get("ts")
+		if tsStr == "" {
+			writeError(w, http.StatusBadRequest, "ts parameter is required")
+			return
+		}
+		ts, err := parseTimestampParam(tsStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		quote, err := quoteRepo.GetQuoteAt(ctx, ticker, ts)
+		if err != nil {
+			logger.Log.Error("failed to get quote at time", zap.Error(err), zap.String("ticker", ticker), zap.Int64("ts", ts))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: quote})
 	}
 }
 
 // Anomalies handler
 func getAnomaliesHandler(anomalyRepo database.AnomalyRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse query parameters
-		minZScoreStr := r.URL.Query().Get("min_zscore")
-		limitStr := r.URL.Query().Get("limit")
+		opts, err := parseListOptions(r, "price", "timestamp", "zscore")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if opts.SortBy == "" {
+			opts.SortBy = "zscore"
+			opts.SortDesc = !opts.OrderSet || opts.SortDesc
+		}
 
-		// Parse parameters (simplified)
 		minZScore := 2.0 // Default threshold
-		limit := 100     // Default limit
+		if v := r.URL.Query().Get("min_zscore"); v != "" {
+			minZScore, err = strconv.ParseFloat(v, 64)
+			if err != nil || minZScore < 0 {
+				writeError(w, http.StatusBadRequest, "Invalid min_zscore")
+				return
+			}
+		}
+
+		severity := r.URL.Query().Get("severity")
+		if severity != "" && !models.IsValidSeverity(severity) {
+			writeError(w, http.StatusBadRequest, "Invalid severity")
+			return
+		}
+		status := r.URL.Query().Get("status")
+		if status != "" && !models.IsValidAnomalyStatus(status) {
+			writeError(w, http.StatusBadRequest, "Invalid status")
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		anomalies, err := anomalyRepo.GetAnomaliesByZScore(ctx, minZScore, limit)
+		anomalies, err := anomalyRepo.ListAnomalies(ctx, database.AnomalyFilter{
+			MinZScore:   minZScore,
+			Severity:    severity,
+			Status:      status,
+			ListOptions: opts,
+		})
 		if err != nil {
 			logger.Log.Error("failed to get anomalies", zap.Error(err))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, anomalies)
 	}
 }
 
@@ -368,44 +660,91 @@ func getAnomaliesByTickerHandler(anomalyRepo database.AnomalyRepository) http.Ha
 			return
 		}
 
+		opts, err := parseListOptions(r, "price", "timestamp", "zscore")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		anomalies, err := anomalyRepo.GetAnomaliesByTicker(ctx, ticker, 100)
+		anomalies, err := anomalyRepo.ListAnomalies(ctx, database.AnomalyFilter{Ticker: ticker, ListOptions: opts})
 		if err != nil {
 			logger.Log.Error("failed to get anomalies by ticker", zap.Error(err), zap.String("ticker", ticker))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, anomalies)
 	}
 }
 
-// Raw events handler (admin only)
-func getRawEventsHandler(rawEventRepo database.RawEventRepository) http.HandlerFunc {
+// Anomaly range handler. Pages through the anomalies:<ticker> sorted set
+// within ?since= and ?until=, newest first unless ?order=asc, with ?page=
+// and ?limit=. Pass until when paging so later anomalies do not shift pages.
+func getAnomalyRangeHandler(redisClient *redisclient.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ticker := strings.ToUpper(mux.Vars(r)["ticker"])
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		page := 1
+		if v := r.URL.Query().Get("page"); v != "" {
+			page, err = strconv.Atoi(v)
+			if err != nil || page < 1 {
+				writeError(w, http.StatusBadRequest, "page must be a positive integer")
+				return
+			}
+		}
+		perPage := opts.Limit
+		if perPage == 0 {
+			perPage = 100
+		}
+
+		rng := redisclient.AnomalyRange{
+			Offset:      int64((page - 1) * perPage),
+			Limit:       int64(perPage),
+			NewestFirst: !strings.EqualFold(r.URL.Query().Get("order"), "asc"),
+		}
+		if opts.Since != nil {
+			rng.Since = *opts.Since
+		}
+		if opts.Until != nil {
+			rng.Until = *opts.Until
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		// Get events from last 24 hours
-		end := time.Now()
-		start := end.Add(-24 * time.Hour)
-
-		events, err := rawEventRepo.GetRawEventsByTimeRange(ctx, start, end)
+		total, err := redisClient.CountAnomaliesInRange(ctx, ticker, rng)
 		if err != nil {
-			logger.Log.Error("failed to get raw events", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Log.Error("failed to count anomalies", zap.Error(err), zap.String("ticker", ticker))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		anomalies, err := redisClient.AnomaliesInRange(ctx, ticker, rng)
+		if err != nil {
+			logger.Log.Error("failed to read anomaly range", zap.Error(err), zap.String("ticker", ticker))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeJSON(w, http.StatusOK, Response{
+			Success: true,
+			Data:    anomalies,
+			Meta: &Meta{
+				Total:    &total,
+				Page:     page,
+				PerPage:  perPage,
+				HasMore:  rng.Offset+int64(len(anomalies)) < total,
+				Duration: time.Since(start).Milliseconds(),
+			},
+		})
 	}
 }
 
@@ -431,15 +770,12 @@ func getRawEventsBySourceHandler(rawEventRepo database.RawEventRepository) http.
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeList(w, r, events)
 	}
 }
 
 // Migration status handler (admin only)
-func getMigrationStatusHandler(db *database.DB) http.HandlerFunc {
+func getMigrationStatusHandler(db store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
@@ -451,10 +787,7 @@ func getMigrationStatusHandler(db *database.DB) http.HandlerFunc {
 			return
 		}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		// JSON marshaling would go here
+		writeJSON(w, http.StatusOK, status)
 	}
 }
 
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// outboxStreamMaxLen caps each events stream, approximately
+	outboxStreamMaxLen = 100000
+	// outboxCleanupInterval is how often published events are deleted
+	outboxCleanupInterval = time.Hour
+)
+
+// outboxRelayConfig configures the outbox relay
+type outboxRelayConfig struct {
+	pollInterval time.Duration
+	batchSize    int
+	retention    time.Duration
+}
+
+// loadOutboxRelayConfig reads the outbox relay settings:
+//
+//	OUTBOX_POLL_INTERVAL  how often the outbox is checked without a notification (5s)
+//	OUTBOX_BATCH_SIZE     events relayed per transaction (100)
+//	OUTBOX_RETENTION      how long published events are kept (24h)
+func loadOutboxRelayConfig() (*outboxRelayConfig, error) {
+	cfg := &outboxRelayConfig{
+		pollInterval: 5 * time.Second,
+		batchSize:    100,
+		retention:    24 * time.Hour,
+	}
+
+	if v := os.Getenv("OUTBOX_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid OUTBOX_BATCH_SIZE: %q", v)
+		}
+		cfg.batchSize = n
+	}
+	for name, dst := range map[string]*time.Duration{
+		"OUTBOX_POLL_INTERVAL": &cfg.pollInterval,
+		"OUTBOX_RETENTION":     &cfg.retention,
+	} {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*dst = d
+		}
+	}
+
+	return cfg, nil
+}
+
+// outboxRelay publishes the events repositories commit to the outbox table
+// to their Redis streams, so a change and its event are never recorded one
+// without the other. Events are delivered at least once; the outbox_id field
+// lets consumers drop duplicates.
+type outboxRelay struct {
+	repo       database.OutboxRepository
+	listener   outboxListener
+	tickerRepo database.TickerRepository
+	redis      *redisclient.Client
+	cfg        *outboxRelayConfig
+}
+
+// newOutboxRelay creates a new outbox relay for repo. Commit notifications
+// are used if db has them.
+func newOutboxRelay(repo database.OutboxRepository, db store, tickerRepo database.TickerRepository, redisClient *redisclient.Client, cfg *outboxRelayConfig) *outboxRelay {
+	listener, _ := db.(outboxListener)
+	return &outboxRelay{
+		repo:       repo,
+		listener:   listener,
+		tickerRepo: tickerRepo,
+		redis:      redisClient,
+		cfg:        cfg,
+	}
+}
+
+// Run relays events as soon as they are committed, and every pollInterval
+// in case a notification was missed, until ctx is done
+func (r *outboxRelay) Run(ctx context.Context) {
+	wake := make(chan struct{}, 1)
+	if r.listener != nil {
+		go r.listen(ctx, wake)
+	}
+
+	poll := time.NewTicker(r.cfg.pollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(outboxCleanupInterval)
+	defer cleanup.Stop()
+
+	logger.Log.Info("outbox relay started")
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			logger.Log.Info("outbox relay stopped")
+			return
+		case <-wake:
+		case <-poll.C:
+		case <-cleanup.C:
+			deleted, err := r.repo.DeletePublishedOutboxEvents(ctx, time.Now().Add(-r.cfg.retention))
+			if err != nil {
+				logger.Log.Error("failed to delete published outbox events", zap.Error(err))
+			} else if deleted > 0 {
+				logger.Log.Info("deleted published outbox events", zap.Int64("deleted", deleted))
+			}
+		}
+	}
+}
+
+// listen signals wake on every commit notification until ctx is done,
+// reconnecting after interruptions
+func (r *outboxRelay) listen(ctx context.Context, wake chan<- struct{}) {
+	for ctx.Err() == nil {
+		err := r.listener.Listen(ctx, database.OutboxChannel, func(string) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			logger.Log.Warn("outbox notifications interrupted", zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.cfg.pollInterval):
+			}
+		}
+	}
+}
+
+// drain relays batches until the outbox is empty or publishing fails
+func (r *outboxRelay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := r.repo.PublishOutboxEvents(ctx, r.cfg.batchSize, r.publish)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Error("outbox relay failed", zap.Error(err))
+			}
+			return
+		}
+		if n < r.cfg.batchSize {
+			return
+		}
+	}
+}
+
+// publish appends events to their streams. Reference data events also
+// rebuild the reference:tickers hash the normalize service reads.
+func (r *outboxRelay) publish(ctx context.Context, events []*database.OutboxEvent) error {
+	pipe := r.redis.Client().Pipeline()
+	reference := false
+	for _, event := range events {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: event.Stream,
+			MaxLen: outboxStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"outbox_id": event.ID,
+				"type":      event.Type,
+				"payload":   string(event.Payload),
+				"ts_ms":     event.CreatedAt.UnixMilli(),
+			},
+		})
+		if event.Stream == database.OutboxReferenceStream {
+			reference = true
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if reference {
+		return publishReferenceData(ctx, r.tickerRepo, r.redis)
+	}
+	return nil
+}
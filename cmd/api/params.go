@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+)
+
+// parseTimestampParam parses a query timestamp given either as milliseconds
+// since epoch (the unit quotes are stored in) or as an RFC3339 string.
+func parseTimestampParam(value string) (int64, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q: expected milliseconds since epoch or RFC3339", value)
+	}
+	return t.UnixMilli(), nil
+}
+
+// parseListOptions reads the sort, order, price_min, price_max, since, until
+// and limit query parameters shared by list endpoints. sortFields lists the
+// sort names the endpoint accepts.
+func parseListOptions(r *http.Request, sortFields ...string) (database.ListOptions, error) {
+	q := r.URL.Query()
+	var opts database.ListOptions
+
+	if sortBy := q.Get("sort"); sortBy != "" {
+		valid := false
+		for _, f := range sortFields {
+			if f == sortBy {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return opts, fmt.Errorf("invalid sort %q: must be one of %s", sortBy, strings.Join(sortFields, ", "))
+		}
+		opts.SortBy = sortBy
+		opts.SortDesc = true
+	}
+
+	switch order := strings.ToLower(q.Get("order")); order {
+	case "":
+	case "asc", "desc":
+		opts.SortDesc = order == "desc"
+		opts.OrderSet = true
+	default:
+		return opts, fmt.Errorf("invalid order %q: must be asc or desc", order)
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **float64
+	}{{"price_min", &opts.PriceMin}, {"price_max", &opts.PriceMax}} {
+		if v := q.Get(p.name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return opts, fmt.Errorf("invalid %s %q", p.name, v)
+			}
+			*p.dst = &f
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **int64
+	}{{"since", &opts.Since}, {"until", &opts.Until}} {
+		if v := q.Get(p.name); v != "" {
+			ts, err := parseTimestampParam(v)
+			if err != nil {
+				return opts, err
+			}
+			*p.dst = &ts
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 1000 {
+			return opts, fmt.Errorf("invalid limit %q: must be between 1 and 1000", v)
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// performanceWindows are the lookback periods reported by the performance endpoint
+var performanceWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// priceChange is the change of a ticker's price over one window. The base is
+// the last quote at or before the window start; without one the change fields
+// are null.
+type priceChange struct {
+	Window        string   `json:"window"`
+	BasePrice     *float64 `json:"base_price"`
+	BaseTimestamp *int64   `json:"base_timestamp"`
+	Change        *float64 `json:"change"`
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// quotePerformance is the /quotes/{ticker}/performance response body
+type quotePerformance struct {
+	Ticker    string         `json:"ticker"`
+	Price     float64        `json:"price"`
+	Timestamp int64          `json:"timestamp"`
+	Changes   []*priceChange `json:"changes"`
+}
+
+// Quote performance handler. Compares the latest stored quote with the price
+// at the start of each standard window.
+func getQuotePerformanceHandler(quoteRepo database.QuoteRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(mux.Vars(r)["ticker"])
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		latest, err := quoteRepo.GetQuoteAt(ctx, ticker, now.UnixMilli())
+		if err != nil {
+			if !errors.Is(err, database.ErrNotFound) {
+				logger.Log.Error("failed to get latest quote", zap.Error(err), zap.String("ticker", ticker))
+			}
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		perf := &quotePerformance{
+			Ticker:    ticker,
+			Price:     latest.Price,
+			Timestamp: latest.Timestamp,
+			Changes:   make([]*priceChange, 0, len(performanceWindows)),
+		}
+
+		for _, window := range performanceWindows {
+			change := &priceChange{Window: window.name}
+			perf.Changes = append(perf.Changes, change)
+
+			base, err := quoteRepo.GetQuoteAt(ctx, ticker, now.Add(-window.duration).UnixMilli())
+			if errors.Is(err, database.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				logger.Log.Error("failed to get base quote", zap.Error(err), zap.String("ticker", ticker), zap.String("window", window.name))
+				writeError(w, repositoryErrorStatus(err), "Failed to compute performance")
+				return
+			}
+
+			diff := latest.Price - base.Price
+			change.BasePrice = &base.Price
+			change.BaseTimestamp = &base.Timestamp
+			change.Change = &diff
+			if base.Price != 0 {
+				pct := math.Round(diff/base.Price*100*10000) / 10000
+				change.ChangePercent = &pct
+			}
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: perf})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// quotaKeyPrefix namespaces request counters in Redis
+const quotaKeyPrefix = "quota:"
+
+// quotaLimits caps the requests of a principal per UTC day and calendar
+// month. Zero means unlimited.
+type quotaLimits struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// quotaConfig resolves the limits of each principal
+type quotaConfig struct {
+	defaults  quotaLimits
+	overrides map[string]quotaLimits
+}
+
+// loadQuotaConfig reads quotas from the environment:
+//
+//	API_QUOTA_DAILY      default requests per principal per UTC day (unlimited)
+//	API_QUOTA_MONTHLY    default requests per principal per month (unlimited)
+//	API_QUOTA_OVERRIDES  per-principal "daily/monthly", e.g. "apikey:fl_1a2b3c4d=100000/2000000,42=0/0"
+//
+// Principals are user IDs, or apikey:<prefix> for API keys.
+func loadQuotaConfig() (*quotaConfig, error) {
+	cfg := &quotaConfig{overrides: make(map[string]quotaLimits)}
+
+	var err error
+	if cfg.defaults.Daily, err = parseQuota(os.Getenv("API_QUOTA_DAILY")); err != nil {
+		return nil, fmt.Errorf("invalid API_QUOTA_DAILY: %w", err)
+	}
+	if cfg.defaults.Monthly, err = parseQuota(os.Getenv("API_QUOTA_MONTHLY")); err != nil {
+		return nil, fmt.Errorf("invalid API_QUOTA_MONTHLY: %w", err)
+	}
+
+	for _, pair := range strings.Split(os.Getenv("API_QUOTA_OVERRIDES"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// Principals may contain ':' but never '='
+		principal, value, ok := strings.Cut(pair, "=")
+		daily, monthly, ok2 := strings.Cut(value, "/")
+		if !ok || !ok2 || principal == "" {
+			return nil, fmt.Errorf("invalid API_QUOTA_OVERRIDES entry %q", pair)
+		}
+		var limits quotaLimits
+		if limits.Daily, err = parseQuota(daily); err != nil {
+			return nil, fmt.Errorf("invalid API_QUOTA_OVERRIDES entry %q: %w", pair, err)
+		}
+		if limits.Monthly, err = parseQuota(monthly); err != nil {
+			return nil, fmt.Errorf("invalid API_QUOTA_OVERRIDES entry %q: %w", pair, err)
+		}
+		cfg.overrides[principal] = limits
+	}
+
+	return cfg, nil
+}
+
+// parseQuota parses a non-negative request count; empty means unlimited
+func parseQuota(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative integer", s)
+	}
+	return n, nil
+}
+
+// forPrincipal returns the limits of principal
+func (c *quotaConfig) forPrincipal(principal string) quotaLimits {
+	if limits, ok := c.overrides[principal]; ok {
+		return limits
+	}
+	return c.defaults
+}
+
+// quotaUsage is one period's consumption as reported by /usage
+type quotaUsage struct {
+	Used     int64     `json:"used"`
+	Limit    int64     `json:"limit,omitempty"`
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// usageReport is the response of /usage
+type usageReport struct {
+	Principal string     `json:"principal"`
+	Daily     quotaUsage `json:"daily"`
+	Monthly   quotaUsage `json:"monthly"`
+}
+
+// quotaPeriods returns the Redis keys counting principal's requests today
+// and this month, with the times those periods end. Both keys carry the
+// principal as hash tag, so they share a slot on a Redis Cluster.
+func quotaPeriods(principal string, now time.Time) (dayKey, monthKey string, dayEnd, monthEnd time.Time) {
+	now = now.UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	dayKey = quotaKeyPrefix + redisclient.HashTag(principal) + ":d:" + dayStart.Format("20060102")
+	monthKey = quotaKeyPrefix + redisclient.HashTag(principal) + ":m:" + monthStart.Format("200601")
+	return dayKey, monthKey, dayStart.AddDate(0, 0, 1), monthStart.AddDate(0, 1, 0)
+}
+
+// quotaMiddleware counts the requests of each authenticated principal and
+// rejects them with 429 once the daily or monthly quota is used up. It must
+// run after AuthMiddleware. Rejected requests count too, so hammering a
+// closed quota does not reopen it. When Redis is unavailable requests are
+// let through uncounted.
+func quotaMiddleware(redisClient *redisclient.Client, cfg *quotaConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := auth.FromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limits := cfg.forPrincipal(user.UserID)
+			now := time.Now()
+			dayKey, monthKey, dayEnd, monthEnd := quotaPeriods(user.UserID, now)
+
+			var day, month *redis.IntCmd
+			_, err := redisClient.Client().TxPipelined(r.Context(), func(pipe redis.Pipeliner) error {
+				day = pipe.Incr(r.Context(), dayKey)
+				pipe.ExpireAt(r.Context(), dayKey, dayEnd.Add(time.Hour))
+				month = pipe.Incr(r.Context(), monthKey)
+				pipe.ExpireAt(r.Context(), monthKey, monthEnd.Add(time.Hour))
+				return nil
+			})
+			if err != nil {
+				logger.Log.Warn("quota store unavailable", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if limits.Daily > 0 {
+				w.Header().Set("X-Quota-Limit-Day", strconv.FormatInt(limits.Daily, 10))
+				w.Header().Set("X-Quota-Remaining-Day", strconv.FormatInt(max(limits.Daily-day.Val(), 0), 10))
+			}
+			if limits.Monthly > 0 {
+				w.Header().Set("X-Quota-Limit-Month", strconv.FormatInt(limits.Monthly, 10))
+				w.Header().Set("X-Quota-Remaining-Month", strconv.FormatInt(max(limits.Monthly-month.Val(), 0), 10))
+			}
+
+			var period string
+			var resetsAt time.Time
+			switch {
+			case limits.Monthly > 0 && month.Val() > limits.Monthly:
+				period, resetsAt = "monthly", monthEnd
+			case limits.Daily > 0 && day.Val() > limits.Daily:
+				period, resetsAt = "daily", dayEnd
+			}
+			if period != "" {
+				metrics.APIQuotaRejections.WithLabelValues(period).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(resetsAt.Sub(now).Seconds())+1))
+				writeError(w, http.StatusTooManyRequests, fmt.Sprintf("%s request quota exceeded", period))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Usage handler. Reports the caller's consumption of its quotas.
+func usageHandler(redisClient *redisclient.Client, cfg *quotaConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		limits := cfg.forPrincipal(user.UserID)
+		dayKey, monthKey, dayEnd, monthEnd := quotaPeriods(user.UserID, time.Now())
+
+		counts, err := redisClient.Client().MGet(ctx, dayKey, monthKey).Result()
+		if err != nil {
+			logger.Log.Error("failed to get usage", zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, "Usage unavailable")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: usageReport{
+			Principal: user.UserID,
+			Daily:     quotaUsage{Used: redisCount(counts[0]), Limit: limits.Daily, ResetsAt: dayEnd},
+			Monthly:   quotaUsage{Used: redisCount(counts[1]), Limit: limits.Monthly, ResetsAt: monthEnd},
+		}})
+	}
+}
+
+// redisCount converts an MGET reply holding a counter; missing keys count zero
+func redisCount(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
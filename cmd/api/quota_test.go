@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadQuotaConfig_OverridesPerPrincipal(t *testing.T) {
+	t.Setenv("API_QUOTA_DAILY", "1000")
+	t.Setenv("API_QUOTA_MONTHLY", "")
+	t.Setenv("API_QUOTA_OVERRIDES", "apikey:fl_1a2b3c4d=100/2000, 42=0/0")
+
+	cfg, err := loadQuotaConfig()
+	if err != nil {
+		t.Fatalf("loadQuotaConfig: %v", err)
+	}
+	for principal, want := range map[string]quotaLimits{
+		"7":                  {Daily: 1000},
+		"apikey:fl_1a2b3c4d": {Daily: 100, Monthly: 2000},
+		"42":                 {},
+	} {
+		if got := cfg.forPrincipal(principal); got != want {
+			t.Errorf("forPrincipal(%q) = %+v; want %+v", principal, got, want)
+		}
+	}
+}
+
+func TestLoadQuotaConfig_RejectsMalformedOverride(t *testing.T) {
+	t.Setenv("API_QUOTA_OVERRIDES", "42=100")
+	if _, err := loadQuotaConfig(); err == nil {
+		t.Error("loadQuotaConfig accepted an override without a monthly quota")
+	}
+}
+
+func TestQuotaPeriods_ResetAtUTCBoundaries(t *testing.T) {
+	now := time.Date(2024, time.January, 31, 23, 30, 0, 0, time.UTC)
+	dayKey, monthKey, dayEnd, monthEnd := quotaPeriods("apikey:fl_1a2b3c4d", now)
+
+	if !strings.HasSuffix(dayKey, ":d:20240131") || !strings.HasSuffix(monthKey, ":m:202401") {
+		t.Errorf("keys = %q, %q", dayKey, monthKey)
+	}
+	// Both counters share the principal's hash tag
+	if tag := dayKey[:strings.Index(dayKey, "}")+1]; !strings.HasPrefix(monthKey, tag) {
+		t.Errorf("keys %q and %q do not share a hash tag", dayKey, monthKey)
+	}
+	want := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	if !dayEnd.Equal(want) || !monthEnd.Equal(want) {
+		t.Errorf("ends = %s, %s; want %s", dayEnd, monthEnd, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// rawEventStreamTimeout bounds a single NDJSON download
+	rawEventStreamTimeout = 5 * time.Minute
+	// defaultRawEventPage is the page size when no limit is given
+	defaultRawEventPage = 10000
+	// rawEventFlushEvery is how many lines are written between flushes
+	rawEventFlushEvery = 1000
+	// nextCursorTrailer carries the cursor for the following page
+	nextCursorTrailer = "X-Next-Cursor"
+)
+
+// rawEventLine is one NDJSON line; ID is the pagination cursor
+type rawEventLine struct {
+	ID int64 `json:"id"`
+	*models.RawTick
+}
+
+// Raw events handler (admin only). Streams events as NDJSON in id order
+// without loading the window into memory. Query parameters:
+//
+//	since, until   time bounds (ms or RFC3339); since defaults to 24h ago
+//	source, symbol exact-match filters
+//	cursor         resume after this id (the last id of the previous page)
+//	limit          page size (default 10000, max 100000)
+//
+// The cursor for the next page is sent in the X-Next-Cursor trailer and is
+// empty once the window is exhausted.
+func getRawEventsHandler(rawEventRepo database.RawEventRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseRawEventFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), rawEventStreamTimeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Trailer", nextCursorTrailer)
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		var lastID int64
+		count := 0
+
+		err = rawEventRepo.StreamRawEvents(ctx, filter, func(id int64, event *models.RawTick) error {
+			if err := enc.Encode(rawEventLine{ID: id, RawTick: event}); err != nil {
+				return err
+			}
+			lastID = id
+			count++
+			if flusher != nil && count%rawEventFlushEvery == 0 {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Log.Error("failed to stream raw events", zap.Error(err), zap.Int("written", count))
+			if count == 0 {
+				w.Header().Del("Trailer")
+				writeError(w, repositoryErrorStatus(err), "Failed to retrieve raw events")
+			}
+			// Headers are already sent; the client sees a truncated stream without a cursor
+			return
+		}
+
+		if count == filter.Limit {
+			w.Header().Set(nextCursorTrailer, strconv.FormatInt(lastID, 10))
+		} else {
+			w.Header().Set(nextCursorTrailer, "")
+		}
+	}
+}
+
+// parseRawEventFilter reads the raw event stream query parameters
+func parseRawEventFilter(r *http.Request) (database.RawEventFilter, error) {
+	q := r.URL.Query()
+	filter := database.RawEventFilter{
+		Source: q.Get("source"),
+		Symbol: q.Get("symbol"),
+		Since:  time.Now().Add(-24 * time.Hour),
+		Limit:  defaultRawEventPage,
+	}
+
+	if v := q.Get("since"); v != "" {
+		ms, err := parseTimestampParam(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Since = time.UnixMilli(ms)
+	}
+	if v := q.Get("until"); v != "" {
+		ms, err := parseTimestampParam(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Until = time.UnixMilli(ms)
+	}
+	if !filter.Until.IsZero() && filter.Until.Before(filter.Since) {
+		return filter, fmt.Errorf("until must not be before since")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return filter, fmt.Errorf("invalid cursor %q", v)
+		}
+		filter.AfterID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > database.MaxRawEventPage {
+			return filter, fmt.Errorf("invalid limit %q: must be between 1 and %d", v, database.MaxRawEventPage)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// referenceTickersKey is the Redis hash (symbol -> sector) read by the normalize service
+	referenceTickersKey = "reference:tickers"
+	// referencePublishedKey records that referenceTickersKey has been published,
+	// so the normalize service can tell no active tickers from none published yet
+	referencePublishedKey = "reference:tickers:published"
+	// referenceUpdatesChannel tells the normalize service to reload referenceTickersKey
+	referenceUpdatesChannel = "reference:updates"
+)
+
+// assignSectorRequest is the payload for moving a ticker to another sector
+type assignSectorRequest struct {
+	Sector string `json:"sector"`
+}
+
+// updateSectorRequest is the payload for changing a sector's description
+type updateSectorRequest struct {
+	Description string `json:"description"`
+}
+
+// List tickers handler (admin only)
+func listTickersHandler(tickerRepo database.TickerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		activeOnly := r.URL.Query().Get("active") == "true"
+		tickers, err := tickerRepo.GetTickers(ctx, activeOnly)
+		if err != nil {
+			logger.Log.Error("failed to get tickers", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: tickers})
+	}
+}
+
+// Get ticker handler (admin only)
+func getTickerHandler(tickerRepo database.TickerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := mux.Vars(r)["symbol"]
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		ticker, err := tickerRepo.GetTicker(ctx, symbol)
+		if err != nil {
+			logger.Log.Error("failed to get ticker", zap.Error(err), zap.String("symbol", symbol))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: ticker})
+	}
+}
+
+// Create ticker handler (admin only)
+func createTickerHandler(tickerRepo database.TickerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ticker models.Ticker
+		if err := json.NewDecoder(r.Body).Decode(&ticker); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		ticker.Sanitize()
+		if err := ticker.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := tickerRepo.CreateTicker(ctx, &ticker); err != nil {
+			logger.Log.Error("failed to create ticker", zap.Error(err), zap.String("symbol", ticker.Symbol))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: ticker})
+	}
+}
+
+// Assign sector handler (admin only)
+func assignSectorHandler(tickerRepo database.TickerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := mux.Vars(r)["symbol"]
+
+		var req assignSectorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Sector == "" {
+			writeError(w, http.StatusBadRequest, "Sector is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := tickerRepo.AssignSector(ctx, symbol, req.Sector); err != nil {
+			logger.Log.Error("failed to assign sector", zap.Error(err), zap.String("symbol", symbol))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// Deactivate ticker handler (admin only)
+func deactivateTickerHandler(tickerRepo database.TickerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := mux.Vars(r)["symbol"]
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := tickerRepo.DeactivateTicker(ctx, symbol); err != nil {
+			logger.Log.Error("failed to deactivate ticker", zap.Error(err), zap.String("symbol", symbol))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// List sectors handler (admin only)
+func listSectorsHandler(sectorRepo database.SectorRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		sectors, err := sectorRepo.GetSectors(ctx)
+		if err != nil {
+			logger.Log.Error("failed to get sectors", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: sectors})
+	}
+}
+
+// Create sector handler (admin only)
+func createSectorHandler(sectorRepo database.SectorRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sector models.Sector
+		if err := json.NewDecoder(r.Body).Decode(&sector); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		sector.Sanitize()
+		if err := sector.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := sectorRepo.CreateSector(ctx, &sector); err != nil {
+			logger.Log.Error("failed to create sector", zap.Error(err), zap.String("sector", sector.Name))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: sector})
+	}
+}
+
+// Get sector handler (admin only)
+func getSectorHandler(sectorRepo database.SectorRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		sector, err := sectorRepo.GetSector(ctx, name)
+		if err != nil {
+			logger.Log.Error("failed to get sector", zap.Error(err), zap.String("sector", name))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: sector})
+	}
+}
+
+// Update sector handler (admin only)
+func updateSectorHandler(sectorRepo database.SectorRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req updateSectorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		sector := models.Sector{Name: mux.Vars(r)["name"], Description: req.Description}
+		sector.Sanitize()
+		if err := sector.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := sectorRepo.UpdateSector(ctx, &sector); err != nil {
+			logger.Log.Error("failed to update sector", zap.Error(err), zap.String("sector", sector.Name))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: sector})
+	}
+}
+
+// Delete sector handler (admin only)
+func deleteSectorHandler(sectorRepo database.SectorRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := sectorRepo.DeleteSector(ctx, name); err != nil {
+			logger.Log.Error("failed to delete sector", zap.Error(err), zap.String("sector", name))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// publishReferenceData rebuilds the reference:tickers hash from the active
+// tickers in Postgres and notifies the normalize service to reload it. It
+// runs at startup and after the outbox relay publishes reference events.
+func publishReferenceData(ctx context.Context, tickerRepo database.TickerRepository, redisClient *redisclient.Client) error {
+	tickers, err := tickerRepo.GetTickers(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{}, len(tickers))
+	for _, ticker := range tickers {
+		values[ticker.Symbol] = ticker.Sector
+	}
+
+	pipe := redisClient.Client().TxPipeline()
+	pipe.Del(ctx, referenceTickersKey)
+	if len(values) > 0 {
+		pipe.HSet(ctx, referenceTickersKey, values)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// Set apart from the hash, which may live on another Cluster slot
+	if err := redisClient.Client().Set(ctx, referencePublishedKey, time.Now().Unix(), 0).Err(); err != nil {
+		return err
+	}
+	return redisClient.Client().Publish(ctx, referenceUpdatesChannel, len(values)).Err()
+}
+
+// maxSearchQueryLength bounds the ?q= of ticker search
+const maxSearchQueryLength = 50
+
+// Ticker search handler. Ranks exact and prefix matches on symbol, then name,
+// then fuzzy matches; intended for autocomplete.
+func searchTickersHandler(tickerRepo database.TickerRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			writeError(w, http.StatusBadRequest, "Query parameter q is required")
+			return
+		}
+		if len(q) > maxSearchQueryLength {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Query must be at most %d characters", maxSearchQueryLength))
+			return
+		}
+
+		limit := 10
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 50 {
+				writeError(w, http.StatusBadRequest, "limit must be between 1 and 50")
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		matches, err := tickerRepo.SearchTickers(ctx, q, limit)
+		if err != nil {
+			logger.Log.Error("failed to search tickers", zap.Error(err), zap.String("q", q))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: matches})
+	}
+}
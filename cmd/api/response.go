@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// writeJSON writes a JSON response with proper headers
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Log.Error("JSON encoding error", zap.Error(err))
+	}
+}
+
+// writeError writes an error response in the standard envelope
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, Response{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// repositoryErrorStatus maps repository sentinel errors to HTTP status codes
+func repositoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrInvalidRange):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded), database.IsStatementTimeout(err):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// setDeprecation marks a response as coming from a deprecated endpoint and
+// points clients at its successor
+func setDeprecation(w http.ResponseWriter, successor string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// marketStatsCacheKey prefixes the most recently computed market stats of each tenant
+	marketStatsCacheKey = "stats:market:"
+	// marketStatsTTL bounds how stale cached stats may be; the aggregate scans the quotes table
+	marketStatsTTL = 15 * time.Second
+)
+
+// Market stats handler. Stats are aggregated in Postgres and cached in Redis
+// for marketStatsTTL; the X-Cache header reports whether the cache was hit.
+func getStatsHandler(quoteRepo database.QuoteRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		cacheKey := marketStatsCacheKey + tenant.FromContext(ctx)
+		if stats, ok := cachedMarketStats(ctx, redisClient, cacheKey); ok {
+			w.Header().Set("X-Cache", "HIT")
+			writeJSON(w, http.StatusOK, Response{Success: true, Data: stats})
+			return
+		}
+
+		stats, err := quoteRepo.GetQuoteStats(ctx)
+		if err != nil {
+			logger.Log.Error("failed to get quote stats", zap.Error(err))
+			writeError(w, repositoryErrorStatus(err), "Failed to retrieve market stats")
+			return
+		}
+
+		if payload, err := json.Marshal(stats); err == nil {
+			if err := redisClient.Client().Set(ctx, cacheKey, payload, marketStatsTTL).Err(); err != nil {
+				logger.Log.Warn("failed to cache market stats", zap.Error(err))
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: stats})
+	}
+}
+
+// cachedMarketStats returns the cached stats, if present and readable
+func cachedMarketStats(ctx context.Context, redisClient *redisclient.Client, cacheKey string) (*database.QuoteStats, bool) {
+	payload, err := redisClient.Client().Get(ctx, cacheKey).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Log.Warn("failed to read cached market stats", zap.Error(err))
+		}
+		return nil, false
+	}
+
+	var stats database.QuoteStats
+	if err := json.Unmarshal(payload, &stats); err != nil {
+		logger.Log.Warn("discarding corrupt cached market stats", zap.Error(err))
+		return nil, false
+	}
+	return &stats, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/database/sqlite"
+	"github.com/alim08/fin_line/pkg/logger"
+)
+
+// store is the database the API runs on: Postgres, or SQLite for local
+// development and tests
+type store interface {
+	RunMigrations(ctx context.Context) error
+	HealthCheck(ctx context.Context) error
+	GetMigrationStatus(ctx context.Context) ([]database.MigrationStatus, error)
+	PoolStats() database.PoolStats
+	Close() error
+}
+
+// outboxListener wakes the outbox relay when events are committed. Only
+// Postgres has notifications; on SQLite the relay polls.
+type outboxListener interface {
+	Listen(ctx context.Context, channel string, fn func(payload string)) error
+}
+
+// repositories are the store's repositories
+type repositories struct {
+	quotes         database.QuoteRepository
+	anomalies      database.AnomalyRepository
+	rawEvents      database.RawEventRepository
+	tickers        database.TickerRepository
+	sectors        database.SectorRepository
+	detectorConfig database.DetectorConfigRepository
+	webhooks       database.WebhookRepository
+	watchlists     database.WatchlistRepository
+	manualAnomaly  database.ManualAnomalyRepository
+	users          database.UserRepository
+	apiKeys        database.APIKeyRepository
+	authAudit      database.AuthAuditRepository
+	outbox         database.OutboxRepository
+}
+
+// openStore opens the database selected by the environment and applies
+// pending migrations:
+//
+//	DB_DRIVER        postgres (default) or sqlite
+//	DB_SQLITE_PATH   SQLite database file, or ":memory:" (fin_line.db)
+//	DB_AUTO_MIGRATE  false leaves the schema to the migrate command (true)
+//	ARCHIVE_DIR      archival service output; quote history before the
+//	                 archive watermark is read from it too (Postgres only)
+func openStore(ctx context.Context) (store, *repositories, error) {
+	var (
+		st    store
+		repos *repositories
+	)
+
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "postgres":
+		dbConfig := database.NewConfig()
+		if err := database.WaitForReady(context.Background(), dbConfig); err != nil {
+			return nil, nil, err
+		}
+		db, err := database.New(dbConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		quotes := database.NewQuoteRepository(db)
+		if dir := os.Getenv("ARCHIVE_DIR"); dir != "" {
+			quotes = database.NewArchivedQuoteRepository(quotes, database.NewRetentionRepository(db), database.NewQuoteArchive(dir))
+		}
+		st = db
+		repos = &repositories{
+			quotes:         quotes,
+			anomalies:      database.NewAnomalyRepository(db),
+			rawEvents:      database.NewRawEventRepository(db),
+			tickers:        database.NewTickerRepository(db),
+			sectors:        database.NewSectorRepository(db),
+			detectorConfig: database.NewDetectorConfigRepository(db),
+			webhooks:       database.NewWebhookRepository(db),
+			watchlists:     database.NewWatchlistRepository(db),
+			manualAnomaly:  database.NewManualAnomalyRepository(db),
+			users:          database.NewUserRepository(db),
+			apiKeys:        database.NewAPIKeyRepository(db),
+			authAudit:      database.NewAuthAuditRepository(db),
+			outbox:         database.NewOutboxRepository(db),
+		}
+	case "sqlite":
+		path := os.Getenv("DB_SQLITE_PATH")
+		if path == "" {
+			path = "fin_line.db"
+		}
+		db, err := sqlite.Open(path, os.Getenv("DB_SECRET_KEY"))
+		if err != nil {
+			return nil, nil, err
+		}
+		st = db
+		repos = &repositories{
+			quotes:         sqlite.NewQuoteRepository(db),
+			anomalies:      sqlite.NewAnomalyRepository(db),
+			rawEvents:      sqlite.NewRawEventRepository(db),
+			tickers:        sqlite.NewTickerRepository(db),
+			sectors:        sqlite.NewSectorRepository(db),
+			detectorConfig: sqlite.NewDetectorConfigRepository(db),
+			webhooks:       sqlite.NewWebhookRepository(db),
+			watchlists:     sqlite.NewWatchlistRepository(db),
+			manualAnomaly:  sqlite.NewManualAnomalyRepository(db),
+			users:          sqlite.NewUserRepository(db),
+			apiKeys:        sqlite.NewAPIKeyRepository(db),
+			authAudit:      sqlite.NewAuthAuditRepository(db),
+			outbox:         sqlite.NewOutboxRepository(db),
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid DB_DRIVER: %q", driver)
+	}
+
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		if err := st.RunMigrations(ctx); err != nil {
+			st.Close()
+			return nil, nil, fmt.Errorf("failed to run database migrations: %w", err)
+		}
+		logger.Log.Info("database migrations completed")
+	}
+
+	return st, repos, nil
+}
+
+// storeDriver names the database behind st in health reports
+func storeDriver(st store) string {
+	if _, ok := st.(*sqlite.DB); ok {
+		return "sqlite"
+	}
+	return "postgres"
+}
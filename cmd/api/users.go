@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/alim08/fin_line/pkg/validation"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// createUserRequest is the payload of POST /admin/users
+type createUserRequest struct {
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+// userRolesRequest is the payload of PUT /admin/users/{id}/roles
+type userRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// passwordRequest is the payload of POST /admin/users/{id}/password
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// userErrorStatus maps user repository errors to HTTP statuses
+func userErrorStatus(err error) int {
+	if errors.Is(err, database.ErrUnknownRole) {
+		return http.StatusBadRequest
+	}
+	return repositoryErrorStatus(err)
+}
+
+// List users handler (admin only)
+func listUsersHandler(userRepo database.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		users, err := userRepo.ListUsers(ctx)
+		if err != nil {
+			logger.Log.Error("failed to list users", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: users})
+	}
+}
+
+// authorizeRoles checks that caller may hand out roles: everything the roles
+// grant must be held by caller, so admin:users never escalates to more
+func authorizeRoles(authService *auth.AuthService, caller *auth.Claims, roles []string) error {
+	return caller.CanGrant(authService.RolePermissions(roles)...)
+}
+
+// Create user handler (admin only). The user belongs to the request's tenant
+// and may only be given roles within the caller's own permissions.
+func createUserHandler(userRepo database.UserRepository, authService *auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req createUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if err := auth.ValidatePassword(req.Password); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user := models.User{
+			Username: req.Username,
+			Email:    req.Email,
+			Roles:    req.Roles,
+			TenantID: tenant.FromContext(r.Context()),
+			Active:   true,
+		}
+
+		user.Sanitize()
+		if err := user.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := authorizeRoles(authService, caller, user.Roles); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		passwordHash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			logger.Log.Error("failed to hash password", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		user.PasswordHash = passwordHash
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := userRepo.CreateUser(ctx, &user); err != nil {
+			logger.Log.Error("failed to create user", zap.Error(err))
+			writeError(w, userErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: user})
+	}
+}
+
+// Get user handler (admin only)
+func getUserHandler(userRepo database.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		user, err := userRepo.GetUser(ctx, id)
+		if err != nil {
+			logger.Log.Error("failed to get user", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: user})
+	}
+}
+
+// Enable/disable user handler (admin only). Disabling ends the user's
+// sessions; access tokens already issued stay valid until they expire.
+func setUserActiveHandler(userRepo database.UserRepository, active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		user, err := userRepo.SetUserActive(ctx, id, active)
+		if err != nil {
+			logger.Log.Error("failed to set user active", zap.Error(err), zap.Int64("id", id), zap.Bool("active", active))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: user})
+	}
+}
+
+// Assign roles handler (admin only). Replaces the user's roles. Callers
+// cannot change their own roles or grant roles beyond their permissions.
+func setUserRolesHandler(userRepo database.UserRepository, authService *auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+		if caller.UserID == strconv.FormatInt(id, 10) {
+			writeError(w, http.StatusForbidden, "Cannot change your own roles")
+			return
+		}
+
+		var req userRolesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Roles == nil {
+			writeError(w, http.StatusBadRequest, "roles is required")
+			return
+		}
+
+		// Unknown roles are rejected by the repository
+		for i, role := range req.Roles {
+			req.Roles[i] = strings.ToLower(validation.SanitizeString(role))
+		}
+		if err := authorizeRoles(authService, caller, req.Roles); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		user, err := userRepo.SetUserRoles(ctx, id, req.Roles)
+		if err != nil {
+			logger.Log.Error("failed to set user roles", zap.Error(err), zap.Int64("id", id))
+			writeError(w, userErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: user})
+	}
+}
+
+// Reset password handler (admin only). Ends the user's sessions.
+func resetPasswordHandler(userRepo database.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+
+		var req passwordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if err := auth.ValidatePassword(req.Password); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		passwordHash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			logger.Log.Error("failed to hash password", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := userRepo.SetUserPassword(ctx, id, passwordHash); err != nil {
+			logger.Log.Error("failed to reset password", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// List sessions handler (admin only)
+func listSessionsHandler(userRepo database.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		// Resolve the user first so other tenants' users are reported as missing
+		if _, err := userRepo.GetUser(ctx, id); err != nil {
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		sessions, err := userRepo.ListSessions(ctx, id)
+		if err != nil {
+			logger.Log.Error("failed to list sessions", zap.Error(err), zap.Int64("id", id))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: sessions})
+	}
+}
+
+// List roles handler (admin only)
+func listRolesHandler(userRepo database.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		roles, err := userRepo.ListRoles(ctx)
+		if err != nil {
+			logger.Log.Error("failed to list roles", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: roles})
+	}
+}
+
+// Create role handler (admin only). What the role grants comes from the auth policy.
+func createRoleHandler(userRepo database.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var role models.Role
+		if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		role.Sanitize()
+		if err := role.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := userRepo.CreateRole(ctx, &role); err != nil {
+			logger.Log.Error("failed to create role", zap.Error(err))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: role})
+	}
+}
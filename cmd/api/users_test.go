@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// fakeUserRepo records user writes; methods the handlers under test do not
+// call panic through the nil embedded interface
+type fakeUserRepo struct {
+	database.UserRepository
+	created  []*models.User
+	setRoles map[int64][]string
+}
+
+func (f *fakeUserRepo) CreateUser(ctx context.Context, user *models.User) error {
+	user.ID = int64(len(f.created) + 1)
+	f.created = append(f.created, user)
+	return nil
+}
+
+func (f *fakeUserRepo) SetUserRoles(ctx context.Context, id int64, roles []string) (*models.User, error) {
+	if f.setRoles == nil {
+		f.setRoles = make(map[int64][]string)
+	}
+	f.setRoles[id] = roles
+	return &models.User{ID: id, Username: "someone", Roles: roles}, nil
+}
+
+// newTestAuthService returns an HS256 auth service whose policy has an
+// all-powerful admin role, a user manager role and an analyst role
+func newTestAuthService(t *testing.T) *auth.AuthService {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"default": ["quotes:read"], "roles": {"admin": ["*"], "useradmin": ["admin:users"], "analyst": ["anomalies:*"]}}`
+	if err := os.WriteFile(policyPath, []byte(policy), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	authService, err := auth.NewAuthService(&auth.Config{
+		SigningMethod: "HS256",
+		Secret:        strings.Repeat("s", 32),
+		Issuer:        "fin-line",
+		Audience:      "fin-line-api",
+		PolicyPath:    policyPath,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	return authService
+}
+
+// userManager is a caller holding admin:users and the analyst permissions
+func userManager(r *http.Request) *http.Request {
+	return asUser(r, "7", auth.PermQuotesRead, auth.PermAdminUsers, "anomalies:*")
+}
+
+func TestCreateUser_RejectsRolesBeyondCaller(t *testing.T) {
+	authService := newTestAuthService(t)
+	repo := &fakeUserRepo{}
+
+	body := `{"username":"mallory","password":"correct horse battery","roles":["admin"]}`
+	w := httptest.NewRecorder()
+	createUserHandler(repo, authService)(w, userManager(httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusForbidden, w.Body)
+	}
+	if len(repo.created) != 0 {
+		t.Errorf("created %d users; want none", len(repo.created))
+	}
+}
+
+func TestCreateUser_AllowsRolesWithinCaller(t *testing.T) {
+	authService := newTestAuthService(t)
+	repo := &fakeUserRepo{}
+
+	body := `{"username":"alice","password":"correct horse battery","roles":["analyst"]}`
+	w := httptest.NewRecorder()
+	createUserHandler(repo, authService)(w, userManager(httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusCreated, w.Body)
+	}
+	if len(repo.created) != 1 {
+		t.Fatalf("created %d users; want 1", len(repo.created))
+	}
+}
+
+func TestSetUserRoles_RejectsOwnRoles(t *testing.T) {
+	authService := newTestAuthService(t)
+	repo := &fakeUserRepo{}
+
+	r := userManager(httptest.NewRequest(http.MethodPut, "/users/7/roles", strings.NewReader(`{"roles":["analyst"]}`)))
+	r = mux.SetURLVars(r, map[string]string{"id": "7"})
+	w := httptest.NewRecorder()
+	setUserRolesHandler(repo, authService)(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusForbidden, w.Body)
+	}
+	if len(repo.setRoles) != 0 {
+		t.Errorf("set roles %v; want none", repo.setRoles)
+	}
+}
+
+func TestSetUserRoles_RejectsRolesBeyondCaller(t *testing.T) {
+	authService := newTestAuthService(t)
+	repo := &fakeUserRepo{}
+
+	r := userManager(httptest.NewRequest(http.MethodPut, "/users/8/roles", strings.NewReader(`{"roles":["analyst","admin"]}`)))
+	r = mux.SetURLVars(r, map[string]string{"id": "8"})
+	w := httptest.NewRecorder()
+	setUserRolesHandler(repo, authService)(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusForbidden, w.Body)
+	}
+	if len(repo.setRoles) != 0 {
+		t.Errorf("set roles %v; want none", repo.setRoles)
+	}
+}
+
+func TestSetUserRoles_AllowsRolesWithinCaller(t *testing.T) {
+	authService := newTestAuthService(t)
+	repo := &fakeUserRepo{}
+
+	r := userManager(httptest.NewRequest(http.MethodPut, "/users/8/roles", strings.NewReader(`{"roles":["analyst","useradmin"]}`)))
+	r = mux.SetURLVars(r, map[string]string{"id": "8"})
+	w := httptest.NewRecorder()
+	setUserRolesHandler(repo, authService)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	if got := repo.setRoles[8]; len(got) != 2 {
+		t.Errorf("roles = %v; want [analyst useradmin]", got)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// v1Successors maps the templates of the v1 quote routes v2 replaces to the
+// v2 route serving the same quotes, filled with the v1 route's variables
+var v1Successors = map[string]string{
+	"/api/v1/quotes/latest":          "/api/v2/quotes/latest",
+	"/api/v1/quotes/{ticker}":        "/api/v2/quotes?ticker={ticker}",
+	"/api/v1/quotes/sector/{sector}": "/api/v2/quotes?sector={sector}",
+}
+
+// deprecationMiddleware marks the responses of the v1 routes in v1Successors
+// as deprecated, linking the v2 route replacing them
+func deprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				if successor, ok := v1Successors[template]; ok {
+					for name, value := range mux.Vars(r) {
+						successor = strings.ReplaceAll(successor, "{"+name+"}", url.QueryEscape(value))
+					}
+					setDeprecation(w, successor)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// List quotes handler (v2). Served from Postgres with ?ticker=, ?sector= and
+// the shared sort/range/limit parameters, replacing the v1 stream scan.
+func listQuotesV2Handler(quoteRepo database.QuoteRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		opts, err := parseListOptions(r, "price", "timestamp")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		perPage := opts.Limit
+		if perPage == 0 {
+			perPage = 100
+		}
+		// One row past the page tells whether another follows; counting
+		// every match would bring back the scan v2 replaces
+		opts.Peek = true
+		filter := database.QuoteFilter{
+			Ticker:      strings.ToUpper(r.URL.Query().Get("ticker")),
+			Sector:      r.URL.Query().Get("sector"),
+			ListOptions: opts,
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		quotes, err := quoteRepo.ListQuotes(ctx, filter)
+		if err != nil {
+			logger.Log.Error("failed to list quotes", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		hasMore := len(quotes) > perPage
+		if hasMore {
+			quotes = quotes[:perPage]
+		}
+
+		data, err := sparseList(quotes, parseFieldsParam(r))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{
+			Success: true,
+			Data:    data,
+			Meta: &Meta{
+				PerPage:  perPage,
+				HasMore:  hasMore,
+				Duration: time.Since(start).Milliseconds(),
+			},
+		})
+	}
+}
+
+// Latest quotes handler (v2). Reads the quotes:latest hashes of every
+// reference ticker in one pipeline, falling back to the latest_quotes view
+// when the cache is empty.
+func latestQuotesV2Handler(quoteRepo database.QuoteRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		quotes, err := cachedLatestQuotes(ctx, redisClient)
+		if err != nil {
+			logger.Log.Warn("failed to read latest quotes from cache", zap.Error(err))
+		}
+
+		if len(quotes) == 0 {
+			quotes, err = quoteRepo.ListQuotes(ctx, database.QuoteFilter{
+				Latest:      true,
+				ListOptions: database.ListOptions{SortBy: "ticker", Limit: 1000},
+			})
+			if err != nil {
+				logger.Log.Error("failed to get latest quotes", zap.Error(err))
+				writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+
+		writeList(w, r, quotes)
+	}
+}
+
+// Quote by ticker handler (v2). Returns the cached latest quote, falling back
+// to the most recent row in Postgres.
+func quoteByTickerV2Handler(quoteRepo database.QuoteRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(mux.Vars(r)["ticker"])
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		quote, err := cachedLatestQuote(ctx, redisClient, ticker)
+		if err != nil && err != redis.Nil {
+			logger.Log.Warn("failed to read latest quote from cache", zap.Error(err), zap.String("ticker", ticker))
+		}
+
+		if quote == nil {
+			quotes, err := quoteRepo.GetQuotesByTicker(ctx, ticker, 1)
+			if err != nil {
+				logger.Log.Error("failed to get quote by ticker", zap.Error(err), zap.String("ticker", ticker))
+				writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if len(quotes) == 0 {
+				writeError(w, http.StatusNotFound, "No quote found for ticker: "+ticker)
+				return
+			}
+			quote = quotes[0]
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: quote})
+	}
+}
+
+// maxSparklinePoints caps the points of a sparkline
+const maxSparklinePoints = 1000
+
+// Quote sparkline handler (v2). Returns the price of ticker over the last
+// ?window= (default 24h) in ?points= buckets (default 100), each the last
+// price of its bucket, timestamped at the bucket's start. Served from the
+// RedisTimeSeries series cachepub keeps when REDIS_TIMESERIES is on, falling
+// back to the closes of candles of the same buckets from Postgres.
+func quoteSparklineV2Handler(quoteRepo database.QuoteRepository, redisClient *redisclient.Client, tsCfg redisclient.TimeSeriesConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(mux.Vars(r)["ticker"])
+		q := r.URL.Query()
+
+		window := 24 * time.Hour
+		if v := q.Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "window must be a positive duration")
+				return
+			}
+			window = d
+		}
+		points := 100
+		if v := q.Get("points"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 4 || n > maxSparklinePoints {
+				writeError(w, http.StatusBadRequest, "points must be an integer between 4 and "+strconv.Itoa(maxSparklinePoints))
+				return
+			}
+			points = n
+		}
+
+		end := time.Now().UnixMilli()
+		start := end - window.Milliseconds()
+		// Whole milliseconds, so both sources bucket alike
+		resolution := (window / time.Duration(points)).Truncate(time.Millisecond)
+		if resolution < time.Millisecond {
+			resolution = time.Millisecond
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if tsCfg.Enabled {
+			samples, err := redisClient.QuoteSeries(ctx, ticker, start, end, resolution, tsCfg)
+			if err != nil {
+				logger.Log.Warn("failed to read quote series", zap.Error(err), zap.String("ticker", ticker))
+			}
+			if len(samples) > 0 {
+				quotes := make([]*models.NormalizedTick, len(samples))
+				for i, sample := range samples {
+					quotes[i] = &models.NormalizedTick{Ticker: ticker, Price: sample.Value, Timestamp: sample.Timestamp}
+				}
+				writeList(w, r, quotes)
+				return
+			}
+		}
+
+		candles, err := quoteRepo.GetCandles(ctx, ticker, start, end, resolution)
+		if err != nil {
+			logger.Log.Error("failed to get quote sparkline", zap.Error(err), zap.String("ticker", ticker))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+		quotes := make([]*models.NormalizedTick, len(candles))
+		for i, candle := range candles {
+			quotes[i] = &models.NormalizedTick{Ticker: ticker, Price: candle.Close, Timestamp: candle.Start}
+		}
+		writeList(w, r, quotes)
+	}
+}
+
+// cachedLatestQuotes reads quotes:latest:<symbol> for every symbol in the
+// reference:tickers hash. Tickers without a cached quote are skipped.
+func cachedLatestQuotes(ctx context.Context, redisClient *redisclient.Client) ([]*models.NormalizedTick, error) {
+	sectors, err := redisClient.Client().HGetAll(ctx, referenceTickersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(sectors) == 0 {
+		return nil, nil
+	}
+
+	symbols := make([]string, 0, len(sectors))
+	for symbol := range sectors {
+		symbols = append(symbols, symbol)
+	}
+	hashes, err := redisClient.LatestQuoteHashes(ctx, symbols...)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make([]*models.NormalizedTick, 0, len(hashes))
+	for symbol, hash := range hashes {
+		if quote, ok := parseLatestQuote(symbol, sectors[symbol], hash); ok {
+			quotes = append(quotes, quote)
+		}
+	}
+	// Match the alphabetical ordering of the latest_quotes view
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Ticker < quotes[j].Ticker })
+	return quotes, nil
+}
+
+// cachedLatestQuotesFor reads quotes:latest:<ticker> for each of tickers,
+// in the given order. Tickers without a cached quote are skipped.
+func cachedLatestQuotesFor(ctx context.Context, redisClient *redisclient.Client, tickers []string) ([]*models.NormalizedTick, error) {
+	if len(tickers) == 0 {
+		return nil, nil
+	}
+
+	sectors, err := redisClient.Client().HMGet(ctx, referenceTickersKey, tickers...).Result()
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := redisClient.LatestQuoteHashes(ctx, tickers...)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make([]*models.NormalizedTick, 0, len(tickers))
+	for i, ticker := range tickers {
+		var sector string
+		if i < len(sectors) {
+			sector, _ = sectors[i].(string)
+		}
+		if quote, ok := parseLatestQuote(ticker, sector, hashes[ticker]); ok {
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes, nil
+}
+
+// cachedLatestQuote reads quotes:latest:<ticker>; a nil quote means no cache entry.
+func cachedLatestQuote(ctx context.Context, redisClient *redisclient.Client, ticker string) (*models.NormalizedTick, error) {
+	fields, err := redisClient.LatestQuoteHash(ctx, ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	sector, err := redisClient.Client().HGet(ctx, referenceTickersKey, ticker).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if quote, ok := parseLatestQuote(ticker, sector, fields); ok {
+		return quote, nil
+	}
+	return nil, nil
+}
+
+// parseLatestQuote decodes a quotes:latest hash
+func parseLatestQuote(ticker, sector string, fields map[string]string) (*models.NormalizedTick, bool) {
+	price, err := strconv.ParseFloat(fields["price"], 64)
+	if err != nil {
+		return nil, false
+	}
+	ts, err := strconv.ParseInt(fields["ts_ms"], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &models.NormalizedTick{Ticker: ticker, Price: price, Timestamp: ts, Sector: sector}, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// fakeQuoteRepo lists its quotes up to the filter's limit; methods the
+// handlers under test do not call panic through the nil embedded interface
+type fakeQuoteRepo struct {
+	database.QuoteRepository
+	quotes []*models.NormalizedTick
+}
+
+func (f *fakeQuoteRepo) ListQuotes(ctx context.Context, filter database.QuoteFilter) ([]*models.NormalizedTick, error) {
+	limit := filter.Limit
+	if filter.Peek {
+		limit++
+	}
+	if limit > len(f.quotes) {
+		limit = len(f.quotes)
+	}
+	return f.quotes[:limit], nil
+}
+
+// listQuotesV2 calls listQuotesV2Handler and decodes its quotes and meta
+func listQuotesV2(t *testing.T, repo *fakeQuoteRepo, target string) ([]json.RawMessage, map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	listQuotesV2Handler(repo)(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+
+	var resp struct {
+		Data []json.RawMessage      `json:"data"`
+		Meta map[string]interface{} `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp.Data, resp.Meta
+}
+
+func TestListQuotesV2_HasMoreOnlyWithAnotherPage(t *testing.T) {
+	logger.Log = zap.NewNop()
+	repo := &fakeQuoteRepo{quotes: []*models.NormalizedTick{
+		{Ticker: "AAPL", Price: 1, Timestamp: 3},
+		{Ticker: "AAPL", Price: 2, Timestamp: 2},
+		{Ticker: "AAPL", Price: 3, Timestamp: 1},
+	}}
+
+	data, meta := listQuotesV2(t, repo, "/api/v2/quotes?limit=2")
+	if len(data) != 2 || meta["has_more"] != true {
+		t.Errorf("limit 2 = %d quotes, has_more %v; want 2 and true", len(data), meta["has_more"])
+	}
+
+	data, meta = listQuotesV2(t, repo, "/api/v2/quotes?limit=3")
+	if len(data) != 3 || meta["has_more"] != false {
+		t.Errorf("limit 3 = %d quotes, has_more %v; want 3 and false", len(data), meta["has_more"])
+	}
+	if _, ok := meta["total"]; ok {
+		t.Errorf("meta = %v; want no total", meta)
+	}
+}
+
+func TestDeprecationMiddleware_LinksV2Successor(t *testing.T) {
+	router := mux.NewRouter()
+	v1 := router.PathPrefix("/api/v1").Subrouter()
+	v1.Use(deprecationMiddleware)
+	noContent := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	v1.HandleFunc("/quotes/latest", noContent)
+	v1.HandleFunc("/quotes/{ticker}", noContent)
+	v1.HandleFunc("/quotes/{ticker}/history", noContent)
+
+	for target, want := range map[string]string{
+		"/api/v1/quotes/latest":       `</api/v2/quotes/latest>; rel="successor-version"`,
+		"/api/v1/quotes/AAPL":         `</api/v2/quotes?ticker=AAPL>; rel="successor-version"`,
+		"/api/v1/quotes/AAPL/history": "",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if got := w.Header().Get("Link"); got != want {
+			t.Errorf("%s Link = %q; want %q", target, got, want)
+		}
+		if deprecated := w.Header().Get("Deprecation") == "true"; deprecated != (want != "") {
+			t.Errorf("%s Deprecation = %q", target, w.Header().Get("Deprecation"))
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// quotesPubSubChannel carries every normalized tick published by cachepub
+	quotesPubSubChannel = "quotes:pubsub"
+	// watchlistHeartbeat keeps idle watchlist streams open through proxies
+	watchlistHeartbeat = 15 * time.Second
+)
+
+// watchlistRequest is the payload for creating or updating a watchlist
+type watchlistRequest struct {
+	Name    string   `json:"name"`
+	Tickers []string `json:"tickers"`
+}
+
+// List watchlists handler
+func listWatchlistsHandler(watchlistRepo database.WatchlistRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		watchlists, err := watchlistRepo.GetWatchlistsByOwner(ctx, user.UserID)
+		if err != nil {
+			logger.Log.Error("failed to get watchlists", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: watchlists})
+	}
+}
+
+// Create watchlist handler
+func createWatchlistHandler(watchlistRepo database.WatchlistRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req watchlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		watchlist := models.Watchlist{
+			OwnerID: user.UserID,
+			Name:    req.Name,
+			Tickers: req.Tickers,
+		}
+
+		watchlist.Sanitize()
+		if err := watchlist.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := watchlistRepo.CreateWatchlist(ctx, &watchlist); err != nil {
+			logger.Log.Error("failed to create watchlist", zap.Error(err))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: watchlist})
+	}
+}
+
+// Get watchlist handler
+func getWatchlistHandler(watchlistRepo database.WatchlistRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		watchlist, ok := loadWatchlist(w, r, watchlistRepo)
+		if !ok {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: watchlist})
+	}
+}
+
+// Update watchlist handler. Omitted fields keep their current values.
+func updateWatchlistHandler(watchlistRepo database.WatchlistRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req watchlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		watchlist, ok := loadWatchlist(w, r, watchlistRepo)
+		if !ok {
+			return
+		}
+
+		if req.Name != "" {
+			watchlist.Name = req.Name
+		}
+		if req.Tickers != nil {
+			watchlist.Tickers = req.Tickers
+		}
+
+		watchlist.Sanitize()
+		if err := watchlist.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := watchlistRepo.UpdateWatchlist(ctx, watchlist); err != nil {
+			logger.Log.Error("failed to update watchlist", zap.Error(err), zap.Int64("id", watchlist.ID))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: watchlist})
+	}
+}
+
+// Delete watchlist handler
+func deleteWatchlistHandler(watchlistRepo database.WatchlistRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid watchlist id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := watchlistRepo.DeleteWatchlist(ctx, user.UserID, id); err != nil {
+			logger.Log.Error("failed to delete watchlist", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
+
+// Watchlist quotes handler. Returns the latest quote of each ticker on the
+// list, from the quotes:latest cache with a Postgres fallback. Tickers
+// without any quote are omitted.
+func getWatchlistQuotesHandler(watchlistRepo database.WatchlistRepository, quoteRepo database.QuoteRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		watchlist, ok := loadWatchlist(w, r, watchlistRepo)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		cached, err := cachedLatestQuotesFor(ctx, redisClient, watchlist.Tickers)
+		if err != nil {
+			logger.Log.Warn("failed to read latest quotes from cache", zap.Error(err))
+		}
+		byTicker := make(map[string]*models.NormalizedTick, len(cached))
+		for _, quote := range cached {
+			byTicker[quote.Ticker] = quote
+		}
+
+		quotes := make([]*models.NormalizedTick, 0, len(watchlist.Tickers))
+		for _, ticker := range watchlist.Tickers {
+			if quote, ok := byTicker[ticker]; ok {
+				quotes = append(quotes, quote)
+				continue
+			}
+			rows, err := quoteRepo.GetQuotesByTicker(ctx, ticker, 1)
+			if err != nil {
+				logger.Log.Error("failed to get quote by ticker", zap.Error(err), zap.String("ticker", ticker))
+				writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if len(rows) > 0 {
+				quotes = append(quotes, rows[0])
+			}
+		}
+
+		writeList(w, r, quotes)
+	}
+}
+
+// Watchlist stream handler. Pushes quotes for the list's tickers as
+// Server-Sent Events ("event: quote"). The ticker set is read once when the
+// stream opens; clients reconnect to pick up watchlist edits.
+func streamWatchlistHandler(watchlistRepo database.WatchlistRepository, redisClient *redisclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		watchlist, ok := loadWatchlist(w, r, watchlistRepo)
+		if !ok {
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "Streaming unsupported")
+			return
+		}
+
+		ctx := r.Context()
+		sub, err := redisClient.SubscribeManaged(ctx, quotesPubSubChannel)
+		if err != nil {
+			logger.Log.Error("failed to subscribe to quotes", zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, "Quote stream unavailable")
+			return
+		}
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(watchlistHeartbeat)
+		defer heartbeat.Stop()
+
+		seqs := redisclient.NewSequenceTracker(quotesPubSubChannel)
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if msg.Gap {
+					// Quotes were missed; clients refetch the latest ones
+					seqs.Reset()
+					fmt.Fprint(w, "event: gap\ndata: {}\n\n")
+					flusher.Flush()
+					continue
+				}
+				var tick models.NormalizedTick
+				if err := json.Unmarshal([]byte(msg.Payload), &tick); err != nil {
+					continue
+				}
+				if !watchlist.Contains(tick.Ticker) {
+					continue
+				}
+				missed := seqs.Observe(tick.Ticker, redisclient.QuoteSeq(msg.Payload))
+				if missed < 0 {
+					continue
+				}
+				if missed > 0 {
+					// Quotes of this ticker were missed; clients refetch its history
+					fmt.Fprintf(w, "event: gap\ndata: {\"ticker\":%q,\"missed\":%d}\n\n", tick.Ticker, missed)
+				}
+				fmt.Fprintf(w, "event: quote\ndata: %s\n\n", msg.Payload)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// loadWatchlist resolves the {id} watchlist of the authenticated user,
+// writing the error response and returning false if it cannot.
+func loadWatchlist(w http.ResponseWriter, r *http.Request, watchlistRepo database.WatchlistRepository) (*models.Watchlist, bool) {
+	user, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid watchlist id")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	watchlist, err := watchlistRepo.GetWatchlist(ctx, user.UserID, id)
+	if err != nil {
+		if repositoryErrorStatus(err) == http.StatusInternalServerError {
+			logger.Log.Error("failed to get watchlist", zap.Error(err), zap.Int64("id", id))
+		}
+		writeError(w, repositoryErrorStatus(err), err.Error())
+		return nil, false
+	}
+	return watchlist, true
+}
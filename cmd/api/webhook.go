@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/auth"
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// webhookRequest is the payload for creating or updating a webhook
+type webhookRequest struct {
+	URL        string   `json:"url"`
+	Tickers    []string `json:"tickers"`
+	Severities []string `json:"severities"`
+	Active     *bool    `json:"active"`
+}
+
+// List webhooks handler
+func listWebhooksHandler(webhookRepo database.WebhookRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		webhooks, err := webhookRepo.GetWebhooksByOwner(ctx, user.UserID)
+		if err != nil {
+			logger.Log.Error("failed to get webhooks", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		for _, webhook := range webhooks {
+			webhook.Secret = ""
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: webhooks})
+	}
+}
+
+// Create webhook handler. The signing secret is only returned in this response.
+func createWebhookHandler(webhookRepo database.WebhookRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		secret, err := models.NewWebhookSecret()
+		if err != nil {
+			logger.Log.Error("failed to generate webhook secret", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		webhook := models.Webhook{
+			OwnerID:    user.UserID,
+			URL:        req.URL,
+			Secret:     secret,
+			Tickers:    req.Tickers,
+			Severities: req.Severities,
+			Active:     req.Active == nil || *req.Active,
+		}
+
+		webhook.Sanitize()
+		if err := webhook.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := webhookRepo.CreateWebhook(ctx, &webhook); err != nil {
+			logger.Log.Error("failed to create webhook", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Success: true, Data: webhook})
+	}
+}
+
+// Get webhook handler
+func getWebhookHandler(webhookRepo database.WebhookRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid webhook id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		webhook, err := webhookRepo.GetWebhook(ctx, user.UserID, id)
+		if err != nil {
+			logger.Log.Error("failed to get webhook", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		webhook.Secret = ""
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: webhook})
+	}
+}
+
+// Update webhook handler. Omitted fields keep their current values.
+func updateWebhookHandler(webhookRepo database.WebhookRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid webhook id")
+			return
+		}
+
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		webhook, err := webhookRepo.GetWebhook(ctx, user.UserID, id)
+		if err != nil {
+			logger.Log.Error("failed to get webhook", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		if req.URL != "" {
+			webhook.URL = req.URL
+		}
+		if req.Tickers != nil {
+			webhook.Tickers = req.Tickers
+		}
+		if req.Severities != nil {
+			webhook.Severities = req.Severities
+		}
+		if req.Active != nil {
+			webhook.Active = *req.Active
+		}
+
+		webhook.Sanitize()
+		if err := webhook.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := webhookRepo.UpdateWebhook(ctx, webhook); err != nil {
+			logger.Log.Error("failed to update webhook", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		webhook.Secret = ""
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: webhook})
+	}
+}
+
+// Delete webhook handler
+func deleteWebhookHandler(webhookRepo database.WebhookRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid webhook id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := webhookRepo.DeleteWebhook(ctx, user.UserID, id); err != nil {
+			logger.Log.Error("failed to delete webhook", zap.Error(err), zap.Int64("id", id))
+			writeError(w, repositoryErrorStatus(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Success: true})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// anomalyStream is the stream the anomaly service adds each detected
+// anomaly to, besides the anomaly's per-ticker sorted set. Its entries are
+// archived as the anomalies dataset, under the id their sorted set member
+// is archived under, so an anomaly is stored once whichever is archived
+// first.
+var anomalyStream = archivedStream{
+	stream:  "anomalies:stream",
+	dataset: database.ArchiveDatasetAnomalies,
+	record:  detectedAnomalyRecord,
+}
+
+// anomalyID returns the id an anomaly of ticker at timestamp, in
+// milliseconds, is archived under when it has none of its own
+func anomalyID(ticker string, timestamp int64) string {
+	return fmt.Sprintf("%s_%d", ticker, timestamp)
+}
+
+// detectedAnomalyRecord converts an anomalies:stream entry to an archived
+// record identified by its ticker and timestamp
+func detectedAnomalyRecord(msg redis.XMessage) (*database.ArchivedRecord, error) {
+	record, err := streamRecord(msg)
+	if err != nil {
+		return nil, err
+	}
+	if record.Ticker != "" {
+		record.ID = anomalyID(record.Ticker, record.Timestamp)
+	}
+	return record, nil
+}
+
+// anomalySetKeys returns the per-ticker anomaly sorted sets
+func anomalySetKeys(ctx context.Context, rdb *redisclient.Client) ([]string, error) {
+	var keys []string
+	err := rdb.ScanKeys(ctx, redisclient.AnomalyKeyPrefix+"*", func(key string) error {
+		if key != anomalyStream.stream {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomaly sets: %w", err)
+	}
+
+	// Other keys may share the prefix; only sorted sets are archived
+	sets := keys[:0]
+	for _, key := range keys {
+		kind, err := rdb.Client().Type(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the type of %s: %w", key, err)
+		}
+		if kind == "zset" {
+			sets = append(sets, key)
+		}
+	}
+	return sets, nil
+}
+
+// archiveAnomalySets archives the members of the per-ticker anomaly sorted
+// sets scored before cutoff, in pages: each page is written to the sinks
+// and only then removed from its set. Members that cannot be decoded are
+// removed without being archived. Once stop is closed the run ends after
+// the page in progress. It returns the payload bytes archived.
+func archiveAnomalySets(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	keys, err := anomalySetKeys(ctx, rdb)
+	if err != nil {
+		return 0, err
+	}
+
+	var archived int
+	var bytes, remaining int64
+	for _, key := range keys {
+		ticker := strings.TrimPrefix(key, redisclient.AnomalyKeyPrefix)
+		for !stopping(stop) {
+			members, err := anomalySetPage(ctx, rdb, key, cutoff)
+			if err != nil {
+				return bytes, err
+			}
+			if len(members) == 0 {
+				break
+			}
+
+			records := anomalySetRecords(ticker, members)
+			if err := sinks.Write(ctx, database.ArchiveDatasetAnomalies, records); err != nil {
+				return bytes, fmt.Errorf("failed to archive %s: %w", key, err)
+			}
+			removed := make([]interface{}, len(members))
+			for i, member := range members {
+				removed[i] = member
+			}
+			if err := rdb.Client().ZRem(ctx, key, removed...).Err(); err != nil {
+				return bytes, fmt.Errorf("failed to delete archived anomalies from %s: %w", key, err)
+			}
+
+			archived += len(records)
+			bytes += recordsBytes(records)
+			if len(members) < archivePageSize {
+				break
+			}
+		}
+		if n, err := rdb.Client().ZCard(ctx, key).Result(); err == nil {
+			remaining += n
+		}
+	}
+
+	if archived > 0 {
+		logger.Log.Info("archived anomaly sets", zap.Int("sets", len(keys)), zap.Int("anomalies", archived))
+	}
+	metrics.ArchivalBacklog.WithLabelValues(redisclient.AnomalyKeyPrefix + "*").Set(float64(remaining))
+	return bytes, nil
+}
+
+// anomalySetPage returns the first members of the sorted set key scored
+// before cutoff
+func anomalySetPage(ctx context.Context, rdb *redisclient.Client, key string, cutoff time.Time) ([]string, error) {
+	members, err := rdb.Client().ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(cutoff.UnixMilli(), 10),
+		Count: archivePageSize,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return members, nil
+}
+
+// anomalySetRecords converts the members of ticker's anomaly sorted set to
+// archived records, skipping those that cannot be decoded
+func anomalySetRecords(ticker string, members []string) []*database.ArchivedRecord {
+	records := make([]*database.ArchivedRecord, 0, len(members))
+	for _, member := range members {
+		a, err := redisclient.DecodeAnomaly(ticker, member)
+		if err != nil {
+			logger.Log.Warn("skipping unarchivable anomaly", zap.String("ticker", ticker), zap.Error(err))
+			continue
+		}
+		records = append(records, &database.ArchivedRecord{
+			ID:        anomalyID(a.Ticker, a.Timestamp),
+			Ticker:    a.Ticker,
+			Timestamp: a.Timestamp,
+			Payload:   json.RawMessage(member),
+		})
+	}
+	return records
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"go.uber.org/zap"
+)
+
+// streamDeadline is the age past which entries left in a stream mean
+// archival has fallen behind: a full schedule past their cutoff
+type streamDeadline struct {
+	stream string
+	maxAge time.Duration
+}
+
+// backpressureMonitor raises the pipeline's backpressure signal while
+// archival is behind and Redis memory is above high, and clears it once
+// archival catches up or memory falls below low
+type backpressureMonitor struct {
+	rdb       *redisclient.Client
+	deadlines []streamDeadline
+	high, low float64
+	interval  time.Duration
+
+	signal redisclient.Backpressure
+}
+
+// newBackpressureMonitor creates a monitor for the streams archived on the
+// dataset schedules, checking every ARCHIVE_BACKPRESSURE_INTERVAL whether
+// memory is above ARCHIVE_BACKPRESSURE_HIGH or below ARCHIVE_BACKPRESSURE_LOW,
+// as fractions of maxmemory. It returns nil when ARCHIVE_BACKPRESSURE_HIGH
+// is 0.
+func newBackpressureMonitor(rdb *redisclient.Client, interval time.Duration) (*backpressureMonitor, error) {
+	high, err := strconv.ParseFloat(getEnvOrDefault("ARCHIVE_BACKPRESSURE_HIGH", "0.85"), 64)
+	if err != nil || high < 0 || high > 1 {
+		return nil, fmt.Errorf("invalid ARCHIVE_BACKPRESSURE_HIGH: must be a fraction of maxmemory")
+	}
+	if high == 0 {
+		return nil, nil
+	}
+	low, err := strconv.ParseFloat(getEnvOrDefault("ARCHIVE_BACKPRESSURE_LOW", "0.75"), 64)
+	if err != nil || low < 0 || low > high {
+		return nil, fmt.Errorf("invalid ARCHIVE_BACKPRESSURE_LOW: must be a fraction of maxmemory below ARCHIVE_BACKPRESSURE_HIGH")
+	}
+	every, err := envDuration("ARCHIVE_BACKPRESSURE_INTERVAL", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if every <= 0 {
+		return nil, fmt.Errorf("ARCHIVE_BACKPRESSURE_INTERVAL must be positive")
+	}
+
+	m := &backpressureMonitor{rdb: rdb, high: high, low: low, interval: every}
+	for _, dataset := range archiveDatasets {
+		schedule, err := newDatasetSchedule(dataset, interval)
+		if err != nil {
+			return nil, err
+		}
+		if schedule.After == 0 {
+			continue
+		}
+		maxAge := schedule.After + schedule.Every
+		if s, ok := archivedStreams[dataset]; ok {
+			m.deadlines = append(m.deadlines, streamDeadline{stream: s.stream, maxAge: maxAge})
+		}
+		if dataset == database.ArchiveDatasetAnomalies {
+			m.deadlines = append(m.deadlines, streamDeadline{stream: anomalyStream.stream, maxAge: maxAge})
+		}
+	}
+	return m, nil
+}
+
+// run checks every interval until ctx is done or stop is closed. A signal
+// left on is not cleared, so a new leader takes it over; it expires
+// unless renewed.
+func (m *backpressureMonitor) run(ctx context.Context, stop <-chan struct{}) {
+	// Carry on from the signal a previous leader left
+	if signal, err := m.rdb.GetBackpressure(ctx); err == nil {
+		m.signal = signal
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.check(ctx); err != nil && ctx.Err() == nil {
+			logger.Log.Warn("backpressure check failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check updates the signal from the memory of Redis and the oldest entries
+// of the archived streams, renewing it while it stays on
+func (m *backpressureMonitor) check(ctx context.Context) error {
+	used, max, err := m.rdb.MemoryUsage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read Redis memory: %w", err)
+	}
+	// Without maxmemory there is no limit to approach
+	ratio := 0.0
+	if max > 0 {
+		ratio = float64(used) / float64(max)
+	}
+	behind, err := m.behind(ctx)
+	if err != nil {
+		return err
+	}
+
+	signal := m.signal
+	signal.MemoryRatio = ratio
+	switch {
+	case !signal.Active && behind != "" && ratio >= m.high:
+		signal = redisclient.Backpressure{
+			Active:      true,
+			Reason:      fmt.Sprintf("%s, Redis memory at %.0f%% of maxmemory", behind, 100*ratio),
+			MemoryRatio: ratio,
+			Since:       time.Now().UnixMilli(),
+		}
+		logger.Log.Warn("archival behind with Redis memory high, raising backpressure", zap.String("reason", signal.Reason))
+	case signal.Active && (behind == "" || ratio < m.low):
+		signal = redisclient.Backpressure{MemoryRatio: ratio}
+		logger.Log.Info("clearing backpressure", zap.Float64("memory_ratio", ratio), zap.Bool("archival_behind", behind != ""))
+	case !signal.Active:
+		// Nothing to publish or renew
+		m.signal = signal
+		return nil
+	}
+
+	if err := m.rdb.SetBackpressure(ctx, signal, 3*m.interval); err != nil {
+		return fmt.Errorf("failed to publish backpressure: %w", err)
+	}
+	m.signal = signal
+	if signal.Active {
+		metrics.PipelineBackpressure.Set(1)
+	} else {
+		metrics.PipelineBackpressure.Set(0)
+	}
+	return nil
+}
+
+// behind describes the first stream holding entries past its deadline, or
+// returns "" if archival is keeping up
+func (m *backpressureMonitor) behind(ctx context.Context) (string, error) {
+	for _, d := range m.deadlines {
+		msgs, err := m.rdb.Client().XRangeN(ctx, d.stream, "-", "+", 1).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", d.stream, err)
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		if age := time.Since(time.UnixMilli(streamIDMillis(msgs[0].ID))); age > d.maxAge {
+			return fmt.Sprintf("%s holds entries %s old, archived after %s", d.stream, age.Round(time.Minute), d.maxAge), nil
+		}
+	}
+	return "", nil
+}
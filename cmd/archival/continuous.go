@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// archivalGroup is the consumer group continuous archival reads with
+	archivalGroup = "archival"
+	// archivalConsumer is its consumer; only the leader reads, so a new
+	// leader picks up the entries the previous one left unacknowledged
+	archivalConsumer = "archiver"
+	// flushRetryDelay is the wait before retrying a failed read or flush
+	flushRetryDelay = 5 * time.Second
+)
+
+// continuousArchiver tails a stream through a consumer group and writes
+// its entries to the sinks every flushEvery or flushRecords entries,
+// whichever comes first. After each flush the entries are acknowledged,
+// recorded as the stream's checkpoint and, once older than after, trimmed,
+// so the stream holds little more than the entries younger than after.
+type continuousArchiver struct {
+	rdb          *redisclient.Client
+	sinks        archiveSinks
+	stream       archivedStream
+	after        time.Duration
+	flushEvery   time.Duration
+	flushRecords int
+
+	ids     []string
+	records []*database.ArchivedRecord
+	readAt  time.Time
+}
+
+// continuousConfig reads ARCHIVE_FLUSH_INTERVAL and ARCHIVE_FLUSH_RECORDS,
+// the bounds on how long and how many entries continuous archival buffers
+func continuousConfig() (time.Duration, int, error) {
+	every, err := envDuration("ARCHIVE_FLUSH_INTERVAL", 10*time.Second)
+	if err != nil {
+		return 0, 0, err
+	}
+	if every <= 0 {
+		return 0, 0, fmt.Errorf("ARCHIVE_FLUSH_INTERVAL must be positive")
+	}
+	records, err := strconv.Atoi(getEnvOrDefault("ARCHIVE_FLUSH_RECORDS", "1000"))
+	if err != nil || records <= 0 {
+		return 0, 0, fmt.Errorf("invalid ARCHIVE_FLUSH_RECORDS: must be a positive integer")
+	}
+	return every, records, nil
+}
+
+// runContinuous runs archivers until ctx is done or stop is closed
+func runContinuous(ctx context.Context, archivers []*continuousArchiver, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, a := range archivers {
+		wg.Add(1)
+		go func(a *continuousArchiver) {
+			defer wg.Done()
+			a.run(ctx, stop)
+		}(a)
+	}
+	wg.Wait()
+}
+
+// run archives the stream until ctx is done or stop is closed, flushing
+// the entries it holds in the latter case. It first reads the entries
+// delivered to the group but never acknowledged, then new ones.
+func (a *continuousArchiver) run(ctx context.Context, stop <-chan struct{}) {
+	logger.Log.Info("archiving stream continuously", zap.String("stream", a.stream.stream),
+		zap.Duration("flush_every", a.flushEvery), zap.Int("flush_records", a.flushRecords))
+
+	for ctx.Err() == nil && !stopping(stop) {
+		if err := a.createGroup(ctx); err == nil {
+			break
+		} else if ctx.Err() == nil {
+			logger.Log.Error("failed to create archival consumer group", zap.String("stream", a.stream.stream), zap.Error(err))
+			pause(ctx, stop, flushRetryDelay)
+		}
+	}
+
+	readID := "0"
+	for ctx.Err() == nil {
+		if stopping(stop) {
+			a.drain(ctx)
+			return
+		}
+
+		if len(a.ids) < a.flushRecords {
+			msgs, err := a.read(ctx, readID)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Log.Warn("failed to read stream for archival", zap.String("stream", a.stream.stream), zap.Error(err))
+					pause(ctx, stop, flushRetryDelay)
+				}
+				continue
+			}
+			if readID != ">" {
+				// Unacknowledged entries are read in order until none are left
+				if len(msgs) == 0 {
+					readID = ">"
+				} else {
+					readID = msgs[len(msgs)-1].ID
+				}
+			}
+			a.add(msgs)
+		}
+
+		if len(a.ids) > 0 && (len(a.ids) >= a.flushRecords || time.Since(a.readAt) >= a.flushEvery) {
+			if err := a.flush(ctx); err != nil {
+				logger.Log.Error("continuous archival failed", zap.String("stream", a.stream.stream), zap.Error(err))
+				metrics.ArchivalErrorCounter.Inc()
+				pause(ctx, stop, flushRetryDelay)
+			}
+		}
+	}
+}
+
+// drain flushes the buffered entries on shutdown, retrying until ctx is
+// done. Entries it could not flush stay pending in the group and are
+// archived by the next leader.
+func (a *continuousArchiver) drain(ctx context.Context) {
+	for len(a.ids) > 0 && ctx.Err() == nil {
+		err := a.flush(ctx)
+		if err == nil {
+			logger.Log.Info("flushed archived entries on shutdown", zap.String("stream", a.stream.stream))
+			return
+		}
+		logger.Log.Error("continuous archival failed", zap.String("stream", a.stream.stream), zap.Error(err))
+		metrics.ArchivalErrorCounter.Inc()
+		pause(ctx, nil, flushRetryDelay)
+	}
+}
+
+// createGroup creates the archival group of the stream, starting after its
+// checkpoint so entries the batch runs archived are not read again
+func (a *continuousArchiver) createGroup(ctx context.Context) error {
+	start := "0"
+	checkpoint, err := a.rdb.Client().HGet(ctx, checkpointsKey, a.stream.stream).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to read %s checkpoint: %w", a.stream.stream, err)
+	}
+	if checkpoint != "" {
+		start = checkpoint
+	}
+	err = a.rdb.Client().XGroupCreateMkStream(ctx, a.stream.stream, archivalGroup, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// read reads entries after id, waiting for new ones until the buffered
+// entries are due to be flushed
+func (a *continuousArchiver) read(ctx context.Context, id string) ([]redis.XMessage, error) {
+	block := a.flushEvery
+	if len(a.ids) > 0 {
+		block = time.Until(a.readAt.Add(a.flushEvery))
+	}
+	if id != ">" || block < time.Millisecond {
+		// Reading pending entries or already due: do not wait
+		block = -1
+	}
+
+	streams, err := a.rdb.Client().XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    archivalGroup,
+		Consumer: archivalConsumer,
+		Streams:  []string{a.stream.stream, id},
+		Count:    int64(a.flushRecords - len(a.ids)),
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams[0].Messages, nil
+}
+
+// add buffers msgs. Entries trimmed while pending come back without fields
+// and are only acknowledged.
+func (a *continuousArchiver) add(msgs []redis.XMessage) {
+	for _, msg := range msgs {
+		if len(a.ids) == 0 {
+			a.readAt = time.Now()
+		}
+		a.ids = append(a.ids, msg.ID)
+		if len(msg.Values) == 0 {
+			continue
+		}
+		record, err := a.stream.toRecord(msg)
+		if err != nil {
+			logger.Log.Warn("skipping unarchivable entry", zap.String("stream", a.stream.stream), zap.String("id", msg.ID), zap.Error(err))
+			continue
+		}
+		a.records = append(a.records, record)
+	}
+}
+
+// flush writes the buffered entries to the sinks, records the last as the
+// checkpoint, acknowledges them and trims the archived entries older than
+// after. Entries written but not acknowledged are read and written again.
+func (a *continuousArchiver) flush(ctx context.Context) error {
+	s := a.stream
+	if err := a.sinks.Write(ctx, s.dataset, a.records); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", s.stream, err)
+	}
+
+	last := a.ids[len(a.ids)-1]
+	if err := a.rdb.FencedHSet(ctx, checkpointsKey, s.stream, last); err != nil {
+		return fmt.Errorf("failed to record %s checkpoint: %w", s.stream, err)
+	}
+	if err := a.rdb.Client().XAck(ctx, s.stream, archivalGroup, a.ids...).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge archived %s entries: %w", s.stream, err)
+	}
+	trimArchived(ctx, a.rdb, s.stream, trimBound(last, time.Now().Add(-a.after)))
+
+	metrics.ArchivalStreamLag.WithLabelValues(s.stream).Set(time.Since(time.UnixMilli(streamIDMillis(a.ids[0]))).Seconds())
+	metrics.ArchivalLastSuccess.WithLabelValues(s.dataset).SetToCurrentTime()
+	if length, err := a.rdb.Client().XLen(ctx, s.stream).Result(); err == nil {
+		metrics.ArchivalBacklog.WithLabelValues(s.stream).Set(float64(length))
+	}
+	logger.Log.Debug("flushed archived entries", zap.String("stream", s.stream), zap.Int("entries", len(a.ids)), zap.String("checkpoint", last))
+
+	a.ids, a.records = nil, nil
+	return nil
+}
+
+// trimBound returns the XTRIM MINID keeping the entries after the
+// checkpoint or added since cutoff
+func trimBound(checkpoint string, cutoff time.Time) string {
+	if streamIDMillis(checkpoint) < cutoff.UnixMilli() {
+		return redisclient.NextStreamID(checkpoint)
+	}
+	return strconv.FormatInt(cutoff.UnixMilli(), 10) + "-0"
+}
+
+// streamIDMillis returns the millisecond part of a stream ID
+func streamIDMillis(id string) int64 {
+	ms, _, _ := strings.Cut(id, "-")
+	n, _ := strconv.ParseInt(ms, 10, 64)
+	return n
+}
+
+// pause waits for d, or until ctx is done or stop is closed
+func pause(ctx context.Context, stop <-chan struct{}, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-stop:
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrimBound(t *testing.T) {
+	cutoff := time.UnixMilli(5000)
+
+	if got := trimBound("2000-3", cutoff); got != "2000-4" {
+		t.Errorf("trimBound before cutoff = %q; want %q", got, "2000-4")
+	}
+	if got := trimBound("7000-0", cutoff); got != "5000-0" {
+		t.Errorf("trimBound after cutoff = %q; want %q", got, "5000-0")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+)
+
+// archivalPreview sums up the entries a run would archive
+type archivalPreview struct {
+	entries         int
+	bytes           int64
+	minTs, maxTs    int64
+	firstID, lastID string
+}
+
+// add counts record in the preview
+func (p *archivalPreview) add(record *database.ArchivedRecord) {
+	if p.entries == 0 || record.Timestamp < p.minTs {
+		p.minTs = record.Timestamp
+	}
+	if p.entries == 0 || record.Timestamp > p.maxTs {
+		p.maxTs = record.Timestamp
+	}
+	if p.entries == 0 {
+		p.firstID = record.ID
+	}
+	p.lastID = record.ID
+	p.entries++
+	p.bytes += int64(len(record.Payload))
+}
+
+// dryRun runs archival with --dry-run: it reports, for each dataset, what
+// a run would archive now under the configured schedules, reading Redis
+// without changing it, and returns the exit code
+func dryRun(args []string) int {
+	fs := flag.NewFlagSet("dry-run", flag.ExitOnError)
+	dataset := fs.String("dataset", "", "dataset to report on (default all)")
+	redisURL := fs.String("redis", os.Getenv("REDIS_URL"), "Redis connection URL")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: archival --dry-run [flags]
+
+Reports what an archival run would move out of Redis now, given the
+ARCHIVE_<DATASET>_AFTER ages: how many entries of each dataset, their ids
+and time span, and the size of their payloads. Redis is only read.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	datasets := archiveDatasets
+	if *dataset != "" {
+		datasets = []string{*dataset}
+	}
+	names, err := sinkNames()
+	if fs.NArg() != 0 || !contains(archiveDatasets, datasets[0]) || *redisURL == "" || err != nil {
+		fs.Usage()
+		return 2
+	}
+	interval, err := envDuration("ARCHIVAL_INTERVAL", time.Hour)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dry run:", err)
+		return 2
+	}
+
+	if err := logger.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, "logger init error:", err)
+		return 1
+	}
+	defer logger.Log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rdb := redisclient.New(*redisURL)
+	defer rdb.Close()
+
+	now := time.Now()
+	for _, dataset := range datasets {
+		schedule, err := newDatasetSchedule(dataset, interval)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dry run:", err)
+			return 2
+		}
+		if schedule.After == 0 {
+			fmt.Printf("%s: kept in Redis\n", dataset)
+			continue
+		}
+		cutoff := now.Add(-schedule.After)
+
+		var preview archivalPreview
+		var removal string
+		if s, ok := archivedStreams[dataset]; ok {
+			preview, err = previewStream(ctx, rdb, s, cutoff)
+			removal = fmt.Sprintf("trimmed from %s with XTRIM MINID %s", s.stream, redisclient.NextStreamID(preview.lastID))
+		} else {
+			preview, err = previewAnomalies(ctx, rdb, cutoff)
+			removal = "removed from the anomalies list, the anomalies:stream stream and the anomalies:<ticker> sets"
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dry run:", err)
+			return 1
+		}
+
+		fmt.Printf("%s: entries older than %s (before %s), archived every %s\n",
+			dataset, schedule.After, cutoff.UTC().Format(time.RFC3339), schedule.Every)
+		if preview.entries == 0 {
+			fmt.Println("  nothing to archive")
+			continue
+		}
+		fmt.Printf("  would archive %d entries, %s to %s (ids %s to %s), about %s\n",
+			preview.entries, formatMillis(preview.minTs), formatMillis(preview.maxTs), preview.firstID, preview.lastID, formatBytes(preview.bytes))
+		fmt.Printf("  written to %s, then %s\n", strings.Join(names, ", "), removal)
+	}
+	return 0
+}
+
+// previewStream sums up the entries of s archiveStream would archive
+func previewStream(ctx context.Context, rdb *redisclient.Client, s archivedStream, cutoff time.Time) (archivalPreview, error) {
+	var preview archivalPreview
+	stream := s.stream
+	start, end, err := streamArchiveRange(ctx, rdb, stream, cutoff)
+	if err != nil {
+		return preview, err
+	}
+	for {
+		msgs, err := rdb.Client().XRangeN(ctx, stream, start, end, archivePageSize).Result()
+		if err != nil {
+			return preview, fmt.Errorf("failed to read %s: %w", stream, err)
+		}
+		for _, msg := range msgs {
+			if record, err := s.toRecord(msg); err == nil {
+				preview.add(record)
+			}
+		}
+		if len(msgs) == 0 {
+			return preview, nil
+		}
+		// The last entry read, archivable or not, bounds the trim
+		preview.lastID = msgs[len(msgs)-1].ID
+		if len(msgs) < archivePageSize {
+			return preview, nil
+		}
+		start = "(" + preview.lastID
+	}
+}
+
+// previewAnomalies sums up the anomalies archiveOldAnomalies would archive
+// from the anomalies list, the anomalies stream and the anomaly sets
+func previewAnomalies(ctx context.Context, rdb *redisclient.Client, cutoff time.Time) (archivalPreview, error) {
+	anomalies, err := rdb.Client().LRange(ctx, "anomalies", 0, -1).Result()
+	if err != nil && err != redis.Nil {
+		return archivalPreview{}, err
+	}
+	records, _ := oldAnomalies(anomalies, cutoff)
+
+	// The stream's entries are counted with their last id bounding the trim
+	preview, err := previewStream(ctx, rdb, anomalyStream, cutoff)
+	if err != nil {
+		return preview, err
+	}
+
+	keys, err := anomalySetKeys(ctx, rdb)
+	if err != nil {
+		return preview, err
+	}
+	for _, key := range keys {
+		members, err := rdb.Client().ZRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: "(" + strconv.FormatInt(cutoff.UnixMilli(), 10),
+		}).Result()
+		if err != nil {
+			return preview, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		records = append(records, anomalySetRecords(strings.TrimPrefix(key, redisclient.AnomalyKeyPrefix), members)...)
+	}
+
+	for _, record := range records {
+		preview.add(record)
+	}
+	return preview, nil
+}
+
+// formatMillis formats a time in milliseconds since the epoch as RFC3339
+func formatMillis(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
+
+// formatBytes formats n bytes with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sealedObjectMagic starts every archive file encrypted by encryptedStore
+var sealedObjectMagic = []byte("FLENC1")
+
+// errArchiveKeyMissing is returned when reading an encrypted archive file
+// without an archive key configured
+var errArchiveKeyMissing = errors.New("archive file is encrypted but no archive key is configured")
+
+// encryptedStore encrypts archive files with AES-256-GCM before storing
+// them in store and decrypts them when read back. Files stored before a key
+// was configured are read as they are.
+type encryptedStore struct {
+	objectStore
+	aead cipher.AEAD
+}
+
+// newEncryptedStore wraps store to encrypt its files with the
+// base64-encoded 32-byte key in ARCHIVE_ENCRYPTION_KEY, or in the file
+// named by ARCHIVE_ENCRYPTION_KEY_FILE (e.g. a mounted secret). With
+// neither set files are stored unencrypted, and reading an encrypted one
+// fails with errArchiveKeyMissing.
+func newEncryptedStore(store objectStore) (objectStore, error) {
+	key := getEnvOrDefault("ARCHIVE_ENCRYPTION_KEY", "")
+	if path := getEnvOrDefault("ARCHIVE_ENCRYPTION_KEY_FILE", ""); key == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive key file: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		return &encryptedStore{objectStore: store}, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive key: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("invalid archive key: got %d bytes, want 32", len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive key: %w", err)
+	}
+	return &encryptedStore{objectStore: store, aead: aead}, nil
+}
+
+// Put implements objectStore. The key is authenticated with the file, so
+// a file copied to another key fails to decrypt.
+func (s *encryptedStore) Put(ctx context.Context, key string, body []byte) error {
+	if s.aead == nil {
+		return s.objectStore.Put(ctx, key, body)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	sealed := append(append([]byte{}, sealedObjectMagic...), nonce...)
+	sealed = s.aead.Seal(sealed, nonce, body, []byte(key))
+	return s.objectStore.Put(ctx, key, sealed)
+}
+
+// Get implements objectStore
+func (s *encryptedStore) Get(ctx context.Context, key string) ([]byte, error) {
+	body, err := s.objectStore.Get(ctx, key)
+	if err != nil || !bytes.HasPrefix(body, sealedObjectMagic) {
+		return body, err
+	}
+	if s.aead == nil {
+		return nil, errArchiveKeyMissing
+	}
+
+	sealed := body[len(sealedObjectMagic):]
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("failed to decrypt %s: malformed file", key)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	return plain, nil
+}
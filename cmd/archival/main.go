@@ -1,20 +1,46 @@
+// Command archival moves aged entries out of Redis into the archive sinks
+// and exports and prunes Postgres tables past retention.
+//
+//	archival                   run the archival service
+//	archival restore [flags]   write archived records back to Redis or the quotes table
+//	archival verify [flags]    check archived batches against their manifests
+//	archival --dry-run [flags] report what a run would archive, changing nothing
 package main
 
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/alim08/fin_line/pkg/config"
+	"github.com/alim08/fin_line/pkg/database"
 	"github.com/alim08/fin_line/pkg/logger"
 	"github.com/alim08/fin_line/pkg/metrics"
 	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			os.Exit(restore(os.Args[2:]))
+		case "verify":
+			os.Exit(verify(os.Args[2:]))
+		case "-dry-run", "--dry-run":
+			os.Exit(dryRun(os.Args[2:]))
+		}
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -31,6 +57,60 @@ func main() {
 	rdb := redisclient.New(cfg.RedisURL)
 	defer rdb.Close()
 
+	names, err := sinkNames()
+	if err != nil {
+		logger.Log.Fatal("invalid archive sinks", zap.Error(err))
+	}
+
+	// Connect to Postgres when any table has a retention policy, Redis
+	// entries are archived to it or Parquet files are cataloged in it
+	policies := database.NewRetentionPolicies()
+	catalogFiles := contains(names, "parquet") && getEnvOrDefault("ARCHIVE_CATALOG", "true") == "true"
+	var db *database.DB
+	if len(policies) > 0 || contains(names, "postgres") || catalogFiles {
+		dbConfig := database.NewConfig()
+		if err := database.WaitForReady(context.Background(), dbConfig); err != nil {
+			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		}
+		db, err = database.New(dbConfig)
+		if err != nil {
+			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		}
+		defer db.Close()
+	}
+
+	var archiver *postgresArchiver
+	if len(policies) > 0 {
+		archiver = &postgresArchiver{
+			repo:     database.NewRetentionRepository(db),
+			policies: policies,
+			dir:      getEnvOrDefault("ARCHIVE_DIR", "archive"),
+		}
+	}
+
+	var sinks archiveSinks
+	for _, name := range names {
+		switch name {
+		case "postgres":
+			sinks = append(sinks, &postgresSink{repo: database.NewRedisArchiveRepository(db)})
+		case "parquet":
+			store, err := newArchiveStore(context.Background())
+			if err != nil {
+				logger.Log.Fatal("failed to set up the parquet sink", zap.Error(err))
+			}
+			codec, err := parquetCompression()
+			if err != nil {
+				logger.Log.Fatal("failed to set up the parquet sink", zap.Error(err))
+			}
+			sink := &parquetSink{store: store, prefix: getEnvOrDefault("ARCHIVE_S3_PREFIX", "fin_line"), codec: codec}
+			if catalogFiles {
+				sink.catalog = database.NewArchiveCatalogRepository(db)
+			}
+			sinks = append(sinks, sink)
+		}
+	}
+	logger.Log.Info("archiving Redis entries", zap.Strings("sinks", names))
+
 	// Start metrics server
 	go startMetricsServer()
 
@@ -38,103 +118,227 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Run archival every hour
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	logger.Log.Info("archival service started")
-
-	for {
-		select {
-		case <-ctx.Done():
-			logger.Log.Info("archival service shutting down")
-			return
-		case <-ticker.C:
-			if err := runArchival(ctx, rdb); err != nil {
-				logger.Log.Error("archival failed", zap.Error(err))
-				metrics.ArchivalErrorCounter.Inc()
-			} else {
-				logger.Log.Info("archival completed successfully")
-				metrics.ArchivalSuccessCounter.Inc()
-			}
-		}
+	interval, err := envDuration("ARCHIVAL_INTERVAL", time.Hour)
+	if err != nil || interval <= 0 {
+		logger.Log.Fatal("invalid ARCHIVAL_INTERVAL", zap.Error(err))
 	}
-}
 
-func runArchival(ctx context.Context, rdb *redisclient.Client) error {
-	// Archive old quotes (older than 7 days)
-	if err := archiveOldQuotes(ctx, rdb); err != nil {
-		return err
+	// Keep the Redis streams bounded by REDIS_STREAM_TRIM, without trimming
+	// entries that were not archived yet
+	trimInterval, err := time.ParseDuration(getEnvOrDefault("REDIS_STREAM_TRIM_INTERVAL", "1m"))
+	if err != nil {
+		logger.Log.Fatal("invalid REDIS_STREAM_TRIM_INTERVAL", zap.Error(err))
 	}
-
-	// Archive old anomalies (older than 30 days)
-	if err := archiveOldAnomalies(ctx, rdb); err != nil {
-		return err
+	archived, err := archivingStreams(interval)
+	if err != nil {
+		logger.Log.Fatal("invalid archival schedule", zap.Error(err))
+	}
+	trimPolicies := redisclient.NewTrimPolicies()
+	if err := checkTrimPolicies(trimPolicies, archived); err != nil {
+		logger.Log.Fatal("invalid stream trim policy", zap.Error(err))
+	}
+	go rdb.RunTrimmer(ctx, trimInterval, trimPolicies, archivalTrimFloor(rdb, archived))
+	mode := getEnvOrDefault("ARCHIVAL_MODE", "batch")
+	if mode != "batch" && mode != "continuous" {
+		logger.Log.Fatal("invalid ARCHIVAL_MODE: must be batch or continuous", zap.String("mode", mode))
+	}
+	jobs, continuous, err := archivalJobs(rdb, sinks, archiver, interval, mode == "continuous")
+	if err != nil {
+		logger.Log.Fatal("invalid archival schedule", zap.Error(err))
 	}
 
-	// Archive old raw events (older than 1 day)
-	if err := archiveOldRawEvents(ctx, rdb); err != nil {
-		return err
+	drainTimeout, err := envDuration("ARCHIVAL_SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		logger.Log.Fatal("invalid ARCHIVAL_SHUTDOWN_TIMEOUT", zap.Error(err))
+	}
+	monitor, err := newBackpressureMonitor(rdb, interval)
+	if err != nil {
+		logger.Log.Fatal("invalid backpressure settings", zap.Error(err))
 	}
 
-	return nil
+	// SIGINT/SIGTERM stop new runs; runs in progress finish their page and
+	// continuous archival flushes what it holds, within drainTimeout
+	stopCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	stop := stopCtx.Done()
+
+	logger.Log.Info("archival service started", zap.String("mode", mode))
+
+	// Only the replica holding the archival lock archives
+	var work leaderWork
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		rdb.RunAsLeader(ctx, "archival", redisclient.DefaultLeaseTTL, func(ctx context.Context, token int64) {
+			if !work.start() {
+				return
+			}
+			defer work.done()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				runContinuous(ctx, continuous, stop)
+			}()
+			// Signal the pipeline to slow down while archival is behind
+			monitored := make(chan struct{})
+			go func() {
+				defer close(monitored)
+				if monitor != nil {
+					monitor.run(ctx, stop)
+				}
+			}()
+			runJobs(ctx, rdb, jobs, stop)
+			<-done
+			<-monitored
+		})
+	}()
+
+	<-stop
+	logger.Log.Info("archival service shutting down, draining archival in progress", zap.Duration("timeout", drainTimeout))
+	select {
+	case <-work.stop():
+		logger.Log.Info("archival drained")
+	case <-time.After(drainTimeout):
+		logger.Log.Warn("archival drain timed out, abandoning runs in progress")
+	}
+	// Ends runs still in progress and gives up leadership
+	cancel()
+	<-leaderDone
+	logger.Log.Info("archival service stopped")
 }
 
-func archiveOldQuotes(ctx context.Context, rdb *redisclient.Client) error {
-	// Archive quotes older than 7 days
-	cutoff := time.Now().AddDate(0, 0, -7).UnixMilli()
-	
-	// Get old quotes from normalized:quotes stream
-	args := &redis.XReadArgs{
-		Streams: []string{"normalized:quotes", "0"},
-		Count:   1000,
-		Block:   100 * time.Millisecond,
+// archivalJobs returns the jobs archiving each Redis dataset on its
+// schedule and, when any table has a retention policy, the job exporting
+// and pruning Postgres tables every interval. When continuous, the datasets
+// kept in streams are archived by the continuous archivers returned instead.
+func archivalJobs(rdb *redisclient.Client, sinks archiveSinks, archiver *postgresArchiver, interval time.Duration,
+	continuous bool) ([]archivalJob, []*continuousArchiver, error) {
+	archivers := map[string]func(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, cutoff time.Time, stop <-chan struct{}) (int64, error){
+		database.ArchiveDatasetQuotes:    archiveOldQuotes,
+		database.ArchiveDatasetAnomalies: archiveOldAnomalies,
+		database.ArchiveDatasetRawEvents: archiveOldRawEvents,
 	}
 
-	streams, err := rdb.Client().XRead(ctx, args).Result()
-	if err != nil && err != redis.Nil {
-		return err
+	var flushEvery time.Duration
+	var flushRecords int
+	if continuous {
+		var err error
+		if flushEvery, flushRecords, err = continuousConfig(); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	if len(streams) > 0 && len(streams[0].Messages) > 0 {
-		for _, msg := range streams[0].Messages {
-			// Parse timestamp from message ID
-			tsMs, _ := msg.Values["ts_ms"].(string)
-			if tsMs == "" {
-				continue
-			}
-
-			timestamp, err := strconv.ParseInt(tsMs, 10, 64)
-			if err != nil {
-				continue
-			}
-
-			// If message is old enough, archive it
-			if timestamp < cutoff {
-				// Archive to long-term storage (e.g., database, file system)
-				if err := archiveQuote(msg); err != nil {
-					logger.Log.Error("failed to archive quote", zap.Error(err), zap.String("id", msg.ID))
-				} else {
-					// Remove from Redis stream
-					rdb.Client().XDel(ctx, "normalized:quotes", msg.ID)
-				}
-			}
+	var jobs []archivalJob
+	var tailers []*continuousArchiver
+	for _, dataset := range archiveDatasets {
+		schedule, err := newDatasetSchedule(dataset, interval)
+		if err != nil {
+			return nil, nil, err
+		}
+		if schedule.After == 0 {
+			logger.Log.Info("dataset kept in Redis", zap.String("dataset", dataset))
+			continue
+		}
+		if s, ok := archivedStreams[dataset]; ok && continuous {
+			tailers = append(tailers, &continuousArchiver{
+				rdb:          rdb,
+				sinks:        sinks,
+				stream:       s,
+				after:        schedule.After,
+				flushEvery:   flushEvery,
+				flushRecords: flushRecords,
+			})
+			continue
 		}
+		logger.Log.Info("archiving dataset", zap.String("dataset", dataset), zap.Duration("every", schedule.Every), zap.Duration("after", schedule.After))
+
+		archive := archivers[dataset]
+		jobs = append(jobs, archivalJob{
+			name:  dataset,
+			every: schedule.Every,
+			run: func(ctx context.Context, stop <-chan struct{}) (int64, error) {
+				return archive(ctx, rdb, sinks, time.Now().Add(-schedule.After), stop)
+			},
+		})
 	}
 
-	return nil
+	// Export and prune Postgres tables past retention
+	if archiver != nil {
+		jobs = append(jobs, archivalJob{
+			name:  "postgres_retention",
+			every: interval,
+			run: func(ctx context.Context, _ <-chan struct{}) (int64, error) {
+				return 0, archiver.archive(ctx)
+			},
+		})
+	}
+	return jobs, tailers, nil
+}
+
+// archiveOldQuotes archives the quotes of the normalized:events stream
+// older than cutoff and returns their payload bytes
+func archiveOldQuotes(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	return archiveStream(ctx, rdb, sinks, archivedStreams[database.ArchiveDatasetQuotes], cutoff, stop)
 }
 
-func archiveOldAnomalies(ctx context.Context, rdb *redisclient.Client) error {
-	// Archive anomalies older than 30 days
-	cutoff := time.Now().AddDate(0, 0, -30).UnixMilli()
+// archiveOldRawEvents archives the entries of the raw:events stream older
+// than cutoff and returns their payload bytes
+func archiveOldRawEvents(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	return archiveStream(ctx, rdb, sinks, archivedStreams[database.ArchiveDatasetRawEvents], cutoff, stop)
+}
+
+// archiveOldAnomalies archives the anomalies older than cutoff: those of
+// the anomalies list the API adds manual anomalies to, and those the
+// anomaly service detected, in the anomalies:stream stream and the
+// anomalies:<ticker> sorted sets. It returns their payload bytes.
+func archiveOldAnomalies(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	bytes, err := archiveAnomalyList(ctx, rdb, sinks, cutoff)
+	if err != nil || stopping(stop) {
+		return bytes, err
+	}
+	n, err := archiveStream(ctx, rdb, sinks, anomalyStream, cutoff, stop)
+	bytes += n
+	if err != nil || stopping(stop) {
+		return bytes, err
+	}
+	n, err = archiveAnomalySets(ctx, rdb, sinks, cutoff, stop)
+	return bytes + n, err
+}
 
+// archiveAnomalyList archives the anomalies of the anomalies list older
+// than cutoff and returns their payload bytes
+func archiveAnomalyList(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, cutoff time.Time) (int64, error) {
 	// Get old anomalies from anomalies list
 	anomalies, err := rdb.Client().LRange(ctx, "anomalies", 0, -1).Result()
 	if err != nil && err != redis.Nil {
-		return err
+		return 0, err
+	}
+
+	records, members := oldAnomalies(anomalies, cutoff)
+	if len(records) == 0 {
+		metrics.ArchivalBacklog.WithLabelValues("anomalies").Set(float64(len(anomalies)))
+		return 0, nil
+	}
+
+	if err := sinks.Write(ctx, database.ArchiveDatasetAnomalies, records); err != nil {
+		return 0, fmt.Errorf("failed to archive anomalies: %w", err)
 	}
+	for _, member := range members {
+		// Remove from Redis list
+		if err := rdb.Client().LRem(ctx, "anomalies", 1, member).Err(); err != nil {
+			return 0, fmt.Errorf("failed to delete archived anomaly: %w", err)
+		}
+	}
+	metrics.ArchivalBacklog.WithLabelValues("anomalies").Set(float64(len(anomalies) - len(members)))
+	logger.Log.Info("archived anomalies", zap.Int("anomalies", len(records)))
+	return recordsBytes(records), nil
+}
 
+// oldAnomalies returns the records of the anomalies, members of the
+// anomalies list, older than cutoff, and the members they were read from
+func oldAnomalies(anomalies []string, cutoff time.Time) ([]*database.ArchivedRecord, []string) {
+	var records []*database.ArchivedRecord
+	var members []string
 	for _, anomalyStr := range anomalies {
 		var anomalyData map[string]interface{}
 		if err := json.Unmarshal([]byte(anomalyStr), &anomalyData); err != nil {
@@ -156,85 +360,48 @@ func archiveOldAnomalies(ctx context.Context, rdb *redisclient.Client) error {
 		}
 
 		// If anomaly is old enough, archive it
-		if timestamp < cutoff {
-			// Archive to long-term storage
-			if err := archiveAnomaly(anomalyData); err != nil {
-				logger.Log.Error("failed to archive anomaly", zap.Error(err))
-			} else {
-				// Remove from Redis list
-				rdb.Client().LRem(ctx, "anomalies", 1, anomalyStr)
+		if timestamp < cutoff.UnixMilli() {
+			id, _ := anomalyData["id"].(string)
+			ticker, _ := anomalyData["ticker"].(string)
+			if id == "" {
+				id = anomalyID(ticker, timestamp)
 			}
+			records = append(records, &database.ArchivedRecord{
+				ID:        id,
+				Ticker:    ticker,
+				Timestamp: timestamp,
+				Payload:   json.RawMessage(anomalyStr),
+			})
+			members = append(members, anomalyStr)
 		}
 	}
-
-	return nil
+	return records, members
 }
 
-func archiveOldRawEvents(ctx context.Context, rdb *redisclient.Client) error {
-	// Archive raw events older than 1 day
-	cutoff := time.Now().AddDate(0, 0, -1).UnixMilli()
-
-	// Get old raw events from raw:events stream
-	args := &redis.XReadArgs{
-		Streams: []string{"raw:events", "0"},
-		Count:   1000,
-		Block:   100 * time.Millisecond,
-	}
-
-	streams, err := rdb.Client().XRead(ctx, args).Result()
-	if err != nil && err != redis.Nil {
-		return err
+// startMetricsServer serves the Prometheus metrics on ARCHIVAL_PORT
+func startMetricsServer() {
+	r := chi.NewRouter()
+	r.Handle("/metrics", promhttp.Handler())
+	addr := ":" + getEnvOrDefault("ARCHIVAL_PORT", "8085")
+	logger.Log.Info("metrics server listening", zap.String("addr", addr))
+	if err := http.ListenAndServe(addr, r); err != nil {
+		logger.Log.Error("metrics server failed", zap.Error(err))
 	}
+}
 
-	if len(streams) > 0 && len(streams[0].Messages) > 0 {
-		for _, msg := range streams[0].Messages {
-			// Parse timestamp from message ID
-			tsMs, _ := msg.Values["timestamp"].(string)
-			if tsMs == "" {
-				continue
-			}
-
-			timestamp, err := strconv.ParseInt(tsMs, 10, 64)
-			if err != nil {
-				continue
-			}
-
-			// If message is old enough, archive it
-			if timestamp < cutoff {
-				// Archive to long-term storage
-				if err := archiveRawEvent(msg); err != nil {
-					logger.Log.Error("failed to archive raw event", zap.Error(err), zap.String("id", msg.ID))
-				} else {
-					// Remove from Redis stream
-					rdb.Client().XDel(ctx, "raw:events", msg.ID)
-				}
-			}
+// contains reports whether names holds name
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
 		}
 	}
-
-	return nil
+	return false
 }
 
-// Placeholder functions for actual archival implementation
-func archiveQuote(msg redis.XMessage) error {
-	// TODO: Implement actual archival to database or file system
-	logger.Log.Info("archiving quote", zap.String("id", msg.ID))
-	return nil
-}
-
-func archiveAnomaly(data map[string]interface{}) error {
-	// TODO: Implement actual archival to database or file system
-	logger.Log.Info("archiving anomaly", zap.String("id", data["id"].(string)))
-	return nil
-}
-
-func archiveRawEvent(msg redis.XMessage) error {
-	// TODO: Implement actual archival to database or file system
-	logger.Log.Info("archiving raw event", zap.String("id", msg.ID))
-	return nil
-}
-
-func startMetricsServer() {
-	// TODO: Implement metrics server
-	logger.Log.Info("metrics server started")
-} 
\ No newline at end of file
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
\ No newline at end of file
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+)
+
+// manifestSuffix is appended to the key of a Parquet file to name its
+// manifest
+const manifestSuffix = ".manifest.json"
+
+// parquetManifest describes a Parquet archive file as written, so a later
+// check can tell whether the file is still there and unchanged
+type parquetManifest struct {
+	Dataset      string    `json:"dataset"`
+	Object       string    `json:"object"`
+	Records      int       `json:"records"`
+	MinTimestamp int64     `json:"min_timestamp"`
+	MaxTimestamp int64     `json:"max_timestamp"`
+	SHA256       string    `json:"sha256"`
+	IDsSHA256    string    `json:"ids_sha256"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// newParquetManifest describes the file body, holding records, written to
+// key. records are in timestamp order.
+func newParquetManifest(dataset, key string, records []*database.ArchivedRecord, body []byte) *parquetManifest {
+	sum := sha256.Sum256(body)
+	return &parquetManifest{
+		Dataset:      dataset,
+		Object:       key,
+		Records:      len(records),
+		MinTimestamp: records[0].Timestamp,
+		MaxTimestamp: records[len(records)-1].Timestamp,
+		SHA256:       hex.EncodeToString(sum[:]),
+		IDsSHA256:    recordsDigest(records),
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+// writeParquetManifest stores manifest beside the file it describes
+func writeParquetManifest(ctx context.Context, store objectStore, manifest *parquetManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	key := manifest.Object + manifestSuffix
+	if err := store.Put(ctx, key, body); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// verifyParquetManifest checks the file described by the manifest at key,
+// returning the problems found: a missing or altered file, or one whose
+// records differ from the manifest's
+func verifyParquetManifest(ctx context.Context, store objectStore, key string) ([]string, error) {
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	var manifest parquetManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return []string{fmt.Sprintf("unreadable manifest: %v", err)}, nil
+	}
+	if manifest.Object != strings.TrimSuffix(key, manifestSuffix) {
+		return []string{fmt.Sprintf("manifest describes %s", manifest.Object)}, nil
+	}
+
+	body, err := store.Get(ctx, manifest.Object)
+	if err != nil {
+		return []string{fmt.Sprintf("file unreadable: %v", err)}, nil
+	}
+	var problems []string
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		problems = append(problems, "file checksum differs")
+	}
+	records, err := decodeParquet(body)
+	if err != nil {
+		return append(problems, err.Error()), nil
+	}
+	if len(records) != manifest.Records {
+		return append(problems, fmt.Sprintf("file holds %d records, manifest %d", len(records), manifest.Records)), nil
+	}
+	if len(records) > 0 && (records[0].Timestamp != manifest.MinTimestamp || records[len(records)-1].Timestamp != manifest.MaxTimestamp) {
+		problems = append(problems, "record timestamps differ")
+	}
+	if recordsDigest(records) != manifest.IDsSHA256 {
+		problems = append(problems, "record ids differ")
+	}
+	return problems, nil
+}
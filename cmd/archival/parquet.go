@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// parquetRow is the schema of the Parquet archive files
+type parquetRow struct {
+	ID        string `parquet:"id"`
+	Ticker    string `parquet:"ticker,dict"`
+	Timestamp int64  `parquet:"timestamp,timestamp(millisecond)"`
+	Payload   string `parquet:"payload"`
+}
+
+// objectStore stores archive files
+type objectStore interface {
+	Put(ctx context.Context, key string, body []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// parquetSink writes each batch as Parquet files to an object store, one
+// per day and ticker of the entries, in Hive-style partitions:
+// <prefix>/<dataset>/date=<YYYY-MM-DD>/symbol=<ticker>/<first timestamp>-<digest>.parquet,
+// each with a manifest beside it. The digest covers the entry ids, so
+// writing a batch again overwrites its files instead of duplicating them.
+// With a catalog, each file is also recorded there.
+type parquetSink struct {
+	store   objectStore
+	prefix  string
+	codec   compress.Codec
+	catalog database.ArchiveCatalogRepository
+}
+
+// noTickerPartition is the symbol partition of entries without a ticker,
+// the value Hive, Spark and Athena read as null
+const noTickerPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// archivePartition is the day and ticker an archive file holds entries of
+type archivePartition struct {
+	day    string
+	ticker string
+}
+
+// dir returns the directory of the partition's files under datasetDir. The
+// ticker partition is named symbol because the files keep their ticker
+// column, and Spark and Athena reject a partition column sharing its name
+// with a file column.
+func (p archivePartition) dir(datasetDir string) string {
+	symbol := noTickerPartition
+	if p.ticker != "" {
+		symbol = url.PathEscape(p.ticker)
+	}
+	return path.Join(datasetDir, "date="+p.day, "symbol="+symbol)
+}
+
+// Name implements archiveSink
+func (s *parquetSink) Name() string {
+	return "parquet"
+}
+
+// Write implements archiveSink
+func (s *parquetSink) Write(ctx context.Context, dataset string, records []*database.ArchivedRecord) error {
+	partitions := make(map[archivePartition][]*database.ArchivedRecord)
+	for _, record := range records {
+		p := archivePartition{day: time.UnixMilli(record.Timestamp).UTC().Format("2006-01-02"), ticker: record.Ticker}
+		partitions[p] = append(partitions[p], record)
+	}
+
+	for p, partRecords := range partitions {
+		sort.SliceStable(partRecords, func(i, j int) bool { return partRecords[i].Timestamp < partRecords[j].Timestamp })
+
+		body, err := encodeParquet(partRecords, s.codec)
+		if err != nil {
+			return err
+		}
+		key := path.Join(p.dir(path.Join(s.prefix, dataset)), fmt.Sprintf("%d-%s.parquet", partRecords[0].Timestamp, recordsDigest(partRecords)[:16]))
+		if err := s.store.Put(ctx, key, body); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		manifest := newParquetManifest(dataset, key, partRecords, body)
+		if err := writeParquetManifest(ctx, s.store, manifest); err != nil {
+			return err
+		}
+		if s.catalog != nil {
+			err := s.catalog.SaveArchiveCatalogEntry(ctx, &database.ArchiveCatalogEntry{
+				Object:       key,
+				Dataset:      dataset,
+				Date:         p.day,
+				Ticker:       p.ticker,
+				Records:      manifest.Records,
+				Bytes:        int64(len(body)),
+				MinTimestamp: manifest.MinTimestamp,
+				MaxTimestamp: manifest.MaxTimestamp,
+				SHA256:       manifest.SHA256,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parquetCodecs are the compression codecs ARCHIVE_PARQUET_COMPRESSION names
+var parquetCodecs = map[string]compress.Codec{
+	"zstd":   &parquet.Zstd,
+	"snappy": &parquet.Snappy,
+	"gzip":   &parquet.Gzip,
+	"none":   &parquet.Uncompressed,
+}
+
+// parquetCompression returns the codec named in ARCHIVE_PARQUET_COMPRESSION
+func parquetCompression() (compress.Codec, error) {
+	name := getEnvOrDefault("ARCHIVE_PARQUET_COMPRESSION", "zstd")
+	codec, ok := parquetCodecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown ARCHIVE_PARQUET_COMPRESSION %q: must be zstd, snappy, gzip or none", name)
+	}
+	return codec, nil
+}
+
+// encodeParquet encodes records as a Parquet file with its columns
+// compressed by codec
+func encodeParquet(records []*database.ArchivedRecord, codec compress.Codec) ([]byte, error) {
+	rows := make([]parquetRow, len(records))
+	for i, record := range records {
+		rows[i] = parquetRow{ID: record.ID, Ticker: record.Ticker, Timestamp: record.Timestamp, Payload: string(record.Payload)}
+	}
+
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[parquetRow](&buf, parquet.Compression(codec))
+	if _, err := w.Write(rows); err != nil {
+		return nil, fmt.Errorf("failed to encode parquet: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode parquet: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeParquet decodes the records of a Parquet file
+func decodeParquet(body []byte) ([]*database.ArchivedRecord, error) {
+	rows, err := parquet.Read[parquetRow](bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode parquet: %w", err)
+	}
+	records := make([]*database.ArchivedRecord, len(rows))
+	for i, row := range rows {
+		records[i] = &database.ArchivedRecord{ID: row.ID, Ticker: row.Ticker, Timestamp: row.Timestamp, Payload: json.RawMessage(row.Payload)}
+	}
+	return records, nil
+}
+
+// recordsDigest returns the SHA-256 of the ids of records, in order
+func recordsDigest(records []*database.ArchivedRecord) string {
+	h := sha256.New()
+	for _, record := range records {
+		h.Write([]byte(record.ID))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newArchiveStore creates the store of the Parquet files: the S3 bucket,
+// through encryption when an archive key is configured
+func newArchiveStore(ctx context.Context) (objectStore, error) {
+	store, err := newS3Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptedStore(store)
+}
+
+// s3Store uploads archive files to an S3 bucket, or to Google Cloud Storage
+// through its S3-compatible endpoint with HMAC keys
+type s3Store struct {
+	client   *s3.Client
+	bucket   string
+	kmsKeyID string
+}
+
+// newS3Store creates a store for ARCHIVE_S3_BUCKET, with credentials from
+// the default AWS chain (environment, shared config, instance role). Set
+// ARCHIVE_S3_ENDPOINT for other S3-compatible stores, e.g.
+// https://storage.googleapis.com. With ARCHIVE_S3_KMS_KEY_ID, S3 encrypts
+// the files with that KMS key.
+func newS3Store(ctx context.Context) (*s3Store, error) {
+	bucket := getEnvOrDefault("ARCHIVE_S3_BUCKET", "")
+	if bucket == "" {
+		return nil, fmt.Errorf("ARCHIVE_S3_BUCKET is required by the parquet sink")
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region := getEnvOrDefault("ARCHIVE_S3_REGION", ""); region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	endpoint := getEnvOrDefault("ARCHIVE_S3_ENDPOINT", "")
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+			// Other stores may reject the checksums S3 accepts by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		}
+	})
+	return &s3Store{client: client, bucket: bucket, kmsKeyID: getEnvOrDefault("ARCHIVE_S3_KMS_KEY_ID", "")}, nil
+}
+
+// Put implements objectStore
+func (s *s3Store) Put(ctx context.Context, key string, body []byte) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/vnd.apache.parquet"),
+	}
+	if s.kmsKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+	_, err := s.client.PutObject(ctx, input)
+	return err
+}
+
+// Get implements objectStore
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// List implements objectStore
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+	return keys, nil
+}
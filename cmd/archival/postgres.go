@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// postgresArchiver exports rows of the retention tables to gzipped JSON
+// lines files before the retention policy allows them to be pruned
+type postgresArchiver struct {
+	repo     database.RetentionRepository
+	policies []database.RetentionPolicy
+	dir      string
+}
+
+// archive exports and prunes every table with a retention policy. Without
+// RequireArchive expired rows are pruned without being exported.
+func (a *postgresArchiver) archive(ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, policy := range a.policies {
+		var deleted int64
+		var err error
+		if policy.RequireArchive {
+			// Archive files are named to the second, so they span exactly
+			// what they hold
+			deleted, err = a.exportAndPrune(ctx, policy.Table, now.Add(-policy.MaxAge).Truncate(time.Second))
+		} else {
+			deleted, err = a.repo.Prune(ctx, policy, now)
+		}
+		if err != nil {
+			return err
+		}
+		logger.Log.Info("pruned expired rows", zap.String("table", policy.Table), zap.Int64("deleted", deleted))
+	}
+	return nil
+}
+
+// exportAndPrune writes every row of table aged before until, late rows
+// older than the archive watermark included, to
+// <dir>/<table>/<from>-<until>.jsonl.gz and deletes them in the same
+// transaction, so rows are only ever pruned once they are on disk
+func (a *postgresArchiver) exportAndPrune(ctx context.Context, table string, until time.Time) (int64, error) {
+	dir := filepath.Join(a.dir, table)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	deleted, err := a.repo.ExportAndPrune(ctx, table, until, func(rows database.ExportedRows) error {
+		n, err := writeArchive(dir, until, rows)
+		if err != nil {
+			return err
+		}
+		logger.Log.Info("archived rows",
+			zap.String("table", table),
+			zap.Int("rows", n),
+			zap.Time("until", until))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// writeArchive writes rows to dir, one per line, in a file named for the
+// age of the oldest row and until. The file only appears once it is
+// complete and synced, and not at all when there are no rows.
+func writeArchive(dir string, until time.Time, rows database.ExportedRows) (int, error) {
+	f, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	w := bufio.NewWriter(gz)
+	var n int
+	var from time.Time
+	err = rows(func(row []byte, at time.Time) error {
+		if n == 0 {
+			from = at
+		}
+		n++
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	if err := w.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync archive file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close archive file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, database.ArchiveFileName(from, until))); err != nil {
+		return 0, fmt.Errorf("failed to move archive file into place: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// restoreOptions are the flags of the restore command
+type restoreOptions struct {
+	dataset  string
+	from     string
+	to       string
+	source   string
+	target   string
+	stream   string
+	redisURL string
+	batch    int
+}
+
+// restore runs the restore command with args and returns its exit code
+func restore(args []string) int {
+	var opts restoreOptions
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.StringVar(&opts.dataset, "dataset", database.ArchiveDatasetQuotes, "dataset to restore: quotes, anomalies or raw_events")
+	fs.StringVar(&opts.from, "from", "", "start of the time range, in milliseconds or RFC3339 (required)")
+	fs.StringVar(&opts.to, "to", "", "end of the time range, exclusive (default now)")
+	fs.StringVar(&opts.source, "source", "postgres", "archive to read: postgres or parquet")
+	fs.StringVar(&opts.target, "target", "redis", "where to write: redis (a stream) or quotes (the quotes table)")
+	fs.StringVar(&opts.stream, "stream", "", "stream the redis target appends to (default restored:<dataset>)")
+	fs.StringVar(&opts.redisURL, "redis", os.Getenv("REDIS_URL"), "Redis connection URL")
+	fs.IntVar(&opts.batch, "batch", 1000, "records written at a time")
+	timeout := fs.Duration("timeout", 0, "maximum time for the whole restore (0 for none)")
+	fs.Usage = func() { restoreUsage(fs) }
+	fs.Parse(args)
+
+	from, fromErr := parseRestoreTime(opts.from, time.Time{})
+	until, toErr := parseRestoreTime(opts.to, time.Now())
+	valid := fs.NArg() == 0 && opts.from != "" && fromErr == nil && toErr == nil && from.Before(until) && opts.batch > 0 &&
+		(opts.source == "postgres" || opts.source == "parquet") &&
+		((opts.target == "redis" && opts.redisURL != "") || (opts.target == "quotes" && opts.dataset == database.ArchiveDatasetQuotes))
+	if !valid {
+		restoreUsage(fs)
+		return 2
+	}
+	if opts.stream == "" {
+		opts.stream = "restored:" + opts.dataset
+	}
+
+	if err := logger.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, "logger init error:", err)
+		return 1
+	}
+	defer logger.Log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var db *database.DB
+	if opts.source == "postgres" || opts.target == "quotes" {
+		dbConfig := database.NewConfig()
+		if err := database.WaitForReady(ctx, dbConfig); err != nil {
+			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		}
+		var err error
+		db, err = database.New(dbConfig)
+		if err != nil {
+			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		}
+		defer db.Close()
+	}
+
+	r := &restorer{batchSize: opts.batch}
+	switch opts.target {
+	case "redis":
+		rdb := redisclient.New(opts.redisURL)
+		defer rdb.Close()
+		r.write = func(ctx context.Context, records []*database.ArchivedRecord) (int64, error) {
+			return appendToStream(ctx, rdb, opts.stream, records)
+		}
+	case "quotes":
+		repo := database.NewQuoteRepository(db)
+		r.write = func(ctx context.Context, records []*database.ArchivedRecord) (int64, error) {
+			return backfillQuotes(ctx, repo, records)
+		}
+	}
+
+	var err error
+	switch opts.source {
+	case "postgres":
+		filter := database.ArchiveFilter{Dataset: opts.dataset, From: from.UnixMilli(), Until: until.UnixMilli()}
+		err = database.NewRedisArchiveRepository(db).ReadArchivedRecords(ctx, filter, func(record *database.ArchivedRecord) error {
+			return r.add(ctx, record)
+		})
+	case "parquet":
+		var store objectStore
+		store, err = newArchiveStore(ctx)
+		if err == nil {
+			err = readParquetArchive(ctx, store, getEnvOrDefault("ARCHIVE_S3_PREFIX", "fin_line"), opts.dataset, from, until, func(record *database.ArchivedRecord) error {
+				return r.add(ctx, record)
+			})
+		}
+	}
+	if err == nil {
+		err = r.flush(ctx)
+	}
+
+	fmt.Printf("read %d archived %s, restored %d\n", r.read, opts.dataset, r.written)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore:", err)
+		return 1
+	}
+	return 0
+}
+
+func restoreUsage(fs *flag.FlagSet) {
+	fmt.Fprintf(fs.Output(), `Usage: archival restore --from TIME [flags]
+
+Reads the records of a dataset archived between --from and --to, from the
+redis_archive_* tables or the Parquet files, and appends them to a Redis
+stream or, for quotes, stores them in the quotes table. Quotes already
+stored are left as they are; records appended to a stream are appended
+again by a second restore.
+
+Flags:
+`)
+	fs.PrintDefaults()
+}
+
+// parseRestoreTime parses a time in milliseconds since the epoch or
+// RFC3339, returning defaultValue for an empty s
+func parseRestoreTime(s string, defaultValue time.Time) (time.Time, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// restorer collects archived records and writes them in batches
+type restorer struct {
+	batchSize int
+	write     func(ctx context.Context, records []*database.ArchivedRecord) (int64, error)
+	pending   []*database.ArchivedRecord
+
+	read, written int64
+}
+
+// add queues record, writing the queue once it holds a full batch
+func (r *restorer) add(ctx context.Context, record *database.ArchivedRecord) error {
+	r.read++
+	r.pending = append(r.pending, record)
+	if len(r.pending) < r.batchSize {
+		return nil
+	}
+	return r.flush(ctx)
+}
+
+// flush writes the queued records
+func (r *restorer) flush(ctx context.Context) error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	written, err := r.write(ctx, r.pending)
+	if err != nil {
+		return err
+	}
+	r.written += written
+	r.pending = r.pending[:0]
+
+	logger.Log.Info("restore progress", zap.Int64("read", r.read), zap.Int64("restored", r.written))
+	return nil
+}
+
+// readParquetArchive calls fn with each record of dataset timestamped in
+// [from, until) from the Parquet files under prefix, ordered by timestamp
+// and id. The files of each day are read together, so records written to
+// several files by repeated runs are passed once.
+func readParquetArchive(ctx context.Context, store objectStore, prefix, dataset string, from, until time.Time, fn func(record *database.ArchivedRecord) error) error {
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(until); day = day.AddDate(0, 0, 1) {
+		keys, err := store.List(ctx, path.Join(prefix, dataset, "date="+day.Format("2006-01-02"))+"/")
+		if err != nil {
+			return fmt.Errorf("failed to list archive files: %w", err)
+		}
+
+		seen := make(map[string]bool)
+		var records []*database.ArchivedRecord
+		for _, key := range keys {
+			if !strings.HasSuffix(key, ".parquet") {
+				continue
+			}
+			body, err := store.Get(ctx, key)
+			if err != nil {
+				return fmt.Errorf("failed to download %s: %w", key, err)
+			}
+			fileRecords, err := decodeParquet(body)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			for _, record := range fileRecords {
+				if seen[record.ID] || record.Timestamp < from.UnixMilli() || record.Timestamp >= until.UnixMilli() {
+					continue
+				}
+				seen[record.ID] = true
+				records = append(records, record)
+			}
+		}
+
+		sort.Slice(records, func(i, j int) bool {
+			if records[i].Timestamp != records[j].Timestamp {
+				return records[i].Timestamp < records[j].Timestamp
+			}
+			return records[i].ID < records[j].ID
+		})
+		for _, record := range records {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendToStream adds each record to stream as an entry holding the
+// record's payload fields
+func appendToStream(ctx context.Context, rdb *redisclient.Client, stream string, records []*database.ArchivedRecord) (int64, error) {
+	var written int64
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, record := range records {
+			values, err := payloadFields(record.Payload)
+			if err != nil {
+				logger.Log.Warn("skipping unrestorable record", zap.String("id", record.ID), zap.Error(err))
+				continue
+			}
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: values})
+			written++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to append to %s: %w", stream, err)
+	}
+	return written, nil
+}
+
+// backfillQuotes stores the quotes among records in the quotes table
+func backfillQuotes(ctx context.Context, repo database.QuoteRepository, records []*database.ArchivedRecord) (int64, error) {
+	quotes := make([]*models.NormalizedTick, 0, len(records))
+	for _, record := range records {
+		values, err := payloadFields(record.Payload)
+		if err == nil {
+			var tick models.NormalizedTick
+			if tick, err = models.HistoricalTickFromMap(values); err == nil {
+				quotes = append(quotes, &tick)
+				continue
+			}
+		}
+		logger.Log.Warn("skipping unrestorable record", zap.String("id", record.ID), zap.Error(err))
+	}
+	return repo.BackfillQuotes(ctx, quotes)
+}
+
+// payloadFields returns the fields of an archived payload as stream entry
+// values: strings as they are and other values as JSON
+func payloadFields(payload json.RawMessage) (map[string]interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{}, len(fields))
+	for name, raw := range fields {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			values[name] = s
+		} else {
+			values[name] = string(bytes.TrimSpace(raw))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Default ages past which Redis entries are archived
+var defaultArchiveAfter = map[string]time.Duration{
+	database.ArchiveDatasetQuotes:    7 * 24 * time.Hour,
+	database.ArchiveDatasetAnomalies: 30 * 24 * time.Hour,
+	database.ArchiveDatasetRawEvents: 24 * time.Hour,
+}
+
+// archivalJob is a task the archival service runs on its own interval.
+// run returns the payload bytes it archived; once stop is closed it should
+// finish what it can leave consistent, e.g. the page in progress, and
+// return, while ctx ends it outright.
+type archivalJob struct {
+	name  string
+	every time.Duration
+	run   func(ctx context.Context, stop <-chan struct{}) (int64, error)
+}
+
+// datasetSchedule is how often a dataset is archived and how old its
+// entries must be. An After of 0 keeps the dataset in Redis.
+type datasetSchedule struct {
+	Every time.Duration
+	After time.Duration
+}
+
+// newDatasetSchedule reads the schedule of dataset from
+// ARCHIVE_<DATASET>_EVERY, defaulting to ARCHIVAL_INTERVAL, and
+// ARCHIVE_<DATASET>_AFTER, e.g. ARCHIVE_RAW_EVENTS_AFTER=48h
+func newDatasetSchedule(dataset string, interval time.Duration) (datasetSchedule, error) {
+	prefix := "ARCHIVE_" + strings.ToUpper(dataset)
+	every, err := envDuration(prefix+"_EVERY", interval)
+	if err != nil {
+		return datasetSchedule{}, err
+	}
+	after, err := envDuration(prefix+"_AFTER", defaultArchiveAfter[dataset])
+	if err != nil {
+		return datasetSchedule{}, err
+	}
+	if every <= 0 {
+		return datasetSchedule{}, fmt.Errorf("%s_EVERY must be positive", prefix)
+	}
+	if after < 0 {
+		return datasetSchedule{}, fmt.Errorf("%s_AFTER must not be negative", prefix)
+	}
+	return datasetSchedule{Every: every, After: after}, nil
+}
+
+// envDuration returns the duration in key, or defaultValue if it is unset
+func envDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := getEnvOrDefault(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// lastRunsKey is the hash holding, per job, when it last started, in
+// milliseconds, so a replica taking over leadership keeps to the schedule
+const lastRunsKey = "archival:last_runs"
+
+// runJobs runs each job every interval until ctx is done or stop is
+// closed, returning once the runs in progress have returned. Jobs run
+// independently, so a slow dataset does not hold back the others. Each
+// job's start is recorded in Redis, so a new leader runs a job when the
+// previous one would have, right away if it is overdue, rather than a full
+// interval after taking over.
+func runJobs(ctx context.Context, rdb *redisclient.Client, jobs []archivalJob, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job archivalJob) {
+			defer wg.Done()
+			for {
+				timer := time.NewTimer(time.Until(nextRun(ctx, rdb, job)))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-stop:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+
+				start := time.Now()
+				if err := rdb.Client().HSet(ctx, lastRunsKey, job.name, start.UnixMilli()).Err(); err != nil {
+					logger.Log.Warn("failed to record archival run", zap.String("job", job.name), zap.Error(err))
+				}
+				bytes, err := job.run(ctx, stop)
+				metrics.ArchivalLatency.Observe(time.Since(start).Seconds())
+				metrics.ArchivalRunBytes.WithLabelValues(job.name).Set(float64(bytes))
+				if err != nil {
+					logger.Log.Error("archival failed", zap.String("job", job.name), zap.Error(err))
+					metrics.ArchivalErrorCounter.Inc()
+				} else {
+					logger.Log.Info("archival completed successfully", zap.String("job", job.name), zap.Int64("bytes", bytes))
+					metrics.ArchivalSuccessCounter.Inc()
+					metrics.ArchivalLastSuccess.WithLabelValues(job.name).SetToCurrentTime()
+				}
+			}
+		}(job)
+	}
+	wg.Wait()
+}
+
+// nextRun returns when job is next due: an interval after its last
+// recorded start, or an interval from now if none could be read
+func nextRun(ctx context.Context, rdb *redisclient.Client, job archivalJob) time.Time {
+	last, err := rdb.Client().HGet(ctx, lastRunsKey, job.name).Int64()
+	if err != nil {
+		if err != redis.Nil && ctx.Err() == nil {
+			logger.Log.Warn("failed to read last archival run", zap.String("job", job.name), zap.Error(err))
+		}
+		return time.Now().Add(job.every)
+	}
+	return time.UnixMilli(last).Add(job.every)
+}
+
+// stopping reports whether stop is closed
+func stopping(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
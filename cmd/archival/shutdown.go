@@ -0,0 +1,47 @@
+package main
+
+import "sync"
+
+// leaderWork tracks whether the leader is archiving, so shutdown can wait
+// for in-progress work to finish before giving up leadership
+type leaderWork struct {
+	mu      sync.Mutex
+	stopped bool
+	running bool
+	idle    chan struct{}
+}
+
+// start marks work as running and reports whether it may run at all: once
+// stop is called, no new work starts
+func (w *leaderWork) start() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return false
+	}
+	w.running = true
+	w.idle = make(chan struct{})
+	return true
+}
+
+// done marks the work started last as finished
+func (w *leaderWork) done() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running = false
+	close(w.idle)
+}
+
+// stop prevents new work from starting and returns a channel closed once
+// no work is running
+func (w *leaderWork) stop() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if !w.running {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return w.idle
+}
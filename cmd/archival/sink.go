@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/metrics"
+)
+
+// archiveSink stores entries archived from Redis. A batch written without
+// error must be durable, as its entries are deleted from Redis next, and
+// writing a batch again must be harmless, as that deletion may fail.
+type archiveSink interface {
+	Name() string
+	Write(ctx context.Context, dataset string, records []*database.ArchivedRecord) error
+}
+
+// archiveSinks writes every batch to each of its sinks
+type archiveSinks []archiveSink
+
+// Write writes records to each sink in turn, stopping at the first failure.
+// Sinks written before it hold the batch already, which is harmless as it is
+// written again on the next run.
+func (s archiveSinks) Write(ctx context.Context, dataset string, records []*database.ArchivedRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	for _, sink := range s {
+		start := time.Now()
+		err := sink.Write(ctx, dataset, records)
+		metrics.ArchivalSinkDuration.WithLabelValues(sink.Name()).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.ArchivalSinkErrors.WithLabelValues(sink.Name(), dataset).Inc()
+			return fmt.Errorf("%s sink: %w", sink.Name(), err)
+		}
+		metrics.ArchivalSinkRecords.WithLabelValues(sink.Name(), dataset).Add(float64(len(records)))
+	}
+	return nil
+}
+
+// recordsBytes returns the size of the payloads of records
+func recordsBytes(records []*database.ArchivedRecord) int64 {
+	var n int64
+	for _, record := range records {
+		n += int64(len(record.Payload))
+	}
+	return n
+}
+
+// sinkNames returns the sinks listed, comma-separated, in ARCHIVE_SINKS:
+// postgres, parquet or both
+func sinkNames() ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(getEnvOrDefault("ARCHIVE_SINKS", "postgres"), ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "postgres", "parquet":
+			names = append(names, name)
+		default:
+			return nil, fmt.Errorf("unknown archive sink %q: must be postgres or parquet", name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("ARCHIVE_SINKS lists no sink")
+	}
+	return names, nil
+}
+
+// postgresSink inserts archived entries into the redis_archive_* tables
+type postgresSink struct {
+	repo database.RedisArchiveRepository
+}
+
+// Name implements archiveSink
+func (s *postgresSink) Name() string {
+	return "postgres"
+}
+
+// Write implements archiveSink
+func (s *postgresSink) Write(ctx context.Context, dataset string, records []*database.ArchivedRecord) error {
+	_, err := s.repo.SaveArchivedRecords(ctx, dataset, records)
+	return err
+}
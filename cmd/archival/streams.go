@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// checkpointsKey is the hash holding, per stream, the ID of the last entry
+// archived, from which the next run resumes. It is written fenced by the
+// archival lease, so a leader that lost its lease cannot move it.
+const checkpointsKey = "archival:checkpoints"
+
+// archivePageSize is the entries read, archived and trimmed at a time
+const archivePageSize = 1000
+
+// archivedStream is a stream archived as dataset. record converts its
+// entries, streamRecord if nil.
+type archivedStream struct {
+	stream  string
+	dataset string
+	record  func(msg redis.XMessage) (*database.ArchivedRecord, error)
+}
+
+// toRecord converts an entry of the stream to an archived record
+func (s archivedStream) toRecord(msg redis.XMessage) (*database.ArchivedRecord, error) {
+	if s.record != nil {
+		return s.record(msg)
+	}
+	return streamRecord(msg)
+}
+
+// archivedStreams are the streams of the datasets archived from streams
+var archivedStreams = map[string]archivedStream{
+	database.ArchiveDatasetQuotes:    {stream: "normalized:events", dataset: database.ArchiveDatasetQuotes},
+	database.ArchiveDatasetRawEvents: {stream: "raw:events", dataset: database.ArchiveDatasetRawEvents},
+}
+
+// archiveStream archives the entries of s added before cutoff, by entry ID,
+// in pages: each page is read with XRANGE after the stream's checkpoint,
+// written to the sinks, recorded as the new checkpoint and only then
+// trimmed from the stream with XTRIM MINID. A run interrupted at any point
+// resumes after the last page recorded, and a page written but not
+// recorded is written again, which the sinks tolerate. Once stop is closed
+// the run ends after the page in progress. It returns the payload bytes
+// archived.
+func archiveStream(ctx context.Context, rdb *redisclient.Client, sinks archiveSinks, s archivedStream, cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	start, end, err := streamArchiveRange(ctx, rdb, s.stream, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	var archived int
+	var bytes int64
+	for {
+		msgs, err := rdb.Client().XRangeN(ctx, s.stream, start, end, archivePageSize).Result()
+		if err != nil {
+			return bytes, fmt.Errorf("failed to read %s: %w", s.stream, err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+
+		records := make([]*database.ArchivedRecord, 0, len(msgs))
+		for _, msg := range msgs {
+			record, err := s.toRecord(msg)
+			if err != nil {
+				logger.Log.Warn("skipping unarchivable entry", zap.String("stream", s.stream), zap.String("id", msg.ID), zap.Error(err))
+				continue
+			}
+			records = append(records, record)
+		}
+		if err := sinks.Write(ctx, s.dataset, records); err != nil {
+			return bytes, fmt.Errorf("failed to archive %s: %w", s.stream, err)
+		}
+
+		last := msgs[len(msgs)-1].ID
+		if err := rdb.FencedHSet(ctx, checkpointsKey, s.stream, last); err != nil {
+			return bytes, fmt.Errorf("failed to record %s checkpoint: %w", s.stream, err)
+		}
+		// Entries behind the checkpoint are archived; a failed trim is
+		// repeated by the next page or run
+		trimArchived(ctx, rdb, s.stream, redisclient.NextStreamID(last))
+
+		archived += len(msgs)
+		bytes += recordsBytes(records)
+		if len(msgs) < archivePageSize || stopping(stop) {
+			break
+		}
+		start = "(" + last
+	}
+
+	if archived > 0 {
+		logger.Log.Info("archived stream entries", zap.String("stream", s.stream), zap.Int("entries", archived))
+	}
+	// Archived entries are trimmed, so the stream holds only the backlog
+	if length, err := rdb.Client().XLen(ctx, s.stream).Result(); err == nil {
+		metrics.ArchivalBacklog.WithLabelValues(s.stream).Set(float64(length))
+	}
+	return bytes, nil
+}
+
+// trimArchived trims the archived entries of stream below minID, keeping
+// those another consumer group, such as dbsink or cachepub, has yet to be
+// delivered or acknowledge. XTRIM MINID needs Redis 6.2. A failed trim is
+// only logged.
+func trimArchived(ctx context.Context, rdb *redisclient.Client, stream, minID string) {
+	floor, err := rdb.GroupsFloor(ctx, stream, archivalGroup)
+	if err != nil {
+		logger.Log.Warn("failed to read consumer groups, not trimming archived entries", zap.String("stream", stream), zap.Error(err))
+		return
+	}
+	if floor != "" && redisclient.CompareStreamIDs(floor, minID) < 0 {
+		minID = floor
+	}
+	if err := rdb.Client().XTrimMinID(ctx, stream, minID).Err(); err != nil {
+		logger.Log.Warn("failed to trim archived entries", zap.String("stream", stream), zap.Error(err))
+	}
+}
+
+// streamArchiveRange returns the XRANGE bounds of the entries of stream to
+// archive: those after its checkpoint added before cutoff
+func streamArchiveRange(ctx context.Context, rdb *redisclient.Client, stream string, cutoff time.Time) (string, string, error) {
+	start := "-"
+	checkpoint, err := rdb.Client().HGet(ctx, checkpointsKey, stream).Result()
+	if err != nil && err != redis.Nil {
+		return "", "", fmt.Errorf("failed to read %s checkpoint: %w", stream, err)
+	}
+	if checkpoint != "" {
+		start = "(" + checkpoint
+	}
+	// The end of an XRANGE without a sequence number takes the whole millisecond
+	return start, strconv.FormatInt(cutoff.UnixMilli()-1, 10), nil
+}
+
+// archivingStreams returns the streams whose datasets are archived on the
+// schedules read with interval as the default
+func archivingStreams(interval time.Duration) (map[string]bool, error) {
+	streams := make(map[string]bool)
+	for _, dataset := range archiveDatasets {
+		schedule, err := newDatasetSchedule(dataset, interval)
+		if err != nil {
+			return nil, err
+		}
+		if schedule.After == 0 {
+			continue
+		}
+		if s, ok := archivedStreams[dataset]; ok {
+			streams[s.stream] = true
+		}
+		if dataset == anomalyStream.dataset {
+			streams[anomalyStream.stream] = true
+		}
+	}
+	return streams, nil
+}
+
+// checkTrimPolicies rejects REDIS_STREAM_TRIM count bounds on archived
+// streams: XTRIM MAXLEN cannot be kept from entries not yet archived
+func checkTrimPolicies(policies []redisclient.TrimPolicy, archived map[string]bool) error {
+	for _, policy := range policies {
+		if archived[policy.Stream] && policy.MaxLen > 0 {
+			return fmt.Errorf("REDIS_STREAM_TRIM: %s is archived, so it can only be bounded by age", policy.Stream)
+		}
+	}
+	return nil
+}
+
+// archivalTrimFloor keeps REDIS_STREAM_TRIM from trimming the entries of
+// archived streams after their checkpoint, all of them before the first run
+func archivalTrimFloor(rdb *redisclient.Client, archived map[string]bool) redisclient.TrimFloor {
+	return func(ctx context.Context, stream string) (string, error) {
+		if !archived[stream] {
+			return "", nil
+		}
+		checkpoint, err := rdb.Client().HGet(ctx, checkpointsKey, stream).Result()
+		if err == redis.Nil {
+			return "0-1", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s checkpoint: %w", stream, err)
+		}
+		return redisclient.NextStreamID(checkpoint), nil
+	}
+}
+
+// streamRecord converts a stream entry to an archived record, timestamped
+// by its ts_ms or timestamp field, or by its ID without either
+func streamRecord(msg redis.XMessage) (*database.ArchivedRecord, error) {
+	payload, err := json.Marshal(msg.Values)
+	if err != nil {
+		return nil, err
+	}
+	ticker, _ := msg.Values["ticker"].(string)
+	if ticker == "" {
+		ticker, _ = msg.Values["symbol"].(string)
+	}
+	return &database.ArchivedRecord{ID: msg.ID, Ticker: ticker, Timestamp: entryTimestamp(msg), Payload: payload}, nil
+}
+
+// entryTimestamp returns the time of a stream entry in milliseconds
+func entryTimestamp(msg redis.XMessage) int64 {
+	if v, ok := msg.Values["ts_ms"].(string); ok {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return ms
+		}
+	}
+	if v, ok := msg.Values["timestamp"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UnixMilli()
+		}
+	}
+	return streamIDMillis(msg.ID)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	redismock "github.com/go-redis/redismock/v8"
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/redisclient"
+)
+
+// fakeSink records the batches written to it, failing with err if set
+type fakeSink struct {
+	batches [][]*database.ArchivedRecord
+	err     error
+}
+
+func (f *fakeSink) Name() string {
+	return "fake"
+}
+
+func (f *fakeSink) Write(ctx context.Context, dataset string, records []*database.ArchivedRecord) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.batches = append(f.batches, records)
+	return nil
+}
+
+// archiveTestStream is the stream archived by the tests and their cutoff
+var (
+	archiveTestStream = archivedStream{stream: "normalized:events", dataset: database.ArchiveDatasetQuotes}
+	archiveTestCutoff = time.UnixMilli(5000)
+)
+
+// archiveTestEntries is a page of two entries before the cutoff
+var archiveTestEntries = []redis.XMessage{
+	{ID: "1000-0", Values: map[string]interface{}{"ticker": "AAPL", "ts_ms": "1000"}},
+	{ID: "2000-0", Values: map[string]interface{}{"ticker": "MSFT", "ts_ms": "2000"}},
+}
+
+func TestArchiveStream_CheckpointsBeforeTrimming(t *testing.T) {
+	logger.Log = zap.NewNop()
+	db, mock := redismock.NewClientMock()
+	sink := &fakeSink{}
+
+	mock.ExpectHGet(checkpointsKey, "normalized:events").RedisNil()
+	mock.ExpectXRangeN("normalized:events", "-", "4999", archivePageSize).SetVal(archiveTestEntries)
+	mock.ExpectHSet(checkpointsKey, "normalized:events", "2000-0").SetVal(1)
+	mock.ExpectDo("XINFO", "GROUPS", "normalized:events").SetVal([]interface{}{})
+	mock.ExpectXTrimMinID("normalized:events", "2000-1").SetVal(2)
+	mock.ExpectXLen("normalized:events").SetVal(0)
+
+	if _, err := archiveStream(context.Background(), redisclient.NewFromClient(db), archiveSinks{sink}, archiveTestStream, archiveTestCutoff, nil); err != nil {
+		t.Fatalf("archiveStream: %v", err)
+	}
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 2 {
+		t.Errorf("batches = %v; want one of 2 records", sink.batches)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestArchiveStream_SinkFailureKeepsCheckpointAndEntries(t *testing.T) {
+	logger.Log = zap.NewNop()
+	db, mock := redismock.NewClientMock()
+	sinkErr := errors.New("bucket unavailable")
+
+	// Neither the checkpoint nor XTRIM is expected after the failed write
+	mock.ExpectHGet(checkpointsKey, "normalized:events").SetVal("500-0")
+	mock.ExpectXRangeN("normalized:events", "(500-0", "4999", archivePageSize).SetVal(archiveTestEntries)
+
+	_, err := archiveStream(context.Background(), redisclient.NewFromClient(db), archiveSinks{&fakeSink{err: sinkErr}}, archiveTestStream, archiveTestCutoff, nil)
+	if !errors.Is(err, sinkErr) {
+		t.Fatalf("archiveStream err = %v; want %v", err, sinkErr)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestArchiveStream_TrimKeepsOtherGroupsBacklog(t *testing.T) {
+	logger.Log = zap.NewNop()
+	db, mock := redismock.NewClientMock()
+
+	mock.ExpectHGet(checkpointsKey, "normalized:events").RedisNil()
+	mock.ExpectXRangeN("normalized:events", "-", "4999", archivePageSize).SetVal(archiveTestEntries)
+	mock.ExpectHSet(checkpointsKey, "normalized:events", "2000-0").SetVal(1)
+	mock.ExpectDo("XINFO", "GROUPS", "normalized:events").SetVal([]interface{}{
+		[]interface{}{"name", "archival", "consumers", int64(1), "pending", int64(0), "last-delivered-id", "2000-0"},
+		[]interface{}{"name", "dbsink", "consumers", int64(1), "pending", int64(0), "last-delivered-id", "1000-0"},
+	})
+	mock.ExpectXTrimMinID("normalized:events", "1000-1").SetVal(1)
+	mock.ExpectXLen("normalized:events").SetVal(1)
+
+	if _, err := archiveStream(context.Background(), redisclient.NewFromClient(db), archiveSinks{&fakeSink{}}, archiveTestStream, archiveTestCutoff, nil); err != nil {
+		t.Fatalf("archiveStream: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckTrimPolicies_RejectsCountBoundOnArchivedStream(t *testing.T) {
+	archived := map[string]bool{"normalized:events": true}
+
+	if err := checkTrimPolicies([]redisclient.TrimPolicy{{Stream: "normalized:events", MaxLen: 1000}}, archived); err == nil {
+		t.Error("count bound on an archived stream accepted; want an error")
+	}
+	if err := checkTrimPolicies([]redisclient.TrimPolicy{{Stream: "normalized:events", MaxAge: time.Hour}}, archived); err != nil {
+		t.Errorf("age bound on an archived stream: %v", err)
+	}
+	if err := checkTrimPolicies([]redisclient.TrimPolicy{{Stream: "raw:events", MaxLen: 1000}}, archived); err != nil {
+		t.Errorf("count bound on an unarchived stream: %v", err)
+	}
+}
+
+func TestArchivalTrimFloor_KeepsEntriesAfterCheckpoint(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	floor := archivalTrimFloor(redisclient.NewFromClient(db), map[string]bool{"normalized:events": true, "raw:events": true})
+	ctx := context.Background()
+
+	mock.ExpectHGet(checkpointsKey, "normalized:events").SetVal("2000-3")
+	mock.ExpectHGet(checkpointsKey, "raw:events").RedisNil()
+
+	for _, tt := range []struct {
+		stream string
+		want   string
+	}{
+		{"normalized:events", "2000-4"},
+		{"raw:events", "0-1"},
+		{"anomalies", ""},
+	} {
+		got, err := floor(ctx, tt.stream)
+		if err != nil {
+			t.Fatalf("floor(%s): %v", tt.stream, err)
+		}
+		if got != tt.want {
+			t.Errorf("floor(%s) = %q; want %q", tt.stream, got, tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestEntryTimestamp(t *testing.T) {
+	for _, tt := range []struct {
+		values map[string]interface{}
+		want   int64
+	}{
+		{map[string]interface{}{"ts_ms": "1500"}, 1500},
+		{map[string]interface{}{"timestamp": "1970-01-01T00:00:02Z"}, 2000},
+		{map[string]interface{}{"ticker": "AAPL"}, 3000},
+	} {
+		if got := entryTimestamp(redis.XMessage{ID: "3000-0", Values: tt.values}); got != tt.want {
+			t.Errorf("entryTimestamp(%v) = %d; want %d", tt.values, got, tt.want)
+		}
+	}
+}
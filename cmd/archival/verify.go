@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// archiveDatasets are the datasets the archival service moves out of Redis
+var archiveDatasets = []string{database.ArchiveDatasetQuotes, database.ArchiveDatasetAnomalies, database.ArchiveDatasetRawEvents}
+
+// verify runs the verify command with args and returns its exit code:
+// 0 when every manifest matches what is stored, 1 otherwise
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dataset := fs.String("dataset", "", "dataset to verify (default all)")
+	fromFlag := fs.String("from", "", "verify batches archived from this time, in milliseconds or RFC3339 (default all)")
+	toFlag := fs.String("to", "", "verify batches archived before this time (default now)")
+	timeout := fs.Duration("timeout", 0, "maximum time for the whole verification (0 for none)")
+	fs.Usage = func() { verifyUsage(fs) }
+	fs.Parse(args)
+
+	from, fromErr := parseRestoreTime(*fromFlag, time.UnixMilli(0))
+	until, toErr := parseRestoreTime(*toFlag, time.Now())
+	datasets := archiveDatasets
+	if *dataset != "" {
+		datasets = []string{*dataset}
+	}
+	names, err := sinkNames()
+	if fs.NArg() != 0 || !contains(archiveDatasets, datasets[0]) || fromErr != nil || toErr != nil || !from.Before(until) || err != nil {
+		verifyUsage(fs)
+		return 2
+	}
+
+	if err := logger.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, "logger init error:", err)
+		return 1
+	}
+	defer logger.Log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var checked, failed int
+	report := func(sink, dataset, ref string, problems []string) {
+		checked++
+		if len(problems) > 0 {
+			failed++
+			fmt.Printf("FAIL %s %s %s: %s\n", sink, dataset, ref, strings.Join(problems, "; "))
+		}
+	}
+
+	for _, name := range names {
+		switch name {
+		case "postgres":
+			dbConfig := database.NewConfig()
+			if err := database.WaitForReady(ctx, dbConfig); err != nil {
+				logger.Log.Fatal("failed to connect to database", zap.Error(err))
+			}
+			var db *database.DB
+			db, err = database.New(dbConfig)
+			if err != nil {
+				logger.Log.Fatal("failed to connect to database", zap.Error(err))
+			}
+			defer db.Close()
+			err = verifyPostgresManifests(ctx, database.NewRedisArchiveRepository(db), datasets, from, until, report)
+		case "parquet":
+			var store objectStore
+			store, err = newArchiveStore(ctx)
+			if err == nil {
+				err = verifyParquetManifests(ctx, store, getEnvOrDefault("ARCHIVE_S3_PREFIX", "fin_line"), datasets, from, until, report)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verify: %s: %v\n", name, err)
+			return 1
+		}
+	}
+
+	fmt.Printf("verified %d manifests, %d failed\n", checked, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func verifyUsage(fs *flag.FlagSet) {
+	fmt.Fprintf(fs.Output(), `Usage: archival verify [flags]
+
+Checks every archived batch between --from and --to against its manifest,
+in each sink of ARCHIVE_SINKS: that the redis_archive_* rows a batch saved
+are all still there unchanged, and that each Parquet file is present, has
+its recorded checksum and holds the records its manifest lists. Batches
+failing are printed, and the command exits with status 1 if there are any.
+
+Flags:
+`)
+	fs.PrintDefaults()
+}
+
+// verifyPostgresManifests checks the manifests of datasets overlapping
+// [from, until) against the archive tables
+func verifyPostgresManifests(ctx context.Context, repo database.RedisArchiveRepository, datasets []string, from, until time.Time,
+	report func(sink, dataset, ref string, problems []string)) error {
+	for _, dataset := range datasets {
+		err := repo.ReadArchiveManifests(ctx, dataset, from.UnixMilli(), until.UnixMilli(), func(manifest *database.ArchiveManifest) error {
+			actual, err := repo.CheckArchiveManifest(ctx, manifest)
+			if err != nil {
+				return err
+			}
+
+			var problems []string
+			if actual.Records != manifest.Records {
+				problems = append(problems, fmt.Sprintf("table holds %d records, manifest %d", actual.Records, manifest.Records))
+			}
+			if actual.MinTimestamp != manifest.MinTimestamp || actual.MaxTimestamp != manifest.MaxTimestamp {
+				problems = append(problems, "record timestamps differ")
+			}
+			if actual.Checksum != manifest.Checksum {
+				problems = append(problems, "checksum differs")
+			}
+			report("postgres", dataset, fmt.Sprintf("manifest %d", manifest.ID), problems)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyParquetManifests checks the manifests of the Parquet files of
+// datasets dated in [from, until) against the files
+func verifyParquetManifests(ctx context.Context, store objectStore, prefix string, datasets []string, from, until time.Time,
+	report func(sink, dataset, ref string, problems []string)) error {
+	first := from.UTC().Format("2006-01-02")
+	last := until.UTC().Format("2006-01-02")
+	for _, dataset := range datasets {
+		keys, err := store.List(ctx, path.Join(prefix, dataset)+"/")
+		if err != nil {
+			return fmt.Errorf("failed to list archive files: %w", err)
+		}
+
+		for _, key := range keys {
+			if !strings.HasSuffix(key, manifestSuffix) {
+				continue
+			}
+			if day := keyDate(key); day < first || day > last {
+				continue
+			}
+			problems, err := verifyParquetManifest(ctx, store, key)
+			if err != nil {
+				return err
+			}
+			report("parquet", dataset, strings.TrimSuffix(key, manifestSuffix), problems)
+		}
+	}
+	return nil
+}
+
+// keyDate returns the YYYY-MM-DD of the date= directory of an archive file
+// key
+func keyDate(key string) string {
+	for _, part := range strings.Split(key, "/") {
+		if day, ok := strings.CutPrefix(part, "date="); ok {
+			return day
+		}
+	}
+	return ""
+}
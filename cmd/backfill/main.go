@@ -0,0 +1,242 @@
+// Command backfill replays normalized ticks into the quotes table, to
+// recover after a database incident or to persist the history of a
+// deployment that ran without the database sink.
+//
+//	backfill [flags]                 replay the normalized:events Redis stream
+//	backfill [flags] --file DUMP     replay a dump of the stream instead
+//
+// A dump holds the fields of one stream entry per line as a JSON object,
+// e.g. {"ticker":"AAPL","price":"190.12","ts_ms":"1718000000000","sector":"tech"},
+// and is read gzipped if its name ends in .gz.
+//
+// Replaying is idempotent: a quote already stored for the same ticker and
+// timestamp is left untouched, so a backfill can be rerun, interrupted, or
+// overlap what the sink has already written. Entries are only read, so the
+// sink's consumer group is unaffected.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"go.uber.org/zap"
+)
+
+// options are the command line flags
+type options struct {
+	redisURL string
+	stream   string
+	start    string
+	end      string
+	file     string
+	batch    int
+	dryRun   bool
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.redisURL, "redis", os.Getenv("REDIS_URL"), "Redis connection URL")
+	flag.StringVar(&opts.stream, "stream", "normalized:events", "stream to replay")
+	flag.StringVar(&opts.start, "start", "-", "first stream entry ID to replay")
+	flag.StringVar(&opts.end, "end", "+", "last stream entry ID to replay")
+	flag.StringVar(&opts.file, "file", "", "replay this stream dump instead of Redis")
+	flag.IntVar(&opts.batch, "batch", 1000, "quotes stored per transaction")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "parse and count entries without storing them")
+	timeout := flag.Duration("timeout", 0, "maximum time for the whole backfill (0 for none)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 0 || opts.batch < 1 || (opts.file == "" && opts.redisURL == "") {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := logger.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, "logger init error:", err)
+		os.Exit(1)
+	}
+	defer logger.Log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var repo database.QuoteRepository
+	if !opts.dryRun {
+		dbConfig := database.NewConfig()
+		if err := database.WaitForReady(ctx, dbConfig); err != nil {
+			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		}
+		db, err := database.New(dbConfig)
+		if err != nil {
+			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		}
+		defer db.Close()
+		repo = database.NewQuoteRepository(db)
+	}
+
+	b := &backfiller{repo: repo, batchSize: opts.batch}
+	var err error
+	if opts.file != "" {
+		err = replayFile(ctx, opts.file, b.add)
+	} else {
+		rdb := redisclient.New(opts.redisURL)
+		defer rdb.Close()
+		err = replayStream(ctx, rdb, opts.stream, opts.start, opts.end, int64(opts.batch), b.add)
+	}
+	if err == nil {
+		err = b.flush(ctx)
+	}
+
+	fmt.Printf("read %d entries, skipped %d invalid, inserted %d quotes, %d already stored\n",
+		b.read, b.invalid, b.inserted, b.read-b.invalid-b.inserted)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backfill:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: backfill [flags]
+
+Replays normalized ticks from a Redis stream, or from a dump of one given
+with --file, into the quotes table. Quotes already stored are left as they
+are, so a backfill can safely be run again.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// backfiller collects replayed ticks and stores them in batches
+type backfiller struct {
+	repo      database.QuoteRepository
+	batchSize int
+	pending   []*models.NormalizedTick
+
+	read, invalid, inserted int64
+}
+
+// add queues the tick in the fields of a stream entry, storing the queue
+// once it holds a full batch. Entries that are not valid ticks are logged
+// and skipped.
+func (b *backfiller) add(ctx context.Context, id string, values map[string]interface{}) error {
+	b.read++
+	tick, err := models.HistoricalTickFromMap(values)
+	if err != nil {
+		b.invalid++
+		logger.Log.Warn("skipping invalid entry", zap.String("id", id), zap.Error(err))
+		return nil
+	}
+
+	b.pending = append(b.pending, &tick)
+	if len(b.pending) < b.batchSize {
+		return nil
+	}
+	return b.flush(ctx)
+}
+
+// flush stores the queued ticks
+func (b *backfiller) flush(ctx context.Context) error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	if b.repo != nil {
+		inserted, err := b.repo.BackfillQuotes(ctx, b.pending)
+		if err != nil {
+			return err
+		}
+		b.inserted += inserted
+	}
+	b.pending = b.pending[:0]
+
+	logger.Log.Info("backfill progress", zap.Int64("read", b.read), zap.Int64("inserted", b.inserted))
+	return nil
+}
+
+// replayStream calls fn with every entry of stream between the IDs start
+// and end, reading count entries at a time
+func replayStream(ctx context.Context, rdb *redisclient.Client, stream, start, end string, count int64,
+	fn func(ctx context.Context, id string, values map[string]interface{}) error) error {
+	for {
+		msgs, err := rdb.Client().XRangeN(ctx, stream, start, end, count).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", stream, err)
+		}
+		for _, msg := range msgs {
+			if err := fn(ctx, msg.ID, msg.Values); err != nil {
+				return err
+			}
+		}
+		if int64(len(msgs)) < count {
+			return nil
+		}
+		// Resume after the last entry without the exclusive ranges only
+		// Redis 6.2 understands
+		start = redisclient.NextStreamID(msgs[len(msgs)-1].ID)
+	}
+}
+
+// replayFile calls fn with every entry of the stream dump at path, naming
+// each entry after its line number
+func replayFile(ctx context.Context, path string, fn func(ctx context.Context, id string, values map[string]interface{}) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open dump: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read dump: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var values map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &values); err != nil {
+			// Passed on empty, so it is counted and logged as invalid
+			values = nil
+		}
+		if err := fn(ctx, "line "+strconv.Itoa(line), values); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+	return nil
+}
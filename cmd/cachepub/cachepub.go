@@ -3,103 +3,74 @@ package main
 import (
     "context"
     "encoding/json"
-    "strconv"
+    "os"
     "time"
 
     "github.com/alim08/fin_line/pkg/logger"
     "github.com/alim08/fin_line/pkg/metrics"
     "github.com/alim08/fin_line/pkg/models"
     "github.com/alim08/fin_line/pkg/redisclient"
-    "github.com/go-redis/redis/v8"
     "go.uber.org/zap"
 )
 
-// runCachePub subscribes to normalized events and publishes them to cache & channels.
+// consumerGroup is the Redis consumer group cachepub reads normalized:events
+// with; replicas share the stream, so each tick is published once
+const consumerGroup = "cachepub"
+
+// runCachePub reads normalized events and publishes them to cache & channels.
 func runCachePub(ctx context.Context, rdb *redisclient.Client) {
     logger.Log.Info("cachepub service started")
 
-    // Read from the normalized:events stream
-    lastID := "0-0"
-    
-    for {
-        select {
-        case <-ctx.Done():
-            logger.Log.Info("runCachePub: context cancelled")
-            return
-        default:
-            // Read from normalized:events stream
-            res, err := rdb.Client().XRead(ctx, &redis.XReadArgs{
-                Streams: []string{"normalized:events", lastID},
-                Count:   100,
-                Block:   500 * time.Millisecond,
-            }).Result()
-            
-            if err != nil && err != redis.Nil {
-                logger.Log.Warn("XREAD error", zap.Error(err))
-                time.Sleep(200 * time.Millisecond)
-                continue
-            }
-            
-            if len(res) == 0 || len(res[0].Messages) == 0 {
-                continue
-            }
-            
-            for _, msg := range res[0].Messages {
-                lastID = msg.ID
-                
-                // Parse the normalized tick
-                var tick models.NormalizedTick
-                if ticker, ok := msg.Values["ticker"].(string); ok {
-                    tick.Ticker = ticker
-                }
-                if priceStr, ok := msg.Values["price"].(string); ok {
-                    if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-                        tick.Price = price
-                    }
-                }
-                if tsMs, ok := msg.Values["ts_ms"].(string); ok {
-                    if ts, err := strconv.ParseInt(tsMs, 10, 64); err == nil {
-                        tick.Timestamp = ts
-                    }
-                }
-                if sector, ok := msg.Values["sector"].(string); ok {
-                    tick.Sector = sector
-                }
-                
-                // Process the tick
-                if err := publishTick(ctx, rdb, tick); err != nil {
-                    logger.Log.Error("publishTick failed", zap.Error(err))
-                    metrics.CachePubErrors.Inc()
-                } else {
-                    metrics.CachePubCounter.Inc()
-                }
-            }
+    series := newQuoteSeries(rdb, redisclient.NewTimeSeriesConfig())
+
+    consumer, _ := os.Hostname()
+    reader := redisclient.NewStreamReader(rdb, redisclient.StreamReaderConfig[models.NormalizedTick]{
+        Stream:           "normalized:events",
+        Group:            consumerGroup,
+        Consumer:         consumer,
+        FromMap:          models.NormalizedTickFromMap,
+        DeadLetterStream: "normalized:events:dlq",
+    })
+    err := reader.RunEach(ctx, func(ctx context.Context, entry redisclient.StreamEntry[models.NormalizedTick]) error {
+        tick := entry.Value
+        if err := publishTick(ctx, rdb, tick); err != nil {
+            logger.Log.Error("publishTick failed", zap.Error(err))
+            metrics.CachePubErrors.Inc()
+            return err
         }
+        metrics.CachePubCounter.Inc()
+        series.add(ctx, tick)
+        return nil
+    })
+    if err != nil {
+        logger.Log.Fatal("failed to create consumer group", zap.Error(err))
     }
 }
 
+// publishTickScript updates a ticker's latest-quote hash, bumps the
+// sequence number kept in its seq field and publishes the tick with that
+// number, all atomically: subscribers never see a tick the hash does not
+// hold yet, and sequence numbers follow the order of updates. Its only key
+// is the hash, so it runs on a Redis Cluster too.
+//
+// KEYS[1] is the hash; ARGV holds the price, ts_ms, the channel and the
+// tick's JSON object, to which "seq" is added.
+var publishTickScript = redisclient.RegisterScript("publish_tick", `
+local seq = redis.call('HINCRBY', KEYS[1], 'seq', 1)
+redis.call('HSET', KEYS[1], 'price', ARGV[1], 'ts_ms', ARGV[2])
+redis.call('PUBLISH', ARGV[3], string.sub(ARGV[4], 1, -2) .. ',"seq":' .. seq .. '}')
+return seq
+`)
+
 // publishTick updates the latest-quote hash and publishes on quotes:pubsub.
 func publishTick(ctx context.Context, rdb *redisclient.Client, tick models.NormalizedTick) error {
-    // 1) Prepare Redis pipeline for atomicity & performance
-    pipe := rdb.Client().Pipeline()
-
-    // 2) Update hash: HSET quotes:latest:<ticker>
-    hashKey := "quotes:latest:" + tick.Ticker
-    pipe.HSet(ctx, hashKey, map[string]interface{}{
-        "price": tick.Price,
-        "ts_ms": tick.Timestamp,
-    })
-
-    // 3) Publish full JSON payload for subscribers
     payload, _ := json.Marshal(tick) // error unlikely; tick is well-typed
-    pipe.Publish(ctx, "quotes:pubsub", payload)
 
-    // 4) Execute pipeline with timeout
+    // Run the script with timeout
     execCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
     defer cancel()
 
-    if _, err := pipe.Exec(execCtx); err != nil {
-        return err
-    }
-    return nil
+    _, err := rdb.RunScript(execCtx, publishTickScript, []string{redisclient.LatestQuoteKey(tick.Ticker)},
+        tick.Price, tick.Timestamp, "quotes:pubsub", payload)
+    return err
 }
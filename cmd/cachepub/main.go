@@ -10,6 +10,7 @@ import (
     "github.com/alim08/fin_line/pkg/config"
     "github.com/alim08/fin_line/pkg/logger"
     "github.com/alim08/fin_line/pkg/redisclient"
+    "go.uber.org/zap"
 )
 
 func main() {
@@ -29,6 +30,11 @@ func main() {
     rdb := redisclient.New(cfg.RedisURL)
     defer rdb.Close()
 
+    // Preload the Lua scripts; they are sent in full on first use otherwise
+    if err := rdb.LoadScripts(context.Background()); err != nil {
+        logger.Log.Warn("failed to load Redis scripts", zap.Error(err))
+    }
+
     // 4. Launch cache-pub processor
     ctx, cancel := context.WithCancel(context.Background())
     go runCachePub(ctx, rdb)
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "context"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/models"
+    "github.com/alim08/fin_line/pkg/redisclient"
+    "go.uber.org/zap"
+)
+
+// quoteSeries appends ticks to the per-ticker RedisTimeSeries series the
+// API serves sparklines from. It creates each ticker's series on its first
+// tick and turns itself off if Redis lacks the RedisTimeSeries module.
+type quoteSeries struct {
+    rdb     *redisclient.Client
+    cfg     redisclient.TimeSeriesConfig
+    created map[string]bool
+}
+
+// newQuoteSeries returns nil when the series are not enabled
+func newQuoteSeries(rdb *redisclient.Client, cfg redisclient.TimeSeriesConfig) *quoteSeries {
+    if !cfg.Enabled {
+        return nil
+    }
+    logger.Log.Info("maintaining quote time series",
+        zap.Duration("retention", cfg.Retention),
+        zap.Duration("bucket", cfg.Bucket),
+        zap.Duration("bucket_retention", cfg.BucketRetention))
+    return &quoteSeries{rdb: rdb, cfg: cfg, created: make(map[string]bool)}
+}
+
+// add appends tick to its ticker's series. Failures are logged only: the
+// series are a cache, and the latest-quote hash was already updated.
+func (s *quoteSeries) add(ctx context.Context, tick models.NormalizedTick) {
+    if s == nil || !s.cfg.Enabled || tick.Ticker == "" {
+        return
+    }
+
+    execCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+    defer cancel()
+
+    if !s.created[tick.Ticker] {
+        if err := s.rdb.CreateQuoteSeries(execCtx, tick.Ticker, s.cfg); err != nil {
+            s.fail(tick.Ticker, err)
+            return
+        }
+        s.created[tick.Ticker] = true
+    }
+
+    if err := s.rdb.TSAdd(execCtx, redisclient.QuoteSeriesKey(tick.Ticker), tick.Timestamp, tick.Price); err != nil {
+        // Check the series and its rule again on the next tick
+        delete(s.created, tick.Ticker)
+        s.fail(tick.Ticker, err)
+    }
+}
+
+// fail logs err, turning the series off if Redis cannot hold them at all
+func (s *quoteSeries) fail(ticker string, err error) {
+    if redisclient.IsUnknownCommand(err) {
+        logger.Log.Error("Redis lacks the RedisTimeSeries module, quote time series disabled", zap.Error(err))
+        s.cfg.Enabled = false
+        s.created = nil
+        return
+    }
+    logger.Log.Warn("failed to update quote time series", zap.String("ticker", ticker), zap.Error(err))
+}
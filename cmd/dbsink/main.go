@@ -0,0 +1,73 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/config"
+    "github.com/alim08/fin_line/pkg/database"
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/redisclient"
+    "go.uber.org/zap"
+)
+
+func main() {
+    // 1. Load configuration
+    cfg, err := config.Load()
+    if err != nil {
+        panic("config load error: " + err.Error())
+    }
+
+    // 2. Initialize structured logging
+    if err := logger.Init(); err != nil {
+        panic("logger init error: " + err.Error())
+    }
+    defer logger.Log.Sync()
+
+    // 3. Connect to Redis and Postgres; the API owns migrations
+    rdb := redisclient.New(cfg.RedisURL)
+    defer rdb.Close()
+
+    dbConfig := database.NewConfig()
+    if err := database.WaitForReady(context.Background(), dbConfig); err != nil {
+        logger.Log.Fatal("failed to connect to database", zap.Error(err))
+    }
+    db, err := database.New(dbConfig)
+    if err != nil {
+        logger.Log.Fatal("failed to connect to database", zap.Error(err))
+    }
+    defer db.Close()
+
+    quoteRepo := database.NewQuoteRepository(db)
+    rawEventRepo := database.NewRawEventRepository(db)
+
+    // 4. One consumer per stream; several dbsink replicas share the work
+    consumer, _ := os.Hostname()
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{}, 2)
+    for _, s := range []sinkStream{rawEventStream(rawEventRepo), quoteStream(quoteRepo)} {
+        go func(s sinkStream) {
+            runSink(ctx, rdb, s, consumer, cfg.BatchSize)
+            done <- struct{}{}
+        }(s)
+    }
+
+    // 5. Graceful shutdown on SIGINT/SIGTERM; an unacknowledged batch is
+    // redelivered on restart
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+    <-stop
+
+    logger.Log.Info("shutdown signal received, exiting")
+    cancel()
+    for i := 0; i < 2; i++ {
+        select {
+        case <-done:
+        case <-time.After(5 * time.Second):
+            return
+        }
+    }
+}
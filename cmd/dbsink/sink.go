@@ -0,0 +1,100 @@
+package main
+
+import (
+    "context"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/database"
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/metrics"
+    "github.com/alim08/fin_line/pkg/models"
+    "github.com/alim08/fin_line/pkg/redisclient"
+    "go.uber.org/zap"
+)
+
+// consumerGroup is the Redis consumer group the sink reads streams with, so
+// it tracks its own position independently of cachepub and anomaly
+const consumerGroup = "dbsink"
+
+// retryBackoff is how long to wait before retrying a batch Postgres rejected
+const retryBackoff = time.Second
+
+// sinkStream reads a Redis stream and persists it in batches of up to
+// batchSize until ctx is done
+type sinkStream struct {
+    name string
+    run  func(ctx context.Context, rdb *redisclient.Client, consumer string, batchSize int) error
+}
+
+// rawEventStream persists raw:events to raw_events
+func rawEventStream(repo database.RawEventRepository) sinkStream {
+    return newSinkStream("raw:events", func(m map[string]interface{}) (*models.RawTick, error) {
+        event, err := models.RawTickFromMap(m)
+        if err != nil {
+            return nil, err
+        }
+        event.Sanitize()
+        return &event, event.Validate()
+    }, repo.SaveRawEvents)
+}
+
+// quoteStream persists normalized:events to quotes
+func quoteStream(repo database.QuoteRepository) sinkStream {
+    return newSinkStream("normalized:events", func(m map[string]interface{}) (*models.NormalizedTick, error) {
+        tick, err := models.NormalizedTickFromMap(m)
+        if err != nil {
+            return nil, err
+        }
+        tick.Sanitize()
+        return &tick, tick.Validate()
+    }, repo.SaveQuotes)
+}
+
+// newSinkStream binds stream to the repository call persisting its decoded
+// entries. Entries are acknowledged only once stored, so a crash or a
+// Postgres outage redelivers them; delivery is at least once. Entries that
+// can never be stored, such as malformed ticks, go to <stream>:dlq.
+func newSinkStream[T any](name string, fromMap func(map[string]interface{}) (T, error), save func(ctx context.Context, items []T) error) sinkStream {
+    return sinkStream{
+        name: name,
+        run: func(ctx context.Context, rdb *redisclient.Client, consumer string, batchSize int) error {
+            reader := redisclient.NewStreamReader(rdb, redisclient.StreamReaderConfig[T]{
+                Stream:       name,
+                Group:        consumerGroup,
+                Consumer:     consumer,
+                Start:        "0",
+                Count:        int64(batchSize),
+                RetryBackoff: retryBackoff,
+                // A failed batch means Postgres is unavailable, not that its
+                // entries are bad, which FromMap already rules out
+                MaxDeliveries:    -1,
+                FromMap:          fromMap,
+                DeadLetterStream: name + ":dlq",
+            })
+            return reader.Run(ctx, func(ctx context.Context, entries []redisclient.StreamEntry[T]) error {
+                start := time.Now()
+                defer func() {
+                    metrics.DBSinkLatency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+                }()
+
+                items := make([]T, len(entries))
+                for i, entry := range entries {
+                    items[i] = entry.Value
+                }
+                if err := save(ctx, items); err != nil {
+                    metrics.DBSinkErrors.WithLabelValues(name).Inc()
+                    return err
+                }
+                metrics.DBSinkCounter.WithLabelValues(name).Add(float64(len(items)))
+                return nil
+            })
+        },
+    }
+}
+
+// runSink persists s until ctx is done
+func runSink(ctx context.Context, rdb *redisclient.Client, s sinkStream, consumer string, batchSize int) {
+    if err := s.run(ctx, rdb, consumer, batchSize); err != nil {
+        logger.Log.Fatal("failed to create consumer group", zap.String("stream", s.name), zap.Error(err))
+    }
+}
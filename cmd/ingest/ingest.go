@@ -3,6 +3,8 @@ package main
 import (
     "context"
     "strings"
+    "sync/atomic"
+    "time"
 
     "github.com/alim08/fin_line/pkg/logger"
     "github.com/alim08/fin_line/pkg/metrics"
@@ -10,9 +12,20 @@ import (
     "go.uber.org/zap"
 )
 
-func ingestFeed(ctx context.Context, rdb *redisclient.Client, feedURL string) {
+// feedHealthKey is a hash of feed URL -> time (ms) of its last ingested event,
+// read by the API health endpoint
+const feedHealthKey = "feeds:health"
+
+// heartbeatInterval throttles feedHealthKey writes per feed
+const heartbeatInterval = time.Second
+
+// ingestFeed reads feedURL into raw:events. A non-nil throttle drops the
+// events it does not allow.
+func ingestFeed(ctx context.Context, rdb *redisclient.Client, feedURL string, throttle *feedThrottle) {
     logger.Log.Info("starting ingestFeed", zap.String("url", feedURL))
 
+    var lastBeat int64 // unix ms of the last heartbeat, shared by writers
+
     // 1. Buffer up to 1k events before blocking the reader
     events := make(chan map[string]interface{}, 1000)
 
@@ -28,12 +41,24 @@ func ingestFeed(ctx context.Context, rdb *redisclient.Client, feedURL string) {
                     if !ok {
                         return
                     }
+                    if !throttle.allow() {
+                        metrics.IngestThrottled.Inc()
+                        continue
+                    }
                     if err := rdb.AddToStream(ctx, "raw:events", evt); err != nil {
                         logger.Log.Warn("stream write failed", zap.Error(err))
                         metrics.IngestErrors.Inc()
                         continue
                     }
                     metrics.IngestCounter.Inc()
+
+                    now := time.Now().UnixMilli()
+                    last := atomic.LoadInt64(&lastBeat)
+                    if now-last >= heartbeatInterval.Milliseconds() && atomic.CompareAndSwapInt64(&lastBeat, last, now) {
+                        if err := rdb.Client().HSet(ctx, feedHealthKey, feedURL, now).Err(); err != nil {
+                            logger.Log.Warn("feed heartbeat failed", zap.Error(err))
+                        }
+                    }
                 }
             }
         }(i)
@@ -37,13 +37,25 @@ func main() {
     // 4. Start Prometheus metrics endpoint
     go startMetricsServer(8082) // Use default metrics port
 
-    // 5. Launch one ingestFeed per URL
+    // 5. Follow the archival backpressure signal for low priority feeds
     ctx, cancel := context.WithCancel(context.Background())
-    for _, feed := range cfg.FeedURLs {
-        go ingestFeed(ctx, rdb, feed)
+    throttledRate, err := throttledRate()
+    if err != nil {
+        panic("config error: " + err.Error())
+    }
+    watcher := redisclient.NewBackpressureWatcher(rdb)
+    go watcher.Run(ctx)
+
+    // 6. Launch one ingestFeed per feed
+    for _, feed := range cfg.Feeds {
+        var throttle *feedThrottle
+        if feed.Priority == config.FeedPriorityLow {
+            throttle = &feedThrottle{watcher: watcher, rate: throttledRate}
+        }
+        go ingestFeed(ctx, rdb, feed.URL, throttle)
     }
 
-    // 6. Wait for shutdown signal
+    // 7. Wait for shutdown signal
     sigs := make(chan os.Signal, 1)
     signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
     <-sigs
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/redisclient"
+)
+
+// feedThrottle limits a low priority feed to rate events per second while
+// the pipeline is under backpressure, dropping the rest so Redis keeps
+// room for the high priority feeds until archival catches up
+type feedThrottle struct {
+    watcher *redisclient.BackpressureWatcher
+    rate    int
+
+    mu     sync.Mutex
+    window int64 // unix second the count is for
+    count  int
+}
+
+// throttledRate reads INGEST_THROTTLED_RATE, the events per second a low
+// priority feed may still write under backpressure; 0 pauses it
+func throttledRate() (int, error) {
+    value := os.Getenv("INGEST_THROTTLED_RATE")
+    if value == "" {
+        return 0, nil
+    }
+    rate, err := strconv.Atoi(value)
+    if err != nil || rate < 0 {
+        return 0, fmt.Errorf("invalid INGEST_THROTTLED_RATE: must be a non-negative integer")
+    }
+    return rate, nil
+}
+
+// allow reports whether an event may be written. A nil throttle, that of
+// a high priority feed, allows every event.
+func (t *feedThrottle) allow() bool {
+    if t == nil || !t.watcher.Active() {
+        return true
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if now := time.Now().Unix(); now != t.window {
+        t.window, t.count = now, 0
+    }
+    if t.count >= t.rate {
+        return false
+    }
+    t.count++
+    return true
+}
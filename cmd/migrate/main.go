@@ -0,0 +1,242 @@
+// Command migrate manages the Postgres schema outside of API startup.
+//
+//	migrate [flags] up              apply all pending migrations
+//	migrate [flags] down [N]        roll back the last N applied migrations (default 1)
+//	migrate [flags] goto VERSION    migrate up or down to VERSION (0 rolls back everything)
+//	migrate [flags] status          list migrations, when they were applied and
+//	                                whether their files changed since
+//
+// With --dry-run the SQL of each step is printed instead of executed.
+//
+// In schema tenancy mode up, status and encrypt-secrets cover public and the
+// schema of every tenant in DB_TENANT_SCHEMAS; --tenant limits a command to
+// one tenant's schema, and down and goto act on public unless it is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the SQL of each step instead of executing it")
+	timeout := flag.Duration("timeout", 10*time.Minute, "maximum time for the whole command")
+	tenantID := flag.String("tenant", "", "run the command against this tenant's schema only")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := logger.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, "logger init error:", err)
+		os.Exit(1)
+	}
+	defer logger.Log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	dbConfig := database.NewConfig()
+	if err := database.WaitForReady(ctx, dbConfig); err != nil {
+		logger.Log.Fatal("failed to connect to database", zap.Error(err))
+	}
+	db, err := database.New(dbConfig)
+	if err != nil {
+		logger.Log.Fatal("failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	targets, err := migrationTargets(db, flag.Arg(0), *tenantID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		db.Close()
+		os.Exit(2)
+	}
+	for _, id := range targets {
+		if len(targets) > 1 {
+			fmt.Printf("== %s\n", schemaName(id))
+		}
+		if err := run(tenant.WithTenant(ctx, id), db, flag.Args(), *dryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %s: %v\n", schemaName(id), err)
+			db.Close()
+			os.Exit(1)
+		}
+	}
+}
+
+// migrationTargets returns the tenants whose schemas command runs against:
+// the one named by --tenant, every migrated schema for the commands that
+// cover them all, or public
+func migrationTargets(db *database.DB, command, tenantID string) ([]string, error) {
+	tenants := db.MigrationTenants()
+	if tenantID != "" {
+		for _, id := range tenants {
+			if id == tenantID {
+				return []string{id}, nil
+			}
+		}
+		return nil, fmt.Errorf("tenant %q has no schema of its own", tenantID)
+	}
+
+	switch command {
+	case "up", "status", "encrypt-secrets":
+		return tenants, nil
+	default:
+		return []string{tenant.Default}, nil
+	}
+}
+
+// schemaName returns the schema holding the tables of tenant id
+func schemaName(id string) string {
+	if id == tenant.Default {
+		return "public"
+	}
+	return database.TenantSchema(id)
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: migrate [flags] <command>
+
+Commands:
+  up              apply all pending migrations
+  down [N]        roll back the last N applied migrations (default 1)
+  goto VERSION    migrate up or down to VERSION (0 rolls back everything)
+  status          list migrations, when they were applied and whether
+                  their files changed since
+  encrypt-secrets encrypt webhook secrets stored before DB_SECRET_KEY
+                  was set
+
+In schema tenancy mode up, status and encrypt-secrets run against public
+and every tenant schema, down and goto against public; --tenant selects a
+single tenant's schema instead.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// run executes the command in args
+func run(ctx context.Context, db *database.DB, args []string, dryRun bool) error {
+	command, args := args[0], args[1:]
+
+	var steps []database.MigrationStep
+	var err error
+	switch command {
+	case "status":
+		if len(args) != 0 {
+			return fmt.Errorf("status takes no arguments")
+		}
+		return printStatus(ctx, db)
+	case "encrypt-secrets":
+		if len(args) != 0 {
+			return fmt.Errorf("encrypt-secrets takes no arguments")
+		}
+		if dryRun {
+			return fmt.Errorf("encrypt-secrets has no dry run")
+		}
+		encrypted, err := db.EncryptWebhookSecrets(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("encrypted %d webhook secrets\n", encrypted)
+		return nil
+	case "up":
+		if len(args) != 0 {
+			return fmt.Errorf("up takes no arguments")
+		}
+		steps, err = db.PlanMigrateUp(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			return fmt.Errorf("down takes at most one argument")
+		}
+		if len(args) == 1 {
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+		}
+		steps, err = db.PlanRollback(ctx, n)
+	case "goto":
+		if len(args) != 1 {
+			return fmt.Errorf("goto takes exactly one argument")
+		}
+		version, convErr := strconv.Atoi(args[0])
+		if convErr != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		steps, err = db.PlanMigrateTo(ctx, version)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(steps) == 0 {
+		fmt.Println("nothing to do")
+		return nil
+	}
+	if dryRun {
+		printSteps(steps)
+		return nil
+	}
+	if err := db.ApplyMigrationSteps(ctx, steps); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		fmt.Printf("%s %d %s\n", direction(step), step.Migration.Version, step.Migration.Description)
+	}
+	return nil
+}
+
+// printStatus lists every migration with whether and when it was applied
+func printStatus(ctx context.Context, db *database.DB) error {
+	status, err := db.GetMigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get migration status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED\tAPPLIED AT\tDRIFTED\tDESCRIPTION")
+	for _, ms := range status {
+		appliedAt := "-"
+		if ms.Applied {
+			appliedAt = ms.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%t\t%s\t%t\t%s\n", ms.Version, ms.Applied, appliedAt, ms.Drifted, ms.Description)
+	}
+	return w.Flush()
+}
+
+// printSteps prints the SQL each step would execute
+func printSteps(steps []database.MigrationStep) {
+	for _, step := range steps {
+		fmt.Printf("-- %s %d: %s\n", direction(step), step.Migration.Version, step.Migration.Description)
+		fmt.Println(step.SQL())
+	}
+}
+
+func direction(step database.MigrationStep) string {
+	if step.Down {
+		return "down"
+	}
+	return "up"
+}
@@ -10,6 +10,7 @@ import (
     "github.com/alim08/fin_line/pkg/config"
     "github.com/alim08/fin_line/pkg/logger"
     "github.com/alim08/fin_line/pkg/redisclient"
+    "go.uber.org/zap"
 )
 
 func main() {
@@ -32,8 +33,15 @@ func main() {
     sigs := make(chan os.Signal, 1)
     signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+    // Load reference data published by the API and keep it current
+    ref := newReferenceData()
+    if err := ref.load(ctx, rdb); err != nil {
+        logger.Log.Warn("failed to load reference data, using defaults", zap.Error(err))
+    }
+    go watchReferenceData(ctx, rdb, ref)
+
     // Start normalization workers
-    go startNormalization(ctx, rdb)
+    go startNormalization(ctx, rdb, ref)
 
     // Block until signal
     <-sigs
@@ -0,0 +1,137 @@
+package main
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/redisclient"
+    "github.com/go-redis/redis/v8"
+    "go.uber.org/zap"
+)
+
+const (
+    // referenceTickersKey is the hash (symbol -> sector) maintained by the API
+    referenceTickersKey = "reference:tickers"
+    // referencePublishedKey is set by the API once it has published referenceTickersKey
+    referencePublishedKey = "reference:tickers:published"
+    // referenceUpdatesChannel is published by the API after every reference data change
+    referenceUpdatesChannel = "reference:updates"
+    // referenceRefreshInterval reloads reference data in case an update was missed
+    referenceRefreshInterval = time.Minute
+)
+
+// referenceData holds the symbol and sector mappings used by normalizeOne.
+// It starts from the built-in symbolMap/sectorMap and is replaced by the
+// reference:tickers hash once the API has published it.
+type referenceData struct {
+    mu      sync.RWMutex
+    symbols map[string]string // raw symbol -> ticker
+    sectors map[string]string // ticker -> sector
+}
+
+func newReferenceData() *referenceData {
+    ref := &referenceData{
+        symbols: make(map[string]string, len(symbolMap)),
+        sectors: make(map[string]string, len(sectorMap)),
+    }
+    for k, v := range symbolMap {
+        ref.symbols[k] = v
+    }
+    for k, v := range sectorMap {
+        ref.sectors[k] = v
+    }
+    return ref
+}
+
+// lookup maps a raw symbol to its ticker and sector
+func (r *referenceData) lookup(symbol string) (ticker, sector string, ok bool) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    ticker, ok = r.symbols[symbol]
+    if !ok {
+        return "", "", false
+    }
+    return ticker, r.sectors[ticker], true
+}
+
+// load replaces the mappings with the contents of reference:tickers. The
+// built-in symbolMap aliases are kept for tickers that are still listed.
+// Until the API has published the hash the current mappings are kept; once
+// it has, an empty hash means there are no active tickers.
+func (r *referenceData) load(ctx context.Context, rdb *redisclient.Client) error {
+    var data *redis.StringStringMapCmd
+    var published *redis.IntCmd
+    _, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+        data = pipe.HGetAll(ctx, referenceTickersKey)
+        published = pipe.Exists(ctx, referencePublishedKey)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    if len(data.Val()) == 0 && published.Val() == 0 {
+        return nil
+    }
+
+    symbols, sectors := buildReferenceMaps(data.Val())
+
+    r.mu.Lock()
+    r.symbols = symbols
+    r.sectors = sectors
+    r.mu.Unlock()
+
+    logger.Log.Info("reference data loaded", zap.Int("tickers", len(sectors)), zap.Int("symbols", len(symbols)))
+    return nil
+}
+
+// buildReferenceMaps maps every ticker of tickers (ticker -> sector) to
+// itself, plus the symbolMap aliases of those tickers
+func buildReferenceMaps(tickers map[string]string) (symbols, sectors map[string]string) {
+    symbols = make(map[string]string, len(tickers)+len(symbolMap))
+    sectors = make(map[string]string, len(tickers))
+    for ticker, sector := range tickers {
+        symbols[ticker] = ticker
+        sectors[ticker] = sector
+    }
+    for raw, ticker := range symbolMap {
+        if _, listed := tickers[ticker]; !listed {
+            continue
+        }
+        if _, taken := symbols[raw]; !taken {
+            symbols[raw] = ticker
+        }
+    }
+    return symbols, sectors
+}
+
+// watchReferenceData reloads reference data on every reference:updates
+// message, after updates may have been missed while Redis was unreachable,
+// and periodically as a fallback.
+func watchReferenceData(ctx context.Context, rdb *redisclient.Client, ref *referenceData) {
+    // Without a subscription the periodic refresh alone keeps data current
+    var updates <-chan redisclient.Message
+    if sub, err := rdb.SubscribeManaged(ctx, referenceUpdatesChannel); err != nil {
+        logger.Log.Warn("failed to subscribe to reference updates", zap.Error(err))
+    } else {
+        defer sub.Close()
+        updates = sub.Channel()
+    }
+
+    refresh := time.NewTicker(referenceRefreshInterval)
+    defer refresh.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-updates:
+        case <-refresh.C:
+        }
+
+        if err := ref.load(ctx, rdb); err != nil {
+            logger.Log.Warn("failed to reload reference data", zap.Error(err))
+        }
+    }
+}
@@ -2,99 +2,89 @@ package main
 
 import (
     "context"
+    "fmt"
+    "os"
+    "sync"
     "time"
 
     "github.com/alim08/fin_line/pkg/logger"
     "github.com/alim08/fin_line/pkg/metrics"
     "github.com/alim08/fin_line/pkg/models"
     "github.com/alim08/fin_line/pkg/redisclient"
-    "github.com/go-redis/redis/v8"
     "go.uber.org/zap"
 )
 
-// symbolMap could be loaded from config or DB; here's a stub.
+// symbolMap seeds the reference data until the API publishes reference:tickers.
 var symbolMap = map[string]string{
     "BTCUSD": "BTCUSD",
     // add more mappings...
 }
 
-// sectorMap stub
+// sectorMap seeds the reference data until the API publishes reference:tickers.
 var sectorMap = map[string]string{
     "BTCUSD": "crypto",
     // add more...
 }
 
-// Limits concurrent Normalize handlers
-const maxWorkers = 50
+// consumerGroup is the Redis consumer group normalizers read raw:events
+// with, so replicas share the stream and resume where they stopped
+const consumerGroup = "normalize"
 
-func startNormalization(ctx context.Context, rdb *redisclient.Client) {
-    logger.Log.Info("normalization worker started")
-    sem := make(chan struct{}, maxWorkers)
-    lastID := "0-0" // start reading from the very beginning
-
-    for {
-        // 1) Read up to 100 messages, wait up to 500ms
-        res, err := rdb.Client().XRead(ctx, &redis.XReadArgs{
-            Streams: []string{"raw:events", lastID},
-            Count:   100,
-            Block:   500 * time.Millisecond,
-        }).Result()
-        if err != nil && err != redis.Nil {
-            logger.Log.Warn("XREAD error", zap.Error(err))
-            time.Sleep(200 * time.Millisecond) // simple backoff
-            continue
-        }
-
-        if len(res) == 0 || len(res[0].Messages) == 0 {
-            continue
-        }
-
-        // 2) Process each message in parallel (bounded)
-        for _, msg := range res[0].Messages {
-            lastID = msg.ID // advance our cursor
+// consumers is how many group consumers each normalizer runs, bounding the
+// ticks normalized concurrently
+const consumers = 8
 
-            select {
-            case sem <- struct{}{}:
-                go func(m redis.XMessage) {
-                    defer func() { <-sem }()
-                    normalizeOne(ctx, rdb, m)
-                }(msg)
-            default:
-                // Worker pool full: drop oldest to keep up
-                logger.Log.Warn("normalize pool full, dropping message", zap.String("id", msg.ID))
-                metrics.NormalizeErrors.Inc()
+// startNormalization normalizes raw:events into normalized:events until ctx
+// is done. Raw events that fail to parse or name an unknown symbol go to
+// raw:events:dlq.
+func startNormalization(ctx context.Context, rdb *redisclient.Client, ref *referenceData) {
+    logger.Log.Info("normalization worker started")
+    host, _ := os.Hostname()
+
+    var wg sync.WaitGroup
+    for i := 0; i < consumers; i++ {
+        reader := redisclient.NewStreamReader(rdb, redisclient.StreamReaderConfig[models.RawTick]{
+            Stream:           "raw:events",
+            Group:            consumerGroup,
+            Consumer:         fmt.Sprintf("%s-%d", host, i),
+            FromMap:          models.RawTickFromMap,
+            DeadLetterStream: "raw:events:dlq",
+        })
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            err := reader.RunEach(ctx, func(ctx context.Context, entry redisclient.StreamEntry[models.RawTick]) error {
+                return normalizeOne(ctx, rdb, ref, entry.Value)
+            })
+            if err != nil {
+                logger.Log.Fatal("failed to create consumer group", zap.Error(err))
             }
-        }
+        }()
     }
+    wg.Wait()
 }
 
-func normalizeOne(ctx context.Context, rdb *redisclient.Client, msg redis.XMessage) {
+// normalizeOne maps raw to a NormalizedTick and appends it to
+// normalized:events
+func normalizeOne(ctx context.Context, rdb *redisclient.Client, ref *referenceData, raw models.RawTick) error {
     start := time.Now()
-    defer metrics.NormalizeLatency.Observe(time.Since(start).Seconds())
-
-    // 1) Convert raw map → typed RawTick
-    raw, err := models.RawTickFromMap(msg.Values)
-    if err != nil {
-        logger.Log.Warn("raw parse error", zap.String("id", msg.ID), zap.Error(err))
-        metrics.NormalizeErrors.Inc()
-        return
-    }
+    defer func() {
+        metrics.NormalizeLatency.Observe(time.Since(start).Seconds())
+    }()
 
-    // 2) Symbol mapping
-    ticker, ok := symbolMap[raw.Symbol]
+    // 1) Symbol mapping & sector lookup from reference data
+    ticker, sector, ok := ref.lookup(raw.Symbol)
     if !ok {
-        logger.Log.Warn("unknown symbol", zap.String("symbol", raw.Symbol))
         metrics.NormalizeErrors.Inc()
-        return
+        return redisclient.Permanent(fmt.Errorf("unknown symbol %q", raw.Symbol))
     }
 
-    // 3) Lookup sector (fallback to "unknown")
-    sector := sectorMap[ticker]
+    // 2) Fallback sector to "unknown"
     if sector == "" {
         sector = "unknown"
     }
 
-    // 4) Build NormalizedTick
+    // 3) Build NormalizedTick
     norm := models.NormalizedTick{
         Ticker:    ticker,
         Price:     raw.Price,
@@ -102,11 +92,12 @@ func normalizeOne(ctx context.Context, rdb *redisclient.Client, msg redis.XMessa
         Sector:    sector,
     }
 
-    // 5) Write to normalized:events
+    // 4) Write to normalized:events; a failure redelivers the raw event
     if err := rdb.AddToStream(ctx, "normalized:events", norm.ToMap()); err != nil {
         logger.Log.Error("failed to write normalized event", zap.Error(err))
         metrics.NormalizeErrors.Inc()
-        return
+        return err
     }
     metrics.NormalizeCounter.Inc()
+    return nil
 }
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// APIKeyHeader carries an API key as an alternative to a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyUserPrefix prefixes the UserID of claims built from an API key, so
+// keys never collide with user accounts as resource owners
+const apiKeyUserPrefix = "apikey:"
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, revoked and expired API keys
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyUnavailable is returned when API keys cannot be looked up
+	ErrAPIKeyUnavailable = errors.New("api key store unavailable")
+)
+
+// APIKeyStore looks up live API keys by the hash of the presented key
+type APIKeyStore interface {
+	UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+// SetAPIKeyStore makes AuthMiddleware accept API keys from store in the
+// APIKeyHeader
+func (a *AuthService) SetAPIKeyStore(store APIKeyStore) {
+	a.apiKeys = store
+}
+
+// AuthenticateAPIKey looks up an API key and returns claims granted exactly
+// its scopes as permissions in its tenant. Keys get no roles and none of the
+// policy's default permissions.
+func (a *AuthService) AuthenticateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	if a.apiKeys == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := a.apiKeys.UseAPIKey(ctx, HashAPIKey(key))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPIKeyUnavailable, err)
+	}
+
+	return &Claims{
+		UserID:      apiKeyUserPrefix + apiKey.Prefix,
+		Username:    apiKey.Name,
+		TenantID:    apiKey.TenantID,
+		Permissions: apiKey.Scopes,
+	}, nil
+}
+
+// NewAPIKey returns a random API key, its public prefix and the hash to
+// store for it. Keys look like fl_<prefix>_<secret>.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	p := make([]byte, 4)
+	s := make([]byte, 32)
+	if _, err := rand.Read(p); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	if _, err := rand.Read(s); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	prefix = "fl_" + hex.EncodeToString(p)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(s)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of an API key
+func HashAPIKey(key string) string {
+	return HashRefreshToken(key)
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// fakeAPIKeyStore holds API keys by the hash of the key
+type fakeAPIKeyStore struct {
+	keys map[string]*models.APIKey
+}
+
+func (f *fakeAPIKeyStore) UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	key, ok := f.keys[keyHash]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return key, nil
+}
+
+func TestAuthenticateAPIKey_GrantsOnlyScopes(t *testing.T) {
+	service := newTestService(t)
+	key, prefix, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") {
+		t.Fatalf("key %q does not start with prefix %q", key, prefix)
+	}
+	service.SetAPIKeyStore(&fakeAPIKeyStore{keys: map[string]*models.APIKey{
+		hash: {Name: "reader", Prefix: prefix, TenantID: "acme", Scopes: []string{PermQuotesRead}},
+	}})
+
+	claims, err := service.AuthenticateAPIKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey: %v", err)
+	}
+	if claims.Tenant() != "acme" {
+		t.Errorf("tenant = %q; want acme", claims.Tenant())
+	}
+	if !claims.HasPermission(PermQuotesRead) || claims.HasPermission(PermAnomaliesRead) {
+		t.Errorf("permissions = %v; want exactly the key's scopes", claims.Permissions)
+	}
+	if len(claims.Roles) != 0 {
+		t.Errorf("roles = %v; want none", claims.Roles)
+	}
+}
+
+func TestAuthenticateAPIKey_RejectsUnknownKey(t *testing.T) {
+	service := newTestService(t)
+	service.SetAPIKeyStore(&fakeAPIKeyStore{})
+
+	key, _, _, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	if _, err := service.AuthenticateAPIKey(context.Background(), key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey err = %v; want %v", err, ErrInvalidAPIKey)
+	}
+}
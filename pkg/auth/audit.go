@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// auditQueueSize bounds the events waiting to be written; a burst beyond
+	// it, such as a credential stuffing run against a slow sink, is dropped
+	// rather than allowed to stall requests
+	auditQueueSize = 1024
+	// auditWriteTimeout bounds writing a single event to the sink
+	auditWriteTimeout = 5 * time.Second
+)
+
+// AuditSink stores authentication and authorization events
+type AuditSink interface {
+	RecordAuthEvent(ctx context.Context, event *models.AuthEvent) error
+}
+
+// SetAuditSink makes the service record auth events to sink. Events are
+// written in the background by a single worker.
+func (a *AuthService) SetAuditSink(sink AuditSink) {
+	events := make(chan *models.AuthEvent, auditQueueSize)
+	go func() {
+		for event := range events {
+			ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+			if err := sink.RecordAuthEvent(ctx, event); err != nil {
+				metrics.AuthErrors.WithLabelValues("audit").Inc()
+				logger.Log.Error("failed to record auth event", zap.String("type", event.Type), zap.Error(err))
+			}
+			cancel()
+		}
+	}()
+	a.audit = events
+}
+
+// Audit records an auth event about request r. principal and tenantID may
+// be empty when the caller is unknown. It never blocks.
+func (a *AuthService) Audit(r *http.Request, eventType, principal, tenantID, detail string) {
+	if a.audit == nil {
+		return
+	}
+
+	event := &models.AuthEvent{
+		Type:      eventType,
+		Principal: principal,
+		TenantID:  tenantID,
+		IP:        r.RemoteAddr,
+		Method:    r.Method,
+		Route:     r.URL.Path,
+		Detail:    detail,
+	}
+	select {
+	case a.audit <- event:
+	default:
+		metrics.AuthErrors.WithLabelValues("audit").Inc()
+		logger.Log.Warn("auth audit queue full; dropping event", zap.String("type", eventType), zap.String("principal", principal))
+	}
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minHMACSecretLength is the shortest HS256 secret accepted, matching the
+// 256-bit output of the hash
+const minHMACSecretLength = 32
+
+// signingMethods are the methods local tokens may be signed with
+var signingMethods = []jwt.SigningMethod{
+	jwt.SigningMethodRS256,
+	jwt.SigningMethodES256,
+	jwt.SigningMethodEdDSA,
+	jwt.SigningMethodHS256,
+}
+
+// signingKeys holds the method and keys local tokens are signed and
+// verified with
+type signingKeys struct {
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// loadSigningKeys resolves the keys for config.SigningMethod. Keys given
+// inline in the environment take precedence over key files.
+func loadSigningKeys(config *Config) (*signingKeys, error) {
+	var method jwt.SigningMethod
+	for _, m := range signingMethods {
+		if strings.EqualFold(m.Alg(), config.SigningMethod) {
+			method = m
+		}
+	}
+
+	switch method {
+	case nil:
+		return nil, fmt.Errorf("unsupported signing method %q", config.SigningMethod)
+
+	case jwt.SigningMethodHS256:
+		secret := []byte(config.Secret)
+		if config.Secret == "" && config.SecretPath != "" {
+			data, err := readFile(config.SecretPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read secret file: %w", err)
+			}
+			secret = []byte(strings.TrimSpace(string(data)))
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("HS256 requires JWT_SECRET or JWT_SECRET_FILE")
+		}
+		if len(secret) < minHMACSecretLength {
+			return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minHMACSecretLength)
+		}
+		return &signingKeys{method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+
+	default:
+		privatePEM, err := keyPEM(config.PrivateKeyPEM, config.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		privateKey, err := parsePrivateKey(privatePEM)
+		if err != nil {
+			return nil, err
+		}
+
+		// The public key is derived from the private key unless given
+		publicKey := privateKey.Public()
+		if config.PublicKeyPEM != "" || fileExists(config.PublicKeyPath) {
+			publicPEM, err := keyPEM(config.PublicKeyPEM, config.PublicKeyPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read public key: %w", err)
+			}
+			if publicKey, err = parsePublicKey(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := checkKeyType(method, privateKey.Public()); err != nil {
+			return nil, fmt.Errorf("private key: %w", err)
+		}
+		if err := checkKeyType(method, publicKey); err != nil {
+			return nil, fmt.Errorf("public key: %w", err)
+		}
+
+		return &signingKeys{method: method, sign: privateKey, verify: publicKey}, nil
+	}
+}
+
+// keyPEM returns the PEM given inline, or else the contents of path
+func keyPEM(inline, path string) ([]byte, error) {
+	if inline != "" {
+		return decodeEnvPEM(inline), nil
+	}
+	return readFile(path)
+}
+
+// decodeEnvPEM accepts a PEM block as-is, with its newlines escaped as \n
+// (as .env files and container platforms often require), or base64 encoded
+func decodeEnvPEM(value string) []byte {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(strings.ReplaceAll(value, `\n`, "\n"))
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value)); err == nil {
+		return decoded
+	}
+	return []byte(value)
+}
+
+// parsePrivateKey parses a PEM encoded private key: PKCS #1 RSA, SEC 1 EC
+// or PKCS #8 of any supported type
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// parsePublicKey parses a PKCS #1 RSA or PKIX PEM encoded public key
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return key, nil
+}
+
+// checkKeyType reports whether key suits method: RSA for RS256, P-256 for
+// ES256 and Ed25519 for EdDSA
+func checkKeyType(method jwt.SigningMethod, key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if method == jwt.SigningMethodRS256 {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if method == jwt.SigningMethodES256 {
+			if k.Curve != elliptic.P256() {
+				return fmt.Errorf("ES256 requires a P-256 key, got %s", k.Curve.Params().Name)
+			}
+			return nil
+		}
+	case ed25519.PublicKey:
+		if method == jwt.SigningMethodEdDSA {
+			return nil
+		}
+	}
+	return fmt.Errorf("%T cannot be used with %s", key, method.Alg())
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/logger"
+)
+
+// pkcs8PEM encodes key as a PKCS #8 PEM block
+func pkcs8PEM(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestNewAuthService_SignsWithKeyPairMethods(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for method, key := range map[string]crypto.Signer{"ES256": ecKey, "EdDSA": edKey} {
+		service, err := NewAuthService(&Config{SigningMethod: method, PrivateKeyPEM: pkcs8PEM(t, key), Issuer: "fin-line", Audience: "fin-line-api", Expiration: time.Minute})
+		if err != nil {
+			t.Fatalf("%s: NewAuthService: %v", method, err)
+		}
+		token, err := service.GenerateToken("1", "alice", "alice@example.com", nil)
+		if err != nil {
+			t.Fatalf("%s: GenerateToken: %v", method, err)
+		}
+		claims, err := service.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("%s: ValidateToken: %v", method, err)
+		}
+		if claims.Username != "alice" {
+			t.Errorf("%s: username = %q; want alice", method, claims.Username)
+		}
+	}
+}
+
+func TestNewAuthService_RejectsMismatchedKey(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if _, err := NewAuthService(&Config{SigningMethod: "ES256", PrivateKeyPEM: pkcs8PEM(t, edKey)}); err == nil {
+		t.Error("NewAuthService accepted an Ed25519 key for ES256")
+	}
+}
+
+func TestNewAuthService_RejectsShortHMACSecret(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	if _, err := NewAuthService(&Config{SigningMethod: "HS256", Secret: strings.Repeat("s", minHMACSecretLength-1)}); err == nil {
+		t.Error("NewAuthService accepted a short HS256 secret")
+	}
+}
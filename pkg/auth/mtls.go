@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// ServicePrincipalPrefix prefixes the UserID of internal services, whether
+// authenticated by client certificate or service token
+const ServicePrincipalPrefix = "service:"
+
+// MTLSConfig configures TLS for the API server and authentication of
+// internal services by client certificate
+type MTLSConfig struct {
+	// CertFile and KeyFile hold the server's certificate; TLS is off when empty
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the CAs client certificates must chain to; client
+	// certificates are not requested when empty
+	ClientCAFile string
+	// RequireClientCert rejects connections without a verified client
+	// certificate. Otherwise certificates are optional and callers without
+	// one authenticate with tokens or API keys as usual.
+	RequireClientCert bool
+	// ServiceIdentities maps certificate SANs (DNS names or URIs such as
+	// spiffe://fin-line/alerter) to service names
+	ServiceIdentities map[string]string
+}
+
+// newMTLSConfig reads the TLS configuration from environment variables
+func newMTLSConfig() MTLSConfig {
+	return MTLSConfig{
+		CertFile:          getEnvOrDefault("API_TLS_CERT_FILE", ""),
+		KeyFile:           getEnvOrDefault("API_TLS_KEY_FILE", ""),
+		ClientCAFile:      getEnvOrDefault("API_TLS_CLIENT_CA_FILE", ""),
+		RequireClientCert: getEnvOrDefault("API_TLS_CLIENT_AUTH", "") == "require",
+		ServiceIdentities: parseServiceIdentities(getEnvOrDefault("MTLS_SERVICE_IDENTITIES", "")),
+	}
+}
+
+// parseServiceIdentities parses "san=service,san=service" pairs
+func parseServiceIdentities(s string) map[string]string {
+	identities := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		// URI SANs contain ':' and '/', so split on the last '='
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			continue
+		}
+		san, service := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if san == "" || service == "" {
+			continue
+		}
+		identities[san] = strings.ToLower(service)
+	}
+	return identities
+}
+
+// Enabled reports whether the server should serve TLS
+func (c MTLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// ServerTLSConfig builds the server side TLS configuration, verifying client
+// certificates against ClientCAFile when it is set. The server certificate
+// itself is passed to ListenAndServeTLS.
+func (c MTLSConfig) ServerTLSConfig() (*tls.Config, error) {
+	if !c.Enabled() {
+		return nil, errors.New("tls requires a certificate and key file")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile == "" {
+		if c.RequireClientCert {
+			return nil, errors.New("requiring client certificates needs a client CA file")
+		}
+		return tlsConfig, nil
+	}
+
+	pem, err := readFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("client CA file contains no certificates")
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// AuthenticateCertificate maps the verified client certificate of r to a
+// service identity. It reports false when the connection carries no verified
+// certificate or none of its SANs names a known service.
+//
+// Services act on the default tenant with the role named after the service,
+// so AUTH_POLICY_FILE can grant each one its own permissions.
+func (a *AuthService) AuthenticateCertificate(r *http.Request) (*Claims, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(a.services) == 0 {
+		return nil, false
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	sans := append([]string(nil), leaf.DNSNames...)
+	for _, uri := range leaf.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	for _, san := range sans {
+		service, ok := a.services[san]
+		if !ok {
+			continue
+		}
+		roles := []string{service}
+		return &Claims{
+			UserID:      ServicePrincipalPrefix + service,
+			Username:    service,
+			Roles:       roles,
+			TenantID:    tenant.Default,
+			Permissions: a.policy.Permissions(roles),
+		}, true
+	}
+	return nil, false
+}
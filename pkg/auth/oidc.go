@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched signing keys are trusted before
+	// the key set is fetched again
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval rate-limits refetches triggered by tokens signed
+	// with an unknown key ID
+	jwksMinRefreshInterval = time.Minute
+	// jwksFetchTimeout bounds discovery and JWKS requests
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// OIDCConfig configures validation of tokens issued by an external OpenID
+// Connect provider such as Okta, Keycloak or Auth0
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL exactly as it appears in the iss
+	// claim (Auth0 keeps a trailing slash); OIDC validation is off when empty
+	Issuer string
+	// Audience is the client ID tokens must be issued for; required with an
+	// issuer, as a provider signs tokens for all of its clients with the
+	// same keys
+	Audience string
+	// JWKSURL overrides the jwks_uri found through issuer discovery
+	JWKSURL string
+	// GroupsClaim names the claim listing the user's IdP groups
+	GroupsClaim string
+	// TenantClaim optionally names a claim carrying the user's tenant
+	TenantClaim string
+	// RoleMapping maps IdP groups to fin_line roles
+	RoleMapping map[string][]string
+}
+
+// newOIDCConfig reads the OIDC configuration from environment variables
+func newOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		Issuer:      getEnvOrDefault("OIDC_ISSUER", ""),
+		Audience:    getEnvOrDefault("OIDC_AUDIENCE", ""),
+		JWKSURL:     getEnvOrDefault("OIDC_JWKS_URL", ""),
+		GroupsClaim: getEnvOrDefault("OIDC_GROUPS_CLAIM", "groups"),
+		TenantClaim: getEnvOrDefault("OIDC_TENANT_CLAIM", ""),
+		RoleMapping: parseRoleMapping(getEnvOrDefault("OIDC_ROLE_MAPPING", "")),
+	}
+}
+
+// parseRoleMapping parses "group=role,group=role" pairs. A group may be
+// listed more than once to grant several roles.
+func parseRoleMapping(s string) map[string][]string {
+	mapping := make(map[string][]string)
+	for _, pair := range strings.Split(s, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || group == "" || role == "" {
+			continue
+		}
+		mapping[group] = append(mapping[group], strings.ToLower(role))
+	}
+	return mapping
+}
+
+// oidcValidator validates RS256 tokens against a provider's published keys
+type oidcValidator struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu        sync.RWMutex
+	jwksURL   string
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// newOIDCValidator creates a validator for config. Keys are fetched on first use.
+func newOIDCValidator(config OIDCConfig) *oidcValidator {
+	return &oidcValidator{
+		config:  config,
+		client:  &http.Client{Timeout: jwksFetchTimeout},
+		jwksURL: config.JWKSURL,
+	}
+}
+
+// validate verifies tokenString and maps its claims to fin_line claims
+func (v *oidcValidator) validate(tokenString string) (*Claims, error) {
+	start := time.Now()
+	defer func() {
+		metrics.AuthOperationDuration.WithLabelValues("validate_oidc_token", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(v.config.Issuer),
+		jwt.WithAudience(v.config.Audience),
+		jwt.WithExpirationRequired(),
+	}
+
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mapClaims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.key(kid)
+	}, opts...)
+	if err != nil {
+		metrics.AuthOperationDuration.WithLabelValues("validate_oidc_token", "error").Observe(time.Since(start).Seconds())
+		metrics.AuthErrors.WithLabelValues("validate_oidc_token").Inc()
+		return nil, fmt.Errorf("failed to parse oidc token: %w", err)
+	}
+
+	if stringClaim(mapClaims, "sub") == "" {
+		metrics.AuthOperationDuration.WithLabelValues("validate_oidc_token", "error").Observe(time.Since(start).Seconds())
+		metrics.AuthErrors.WithLabelValues("validate_oidc_token").Inc()
+		return nil, errors.New("oidc token has no subject")
+	}
+
+	metrics.AuthOperations.WithLabelValues("validate_oidc_token", "success").Inc()
+	return v.claims(mapClaims), nil
+}
+
+// OIDCUserID returns the user ID of the subject of an OIDC provider's
+// tokens, namespaced by the provider's issuer so it can never be taken for
+// a local user's ID or another provider's subject. Issuers cannot contain a
+// fragment, so the ID is unambiguous.
+func OIDCUserID(issuer, subject string) string {
+	return issuer + "#" + subject
+}
+
+// claims maps a provider's claims to fin_line claims. Groups without a
+// mapping grant no roles.
+func (v *oidcValidator) claims(mapClaims jwt.MapClaims) *Claims {
+	claims := &Claims{
+		UserID:   OIDCUserID(v.config.Issuer, stringClaim(mapClaims, "sub")),
+		Username: stringClaim(mapClaims, "preferred_username"),
+		Email:    stringClaim(mapClaims, "email"),
+	}
+	if claims.Username == "" {
+		claims.Username = claims.Email
+	}
+	if v.config.TenantClaim != "" {
+		claims.TenantID = stringClaim(mapClaims, v.config.TenantClaim)
+	}
+
+	seen := make(map[string]bool)
+	for _, group := range stringsClaim(mapClaims, v.config.GroupsClaim) {
+		for _, role := range v.config.RoleMapping[group] {
+			if !seen[role] {
+				seen[role] = true
+				claims.Roles = append(claims.Roles, role)
+			}
+		}
+	}
+
+	claims.ID = stringClaim(mapClaims, "jti")
+	claims.Issuer = stringClaim(mapClaims, "iss")
+	if exp, err := mapClaims.GetExpirationTime(); err == nil {
+		claims.ExpiresAt = exp
+	}
+	return claims
+}
+
+// key returns the provider's signing key with ID kid, refetching the key set
+// when it is stale or does not contain kid
+func (v *oidcValidator) key(kid string) (*rsa.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fetchedAt := v.fetchedAt
+	v.mu.RUnlock()
+
+	stale := time.Since(fetchedAt) > jwksRefreshInterval
+	if ok && !stale {
+		return key, nil
+	}
+	if !ok && !stale && time.Since(fetchedAt) < jwksMinRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	if err := v.refresh(ctx); err != nil {
+		if ok {
+			// Keep trusting a known key while the provider is unreachable
+			logger.Log.Warn("failed to refresh oidc signing keys", zap.Error(err))
+			return key, nil
+		}
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jwk is a single key of a JSON Web Key Set
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// refresh fetches the provider's key set, discovering its URL first if needed
+func (v *oidcValidator) refresh(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Record the attempt up front so a failing provider is not hammered
+	v.fetchedAt = time.Now()
+
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, strings.TrimSuffix(v.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("oidc discovery failed: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("oidc discovery document has no jwks_uri")
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &set); err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.rsaPublicKey()
+		if err != nil {
+			logger.Log.Warn("skipping malformed jwk", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks contains no RSA signing keys")
+	}
+
+	v.keys = keys
+	logger.Log.Info("oidc signing keys refreshed", zap.String("jwks_url", v.jwksURL), zap.Int("keys", len(keys)))
+	return nil
+}
+
+// getJSON fetches url and decodes its JSON body into dst
+func (v *oidcValidator) getJSON(ctx context.Context, url string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// rsaPublicKey decodes the key's base64url modulus and exponent
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// stringClaim returns a string claim, or "" if it is missing or not a string
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim returns a claim holding a list of strings. A single string is
+// treated as a one-element list, as some providers emit it that way.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// tokenIssuer returns the unverified iss claim of tokenString, used to pick
+// the validator before the signature is checked
+func tokenIssuer(tokenString string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return ""
+	}
+	return stringClaim(claims, "iss")
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/logger"
+)
+
+const testOIDCIssuer = "https://idp.example.com"
+
+// newTestOIDCValidator returns a validator for audience fin-line-api whose
+// provider signs with the returned key
+func newTestOIDCValidator(t *testing.T) (*oidcValidator, *rsa.PrivateKey) {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	jwks := map[string]interface{}{"keys": []map[string]string{{
+		"kid": "k1",
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return newOIDCValidator(OIDCConfig{Issuer: testOIDCIssuer, Audience: "fin-line-api", JWKSURL: server.URL}), key
+}
+
+// signOIDCToken signs a provider token for subject and audience
+func signOIDCToken(t *testing.T, key *rsa.PrivateKey, subject, audience string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": testOIDCIssuer,
+		"sub": subject,
+		"aud": audience,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestNewAuthService_RequiresOIDCAudience(t *testing.T) {
+	logger.Log = zap.NewNop()
+	_, err := NewAuthService(&Config{OIDC: OIDCConfig{Issuer: testOIDCIssuer}})
+	if err == nil {
+		t.Fatal("NewAuthService accepted an OIDC issuer without an audience")
+	}
+}
+
+func TestOIDCValidate_RejectsOtherAudience(t *testing.T) {
+	validator, key := newTestOIDCValidator(t)
+
+	if _, err := validator.validate(signOIDCToken(t, key, "1", "another-app")); err == nil {
+		t.Error("validate accepted a token issued for another client")
+	}
+}
+
+func TestOIDCValidate_NamespacesSubject(t *testing.T) {
+	validator, key := newTestOIDCValidator(t)
+
+	claims, err := validator.validate(signOIDCToken(t, key, "1", "fin-line-api"))
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if want := testOIDCIssuer + "#1"; claims.UserID != want {
+		t.Errorf("UserID = %q; want %q", claims.UserID, want)
+	}
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Permissions are "<resource>:<action>" strings. A grant of "<resource>:*"
+// covers every action on a resource and "*" covers everything.
+const (
+	PermQuotesRead      = "quotes:read"
+	PermAnomaliesRead   = "anomalies:read"
+	PermAnomaliesWrite  = "anomalies:write"
+	PermWebhooksRead    = "webhooks:read"
+	PermWebhooksWrite   = "webhooks:write"
+	PermWatchlistsRead  = "watchlists:read"
+	PermWatchlistsWrite = "watchlists:write"
+	// PermAdminFeeds covers raw events and ticker and sector reference data
+	PermAdminFeeds = "admin:feeds"
+	// PermAdminDetector covers the anomaly detector configuration
+	PermAdminDetector = "admin:detector"
+	// PermAdminAnomalies covers restoring, acknowledging and auditing
+	// anomalies, and deleting other users' manual anomalies
+	PermAdminAnomalies = "admin:anomalies"
+	// PermAdminAuth covers access token revocation and API keys
+	PermAdminAuth = "admin:auth"
+	// PermAdminUsers covers user accounts, their roles and sessions
+	PermAdminUsers = "admin:users"
+	// PermAdminTenants lets a caller act on other tenants via TenantHeader
+	PermAdminTenants = "admin:tenants"
+	// PermAdminSystem covers migrations and runtime diagnostics
+	PermAdminSystem = "admin:system"
+	// PermAdminArchive covers reading data archived out of Redis
+	PermAdminArchive = "admin:archive"
+)
+
+// Policy maps roles to the permissions they grant
+type Policy struct {
+	// Default is granted to every authenticated user regardless of roles
+	Default []string `json:"default"`
+	// Roles lists the permissions each role grants on top of Default
+	Roles map[string][]string `json:"roles"`
+}
+
+// DefaultPolicy returns the built-in policy: every user may read market
+// data and manage their own anomalies, webhooks and watchlists, and admins
+// may do everything
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Default: []string{
+			PermQuotesRead,
+			PermAnomaliesRead,
+			PermAnomaliesWrite,
+			PermWebhooksRead,
+			PermWebhooksWrite,
+			PermWatchlistsRead,
+			PermWatchlistsWrite,
+		},
+		Roles: map[string][]string{
+			"admin": {"*"},
+		},
+	}
+}
+
+// LoadPolicy reads a JSON policy such as
+//
+//	{"default": ["quotes:read"], "roles": {"admin": ["*"], "analyst": ["anomalies:*"]}}
+//
+// An empty path yields DefaultPolicy.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+
+	data, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	return &policy, nil
+}
+
+// Permissions returns the deduplicated permissions roles are granted
+func (p *Policy) Permissions(roles []string) []string {
+	seen := make(map[string]bool)
+	var permissions []string
+	add := func(granted []string) {
+		for _, permission := range granted {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	add(p.Default)
+	for _, role := range roles {
+		add(p.Roles[role])
+	}
+	return permissions
+}
+
+// RolePermissions returns the permissions the service's policy grants roles
+func (a *AuthService) RolePermissions(roles []string) []string {
+	return a.policy.Permissions(roles)
+}
+
+// grants reports whether granted covers permission, honouring wildcards
+func grants(granted, permission string) bool {
+	if granted == "*" || granted == permission {
+		return true
+	}
+	if resource, ok := strings.CutSuffix(granted, ":*"); ok {
+		return strings.HasPrefix(permission, resource+":")
+	}
+	return false
+}
+
+// HasPermission checks if the user was granted permission
+func (c *Claims) HasPermission(permission string) bool {
+	for _, granted := range c.Permissions {
+		if grants(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllPermissions checks if the user was granted every one of permissions
+func (c *Claims) HasAllPermissions(permissions ...string) bool {
+	for _, permission := range permissions {
+		if !c.HasPermission(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanGrant returns ErrPermissionNotHeld for the first of permissions c does
+// not hold itself, so nothing c hands out (tokens, API key scopes, roles)
+// carries more rights than c has
+func (c *Claims) CanGrant(permissions ...string) error {
+	for _, permission := range permissions {
+		if !c.HasPermission(permission) {
+			return fmt.Errorf("%w: %s", ErrPermissionNotHeld, permission)
+		}
+	}
+	return nil
+}
+
+// PermissionMiddleware creates middleware that requires all of permissions.
+// It must run after AuthMiddleware.
+func (a *AuthService) PermissionMiddleware(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			defer func() {
+				metrics.AuthMiddlewareDuration.Observe(time.Since(start).Seconds())
+			}()
+
+			user, ok := FromContext(r.Context())
+			if !ok {
+				metrics.AuthMiddlewareErrors.WithLabelValues("no_user_context").Inc()
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !user.HasAllPermissions(permissions...) {
+				logger.Log.Warn("insufficient permissions",
+					zap.String("user_id", user.UserID),
+					zap.Strings("user_permissions", user.Permissions),
+					zap.Strings("required_permissions", permissions))
+				metrics.AuthMiddlewareErrors.WithLabelValues("insufficient_permissions").Inc()
+				a.Audit(r, models.AuthEventPermissionDenied, user.UserID, user.Tenant(), "requires "+strings.Join(permissions, ", "))
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			metrics.AuthMiddlewareSuccess.Inc()
+		})
+	}
+}
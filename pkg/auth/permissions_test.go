@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanGrant(t *testing.T) {
+	caller := &Claims{Permissions: []string{"quotes:*", PermAdminAuth}}
+
+	for _, tc := range []struct {
+		permissions []string
+		held        bool
+	}{
+		{[]string{PermQuotesRead}, true},
+		{[]string{"quotes:*", PermAdminAuth}, true},
+		{[]string{PermQuotesRead, PermAnomaliesRead}, false},
+		{[]string{"*"}, false},
+		{[]string{"admin:*"}, false},
+	} {
+		err := caller.CanGrant(tc.permissions...)
+		if tc.held && err != nil {
+			t.Errorf("CanGrant(%v) = %v; want nil", tc.permissions, err)
+		}
+		if !tc.held && !errors.Is(err, ErrPermissionNotHeld) {
+			t.Errorf("CanGrant(%v) = %v; want %v", tc.permissions, err, ErrPermissionNotHeld)
+		}
+	}
+}
+
+func TestHasPermission_Wildcards(t *testing.T) {
+	claims := &Claims{Permissions: []string{"quotes:*", PermAnomaliesRead}}
+
+	for permission, want := range map[string]bool{
+		PermQuotesRead:     true,
+		"quotes:write":     true,
+		PermAnomaliesRead:  true,
+		PermAdminAnomalies: false,
+		"quotesx:read":     false,
+		"quotes":           false,
+	} {
+		if got := claims.HasPermission(permission); got != want {
+			t.Errorf("HasPermission(%q) = %v; want %v", permission, got, want)
+		}
+	}
+}
+
+func TestPermissionMiddleware_RequiresEveryPermission(t *testing.T) {
+	service := newTestService(t)
+	handler := service.PermissionMiddleware(PermQuotesRead, PermAdminUsers)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		claims *Claims
+		want   int
+	}{
+		{nil, http.StatusUnauthorized},
+		{&Claims{UserID: "1", Permissions: []string{PermQuotesRead}}, http.StatusForbidden},
+		{&Claims{UserID: "1", Permissions: []string{PermQuotesRead, "admin:*"}}, http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.claims != nil {
+			r = r.WithContext(SetUser(r.Context(), tc.claims))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("claims %+v: status = %d; want %d", tc.claims, w.Code, tc.want)
+		}
+	}
+}
+
+func TestResolveTenant_OtherTenantNeedsTenantAdmin(t *testing.T) {
+	user := &Claims{UserID: "1", TenantID: "acme"}
+	if got, err := ResolveTenant(user, ""); err != nil || got != "acme" {
+		t.Errorf("ResolveTenant(own) = %q, %v; want acme", got, err)
+	}
+	if _, err := ResolveTenant(user, "globex"); !errors.Is(err, ErrTenantDenied) {
+		t.Errorf("ResolveTenant(other) err = %v; want %v", err, ErrTenantDenied)
+	}
+
+	admin := &Claims{UserID: "2", TenantID: "acme", Permissions: []string{PermAdminTenants}}
+	if got, err := ResolveTenant(admin, "globex"); err != nil || got != "globex" {
+		t.Errorf("ResolveTenant(admin, other) = %q, %v; want globex", got, err)
+	}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/redisclient"
+	"github.com/go-redis/redis/v8"
+)
+
+// revokedTokenPrefix prefixes the Redis key recording a revoked token ID
+const revokedTokenPrefix = "auth:revoked:"
+
+var (
+	// ErrTokenRevoked is returned for tokens revoked before their expiry
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrRevocationUnavailable is returned when the revocation list cannot be
+	// consulted; tokens are rejected rather than trusted blindly
+	ErrRevocationUnavailable = errors.New("token revocation list unavailable")
+)
+
+// RevocationStore records revoked token IDs (jti) until the tokens expire
+type RevocationStore interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// redisRevocationStore keeps one key per revoked token, expiring together
+// with the token so the list never outgrows the live tokens
+type redisRevocationStore struct {
+	redis *redisclient.Client
+}
+
+// NewRedisRevocationStore creates a RevocationStore backed by Redis
+func NewRedisRevocationStore(redisClient *redisclient.Client) RevocationStore {
+	return &redisRevocationStore{redis: redisClient}
+}
+
+// Revoke records jti as revoked until expiresAt. Already expired tokens are
+// not recorded.
+func (s *redisRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.redis.Client().Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err()
+}
+
+// IsRevoked reports whether jti has been revoked
+func (s *redisRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	err := s.redis.Client().Get(ctx, revokedTokenPrefix+jti).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetRevocationStore makes Authenticate reject tokens revoked in store
+func (a *AuthService) SetRevocationStore(store RevocationStore) {
+	a.revocations = store
+}
+
+// Authenticate validates a token and checks that it has not been revoked
+func (a *AuthService) Authenticate(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := a.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued before jti claims were added cannot be revoked
+	if a.revocations == nil || claims.ID == "" {
+		return claims, nil
+	}
+
+	revoked, err := a.revocations.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRevocationUnavailable, err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// RevokeToken revokes a token for the rest of its lifetime
+func (a *AuthService) RevokeToken(ctx context.Context, claims *Claims) error {
+	if a.revocations == nil {
+		return ErrRevocationUnavailable
+	}
+	if claims.ID == "" {
+		return fmt.Errorf("token has no jti claim")
+	}
+
+	expiresAt := time.Now().Add(a.expiration)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return a.revocations.Revoke(ctx, claims.ID, expiresAt)
+}
+
+// RevokeTokenID revokes the token with ID jti. Its expiry is unknown, so it
+// stays revoked for the longest lifetime a token can have: that of access
+// tokens, or MaxServiceTokenTTL for service tokens if longer.
+func (a *AuthService) RevokeTokenID(ctx context.Context, jti string) error {
+	if a.revocations == nil {
+		return ErrRevocationUnavailable
+	}
+	ttl := a.expiration
+	if ttl < MaxServiceTokenTTL {
+		ttl = MaxServiceTokenTTL
+	}
+	return a.revocations.Revoke(ctx, jti, time.Now().Add(ttl))
+}
+
+// newTokenID returns a random jti
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/logger"
+)
+
+// fakeRevocationStore keeps revoked token IDs and their expiry in memory
+type fakeRevocationStore struct {
+	revoked map[string]time.Time
+}
+
+func (f *fakeRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if f.revoked == nil {
+		f.revoked = make(map[string]time.Time)
+	}
+	f.revoked[jti] = expiresAt
+	return nil
+}
+
+func (f *fakeRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	expiresAt, ok := f.revoked[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// newTestService returns an HS256 service with the default policy
+func newTestService(t *testing.T) *AuthService {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	service, err := NewAuthService(&Config{
+		SigningMethod: "HS256",
+		Secret:        strings.Repeat("s", 32),
+		Issuer:        "fin-line",
+		Audience:      "fin-line-api",
+		Expiration:    15 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	return service
+}
+
+func TestRevokeTokenID_OutlivesServiceTokens(t *testing.T) {
+	service := newTestService(t)
+	store := &fakeRevocationStore{}
+	service.SetRevocationStore(store)
+
+	issuer := &Claims{UserID: "1", Permissions: []string{"*"}}
+	token, claims, err := service.GenerateServiceToken(issuer, "archival", []string{PermAdminArchive}, MaxServiceTokenTTL)
+	if err != nil {
+		t.Fatalf("GenerateServiceToken: %v", err)
+	}
+
+	if err := service.RevokeTokenID(context.Background(), claims.ID); err != nil {
+		t.Fatalf("RevokeTokenID: %v", err)
+	}
+	if until := store.revoked[claims.ID]; until.Before(claims.ExpiresAt.Time) {
+		t.Errorf("revoked until %s; want at least the token's expiry %s", until, claims.ExpiresAt.Time)
+	}
+	if _, err := service.Authenticate(context.Background(), token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Authenticate err = %v; want %v", err, ErrTokenRevoked)
+	}
+}
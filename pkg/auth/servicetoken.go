@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	// DefaultServiceTokenTTL is the lifetime of service tokens minted without one
+	DefaultServiceTokenTTL = 15 * time.Minute
+	// MaxServiceTokenTTL caps the lifetime of service tokens; components are
+	// expected to mint new ones rather than hold long-lived credentials
+	MaxServiceTokenTTL = 24 * time.Hour
+)
+
+// serviceNamePattern restricts service names to short lowercase slugs
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// ErrPermissionNotHeld is returned when minting a token, API key or role
+// assignment with a permission the issuer does not hold itself
+var ErrPermissionNotHeld = errors.New("permission not held by issuer")
+
+// GenerateServiceToken mints a token for an internal component such as the
+// archival or alerter service. The token carries exactly permissions rather
+// than roles, and issuer must hold every one of them so minting never
+// escalates privileges. The service acts on issuer's tenant.
+func (a *AuthService) GenerateServiceToken(issuer *Claims, service string, permissions []string, ttl time.Duration) (string, *Claims, error) {
+	if !serviceNamePattern.MatchString(service) {
+		return "", nil, fmt.Errorf("invalid service name %q", service)
+	}
+	if len(permissions) == 0 {
+		return "", nil, errors.New("at least one permission is required")
+	}
+	if err := issuer.CanGrant(permissions...); err != nil {
+		return "", nil, err
+	}
+	if ttl <= 0 {
+		ttl = DefaultServiceTokenTTL
+	}
+	if ttl > MaxServiceTokenTTL {
+		return "", nil, fmt.Errorf("ttl must not exceed %s", MaxServiceTokenTTL)
+	}
+
+	claims := &Claims{
+		UserID:      ServicePrincipalPrefix + service,
+		Username:    service,
+		TenantID:    issuer.Tenant(),
+		Permissions: permissions,
+	}
+	token, err := a.signToken("generate_service_token", claims, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
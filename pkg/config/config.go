@@ -14,8 +14,16 @@ type Feed struct {
     Type         string // "websocket" or "http"
     PollInterval time.Duration
     APIKey       string
+    // Priority is "high" or "low"; low priority feeds are throttled while
+    // the pipeline is under backpressure
+    Priority     string
 }
 
+const (
+    FeedPriorityHigh = "high"
+    FeedPriorityLow  = "low"
+)
+
 type Config struct {
     RedisURL string
     HTTPPort int
@@ -125,6 +133,7 @@ func (c *Config) loadFeeds() error {
                 URL:          url,
                 Type:         "http", // default to HTTP
                 PollInterval: 30 * time.Second,
+                Priority:     FeedPriorityHigh,
             }
             c.Feeds = append(c.Feeds, feed)
         }
@@ -145,6 +154,10 @@ func (c *Config) loadFeeds() error {
             Type:         getEnvOrDefault(feedPrefix+"_TYPE", "http"),
             PollInterval: getDurationEnvOrDefault(feedPrefix+"_POLL_INTERVAL", 30*time.Second),
             APIKey:       os.Getenv(feedPrefix + "_API_KEY"),
+            Priority:     getEnvOrDefault(feedPrefix+"_PRIORITY", FeedPriorityHigh),
+        }
+        if feed.Priority != FeedPriorityHigh && feed.Priority != FeedPriorityLow {
+            return fmt.Errorf("invalid %s_PRIORITY %q: must be high or low", feedPrefix, feed.Priority)
         }
 
         c.Feeds = append(c.Feeds, feed)
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// ManualAnomalyRepository defines the interface for API-created anomalies and their audit trail
+type ManualAnomalyRepository interface {
+	CreateManualAnomaly(ctx context.Context, anomaly *models.ManualAnomaly) error
+	GetManualAnomaly(ctx context.Context, id int64) (*models.ManualAnomaly, error)
+	SoftDeleteAnomaly(ctx context.Context, id int64, actor string) error
+	RestoreAnomaly(ctx context.Context, id int64, actor string) error
+	AcknowledgeAnomaly(ctx context.Context, id int64, actor string) error
+	GetAnomalyIDAt(ctx context.Context, ticker string, timestamp int64) (int64, error)
+	GetAnomalyAuditLog(ctx context.Context, anomalyID int64) ([]*models.AnomalyAuditEntry, error)
+}
+
+// manualAnomalyRepository implements ManualAnomalyRepository
+type manualAnomalyRepository struct {
+	db *DB
+}
+
+// NewManualAnomalyRepository creates a new manual anomaly repository
+func NewManualAnomalyRepository(db *DB) ManualAnomalyRepository {
+	return &manualAnomalyRepository{db: db}
+}
+
+// anomalyChangeEvent is the outbox payload of an anomaly being deleted,
+// restored or acknowledged
+type anomalyChangeEvent struct {
+	ID       int64  `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Actor    string `json:"actor"`
+}
+
+// insertAuditEntry records an audit action within tx
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, anomalyID int64, action, actor string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO anomaly_audit_log (anomaly_id, action, actor) VALUES ($1, $2, $3)`,
+		anomalyID, action, actor)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// CreateManualAnomaly inserts an anomaly attributed to anomaly.CreatedBy and audits the creation
+func (r *manualAnomalyRepository) CreateManualAnomaly(ctx context.Context, anomaly *models.ManualAnomaly) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_manual_anomaly", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	anomaly.Sanitize()
+	if err := anomaly.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_manual_anomaly", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("anomaly validation failed: %w", err)
+	}
+
+	anomaly.TenantID = tenant.FromContext(ctx)
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO anomalies (ticker, price, z_score, timestamp, source, note, created_by, tenant_id, severity)
+			VALUES ($1, $2, $3, $4, 'manual', NULLIF($5, ''), $6, $7, $8)
+			RETURNING id, created_at
+		`
+		err := tx.QueryRowContext(ctx, query,
+			anomaly.Ticker,
+			anomaly.Price,
+			anomaly.ZScore,
+			anomaly.Timestamp,
+			anomaly.Note,
+			anomaly.CreatedBy,
+			anomaly.TenantID,
+			anomaly.Severity(),
+		).Scan(&anomaly.ID, &anomaly.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if err := insertAuditEntry(ctx, tx, anomaly.ID, models.AuditActionCreate, anomaly.CreatedBy); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxAnomalyStream, EventAnomalyCreated, anomaly)
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_manual_anomaly", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("create_manual_anomaly").Inc()
+		return fmt.Errorf("failed to create anomaly: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_manual_anomaly", "success").Inc()
+	return nil
+}
+
+// GetManualAnomaly retrieves a manual anomaly of the context's tenant by ID, including soft-deleted ones
+func (r *manualAnomalyRepository) GetManualAnomaly(ctx context.Context, id int64) (*models.ManualAnomaly, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_manual_anomaly", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT id, ticker, price, z_score, timestamp, COALESCE(note, ''), COALESCE(created_by, ''),
+			created_at, deleted_at, COALESCE(deleted_by, ''), acknowledged_at, COALESCE(acknowledged_by, ''), tenant_id
+		FROM anomalies
+		WHERE id = $1 AND source = 'manual' AND tenant_id = $2
+	`
+
+	var anomaly models.ManualAnomaly
+	var deletedAt, acknowledgedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)).Scan(
+		&anomaly.ID,
+		&anomaly.Ticker,
+		&anomaly.Price,
+		&anomaly.ZScore,
+		&anomaly.Timestamp,
+		&anomaly.Note,
+		&anomaly.CreatedBy,
+		&anomaly.CreatedAt,
+		&deletedAt,
+		&anomaly.DeletedBy,
+		&acknowledgedAt,
+		&anomaly.AcknowledgedBy,
+		&anomaly.TenantID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("anomaly %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_manual_anomaly", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_manual_anomaly").Inc()
+		return nil, fmt.Errorf("failed to get anomaly: %w", err)
+	}
+	if deletedAt.Valid {
+		anomaly.DeletedAt = &deletedAt.Time
+	}
+	if acknowledgedAt.Valid {
+		anomaly.AcknowledgedAt = &acknowledgedAt.Time
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_manual_anomaly", "success").Inc()
+	return &anomaly, nil
+}
+
+// SoftDeleteAnomaly hides a manual anomaly from queries and audits the deletion
+func (r *manualAnomalyRepository) SoftDeleteAnomaly(ctx context.Context, id int64, actor string) error {
+	return r.setDeleted(ctx, "soft_delete_anomaly", id, actor, true)
+}
+
+// GetAnomalyIDAt returns the id of the context tenant's anomaly of ticker at
+// timestamp, preferring one not yet acknowledged. It resolves anomalies read
+// from Redis, which carry no Postgres id, to their stored row.
+func (r *manualAnomalyRepository) GetAnomalyIDAt(ctx context.Context, ticker string, timestamp int64) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_anomaly_id_at", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT id FROM anomalies
+		WHERE tenant_id = $1 AND ticker = $2 AND timestamp = $3 AND deleted_at IS NULL
+		ORDER BY acknowledged_at IS NOT NULL, id
+		LIMIT 1
+	`
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, query, tenant.FromContext(ctx), ticker, timestamp).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("anomaly of %s at %d: %w", ticker, timestamp, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_anomaly_id_at", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_anomaly_id_at").Inc()
+		return 0, fmt.Errorf("failed to get anomaly id: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_anomaly_id_at", "success").Inc()
+	return id, nil
+}
+
+// RestoreAnomaly makes a soft-deleted manual anomaly visible again and audits the restore
+func (r *manualAnomalyRepository) RestoreAnomaly(ctx context.Context, id int64, actor string) error {
+	return r.setDeleted(ctx, "restore_anomaly", id, actor, false)
+}
+
+// setDeleted toggles deleted_at for a manual anomaly of the context's tenant in the expected state
+func (r *manualAnomalyRepository) setDeleted(ctx context.Context, operation string, id int64, actor string, deleted bool) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		UPDATE anomalies SET deleted_at = NOW(), deleted_by = $3
+		WHERE id = $1 AND tenant_id = $2 AND source = 'manual' AND deleted_at IS NULL
+	`
+	args := []interface{}{id, tenant.FromContext(ctx), actor}
+	action := models.AuditActionDelete
+	eventType := EventAnomalyDeleted
+	if !deleted {
+		query = `
+			UPDATE anomalies SET deleted_at = NULL, deleted_by = NULL
+			WHERE id = $1 AND tenant_id = $2 AND source = 'manual' AND deleted_at IS NOT NULL
+		`
+		args = args[:2]
+		action = models.AuditActionRestore
+		eventType = EventAnomalyRestored
+	}
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("anomaly %d: %w", id, ErrNotFound)
+		}
+		if err := insertAuditEntry(ctx, tx, id, action, actor); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxAnomalyStream, eventType, anomalyChangeEvent{ID: id, TenantID: tenant.FromContext(ctx), Actor: actor})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues(operation).Inc()
+		return fmt.Errorf("failed to %s anomaly: %w", action, err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues(operation, "success").Inc()
+	return nil
+}
+
+// AcknowledgeAnomaly marks an unacknowledged anomaly of the context's tenant,
+// detected or manual, as handled by actor and audits the acknowledgement
+func (r *manualAnomalyRepository) AcknowledgeAnomaly(ctx context.Context, id int64, actor string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("acknowledge_anomaly", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		UPDATE anomalies SET acknowledged_at = NOW(), acknowledged_by = $3, status = 'acknowledged'
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL AND acknowledged_at IS NULL
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, tenant.FromContext(ctx), actor)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("anomaly %d: %w", id, ErrNotFound)
+		}
+		if err := insertAuditEntry(ctx, tx, id, models.AuditActionAcknowledge, actor); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxAnomalyStream, EventAnomalyAcknowledged, anomalyChangeEvent{ID: id, TenantID: tenant.FromContext(ctx), Actor: actor})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("acknowledge_anomaly", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("acknowledge_anomaly").Inc()
+		return fmt.Errorf("failed to acknowledge anomaly: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("acknowledge_anomaly", "success").Inc()
+	return nil
+}
+
+// GetAnomalyAuditLog retrieves the audit entries of an anomaly of the context's tenant, oldest first
+func (r *manualAnomalyRepository) GetAnomalyAuditLog(ctx context.Context, anomalyID int64) ([]*models.AnomalyAuditEntry, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_anomaly_audit_log", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT l.id, l.anomaly_id, l.action, l.actor, l.created_at
+		FROM anomaly_audit_log l
+		JOIN anomalies a ON a.id = l.anomaly_id
+		WHERE l.anomaly_id = $1 AND a.tenant_id = $2
+		ORDER BY l.created_at, l.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, anomalyID, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_anomaly_audit_log", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_anomaly_audit_log").Inc()
+		return nil, fmt.Errorf("failed to get anomaly audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.AnomalyAuditEntry
+	for rows.Next() {
+		var entry models.AnomalyAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.AnomalyID, &entry.Action, &entry.Actor, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit entries: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_anomaly_audit_log", "success").Inc()
+	return entries, nil
+}
@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// apiKeyTouchInterval bounds how often last_used_at is written for a busy key
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyRepository defines the interface for API key access
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*models.APIKey, error)
+	UpdateAPIKey(ctx context.Context, key *models.APIKey) error
+	RevokeAPIKey(ctx context.Context, id int64) error
+	UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+// apiKeyRepository implements APIKeyRepository
+type apiKeyRepository struct {
+	db *DB
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, tenant_id, created_by, expires_at, last_used_at, revoked_at, created_at, updated_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var (
+		key                            models.APIKey
+		expiresAt, lastUsedAt, revoked sql.NullTime
+	)
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		stringArray(&key.Scopes),
+		&key.TenantID,
+		&key.CreatedBy,
+		&expiresAt,
+		&lastUsedAt,
+		&revoked,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revoked.Valid {
+		key.RevokedAt = &revoked.Time
+	}
+	return &key, nil
+}
+
+// CreateAPIKey inserts a new API key for the context's tenant
+func (r *apiKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_api_key", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	key.Sanitize()
+	if err := key.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_api_key", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("api key validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, tenant_id, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	key.TenantID = tenant.FromContext(ctx)
+	err := r.db.QueryRowContext(ctx, query,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		key.Scopes,
+		key.TenantID,
+		key.CreatedBy,
+		key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt, &key.UpdatedAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_api_key", "error").Observe(time.Since(start).Seconds())
+		if isUniqueViolation(err) {
+			return fmt.Errorf("api key %s: %w", key.Prefix, ErrConflict)
+		}
+		metrics.DatabaseErrors.WithLabelValues("create_api_key").Inc()
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_api_key", "success").Inc()
+	return nil
+}
+
+// GetAPIKey retrieves an API key of the context's tenant, revoked or not
+func (r *apiKeyRepository) GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_api_key", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1 AND tenant_id = $2`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_api_key", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_api_key").Inc()
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_api_key", "success").Inc()
+	return key, nil
+}
+
+// ListAPIKeys retrieves every API key of the context's tenant
+func (r *apiKeyRepository) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_api_keys", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = $1 ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_api_keys", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_api_keys").Inc()
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api keys: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_api_keys", "success").Inc()
+	return keys, nil
+}
+
+// UpdateAPIKey replaces the name, scopes and expiry of an API key of the context's tenant
+func (r *apiKeyRepository) UpdateAPIKey(ctx context.Context, key *models.APIKey) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_api_key", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	key.Sanitize()
+	if err := key.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_api_key", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("api key validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE api_keys
+		SET name = $2, scopes = $3, expires_at = $4, updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $5
+		RETURNING ` + apiKeyColumns
+
+	updated, err := scanAPIKey(r.db.QueryRowContext(ctx, query,
+		key.ID,
+		key.Name,
+		key.Scopes,
+		key.ExpiresAt,
+		tenant.FromContext(ctx),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("api key %d: %w", key.ID, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_api_key", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("update_api_key").Inc()
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+
+	*key = *updated
+	metrics.DatabaseOperations.WithLabelValues("update_api_key", "success").Inc()
+	return nil
+}
+
+// RevokeAPIKey revokes a live API key of the context's tenant. Revoked keys
+// are kept so their last use stays visible.
+func (r *apiKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("revoke_api_key", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `UPDATE api_keys SET revoked_at = NOW(), updated_at = NOW() WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("revoke_api_key", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("revoke_api_key").Inc()
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("api key %d: %w", id, ErrNotFound)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("revoke_api_key", "success").Inc()
+	return nil
+}
+
+// UseAPIKey retrieves the live key with keyHash, of any tenant, and records
+// that it was used. Unknown, revoked and expired keys are reported as
+// ErrNotFound.
+func (r *apiKeyRepository) UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("use_api_key", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key: %w", ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("use_api_key", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("use_api_key").Inc()
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	// Failing to record the use must not fail the request
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, key.ID)
+		if err != nil {
+			metrics.DatabaseErrors.WithLabelValues("use_api_key").Inc()
+		}
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("use_api_key", "success").Inc()
+	return key, nil
+}
@@ -0,0 +1,363 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// ArchiveFileTimeFormat names archive files after the span they hold
+const ArchiveFileTimeFormat = "20060102T150405Z"
+
+// archiveFileSuffix ends the name of every archive file
+const archiveFileSuffix = ".jsonl.gz"
+
+// ArchiveFileName returns the name of the archive file holding the rows
+// aged within [from, until)
+func ArchiveFileName(from, until time.Time) string {
+	return from.UTC().Format(ArchiveFileTimeFormat) + "-" + until.UTC().Format(ArchiveFileTimeFormat) + archiveFileSuffix
+}
+
+// parseArchiveFileName returns the span of rows an archive file holds
+func parseArchiveFileName(name string) (from, until time.Time, ok bool) {
+	span, ok := strings.CutSuffix(name, archiveFileSuffix)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	fromStr, untilStr, ok := strings.Cut(span, "-")
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	from, err := time.Parse(ArchiveFileTimeFormat, fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	until, err = time.Parse(ArchiveFileTimeFormat, untilStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, until, true
+}
+
+// archivedQuote is a quotes row as ExportAndPrune encodes it
+type archivedQuote struct {
+	Ticker    string  `json:"ticker"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"timestamp"`
+	Sector    string  `json:"sector"`
+	TenantID  string  `json:"tenant_id"`
+}
+
+// QuoteArchive reads the quotes the archival service exported to
+// <dir>/quotes. Files are scanned whole, so archive reads are far slower
+// than reads of the quotes table.
+type QuoteArchive struct {
+	dir string
+}
+
+// NewQuoteArchive creates a reader of the archive under dir
+func NewQuoteArchive(dir string) *QuoteArchive {
+	return &QuoteArchive{dir: dir}
+}
+
+// archiveFile is an archive file and the span of timestamps it holds
+type archiveFile struct {
+	path         string
+	start, until int64
+}
+
+// files returns the archive files holding quotes timestamped within
+// [start, end], oldest first
+func (a *QuoteArchive) files(start, end int64) ([]archiveFile, error) {
+	dir := filepath.Join(a.dir, "quotes")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quote archive: %w", err)
+	}
+
+	var files []archiveFile
+	for _, entry := range entries {
+		from, until, ok := parseArchiveFileName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		file := archiveFile{path: filepath.Join(dir, entry.Name()), start: from.UnixMilli(), until: until.UnixMilli()}
+		if file.start <= end && file.until > start {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].start < files[j].start })
+	return files, nil
+}
+
+// scan calls fn with each quote of ticker in path visible to ctx's tenant
+func (a *QuoteArchive) scan(ctx context.Context, path, ticker string, fn func(quote *models.NormalizedTick)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read archive file %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	visible := tenant.Visible(ctx)
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var row archivedQuote
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return fmt.Errorf("failed to decode archive file %s: %w", path, err)
+		}
+		if row.Ticker != ticker || !containsTenant(visible, row.TenantID) {
+			continue
+		}
+		fn(&models.NormalizedTick{Ticker: row.Ticker, Price: row.Price, Timestamp: row.Timestamp, Sector: row.Sector})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read archive file %s: %w", path, err)
+	}
+	return ctx.Err()
+}
+
+// containsTenant reports whether id is one of tenants. Rows archived
+// before tenants existed have no tenant_id and belong to Default.
+func containsTenant(tenants []string, id string) bool {
+	if id == "" {
+		id = tenant.Default
+	}
+	for _, t := range tenants {
+		if t == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Quotes returns the archived quotes of ticker within [start, end], oldest
+// first
+func (a *QuoteArchive) Quotes(ctx context.Context, ticker string, start, end int64) ([]*models.NormalizedTick, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("read_quote_archive", "success").Observe(time.Since(startTime).Seconds())
+	}()
+
+	files, err := a.files(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var quotes []*models.NormalizedTick
+	for _, file := range files {
+		err := a.scan(ctx, file.path, ticker, func(quote *models.NormalizedTick) {
+			if quote.Timestamp >= start && quote.Timestamp <= end {
+				quotes = append(quotes, quote)
+			}
+		})
+		if err != nil {
+			metrics.DatabaseErrors.WithLabelValues("read_quote_archive").Inc()
+			return nil, err
+		}
+	}
+	sort.SliceStable(quotes, func(i, j int) bool { return quotes[i].Timestamp < quotes[j].Timestamp })
+
+	metrics.DatabaseOperations.WithLabelValues("read_quote_archive", "success").Inc()
+	return quotes, nil
+}
+
+// QuoteAt returns the last archived quote of ticker at or before ts, or nil
+// if there is none
+func (a *QuoteArchive) QuoteAt(ctx context.Context, ticker string, ts int64) (*models.NormalizedTick, error) {
+	files, err := a.files(0, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files holding late rows span back past earlier files, so files are
+	// scanned by the end of their span until none left can hold a later
+	// quote
+	sort.Slice(files, func(i, j int) bool { return files[i].until > files[j].until })
+	var last *models.NormalizedTick
+	for _, file := range files {
+		if last != nil && file.until <= last.Timestamp {
+			break
+		}
+		err := a.scan(ctx, file.path, ticker, func(quote *models.NormalizedTick) {
+			if quote.Timestamp <= ts && (last == nil || quote.Timestamp > last.Timestamp) {
+				last = quote
+			}
+		})
+		if err != nil {
+			metrics.DatabaseErrors.WithLabelValues("read_quote_archive").Inc()
+			return nil, err
+		}
+	}
+	return last, nil
+}
+
+// archivedQuoteRepository answers the history queries of a QuoteRepository
+// whose range reaches before the quotes archive watermark, where retention
+// may have pruned the quotes table, from the archive as well
+type archivedQuoteRepository struct {
+	QuoteRepository
+	retention RetentionRepository
+	archive   *QuoteArchive
+}
+
+// NewArchivedQuoteRepository wraps quotes so GetQuotesByTimeRange,
+// GetQuotesByTimeRangeDownsampled and GetQuoteAt merge archived quotes
+// with live ones
+func NewArchivedQuoteRepository(quotes QuoteRepository, retention RetentionRepository, archive *QuoteArchive) QuoteRepository {
+	return &archivedQuoteRepository{QuoteRepository: quotes, retention: retention, archive: archive}
+}
+
+// archivedUntil returns the quotes archive watermark in milliseconds since
+// the epoch, and whether a range starting at start reaches before it
+func (r *archivedQuoteRepository) archivedUntil(ctx context.Context, start int64) (int64, bool, error) {
+	until, ok, err := r.retention.ArchiveWatermark(ctx, "quotes")
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	watermark := until.UnixMilli()
+	return watermark, start < watermark, nil
+}
+
+// GetQuotesByTimeRange retrieves quotes within a time range from the quotes
+// table and, before the archive watermark, from the archive
+func (r *archivedQuoteRepository) GetQuotesByTimeRange(ctx context.Context, ticker string, start, end int64) ([]*models.NormalizedTick, error) {
+	live, err := r.QuoteRepository.GetQuotesByTimeRange(ctx, ticker, start, end)
+	if err != nil {
+		return nil, err
+	}
+	watermark, ok, err := r.archivedUntil(ctx, start)
+	if err != nil || !ok {
+		return live, err
+	}
+
+	archived, err := r.archive.Quotes(ctx, ticker, start, min(end, watermark-1))
+	if err != nil {
+		return nil, err
+	}
+	return mergeQuotes(archived, live), nil
+}
+
+// GetQuotesByTimeRangeDownsampled downsamples the quotes within a time range
+// like the wrapped repository, including archived quotes before the archive
+// watermark
+func (r *archivedQuoteRepository) GetQuotesByTimeRangeDownsampled(ctx context.Context, ticker string, start, end int64, resolution time.Duration) ([]*models.NormalizedTick, error) {
+	live, err := r.QuoteRepository.GetQuotesByTimeRangeDownsampled(ctx, ticker, start, end, resolution)
+	if err != nil {
+		return nil, err
+	}
+	watermark, ok, err := r.archivedUntil(ctx, start)
+	if err != nil || !ok {
+		return live, err
+	}
+
+	archived, err := r.archive.Quotes(ctx, ticker, start, min(end, watermark-1))
+	if err != nil {
+		return nil, err
+	}
+	// The extremes of the union of two sets are among the extremes of each,
+	// so downsampling the live buckets again with the archived quotes is
+	// exact
+	return downsampleQuotes(mergeQuotes(archived, live), resolution.Milliseconds()), nil
+}
+
+// GetQuoteAt retrieves the last known quote for ticker at or before ts,
+// looking in the archive too when ts is before the archive watermark
+func (r *archivedQuoteRepository) GetQuoteAt(ctx context.Context, ticker string, ts int64) (*models.NormalizedTick, error) {
+	live, err := r.QuoteRepository.GetQuoteAt(ctx, ticker, ts)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	_, ok, watermarkErr := r.archivedUntil(ctx, ts)
+	if watermarkErr != nil {
+		return nil, watermarkErr
+	}
+	if !ok {
+		return live, err
+	}
+
+	archived, archiveErr := r.archive.QuoteAt(ctx, ticker, ts)
+	if archiveErr != nil {
+		return nil, archiveErr
+	}
+	if archived == nil {
+		return live, err
+	}
+	if live != nil && live.Timestamp >= archived.Timestamp {
+		return live, nil
+	}
+	return archived, nil
+}
+
+// mergeQuotes merges archived and live quotes, each oldest first, into one
+// list oldest first. A quote in both, not yet pruned after being archived,
+// is taken from live.
+func mergeQuotes(archived, live []*models.NormalizedTick) []*models.NormalizedTick {
+	inLive := make(map[int64]bool, len(live))
+	for _, quote := range live {
+		inLive[quote.Timestamp] = true
+	}
+
+	merged := make([]*models.NormalizedTick, 0, len(archived)+len(live))
+	for _, quote := range archived {
+		if !inLive[quote.Timestamp] {
+			merged = append(merged, quote)
+		}
+	}
+	merged = append(merged, live...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	return merged
+}
+
+// downsampleQuotes keeps the first, last, lowest and highest of quotes,
+// oldest first, in each width-millisecond bucket aligned to the epoch,
+// breaking ties like downsampledQuotesQuery
+func downsampleQuotes(quotes []*models.NormalizedTick, width int64) []*models.NormalizedTick {
+	kept := make(map[*models.NormalizedTick]bool)
+	for i := 0; i < len(quotes); {
+		bucket := quotes[i].Timestamp - quotes[i].Timestamp%width
+		j := i
+		first, last, low, high := quotes[i], quotes[i], quotes[i], quotes[i]
+		for ; j < len(quotes) && quotes[j].Timestamp-quotes[j].Timestamp%width == bucket; j++ {
+			quote := quotes[j]
+			last = quote
+			if quote.Price < low.Price {
+				low = quote
+			}
+			if quote.Price > high.Price {
+				high = quote
+			}
+		}
+		kept[first], kept[last], kept[low], kept[high] = true, true, true, true
+		i = j
+	}
+
+	downsampled := make([]*models.NormalizedTick, 0, len(kept))
+	for _, quote := range quotes {
+		if kept[quote] {
+			downsampled = append(downsampled, quote)
+		}
+	}
+	return downsampled
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+)
+
+// ArchiveCatalogEntry describes an archive file uploaded to object storage:
+// the dataset, UTC day (YYYY-MM-DD) and ticker partition it belongs to, and
+// the records it holds
+type ArchiveCatalogEntry struct {
+	Object       string    `json:"object"`
+	Dataset      string    `json:"dataset"`
+	Date         string    `json:"date"`
+	Ticker       string    `json:"ticker"`
+	Records      int       `json:"records"`
+	Bytes        int64     `json:"bytes"`
+	MinTimestamp int64     `json:"min_timestamp"`
+	MaxTimestamp int64     `json:"max_timestamp"`
+	SHA256       string    `json:"sha256"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ArchiveCatalogRepository records the archive files in object storage
+type ArchiveCatalogRepository interface {
+	SaveArchiveCatalogEntry(ctx context.Context, entry *ArchiveCatalogEntry) error
+}
+
+// archiveCatalogRepository implements ArchiveCatalogRepository
+type archiveCatalogRepository struct {
+	db *DB
+}
+
+// NewArchiveCatalogRepository creates a new archive catalog repository
+func NewArchiveCatalogRepository(db *DB) ArchiveCatalogRepository {
+	return &archiveCatalogRepository{db: db}
+}
+
+// SaveArchiveCatalogEntry records entry, replacing the entry of a file
+// uploaded again under the same key
+func (r *archiveCatalogRepository) SaveArchiveCatalogEntry(ctx context.Context, entry *ArchiveCatalogEntry) error {
+	start := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO archive_catalog (object, dataset, date, ticker, records, bytes, min_timestamp, max_timestamp, sha256)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (object) DO UPDATE SET records = EXCLUDED.records, bytes = EXCLUDED.bytes,
+			min_timestamp = EXCLUDED.min_timestamp, max_timestamp = EXCLUDED.max_timestamp,
+			sha256 = EXCLUDED.sha256, updated_at = NOW()
+	`, entry.Object, entry.Dataset, entry.Date, entry.Ticker, entry.Records, entry.Bytes,
+		entry.MinTimestamp, entry.MaxTimestamp, entry.SHA256)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_archive_catalog_entry", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("save_archive_catalog_entry").Inc()
+		return fmt.Errorf("failed to catalog %s: %w", entry.Object, err)
+	}
+	metrics.DatabaseOperationDuration.WithLabelValues("save_archive_catalog_entry", "success").Observe(time.Since(start).Seconds())
+	return nil
+}
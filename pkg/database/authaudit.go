@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// MaxAuthEventPage caps how many events one ListAuthEvents call returns
+const MaxAuthEventPage = 1000
+
+// AuthEventFilter selects auth audit events for ListAuthEvents. Events are
+// returned newest first starting before BeforeID, so the last id seen is the
+// cursor for the next page. Zero-valued fields are not applied.
+type AuthEventFilter struct {
+	Type      string
+	Principal string
+	TenantID  string
+	Since     time.Time
+	Until     time.Time
+	BeforeID  int64
+	Limit     int
+}
+
+// AuthAuditRepository defines the interface for the auth audit log. The log
+// spans all tenants.
+type AuthAuditRepository interface {
+	RecordAuthEvent(ctx context.Context, event *models.AuthEvent) error
+	ListAuthEvents(ctx context.Context, filter AuthEventFilter) ([]*models.AuthEvent, error)
+}
+
+// authAuditRepository implements AuthAuditRepository
+type authAuditRepository struct {
+	db *DB
+}
+
+// NewAuthAuditRepository creates a new auth audit repository
+func NewAuthAuditRepository(db *DB) AuthAuditRepository {
+	return &authAuditRepository{db: db}
+}
+
+// RecordAuthEvent appends event to the audit log
+func (r *authAuditRepository) RecordAuthEvent(ctx context.Context, event *models.AuthEvent) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("record_auth_event", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		INSERT INTO auth_audit_log (event_type, principal, tenant_id, ip, method, route, detail)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''))
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		event.Type, event.Principal, event.TenantID, event.IP, event.Method, event.Route, event.Detail,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("record_auth_event", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("record_auth_event").Inc()
+		return fmt.Errorf("failed to record auth event: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("record_auth_event", "success").Inc()
+	return nil
+}
+
+// ListAuthEvents retrieves audit events matching filter, newest first
+func (r *authAuditRepository) ListAuthEvents(ctx context.Context, filter AuthEventFilter) ([]*models.AuthEvent, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_auth_events", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	limit := filter.Limit
+	if limit <= 0 || limit > MaxAuthEventPage {
+		limit = MaxAuthEventPage
+	}
+
+	var where whereBuilder
+	if filter.BeforeID > 0 {
+		where.add("id < $%d", filter.BeforeID)
+	}
+	if filter.Type != "" {
+		where.add("event_type = $%d", filter.Type)
+	}
+	if filter.Principal != "" {
+		where.add("principal = $%d", filter.Principal)
+	}
+	if filter.TenantID != "" {
+		where.add("tenant_id = $%d", filter.TenantID)
+	}
+	if !filter.Since.IsZero() {
+		where.add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where.add("created_at <= $%d", filter.Until)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, event_type, principal, tenant_id, ip, method, route, detail, created_at
+		FROM auth_audit_log %s
+		ORDER BY id DESC
+		LIMIT %d
+	`, where.clause(), limit)
+
+	rows, err := r.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_auth_events", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_auth_events").Inc()
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuthEvent
+	for rows.Next() {
+		var (
+			event                       models.AuthEvent
+			principal, tenantID, detail sql.NullString
+		)
+		if err := rows.Scan(&event.ID, &event.Type, &principal, &tenantID, &event.IP, &event.Method, &event.Route, &detail, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		event.Principal = principal.String
+		event.TenantID = tenantID.String
+		event.Detail = detail.String
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		metrics.DatabaseErrors.WithLabelValues("list_auth_events").Inc()
+		return nil, fmt.Errorf("error iterating auth events: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_auth_events", "success").Inc()
+	return events, nil
+}
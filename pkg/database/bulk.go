@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// copyThreshold is the batch size from which rows are streamed with COPY;
+// smaller batches use a single multi-row INSERT, which costs fewer round trips
+const copyThreshold = 100
+
+// quoteColumns and rawEventColumns are the columns batch writes fill
+var (
+	quoteColumns    = []string{"ticker", "price", "timestamp", "sector", "tenant_id"}
+	rawEventColumns = []string{"source", "symbol", "price", "timestamp"}
+)
+
+// SaveQuotes saves a batch of quotes in one transaction. Like SaveQuote it
+// overwrites the price and sector of a quote the tenant already stored for
+// the same ticker and timestamp; within the batch the last such quote wins. Nothing
+// is stored if any quote is invalid.
+func (r *quoteRepository) SaveQuotes(ctx context.Context, quotes []*models.NormalizedTick) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_quotes", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	for i, quote := range quotes {
+		quote.Sanitize()
+		if err := quote.Validate(); err != nil {
+			metrics.DatabaseOperationDuration.WithLabelValues("save_quotes", "validation_error").Observe(time.Since(start).Seconds())
+			return fmt.Errorf("quote %d validation failed: %w", i, err)
+		}
+	}
+	quotes = latestQuotes(quotes)
+	if len(quotes) == 0 {
+		return nil
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		if set := r.db.localStatementTimeout(); set != "" {
+			if _, err := tx.Exec(ctx, set); err != nil {
+				return err
+			}
+		}
+		_, err := writeQuotes(ctx, tx, quotes, tenantID, upsertQuotesSQL)
+		return err
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_quotes", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("save_quotes").Inc()
+		return fmt.Errorf("failed to save quotes: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("save_quotes", "success").Add(float64(len(quotes)))
+	return nil
+}
+
+// latestQuotes drops all but the last quote of each ticker and timestamp, as
+// one upsert statement cannot touch the same row twice
+func latestQuotes(quotes []*models.NormalizedTick) []*models.NormalizedTick {
+	type key struct {
+		ticker    string
+		timestamp int64
+	}
+	last := make(map[key]int, len(quotes))
+	for i, quote := range quotes {
+		last[key{quote.Ticker, quote.Timestamp}] = i
+	}
+	if len(last) == len(quotes) {
+		return quotes
+	}
+
+	unique := make([]*models.NormalizedTick, 0, len(last))
+	for i, quote := range quotes {
+		if last[key{quote.Ticker, quote.Timestamp}] == i {
+			unique = append(unique, quote)
+		}
+	}
+	return unique
+}
+
+// upsertQuotesSQL completes an INSERT INTO quotes of quoteColumns
+const upsertQuotesSQL = `
+	ON CONFLICT (tenant_id, ticker, timestamp) DO UPDATE SET
+		price = EXCLUDED.price,
+		sector = EXCLUDED.sector,
+		updated_at = NOW()
+`
+
+// skipStoredQuotesSQL completes an INSERT INTO quotes of quoteColumns,
+// leaving quotes the tenant already stored for the same ticker and timestamp
+// untouched
+const skipStoredQuotesSQL = `ON CONFLICT (tenant_id, ticker, timestamp) DO NOTHING`
+
+// writeQuotes inserts quotes, resolving conflicts with onConflict, and
+// returns how many rows were written
+func writeQuotes(ctx context.Context, tx pgx.Tx, quotes []*models.NormalizedTick, tenantID, onConflict string) (int64, error) {
+	if len(quotes) < copyThreshold {
+		return insertQuotes(ctx, tx, quotes, tenantID, onConflict)
+	}
+	return copyQuotes(ctx, tx, quotes, tenantID, onConflict)
+}
+
+// insertQuotes inserts quotes with a single multi-row INSERT
+func insertQuotes(ctx context.Context, tx pgx.Tx, quotes []*models.NormalizedTick, tenantID, onConflict string) (int64, error) {
+	args := make([]interface{}, 0, len(quotes)*len(quoteColumns))
+	for _, quote := range quotes {
+		args = append(args, quote.Ticker, quote.Price, quote.Timestamp, quote.Sector, tenantID)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO quotes (%s) VALUES %s %s`,
+		strings.Join(quoteColumns, ", "), valuesPlaceholders(len(quotes), len(quoteColumns)), onConflict)
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// copyQuotes streams quotes into a staging table with COPY and inserts them
+// from there, since COPY itself cannot resolve conflicts
+func copyQuotes(ctx context.Context, tx pgx.Tx, quotes []*models.NormalizedTick, tenantID, onConflict string) (int64, error) {
+	_, err := tx.Exec(ctx, fmt.Sprintf(
+		`CREATE TEMP TABLE quotes_staging ON COMMIT DROP AS SELECT %s FROM quotes WITH NO DATA`,
+		strings.Join(quoteColumns, ", ")))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	err = copyRows(ctx, tx, "quotes_staging", quoteColumns, len(quotes), func(i int) []interface{} {
+		quote := quotes[i]
+		return []interface{}{quote.Ticker, quote.Price, quote.Timestamp, quote.Sector, tenantID}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	columns := strings.Join(quoteColumns, ", ")
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO quotes (%s) SELECT %s FROM quotes_staging %s`, columns, columns, onConflict))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// BackfillQuotes stores quotes recorded in the past, such as ones replayed
+// from a stream, in one transaction and returns how many it inserted.
+// Unlike SaveQuotes it accepts timestamps of any age and leaves a quote
+// already stored for the same ticker and timestamp untouched, so replaying
+// the same quotes again changes nothing. Nothing is stored if any quote is
+// invalid.
+func (r *quoteRepository) BackfillQuotes(ctx context.Context, quotes []*models.NormalizedTick) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("backfill_quotes", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	for i, quote := range quotes {
+		if err := quote.ValidateHistorical(); err != nil {
+			metrics.DatabaseOperationDuration.WithLabelValues("backfill_quotes", "validation_error").Observe(time.Since(start).Seconds())
+			return 0, fmt.Errorf("quote %d validation failed: %w", i, err)
+		}
+	}
+	quotes = latestQuotes(quotes)
+	if len(quotes) == 0 {
+		return 0, nil
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	var inserted int64
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		if set := r.db.localStatementTimeout(); set != "" {
+			if _, err := tx.Exec(ctx, set); err != nil {
+				return err
+			}
+		}
+		var err error
+		inserted, err = writeQuotes(ctx, tx, quotes, tenantID, skipStoredQuotesSQL)
+		return err
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("backfill_quotes", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("backfill_quotes").Inc()
+		return 0, fmt.Errorf("failed to backfill quotes: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("backfill_quotes", "success").Add(float64(inserted))
+	return inserted, nil
+}
+
+// SaveRawEvents saves a batch of raw events in one transaction. Nothing is
+// stored if any event is invalid.
+func (r *rawEventRepository) SaveRawEvents(ctx context.Context, events []*models.RawTick) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_raw_events", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	if len(events) == 0 {
+		return nil
+	}
+	for i, event := range events {
+		event.Sanitize()
+		if err := event.Validate(); err != nil {
+			metrics.DatabaseOperationDuration.WithLabelValues("save_raw_events", "validation_error").Observe(time.Since(start).Seconds())
+			return fmt.Errorf("raw event %d validation failed: %w", i, err)
+		}
+	}
+
+	row := func(i int) []interface{} {
+		event := events[i]
+		return []interface{}{event.Source, event.Symbol, event.Price, event.Timestamp}
+	}
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		if set := r.db.localStatementTimeout(); set != "" {
+			if _, err := tx.Exec(ctx, set); err != nil {
+				return err
+			}
+		}
+		if len(events) >= copyThreshold {
+			return copyRows(ctx, tx, "raw_events", rawEventColumns, len(events), row)
+		}
+
+		args := make([]interface{}, 0, len(events)*len(rawEventColumns))
+		for i := range events {
+			args = append(args, row(i)...)
+		}
+		query := fmt.Sprintf(`INSERT INTO raw_events (%s) VALUES %s`,
+			strings.Join(rawEventColumns, ", "), valuesPlaceholders(len(events), len(rawEventColumns)))
+		_, err := tx.Exec(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_raw_events", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("save_raw_events").Inc()
+		return fmt.Errorf("failed to save raw events: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("save_raw_events", "success").Add(float64(len(events)))
+	return nil
+}
+
+// copyRows streams n rows into table with the COPY protocol
+func copyRows(ctx context.Context, tx pgx.Tx, table string, columns []string, n int, row func(i int) []interface{}) error {
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromSlice(n, func(i int) ([]interface{}, error) {
+		return row(i), nil
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to copy rows: %w", err)
+	}
+	return nil
+}
+
+// valuesPlaceholders returns "($1, $2), ($3, $4)" style placeholders for
+// rows of the given width
+func valuesPlaceholders(rows, width int) string {
+	var b strings.Builder
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := 0; j < width; j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", i*width+j+1)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// MaxCandles bounds how many buckets a single GetCandles call may span
+const MaxCandles = 5000
+
+// ErrInvalidRange is returned when a time range or bucket interval is unusable
+var ErrInvalidRange = errors.New("invalid time range")
+
+// Candle is the open/high/low/close summary of a ticker's quotes over the
+// bucket [Start, End). Start and End are milliseconds since epoch.
+type Candle struct {
+	Ticker string  `json:"ticker"`
+	Start  int64   `json:"start"`
+	End    int64   `json:"end"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Count  int64   `json:"count"`
+}
+
+// rawCandlesQuery aggregates candles from quotes
+const rawCandlesQuery = `
+	SELECT bucket,
+		(array_agg(price ORDER BY timestamp ASC))[1] AS open,
+		MAX(price) AS high,
+		MIN(price) AS low,
+		(array_agg(price ORDER BY timestamp DESC))[1] AS close,
+		COUNT(*) AS count
+	FROM (
+		SELECT price, timestamp, timestamp - (timestamp % $4) AS bucket
+		FROM quotes
+		WHERE ticker = $1 AND timestamp >= $2 AND timestamp < $3 AND tenant_id = ANY($5)
+	) q
+	GROUP BY bucket
+	ORDER BY bucket ASC
+`
+
+// viewCandlesQuery rolls candles up from the view replacing {view} over
+// [$6, $7), and from quotes over the rest of [$2, $3)
+const viewCandlesQuery = `
+	SELECT bucket,
+		(array_agg(open ORDER BY start ASC))[1] AS open,
+		MAX(high) AS high,
+		MIN(low) AS low,
+		(array_agg(close ORDER BY start DESC))[1] AS close,
+		SUM(count)::BIGINT AS count
+	FROM (
+		SELECT bucket AS start, bucket - (bucket % $4) AS bucket, open, high, low, close, count
+		FROM {view}
+		WHERE ticker = $1 AND bucket >= $6 AND bucket < $7 AND tenant_id = ANY($5)
+		UNION ALL
+		SELECT timestamp, timestamp - (timestamp % $4), price, price, price, price, 1
+		FROM quotes
+		WHERE ticker = $1 AND tenant_id = ANY($5)
+			AND timestamp >= $2 AND timestamp < $3
+			AND (timestamp < $6 OR timestamp >= $7)
+	) c
+	GROUP BY bucket
+	ORDER BY bucket ASC
+`
+
+// GetCandles aggregates ticker's quotes in [start, end) into interval-wide
+// buckets aligned to the Unix epoch. Buckets without quotes are omitted.
+// Intervals that are a multiple of a candle view's width are rolled up from
+// the view, reading only quotes newer than its last refresh.
+func (r *quoteRepository) GetCandles(ctx context.Context, ticker string, start, end int64, interval time.Duration) ([]*Candle, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_candles", "success").Observe(time.Since(startTime).Seconds())
+	}()
+
+	width := interval.Milliseconds()
+	if width <= 0 || end <= start {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_candles", "validation_error").Observe(time.Since(startTime).Seconds())
+		return nil, fmt.Errorf("%w: interval must be positive and end after start", ErrInvalidRange)
+	}
+	if (end-start)/width > MaxCandles {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_candles", "validation_error").Observe(time.Since(startTime).Seconds())
+		return nil, fmt.Errorf("%w: range spans more than %d candles", ErrInvalidRange, MaxCandles)
+	}
+
+	view, refreshedAt, err := r.candleSource(ctx, width)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_candles", "error").Observe(time.Since(startTime).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_candles").Inc()
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+
+	var rows *sql.Rows
+	if view == nil {
+		rows, err = r.db.Reader().QueryContext(ctx, rawCandlesQuery, ticker, start, end, width, visibleTenants(ctx))
+	} else {
+		// Whole view buckets refreshed before refreshedAt come from the view;
+		// the edges of the range and everything since come from quotes
+		viewFrom := ceilTo(start, view.width)
+		viewTo := min(end, refreshedAt)
+		viewTo -= viewTo % view.width
+		if viewTo < viewFrom {
+			viewFrom, viewTo = start, start
+		}
+		query := strings.Replace(viewCandlesQuery, "{view}", view.name, 1)
+		rows, err = r.db.Reader().QueryContext(ctx, query, ticker, start, end, width, visibleTenants(ctx), viewFrom, viewTo)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_candles", "error").Observe(time.Since(startTime).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_candles").Inc()
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+	defer rows.Close()
+
+	var candles []*Candle
+	for rows.Next() {
+		candle := Candle{Ticker: ticker}
+		if err := rows.Scan(&candle.Start, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candle.End = candle.Start + width
+		candles = append(candles, &candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating candles: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_candles", "success").Inc()
+	return candles, nil
+}
+
+// candleView is a materialized view of width-wide candles
+type candleView struct {
+	name  string
+	width int64
+}
+
+// candleViews are the candle views, finest first; views after the first are
+// rolled up from it. See migration 14.
+var candleViews = []candleView{
+	{name: "candles_1m", width: time.Minute.Milliseconds()},
+	{name: "candles_5m", width: 5 * time.Minute.Milliseconds()},
+	{name: "candles_1h", width: time.Hour.Milliseconds()},
+}
+
+// candleSource picks the coarsest view whose width divides width and returns
+// it with the time it was last refreshed, or nil if no view fits or none has
+// been refreshed yet
+func (r *quoteRepository) candleSource(ctx context.Context, width int64) (*candleView, int64, error) {
+	var view *candleView
+	for i := range candleViews {
+		if width%candleViews[i].width == 0 {
+			view = &candleViews[i]
+		}
+	}
+	if view == nil {
+		return nil, 0, nil
+	}
+
+	var refreshedAt int64
+	err := r.db.Reader().QueryRowContext(ctx,
+		`SELECT refreshed_at FROM candle_view_refreshes WHERE view_name = $1`, view.name).Scan(&refreshedAt)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return view, refreshedAt, nil
+}
+
+// ceilTo rounds ms up to a multiple of width
+func ceilTo(ms, width int64) int64 {
+	if rem := ms % width; rem != 0 {
+		return ms + width - rem
+	}
+	return ms
+}
+
+// candleRefreshLockKey is the advisory lock serializing candle view
+// refreshes across replicas
+const candleRefreshLockKey = 7265111
+
+// CandleRefresher keeps the candle views up to date
+type CandleRefresher struct {
+	db       *DB
+	interval time.Duration
+}
+
+// NewCandleRefresher creates a refresher running every CANDLES_REFRESH_INTERVAL
+func NewCandleRefresher(db *DB) *CandleRefresher {
+	return &CandleRefresher{
+		db:       db,
+		interval: getEnvDurationOrDefault("CANDLES_REFRESH_INTERVAL", time.Minute),
+	}
+}
+
+// Run refreshes the views immediately and then every interval until ctx is
+// done
+func (c *CandleRefresher) Run(ctx context.Context) {
+	logger.Log.Info("candle refresher started", zap.Duration("interval", c.interval))
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+			logger.Log.Error("candle view refresh failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Log.Info("candle refresher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh refreshes every candle view, finest first, and records when the
+// refresh began. Views are refreshed concurrently with reads once populated.
+func (c *CandleRefresher) Refresh(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("refresh_candles", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	err := c.db.Transaction(ctx, func(tx *sql.Tx) error {
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, candleRefreshLockKey).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to acquire refresh lock: %w", err)
+		}
+		if !locked {
+			// Another instance is refreshing
+			return nil
+		}
+
+		refreshedAt := start.UnixMilli()
+		for _, view := range candleViews {
+			var populated bool
+			if err := tx.QueryRowContext(ctx, `SELECT ispopulated FROM pg_matviews WHERE matviewname = $1`, view.name).Scan(&populated); err != nil {
+				return fmt.Errorf("failed to check view %s: %w", view.name, err)
+			}
+
+			// CONCURRENTLY keeps the view readable but needs it populated
+			refresh := `REFRESH MATERIALIZED VIEW ` + view.name
+			if populated {
+				refresh = `REFRESH MATERIALIZED VIEW CONCURRENTLY ` + view.name
+			}
+			if _, err := tx.ExecContext(ctx, refresh); err != nil {
+				return fmt.Errorf("failed to refresh view %s: %w", view.name, err)
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO candle_view_refreshes (view_name, refreshed_at) VALUES ($1, $2)
+				ON CONFLICT (view_name) DO UPDATE SET refreshed_at = EXCLUDED.refreshed_at
+			`, view.name, refreshedAt)
+			if err != nil {
+				return fmt.Errorf("failed to record refresh of %s: %w", view.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("refresh_candles", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("refresh_candles").Inc()
+		return fmt.Errorf("failed to refresh candles: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("refresh_candles", "success").Inc()
+	return nil
+}
@@ -6,18 +6,34 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alim08/fin_line/pkg/logger"
 	"github.com/alim08/fin_line/pkg/metrics"
-	_ "github.com/lib/pq"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 )
 
-// DB represents the database connection with connection pooling
+// DB represents the database connection with connection pooling. Pool is
+// the pgx connection pool; the embedded *sql.DB draws its connections from
+// Pool, so both share one set of connections and the same statement cache.
 type DB struct {
 	*sql.DB
-	config *Config
+	Pool    *pgxpool.Pool
+	config  *Config
+	secrets *SecretCipher
+
+	// replicas serve Reader; see replica.go
+	replicas    []*replica
+	nextReplica atomic.Uint64
+	stopMonitor context.CancelFunc
 }
 
 // Config holds database configuration
@@ -29,9 +45,48 @@ type Config struct {
 	Database        string
 	SSLMode         string
 	MaxOpenConns    int
-	MaxIdleConns    int
+	MinConns        int
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
+	// StatementCacheCapacity is the number of prepared statements cached
+	// per connection
+	StatementCacheCapacity int
+	// WriterDSN, when set, is the primary's connection string and replaces
+	// Host, Port, User, Password, Database and SSLMode
+	WriterDSN string
+	// ReaderDSNs are connection strings of read replicas serving Reader
+	ReaderDSNs []string
+	// MaxReplicaLag is the replication lag beyond which a replica stops
+	// serving reads until it catches up
+	MaxReplicaLag time.Duration
+	// ReplicaCheckInterval is how often replica lag is measured
+	ReplicaCheckInterval time.Duration
+	// SlowQueryThreshold is the duration beyond which a statement is logged;
+	// zero disables slow query logging
+	SlowQueryThreshold time.Duration
+	// Debug logs the EXPLAIN plan of each slow statement
+	Debug bool
+	// StatementTimeout bounds each statement a repository method runs; zero
+	// disables the limit
+	StatementTimeout time.Duration
+	// StatementTimeouts overrides StatementTimeout per repository method,
+	// keyed like "quoteRepository.GetCandles"; zero disables the limit
+	StatementTimeouts map[string]time.Duration
+	// StartupTimeout is how long WaitForReady retries before giving up;
+	// zero makes a single attempt
+	StartupTimeout time.Duration
+	// StartupRetryInterval is the wait after the first failed attempt,
+	// doubled after each further failure up to StartupMaxRetryInterval
+	StartupRetryInterval    time.Duration
+	StartupMaxRetryInterval time.Duration
+	// SecretKey is the base64-encoded 32-byte key webhook secrets are
+	// encrypted with; empty stores them unencrypted
+	SecretKey string
+	// TenancyMode is TenancyColumn or TenancySchema
+	TenancyMode string
+	// Tenants are the tenants given a schema of their own in TenancySchema
+	// mode
+	Tenants []string
 }
 
 // NewConfig creates a new database configuration from environment variables
@@ -44,55 +99,172 @@ func NewConfig() *Config {
 		Database:        getEnvOrDefault("DB_NAME", "fin_line"),
 		SSLMode:         getEnvOrDefault("DB_SSLMODE", "disable"),
 		MaxOpenConns:    getEnvIntOrDefault("DB_MAX_OPEN_CONNS", 25),
-		MaxIdleConns:    getEnvIntOrDefault("DB_MAX_IDLE_CONNS", 5),
+		MinConns:        getEnvIntOrDefault("DB_MIN_CONNS", 5),
 		ConnMaxLifetime: getEnvDurationOrDefault("DB_CONN_MAX_LIFETIME", 5*time.Minute),
 		ConnMaxIdleTime: getEnvDurationOrDefault("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+
+		StatementCacheCapacity: getEnvIntOrDefault("DB_STATEMENT_CACHE_CAPACITY", 512),
+
+		WriterDSN:            getEnvOrDefault("DB_WRITER_DSN", ""),
+		ReaderDSNs:           splitDSNs(getEnvOrDefault("DB_READER_DSNS", "")),
+		MaxReplicaLag:        getEnvDurationOrDefault("DB_MAX_REPLICA_LAG", 10*time.Second),
+		ReplicaCheckInterval: getEnvDurationOrDefault("DB_REPLICA_CHECK_INTERVAL", 5*time.Second),
+
+		SlowQueryThreshold: getEnvDurationOrDefault("DB_SLOW_QUERY_THRESHOLD", 500*time.Millisecond),
+		Debug:              getEnvOrDefault("DB_DEBUG", "false") == "true",
+
+		StatementTimeout:  getEnvDurationOrDefault("DB_STATEMENT_TIMEOUT", 10*time.Second),
+		StatementTimeouts: parseStatementTimeouts(getEnvOrDefault("DB_STATEMENT_TIMEOUTS", "")),
+
+		StartupTimeout:          getEnvDurationOrDefault("DB_STARTUP_TIMEOUT", time.Minute),
+		StartupRetryInterval:    getEnvDurationOrDefault("DB_STARTUP_RETRY_INTERVAL", 500*time.Millisecond),
+		StartupMaxRetryInterval: getEnvDurationOrDefault("DB_STARTUP_MAX_RETRY_INTERVAL", 10*time.Second),
+
+		SecretKey: getEnvOrDefault("DB_SECRET_KEY", ""),
+
+		TenancyMode: getEnvOrDefault("DB_TENANCY_MODE", TenancyColumn),
+		Tenants:     parseTenants(getEnvOrDefault("DB_TENANT_SCHEMAS", "")),
+	}
+}
+
+// DSN returns the primary's connection string
+func (c *Config) DSN() string {
+	if c.WriterDSN != "" {
+		return c.WriterDSN
 	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Database, c.SSLMode)
+}
+
+// splitDSNs splits a comma-separated list of connection strings
+func splitDSNs(s string) []string {
+	var dsns []string
+	for _, dsn := range strings.Split(s, ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	return dsns
 }
 
 // New creates a new database connection with connection pooling
 func New(config *Config) (*DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		config.Host, config.Port, config.User, config.Password, config.Database, config.SSLMode)
+	if err := config.validateTenancy(); err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("postgres", dsn)
+	secrets, err := NewSecretCipher(config.SecretKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("DB_SECRET_KEY: %w", err)
+	}
+	if secrets == nil {
+		logger.Log.Warn("DB_SECRET_KEY is not set, webhook secrets are stored unencrypted")
 	}
-
-	// Configure connection pool
-	db.SetMaxOpenConns(config.MaxOpenConns)
-	db.SetMaxIdleConns(config.MaxIdleConns)
-	db.SetConnMaxLifetime(config.ConnMaxLifetime)
-	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
 
 	// Test the connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := db.PingContext(ctx); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	pool, err := openPool(ctx, config.DSN(), config)
+	if err != nil {
+		return nil, err
 	}
 
+	connConfig := pool.Config().ConnConfig
 	logger.Log.Info("database connected successfully",
-		zap.String("host", config.Host),
-		zap.Int("port", config.Port),
-		zap.String("database", config.Database))
+		zap.String("host", connConfig.Host),
+		zap.Uint16("port", connConfig.Port),
+		zap.String("database", connConfig.Database))
+
+	db := &DB{DB: stdlib.OpenDBFromPool(pool), Pool: pool, config: config, secrets: secrets}
+	db.openReplicas(ctx)
+	return db, nil
+}
+
+// WaitForReady blocks until the primary accepts connections, retrying with
+// exponential backoff for up to config.StartupTimeout, so services may start
+// before Postgres does. Call it before New.
+func WaitForReady(ctx context.Context, config *Config) error {
+	var policy backoff.BackOff = &backoff.StopBackOff{}
+	if config.StartupTimeout > 0 {
+		exp := backoff.NewExponentialBackOff()
+		exp.InitialInterval = config.StartupRetryInterval
+		exp.MaxInterval = config.StartupMaxRetryInterval
+		exp.MaxElapsedTime = config.StartupTimeout
+		policy = exp
+	}
+
+	ping := func() error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		conn, err := pgx.Connect(ctx, config.DSN())
+		if err != nil {
+			return err
+		}
+		defer conn.Close(ctx)
+		return conn.Ping(ctx)
+	}
+	notify := func(err error, wait time.Duration) {
+		logger.Log.Warn("database not ready, retrying", zap.Error(err), zap.Duration("retry_in", wait))
+	}
+
+	if err := backoff.RetryNotify(ping, backoff.WithContext(policy, ctx), notify); err != nil {
+		return fmt.Errorf("database not ready: %w", err)
+	}
+	return nil
+}
 
-	return &DB{DB: db, config: config}, nil
+// openPool opens and pings a connection pool to dsn
+func openPool(ctx context.Context, dsn string, config *Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	// Configure connection pool
+	poolConfig.MaxConns = int32(config.MaxOpenConns)
+	poolConfig.MinConns = int32(config.MinConns)
+	poolConfig.MaxConnLifetime = config.ConnMaxLifetime
+	poolConfig.MaxConnIdleTime = config.ConnMaxIdleTime
+	poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	poolConfig.ConnConfig.StatementCacheCapacity = config.StatementCacheCapacity
+	tracer := &queryTracer{
+		slowThreshold:    config.SlowQueryThreshold,
+		explain:          config.Debug,
+		statementTimeout: config.statementTimeout,
+	}
+	poolConfig.ConnConfig.Tracer = tracer
+	if router := newSchemaRouter(config); router != nil {
+		poolConfig.BeforeAcquire = router.beforeAcquire
+		poolConfig.BeforeClose = router.beforeClose
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	tracer.pool = pool
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return pool, nil
 }
 
 // Close closes the database connection
 func (db *DB) Close() error {
 	logger.Log.Info("closing database connection")
-	return db.DB.Close()
+	db.closeReplicas()
+	err := db.DB.Close()
+	db.Pool.Close()
+	return err
 }
 
 // HealthCheck performs a health check on the database
 func (db *DB) HealthCheck(ctx context.Context) error {
 	start := time.Now()
-	err := db.PingContext(ctx)
+	err := db.Pool.Ping(ctx)
 	duration := time.Since(start).Seconds()
 
 	metrics.DatabaseHealthCheckDuration.Observe(duration)
@@ -105,13 +277,15 @@ func (db *DB) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
-// GetStats returns database connection statistics
-func (db *DB) GetStats() sql.DBStats {
-	return db.Stats()
+// GetStats returns database connection pool statistics
+func (db *DB) GetStats() *pgxpool.Stat {
+	return db.Pool.Stat()
 }
 
-// Transaction wraps a database transaction with proper error handling
-func (db *DB) Transaction(ctx context.Context, fn func(*sql.Tx) error) error {
+// Transaction wraps a database transaction with proper error handling. Its
+// statements are limited to the statement timeout of the repository method
+// calling it.
+func (db *DB) Transaction(ctx context.Context, fn func(*sql.Tx) error) (err error) {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -131,10 +305,68 @@ func (db *DB) Transaction(ctx context.Context, fn func(*sql.Tx) error) error {
 		}
 	}()
 
+	if set := db.localStatementTimeout(); set != "" {
+		if _, err = tx.ExecContext(ctx, set); err != nil {
+			return fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
+
 	err = fn(tx)
 	return err
 }
 
+// Listen calls fn with the payload of every notification sent on channel
+// until ctx is done. It holds one pool connection for as long as it runs.
+func (db *DB) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+	defer func() {
+		// The connection goes back to the pool, so stop listening on it
+		unlistenCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlistenCtx, "UNLISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			conn.Conn().Close(unlistenCtx)
+		}
+	}()
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+		fn(notification.Payload)
+	}
+}
+
+// typeMaps pools pgtype maps, which are not safe for concurrent use
+var typeMaps = sync.Pool{New: func() interface{} { return pgtype.NewMap() }}
+
+// stringArray scans a Postgres text array into dst. Slices are passed to
+// queries as they are.
+func stringArray(dst *[]string) sql.Scanner {
+	return textArrayScanner{dst: dst}
+}
+
+type textArrayScanner struct {
+	dst *[]string
+}
+
+func (s textArrayScanner) Scan(src interface{}) error {
+	m := typeMaps.Get().(*pgtype.Map)
+	defer typeMaps.Put(m)
+	return m.SQLScanner(s.dst).Scan(src)
+}
+
 // Helper functions for environment variable parsing
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
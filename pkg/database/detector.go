@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// globalDetectorScope is the detector_config key holding the global defaults
+const globalDetectorScope = "*"
+
+// DetectorConfigRepository defines the interface for anomaly detector configuration access
+type DetectorConfigRepository interface {
+	GetDetectorConfigs(ctx context.Context) ([]*models.DetectorConfig, error)
+	SaveDetectorConfig(ctx context.Context, config *models.DetectorConfig) error
+	DeleteDetectorConfig(ctx context.Context, ticker string) error
+}
+
+// detectorConfigRepository implements DetectorConfigRepository
+type detectorConfigRepository struct {
+	db *DB
+}
+
+// NewDetectorConfigRepository creates a new detector configuration repository
+func NewDetectorConfigRepository(db *DB) DetectorConfigRepository {
+	return &detectorConfigRepository{db: db}
+}
+
+// GetDetectorConfigs retrieves the global configuration (empty Ticker) and all per-ticker overrides
+func (r *detectorConfigRepository) GetDetectorConfigs(ctx context.Context) ([]*models.DetectorConfig, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_detector_configs", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT ticker, threshold, window_size, COALESCE(updated_by, ''), updated_at
+		FROM detector_config
+		ORDER BY ticker
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_detector_configs", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_detector_configs").Inc()
+		return nil, fmt.Errorf("failed to get detector configs: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []*models.DetectorConfig
+	for rows.Next() {
+		var config models.DetectorConfig
+		if err := rows.Scan(&config.Ticker, &config.Threshold, &config.WindowSize, &config.UpdatedBy, &config.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan detector config: %w", err)
+		}
+		if config.Ticker == globalDetectorScope {
+			config.Ticker = ""
+		}
+		configs = append(configs, &config)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating detector configs: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_detector_configs", "success").Inc()
+	return configs, nil
+}
+
+// SaveDetectorConfig inserts or replaces the global configuration or a per-ticker override
+func (r *detectorConfigRepository) SaveDetectorConfig(ctx context.Context, config *models.DetectorConfig) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_detector_config", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	config.Sanitize()
+	if err := config.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_detector_config", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("detector config validation failed: %w", err)
+	}
+
+	scope := config.Ticker
+	if scope == "" {
+		scope = globalDetectorScope
+	}
+
+	query := `
+		INSERT INTO detector_config (ticker, threshold, window_size, updated_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (ticker) DO UPDATE SET
+			threshold = EXCLUDED.threshold,
+			window_size = EXCLUDED.window_size,
+			updated_by = EXCLUDED.updated_by
+		RETURNING updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, scope, config.Threshold, config.WindowSize, config.UpdatedBy).Scan(&config.UpdatedAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_detector_config", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("save_detector_config").Inc()
+		return fmt.Errorf("failed to save detector config: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("save_detector_config", "success").Inc()
+	return nil
+}
+
+// DeleteDetectorConfig removes a per-ticker override so the ticker falls back to the global configuration
+func (r *detectorConfigRepository) DeleteDetectorConfig(ctx context.Context, ticker string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_detector_config", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `DELETE FROM detector_config WHERE ticker = $1 AND ticker <> $2`
+
+	result, err := r.db.ExecContext(ctx, query, ticker, globalDetectorScope)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_detector_config", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("delete_detector_config").Inc()
+		return fmt.Errorf("failed to delete detector config: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("detector override for %q: %w", ticker, ErrNotFound)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("delete_detector_config", "success").Inc()
+	return nil
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// ErrInvalidSort is returned when a list query asks to sort by an unsupported field
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// ListOptions holds the sorting, range filters and limit shared by list queries.
+// Nil range bounds are not applied. Since and Until are milliseconds since epoch.
+// OrderSet marks SortDesc as requested, so it also applies to the default sort.
+// Peek fetches one row past Limit, telling callers whether another page follows.
+type ListOptions struct {
+	SortBy   string
+	SortDesc bool
+	OrderSet bool
+	PriceMin *float64
+	PriceMax *float64
+	Since    *int64
+	Until    *int64
+	Limit    int
+	Peek     bool
+}
+
+// QuoteFilter selects quotes for ListQuotes. With Latest set only the most
+// recent quote of each ticker is considered.
+type QuoteFilter struct {
+	Ticker string
+	Sector string
+	Latest bool
+	ListOptions
+}
+
+// AnomalyFilter selects anomalies for ListAnomalies
+type AnomalyFilter struct {
+	Ticker    string
+	MinZScore float64
+	Severity  string
+	Status    string
+	ListOptions
+}
+
+// RawEventFilter selects raw events for StreamRawEvents. Events are returned
+// in id order starting after AfterID, so the last id seen is the cursor for
+// the next page. Zero-valued fields are not applied.
+type RawEventFilter struct {
+	Source  string
+	Symbol  string
+	Since   time.Time
+	Until   time.Time
+	AfterID int64
+	Limit   int
+}
+
+// MaxRawEventPage caps how many raw events one StreamRawEvents call returns
+const MaxRawEventPage = 100000
+
+// quoteSortColumns and anomalySortColumns map public sort names to columns
+var (
+	quoteSortColumns = map[string]string{
+		"ticker":    "ticker",
+		"price":     "price",
+		"timestamp": "timestamp",
+	}
+	anomalySortColumns = map[string]string{
+		"price":     "price",
+		"timestamp": "timestamp",
+		"zscore":    "z_score",
+	}
+)
+
+// whereBuilder accumulates positional SQL conditions and their arguments
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add appends a condition; cond contains a single %d for the placeholder index
+func (b *whereBuilder) add(cond string, arg interface{}) {
+	b.args = append(b.args, arg)
+	b.conditions = append(b.conditions, fmt.Sprintf(cond, len(b.args)))
+}
+
+// addRange applies the price and time bounds of opts
+func (b *whereBuilder) addRange(opts ListOptions) {
+	if opts.PriceMin != nil {
+		b.add("price >= $%d", *opts.PriceMin)
+	}
+	if opts.PriceMax != nil {
+		b.add("price <= $%d", *opts.PriceMax)
+	}
+	if opts.Since != nil {
+		b.add("timestamp >= $%d", *opts.Since)
+	}
+	if opts.Until != nil {
+		b.add("timestamp <= $%d", *opts.Until)
+	}
+}
+
+// clause renders the WHERE clause, or an empty string without conditions
+func (b *whereBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// orderClause renders ORDER BY/LIMIT for opts, falling back to defaultSort
+func orderClause(opts ListOptions, columns map[string]string, defaultSort string) (string, error) {
+	sortBy := opts.SortBy
+	desc := opts.SortDesc
+	if sortBy == "" {
+		sortBy = defaultSort
+		desc = !opts.OrderSet || opts.SortDesc
+	}
+
+	column, ok := columns[sortBy]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidSort, sortBy)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	limit := opts.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	if opts.Peek {
+		limit++
+	}
+
+	// timestamp breaks ties so pages are stable
+	order := fmt.Sprintf("ORDER BY %s %s", column, direction)
+	if column != "timestamp" {
+		order += ", timestamp DESC"
+	}
+	return fmt.Sprintf("%s LIMIT %d", order, limit), nil
+}
+
+// ListQuotes retrieves quotes matching filter, sorted and filtered in SQL
+func (r *quoteRepository) ListQuotes(ctx context.Context, filter QuoteFilter) ([]*models.NormalizedTick, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_quotes", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	order, err := orderClause(filter.ListOptions, quoteSortColumns, "timestamp")
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_quotes", "validation_error").Observe(time.Since(start).Seconds())
+		return nil, err
+	}
+
+	table := "quotes"
+	if filter.Latest {
+		table = "latest_quotes"
+	}
+
+	var where whereBuilder
+	where.addTenant(ctx)
+	if filter.Ticker != "" {
+		where.add("ticker = $%d", filter.Ticker)
+	}
+	if filter.Sector != "" {
+		where.add("sector = $%d", filter.Sector)
+	}
+	where.addRange(filter.ListOptions)
+
+	query := fmt.Sprintf(`SELECT ticker, price, timestamp, sector FROM %s %s %s`, table, where.clause(), order)
+
+	rows, err := r.db.Reader().QueryContext(ctx, query, where.args...)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_quotes", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_quotes").Inc()
+		return nil, fmt.Errorf("failed to list quotes: %w", err)
+	}
+	defer rows.Close()
+
+	var quotes []*models.NormalizedTick
+	for rows.Next() {
+		var quote models.NormalizedTick
+		if err := rows.Scan(&quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector); err != nil {
+			return nil, fmt.Errorf("failed to scan quote: %w", err)
+		}
+		quotes = append(quotes, &quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quotes: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_quotes", "success").Inc()
+	return quotes, nil
+}
+
+// ListAnomalies retrieves anomalies matching filter, sorted and filtered in SQL
+func (r *anomalyRepository) ListAnomalies(ctx context.Context, filter AnomalyFilter) ([]*models.Anomaly, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_anomalies", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	order, err := orderClause(filter.ListOptions, anomalySortColumns, "timestamp")
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_anomalies", "validation_error").Observe(time.Since(start).Seconds())
+		return nil, err
+	}
+
+	where := whereBuilder{conditions: []string{"deleted_at IS NULL"}}
+	where.addTenant(ctx)
+	if filter.Ticker != "" {
+		where.add("ticker = $%d", filter.Ticker)
+	}
+	if filter.MinZScore > 0 {
+		where.add("z_score >= $%d", filter.MinZScore)
+	}
+	if filter.Severity != "" {
+		where.add("severity = $%d", filter.Severity)
+	}
+	if filter.Status != "" {
+		where.add("status = $%d", filter.Status)
+	}
+	where.addRange(filter.ListOptions)
+
+	query := fmt.Sprintf(`SELECT ticker, price, z_score, timestamp FROM anomalies %s %s`, where.clause(), order)
+
+	rows, err := r.db.Reader().QueryContext(ctx, query, where.args...)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_anomalies", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_anomalies").Inc()
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	var anomalies []*models.Anomaly
+	for rows.Next() {
+		var anomaly models.Anomaly
+		if err := rows.Scan(&anomaly.Ticker, &anomaly.Price, &anomaly.ZScore, &anomaly.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		anomalies = append(anomalies, &anomaly)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating anomalies: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_anomalies", "success").Inc()
+	return anomalies, nil
+}
+
+// StreamRawEvents calls fn for each raw event matching filter without
+// buffering the result set. An error from fn stops iteration and is returned
+// unwrapped.
+func (r *rawEventRepository) StreamRawEvents(ctx context.Context, filter RawEventFilter, fn func(id int64, event *models.RawTick) error) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("stream_raw_events", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	limit := filter.Limit
+	if limit <= 0 || limit > MaxRawEventPage {
+		limit = MaxRawEventPage
+	}
+
+	var where whereBuilder
+	if filter.AfterID > 0 {
+		where.add("id > $%d", filter.AfterID)
+	}
+	if filter.Source != "" {
+		where.add("source = $%d", filter.Source)
+	}
+	if filter.Symbol != "" {
+		where.add("symbol = $%d", filter.Symbol)
+	}
+	if !filter.Since.IsZero() {
+		where.add("timestamp >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where.add("timestamp <= $%d", filter.Until)
+	}
+
+	query := fmt.Sprintf(`SELECT id, source, symbol, price, timestamp FROM raw_events %s ORDER BY id ASC LIMIT %d`, where.clause(), limit)
+
+	rows, err := r.db.Reader().QueryContext(ctx, query, where.args...)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("stream_raw_events", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("stream_raw_events").Inc()
+		return fmt.Errorf("failed to stream raw events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var event models.RawTick
+		if err := rows.Scan(&id, &event.Source, &event.Symbol, &event.Price, &event.Timestamp); err != nil {
+			return fmt.Errorf("failed to scan raw event: %w", err)
+		}
+		if err := fn(id, &event); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		metrics.DatabaseErrors.WithLabelValues("stream_raw_events").Inc()
+		return fmt.Errorf("error iterating raw events: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("stream_raw_events", "success").Inc()
+	return nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+func TestWhereBuilder_ScopesToVisibleTenants(t *testing.T) {
+	ctx := tenant.WithTenant(context.Background(), "acme")
+
+	var where whereBuilder
+	where.addTenant(ctx)
+	where.add("ticker = $%d", "BTCUSD")
+
+	if got, want := where.clause(), "WHERE tenant_id = ANY($1) AND ticker = $2"; got != want {
+		t.Errorf("clause = %q; want %q", got, want)
+	}
+	if got, want := where.args[0], []string{"acme", tenant.Default}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tenants = %v; want %v", got, want)
+	}
+}
+
+func TestWhereBuilder_DefaultTenantSeesOnlyDefault(t *testing.T) {
+	var where whereBuilder
+	where.addTenant(context.Background())
+
+	if got, want := where.args[0], []string{tenant.Default}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tenants = %v; want %v", got, want)
+	}
+}
+
+func TestOrderClause(t *testing.T) {
+	for _, tc := range []struct {
+		opts ListOptions
+		want string
+	}{
+		{ListOptions{}, "ORDER BY timestamp DESC LIMIT 100"},
+		{ListOptions{OrderSet: true}, "ORDER BY timestamp ASC LIMIT 100"},
+		{ListOptions{SortBy: "price", SortDesc: true, Limit: 10}, "ORDER BY price DESC, timestamp DESC LIMIT 10"},
+		{ListOptions{SortBy: "price", Limit: 5000}, "ORDER BY price ASC, timestamp DESC LIMIT 100"},
+		{ListOptions{Limit: 10, Peek: true}, "ORDER BY timestamp DESC LIMIT 11"},
+	} {
+		got, err := orderClause(tc.opts, quoteSortColumns, "timestamp")
+		if err != nil {
+			t.Fatalf("orderClause(%+v): %v", tc.opts, err)
+		}
+		if got != tc.want {
+			t.Errorf("orderClause(%+v) = %q; want %q", tc.opts, got, tc.want)
+		}
+	}
+
+	if _, err := orderClause(ListOptions{SortBy: "price; DROP TABLE quotes"}, quoteSortColumns, "timestamp"); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("orderClause with an unknown sort err = %v; want %v", err, ErrInvalidSort)
+	}
+}
@@ -2,11 +2,23 @@ package database
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
@@ -16,161 +28,96 @@ type Migration struct {
 	Description string
 	UpSQL       string
 	DownSQL     string
+	// Checksum is the hex SHA-256 of UpSQL, recorded when the migration is
+	// applied so later edits to an applied migration are detected
+	Checksum string
 }
 
-// Migrations holds all database migrations
-var Migrations = []Migration{
-	{
-		Version:     1,
-		Description: "Create initial schema",
-		UpSQL: `
-			-- Create quotes table
-			CREATE TABLE IF NOT EXISTS quotes (
-				id BIGSERIAL PRIMARY KEY,
-				ticker VARCHAR(10) NOT NULL,
-				price DECIMAL(20,8) NOT NULL CHECK (price > 0),
-				timestamp BIGINT NOT NULL,
-				sector VARCHAR(50) NOT NULL DEFAULT 'unknown',
-				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-			);
-
-			-- Create indexes for performance
-			CREATE INDEX IF NOT EXISTS idx_quotes_ticker ON quotes(ticker);
-			CREATE INDEX IF NOT EXISTS idx_quotes_timestamp ON quotes(timestamp);
-			CREATE INDEX IF NOT EXISTS idx_quotes_sector ON quotes(sector);
-			CREATE INDEX IF NOT EXISTS idx_quotes_ticker_timestamp ON quotes(ticker, timestamp DESC);
-
-			-- Create anomalies table
-			CREATE TABLE IF NOT EXISTS anomalies (
-				id BIGSERIAL PRIMARY KEY,
-				ticker VARCHAR(10) NOT NULL,
-				price DECIMAL(20,8) NOT NULL CHECK (price > 0),
-				z_score DECIMAL(10,4) NOT NULL CHECK (z_score >= 0),
-				timestamp BIGINT NOT NULL,
-				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-			);
-
-			-- Create indexes for anomalies
-			CREATE INDEX IF NOT EXISTS idx_anomalies_ticker ON anomalies(ticker);
-			CREATE INDEX IF NOT EXISTS idx_anomalies_timestamp ON anomalies(timestamp);
-			CREATE INDEX IF NOT EXISTS idx_anomalies_z_score ON anomalies(z_score);
-			CREATE INDEX IF NOT EXISTS idx_anomalies_ticker_timestamp ON anomalies(ticker, timestamp DESC);
-
-			-- Create raw_events table for audit trail
-			CREATE TABLE IF NOT EXISTS raw_events (
-				id BIGSERIAL PRIMARY KEY,
-				source VARCHAR(100) NOT NULL,
-				symbol VARCHAR(10) NOT NULL,
-				price DECIMAL(20,8) NOT NULL CHECK (price > 0),
-				timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
-				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-			);
-
-			-- Create indexes for raw_events
-			CREATE INDEX IF NOT EXISTS idx_raw_events_source ON raw_events(source);
-			CREATE INDEX IF NOT EXISTS idx_raw_events_symbol ON raw_events(symbol);
-			CREATE INDEX IF NOT EXISTS idx_raw_events_timestamp ON raw_events(timestamp);
-
-			-- Create sectors table for reference data
-			CREATE TABLE IF NOT EXISTS sectors (
-				id SERIAL PRIMARY KEY,
-				name VARCHAR(50) UNIQUE NOT NULL,
-				description TEXT,
-				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-			);
-
-			-- Insert default sectors
-			INSERT INTO sectors (name, description) VALUES
-				('crypto', 'Cryptocurrency assets'),
-				('stocks', 'Stock market securities'),
-				('forex', 'Foreign exchange markets'),
-				('commodities', 'Commodity markets'),
-				('unknown', 'Unknown or unclassified assets')
-			ON CONFLICT (name) DO NOTHING;
-
-			-- Create tickers table for reference data
-			CREATE TABLE IF NOT EXISTS tickers (
-				id SERIAL PRIMARY KEY,
-				symbol VARCHAR(10) UNIQUE NOT NULL,
-				name VARCHAR(100),
-				sector_id INTEGER REFERENCES sectors(id),
-				active BOOLEAN DEFAULT TRUE,
-				created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-			);
-
-			-- Create indexes for tickers
-			CREATE INDEX IF NOT EXISTS idx_tickers_symbol ON tickers(symbol);
-			CREATE INDEX IF NOT EXISTS idx_tickers_sector_id ON tickers(sector_id);
-			CREATE INDEX IF NOT EXISTS idx_tickers_active ON tickers(active);
-
-			-- Create latest_quotes view for efficient latest quote retrieval
-			CREATE OR REPLACE VIEW latest_quotes AS
-			SELECT DISTINCT ON (ticker) 
-				ticker,
-				price,
-				timestamp,
-				sector,
-				created_at
-			FROM quotes
-			ORDER BY ticker, timestamp DESC;
-
-			-- Create function to update updated_at timestamp
-			CREATE OR REPLACE FUNCTION update_updated_at_column()
-			RETURNS TRIGGER AS $$
-			BEGIN
-				NEW.updated_at = NOW();
-				RETURN NEW;
-			END;
-			$$ language 'plpgsql';
-
-			-- Create triggers for updated_at
-			CREATE TRIGGER update_quotes_updated_at BEFORE UPDATE ON quotes
-				FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
-
-			CREATE TRIGGER update_tickers_updated_at BEFORE UPDATE ON tickers
-				FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
-		`,
-		DownSQL: `
-			DROP TRIGGER IF EXISTS update_tickers_updated_at ON tickers;
-			DROP TRIGGER IF EXISTS update_quotes_updated_at ON quotes;
-			DROP FUNCTION IF EXISTS update_updated_at_column();
-			DROP VIEW IF EXISTS latest_quotes;
-			DROP TABLE IF EXISTS tickers;
-			DROP TABLE IF EXISTS sectors;
-			DROP TABLE IF EXISTS raw_events;
-			DROP TABLE IF EXISTS anomalies;
-			DROP TABLE IF EXISTS quotes;
-		`,
-	},
-	{
-		Version:     2,
-		Description: "Add partitioning for quotes table",
-		UpSQL: `
-			-- Create partitioned quotes table
-			CREATE TABLE IF NOT EXISTS quotes_partitioned (
-				LIKE quotes INCLUDING ALL
-			) PARTITION BY RANGE (timestamp);
-
-			-- Create partitions for current month and next month
-			CREATE TABLE IF NOT EXISTS quotes_2024_01 PARTITION OF quotes_partitioned
-				FOR VALUES FROM (1704067200000) TO (1706745600000);
-			CREATE TABLE IF NOT EXISTS quotes_2024_02 PARTITION OF quotes_partitioned
-				FOR VALUES FROM (1706745600000) TO (1709251200000);
-
-			-- Create indexes on partitions
-			CREATE INDEX IF NOT EXISTS idx_quotes_2024_01_ticker ON quotes_2024_01(ticker);
-			CREATE INDEX IF NOT EXISTS idx_quotes_2024_01_timestamp ON quotes_2024_01(timestamp);
-			CREATE INDEX IF NOT EXISTS idx_quotes_2024_02_ticker ON quotes_2024_02(ticker);
-			CREATE INDEX IF NOT EXISTS idx_quotes_2024_02_timestamp ON quotes_2024_02(timestamp);
-		`,
-		DownSQL: `
-			DROP TABLE IF EXISTS quotes_2024_02;
-			DROP TABLE IF EXISTS quotes_2024_01;
-			DROP TABLE IF EXISTS quotes_partitioned;
-		`,
-	},
+// ErrMigrationDrift is returned when an applied migration's recorded
+// checksum no longer matches its file
+var ErrMigrationDrift = errors.New("applied migrations differ from their files")
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations holds all database migrations, loaded from the embedded
+// migrations/NNNN_name.up.sql and optional NNNN_name.down.sql files. The
+// first line of an up file is a "-- " comment describing the migration.
+var Migrations = MustLoadMigrations(migrationFiles, "migrations")
+
+//go:embed tenant_migrations/*.sql
+var tenantMigrationFiles embed.FS
+
+// TenantMigrations holds the migrations of tenant schemas, in the layout of
+// Migrations. They are applied to the schema of every tenant with one of its
+// own and tracked in that schema's migrations table.
+var TenantMigrations = MustLoadMigrations(tenantMigrationFiles, "tenant_migrations")
+
+// migrationFileName matches migration file names, capturing the version and
+// the direction
+var migrationFileName = regexp.MustCompile(`^(\d+)_\w+\.(up|down)\.sql$`)
+
+// loadMigrations reads the migration files in dir of fsys, ordered by version
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version}
+			byVersion[version] = migration
+		}
+		if match[2] == "down" {
+			migration.DownSQL = string(content)
+			continue
+		}
+		if migration.UpSQL != "" {
+			return nil, fmt.Errorf("duplicate migration version %d", version)
+		}
+		firstLine, _, _ := strings.Cut(string(content), "\n")
+		description, ok := strings.CutPrefix(firstLine, "-- ")
+		if !ok {
+			return nil, fmt.Errorf("migration %s does not start with a description comment", entry.Name())
+		}
+		migration.Description = strings.TrimSpace(description)
+		migration.UpSQL = string(content)
+		sum := sha256.Sum256(content)
+		migration.Checksum = hex.EncodeToString(sum[:])
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, migration := range byVersion {
+		if migration.UpSQL == "" {
+			return nil, fmt.Errorf("migration %d has no up file", version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MustLoadMigrations is loadMigrations for embedded files, which are fixed
+// at build time
+func MustLoadMigrations(fsys fs.FS, dir string) []Migration {
+	migrations, err := loadMigrations(fsys, dir)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded migrations: %v", err))
+	}
+	return migrations
 }
 
 // MigrationStatus represents the status of a migration
@@ -179,17 +126,47 @@ type MigrationStatus struct {
 	Applied     bool      `json:"applied"`
 	AppliedAt   time.Time `json:"applied_at,omitempty"`
 	Description string    `json:"description"`
+	// Drifted is set when the migration's file changed after it was applied
+	Drifted bool `json:"drifted"`
 }
 
-// RunMigrations runs all pending database migrations
+// migrationsFor returns the migrations of the schema ctx's tenant uses:
+// TenantMigrations if it has a schema of its own, Migrations otherwise
+func (db *DB) migrationsFor(ctx context.Context) []Migration {
+	if _, ok := db.tenantSchema(ctx); ok {
+		return TenantMigrations
+	}
+	return Migrations
+}
+
+// RunMigrations runs all pending database migrations, in public and then in
+// the schema of every tenant with one of its own
 func (db *DB) RunMigrations(ctx context.Context) error {
-	logger.Log.Info("starting database migrations")
+	for _, id := range db.MigrationTenants() {
+		if err := db.runMigrations(tenant.WithTenant(ctx, id)); err != nil {
+			if id != tenant.Default {
+				return fmt.Errorf("schema %s: %w", TenantSchema(id), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigrations runs the pending migrations of the schema ctx's tenant uses
+func (db *DB) runMigrations(ctx context.Context) error {
+	logger.Log.Info("starting database migrations", zap.String("tenant", tenant.FromContext(ctx)))
 
 	// Create migrations table if it doesn't exist
 	if err := db.createMigrationsTable(ctx); err != nil {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
+	// Refuse to migrate a schema that no longer matches its files
+	if err := db.VerifyMigrations(ctx); err != nil {
+		return err
+	}
+
 	// Get applied migrations
 	applied, err := db.getAppliedMigrations(ctx)
 	if err != nil {
@@ -197,7 +174,7 @@ func (db *DB) RunMigrations(ctx context.Context) error {
 	}
 
 	// Run pending migrations
-	for _, migration := range Migrations {
+	for _, migration := range db.migrationsFor(ctx) {
 		if applied[migration.Version] {
 			logger.Log.Debug("migration already applied", zap.Int("version", migration.Version))
 			continue
@@ -218,14 +195,22 @@ func (db *DB) RunMigrations(ctx context.Context) error {
 	return nil
 }
 
-// createMigrationsTable creates the migrations tracking table
+// createMigrationsTable creates the migrations tracking table, and the
+// schema of ctx's tenant if it has one of its own
 func (db *DB) createMigrationsTable(ctx context.Context) error {
+	if schema, ok := db.tenantSchema(ctx); ok {
+		if _, err := db.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS `+pgx.Identifier{schema}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to create schema %s: %w", schema, err)
+		}
+	}
+
 	query := `
 		CREATE TABLE IF NOT EXISTS migrations (
 			version INTEGER PRIMARY KEY,
 			description TEXT NOT NULL,
 			applied_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 		);
+		ALTER TABLE migrations ADD COLUMN IF NOT EXISTS checksum CHAR(64);
 	`
 	_, err := db.ExecContext(ctx, query)
 	return err
@@ -252,6 +237,66 @@ func (db *DB) getAppliedMigrations(ctx context.Context) (map[int]bool, error) {
 	return applied, rows.Err()
 }
 
+// getAppliedChecksums returns the recorded checksum of each applied
+// migration; migrations applied before checksums were recorded have none
+func (db *DB) getAppliedChecksums(ctx context.Context) (map[int]sql.NullString, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, checksum FROM migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := make(map[int]sql.NullString)
+	for rows.Next() {
+		var version int
+		var checksum sql.NullString
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		checksums[version] = checksum
+	}
+
+	return checksums, rows.Err()
+}
+
+// VerifyMigrations compares the recorded checksum of every applied migration
+// with its file and returns ErrMigrationDrift listing the ones that differ.
+// Migrations applied before checksums were recorded adopt their current
+// checksum.
+func (db *DB) VerifyMigrations(ctx context.Context) error {
+	if err := db.createMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	checksums, err := db.getAppliedChecksums(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	var drifted []int
+	for _, migration := range db.migrationsFor(ctx) {
+		checksum, applied := checksums[migration.Version]
+		if !applied {
+			continue
+		}
+		if !checksum.Valid {
+			query := `UPDATE migrations SET checksum = $1 WHERE version = $2 AND checksum IS NULL`
+			if _, err := db.ExecContext(ctx, query, migration.Checksum, migration.Version); err != nil {
+				return fmt.Errorf("failed to record checksum of migration %d: %w", migration.Version, err)
+			}
+			continue
+		}
+		if checksum.String != migration.Checksum {
+			drifted = append(drifted, migration.Version)
+		}
+	}
+
+	if len(drifted) > 0 {
+		logger.Log.Error("applied migrations differ from their files", zap.Ints("versions", drifted))
+		return fmt.Errorf("%w: versions %v", ErrMigrationDrift, drifted)
+	}
+	return nil
+}
+
 // applyMigration applies a single migration
 func (db *DB) applyMigration(ctx context.Context, migration Migration) error {
 	// Start transaction
@@ -260,6 +305,9 @@ func (db *DB) applyMigration(ctx context.Context, migration Migration) error {
 		return err
 	}
 	defer tx.Rollback()
+	if err := db.confineToTenantSchema(ctx, tx); err != nil {
+		return err
+	}
 
 	// Execute migration SQL
 	if _, err := tx.ExecContext(ctx, migration.UpSQL); err != nil {
@@ -267,8 +315,8 @@ func (db *DB) applyMigration(ctx context.Context, migration Migration) error {
 	}
 
 	// Record migration as applied
-	query := `INSERT INTO migrations (version, description) VALUES ($1, $2)`
-	if _, err := tx.ExecContext(ctx, query, migration.Version, migration.Description); err != nil {
+	query := `INSERT INTO migrations (version, description, checksum) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, migration.Version, migration.Description, migration.Checksum); err != nil {
 		return fmt.Errorf("failed to record migration: %w", err)
 	}
 
@@ -278,17 +326,22 @@ func (db *DB) applyMigration(ctx context.Context, migration Migration) error {
 
 // GetMigrationStatus returns the status of all migrations
 func (db *DB) GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
-	applied, err := db.getAppliedMigrations(ctx)
+	if err := db.createMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	checksums, err := db.getAppliedChecksums(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var status []MigrationStatus
-	for _, migration := range Migrations {
+	for _, migration := range db.migrationsFor(ctx) {
+		checksum, applied := checksums[migration.Version]
 		ms := MigrationStatus{
 			Version:     migration.Version,
-			Applied:     applied[migration.Version],
+			Applied:     applied,
 			Description: migration.Description,
+			Drifted:     checksum.Valid && checksum.String != migration.Checksum,
 		}
 
 		if ms.Applied {
@@ -308,38 +361,153 @@ func (db *DB) GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error)
 
 // RollbackMigration rolls back the last applied migration
 func (db *DB) RollbackMigration(ctx context.Context) error {
-	// Get the last applied migration
-	query := `SELECT version, description FROM migrations ORDER BY version DESC LIMIT 1`
-	var version int
-	var description string
-	err := db.QueryRowContext(ctx, query).Scan(&version, &description)
+	steps, err := db.PlanRollback(ctx, 1)
 	if err != nil {
-		return fmt.Errorf("no migrations to rollback: %w", err)
+		return err
+	}
+	if len(steps) == 0 {
+		return fmt.Errorf("no migrations to rollback")
 	}
+	return db.ApplyMigrationSteps(ctx, steps)
+}
+
+// MigrationStep is a migration to apply, or to roll back when Down is set
+type MigrationStep struct {
+	Migration Migration
+	Down      bool
+}
+
+// SQL returns the statements the step executes
+func (s MigrationStep) SQL() string {
+	if s.Down {
+		return s.Migration.DownSQL
+	}
+	return s.Migration.UpSQL
+}
 
-	// Find the migration
-	var migration Migration
-	for _, m := range Migrations {
-		if m.Version == version {
-			migration = m
-			break
+// LatestMigrationVersion returns the highest known migration version
+func LatestMigrationVersion() int {
+	return latestVersion(Migrations)
+}
+
+// latestVersion returns the highest version of migrations
+func latestVersion(migrations []Migration) int {
+	latest := 0
+	for _, migration := range migrations {
+		latest = max(latest, migration.Version)
+	}
+	return latest
+}
+
+// findMigration returns the migration with the given version
+func findMigration(migrations []Migration, version int) (Migration, bool) {
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return migration, true
 		}
 	}
+	return Migration{}, false
+}
 
-	if migration.Version == 0 {
-		return fmt.Errorf("migration version %d not found", version)
+// PlanMigrateTo returns the steps bringing the schema to version: pending
+// migrations up to version are applied in ascending order, then applied
+// migrations above it are rolled back in descending order
+func (db *DB) PlanMigrateTo(ctx context.Context, version int) ([]MigrationStep, error) {
+	migrations := db.migrationsFor(ctx)
+	if version != 0 {
+		if _, ok := findMigration(migrations, version); !ok {
+			return nil, fmt.Errorf("migration version %d not found", version)
+		}
+	}
+	if err := db.VerifyMigrations(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := db.getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
 	}
 
-	logger.Log.Info("rolling back migration", 
-		zap.Int("version", version),
-		zap.String("description", description))
+	var steps []MigrationStep
+	for _, migration := range migrations {
+		if migration.Version <= version && !applied[migration.Version] {
+			steps = append(steps, MigrationStep{Migration: migration})
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > version && applied[migration.Version] {
+			steps = append(steps, MigrationStep{Migration: migration, Down: true})
+		}
+	}
+	return steps, nil
+}
 
+// PlanMigrateUp returns the steps applying every pending migration
+func (db *DB) PlanMigrateUp(ctx context.Context) ([]MigrationStep, error) {
+	return db.PlanMigrateTo(ctx, latestVersion(db.migrationsFor(ctx)))
+}
+
+// PlanRollback returns the steps rolling back the last n applied migrations
+func (db *DB) PlanRollback(ctx context.Context, n int) ([]MigrationStep, error) {
+	if err := db.createMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version FROM migrations ORDER BY version DESC LIMIT $1`, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []MigrationStep
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		migration, ok := findMigration(db.migrationsFor(ctx), version)
+		if !ok {
+			return nil, fmt.Errorf("migration version %d not found", version)
+		}
+		steps = append(steps, MigrationStep{Migration: migration, Down: true})
+	}
+	return steps, rows.Err()
+}
+
+// ApplyMigrationSteps runs steps in order, each in its own transaction. It
+// stops at the first step that fails; the steps before it stay applied.
+func (db *DB) ApplyMigrationSteps(ctx context.Context, steps []MigrationStep) error {
+	for _, step := range steps {
+		if !step.Down {
+			logger.Log.Info("applying migration",
+				zap.Int("version", step.Migration.Version),
+				zap.String("description", step.Migration.Description))
+			if err := db.applyMigration(ctx, step.Migration); err != nil {
+				return fmt.Errorf("failed to apply migration %d: %w", step.Migration.Version, err)
+			}
+			continue
+		}
+
+		logger.Log.Info("rolling back migration",
+			zap.Int("version", step.Migration.Version),
+			zap.String("description", step.Migration.Description))
+		if err := db.rollbackMigration(ctx, step.Migration); err != nil {
+			return fmt.Errorf("failed to roll back migration %d: %w", step.Migration.Version, err)
+		}
+	}
+	return nil
+}
+
+// rollbackMigration rolls back a single migration
+func (db *DB) rollbackMigration(ctx context.Context, migration Migration) error {
 	// Start transaction
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
+	if err := db.confineToTenantSchema(ctx, tx); err != nil {
+		return err
+	}
 
 	// Execute rollback SQL
 	if migration.DownSQL != "" {
@@ -349,11 +517,25 @@ func (db *DB) RollbackMigration(ctx context.Context) error {
 	}
 
 	// Remove migration record
-	query = `DELETE FROM migrations WHERE version = $1`
-	if _, err := tx.ExecContext(ctx, query, version); err != nil {
+	query := `DELETE FROM migrations WHERE version = $1`
+	if _, err := tx.ExecContext(ctx, query, migration.Version); err != nil {
 		return fmt.Errorf("failed to remove migration record: %w", err)
 	}
 
 	// Commit transaction
 	return tx.Commit()
-} 
\ No newline at end of file
+}
+
+// confineToTenantSchema limits tx to the schema of ctx's tenant, if it has
+// one of its own, so a tenant migration never falls through to a table of
+// the same name in public
+func (db *DB) confineToTenantSchema(ctx context.Context, tx *sql.Tx) error {
+	schema, ok := db.tenantSchema(ctx)
+	if !ok {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `SET LOCAL search_path TO `+pgx.Identifier{schema}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to set search_path: %w", err)
+	}
+	return nil
+}
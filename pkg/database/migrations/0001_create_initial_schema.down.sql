@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS update_tickers_updated_at ON tickers;
+DROP TRIGGER IF EXISTS update_quotes_updated_at ON quotes;
+DROP FUNCTION IF EXISTS update_updated_at_column();
+DROP VIEW IF EXISTS latest_quotes;
+DROP TABLE IF EXISTS tickers;
+DROP TABLE IF EXISTS sectors;
+DROP TABLE IF EXISTS raw_events;
+DROP TABLE IF EXISTS anomalies;
+DROP TABLE IF EXISTS quotes;
@@ -0,0 +1,109 @@
+-- Create initial schema
+
+-- Create quotes table
+CREATE TABLE IF NOT EXISTS quotes (
+	id BIGSERIAL PRIMARY KEY,
+	ticker VARCHAR(10) NOT NULL,
+	price DECIMAL(20,8) NOT NULL CHECK (price > 0),
+	timestamp BIGINT NOT NULL,
+	sector VARCHAR(50) NOT NULL DEFAULT 'unknown',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_quotes_ticker ON quotes(ticker);
+CREATE INDEX IF NOT EXISTS idx_quotes_timestamp ON quotes(timestamp);
+CREATE INDEX IF NOT EXISTS idx_quotes_sector ON quotes(sector);
+CREATE INDEX IF NOT EXISTS idx_quotes_ticker_timestamp ON quotes(ticker, timestamp DESC);
+
+-- Create anomalies table
+CREATE TABLE IF NOT EXISTS anomalies (
+	id BIGSERIAL PRIMARY KEY,
+	ticker VARCHAR(10) NOT NULL,
+	price DECIMAL(20,8) NOT NULL CHECK (price > 0),
+	z_score DECIMAL(10,4) NOT NULL CHECK (z_score >= 0),
+	timestamp BIGINT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create indexes for anomalies
+CREATE INDEX IF NOT EXISTS idx_anomalies_ticker ON anomalies(ticker);
+CREATE INDEX IF NOT EXISTS idx_anomalies_timestamp ON anomalies(timestamp);
+CREATE INDEX IF NOT EXISTS idx_anomalies_z_score ON anomalies(z_score);
+CREATE INDEX IF NOT EXISTS idx_anomalies_ticker_timestamp ON anomalies(ticker, timestamp DESC);
+
+-- Create raw_events table for audit trail
+CREATE TABLE IF NOT EXISTS raw_events (
+	id BIGSERIAL PRIMARY KEY,
+	source VARCHAR(100) NOT NULL,
+	symbol VARCHAR(10) NOT NULL,
+	price DECIMAL(20,8) NOT NULL CHECK (price > 0),
+	timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create indexes for raw_events
+CREATE INDEX IF NOT EXISTS idx_raw_events_source ON raw_events(source);
+CREATE INDEX IF NOT EXISTS idx_raw_events_symbol ON raw_events(symbol);
+CREATE INDEX IF NOT EXISTS idx_raw_events_timestamp ON raw_events(timestamp);
+
+-- Create sectors table for reference data
+CREATE TABLE IF NOT EXISTS sectors (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50) UNIQUE NOT NULL,
+	description TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Insert default sectors
+INSERT INTO sectors (name, description) VALUES
+	('crypto', 'Cryptocurrency assets'),
+	('stocks', 'Stock market securities'),
+	('forex', 'Foreign exchange markets'),
+	('commodities', 'Commodity markets'),
+	('unknown', 'Unknown or unclassified assets')
+ON CONFLICT (name) DO NOTHING;
+
+-- Create tickers table for reference data
+CREATE TABLE IF NOT EXISTS tickers (
+	id SERIAL PRIMARY KEY,
+	symbol VARCHAR(10) UNIQUE NOT NULL,
+	name VARCHAR(100),
+	sector_id INTEGER REFERENCES sectors(id),
+	active BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create indexes for tickers
+CREATE INDEX IF NOT EXISTS idx_tickers_symbol ON tickers(symbol);
+CREATE INDEX IF NOT EXISTS idx_tickers_sector_id ON tickers(sector_id);
+CREATE INDEX IF NOT EXISTS idx_tickers_active ON tickers(active);
+
+-- Create latest_quotes view for efficient latest quote retrieval
+CREATE OR REPLACE VIEW latest_quotes AS
+SELECT DISTINCT ON (ticker) 
+	ticker,
+	price,
+	timestamp,
+	sector,
+	created_at
+FROM quotes
+ORDER BY ticker, timestamp DESC;
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+	NEW.updated_at = NOW();
+	RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Create triggers for updated_at
+CREATE TRIGGER update_quotes_updated_at BEFORE UPDATE ON quotes
+	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_tickers_updated_at BEFORE UPDATE ON tickers
+	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
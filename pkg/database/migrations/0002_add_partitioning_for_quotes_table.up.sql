@@ -0,0 +1,13 @@
+-- Add partitioning for quotes table
+
+-- Create partitioned quotes table. Its partitions are created
+-- and dropped at runtime by PartitionManager. The primary key of
+-- quotes is left out since a unique index on a partitioned table
+-- must include the partition key.
+CREATE TABLE IF NOT EXISTS quotes_partitioned (
+	LIKE quotes INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+) PARTITION BY RANGE (timestamp);
+
+-- Create indexes, inherited by every partition
+CREATE INDEX IF NOT EXISTS idx_quotes_partitioned_ticker ON quotes_partitioned(ticker);
+CREATE INDEX IF NOT EXISTS idx_quotes_partitioned_timestamp ON quotes_partitioned(timestamp);
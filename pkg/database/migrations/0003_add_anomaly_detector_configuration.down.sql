@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_detector_config_updated_at ON detector_config;
+DROP TABLE IF EXISTS detector_config;
@@ -0,0 +1,13 @@
+-- Add anomaly detector configuration
+
+-- Detector parameters; ticker '*' holds the global defaults
+CREATE TABLE IF NOT EXISTS detector_config (
+	ticker VARCHAR(10) PRIMARY KEY,
+	threshold DECIMAL(10,4) NOT NULL CHECK (threshold > 0),
+	window_size INTEGER NOT NULL CHECK (window_size >= 2),
+	updated_by VARCHAR(100),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TRIGGER update_detector_config_updated_at BEFORE UPDATE ON detector_config
+	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
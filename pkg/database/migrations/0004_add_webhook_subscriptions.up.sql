@@ -0,0 +1,19 @@
+-- Add webhook subscriptions
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id BIGSERIAL PRIMARY KEY,
+	owner_id VARCHAR(100) NOT NULL,
+	url TEXT NOT NULL,
+	secret VARCHAR(128) NOT NULL,
+	tickers TEXT[] NOT NULL DEFAULT '{}',
+	severities TEXT[] NOT NULL DEFAULT '{}',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_owner_id ON webhook_subscriptions(owner_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_active ON webhook_subscriptions(active);
+
+CREATE TRIGGER update_webhook_subscriptions_updated_at BEFORE UPDATE ON webhook_subscriptions
+	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS anomaly_audit_log;
+DROP INDEX IF EXISTS idx_anomalies_not_deleted;
+ALTER TABLE anomalies
+	DROP COLUMN IF EXISTS deleted_by,
+	DROP COLUMN IF EXISTS deleted_at,
+	DROP COLUMN IF EXISTS created_by,
+	DROP COLUMN IF EXISTS note,
+	DROP COLUMN IF EXISTS source;
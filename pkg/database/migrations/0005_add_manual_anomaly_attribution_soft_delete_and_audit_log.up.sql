@@ -0,0 +1,20 @@
+-- Add manual anomaly attribution, soft delete and audit log
+
+ALTER TABLE anomalies
+	ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'detector' CHECK (source IN ('detector', 'manual')),
+	ADD COLUMN IF NOT EXISTS note TEXT,
+	ADD COLUMN IF NOT EXISTS created_by VARCHAR(100),
+	ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_anomalies_not_deleted ON anomalies(timestamp) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS anomaly_audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	anomaly_id BIGINT NOT NULL REFERENCES anomalies(id),
+	action VARCHAR(20) NOT NULL CHECK (action IN ('create', 'delete', 'restore')),
+	actor VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_anomaly_audit_log_anomaly_id ON anomaly_audit_log(anomaly_id);
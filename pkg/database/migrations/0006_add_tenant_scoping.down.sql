@@ -0,0 +1,17 @@
+DROP VIEW IF EXISTS latest_quotes;
+CREATE VIEW latest_quotes AS
+SELECT DISTINCT ON (ticker)
+	ticker,
+	price,
+	timestamp,
+	sector,
+	created_at
+FROM quotes
+ORDER BY ticker, timestamp DESC;
+
+DROP INDEX IF EXISTS idx_webhook_subscriptions_tenant_owner;
+DROP INDEX IF EXISTS idx_anomalies_tenant_timestamp;
+DROP INDEX IF EXISTS idx_quotes_tenant_ticker_timestamp;
+ALTER TABLE webhook_subscriptions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE anomalies DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE quotes DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,21 @@
+-- Add tenant scoping
+
+-- Existing rows and pipeline writes belong to the shared default tenant
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_quotes_tenant_ticker_timestamp ON quotes(tenant_id, ticker, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_anomalies_tenant_timestamp ON anomalies(tenant_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_tenant_owner ON webhook_subscriptions(tenant_id, owner_id);
+
+CREATE OR REPLACE VIEW latest_quotes AS
+SELECT DISTINCT ON (tenant_id, ticker)
+	ticker,
+	price,
+	timestamp,
+	sector,
+	created_at,
+	tenant_id
+FROM quotes
+ORDER BY tenant_id, ticker, timestamp DESC;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_watchlists_updated_at ON watchlists;
+DROP TABLE IF EXISTS watchlists;
@@ -0,0 +1,15 @@
+-- Add watchlists
+
+CREATE TABLE IF NOT EXISTS watchlists (
+	id BIGSERIAL PRIMARY KEY,
+	owner_id VARCHAR(100) NOT NULL,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	name VARCHAR(100) NOT NULL,
+	tickers TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE (tenant_id, owner_id, name)
+);
+
+CREATE TRIGGER update_watchlists_updated_at BEFORE UPDATE ON watchlists
+	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
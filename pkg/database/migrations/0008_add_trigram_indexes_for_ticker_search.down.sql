@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tickers_name_trgm;
+DROP INDEX IF EXISTS idx_tickers_symbol_trgm;
@@ -0,0 +1,6 @@
+-- Add trigram indexes for ticker search
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_tickers_symbol_trgm ON tickers USING GIN (symbol gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_tickers_name_trgm ON tickers USING GIN (LOWER(name) gin_trgm_ops);
@@ -0,0 +1,8 @@
+DELETE FROM anomaly_audit_log WHERE action = 'acknowledge';
+ALTER TABLE anomaly_audit_log DROP CONSTRAINT IF EXISTS anomaly_audit_log_action_check;
+ALTER TABLE anomaly_audit_log ADD CONSTRAINT anomaly_audit_log_action_check
+	CHECK (action IN ('create', 'delete', 'restore'));
+
+ALTER TABLE anomalies
+	DROP COLUMN IF EXISTS acknowledged_by,
+	DROP COLUMN IF EXISTS acknowledged_at;
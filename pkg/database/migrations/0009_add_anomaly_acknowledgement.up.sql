@@ -0,0 +1,9 @@
+-- Add anomaly acknowledgement
+
+ALTER TABLE anomalies
+	ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN IF NOT EXISTS acknowledged_by VARCHAR(100);
+
+ALTER TABLE anomaly_audit_log DROP CONSTRAINT IF EXISTS anomaly_audit_log_action_check;
+ALTER TABLE anomaly_audit_log ADD CONSTRAINT anomaly_audit_log_action_check
+	CHECK (action IN ('create', 'delete', 'restore', 'acknowledge'));
@@ -0,0 +1,30 @@
+-- Add users and refresh tokens
+
+CREATE TABLE IF NOT EXISTS users (
+	id BIGSERIAL PRIMARY KEY,
+	username VARCHAR(100) NOT NULL UNIQUE,
+	email VARCHAR(255),
+	password_hash VARCHAR(255) NOT NULL,
+	roles TEXT[] NOT NULL DEFAULT '{}',
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
+	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Only a SHA-256 hash of each refresh token is stored. Rotation revokes
+-- the presented token and records its successor.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE,
+	replaced_by BIGINT REFERENCES refresh_tokens(id),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
+UPDATE users SET roles = ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role);
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,29 @@
+-- Move user roles to roles and user_roles tables
+
+CREATE TABLE IF NOT EXISTS roles (
+	name VARCHAR(50) PRIMARY KEY,
+	description TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+INSERT INTO roles (name, description) VALUES
+	('admin', 'Full access'),
+	('user', 'Market data and own anomalies, webhooks and watchlists')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles (name)
+	SELECT DISTINCT unnest(roles) FROM users
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS user_roles (
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	granted_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO user_roles (user_id, role)
+	SELECT id, unnest(roles) FROM users
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN IF EXISTS roles;
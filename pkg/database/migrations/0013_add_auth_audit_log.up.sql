@@ -0,0 +1,16 @@
+-- Add auth audit log
+
+CREATE TABLE IF NOT EXISTS auth_audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	event_type VARCHAR(50) NOT NULL,
+	principal VARCHAR(255),
+	tenant_id VARCHAR(64),
+	ip VARCHAR(64) NOT NULL,
+	method VARCHAR(10) NOT NULL,
+	route TEXT NOT NULL,
+	detail TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_created_at ON auth_audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_principal ON auth_audit_log(principal, created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS candle_view_refreshes;
+DROP MATERIALIZED VIEW IF EXISTS candles_1h;
+DROP MATERIALIZED VIEW IF EXISTS candles_5m;
+DROP MATERIALIZED VIEW IF EXISTS candles_1m;
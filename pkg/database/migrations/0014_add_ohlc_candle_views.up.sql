@@ -0,0 +1,58 @@
+-- Add OHLC candle views
+
+-- One-minute candles per tenant and ticker. Created empty; CandleRefresher
+-- populates and refreshes them.
+CREATE MATERIALIZED VIEW IF NOT EXISTS candles_1m AS
+SELECT
+	tenant_id,
+	ticker,
+	timestamp - (timestamp % 60000) AS bucket,
+	(array_agg(price ORDER BY timestamp ASC))[1] AS open,
+	MAX(price) AS high,
+	MIN(price) AS low,
+	(array_agg(price ORDER BY timestamp DESC))[1] AS close,
+	COUNT(*) AS count
+FROM quotes
+GROUP BY tenant_id, ticker, bucket
+WITH NO DATA;
+
+-- Coarser candles roll up the one-minute ones
+CREATE MATERIALIZED VIEW IF NOT EXISTS candles_5m AS
+SELECT
+	tenant_id,
+	ticker,
+	bucket - (bucket % 300000) AS bucket,
+	(array_agg(open ORDER BY bucket ASC))[1] AS open,
+	MAX(high) AS high,
+	MIN(low) AS low,
+	(array_agg(close ORDER BY bucket DESC))[1] AS close,
+	SUM(count)::BIGINT AS count
+FROM candles_1m
+GROUP BY tenant_id, ticker, bucket - (bucket % 300000)
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS candles_1h AS
+SELECT
+	tenant_id,
+	ticker,
+	bucket - (bucket % 3600000) AS bucket,
+	(array_agg(open ORDER BY bucket ASC))[1] AS open,
+	MAX(high) AS high,
+	MIN(low) AS low,
+	(array_agg(close ORDER BY bucket DESC))[1] AS close,
+	SUM(count)::BIGINT AS count
+FROM candles_1m
+GROUP BY tenant_id, ticker, bucket - (bucket % 3600000)
+WITH NO DATA;
+
+-- Unique indexes allow REFRESH MATERIALIZED VIEW CONCURRENTLY
+CREATE UNIQUE INDEX IF NOT EXISTS idx_candles_1m_key ON candles_1m(tenant_id, ticker, bucket);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_candles_5m_key ON candles_5m(tenant_id, ticker, bucket);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_candles_1h_key ON candles_1h(tenant_id, ticker, bucket);
+
+-- refreshed_at (ms since epoch) is when the last refresh of each view began;
+-- quotes after it are read from the quotes table
+CREATE TABLE IF NOT EXISTS candle_view_refreshes (
+	view_name VARCHAR(32) PRIMARY KEY,
+	refreshed_at BIGINT NOT NULL
+);
@@ -0,0 +1,9 @@
+-- Add archive watermarks
+
+-- archived_until is the end of the span of a table's rows the archival
+-- service has exported; retention never deletes rows past it
+CREATE TABLE IF NOT EXISTS archive_watermarks (
+	table_name VARCHAR(64) PRIMARY KEY,
+	archived_until TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_anomalies_tenant_severity_timestamp;
+DROP INDEX IF EXISTS idx_anomalies_tenant_status_timestamp;
+
+ALTER TABLE anomalies
+	DROP COLUMN IF EXISTS status,
+	DROP COLUMN IF EXISTS detector,
+	DROP COLUMN IF EXISTS severity,
+	DROP COLUMN IF EXISTS type;
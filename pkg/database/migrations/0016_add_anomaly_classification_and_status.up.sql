@@ -0,0 +1,24 @@
+-- Add anomaly classification and status
+
+ALTER TABLE anomalies
+	ADD COLUMN IF NOT EXISTS type VARCHAR(32) NOT NULL DEFAULT 'price_spike',
+	ADD COLUMN IF NOT EXISTS severity VARCHAR(10) NOT NULL DEFAULT 'low' CHECK (severity IN ('low', 'medium', 'high')),
+	ADD COLUMN IF NOT EXISTS detector VARCHAR(64),
+	ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved'));
+
+-- Severity buckets match models.Anomaly.Severity; detector rows predate
+-- any detector but the z-score one
+UPDATE anomalies SET severity = CASE
+	WHEN z_score >= 6 THEN 'high'
+	WHEN z_score >= 4 THEN 'medium'
+	ELSE 'low'
+END;
+
+UPDATE anomalies SET detector = 'zscore' WHERE source = 'detector';
+
+UPDATE anomalies SET status = 'acknowledged' WHERE acknowledged_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_anomalies_tenant_status_timestamp
+	ON anomalies(tenant_id, status, timestamp DESC) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_anomalies_tenant_severity_timestamp
+	ON anomalies(tenant_id, severity, timestamp DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_ticker_timestamp_key;
@@ -0,0 +1,13 @@
+-- Add unique constraint on quotes ticker and timestamp
+
+-- SaveQuote and SaveQuotes upsert ON CONFLICT (ticker, timestamp), which
+-- needs a unique constraint to infer. Duplicates written before it existed
+-- are collapsed to the most recently inserted row, as an upsert would have.
+DELETE FROM quotes q
+USING quotes newer
+WHERE newer.ticker = q.ticker
+	AND newer.timestamp = q.timestamp
+	AND newer.id > q.id;
+
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_ticker_timestamp_key;
+ALTER TABLE quotes ADD CONSTRAINT quotes_ticker_timestamp_key UNIQUE (ticker, timestamp);
@@ -0,0 +1,5 @@
+-- Widen webhook secrets to fit encrypted secrets
+
+-- Secrets encrypted with DB_SECRET_KEY are longer than the 64-character
+-- hex secrets stored so far
+ALTER TABLE webhook_subscriptions ALTER COLUMN secret TYPE TEXT;
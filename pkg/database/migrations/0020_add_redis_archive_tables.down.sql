@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS redis_archive_raw_events;
+DROP TABLE IF EXISTS redis_archive_anomalies;
+DROP TABLE IF EXISTS redis_archive_quotes;
@@ -0,0 +1,32 @@
+-- Add Redis archive tables
+
+-- Entries the archival service moved out of Redis, one table per dataset.
+-- id is the stream entry ID or anomaly id, so archiving an entry again is a
+-- no-op; payload holds the entry's fields as stored in Redis.
+CREATE TABLE IF NOT EXISTS redis_archive_quotes (
+	id VARCHAR(64) PRIMARY KEY,
+	ticker VARCHAR(20),
+	timestamp BIGINT NOT NULL,
+	payload JSONB NOT NULL,
+	archived_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS redis_archive_anomalies (
+	id VARCHAR(64) PRIMARY KEY,
+	ticker VARCHAR(20),
+	timestamp BIGINT NOT NULL,
+	payload JSONB NOT NULL,
+	archived_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS redis_archive_raw_events (
+	id VARCHAR(64) PRIMARY KEY,
+	ticker VARCHAR(20),
+	timestamp BIGINT NOT NULL,
+	payload JSONB NOT NULL,
+	archived_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_redis_archive_quotes_ticker_timestamp ON redis_archive_quotes(ticker, timestamp);
+CREATE INDEX IF NOT EXISTS idx_redis_archive_anomalies_ticker_timestamp ON redis_archive_anomalies(ticker, timestamp);
+CREATE INDEX IF NOT EXISTS idx_redis_archive_raw_events_timestamp ON redis_archive_raw_events(timestamp);
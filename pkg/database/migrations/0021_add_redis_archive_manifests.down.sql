@@ -0,0 +1 @@
+DROP TABLE IF EXISTS redis_archive_manifests;
@@ -0,0 +1,18 @@
+-- Add Redis archive manifests
+
+-- One row per batch the archival service saved to a redis_archive_* table,
+-- describing the rows it left there so their loss or alteration can be
+-- detected later. checksum is the SHA-256 of the batch's rows as computed by
+-- the archive repository, ids the ids of the rows.
+CREATE TABLE IF NOT EXISTS redis_archive_manifests (
+	id BIGSERIAL PRIMARY KEY,
+	dataset VARCHAR(32) NOT NULL,
+	records INTEGER NOT NULL,
+	min_timestamp BIGINT NOT NULL,
+	max_timestamp BIGINT NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	ids TEXT[] NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_redis_archive_manifests_dataset_timestamps ON redis_archive_manifests(dataset, min_timestamp, max_timestamp);
@@ -0,0 +1,21 @@
+-- Add archive catalog
+
+-- One row per Parquet file the archival service uploaded, keyed by its
+-- object key, describing the dataset, day and ticker partition it belongs
+-- to so jobs reading the bucket can find files without listing it. ticker
+-- is empty for entries without one.
+CREATE TABLE IF NOT EXISTS archive_catalog (
+	object TEXT PRIMARY KEY,
+	dataset VARCHAR(32) NOT NULL,
+	date DATE NOT NULL,
+	ticker VARCHAR(20) NOT NULL DEFAULT '',
+	records INTEGER NOT NULL,
+	bytes BIGINT NOT NULL,
+	min_timestamp BIGINT NOT NULL,
+	max_timestamp BIGINT NOT NULL,
+	sha256 CHAR(64) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_archive_catalog_partition ON archive_catalog(dataset, date, ticker);
@@ -0,0 +1,11 @@
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_tenant_ticker_timestamp_key;
+
+-- Quotes of different tenants sharing a ticker and timestamp are collapsed
+-- to the most recently inserted row, as 0018 does
+DELETE FROM quotes q
+USING quotes newer
+WHERE newer.ticker = q.ticker
+	AND newer.timestamp = q.timestamp
+	AND newer.id > q.id;
+
+ALTER TABLE quotes ADD CONSTRAINT quotes_ticker_timestamp_key UNIQUE (ticker, timestamp);
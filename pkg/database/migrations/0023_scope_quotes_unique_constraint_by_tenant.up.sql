@@ -0,0 +1,9 @@
+-- Scope quotes unique constraint by tenant
+
+-- Tenants store quotes independently, so two tenants saving a quote for the
+-- same ticker and timestamp must not upsert each other's row. SaveQuote,
+-- SaveQuotes and BackfillQuotes resolve conflicts on
+-- (tenant_id, ticker, timestamp).
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_ticker_timestamp_key;
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_tenant_ticker_timestamp_key;
+ALTER TABLE quotes ADD CONSTRAINT quotes_tenant_ticker_timestamp_key UNIQUE (tenant_id, ticker, timestamp);
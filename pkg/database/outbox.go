@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+)
+
+// OutboxChannel is notified whenever an outbox event is written, so the
+// relay need not wait for its next poll
+const OutboxChannel = "outbox_events"
+
+// Redis streams outbox events are relayed to
+const (
+	OutboxAnomalyStream   = "events:anomalies"
+	OutboxReferenceStream = "events:reference"
+)
+
+// Outbox event types
+const (
+	EventAnomalyCreated       = "anomaly.created"
+	EventAnomalyDeleted       = "anomaly.deleted"
+	EventAnomalyRestored      = "anomaly.restored"
+	EventAnomalyAcknowledged  = "anomaly.acknowledged"
+	EventTickerCreated        = "ticker.created"
+	EventTickerSectorAssigned = "ticker.sector_assigned"
+	EventTickerDeactivated    = "ticker.deactivated"
+	EventSectorCreated        = "sector.created"
+	EventSectorUpdated        = "sector.updated"
+	EventSectorDeleted        = "sector.deleted"
+)
+
+// OutboxEvent is a change committed to Postgres awaiting publication to
+// Stream. Payload is the JSON-encoded event body.
+type OutboxEvent struct {
+	ID        int64
+	Stream    string
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// OutboxRepository defines the interface for relaying outbox events
+type OutboxRepository interface {
+	PublishOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []*OutboxEvent) error) (int, error)
+	DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// outboxRepository implements OutboxRepository
+type outboxRepository struct {
+	db *DB
+}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository(db *DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// enqueueOutboxEvent records an event in tx, so it is published if and only
+// if tx commits
+func enqueueOutboxEvent(ctx context.Context, tx *sql.Tx, stream, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	query := `INSERT INTO outbox (stream, event_type, payload) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, stream, eventType, string(data)); err != nil {
+		return fmt.Errorf("failed to write %s event: %w", eventType, err)
+	}
+	// Delivered on commit
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, '')`, OutboxChannel); err != nil {
+		return fmt.Errorf("failed to notify outbox relay: %w", err)
+	}
+	return nil
+}
+
+// PublishOutboxEvents passes up to limit of the oldest unpublished events to
+// publish and marks them published once it returns nil. If publish fails the
+// events stay unpublished and are passed again on a later call, so events
+// are delivered at least once. Concurrent relays skip each other's events.
+func (r *outboxRepository) PublishOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []*OutboxEvent) error) (int, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("publish_outbox_events", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	var events []*OutboxEvent
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, stream, event_type, payload::text, created_at
+			FROM outbox
+			WHERE published_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids := make([]int64, 0, limit)
+		for rows.Next() {
+			var event OutboxEvent
+			var payload string
+			if err := rows.Scan(&event.ID, &event.Stream, &event.Type, &payload, &event.CreatedAt); err != nil {
+				return fmt.Errorf("failed to scan outbox event: %w", err)
+			}
+			event.Payload = json.RawMessage(payload)
+			events = append(events, &event)
+			ids = append(ids, event.ID)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating outbox events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := publish(ctx, events); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE outbox SET published_at = NOW() WHERE id = ANY($1)`, ids)
+		return err
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("publish_outbox_events", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("publish_outbox_events").Inc()
+		return 0, fmt.Errorf("failed to publish outbox events: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("publish_outbox_events", "success").Add(float64(len(events)))
+	return len(events), nil
+}
+
+// DeletePublishedOutboxEvents removes events published before before
+func (r *outboxRepository) DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_published_outbox_events", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_published_outbox_events", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("delete_published_outbox_events").Inc()
+		return 0, fmt.Errorf("failed to delete published outbox events: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox events: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("delete_published_outbox_events", "success").Inc()
+	return deleted, nil
+}
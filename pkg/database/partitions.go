@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Partition intervals of quotes_partitioned
+const (
+	PartitionMonthly = "monthly"
+	PartitionDaily   = "daily"
+)
+
+// partitionLockKey is the advisory lock serializing partition maintenance
+// across replicas
+const partitionLockKey = 7265110
+
+// partitionedQuotesTable is the parent table the manager maintains
+const partitionedQuotesTable = "quotes_partitioned"
+
+// PartitionConfig configures partition maintenance for quotes_partitioned
+type PartitionConfig struct {
+	// Interval is PartitionMonthly or PartitionDaily
+	Interval string
+	// Premake is how many partitions past the current one are kept ready
+	Premake int
+	// Retention is how long partitions are kept after their range ends;
+	// zero keeps them forever
+	Retention time.Duration
+	// CheckInterval is how often partitions are maintained
+	CheckInterval time.Duration
+}
+
+// NewPartitionConfig creates a partition configuration from environment variables
+func NewPartitionConfig() *PartitionConfig {
+	return &PartitionConfig{
+		Interval:      getEnvOrDefault("QUOTES_PARTITION_INTERVAL", PartitionMonthly),
+		Premake:       getEnvIntOrDefault("QUOTES_PARTITION_PREMAKE", 3),
+		Retention:     getEnvDurationOrDefault("QUOTES_PARTITION_RETENTION", 0),
+		CheckInterval: getEnvDurationOrDefault("QUOTES_PARTITION_CHECK_INTERVAL", time.Hour),
+	}
+}
+
+// Validate checks the configuration
+func (c *PartitionConfig) Validate() error {
+	if c.Interval != PartitionMonthly && c.Interval != PartitionDaily {
+		return fmt.Errorf("partition interval must be %q or %q, got %q", PartitionMonthly, PartitionDaily, c.Interval)
+	}
+	if c.Premake < 0 {
+		return fmt.Errorf("partition premake must not be negative")
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("partition retention must not be negative")
+	}
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("partition check interval must be positive")
+	}
+	return nil
+}
+
+// partition is a child of quotes_partitioned holding the timestamps
+// (milliseconds since the epoch) in [from, to)
+type partition struct {
+	name     string
+	from, to int64
+}
+
+// partitionNameFormats map partition names to the start of their range.
+// Monthly partitions are named quotes_YYYY_MM and daily ones quotes_YYYY_MM_DD.
+var partitionNameFormats = map[string]string{
+	PartitionMonthly: "quotes_2006_01",
+	PartitionDaily:   "quotes_2006_01_02",
+}
+
+// partitionAt returns the partition of the given interval containing t
+func partitionAt(interval string, t time.Time) partition {
+	t = t.UTC()
+	var start, end time.Time
+	if interval == PartitionDaily {
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 0, 1)
+	} else {
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+	}
+	return partition{
+		name: start.Format(partitionNameFormats[interval]),
+		from: start.UnixMilli(),
+		to:   end.UnixMilli(),
+	}
+}
+
+// parsePartition recovers the range of a partition from its name. Names in
+// neither format belong to partitions the manager leaves alone.
+func parsePartition(name string) (partition, bool) {
+	for interval, format := range partitionNameFormats {
+		if len(name) != len(format) {
+			continue
+		}
+		start, err := time.Parse(format, name)
+		if err != nil {
+			continue
+		}
+		return partitionAt(interval, start), true
+	}
+	return partition{}, false
+}
+
+// PartitionManager creates quotes_partitioned partitions ahead of time and
+// drops the ones past retention
+type PartitionManager struct {
+	db     *DB
+	config *PartitionConfig
+}
+
+// NewPartitionManager creates a new partition manager
+func NewPartitionManager(db *DB, config *PartitionConfig) *PartitionManager {
+	return &PartitionManager{db: db, config: config}
+}
+
+// Run maintains partitions immediately and then every CheckInterval until
+// ctx is done
+func (m *PartitionManager) Run(ctx context.Context) {
+	logger.Log.Info("partition manager started",
+		zap.String("interval", m.config.Interval),
+		zap.Int("premake", m.config.Premake),
+		zap.Duration("retention", m.config.Retention))
+
+	ticker := time.NewTicker(m.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.Maintain(ctx); err != nil && ctx.Err() == nil {
+			logger.Log.Error("partition maintenance failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Log.Info("partition manager stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain creates the current partition and the next Premake ones, and
+// drops partitions whose range ended more than Retention ago. A partition
+// overlapping an existing one, e.g. a daily partition inside a monthly one
+// left from before the interval changed, is not created.
+func (m *PartitionManager) Maintain(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("maintain_partitions", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	err := m.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, partitionLockKey); err != nil {
+			return fmt.Errorf("failed to acquire partition lock: %w", err)
+		}
+
+		existing, err := listPartitions(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for i := 0; i <= m.config.Premake; i++ {
+			next := m.partitionAfter(now, i)
+			if overlaps(existing, next) {
+				continue
+			}
+			if err := createPartition(ctx, tx, next); err != nil {
+				return err
+			}
+			existing = append(existing, next)
+		}
+
+		if m.config.Retention == 0 {
+			return nil
+		}
+		cutoff := now.Add(-m.config.Retention).UnixMilli()
+		for _, p := range existing {
+			if p.to > cutoff {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS `+pgx.Identifier{p.name}.Sanitize()); err != nil {
+				return fmt.Errorf("failed to drop partition %s: %w", p.name, err)
+			}
+			logger.Log.Info("dropped expired partition", zap.String("partition", p.name))
+			metrics.DatabaseOperations.WithLabelValues("drop_partition", "success").Inc()
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("maintain_partitions", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("maintain_partitions").Inc()
+		return fmt.Errorf("failed to maintain partitions: %w", err)
+	}
+	return nil
+}
+
+// partitionAfter returns the partition n intervals after the one holding now
+func (m *PartitionManager) partitionAfter(now time.Time, n int) partition {
+	if m.config.Interval == PartitionDaily {
+		return partitionAt(PartitionDaily, now.AddDate(0, 0, n))
+	}
+	// Step from the first of the month so e.g. Jan 31 + 1 month is February
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return partitionAt(PartitionMonthly, first.AddDate(0, n, 0))
+}
+
+// listPartitions returns the managed partitions of quotes_partitioned,
+// oldest first
+func listPartitions(ctx context.Context, tx *sql.Tx) ([]partition, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = $1
+	`, partitionedQuotesTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan partition: %w", err)
+		}
+		if p, ok := parsePartition(name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating partitions: %w", err)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].from < partitions[j].from })
+	return partitions, nil
+}
+
+// overlaps reports whether p shares any timestamps with existing partitions
+func overlaps(existing []partition, p partition) bool {
+	for _, e := range existing {
+		if e.from < p.to && p.from < e.to {
+			return true
+		}
+	}
+	return false
+}
+
+// createPartition attaches a new partition for p's range. Indexes defined on
+// quotes_partitioned are created on it automatically.
+func createPartition(ctx context.Context, tx *sql.Tx, p partition) error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%d) TO (%d)`,
+		pgx.Identifier{p.name}.Sanitize(), partitionedQuotesTable, p.from, p.to)
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create partition %s: %w", p.name, err)
+	}
+	logger.Log.Info("created partition", zap.String("partition", p.name))
+	metrics.DatabaseOperations.WithLabelValues("create_partition", "success").Inc()
+	return nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// PoolStats is a snapshot of a database connection pool
+type PoolStats struct {
+	MaxOpenConnections int
+	OpenConnections    int
+	InUse              int
+	Idle               int
+	// WaitCount is the number of acquisitions that found no idle
+	// connection, and WaitDuration the time spent acquiring, since the
+	// pool was opened
+	WaitCount         int64
+	WaitDuration      time.Duration
+	MaxIdleClosed     int64
+	MaxLifetimeClosed int64
+}
+
+// Exhausted reports whether every connection the pool may open is in use,
+// so further queries wait for one to be released
+func (s PoolStats) Exhausted() bool {
+	return s.MaxOpenConnections > 0 && s.InUse >= s.MaxOpenConnections
+}
+
+// PoolStats returns the statistics of the primary's connection pool, which
+// the embedded *sql.DB and Pool share
+func (db *DB) PoolStats() PoolStats {
+	stats := db.Pool.Stat()
+	return PoolStats{
+		MaxOpenConnections: int(stats.MaxConns()),
+		OpenConnections:    int(stats.TotalConns()),
+		InUse:              int(stats.AcquiredConns()),
+		Idle:               int(stats.IdleConns()),
+		WaitCount:          stats.EmptyAcquireCount(),
+		WaitDuration:       stats.AcquireDuration(),
+		MaxIdleClosed:      stats.MaxIdleDestroyCount(),
+		MaxLifetimeClosed:  stats.MaxLifetimeDestroyCount(),
+	}
+}
+
+// PoolStatsSource is a database whose connection pool can be observed
+type PoolStatsSource interface {
+	PoolStats() PoolStats
+}
+
+// PoolStatsExporter publishes connection pool statistics as Prometheus
+// gauges, so pool exhaustion shows before requests start timing out
+type PoolStatsExporter struct {
+	db       PoolStatsSource
+	interval time.Duration
+}
+
+// NewPoolStatsExporter creates an exporter running every DB_STATS_INTERVAL
+func NewPoolStatsExporter(db PoolStatsSource) *PoolStatsExporter {
+	return &PoolStatsExporter{
+		db:       db,
+		interval: getEnvDurationOrDefault("DB_STATS_INTERVAL", 15*time.Second),
+	}
+}
+
+// Run exports the statistics immediately and then every interval until ctx
+// is done
+func (e *PoolStatsExporter) Run(ctx context.Context) {
+	logger.Log.Info("database pool stats exporter started", zap.Duration("interval", e.interval))
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		e.Export()
+
+		select {
+		case <-ctx.Done():
+			logger.Log.Info("database pool stats exporter stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export sets the pool gauges from the current statistics
+func (e *PoolStatsExporter) Export() {
+	stats := e.db.PoolStats()
+	metrics.DatabasePoolConnections.WithLabelValues("max").Set(float64(stats.MaxOpenConnections))
+	metrics.DatabasePoolConnections.WithLabelValues("open").Set(float64(stats.OpenConnections))
+	metrics.DatabasePoolConnections.WithLabelValues("in_use").Set(float64(stats.InUse))
+	metrics.DatabasePoolConnections.WithLabelValues("idle").Set(float64(stats.Idle))
+	metrics.DatabasePoolWaitCount.Set(float64(stats.WaitCount))
+	metrics.DatabasePoolWaitDuration.Set(stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	// databasePackage prefixes the names of functions in this package as
+	// reported by runtime.Frame.Function
+	databasePackage = "github.com/alim08/fin_line/pkg/database."
+	// explainInterval is how long after explaining a slow statement it is
+	// not explained again
+	explainInterval = 10 * time.Minute
+	// explainTimeout bounds an EXPLAIN of a slow statement
+	explainTimeout = 5 * time.Second
+)
+
+// queryTracer times every statement run on a pool, labeled by the
+// repository method that issued it, and logs statements slower than
+// slowThreshold. Bound arguments are never logged, only their types. With
+// explain set, the plan of each slow statement is logged as well.
+// Statements run outside a transaction are given a deadline of their
+// method's statementTimeout; transactions set theirs on the server instead.
+type queryTracer struct {
+	slowThreshold    time.Duration
+	explain          bool
+	statementTimeout func(method string) time.Duration
+
+	// pool runs the EXPLAINs; it is the pool the tracer is attached to and
+	// is set once that pool is open
+	pool *pgxpool.Pool
+	// explained maps statements to when they were last explained
+	explained sync.Map
+}
+
+// queryTraceKey is the context key of the queryTrace of a running statement
+type queryTraceKey struct{}
+
+// skipTraceKey marks the context of the tracer's own EXPLAINs
+type skipTraceKey struct{}
+
+// queryTrace is a statement in flight
+type queryTrace struct {
+	start  time.Time
+	sql    string
+	args   []any
+	method string
+	// cancel releases the statement's deadline, if it was given one
+	cancel context.CancelFunc
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if ctx.Value(skipTraceKey{}) != nil {
+		return ctx
+	}
+	trace := &queryTrace{
+		start:  time.Now(),
+		sql:    data.SQL,
+		args:   data.Args,
+		method: callerMethod(),
+	}
+	if t.statementTimeout != nil && conn.PgConn().TxStatus() == 'I' {
+		if timeout := t.statementTimeout(trace.method); timeout > 0 {
+			ctx, trace.cancel = context.WithTimeout(ctx, timeout)
+		}
+	}
+	return context.WithValue(ctx, queryTraceKey{}, trace)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer. For queries it runs when the
+// rows are closed, so the time spent reading them counts.
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace, ok := ctx.Value(queryTraceKey{}).(*queryTrace)
+	if !ok {
+		return
+	}
+	if trace.cancel != nil {
+		trace.cancel()
+	}
+
+	elapsed := time.Since(trace.start)
+	metrics.DatabaseQueryDuration.WithLabelValues(trace.method).Observe(elapsed.Seconds())
+	if t.slowThreshold <= 0 || elapsed < t.slowThreshold {
+		return
+	}
+
+	metrics.DatabaseSlowQueries.WithLabelValues(trace.method).Inc()
+	fields := []zap.Field{
+		zap.String("method", trace.method),
+		zap.Duration("duration", elapsed),
+		zap.String("sql", compactSQL(trace.sql)),
+		zap.Strings("arg_types", argTypes(trace.args)),
+	}
+	if data.Err != nil {
+		fields = append(fields, zap.Error(data.Err))
+	}
+	logger.Log.Warn("slow query", fields...)
+
+	if t.explain && t.pool != nil && explainable(trace.sql) && t.shouldExplain(trace.sql) {
+		go t.explainQuery(trace)
+	}
+}
+
+// shouldExplain reports whether sql has not been explained in the last
+// explainInterval, and if so records that it is being explained now
+func (t *queryTracer) shouldExplain(sql string) bool {
+	now := time.Now()
+	if last, ok := t.explained.Load(sql); ok && now.Sub(last.(time.Time)) < explainInterval {
+		return false
+	}
+	t.explained.Store(sql, now)
+	return true
+}
+
+// explainQuery logs the plan of a slow statement. Plain EXPLAIN plans the
+// statement without running it, so writes are safe to explain.
+func (t *queryTracer) explainQuery(trace *queryTrace) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), skipTraceKey{}, true), explainTimeout)
+	defer cancel()
+
+	rows, err := t.pool.Query(ctx, "EXPLAIN "+trace.sql, trace.args...)
+	if err != nil {
+		logger.Log.Warn("failed to explain slow query", zap.String("method", trace.method), zap.Error(err))
+		return
+	}
+	plan, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		logger.Log.Warn("failed to explain slow query", zap.String("method", trace.method), zap.Error(err))
+		return
+	}
+
+	logger.Log.Warn("slow query plan",
+		zap.String("method", trace.method),
+		zap.String("sql", compactSQL(trace.sql)),
+		zap.String("plan", strings.Join(plan, "\n")))
+}
+
+// explainable reports whether sql is a statement EXPLAIN accepts
+func explainable(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH":
+		return true
+	}
+	return false
+}
+
+// callerMethod names the function of this package that issued the current
+// statement, e.g. "anomalyRepository.GetAnomaliesByStatus". The innermost
+// exported method or function on the stack is preferred, so statements run
+// by helpers and transaction closures are attributed to the method calling
+// them, and DB.Transaction is passed over for the method calling it.
+// Statements not issued from this package are labeled "other".
+func callerMethod() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	var fallback string
+	for {
+		frame, more := frames.Next()
+		if name, ok := strings.CutPrefix(frame.Function, databasePackage); ok {
+			name = trimClosures(name)
+			if name == "DB.Transaction" {
+				if !more {
+					break
+				}
+				continue
+			}
+			if isExported(name) {
+				return name
+			}
+			if fallback == "" {
+				fallback = name
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	if fallback == "" {
+		return "other"
+	}
+	return fallback
+}
+
+// trimClosures turns a runtime function name such as
+// "(*manualAnomalyRepository).AcknowledgeAnomaly.func1" into
+// "manualAnomalyRepository.AcknowledgeAnomaly"
+func trimClosures(name string) string {
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "func") && i > 0 {
+			return strings.Join(parts[:i], ".")
+		}
+	}
+	return name
+}
+
+// isExported reports whether the last element of a dotted name is exported
+func isExported(name string) bool {
+	last := name[strings.LastIndex(name, ".")+1:]
+	return last != "" && unicode.IsUpper([]rune(last)[0])
+}
+
+// compactSQL collapses the whitespace of a statement onto one line
+func compactSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// argTypes describes bound arguments without their values
+func argTypes(args []any) []string {
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = fmt.Sprintf("$%d=%T", i+1, arg)
+	}
+	return types
+}
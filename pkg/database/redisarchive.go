@@ -0,0 +1,299 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/jackc/pgx/v5"
+)
+
+// Datasets the archival service moves out of Redis
+const (
+	ArchiveDatasetQuotes    = "quotes"
+	ArchiveDatasetAnomalies = "anomalies"
+	ArchiveDatasetRawEvents = "raw_events"
+)
+
+// redisArchiveTables maps each dataset to its archive table
+var redisArchiveTables = map[string]string{
+	ArchiveDatasetQuotes:    "redis_archive_quotes",
+	ArchiveDatasetAnomalies: "redis_archive_anomalies",
+	ArchiveDatasetRawEvents: "redis_archive_raw_events",
+}
+
+// archiveInsertBatch is the rows per INSERT statement; each row takes four
+// parameters, well within the 65535 Postgres allows
+const archiveInsertBatch = 1000
+
+// ArchivedRecord is an entry archived from Redis. ID is its stream entry ID
+// or anomaly id, Timestamp its time in milliseconds since the epoch and
+// Payload its fields as a JSON object.
+type ArchivedRecord struct {
+	ID        string          `json:"id"`
+	Ticker    string          `json:"ticker,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// ArchiveManifest describes a batch of records saved to an archive table:
+// how many there were, their time span and a checksum of their rows, so a
+// later check can tell whether they are still there unchanged
+type ArchiveManifest struct {
+	ID           int64     `json:"id"`
+	Dataset      string    `json:"dataset"`
+	Records      int       `json:"records"`
+	MinTimestamp int64     `json:"min_timestamp"`
+	MaxTimestamp int64     `json:"max_timestamp"`
+	Checksum     string    `json:"checksum"`
+	IDs          []string  `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// archiveChecksumQuery describes the rows of an archive table with the
+// given ids: their count, time span and the SHA-256 of their ids and
+// payloads, in id order
+const archiveChecksumQuery = `SELECT count(*), COALESCE(min(timestamp), 0), COALESCE(max(timestamp), 0),
+	encode(sha256(convert_to(COALESCE(string_agg(id || ':' || payload::text, E'\n' ORDER BY id), ''), 'UTF8')), 'hex')
+	FROM %s WHERE id = ANY($1)`
+
+// RedisArchiveRepository stores entries archived from Redis
+type RedisArchiveRepository interface {
+	SaveArchivedRecords(ctx context.Context, dataset string, records []*ArchivedRecord) (int64, error)
+	ReadArchivedRecords(ctx context.Context, filter ArchiveFilter, fn func(record *ArchivedRecord) error) error
+	ListArchivePartitions(ctx context.Context, dataset string) ([]*ArchivePartition, error)
+	ReadArchiveManifests(ctx context.Context, dataset string, from, until int64, fn func(manifest *ArchiveManifest) error) error
+	CheckArchiveManifest(ctx context.Context, manifest *ArchiveManifest) (*ArchiveManifest, error)
+}
+
+// redisArchiveRepository implements RedisArchiveRepository
+type redisArchiveRepository struct {
+	db *DB
+}
+
+// NewRedisArchiveRepository creates a new Redis archive repository
+func NewRedisArchiveRepository(db *DB) RedisArchiveRepository {
+	return &redisArchiveRepository{db: db}
+}
+
+// SaveArchivedRecords inserts records into the archive table of dataset in
+// one transaction and returns how many were new. Records already archived,
+// by id, are skipped, so a batch whose removal from Redis failed can be
+// archived again. The transaction also records the batch's manifest.
+func (r *redisArchiveRepository) SaveArchivedRecords(ctx context.Context, dataset string, records []*ArchivedRecord) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_archived_records", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	table, ok := redisArchiveTables[dataset]
+	if !ok {
+		return 0, fmt.Errorf("unknown archive dataset %q", dataset)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	var inserted int64
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		for i := 0; i < len(records); i += archiveInsertBatch {
+			batch := records[i:min(i+archiveInsertBatch, len(records))]
+
+			values := make([]string, len(batch))
+			args := make([]interface{}, 0, 4*len(batch))
+			for j, record := range batch {
+				n := 4 * j
+				values[j] = fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+				args = append(args, record.ID, record.Ticker, record.Timestamp, string(record.Payload))
+			}
+
+			tag, err := tx.Exec(ctx, `INSERT INTO `+table+` (id, ticker, timestamp, payload) VALUES `+
+				strings.Join(values, ", ")+` ON CONFLICT (id) DO NOTHING`, args...)
+			if err != nil {
+				return err
+			}
+			inserted += tag.RowsAffected()
+		}
+
+		manifest := ArchiveManifest{Dataset: dataset, IDs: make([]string, len(records))}
+		for i, record := range records {
+			manifest.IDs[i] = record.ID
+		}
+		if err := tx.QueryRow(ctx, fmt.Sprintf(archiveChecksumQuery, table), manifest.IDs).Scan(
+			&manifest.Records, &manifest.MinTimestamp, &manifest.MaxTimestamp, &manifest.Checksum); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO redis_archive_manifests (dataset, records, min_timestamp, max_timestamp, checksum, ids)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			manifest.Dataset, manifest.Records, manifest.MinTimestamp, manifest.MaxTimestamp, manifest.Checksum, manifest.IDs)
+		return err
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("save_archived_records", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("save_archived_records").Inc()
+		return 0, fmt.Errorf("failed to save archived %s: %w", dataset, err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("save_archived_records", "success").Add(float64(inserted))
+	return inserted, nil
+}
+
+// MaxArchivePage is the largest Limit an ArchiveFilter may have
+const MaxArchivePage = 100000
+
+// ArchiveFilter selects archived records of Dataset timestamped in
+// [From, Until), in milliseconds, optionally of one Ticker. Records are read
+// ordered by timestamp and id, after the record AfterTimestamp, AfterID when
+// AfterID is set, and at most Limit of them unless it is 0.
+type ArchiveFilter struct {
+	Dataset        string
+	Ticker         string
+	From, Until    int64
+	AfterTimestamp int64
+	AfterID        string
+	Limit          int
+}
+
+// ArchivePartition sums up the records of a dataset archived for one UTC
+// day
+type ArchivePartition struct {
+	Dataset      string `json:"dataset"`
+	Date         string `json:"date"`
+	Records      int64  `json:"records"`
+	MinTimestamp int64  `json:"min_timestamp"`
+	MaxTimestamp int64  `json:"max_timestamp"`
+}
+
+// ReadArchivedRecords calls fn with each record filter selects, reading
+// them as fn consumes them rather than all at once
+func (r *redisArchiveRepository) ReadArchivedRecords(ctx context.Context, filter ArchiveFilter, fn func(record *ArchivedRecord) error) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("read_archived_records", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	table, ok := redisArchiveTables[filter.Dataset]
+	if !ok {
+		return fmt.Errorf("unknown archive dataset %q", filter.Dataset)
+	}
+
+	query := `SELECT id, COALESCE(ticker, ''), timestamp, payload::text FROM ` + table + ` WHERE timestamp >= $1 AND timestamp < $2`
+	args := []interface{}{filter.From, filter.Until}
+	if filter.Ticker != "" {
+		args = append(args, filter.Ticker)
+		query += fmt.Sprintf(` AND ticker = $%d`, len(args))
+	}
+	if filter.AfterID != "" {
+		args = append(args, filter.AfterTimestamp, filter.AfterID)
+		query += fmt.Sprintf(` AND (timestamp, id) > ($%d, $%d)`, len(args)-1, len(args))
+	}
+	query += ` ORDER BY timestamp, id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("read_archived_records", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("read_archived_records").Inc()
+		return fmt.Errorf("failed to read archived %s: %w", filter.Dataset, err)
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var record ArchivedRecord
+		var payload string
+		if err := rows.Scan(&record.ID, &record.Ticker, &record.Timestamp, &payload); err != nil {
+			return fmt.Errorf("failed to scan archived %s: %w", filter.Dataset, err)
+		}
+		record.Payload = json.RawMessage(payload)
+		if err := fn(&record); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating archived %s: %w", filter.Dataset, err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("read_archived_records", "success").Add(float64(count))
+	return nil
+}
+
+// ListArchivePartitions returns how many records of dataset are archived
+// for each UTC day, oldest first
+func (r *redisArchiveRepository) ListArchivePartitions(ctx context.Context, dataset string) ([]*ArchivePartition, error) {
+	table, ok := redisArchiveTables[dataset]
+	if !ok {
+		return nil, fmt.Errorf("unknown archive dataset %q", dataset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT to_char(to_timestamp(timestamp / 1000.0) AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+		count(*), min(timestamp), max(timestamp) FROM `+table+` GROUP BY day ORDER BY day`)
+	if err != nil {
+		metrics.DatabaseErrors.WithLabelValues("list_archive_partitions").Inc()
+		return nil, fmt.Errorf("failed to list %s archive partitions: %w", dataset, err)
+	}
+	defer rows.Close()
+
+	var partitions []*ArchivePartition
+	for rows.Next() {
+		partition := &ArchivePartition{Dataset: dataset}
+		if err := rows.Scan(&partition.Date, &partition.Records, &partition.MinTimestamp, &partition.MaxTimestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan %s archive partition: %w", dataset, err)
+		}
+		partitions = append(partitions, partition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating %s archive partitions: %w", dataset, err)
+	}
+	return partitions, nil
+}
+
+// ReadArchiveManifests calls fn with each manifest of dataset whose records
+// overlap [from, until), in milliseconds, oldest first
+func (r *redisArchiveRepository) ReadArchiveManifests(ctx context.Context, dataset string, from, until int64, fn func(manifest *ArchiveManifest) error) error {
+	rows, err := r.db.Pool.Query(ctx, `SELECT id, dataset, records, min_timestamp, max_timestamp, checksum, ids, created_at
+		FROM redis_archive_manifests WHERE dataset = $1 AND max_timestamp >= $2 AND min_timestamp < $3 ORDER BY id`, dataset, from, until)
+	if err != nil {
+		metrics.DatabaseErrors.WithLabelValues("read_archive_manifests").Inc()
+		return fmt.Errorf("failed to read %s manifests: %w", dataset, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var manifest ArchiveManifest
+		if err := rows.Scan(&manifest.ID, &manifest.Dataset, &manifest.Records, &manifest.MinTimestamp,
+			&manifest.MaxTimestamp, &manifest.Checksum, &manifest.IDs, &manifest.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan %s manifest: %w", dataset, err)
+		}
+		if err := fn(&manifest); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s manifests: %w", dataset, err)
+	}
+	return nil
+}
+
+// CheckArchiveManifest describes the rows of manifest's records as they
+// are now, for comparison with manifest
+func (r *redisArchiveRepository) CheckArchiveManifest(ctx context.Context, manifest *ArchiveManifest) (*ArchiveManifest, error) {
+	table, ok := redisArchiveTables[manifest.Dataset]
+	if !ok {
+		return nil, fmt.Errorf("unknown archive dataset %q", manifest.Dataset)
+	}
+
+	actual := &ArchiveManifest{ID: manifest.ID, Dataset: manifest.Dataset, IDs: manifest.IDs, CreatedAt: manifest.CreatedAt}
+	if err := r.db.Pool.QueryRow(ctx, fmt.Sprintf(archiveChecksumQuery, table), manifest.IDs).Scan(
+		&actual.Records, &actual.MinTimestamp, &actual.MaxTimestamp, &actual.Checksum); err != nil {
+		return nil, fmt.Errorf("failed to check %s manifest %d: %w", manifest.Dataset, manifest.ID, err)
+	}
+	return actual, nil
+}
@@ -0,0 +1,531 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrNotFound is returned when a referenced row does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned when a row violates a unique constraint
+	ErrConflict = errors.New("record already exists")
+)
+
+// TickerRepository defines the interface for ticker reference data access
+type TickerRepository interface {
+	CreateTicker(ctx context.Context, ticker *models.Ticker) error
+	GetTicker(ctx context.Context, symbol string) (*models.Ticker, error)
+	GetTickers(ctx context.Context, activeOnly bool) ([]*models.Ticker, error)
+	AssignSector(ctx context.Context, symbol, sector string) error
+	DeactivateTicker(ctx context.Context, symbol string) error
+	SearchTickers(ctx context.Context, query string, limit int) ([]*TickerMatch, error)
+}
+
+// TickerMatch is a ticker search result. Score ranks matches from 1 (exact
+// symbol) down; fuzzy matches score below every prefix match.
+type TickerMatch struct {
+	Symbol string  `json:"symbol"`
+	Name   string  `json:"name,omitempty"`
+	Sector string  `json:"sector"`
+	Score  float64 `json:"score"`
+}
+
+// SectorRepository defines the interface for sector reference data access
+type SectorRepository interface {
+	CreateSector(ctx context.Context, sector *models.Sector) error
+	GetSector(ctx context.Context, name string) (*models.Sector, error)
+	GetSectors(ctx context.Context) ([]*models.Sector, error)
+	UpdateSector(ctx context.Context, sector *models.Sector) error
+	DeleteSector(ctx context.Context, name string) error
+}
+
+// tickerChangeEvent is the outbox payload of a ticker changing sector or
+// being deactivated
+type tickerChangeEvent struct {
+	Symbol string `json:"symbol"`
+	Sector string `json:"sector,omitempty"`
+}
+
+// sectorDeletedEvent is the outbox payload of a sector being deleted
+type sectorDeletedEvent struct {
+	Name string `json:"name"`
+}
+
+// tickerRepository implements TickerRepository
+type tickerRepository struct {
+	db *DB
+}
+
+// NewTickerRepository creates a new ticker repository
+func NewTickerRepository(db *DB) TickerRepository {
+	return &tickerRepository{db: db}
+}
+
+// CreateTicker inserts a new active ticker assigned to an existing sector
+func (r *tickerRepository) CreateTicker(ctx context.Context, ticker *models.Ticker) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_ticker", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	ticker.Sanitize()
+	if err := ticker.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_ticker", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("ticker validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO tickers (symbol, name, sector_id, active)
+		SELECT $1, NULLIF($2, ''), s.id, TRUE
+		FROM sectors s
+		WHERE s.name = $3
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, ticker.Symbol, ticker.Name, ticker.Sector).
+			Scan(&ticker.ID, &ticker.CreatedAt, &ticker.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		ticker.Active = true
+		return enqueueOutboxEvent(ctx, tx, OutboxReferenceStream, EventTickerCreated, ticker)
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_ticker", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("create_ticker").Inc()
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("sector %q: %w", ticker.Sector, ErrNotFound)
+		}
+		if isUniqueViolation(err) {
+			return fmt.Errorf("ticker %q: %w", ticker.Symbol, ErrConflict)
+		}
+		return fmt.Errorf("failed to create ticker: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_ticker", "success").Inc()
+	return nil
+}
+
+// GetTicker retrieves a ticker by symbol, active or not
+func (r *tickerRepository) GetTicker(ctx context.Context, symbol string) (*models.Ticker, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_ticker", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT t.id, t.symbol, COALESCE(t.name, ''), COALESCE(s.name, 'unknown'),
+			COALESCE(t.active, TRUE), t.created_at, t.updated_at
+		FROM tickers t
+		LEFT JOIN sectors s ON s.id = t.sector_id
+		WHERE t.symbol = $1
+	`
+
+	var ticker models.Ticker
+	err := r.db.QueryRowContext(ctx, query, symbol).Scan(&ticker.ID, &ticker.Symbol, &ticker.Name, &ticker.Sector,
+		&ticker.Active, &ticker.CreatedAt, &ticker.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("ticker %q: %w", symbol, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_ticker", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_ticker").Inc()
+		return nil, fmt.Errorf("failed to get ticker: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_ticker", "success").Inc()
+	return &ticker, nil
+}
+
+// GetTickers retrieves the ticker reference table, optionally only active tickers
+func (r *tickerRepository) GetTickers(ctx context.Context, activeOnly bool) ([]*models.Ticker, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_tickers", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT t.id, t.symbol, COALESCE(t.name, ''), COALESCE(s.name, 'unknown'),
+			COALESCE(t.active, TRUE), t.created_at, t.updated_at
+		FROM tickers t
+		LEFT JOIN sectors s ON s.id = t.sector_id
+		WHERE $1 = FALSE OR COALESCE(t.active, TRUE)
+		ORDER BY t.symbol
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, activeOnly)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_tickers", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_tickers").Inc()
+		return nil, fmt.Errorf("failed to get tickers: %w", err)
+	}
+	defer rows.Close()
+
+	var tickers []*models.Ticker
+	for rows.Next() {
+		var ticker models.Ticker
+		if err := rows.Scan(&ticker.ID, &ticker.Symbol, &ticker.Name, &ticker.Sector,
+			&ticker.Active, &ticker.CreatedAt, &ticker.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ticker: %w", err)
+		}
+		tickers = append(tickers, &ticker)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tickers: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_tickers", "success").Inc()
+	return tickers, nil
+}
+
+// AssignSector moves a ticker to another existing sector
+func (r *tickerRepository) AssignSector(ctx context.Context, symbol, sector string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("assign_sector", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		UPDATE tickers SET sector_id = s.id
+		FROM sectors s
+		WHERE tickers.symbol = $1 AND s.name = $2
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, symbol, sector)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("ticker %q or sector %q: %w", symbol, sector, ErrNotFound)
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxReferenceStream, EventTickerSectorAssigned, tickerChangeEvent{Symbol: symbol, Sector: sector})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("assign_sector", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("assign_sector").Inc()
+		return fmt.Errorf("failed to assign sector: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("assign_sector", "success").Inc()
+	return nil
+}
+
+// DeactivateTicker marks a ticker inactive so it is no longer normalized
+func (r *tickerRepository) DeactivateTicker(ctx context.Context, symbol string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("deactivate_ticker", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `UPDATE tickers SET active = FALSE WHERE symbol = $1`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, symbol)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("ticker %q: %w", symbol, ErrNotFound)
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxReferenceStream, EventTickerDeactivated, tickerChangeEvent{Symbol: symbol})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("deactivate_ticker", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("deactivate_ticker").Inc()
+		return fmt.Errorf("failed to deactivate ticker: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("deactivate_ticker", "success").Inc()
+	return nil
+}
+
+// sectorRepository implements SectorRepository
+type sectorRepository struct {
+	db *DB
+}
+
+// NewSectorRepository creates a new sector repository
+func NewSectorRepository(db *DB) SectorRepository {
+	return &sectorRepository{db: db}
+}
+
+// CreateSector inserts a new sector
+func (r *sectorRepository) CreateSector(ctx context.Context, sector *models.Sector) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_sector", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	sector.Sanitize()
+	if err := sector.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_sector", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("sector validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO sectors (name, description)
+		VALUES ($1, NULLIF($2, ''))
+		RETURNING id, created_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, query, sector.Name, sector.Description).Scan(&sector.ID, &sector.CreatedAt); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxReferenceStream, EventSectorCreated, sector)
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_sector", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("create_sector").Inc()
+		if isUniqueViolation(err) {
+			return fmt.Errorf("sector %q: %w", sector.Name, ErrConflict)
+		}
+		return fmt.Errorf("failed to create sector: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_sector", "success").Inc()
+	return nil
+}
+
+// GetSector retrieves a sector by name
+func (r *sectorRepository) GetSector(ctx context.Context, name string) (*models.Sector, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_sector", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT id, name, COALESCE(description, ''), created_at
+		FROM sectors
+		WHERE name = $1
+	`
+
+	var sector models.Sector
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&sector.ID, &sector.Name, &sector.Description, &sector.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("sector %q: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_sector", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_sector").Inc()
+		return nil, fmt.Errorf("failed to get sector: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_sector", "success").Inc()
+	return &sector, nil
+}
+
+// GetSectors retrieves all sectors
+func (r *sectorRepository) GetSectors(ctx context.Context) ([]*models.Sector, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_sectors", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT id, name, COALESCE(description, ''), created_at
+		FROM sectors
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_sectors", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_sectors").Inc()
+		return nil, fmt.Errorf("failed to get sectors: %w", err)
+	}
+	defer rows.Close()
+
+	var sectors []*models.Sector
+	for rows.Next() {
+		var sector models.Sector
+		if err := rows.Scan(&sector.ID, &sector.Name, &sector.Description, &sector.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sector: %w", err)
+		}
+		sectors = append(sectors, &sector)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sectors: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_sectors", "success").Inc()
+	return sectors, nil
+}
+
+// UpdateSector replaces the description of the sector named sector.Name
+func (r *sectorRepository) UpdateSector(ctx context.Context, sector *models.Sector) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_sector", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	sector.Sanitize()
+	if err := sector.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_sector", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("sector validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE sectors SET description = NULLIF($2, '')
+		WHERE name = $1
+		RETURNING id, created_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, query, sector.Name, sector.Description).Scan(&sector.ID, &sector.CreatedAt); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxReferenceStream, EventSectorUpdated, sector)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("sector %q: %w", sector.Name, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_sector", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("update_sector").Inc()
+		return fmt.Errorf("failed to update sector: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("update_sector", "success").Inc()
+	return nil
+}
+
+// DeleteSector removes a sector. Sectors still assigned to tickers, active or
+// not, are kept and ErrConflict is returned.
+func (r *sectorRepository) DeleteSector(ctx context.Context, name string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_sector", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `DELETE FROM sectors WHERE name = $1`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, name)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("sector %q: %w", name, ErrNotFound)
+		}
+		return enqueueOutboxEvent(ctx, tx, OutboxReferenceStream, EventSectorDeleted, sectorDeletedEvent{Name: name})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_sector", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("delete_sector").Inc()
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("sector %q is assigned to tickers: %w", name, ErrConflict)
+		}
+		return fmt.Errorf("failed to delete sector: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("delete_sector", "success").Inc()
+	return nil
+}
+
+// SearchTickers finds active tickers whose symbol or name starts with query,
+// has a word starting with it, or is similar to it by trigram distance
+func (r *tickerRepository) SearchTickers(ctx context.Context, query string, limit int) ([]*TickerMatch, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("search_tickers", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	sqlQuery := `
+		SELECT symbol, name, sector, score FROM (
+			SELECT t.symbol, COALESCE(t.name, '') AS name, COALESCE(s.name, 'unknown') AS sector,
+				CASE
+					WHEN t.symbol = $1 THEN 1.0
+					WHEN t.symbol LIKE $2 || '%' ESCAPE '\' THEN 0.9
+					WHEN LOWER(t.name) LIKE $3 || '%' ESCAPE '\' THEN 0.8
+					WHEN LOWER(t.name) LIKE '% ' || $3 || '%' ESCAPE '\' THEN 0.7
+					ELSE 0.6 * GREATEST(similarity(t.symbol, $1), similarity(LOWER(COALESCE(t.name, '')), LOWER($4)))
+				END AS score
+			FROM tickers t
+			LEFT JOIN sectors s ON s.id = t.sector_id
+			WHERE COALESCE(t.active, TRUE)
+				AND (t.symbol LIKE $2 || '%' ESCAPE '\'
+					OR LOWER(t.name) LIKE $3 || '%' ESCAPE '\'
+					OR LOWER(t.name) LIKE '% ' || $3 || '%' ESCAPE '\'
+					OR t.symbol % $1
+					OR LOWER(t.name) % LOWER($4))
+		) matches
+		ORDER BY score DESC, symbol
+		LIMIT $5
+	`
+
+	pattern := escapeLike(query)
+	rows, err := r.db.QueryContext(ctx, sqlQuery,
+		strings.ToUpper(query),
+		strings.ToUpper(pattern),
+		strings.ToLower(pattern),
+		query,
+		limit,
+	)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("search_tickers", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("search_tickers").Inc()
+		return nil, fmt.Errorf("failed to search tickers: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []*TickerMatch{}
+	for rows.Next() {
+		var match TickerMatch
+		if err := rows.Scan(&match.Symbol, &match.Name, &match.Sector, &match.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan ticker match: %w", err)
+		}
+		matches = append(matches, &match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ticker matches: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("search_tickers", "success").Inc()
+	return matches, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation (23505)
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres
+// foreign_key_violation (23503)
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
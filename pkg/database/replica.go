@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+)
+
+// replicaLagQuery measures how far a standby's replayed WAL trails the
+// primary, and whether it is receiving WAL from the primary at all. A
+// standby that has replayed everything it received is not lagging even if
+// the primary has been idle since its last transaction, but only while its
+// WAL receiver is connected: a disconnected one has replayed everything it
+// received and stays 0 behind however far the primary moves on. The
+// receiver's status is only visible to pg_read_all_stats; without it a
+// running receiver counts as streaming.
+const replicaLagQuery = `
+	SELECT
+		NOT pg_is_in_recovery() OR EXISTS (
+			SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'
+		),
+		CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+		END
+`
+
+// errReplicaDisconnected marks a standby not receiving WAL from the primary
+var errReplicaDisconnected = errors.New("replica is not receiving WAL from the primary")
+
+// replica is a read replica serving Reader while it keeps up with the primary
+type replica struct {
+	name    string
+	db      *sql.DB
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// Reader returns the handle for read-only queries that tolerate replication
+// lag: a replica within MaxReplicaLag, chosen round-robin, or the primary
+// when no replica is configured or healthy
+func (db *DB) Reader() *sql.DB {
+	n := len(db.replicas)
+	if n == 0 {
+		return db.DB
+	}
+
+	start := db.nextReplica.Add(1)
+	for i := 0; i < n; i++ {
+		r := db.replicas[(start+uint64(i))%uint64(n)]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	metrics.DatabaseReaderFallbacks.Inc()
+	return db.DB
+}
+
+// openReplicas connects to the configured replicas and starts monitoring
+// their lag. A replica that cannot be reached is skipped; reads fall back to
+// the primary.
+func (db *DB) openReplicas(ctx context.Context) {
+	for _, dsn := range db.config.ReaderDSNs {
+		pool, err := openPool(ctx, dsn, db.config)
+		if err != nil {
+			logger.Log.Warn("failed to connect to read replica, skipping", zap.Error(err))
+			continue
+		}
+		connConfig := pool.Config().ConnConfig
+		db.replicas = append(db.replicas, &replica{
+			name: fmt.Sprintf("%s:%d", connConfig.Host, connConfig.Port),
+			db:   stdlib.OpenDBFromPool(pool),
+			pool: pool,
+		})
+	}
+	if len(db.replicas) == 0 {
+		return
+	}
+
+	// Measure once up front so replicas serve reads right away
+	db.checkReplicas(ctx)
+
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	db.stopMonitor = cancel
+	go db.monitorReplicas(monitorCtx)
+}
+
+// monitorReplicas measures replica lag every ReplicaCheckInterval until ctx
+// is done
+func (db *DB) monitorReplicas(ctx context.Context) {
+	ticker := time.NewTicker(db.config.ReplicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkReplicas(ctx)
+		}
+	}
+}
+
+// checkReplicas marks each replica healthy if its lag is within
+// MaxReplicaLag and unhealthy if it is behind, disconnected from the
+// primary or unreachable
+func (db *DB) checkReplicas(ctx context.Context) {
+	for _, r := range db.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, db.config.ReplicaCheckInterval)
+		var streaming bool
+		var lagSeconds float64
+		err := r.pool.QueryRow(checkCtx, replicaLagQuery).Scan(&streaming, &lagSeconds)
+		cancel()
+		if err == nil && !streaming {
+			err = errReplicaDisconnected
+		}
+
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		healthy := err == nil && lag <= db.config.MaxReplicaLag
+		if err == nil {
+			metrics.DatabaseReplicaLag.WithLabelValues(r.name).Set(lagSeconds)
+		}
+		if healthy {
+			metrics.DatabaseReplicaHealthy.WithLabelValues(r.name).Set(1)
+		} else {
+			metrics.DatabaseReplicaHealthy.WithLabelValues(r.name).Set(0)
+		}
+
+		if was := r.healthy.Swap(healthy); was != healthy {
+			if healthy {
+				logger.Log.Info("read replica serving reads", zap.String("replica", r.name), zap.Duration("lag", lag))
+			} else {
+				logger.Log.Warn("read replica bypassed", zap.String("replica", r.name), zap.Duration("lag", lag), zap.Error(err))
+			}
+		}
+	}
+}
+
+// closeReplicas stops lag monitoring and closes the replica pools
+func (db *DB) closeReplicas() {
+	if db.stopMonitor != nil {
+		db.stopMonitor()
+	}
+	for _, r := range db.replicas {
+		r.db.Close()
+		r.pool.Close()
+	}
+}
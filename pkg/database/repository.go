@@ -3,47 +3,87 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/alim08/fin_line/pkg/models"
 	"github.com/alim08/fin_line/pkg/metrics"
-	"github.com/alim08/fin_line/pkg/logger"
-	"go.uber.org/zap"
+	"github.com/alim08/fin_line/pkg/tenant"
 )
 
-// QuoteRepository defines the interface for quote data access
+// QuoteRepository defines the interface for quote data access. Its reads
+// are served by read replicas when configured, so they may lag writes.
 type QuoteRepository interface {
 	SaveQuote(ctx context.Context, quote *models.NormalizedTick) error
+	SaveQuotes(ctx context.Context, quotes []*models.NormalizedTick) error
+	BackfillQuotes(ctx context.Context, quotes []*models.NormalizedTick) (int64, error)
 	GetLatestQuotes(ctx context.Context) ([]*models.NormalizedTick, error)
 	GetQuotesByTicker(ctx context.Context, ticker string, limit int) ([]*models.NormalizedTick, error)
+	GetQuotesByTickerBefore(ctx context.Context, ticker string, before KeysetCursor, limit int) ([]*models.NormalizedTick, KeysetCursor, error)
 	GetQuotesBySector(ctx context.Context, sector string, limit int) ([]*models.NormalizedTick, error)
 	GetQuotesByTimeRange(ctx context.Context, ticker string, start, end int64) ([]*models.NormalizedTick, error)
+	GetQuotesByTimeRangeDownsampled(ctx context.Context, ticker string, start, end int64, resolution time.Duration) ([]*models.NormalizedTick, error)
+	GetQuoteAt(ctx context.Context, ticker string, ts int64) (*models.NormalizedTick, error)
+	GetCandles(ctx context.Context, ticker string, start, end int64, interval time.Duration) ([]*Candle, error)
+	ListQuotes(ctx context.Context, filter QuoteFilter) ([]*models.NormalizedTick, error)
 	GetQuoteStats(ctx context.Context) (*QuoteStats, error)
 }
 
-// AnomalyRepository defines the interface for anomaly data access
+// AnomalyRepository defines the interface for anomaly data access. Its reads
+// are served by read replicas when configured, so they may lag writes.
 type AnomalyRepository interface {
 	SaveAnomaly(ctx context.Context, anomaly *models.Anomaly) error
 	GetAnomaliesByTicker(ctx context.Context, ticker string, limit int) ([]*models.Anomaly, error)
+	GetAnomaliesByTickerBefore(ctx context.Context, ticker string, before KeysetCursor, limit int) ([]*models.Anomaly, KeysetCursor, error)
 	GetAnomaliesByTimeRange(ctx context.Context, start, end int64) ([]*models.Anomaly, error)
 	GetAnomaliesByZScore(ctx context.Context, minZScore float64, limit int) ([]*models.Anomaly, error)
+	ListAnomalies(ctx context.Context, filter AnomalyFilter) ([]*models.Anomaly, error)
+	GetAnomaliesByStatus(ctx context.Context, status string, limit int) ([]*models.AnomalyRecord, error)
+	GetAnomaliesBySeverity(ctx context.Context, severity string, limit int) ([]*models.AnomalyRecord, error)
 }
 
-// RawEventRepository defines the interface for raw event data access
+// KeysetCursor is the position of a row in a keyset page ordered newest
+// first by timestamp and then id. A page holds the rows before its cursor,
+// and the cursor of its last row positions the next page.
+type KeysetCursor struct {
+	Timestamp int64
+	ID        int64
+}
+
+// FirstPage is the cursor of the first keyset page, before every row
+var FirstPage = KeysetCursor{Timestamp: math.MaxInt64, ID: math.MaxInt64}
+
+// RawEventRepository defines the interface for raw event data access. Its reads
+// are served by read replicas when configured, so they may lag writes.
 type RawEventRepository interface {
 	SaveRawEvent(ctx context.Context, event *models.RawTick) error
+	SaveRawEvents(ctx context.Context, events []*models.RawTick) error
 	GetRawEventsBySource(ctx context.Context, source string, limit int) ([]*models.RawTick, error)
 	GetRawEventsByTimeRange(ctx context.Context, start, end time.Time) ([]*models.RawTick, error)
+	StreamRawEvents(ctx context.Context, filter RawEventFilter, fn func(id int64, event *models.RawTick) error) error
 }
 
 // QuoteStats represents statistics about quotes
 type QuoteStats struct {
-	TotalQuotes   int64     `json:"total_quotes"`
-	TotalTickers  int64     `json:"total_tickers"`
-	LastUpdate    time.Time `json:"last_update"`
-	AvgPrice      float64   `json:"avg_price"`
-	TotalSectors  int64     `json:"total_sectors"`
+	TotalQuotes   int64          `json:"total_quotes"`
+	TotalTickers  int64          `json:"total_tickers"`
+	LastUpdate    time.Time      `json:"last_update"`
+	AvgPrice      float64        `json:"avg_price"`
+	TotalSectors  int64          `json:"total_sectors"`
+	Sectors       []*SectorStats `json:"sectors"`
+}
+
+// SectorStats represents quote statistics for a single sector
+type SectorStats struct {
+	Sector       string    `json:"sector"`
+	TotalQuotes  int64     `json:"total_quotes"`
+	TotalTickers int64     `json:"total_tickers"`
+	AvgPrice     float64   `json:"avg_price"`
+	MinPrice     float64   `json:"min_price"`
+	MaxPrice     float64   `json:"max_price"`
+	LastUpdate   time.Time `json:"last_update"`
 }
 
 // quoteRepository implements QuoteRepository
@@ -71,15 +111,15 @@ func (r *quoteRepository) SaveQuote(ctx context.Context, quote *models.Normalize
 	}
 
 	query := `
-		INSERT INTO quotes (ticker, price, timestamp, sector)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (ticker, timestamp) DO UPDATE SET
+		INSERT INTO quotes (ticker, price, timestamp, sector, tenant_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, ticker, timestamp) DO UPDATE SET
 			price = EXCLUDED.price,
 			sector = EXCLUDED.sector,
 			updated_at = NOW()
 	`
 
-	_, err := r.db.ExecContext(ctx, query, quote.Ticker, quote.Price, quote.Timestamp, quote.Sector)
+	_, err := r.db.ExecContext(ctx, query, quote.Ticker, quote.Price, quote.Timestamp, quote.Sector, tenant.FromContext(ctx))
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("save_quote", "error").Observe(time.Since(start).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("save_quote").Inc()
@@ -100,10 +140,11 @@ func (r *quoteRepository) GetLatestQuotes(ctx context.Context) ([]*models.Normal
 	query := `
 		SELECT ticker, price, timestamp, sector
 		FROM latest_quotes
+		WHERE tenant_id = ANY($1)
 		ORDER BY ticker
 	`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.Reader().QueryContext(ctx, query, visibleTenants(ctx))
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_latest_quotes", "error").Observe(time.Since(start).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_latest_quotes").Inc()
@@ -130,9 +171,22 @@ func (r *quoteRepository) GetLatestQuotes(ctx context.Context) ([]*models.Normal
 
 // GetQuotesByTicker retrieves quotes for a specific ticker
 func (r *quoteRepository) GetQuotesByTicker(ctx context.Context, ticker string, limit int) ([]*models.NormalizedTick, error) {
+	quotes, _, err := r.quotesByTicker(ctx, "get_quotes_by_ticker", ticker, FirstPage, limit)
+	return quotes, err
+}
+
+// GetQuotesByTickerBefore returns ticker's newest quotes before the cursor,
+// and the cursor of the last one for the next page. Tenants may each hold a
+// quote at the same timestamp, so quotes are ordered by id within it.
+func (r *quoteRepository) GetQuotesByTickerBefore(ctx context.Context, ticker string, before KeysetCursor, limit int) ([]*models.NormalizedTick, KeysetCursor, error) {
+	return r.quotesByTicker(ctx, "get_quotes_by_ticker_before", ticker, before, limit)
+}
+
+// quotesByTicker returns ticker's newest quotes before the cursor
+func (r *quoteRepository) quotesByTicker(ctx context.Context, operation, ticker string, before KeysetCursor, limit int) ([]*models.NormalizedTick, KeysetCursor, error) {
 	start := time.Now()
 	defer func() {
-		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_by_ticker", "success").Observe(time.Since(start).Seconds())
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "success").Observe(time.Since(start).Seconds())
 	}()
 
 	if limit <= 0 || limit > 1000 {
@@ -140,36 +194,38 @@ func (r *quoteRepository) GetQuotesByTicker(ctx context.Context, ticker string,
 	}
 
 	query := `
-		SELECT ticker, price, timestamp, sector
+		SELECT id, ticker, price, timestamp, sector
 		FROM quotes
-		WHERE ticker = $1
-		ORDER BY timestamp DESC
+		WHERE ticker = $1 AND (timestamp, id) < ($4, $5) AND tenant_id = ANY($3)
+		ORDER BY timestamp DESC, id DESC
 		LIMIT $2
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, ticker, limit)
+	rows, err := r.db.Reader().QueryContext(ctx, query, ticker, limit, visibleTenants(ctx), before.Timestamp, before.ID)
 	if err != nil {
-		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_by_ticker", "error").Observe(time.Since(start).Seconds())
-		metrics.DatabaseErrors.WithLabelValues("get_quotes_by_ticker").Inc()
-		return nil, fmt.Errorf("failed to get quotes by ticker: %w", err)
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues(operation).Inc()
+		return nil, before, fmt.Errorf("failed to get quotes by ticker: %w", err)
 	}
 	defer rows.Close()
 
 	var quotes []*models.NormalizedTick
+	next := before
 	for rows.Next() {
 		var quote models.NormalizedTick
-		if err := rows.Scan(&quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector); err != nil {
-			return nil, fmt.Errorf("failed to scan quote: %w", err)
+		if err := rows.Scan(&next.ID, &quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector); err != nil {
+			return nil, before, fmt.Errorf("failed to scan quote: %w", err)
 		}
+		next.Timestamp = quote.Timestamp
 		quotes = append(quotes, &quote)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating quotes: %w", err)
+		return nil, before, fmt.Errorf("error iterating quotes: %w", err)
 	}
 
-	metrics.DatabaseOperations.WithLabelValues("get_quotes_by_ticker", "success").Inc()
-	return quotes, nil
+	metrics.DatabaseOperations.WithLabelValues(operation, "success").Inc()
+	return quotes, next, nil
 }
 
 // GetQuotesBySector retrieves quotes for a specific sector
@@ -186,12 +242,12 @@ func (r *quoteRepository) GetQuotesBySector(ctx context.Context, sector string,
 	query := `
 		SELECT ticker, price, timestamp, sector
 		FROM quotes
-		WHERE sector = $1
+		WHERE sector = $1 AND tenant_id = ANY($3)
 		ORDER BY timestamp DESC
 		LIMIT $2
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, sector, limit)
+	rows, err := r.db.Reader().QueryContext(ctx, query, sector, limit, visibleTenants(ctx))
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_by_sector", "error").Observe(time.Since(start).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_quotes_by_sector").Inc()
@@ -226,11 +282,11 @@ func (r *quoteRepository) GetQuotesByTimeRange(ctx context.Context, ticker strin
 	query := `
 		SELECT ticker, price, timestamp, sector
 		FROM quotes
-		WHERE ticker = $1 AND timestamp BETWEEN $2 AND $3
+		WHERE ticker = $1 AND timestamp BETWEEN $2 AND $3 AND tenant_id = ANY($4)
 		ORDER BY timestamp ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, ticker, start, end)
+	rows, err := r.db.Reader().QueryContext(ctx, query, ticker, start, end, visibleTenants(ctx))
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_by_time_range", "error").Observe(time.Since(startTime).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_quotes_by_time_range").Inc()
@@ -255,6 +311,117 @@ func (r *quoteRepository) GetQuotesByTimeRange(ctx context.Context, ticker strin
 	return quotes, nil
 }
 
+// DownsampleResolution returns the narrowest bucket width that fits
+// [start, end] into maxPoints/4 widths, for GetQuotesByTimeRangeDownsampled
+// to return about maxPoints quotes. Buckets are aligned to the epoch, so the
+// range may touch one bucket more and yield up to four extra quotes.
+func DownsampleResolution(start, end int64, maxPoints int) time.Duration {
+	buckets := int64(maxPoints / 4)
+	if buckets < 1 {
+		buckets = 1
+	}
+	width := (end - start + buckets) / buckets
+	if width < 1 {
+		width = 1
+	}
+	return time.Duration(width) * time.Millisecond
+}
+
+// downsampledQuotesQuery keeps the first, last, lowest and highest quote of
+// each bucket
+const downsampledQuotesQuery = `
+	SELECT ticker, price, timestamp, sector
+	FROM (
+		SELECT ticker, price, timestamp, sector,
+			ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY timestamp ASC) AS first_rank,
+			ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY timestamp DESC) AS last_rank,
+			ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY price ASC, timestamp ASC) AS low_rank,
+			ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY price DESC, timestamp ASC) AS high_rank
+		FROM (
+			SELECT ticker, price, timestamp, sector, timestamp - (timestamp % $4) AS bucket
+			FROM quotes
+			WHERE ticker = $1 AND timestamp BETWEEN $2 AND $3 AND tenant_id = ANY($5)
+		) q
+	) ranked
+	WHERE first_rank = 1 OR last_rank = 1 OR low_rank = 1 OR high_rank = 1
+	ORDER BY timestamp ASC
+`
+
+// GetQuotesByTimeRangeDownsampled retrieves the quotes within a time range
+// reduced server-side to the first, last, lowest and highest quote of each
+// resolution-wide bucket aligned to the Unix epoch, oldest first. A bucket
+// yields one to four quotes, so a chart of them keeps every extreme.
+func (r *quoteRepository) GetQuotesByTimeRangeDownsampled(ctx context.Context, ticker string, start, end int64, resolution time.Duration) ([]*models.NormalizedTick, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_downsampled", "success").Observe(time.Since(startTime).Seconds())
+	}()
+
+	width := resolution.Milliseconds()
+	if width <= 0 || end < start {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_downsampled", "validation_error").Observe(time.Since(startTime).Seconds())
+		return nil, fmt.Errorf("%w: resolution must be at least 1ms and end not before start", ErrInvalidRange)
+	}
+	if (end-start)/width > MaxCandles {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_downsampled", "validation_error").Observe(time.Since(startTime).Seconds())
+		return nil, fmt.Errorf("%w: range spans more than %d buckets", ErrInvalidRange, MaxCandles)
+	}
+
+	rows, err := r.db.Reader().QueryContext(ctx, downsampledQuotesQuery, ticker, start, end, width, visibleTenants(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quotes_downsampled", "error").Observe(time.Since(startTime).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_quotes_downsampled").Inc()
+		return nil, fmt.Errorf("failed to get downsampled quotes: %w", err)
+	}
+	defer rows.Close()
+
+	var quotes []*models.NormalizedTick
+	for rows.Next() {
+		var quote models.NormalizedTick
+		if err := rows.Scan(&quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector); err != nil {
+			return nil, fmt.Errorf("failed to scan quote: %w", err)
+		}
+		quotes = append(quotes, &quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quotes: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_quotes_downsampled", "success").Inc()
+	return quotes, nil
+}
+
+// GetQuoteAt retrieves the last known quote for ticker at or before ts (milliseconds since epoch)
+func (r *quoteRepository) GetQuoteAt(ctx context.Context, ticker string, ts int64) (*models.NormalizedTick, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quote_at", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT ticker, price, timestamp, sector
+		FROM quotes
+		WHERE ticker = $1 AND timestamp <= $2 AND tenant_id = ANY($3)
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`
+
+	var quote models.NormalizedTick
+	err := r.db.Reader().QueryRowContext(ctx, query, ticker, ts, visibleTenants(ctx)).Scan(&quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no quote for %s at or before %d: %w", ticker, ts, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quote_at", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_quote_at").Inc()
+		return nil, fmt.Errorf("failed to get quote at time: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_quote_at", "success").Inc()
+	return &quote, nil
+}
+
 // GetQuoteStats retrieves statistics about quotes
 func (r *quoteRepository) GetQuoteStats(ctx context.Context) (*QuoteStats, error) {
 	start := time.Now()
@@ -270,14 +437,18 @@ func (r *quoteRepository) GetQuoteStats(ctx context.Context) (*QuoteStats, error
 			AVG(price) as avg_price,
 			COUNT(DISTINCT sector) as total_sectors
 		FROM quotes
+		WHERE tenant_id = ANY($1)
 	`
 
+	// MAX and AVG are NULL on an empty table
 	var stats QuoteStats
-	err := r.db.QueryRowContext(ctx, query).Scan(
+	var lastUpdate sql.NullTime
+	var avgPrice sql.NullFloat64
+	err := r.db.Reader().QueryRowContext(ctx, query, visibleTenants(ctx)).Scan(
 		&stats.TotalQuotes,
 		&stats.TotalTickers,
-		&stats.LastUpdate,
-		&stats.AvgPrice,
+		&lastUpdate,
+		&avgPrice,
 		&stats.TotalSectors,
 	)
 	if err != nil {
@@ -285,11 +456,60 @@ func (r *quoteRepository) GetQuoteStats(ctx context.Context) (*QuoteStats, error
 		metrics.DatabaseErrors.WithLabelValues("get_quote_stats").Inc()
 		return nil, fmt.Errorf("failed to get quote stats: %w", err)
 	}
+	stats.LastUpdate = lastUpdate.Time
+	stats.AvgPrice = avgPrice.Float64
+
+	sectors, err := r.getSectorStats(ctx)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_quote_stats", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_quote_stats").Inc()
+		return nil, fmt.Errorf("failed to get sector stats: %w", err)
+	}
+	stats.Sectors = sectors
 
 	metrics.DatabaseOperations.WithLabelValues("get_quote_stats", "success").Inc()
 	return &stats, nil
 }
 
+// getSectorStats computes per-sector quote statistics
+func (r *quoteRepository) getSectorStats(ctx context.Context) ([]*SectorStats, error) {
+	query := `
+		SELECT
+			sector,
+			COUNT(*),
+			COUNT(DISTINCT ticker),
+			AVG(price),
+			MIN(price),
+			MAX(price),
+			MAX(created_at)
+		FROM quotes
+		WHERE tenant_id = ANY($1)
+		GROUP BY sector
+		ORDER BY sector
+	`
+
+	rows, err := r.db.Reader().QueryContext(ctx, query, visibleTenants(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sectors := []*SectorStats{}
+	for rows.Next() {
+		var s SectorStats
+		if err := rows.Scan(&s.Sector, &s.TotalQuotes, &s.TotalTickers, &s.AvgPrice, &s.MinPrice, &s.MaxPrice, &s.LastUpdate); err != nil {
+			return nil, fmt.Errorf("failed to scan sector stats: %w", err)
+		}
+		sectors = append(sectors, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sector stats: %w", err)
+	}
+
+	return sectors, nil
+}
+
 // anomalyRepository implements AnomalyRepository
 type anomalyRepository struct {
 	db *DB
@@ -315,11 +535,12 @@ func (r *anomalyRepository) SaveAnomaly(ctx context.Context, anomaly *models.Ano
 	}
 
 	query := `
-		INSERT INTO anomalies (ticker, price, z_score, timestamp)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO anomalies (ticker, price, z_score, timestamp, tenant_id, type, severity, detector)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
-	_, err := r.db.ExecContext(ctx, query, anomaly.Ticker, anomaly.Price, anomaly.ZScore, anomaly.Timestamp)
+	_, err := r.db.ExecContext(ctx, query, anomaly.Ticker, anomaly.Price, anomaly.ZScore, anomaly.Timestamp, tenant.FromContext(ctx),
+		models.AnomalyTypePriceSpike, anomaly.Severity(), models.AnomalyDetectorZScore)
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("save_anomaly", "error").Observe(time.Since(start).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("save_anomaly").Inc()
@@ -332,9 +553,22 @@ func (r *anomalyRepository) SaveAnomaly(ctx context.Context, anomaly *models.Ano
 
 // GetAnomaliesByTicker retrieves anomalies for a specific ticker
 func (r *anomalyRepository) GetAnomaliesByTicker(ctx context.Context, ticker string, limit int) ([]*models.Anomaly, error) {
+	anomalies, _, err := r.anomaliesByTicker(ctx, "get_anomalies_by_ticker", ticker, FirstPage, limit)
+	return anomalies, err
+}
+
+// GetAnomaliesByTickerBefore returns ticker's newest anomalies before the
+// cursor, and the cursor of the last one for the next page. Anomalies
+// sharing a timestamp are ordered by id, so none are skipped between pages.
+func (r *anomalyRepository) GetAnomaliesByTickerBefore(ctx context.Context, ticker string, before KeysetCursor, limit int) ([]*models.Anomaly, KeysetCursor, error) {
+	return r.anomaliesByTicker(ctx, "get_anomalies_by_ticker_before", ticker, before, limit)
+}
+
+// anomaliesByTicker returns ticker's newest anomalies before the cursor
+func (r *anomalyRepository) anomaliesByTicker(ctx context.Context, operation, ticker string, before KeysetCursor, limit int) ([]*models.Anomaly, KeysetCursor, error) {
 	start := time.Now()
 	defer func() {
-		metrics.DatabaseOperationDuration.WithLabelValues("get_anomalies_by_ticker", "success").Observe(time.Since(start).Seconds())
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "success").Observe(time.Since(start).Seconds())
 	}()
 
 	if limit <= 0 || limit > 1000 {
@@ -342,36 +576,38 @@ func (r *anomalyRepository) GetAnomaliesByTicker(ctx context.Context, ticker str
 	}
 
 	query := `
-		SELECT ticker, price, z_score, timestamp
+		SELECT id, ticker, price, z_score, timestamp
 		FROM anomalies
-		WHERE ticker = $1
-		ORDER BY timestamp DESC
+		WHERE ticker = $1 AND (timestamp, id) < ($4, $5) AND deleted_at IS NULL AND tenant_id = ANY($3)
+		ORDER BY timestamp DESC, id DESC
 		LIMIT $2
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, ticker, limit)
+	rows, err := r.db.Reader().QueryContext(ctx, query, ticker, limit, visibleTenants(ctx), before.Timestamp, before.ID)
 	if err != nil {
-		metrics.DatabaseOperationDuration.WithLabelValues("get_anomalies_by_ticker", "error").Observe(time.Since(start).Seconds())
-		metrics.DatabaseErrors.WithLabelValues("get_anomalies_by_ticker").Inc()
-		return nil, fmt.Errorf("failed to get anomalies by ticker: %w", err)
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues(operation).Inc()
+		return nil, before, fmt.Errorf("failed to get anomalies by ticker: %w", err)
 	}
 	defer rows.Close()
 
 	var anomalies []*models.Anomaly
+	next := before
 	for rows.Next() {
 		var anomaly models.Anomaly
-		if err := rows.Scan(&anomaly.Ticker, &anomaly.Price, &anomaly.ZScore, &anomaly.Timestamp); err != nil {
-			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		if err := rows.Scan(&next.ID, &anomaly.Ticker, &anomaly.Price, &anomaly.ZScore, &anomaly.Timestamp); err != nil {
+			return nil, before, fmt.Errorf("failed to scan anomaly: %w", err)
 		}
+		next.Timestamp = anomaly.Timestamp
 		anomalies = append(anomalies, &anomaly)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating anomalies: %w", err)
+		return nil, before, fmt.Errorf("error iterating anomalies: %w", err)
 	}
 
-	metrics.DatabaseOperations.WithLabelValues("get_anomalies_by_ticker", "success").Inc()
-	return anomalies, nil
+	metrics.DatabaseOperations.WithLabelValues(operation, "success").Inc()
+	return anomalies, next, nil
 }
 
 // GetAnomaliesByTimeRange retrieves anomalies within a time range
@@ -384,11 +620,11 @@ func (r *anomalyRepository) GetAnomaliesByTimeRange(ctx context.Context, start,
 	query := `
 		SELECT ticker, price, z_score, timestamp
 		FROM anomalies
-		WHERE timestamp BETWEEN $1 AND $2
+		WHERE timestamp BETWEEN $1 AND $2 AND deleted_at IS NULL AND tenant_id = ANY($3)
 		ORDER BY timestamp DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, start, end)
+	rows, err := r.db.Reader().QueryContext(ctx, query, start, end, visibleTenants(ctx))
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_anomalies_by_time_range", "error").Observe(time.Since(startTime).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_anomalies_by_time_range").Inc()
@@ -427,12 +663,12 @@ func (r *anomalyRepository) GetAnomaliesByZScore(ctx context.Context, minZScore
 	query := `
 		SELECT ticker, price, z_score, timestamp
 		FROM anomalies
-		WHERE z_score >= $1
+		WHERE z_score >= $1 AND deleted_at IS NULL AND tenant_id = ANY($3)
 		ORDER BY z_score DESC, timestamp DESC
 		LIMIT $2
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, minZScore, limit)
+	rows, err := r.db.Reader().QueryContext(ctx, query, minZScore, limit, visibleTenants(ctx))
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_anomalies_by_zscore", "error").Observe(time.Since(start).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_anomalies_by_zscore").Inc()
@@ -457,6 +693,100 @@ func (r *anomalyRepository) GetAnomaliesByZScore(ctx context.Context, minZScore
 	return anomalies, nil
 }
 
+// anomalyRecordColumns are the columns scanned by scanAnomalyRecord
+const anomalyRecordColumns = `id, ticker, price, z_score, timestamp, type, severity, COALESCE(detector, ''), status,
+	source, acknowledged_at, COALESCE(acknowledged_by, ''), tenant_id, created_at`
+
+// scanAnomalyRecord scans a row of anomalyRecordColumns
+func scanAnomalyRecord(rows *sql.Rows) (*models.AnomalyRecord, error) {
+	var record models.AnomalyRecord
+	var acknowledgedAt sql.NullTime
+	err := rows.Scan(
+		&record.ID,
+		&record.Ticker,
+		&record.Price,
+		&record.ZScore,
+		&record.Timestamp,
+		&record.Type,
+		&record.Severity,
+		&record.Detector,
+		&record.Status,
+		&record.Source,
+		&acknowledgedAt,
+		&record.AcknowledgedBy,
+		&record.TenantID,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if acknowledgedAt.Valid {
+		record.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	return &record, nil
+}
+
+// GetAnomaliesByStatus retrieves the newest anomalies with the given status
+func (r *anomalyRepository) GetAnomaliesByStatus(ctx context.Context, status string, limit int) ([]*models.AnomalyRecord, error) {
+	if !models.IsValidAnomalyStatus(status) {
+		return nil, fmt.Errorf("unknown anomaly status %q", status)
+	}
+	return r.anomalyRecordsWhere(ctx, "get_anomalies_by_status", "status", status, limit)
+}
+
+// GetAnomaliesBySeverity retrieves the newest anomalies with the given severity
+func (r *anomalyRepository) GetAnomaliesBySeverity(ctx context.Context, severity string, limit int) ([]*models.AnomalyRecord, error) {
+	if !models.IsValidSeverity(severity) {
+		return nil, fmt.Errorf("unknown anomaly severity %q", severity)
+	}
+	return r.anomalyRecordsWhere(ctx, "get_anomalies_by_severity", "severity", severity, limit)
+}
+
+// anomalyRecordsWhere returns the newest anomalies whose column equals value.
+// column is one of the constant column names above, never caller input.
+func (r *anomalyRepository) anomalyRecordsWhere(ctx context.Context, operation, column, value string, limit int) ([]*models.AnomalyRecord, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "success").Observe(time.Since(start).Seconds())
+	}()
+
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM anomalies
+		WHERE %s = $1 AND deleted_at IS NULL AND tenant_id = ANY($3)
+		ORDER BY timestamp DESC
+		LIMIT $2
+	`, anomalyRecordColumns, column)
+
+	rows, err := r.db.Reader().QueryContext(ctx, query, value, limit, visibleTenants(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues(operation, "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues(operation).Inc()
+		return nil, fmt.Errorf("failed to get anomalies by %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	var records []*models.AnomalyRecord
+	for rows.Next() {
+		record, err := scanAnomalyRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating anomalies: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues(operation, "success").Inc()
+	return records, nil
+}
+
 // rawEventRepository implements RawEventRepository
 type rawEventRepository struct {
 	db *DB
@@ -516,7 +846,7 @@ func (r *rawEventRepository) GetRawEventsBySource(ctx context.Context, source st
 		LIMIT $2
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, source, limit)
+	rows, err := r.db.Reader().QueryContext(ctx, query, source, limit)
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_raw_events_by_source", "error").Observe(time.Since(start).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_raw_events_by_source").Inc()
@@ -555,7 +885,7 @@ func (r *rawEventRepository) GetRawEventsByTimeRange(ctx context.Context, start,
 		ORDER BY timestamp ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, start, end)
+	rows, err := r.db.Reader().QueryContext(ctx, query, start, end)
 	if err != nil {
 		metrics.DatabaseOperationDuration.WithLabelValues("get_raw_events_by_time_range", "error").Observe(time.Since(startTime).Seconds())
 		metrics.DatabaseErrors.WithLabelValues("get_raw_events_by_time_range").Inc()
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// retentionBatchSize is how many rows one pruning DELETE removes, keeping
+// locks and WAL bursts short
+const retentionBatchSize = 10000
+
+// retentionTable describes how rows of a table age
+type retentionTable struct {
+	// column orders rows by age
+	column string
+	// millis is set when column holds milliseconds since the epoch rather
+	// than a timestamp
+	millis bool
+}
+
+// RetentionTables are the tables retention and archival apply to
+var RetentionTables = map[string]retentionTable{
+	"raw_events": {column: "timestamp"},
+	"quotes":     {column: "timestamp", millis: true},
+}
+
+// RetentionPolicy says how long rows of Table are kept
+type RetentionPolicy struct {
+	Table string
+	// MaxAge is how long rows are kept; zero keeps them forever
+	MaxAge time.Duration
+	// RequireArchive keeps rows until the archival service has exported them
+	RequireArchive bool
+}
+
+// NewRetentionPolicies reads a policy for each of RetentionTables from
+// RETENTION_<TABLE> (e.g. RETENTION_RAW_EVENTS=720h) and
+// RETENTION_REQUIRE_ARCHIVE. Tables without a retention period are omitted.
+func NewRetentionPolicies() []RetentionPolicy {
+	requireArchive := getEnvOrDefault("RETENTION_REQUIRE_ARCHIVE", "true") != "false"
+
+	var policies []RetentionPolicy
+	for table := range RetentionTables {
+		maxAge := getEnvDurationOrDefault("RETENTION_"+strings.ToUpper(table), 0)
+		if maxAge <= 0 {
+			continue
+		}
+		policies = append(policies, RetentionPolicy{Table: table, MaxAge: maxAge, RequireArchive: requireArchive})
+	}
+	return policies
+}
+
+// RetentionRepository exports and prunes aged rows and tracks how far each
+// table has been archived
+type RetentionRepository interface {
+	ArchiveWatermark(ctx context.Context, table string) (time.Time, bool, error)
+	SetArchiveWatermark(ctx context.Context, table string, until time.Time) error
+	ExportAndPrune(ctx context.Context, table string, until time.Time, export func(rows ExportedRows) error) (int64, error)
+	Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (int64, error)
+}
+
+// ExportedRows calls fn with each exported row, oldest first, encoded as a
+// JSON object along with the time it is aged by
+type ExportedRows func(fn func(row []byte, at time.Time) error) error
+
+// retentionRepository implements RetentionRepository
+type retentionRepository struct {
+	db *DB
+}
+
+// NewRetentionRepository creates a new retention repository
+func NewRetentionRepository(db *DB) RetentionRepository {
+	return &retentionRepository{db: db}
+}
+
+// retentionTableFor returns the description of table
+func retentionTableFor(table string) (retentionTable, error) {
+	t, ok := RetentionTables[table]
+	if !ok {
+		return retentionTable{}, fmt.Errorf("retention is not supported for table %q", table)
+	}
+	return t, nil
+}
+
+// bound converts a time to the representation of t's age column
+func (t retentionTable) bound(at time.Time) interface{} {
+	if t.millis {
+		return at.UnixMilli()
+	}
+	return at
+}
+
+// ArchiveWatermark returns the end of the span of table that has been
+// archived, and false if none has
+func (r *retentionRepository) ArchiveWatermark(ctx context.Context, table string) (time.Time, bool, error) {
+	var until time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT archived_until FROM archive_watermarks WHERE table_name = $1`, table).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get archive watermark: %w", err)
+	}
+	return until, true, nil
+}
+
+// SetArchiveWatermark records that table has been archived up to until
+func (r *retentionRepository) SetArchiveWatermark(ctx context.Context, table string, until time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO archive_watermarks (table_name, archived_until) VALUES ($1, $2)
+		ON CONFLICT (table_name) DO UPDATE SET archived_until = EXCLUDED.archived_until, updated_at = NOW()
+	`, table, until)
+	if err != nil {
+		return fmt.Errorf("failed to set archive watermark: %w", err)
+	}
+	return nil
+}
+
+// ExportAndPrune deletes every row of table aged before until, including
+// rows inserted late with an age before the archive watermark, and passes
+// them to export before committing, advancing the watermark to until in
+// the same transaction. Nothing is deleted unless export returns nil, so no
+// row is pruned without having been exported; a commit failing after
+// export leaves the rows to be exported again by the next run. It returns
+// how many rows were deleted.
+func (r *retentionRepository) ExportAndPrune(ctx context.Context, table string, until time.Time, export func(rows ExportedRows) error) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("export_and_prune", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	t, err := retentionTableFor(table)
+	if err != nil {
+		return 0, err
+	}
+
+	// The rows are read back ordered from the statement deleting them, on
+	// the primary, so rows a lagging replica missed are exported too
+	query := fmt.Sprintf(`
+		WITH deleted AS (DELETE FROM %s WHERE %s < $1 RETURNING *)
+		SELECT %s, row_to_json(deleted)::text FROM deleted ORDER BY %s, id`,
+		table, t.column, t.column, t.column)
+	var deleted int64
+	err = r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, t.bound(until))
+		if err != nil {
+			return fmt.Errorf("failed to prune %s: %w", table, err)
+		}
+		defer rows.Close()
+
+		err = export(func(fn func(row []byte, at time.Time) error) error {
+			for rows.Next() {
+				var row []byte
+				at, err := t.scanAge(rows, &row)
+				if err != nil {
+					return fmt.Errorf("failed to scan %s row: %w", table, err)
+				}
+				if err := fn(row, at); err != nil {
+					return err
+				}
+				deleted++
+			}
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("error iterating %s rows: %w", table, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO archive_watermarks (table_name, archived_until) VALUES ($1, $2)
+			ON CONFLICT (table_name) DO UPDATE SET
+				archived_until = GREATEST(archive_watermarks.archived_until, EXCLUDED.archived_until),
+				updated_at = NOW()
+		`, table, until)
+		if err != nil {
+			return fmt.Errorf("failed to set archive watermark: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("export_and_prune", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("export_and_prune").Inc()
+		return 0, err
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("export_and_prune", "success").Add(float64(deleted))
+	return deleted, nil
+}
+
+// scanAge scans a row of its age column and a JSON encoded row into row,
+// returning the age as a time
+func (t retentionTable) scanAge(rows *sql.Rows, row *[]byte) (time.Time, error) {
+	if t.millis {
+		var ms int64
+		if err := rows.Scan(&ms, row); err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	var at time.Time
+	if err := rows.Scan(&at, row); err != nil {
+		return time.Time{}, err
+	}
+	return at.UTC(), nil
+}
+
+// Prune deletes rows of policy.Table older than policy.MaxAge, in batches,
+// without exporting them. With RequireArchive only rows before the table's
+// archive watermark are deleted, and nothing is deleted before the table is
+// first archived; rows inserted late with an age before the watermark are
+// deleted unexported, so archiving callers use ExportAndPrune instead.
+func (r *retentionRepository) Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("prune", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	t, err := retentionTableFor(policy.Table)
+	if err != nil {
+		return 0, err
+	}
+	if policy.MaxAge <= 0 {
+		return 0, nil
+	}
+
+	cutoff := now.Add(-policy.MaxAge)
+	if policy.RequireArchive {
+		watermark, ok, err := r.ArchiveWatermark(ctx, policy.Table)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			logger.Log.Warn("skipping retention of unarchived table", zap.String("table", policy.Table))
+			return 0, nil
+		}
+		if watermark.Before(cutoff) {
+			cutoff = watermark
+		}
+	}
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s < $1 LIMIT %d)`,
+		policy.Table, policy.Table, t.column, retentionBatchSize)
+	var deleted int64
+	for {
+		result, err := r.db.ExecContext(ctx, query, t.bound(cutoff))
+		if err != nil {
+			metrics.DatabaseOperationDuration.WithLabelValues("prune", "error").Observe(time.Since(start).Seconds())
+			metrics.DatabaseErrors.WithLabelValues("prune").Inc()
+			return deleted, fmt.Errorf("failed to prune %s: %w", policy.Table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to prune %s: %w", policy.Table, err)
+		}
+		deleted += n
+		if n < retentionBatchSize {
+			break
+		}
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("prune", "success").Add(float64(deleted))
+	return deleted, nil
+}
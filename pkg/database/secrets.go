@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedSecretPrefix marks a secret encrypted by SecretCipher. Stored
+// secrets without it predate encryption and are read as they are.
+const sealedSecretPrefix = "enc:v1:"
+
+// ErrSecretKeyMissing is returned when reading an encrypted secret without
+// a secret key configured
+var ErrSecretKeyMissing = errors.New("secret is encrypted but no secret key is configured")
+
+// SecretCipher encrypts secrets that have to be recovered to be used, such
+// as webhook signing secrets, with AES-256-GCM. Secrets only ever compared,
+// like passwords, API keys and refresh tokens, are hashed instead. A nil
+// SecretCipher stores secrets unencrypted.
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewSecretCipher creates a cipher from a base64-encoded 32-byte key, or
+// returns nil for an empty key
+func NewSecretCipher(key string) (*SecretCipher, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("invalid secret key: got %d bytes, want 32", len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+
+	return &SecretCipher{aead: aead}, nil
+}
+
+// Seal returns secret as it is to be stored
+func (c *SecretCipher) Seal(secret string) (string, error) {
+	if c == nil || secret == "" {
+		return secret, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return sealedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open recovers a secret stored by Seal
+func (c *SecretCipher) Open(stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedSecretPrefix)
+	if !ok {
+		return stored, nil
+	}
+	if c == nil {
+		return "", ErrSecretKeyMissing
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("failed to decrypt secret: malformed ciphertext")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	secret, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// EncryptWebhookSecrets encrypts the webhook secrets stored before a secret
+// key was configured in the schema ctx's tenant uses, and returns how many
+// it encrypted
+func (db *DB) EncryptWebhookSecrets(ctx context.Context) (int, error) {
+	if db.secrets == nil {
+		return 0, errors.New("DB_SECRET_KEY is not set")
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT id, secret FROM webhook_subscriptions WHERE secret NOT LIKE $1`, sealedSecretPrefix+"%")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read webhook secrets: %w", err)
+	}
+	defer rows.Close()
+
+	plain := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var secret string
+		if err := rows.Scan(&id, &secret); err != nil {
+			return 0, fmt.Errorf("failed to scan webhook secret: %w", err)
+		}
+		plain[id] = secret
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating webhook secrets: %w", err)
+	}
+	rows.Close()
+
+	encrypted := 0
+	for id, secret := range plain {
+		sealed, err := db.secrets.Seal(secret)
+		if err != nil {
+			return encrypted, err
+		}
+		// Matching on the old value leaves a secret changed meanwhile alone
+		result, err := db.ExecContext(ctx, `UPDATE webhook_subscriptions SET secret = $1 WHERE id = $2 AND secret = $3`, sealed, id, secret)
+		if err != nil {
+			return encrypted, fmt.Errorf("failed to encrypt secret of webhook %d: %w", id, err)
+		}
+		if affected, err := result.RowsAffected(); err == nil {
+			encrypted += int(affected)
+		}
+	}
+
+	return encrypted, nil
+}
@@ -0,0 +1,467 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// anomalyRepository implements database.AnomalyRepository
+type anomalyRepository struct {
+	db *DB
+}
+
+// NewAnomalyRepository creates a new anomaly repository
+func NewAnomalyRepository(db *DB) database.AnomalyRepository {
+	return &anomalyRepository{db: db}
+}
+
+// SaveAnomaly saves an anomaly to the database
+func (r *anomalyRepository) SaveAnomaly(ctx context.Context, anomaly *models.Anomaly) error {
+	anomaly.Sanitize()
+	if err := anomaly.Validate(); err != nil {
+		return fmt.Errorf("anomaly validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO anomalies (ticker, price, z_score, timestamp, tenant_id, type, severity, detector)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, anomaly.Ticker, anomaly.Price, anomaly.ZScore, anomaly.Timestamp, tenant.FromContext(ctx),
+		models.AnomalyTypePriceSpike, anomaly.Severity(), models.AnomalyDetectorZScore)
+	if err != nil {
+		return fmt.Errorf("failed to save anomaly: %w", err)
+	}
+
+	return nil
+}
+
+// GetAnomaliesByTicker retrieves anomalies for a specific ticker
+func (r *anomalyRepository) GetAnomaliesByTicker(ctx context.Context, ticker string, limit int) ([]*models.Anomaly, error) {
+	anomalies, _, err := r.GetAnomaliesByTickerBefore(ctx, ticker, database.FirstPage, limit)
+	return anomalies, err
+}
+
+// GetAnomaliesByTickerBefore returns ticker's newest anomalies before the
+// cursor, and the cursor of the last one for the next page
+func (r *anomalyRepository) GetAnomaliesByTickerBefore(ctx context.Context, ticker string, before database.KeysetCursor, limit int) ([]*models.Anomaly, database.KeysetCursor, error) {
+	query := `
+		SELECT id, ticker, price, z_score, timestamp
+		FROM anomalies
+		WHERE ticker = ? AND (timestamp, id) < (?, ?) AND deleted_at IS NULL AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ticker, before.Timestamp, before.ID, visibleTenants(ctx), pageLimit(limit))
+	if err != nil {
+		return nil, before, fmt.Errorf("failed to get anomalies by ticker: %w", err)
+	}
+	defer rows.Close()
+
+	var anomalies []*models.Anomaly
+	next := before
+	for rows.Next() {
+		var anomaly models.Anomaly
+		if err := rows.Scan(&next.ID, &anomaly.Ticker, &anomaly.Price, &anomaly.ZScore, &anomaly.Timestamp); err != nil {
+			return nil, before, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		next.Timestamp = anomaly.Timestamp
+		anomalies = append(anomalies, &anomaly)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, before, fmt.Errorf("error iterating anomalies: %w", err)
+	}
+
+	return anomalies, next, nil
+}
+
+// GetAnomaliesByTimeRange retrieves anomalies within a time range
+func (r *anomalyRepository) GetAnomaliesByTimeRange(ctx context.Context, start, end int64) ([]*models.Anomaly, error) {
+	query := `
+		SELECT ticker, price, z_score, timestamp
+		FROM anomalies
+		WHERE timestamp BETWEEN ? AND ? AND deleted_at IS NULL AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp DESC
+	`
+
+	anomalies, err := r.queryAnomalies(ctx, query, start, end, visibleTenants(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomalies by time range: %w", err)
+	}
+
+	return anomalies, nil
+}
+
+// GetAnomaliesByZScore retrieves anomalies with z-score above threshold
+func (r *anomalyRepository) GetAnomaliesByZScore(ctx context.Context, minZScore float64, limit int) ([]*models.Anomaly, error) {
+	query := `
+		SELECT ticker, price, z_score, timestamp
+		FROM anomalies
+		WHERE z_score >= ? AND deleted_at IS NULL AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY z_score DESC, timestamp DESC
+		LIMIT ?
+	`
+
+	anomalies, err := r.queryAnomalies(ctx, query, minZScore, visibleTenants(ctx), pageLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomalies by z-score: %w", err)
+	}
+
+	return anomalies, nil
+}
+
+// ListAnomalies retrieves anomalies matching filter, sorted and filtered in SQL
+func (r *anomalyRepository) ListAnomalies(ctx context.Context, filter database.AnomalyFilter) ([]*models.Anomaly, error) {
+	order, err := orderClause(filter.ListOptions, anomalySortColumns, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	where := whereBuilder{conditions: []string{"deleted_at IS NULL"}}
+	where.addTenant(ctx)
+	if filter.Ticker != "" {
+		where.add("ticker = ?", filter.Ticker)
+	}
+	if filter.MinZScore > 0 {
+		where.add("z_score >= ?", filter.MinZScore)
+	}
+	if filter.Severity != "" {
+		where.add("severity = ?", filter.Severity)
+	}
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+	where.addRange(filter.ListOptions)
+
+	query := fmt.Sprintf(`SELECT ticker, price, z_score, timestamp FROM anomalies %s %s`, where.clause(), order)
+
+	anomalies, err := r.queryAnomalies(ctx, query, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+
+	return anomalies, nil
+}
+
+// GetAnomaliesByStatus retrieves the newest anomalies with the given status
+func (r *anomalyRepository) GetAnomaliesByStatus(ctx context.Context, status string, limit int) ([]*models.AnomalyRecord, error) {
+	if !models.IsValidAnomalyStatus(status) {
+		return nil, fmt.Errorf("unknown anomaly status %q", status)
+	}
+	return r.anomalyRecordsWhere(ctx, "status", status, limit)
+}
+
+// GetAnomaliesBySeverity retrieves the newest anomalies with the given severity
+func (r *anomalyRepository) GetAnomaliesBySeverity(ctx context.Context, severity string, limit int) ([]*models.AnomalyRecord, error) {
+	if !models.IsValidSeverity(severity) {
+		return nil, fmt.Errorf("unknown anomaly severity %q", severity)
+	}
+	return r.anomalyRecordsWhere(ctx, "severity", severity, limit)
+}
+
+// anomalyRecordsWhere returns the newest anomalies whose column equals value.
+// column is one of the constant column names above, never caller input.
+func (r *anomalyRepository) anomalyRecordsWhere(ctx context.Context, column, value string, limit int) ([]*models.AnomalyRecord, error) {
+	query := fmt.Sprintf(`
+		SELECT id, ticker, price, z_score, timestamp, type, severity, COALESCE(detector, ''), status,
+			source, acknowledged_at, COALESCE(acknowledged_by, ''), tenant_id, created_at
+		FROM anomalies
+		WHERE %s = ? AND deleted_at IS NULL AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, column)
+
+	rows, err := r.db.QueryContext(ctx, query, value, visibleTenants(ctx), pageLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomalies by %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	var records []*models.AnomalyRecord
+	for rows.Next() {
+		var record models.AnomalyRecord
+		var acknowledgedAt sql.NullTime
+		err := rows.Scan(
+			&record.ID,
+			&record.Ticker,
+			&record.Price,
+			&record.ZScore,
+			&record.Timestamp,
+			&record.Type,
+			&record.Severity,
+			&record.Detector,
+			&record.Status,
+			&record.Source,
+			&acknowledgedAt,
+			&record.AcknowledgedBy,
+			&record.TenantID,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		if acknowledgedAt.Valid {
+			record.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		records = append(records, &record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating anomalies: %w", err)
+	}
+
+	return records, nil
+}
+
+// queryAnomalies runs a query selecting ticker, price, z_score and timestamp
+// and collects the rows
+func (r *anomalyRepository) queryAnomalies(ctx context.Context, query string, args ...interface{}) ([]*models.Anomaly, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anomalies []*models.Anomaly
+	for rows.Next() {
+		var anomaly models.Anomaly
+		if err := rows.Scan(&anomaly.Ticker, &anomaly.Price, &anomaly.ZScore, &anomaly.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		anomalies = append(anomalies, &anomaly)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating anomalies: %w", err)
+	}
+
+	return anomalies, nil
+}
+
+// manualAnomalyRepository implements database.ManualAnomalyRepository
+type manualAnomalyRepository struct {
+	db *DB
+}
+
+// NewManualAnomalyRepository creates a new manual anomaly repository
+func NewManualAnomalyRepository(db *DB) database.ManualAnomalyRepository {
+	return &manualAnomalyRepository{db: db}
+}
+
+// anomalyChangeEvent is the outbox payload of an anomaly being deleted,
+// restored or acknowledged, as written by package database
+type anomalyChangeEvent struct {
+	ID       int64  `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Actor    string `json:"actor"`
+}
+
+// insertAuditEntry records an audit action within tx
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, anomalyID int64, action, actor string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO anomaly_audit_log (anomaly_id, action, actor) VALUES (?, ?, ?)`,
+		anomalyID, action, actor)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// CreateManualAnomaly inserts an anomaly attributed to anomaly.CreatedBy and audits the creation
+func (r *manualAnomalyRepository) CreateManualAnomaly(ctx context.Context, anomaly *models.ManualAnomaly) error {
+	anomaly.Sanitize()
+	if err := anomaly.Validate(); err != nil {
+		return fmt.Errorf("anomaly validation failed: %w", err)
+	}
+
+	anomaly.TenantID = tenant.FromContext(ctx)
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO anomalies (ticker, price, z_score, timestamp, source, note, created_by, tenant_id, severity)
+			VALUES (?, ?, ?, ?, 'manual', NULLIF(?, ''), ?, ?, ?)
+			RETURNING id, created_at
+		`
+		err := tx.QueryRowContext(ctx, query,
+			anomaly.Ticker,
+			anomaly.Price,
+			anomaly.ZScore,
+			anomaly.Timestamp,
+			anomaly.Note,
+			anomaly.CreatedBy,
+			anomaly.TenantID,
+			anomaly.Severity(),
+		).Scan(&anomaly.ID, &anomaly.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if err := insertAuditEntry(ctx, tx, anomaly.ID, models.AuditActionCreate, anomaly.CreatedBy); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxAnomalyStream, database.EventAnomalyCreated, anomaly)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create anomaly: %w", err)
+	}
+
+	return nil
+}
+
+// GetManualAnomaly retrieves a manual anomaly of the context's tenant by ID, including soft-deleted ones
+func (r *manualAnomalyRepository) GetManualAnomaly(ctx context.Context, id int64) (*models.ManualAnomaly, error) {
+	query := `
+		SELECT id, ticker, price, z_score, timestamp, COALESCE(note, ''), COALESCE(created_by, ''),
+			created_at, deleted_at, COALESCE(deleted_by, ''), acknowledged_at, COALESCE(acknowledged_by, ''), tenant_id
+		FROM anomalies
+		WHERE id = ? AND source = 'manual' AND tenant_id = ?
+	`
+
+	var anomaly models.ManualAnomaly
+	var deletedAt, acknowledgedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)).Scan(
+		&anomaly.ID,
+		&anomaly.Ticker,
+		&anomaly.Price,
+		&anomaly.ZScore,
+		&anomaly.Timestamp,
+		&anomaly.Note,
+		&anomaly.CreatedBy,
+		&anomaly.CreatedAt,
+		&deletedAt,
+		&anomaly.DeletedBy,
+		&acknowledgedAt,
+		&anomaly.AcknowledgedBy,
+		&anomaly.TenantID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("anomaly %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomaly: %w", err)
+	}
+	if deletedAt.Valid {
+		anomaly.DeletedAt = &deletedAt.Time
+	}
+	if acknowledgedAt.Valid {
+		anomaly.AcknowledgedAt = &acknowledgedAt.Time
+	}
+
+	return &anomaly, nil
+}
+
+// SoftDeleteAnomaly hides a manual anomaly from queries and audits the deletion
+func (r *manualAnomalyRepository) SoftDeleteAnomaly(ctx context.Context, id int64, actor string) error {
+	query := `
+		UPDATE anomalies SET deleted_at = ?, deleted_by = ?
+		WHERE id = ? AND tenant_id = ? AND source = 'manual' AND deleted_at IS NULL
+	`
+	return r.audited(ctx, id, actor, models.AuditActionDelete, database.EventAnomalyDeleted,
+		query, now(), actor, id, tenant.FromContext(ctx))
+}
+
+// RestoreAnomaly makes a soft-deleted manual anomaly visible again and audits the restore
+func (r *manualAnomalyRepository) RestoreAnomaly(ctx context.Context, id int64, actor string) error {
+	query := `
+		UPDATE anomalies SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = ? AND tenant_id = ? AND source = 'manual' AND deleted_at IS NOT NULL
+	`
+	return r.audited(ctx, id, actor, models.AuditActionRestore, database.EventAnomalyRestored,
+		query, id, tenant.FromContext(ctx))
+}
+
+// AcknowledgeAnomaly marks an unacknowledged anomaly of the context's tenant,
+// detected or manual, as handled by actor and audits the acknowledgement
+func (r *manualAnomalyRepository) AcknowledgeAnomaly(ctx context.Context, id int64, actor string) error {
+	query := `
+		UPDATE anomalies SET acknowledged_at = ?, acknowledged_by = ?, status = 'acknowledged'
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL AND acknowledged_at IS NULL
+	`
+	return r.audited(ctx, id, actor, models.AuditActionAcknowledge, database.EventAnomalyAcknowledged,
+		query, now(), actor, id, tenant.FromContext(ctx))
+}
+
+// GetAnomalyIDAt returns the id of the context tenant's anomaly of ticker at
+// timestamp, preferring one not yet acknowledged
+func (r *manualAnomalyRepository) GetAnomalyIDAt(ctx context.Context, ticker string, timestamp int64) (int64, error) {
+	query := `
+		SELECT id FROM anomalies
+		WHERE tenant_id = ? AND ticker = ? AND timestamp = ? AND deleted_at IS NULL
+		ORDER BY acknowledged_at IS NOT NULL, id
+		LIMIT 1
+	`
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, query, tenant.FromContext(ctx), ticker, timestamp).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("anomaly of %s at %d: %w", ticker, timestamp, database.ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get anomaly id: %w", err)
+	}
+	return id, nil
+}
+
+// audited runs an update of anomaly id expected to touch exactly one row,
+// and records action in the audit log and eventType in the outbox with it
+func (r *manualAnomalyRepository) audited(ctx context.Context, id int64, actor, action, eventType, query string, args ...interface{}) error {
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("anomaly %d: %w", id, database.ErrNotFound)
+		}
+		if err := insertAuditEntry(ctx, tx, id, action, actor); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxAnomalyStream, eventType, anomalyChangeEvent{ID: id, TenantID: tenant.FromContext(ctx), Actor: actor})
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s anomaly: %w", action, err)
+	}
+
+	return nil
+}
+
+// GetAnomalyAuditLog retrieves the audit entries of an anomaly of the context's tenant, oldest first
+func (r *manualAnomalyRepository) GetAnomalyAuditLog(ctx context.Context, anomalyID int64) ([]*models.AnomalyAuditEntry, error) {
+	query := `
+		SELECT l.id, l.anomaly_id, l.action, l.actor, l.created_at
+		FROM anomaly_audit_log l
+		JOIN anomalies a ON a.id = l.anomaly_id
+		WHERE l.anomaly_id = ? AND a.tenant_id = ?
+		ORDER BY l.created_at, l.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, anomalyID, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomaly audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.AnomalyAuditEntry
+	for rows.Next() {
+		var entry models.AnomalyAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.AnomalyID, &entry.Action, &entry.Actor, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+func TestGetAnomaliesByTickerBefore_PagesThroughTies(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	repo := NewAnomalyRepository(db)
+	ts := time.Now().Add(-time.Minute).UnixMilli()
+
+	for _, zScore := range []float64{3.1, 3.2, 3.3} {
+		if err := repo.SaveAnomaly(ctx, &models.Anomaly{Ticker: "BTCUSD", Price: 100, ZScore: zScore, Timestamp: ts}); err != nil {
+			t.Fatalf("SaveAnomaly: %v", err)
+		}
+	}
+
+	first, cursor, err := repo.GetAnomaliesByTickerBefore(ctx, "BTCUSD", database.FirstPage, 2)
+	if err != nil {
+		t.Fatalf("GetAnomaliesByTickerBefore: %v", err)
+	}
+	second, _, err := repo.GetAnomaliesByTickerBefore(ctx, "BTCUSD", cursor, 2)
+	if err != nil {
+		t.Fatalf("GetAnomaliesByTickerBefore: %v", err)
+	}
+
+	seen := make(map[float64]bool)
+	for _, anomaly := range append(first, second...) {
+		seen[anomaly.ZScore] = true
+	}
+	if len(first) != 2 || len(second) != 1 || len(seen) != 3 {
+		t.Errorf("pages = %d and %d anomalies covering %d; want 2 and 1 covering all 3", len(first), len(second), len(seen))
+	}
+}
+
+func TestListAnomalies_ScopedToVisibleTenants(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAnomalyRepository(db)
+	ts := time.Now().Add(-time.Minute).UnixMilli()
+
+	for _, id := range []string{tenant.Default, "acme", "globex"} {
+		ctx := tenant.WithTenant(context.Background(), id)
+		if err := repo.SaveAnomaly(ctx, &models.Anomaly{Ticker: "BTCUSD", Price: 100, ZScore: 3, Timestamp: ts}); err != nil {
+			t.Fatalf("SaveAnomaly(%s): %v", id, err)
+		}
+	}
+
+	for id, want := range map[string]int{tenant.Default: 1, "acme": 2, "globex": 2} {
+		anomalies, err := repo.ListAnomalies(tenant.WithTenant(context.Background(), id), database.AnomalyFilter{})
+		if err != nil {
+			t.Fatalf("ListAnomalies(%s): %v", id, err)
+		}
+		if len(anomalies) != want {
+			t.Errorf("tenant %s sees %d anomalies; want %d", id, len(anomalies), want)
+		}
+	}
+}
+
+func TestAcknowledgeAnomaly_OtherTenantNotFound(t *testing.T) {
+	acme := tenant.WithTenant(context.Background(), "acme")
+	globex := tenant.WithTenant(context.Background(), "globex")
+	db := openTestDB(t)
+	repo := NewAnomalyRepository(db)
+	manual := NewManualAnomalyRepository(db)
+	ts := time.Now().Add(-time.Minute).UnixMilli()
+
+	if err := repo.SaveAnomaly(acme, &models.Anomaly{Ticker: "BTCUSD", Price: 100, ZScore: 3, Timestamp: ts}); err != nil {
+		t.Fatalf("SaveAnomaly: %v", err)
+	}
+	id, err := manual.GetAnomalyIDAt(acme, "BTCUSD", ts)
+	if err != nil {
+		t.Fatalf("GetAnomalyIDAt: %v", err)
+	}
+	if _, err := manual.GetAnomalyIDAt(globex, "BTCUSD", ts); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetAnomalyIDAt from another tenant err = %v; want %v", err, database.ErrNotFound)
+	}
+
+	if err := manual.AcknowledgeAnomaly(globex, id, "mallory"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("AcknowledgeAnomaly from another tenant err = %v; want %v", err, database.ErrNotFound)
+	}
+	if err := manual.AcknowledgeAnomaly(acme, id, "alice"); err != nil {
+		t.Fatalf("AcknowledgeAnomaly: %v", err)
+	}
+	if err := manual.AcknowledgeAnomaly(acme, id, "alice"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("second AcknowledgeAnomaly err = %v; want %v", err, database.ErrNotFound)
+	}
+}
@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// apiKeyTouchInterval bounds how often last_used_at is written for a busy key
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyRepository implements database.APIKeyRepository
+type apiKeyRepository struct {
+	db *DB
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *DB) database.APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, tenant_id, created_by, expires_at, last_used_at, revoked_at, created_at, updated_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var (
+		key                            models.APIKey
+		expiresAt, lastUsedAt, revoked sql.NullTime
+	)
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		stringArray(&key.Scopes),
+		&key.TenantID,
+		&key.CreatedBy,
+		&expiresAt,
+		&lastUsedAt,
+		&revoked,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revoked.Valid {
+		key.RevokedAt = &revoked.Time
+	}
+	return &key, nil
+}
+
+// CreateAPIKey inserts a new API key for the context's tenant
+func (r *apiKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.Sanitize()
+	if err := key.Validate(); err != nil {
+		return fmt.Errorf("api key validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, tenant_id, created_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at, updated_at
+	`
+
+	key.TenantID = tenant.FromContext(ctx)
+	err := r.db.QueryRowContext(ctx, query,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		jsonArray(key.Scopes),
+		key.TenantID,
+		key.CreatedBy,
+		nullableTime(key.ExpiresAt),
+	).Scan(&key.ID, &key.CreatedAt, &key.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("api key %s: %w", key.Prefix, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey retrieves an API key of the context's tenant, revoked or not
+func (r *apiKeyRepository) GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = ? AND tenant_id = ?`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys retrieves every API key of the context's tenant
+func (r *apiKeyRepository) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = ? ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// UpdateAPIKey replaces the name, scopes and expiry of an API key of the context's tenant
+func (r *apiKeyRepository) UpdateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.Sanitize()
+	if err := key.Validate(); err != nil {
+		return fmt.Errorf("api key validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE api_keys
+		SET name = ?, scopes = ?, expires_at = ?, updated_at = ?
+		WHERE id = ? AND tenant_id = ?
+		RETURNING ` + apiKeyColumns
+
+	updated, err := scanAPIKey(r.db.QueryRowContext(ctx, query,
+		key.Name,
+		jsonArray(key.Scopes),
+		nullableTime(key.ExpiresAt),
+		now(),
+		key.ID,
+		tenant.FromContext(ctx),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("api key %d: %w", key.ID, database.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+
+	*key = *updated
+	return nil
+}
+
+// RevokeAPIKey revokes a live API key of the context's tenant. Revoked keys
+// are kept so their last use stays visible.
+func (r *apiKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET revoked_at = ?1, updated_at = ?1 WHERE id = ?2 AND tenant_id = ?3 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, now(), id, tenant.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("api key %d: %w", id, database.ErrNotFound)
+	}
+
+	return nil
+}
+
+// UseAPIKey retrieves the live key with keyHash, of any tenant, and records
+// that it was used. Unknown, revoked and expired keys are reported as
+// ErrNotFound.
+func (r *apiKeyRepository) UseAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+	`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash, now()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key: %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	// Failing to record the use must not fail the request
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now(), key.ID)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// authAuditRepository implements database.AuthAuditRepository
+type authAuditRepository struct {
+	db *DB
+}
+
+// NewAuthAuditRepository creates a new auth audit repository
+func NewAuthAuditRepository(db *DB) database.AuthAuditRepository {
+	return &authAuditRepository{db: db}
+}
+
+// RecordAuthEvent appends event to the audit log
+func (r *authAuditRepository) RecordAuthEvent(ctx context.Context, event *models.AuthEvent) error {
+	query := `
+		INSERT INTO auth_audit_log (event_type, principal, tenant_id, ip, method, route, detail)
+		VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, NULLIF(?, ''))
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		event.Type, event.Principal, event.TenantID, event.IP, event.Method, event.Route, event.Detail,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record auth event: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuthEvents retrieves audit events matching filter, newest first
+func (r *authAuditRepository) ListAuthEvents(ctx context.Context, filter database.AuthEventFilter) ([]*models.AuthEvent, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > database.MaxAuthEventPage {
+		limit = database.MaxAuthEventPage
+	}
+
+	var where whereBuilder
+	if filter.BeforeID > 0 {
+		where.add("id < ?", filter.BeforeID)
+	}
+	if filter.Type != "" {
+		where.add("event_type = ?", filter.Type)
+	}
+	if filter.Principal != "" {
+		where.add("principal = ?", filter.Principal)
+	}
+	if filter.TenantID != "" {
+		where.add("tenant_id = ?", filter.TenantID)
+	}
+	if !filter.Since.IsZero() {
+		where.add("created_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where.add("created_at <= ?", filter.Until.UTC())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, event_type, principal, tenant_id, ip, method, route, detail, created_at
+		FROM auth_audit_log %s
+		ORDER BY id DESC
+		LIMIT %d
+	`, where.clause(), limit)
+
+	rows, err := r.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuthEvent
+	for rows.Next() {
+		var (
+			event                       models.AuthEvent
+			principal, tenantID, detail sql.NullString
+		)
+		if err := rows.Scan(&event.ID, &event.Type, &principal, &tenantID, &event.IP, &event.Method, &event.Route, &detail, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		event.Principal = principal.String
+		event.TenantID = tenantID.String
+		event.Detail = detail.String
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating auth events: %w", err)
+	}
+
+	return events, nil
+}
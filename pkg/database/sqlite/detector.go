@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// globalDetectorScope is the detector_config key holding the global defaults
+const globalDetectorScope = "*"
+
+// detectorConfigRepository implements database.DetectorConfigRepository
+type detectorConfigRepository struct {
+	db *DB
+}
+
+// NewDetectorConfigRepository creates a new detector configuration repository
+func NewDetectorConfigRepository(db *DB) database.DetectorConfigRepository {
+	return &detectorConfigRepository{db: db}
+}
+
+// GetDetectorConfigs retrieves the global configuration (empty Ticker) and all per-ticker overrides
+func (r *detectorConfigRepository) GetDetectorConfigs(ctx context.Context) ([]*models.DetectorConfig, error) {
+	query := `
+		SELECT ticker, threshold, window_size, COALESCE(updated_by, ''), updated_at
+		FROM detector_config
+		ORDER BY ticker
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get detector configs: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []*models.DetectorConfig
+	for rows.Next() {
+		var config models.DetectorConfig
+		if err := rows.Scan(&config.Ticker, &config.Threshold, &config.WindowSize, &config.UpdatedBy, &config.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan detector config: %w", err)
+		}
+		if config.Ticker == globalDetectorScope {
+			config.Ticker = ""
+		}
+		configs = append(configs, &config)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating detector configs: %w", err)
+	}
+
+	return configs, nil
+}
+
+// SaveDetectorConfig inserts or replaces the global configuration or a per-ticker override
+func (r *detectorConfigRepository) SaveDetectorConfig(ctx context.Context, config *models.DetectorConfig) error {
+	config.Sanitize()
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("detector config validation failed: %w", err)
+	}
+
+	scope := config.Ticker
+	if scope == "" {
+		scope = globalDetectorScope
+	}
+
+	query := `
+		INSERT INTO detector_config (ticker, threshold, window_size, updated_by, updated_at)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?)
+		ON CONFLICT (ticker) DO UPDATE SET
+			threshold = excluded.threshold,
+			window_size = excluded.window_size,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at
+		RETURNING updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, scope, config.Threshold, config.WindowSize, config.UpdatedBy, now()).Scan(&config.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save detector config: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDetectorConfig removes a per-ticker override so the ticker falls back to the global configuration
+func (r *detectorConfigRepository) DeleteDetectorConfig(ctx context.Context, ticker string) error {
+	query := `DELETE FROM detector_config WHERE ticker = ? AND ticker <> ?`
+
+	result, err := r.db.ExecContext(ctx, query, ticker, globalDetectorScope)
+	if err != nil {
+		return fmt.Errorf("failed to delete detector config: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("detector override for %q: %w", ticker, database.ErrNotFound)
+	}
+
+	return nil
+}
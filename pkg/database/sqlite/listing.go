@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alim08/fin_line/pkg/database"
+)
+
+// quoteSortColumns and anomalySortColumns map public sort names to columns,
+// as in package database
+var (
+	quoteSortColumns = map[string]string{
+		"ticker":    "ticker",
+		"price":     "price",
+		"timestamp": "timestamp",
+	}
+	anomalySortColumns = map[string]string{
+		"price":     "price",
+		"timestamp": "timestamp",
+		"zscore":    "z_score",
+	}
+)
+
+// whereBuilder accumulates SQL conditions and their arguments in order
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add appends a condition with a single ? placeholder
+func (b *whereBuilder) add(cond string, arg interface{}) {
+	b.conditions = append(b.conditions, cond)
+	b.args = append(b.args, arg)
+}
+
+// addTenant restricts the query to the tenants ctx may see
+func (b *whereBuilder) addTenant(ctx context.Context) {
+	b.add("tenant_id IN (SELECT value FROM json_each(?))", visibleTenants(ctx))
+}
+
+// addRange applies the price and time bounds of opts
+func (b *whereBuilder) addRange(opts database.ListOptions) {
+	if opts.PriceMin != nil {
+		b.add("price >= ?", *opts.PriceMin)
+	}
+	if opts.PriceMax != nil {
+		b.add("price <= ?", *opts.PriceMax)
+	}
+	if opts.Since != nil {
+		b.add("timestamp >= ?", *opts.Since)
+	}
+	if opts.Until != nil {
+		b.add("timestamp <= ?", *opts.Until)
+	}
+}
+
+// clause renders the WHERE clause, or an empty string without conditions
+func (b *whereBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// orderClause renders ORDER BY/LIMIT for opts like the Postgres
+// repositories do, falling back to defaultSort
+func orderClause(opts database.ListOptions, columns map[string]string, defaultSort string) (string, error) {
+	sortBy := opts.SortBy
+	desc := opts.SortDesc
+	if sortBy == "" {
+		sortBy = defaultSort
+		desc = !opts.OrderSet || opts.SortDesc
+	}
+
+	column, ok := columns[sortBy]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", database.ErrInvalidSort, sortBy)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	limit := opts.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	if opts.Peek {
+		limit++
+	}
+
+	order := fmt.Sprintf("ORDER BY %s %s", column, direction)
+	if column != "timestamp" {
+		order += ", timestamp DESC"
+	}
+	return fmt.Sprintf("%s LIMIT %d", order, limit), nil
+}
+
+// pageLimit clamps a page size the way the Postgres repositories do
+func pageLimit(limit int) int {
+	if limit <= 0 || limit > 1000 {
+		return 100
+	}
+	return limit
+}
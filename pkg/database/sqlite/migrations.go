@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations holds the SQLite schema, in the file layout of
+// database.Migrations. It is a reduced equivalent of the Postgres schema
+// rather than a port of each Postgres migration, so versions do not
+// correspond, and there are no down migrations.
+var Migrations = database.MustLoadMigrations(migrationFiles, "migrations")
+
+// RunMigrations applies all pending migrations. An applied migration whose
+// file changed since is reported as database.ErrMigrationDrift; delete the
+// database file to start over.
+func (db *DB) RunMigrations(ctx context.Context) error {
+	checksums, err := db.appliedChecksums(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	for _, migration := range Migrations {
+		checksum, applied := checksums[migration.Version]
+		if applied {
+			if checksum != migration.Checksum {
+				return fmt.Errorf("%w: version %d", database.ErrMigrationDrift, migration.Version)
+			}
+			continue
+		}
+
+		logger.Log.Info("applying migration",
+			zap.Int("version", migration.Version),
+			zap.String("description", migration.Description))
+
+		err := db.Transaction(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.UpSQL); err != nil {
+				return fmt.Errorf("failed to execute migration SQL: %w", err)
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO migrations (version, description, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+				migration.Version, migration.Description, migration.Checksum, now())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+		}
+	}
+
+	logger.Log.Info("database migrations completed")
+	return nil
+}
+
+// GetMigrationStatus returns the status of all migrations
+func (db *DB) GetMigrationStatus(ctx context.Context) ([]database.MigrationStatus, error) {
+	checksums, err := db.appliedChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var status []database.MigrationStatus
+	for _, migration := range Migrations {
+		checksum, applied := checksums[migration.Version]
+		ms := database.MigrationStatus{
+			Version:     migration.Version,
+			Applied:     applied,
+			Description: migration.Description,
+			Drifted:     applied && checksum != migration.Checksum,
+		}
+		if applied {
+			var appliedAt time.Time
+			query := `SELECT applied_at FROM migrations WHERE version = ?`
+			if err := db.QueryRowContext(ctx, query, migration.Version).Scan(&appliedAt); err == nil {
+				ms.AppliedAt = appliedAt
+			}
+		}
+		status = append(status, ms)
+	}
+
+	return status, nil
+}
+
+// appliedChecksums creates the migrations table if needed and returns the
+// checksum of each applied migration
+func (db *DB) appliedChecksums(ctx context.Context) (map[int]string, error) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, checksum FROM migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		checksums[version] = checksum
+	}
+
+	return checksums, rows.Err()
+}
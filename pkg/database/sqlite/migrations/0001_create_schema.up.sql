@@ -0,0 +1,214 @@
+-- Create schema
+
+-- Times are UTC text in the format the driver writes with _time_format=sqlite,
+-- so they compare correctly as strings; arrays are JSON text.
+
+CREATE TABLE quotes (
+	id INTEGER PRIMARY KEY,
+	ticker TEXT NOT NULL,
+	price REAL NOT NULL CHECK (price > 0),
+	timestamp INTEGER NOT NULL,
+	sector TEXT NOT NULL DEFAULT 'unknown',
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	UNIQUE (ticker, timestamp)
+);
+
+CREATE INDEX idx_quotes_tenant_ticker_timestamp ON quotes(tenant_id, ticker, timestamp DESC);
+CREATE INDEX idx_quotes_sector ON quotes(sector);
+
+CREATE VIEW latest_quotes AS
+SELECT ticker, price, timestamp, sector, created_at, tenant_id
+FROM quotes q
+WHERE timestamp = (
+	SELECT MAX(timestamp) FROM quotes
+	WHERE ticker = q.ticker AND tenant_id = q.tenant_id
+);
+
+CREATE TABLE anomalies (
+	id INTEGER PRIMARY KEY,
+	ticker TEXT NOT NULL,
+	price REAL NOT NULL CHECK (price > 0),
+	z_score REAL NOT NULL CHECK (z_score >= 0),
+	timestamp INTEGER NOT NULL,
+	type TEXT NOT NULL DEFAULT 'price_spike',
+	severity TEXT NOT NULL DEFAULT 'low' CHECK (severity IN ('low', 'medium', 'high')),
+	detector TEXT,
+	status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+	source TEXT NOT NULL DEFAULT 'detector' CHECK (source IN ('detector', 'manual')),
+	note TEXT,
+	created_by TEXT,
+	deleted_at TIMESTAMP,
+	deleted_by TEXT,
+	acknowledged_at TIMESTAMP,
+	acknowledged_by TEXT,
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_anomalies_tenant_ticker_timestamp ON anomalies(tenant_id, ticker, timestamp DESC);
+CREATE INDEX idx_anomalies_tenant_timestamp ON anomalies(tenant_id, timestamp DESC);
+
+CREATE TABLE anomaly_audit_log (
+	id INTEGER PRIMARY KEY,
+	anomaly_id INTEGER NOT NULL REFERENCES anomalies(id),
+	action TEXT NOT NULL CHECK (action IN ('create', 'delete', 'restore', 'acknowledge')),
+	actor TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_anomaly_audit_log_anomaly_id ON anomaly_audit_log(anomaly_id);
+
+CREATE TABLE raw_events (
+	id INTEGER PRIMARY KEY,
+	source TEXT NOT NULL,
+	symbol TEXT NOT NULL,
+	price REAL NOT NULL CHECK (price > 0),
+	timestamp TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_raw_events_source_timestamp ON raw_events(source, timestamp);
+CREATE INDEX idx_raw_events_timestamp ON raw_events(timestamp);
+
+CREATE TABLE sectors (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+INSERT INTO sectors (name, description) VALUES
+	('crypto', 'Cryptocurrency assets'),
+	('stocks', 'Stock market securities'),
+	('forex', 'Foreign exchange markets'),
+	('commodities', 'Commodity markets'),
+	('unknown', 'Unknown or unclassified assets');
+
+CREATE TABLE tickers (
+	id INTEGER PRIMARY KEY,
+	symbol TEXT NOT NULL UNIQUE,
+	name TEXT,
+	sector_id INTEGER REFERENCES sectors(id),
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+-- ticker '*' holds the global defaults
+CREATE TABLE detector_config (
+	ticker TEXT PRIMARY KEY,
+	threshold REAL NOT NULL CHECK (threshold > 0),
+	window_size INTEGER NOT NULL CHECK (window_size >= 2),
+	updated_by TEXT,
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE webhook_subscriptions (
+	id INTEGER PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	tickers TEXT NOT NULL DEFAULT '[]',
+	severities TEXT NOT NULL DEFAULT '[]',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_webhook_subscriptions_tenant_owner ON webhook_subscriptions(tenant_id, owner_id);
+
+CREATE TABLE watchlists (
+	id INTEGER PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	name TEXT NOT NULL,
+	tickers TEXT NOT NULL DEFAULT '[]',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	UNIQUE (tenant_id, owner_id, name)
+);
+
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	email TEXT,
+	password_hash TEXT NOT NULL,
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE roles (
+	name TEXT PRIMARY KEY,
+	description TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+INSERT INTO roles (name, description) VALUES
+	('admin', 'Full access'),
+	('user', 'Market data and own anomalies, webhooks and watchlists');
+
+CREATE TABLE user_roles (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	granted_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE refresh_tokens (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	replaced_by INTEGER REFERENCES refresh_tokens(id),
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL UNIQUE,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '[]',
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	created_by TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_api_keys_tenant_id ON api_keys(tenant_id);
+
+CREATE TABLE auth_audit_log (
+	id INTEGER PRIMARY KEY,
+	event_type TEXT NOT NULL,
+	principal TEXT,
+	tenant_id TEXT,
+	ip TEXT NOT NULL,
+	method TEXT NOT NULL,
+	route TEXT NOT NULL,
+	detail TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_auth_audit_log_principal ON auth_audit_log(principal, created_at);
+
+CREATE TABLE outbox (
+	id INTEGER PRIMARY KEY,
+	stream TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	published_at TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_published_at ON outbox(published_at);
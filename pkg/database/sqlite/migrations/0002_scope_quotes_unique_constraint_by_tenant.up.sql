@@ -0,0 +1,35 @@
+-- Scope quotes unique constraint by tenant
+
+-- SQLite cannot alter a table constraint, so quotes is rebuilt with
+-- UNIQUE (tenant_id, ticker, timestamp), the key quote upserts resolve
+-- conflicts on. latest_quotes reads quotes and is recreated with it.
+DROP VIEW latest_quotes;
+
+CREATE TABLE quotes_new (
+	id INTEGER PRIMARY KEY,
+	ticker TEXT NOT NULL,
+	price REAL NOT NULL CHECK (price > 0),
+	timestamp INTEGER NOT NULL,
+	sector TEXT NOT NULL DEFAULT 'unknown',
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	UNIQUE (tenant_id, ticker, timestamp)
+);
+
+INSERT INTO quotes_new (id, ticker, price, timestamp, sector, tenant_id, created_at, updated_at)
+SELECT id, ticker, price, timestamp, sector, tenant_id, created_at, updated_at FROM quotes;
+
+DROP TABLE quotes;
+ALTER TABLE quotes_new RENAME TO quotes;
+
+CREATE INDEX idx_quotes_tenant_ticker_timestamp ON quotes(tenant_id, ticker, timestamp DESC);
+CREATE INDEX idx_quotes_sector ON quotes(sector);
+
+CREATE VIEW latest_quotes AS
+SELECT ticker, price, timestamp, sector, created_at, tenant_id
+FROM quotes q
+WHERE timestamp = (
+	SELECT MAX(timestamp) FROM quotes
+	WHERE ticker = q.ticker AND tenant_id = q.tenant_id
+);
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+)
+
+// outboxRepository implements database.OutboxRepository
+type outboxRepository struct {
+	db *DB
+}
+
+// NewOutboxRepository creates a new outbox repository. SQLite has no
+// notifications, so the relay finds new events by polling.
+func NewOutboxRepository(db *DB) database.OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// enqueueOutboxEvent records an event in tx, so it is published if and only
+// if tx commits
+func enqueueOutboxEvent(ctx context.Context, tx *sql.Tx, stream, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	query := `INSERT INTO outbox (stream, event_type, payload) VALUES (?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, query, stream, eventType, string(data)); err != nil {
+		return fmt.Errorf("failed to write %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// PublishOutboxEvents passes up to limit of the oldest unpublished events to
+// publish and marks them published once it returns nil, so events are
+// delivered at least once. Unlike Postgres, no transaction is held while
+// publish runs, since it would block every other write; a single relay per
+// database is assumed.
+func (r *outboxRepository) PublishOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []*database.OutboxEvent) error) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, stream, event_type, payload, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*database.OutboxEvent
+	var ids []interface{}
+	for rows.Next() {
+		var event database.OutboxEvent
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Stream, &event.Type, &payload, &event.CreatedAt); err != nil {
+			return 0, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, &event)
+		ids = append(ids, event.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating outbox events: %w", err)
+	}
+	rows.Close()
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return 0, fmt.Errorf("failed to publish outbox events: %w", err)
+	}
+
+	query := `UPDATE outbox SET published_at = ? WHERE id IN (` + placeholders(len(ids)) + `)`
+	if _, err := r.db.ExecContext(ctx, query, append([]interface{}{now()}, ids...)...); err != nil {
+		return 0, fmt.Errorf("failed to publish outbox events: %w", err)
+	}
+
+	return len(events), nil
+}
+
+// DeletePublishedOutboxEvents removes events published before before
+func (r *outboxRepository) DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox events: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox events: %w", err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,460 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// quoteRepository implements database.QuoteRepository
+type quoteRepository struct {
+	db *DB
+}
+
+// NewQuoteRepository creates a new quote repository
+func NewQuoteRepository(db *DB) database.QuoteRepository {
+	return &quoteRepository{db: db}
+}
+
+// saveQuoteQuery upserts a quote by tenant, ticker and timestamp
+const saveQuoteQuery = `
+	INSERT INTO quotes (ticker, price, timestamp, sector, tenant_id)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (tenant_id, ticker, timestamp) DO UPDATE SET
+		price = excluded.price,
+		sector = excluded.sector,
+		updated_at = excluded.updated_at
+`
+
+// SaveQuote saves a quote to the database
+func (r *quoteRepository) SaveQuote(ctx context.Context, quote *models.NormalizedTick) error {
+	quote.Sanitize()
+	if err := quote.Validate(); err != nil {
+		return fmt.Errorf("quote validation failed: %w", err)
+	}
+
+	_, err := r.db.ExecContext(ctx, saveQuoteQuery, quote.Ticker, quote.Price, quote.Timestamp, quote.Sector, tenant.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to save quote: %w", err)
+	}
+
+	return nil
+}
+
+// SaveQuotes saves a batch of quotes in one transaction. Quotes are upserted
+// in order, so within the batch the last quote of a ticker and timestamp
+// wins. Nothing is stored if any quote is invalid.
+func (r *quoteRepository) SaveQuotes(ctx context.Context, quotes []*models.NormalizedTick) error {
+	for i, quote := range quotes {
+		quote.Sanitize()
+		if err := quote.Validate(); err != nil {
+			return fmt.Errorf("quote %d validation failed: %w", i, err)
+		}
+	}
+	if len(quotes) == 0 {
+		return nil
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, saveQuoteQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, quote := range quotes {
+			if _, err := stmt.ExecContext(ctx, quote.Ticker, quote.Price, quote.Timestamp, quote.Sector, tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save quotes: %w", err)
+	}
+
+	return nil
+}
+
+// BackfillQuotes stores quotes recorded in the past in one transaction and
+// returns how many it inserted. Quotes already stored for the same ticker
+// and timestamp are left untouched.
+func (r *quoteRepository) BackfillQuotes(ctx context.Context, quotes []*models.NormalizedTick) (int64, error) {
+	for i, quote := range quotes {
+		if err := quote.ValidateHistorical(); err != nil {
+			return 0, fmt.Errorf("quote %d validation failed: %w", i, err)
+		}
+	}
+	if len(quotes) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		INSERT INTO quotes (ticker, price, timestamp, sector, tenant_id)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, ticker, timestamp) DO NOTHING
+	`
+
+	tenantID := tenant.FromContext(ctx)
+	var inserted int64
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, quote := range quotes {
+			result, err := stmt.ExecContext(ctx, quote.Ticker, quote.Price, quote.Timestamp, quote.Sector, tenantID)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			inserted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to backfill quotes: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// GetLatestQuotes retrieves the latest quote for each ticker
+func (r *quoteRepository) GetLatestQuotes(ctx context.Context) ([]*models.NormalizedTick, error) {
+	query := `
+		SELECT ticker, price, timestamp, sector
+		FROM latest_quotes
+		WHERE tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY ticker
+	`
+
+	quotes, err := r.queryQuotes(ctx, query, visibleTenants(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest quotes: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// GetQuotesByTicker retrieves quotes for a specific ticker
+func (r *quoteRepository) GetQuotesByTicker(ctx context.Context, ticker string, limit int) ([]*models.NormalizedTick, error) {
+	quotes, _, err := r.GetQuotesByTickerBefore(ctx, ticker, database.FirstPage, limit)
+	return quotes, err
+}
+
+// GetQuotesByTickerBefore returns ticker's newest quotes before the cursor,
+// and the cursor of the last one for the next page
+func (r *quoteRepository) GetQuotesByTickerBefore(ctx context.Context, ticker string, before database.KeysetCursor, limit int) ([]*models.NormalizedTick, database.KeysetCursor, error) {
+	query := `
+		SELECT id, ticker, price, timestamp, sector
+		FROM quotes
+		WHERE ticker = ? AND (timestamp, id) < (?, ?) AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ticker, before.Timestamp, before.ID, visibleTenants(ctx), pageLimit(limit))
+	if err != nil {
+		return nil, before, fmt.Errorf("failed to get quotes by ticker: %w", err)
+	}
+	defer rows.Close()
+
+	var quotes []*models.NormalizedTick
+	next := before
+	for rows.Next() {
+		var quote models.NormalizedTick
+		if err := rows.Scan(&next.ID, &quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector); err != nil {
+			return nil, before, fmt.Errorf("failed to scan quote: %w", err)
+		}
+		next.Timestamp = quote.Timestamp
+		quotes = append(quotes, &quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, before, fmt.Errorf("error iterating quotes: %w", err)
+	}
+
+	return quotes, next, nil
+}
+
+// GetQuotesBySector retrieves quotes for a specific sector
+func (r *quoteRepository) GetQuotesBySector(ctx context.Context, sector string, limit int) ([]*models.NormalizedTick, error) {
+	query := `
+		SELECT ticker, price, timestamp, sector
+		FROM quotes
+		WHERE sector = ? AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`
+
+	quotes, err := r.queryQuotes(ctx, query, sector, visibleTenants(ctx), pageLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quotes by sector: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// GetQuotesByTimeRange retrieves quotes within a time range
+func (r *quoteRepository) GetQuotesByTimeRange(ctx context.Context, ticker string, start, end int64) ([]*models.NormalizedTick, error) {
+	query := `
+		SELECT ticker, price, timestamp, sector
+		FROM quotes
+		WHERE ticker = ? AND timestamp BETWEEN ? AND ? AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp ASC
+	`
+
+	quotes, err := r.queryQuotes(ctx, query, ticker, start, end, visibleTenants(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quotes by time range: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// GetQuotesByTimeRangeDownsampled retrieves the quotes within a time range
+// reduced to the first, last, lowest and highest quote of each
+// resolution-wide bucket aligned to the Unix epoch, oldest first
+func (r *quoteRepository) GetQuotesByTimeRangeDownsampled(ctx context.Context, ticker string, start, end int64, resolution time.Duration) ([]*models.NormalizedTick, error) {
+	width := resolution.Milliseconds()
+	if width <= 0 || end < start {
+		return nil, fmt.Errorf("%w: resolution must be at least 1ms and end not before start", database.ErrInvalidRange)
+	}
+	if (end-start)/width > database.MaxCandles {
+		return nil, fmt.Errorf("%w: range spans more than %d buckets", database.ErrInvalidRange, database.MaxCandles)
+	}
+
+	query := `
+		SELECT ticker, price, timestamp, sector
+		FROM (
+			SELECT ticker, price, timestamp, sector,
+				ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY timestamp ASC) AS first_rank,
+				ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY timestamp DESC) AS last_rank,
+				ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY price ASC, timestamp ASC) AS low_rank,
+				ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY price DESC, timestamp ASC) AS high_rank
+			FROM (
+				SELECT ticker, price, timestamp, sector, timestamp - (timestamp % ?4) AS bucket
+				FROM quotes
+				WHERE ticker = ?1 AND timestamp BETWEEN ?2 AND ?3 AND tenant_id IN (SELECT value FROM json_each(?5))
+			)
+		)
+		WHERE first_rank = 1 OR last_rank = 1 OR low_rank = 1 OR high_rank = 1
+		ORDER BY timestamp ASC
+	`
+
+	quotes, err := r.queryQuotes(ctx, query, ticker, start, end, width, visibleTenants(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get downsampled quotes: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// GetQuoteAt retrieves the last known quote for ticker at or before ts (milliseconds since epoch)
+func (r *quoteRepository) GetQuoteAt(ctx context.Context, ticker string, ts int64) (*models.NormalizedTick, error) {
+	query := `
+		SELECT ticker, price, timestamp, sector
+		FROM quotes
+		WHERE ticker = ? AND timestamp <= ? AND tenant_id IN (SELECT value FROM json_each(?))
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`
+
+	var quote models.NormalizedTick
+	err := r.db.QueryRowContext(ctx, query, ticker, ts, visibleTenants(ctx)).Scan(&quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no quote for %s at or before %d: %w", ticker, ts, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quote at time: %w", err)
+	}
+
+	return &quote, nil
+}
+
+// candlesQuery aggregates candles from quotes. Window functions stand in
+// for the array_agg the Postgres query picks open and close with.
+const candlesQuery = `
+	SELECT DISTINCT bucket,
+		FIRST_VALUE(price) OVER w,
+		MAX(price) OVER w,
+		MIN(price) OVER w,
+		LAST_VALUE(price) OVER w,
+		COUNT(*) OVER w
+	FROM (
+		SELECT price, timestamp, timestamp - (timestamp % ?) AS bucket
+		FROM quotes
+		WHERE ticker = ? AND timestamp >= ? AND timestamp < ? AND tenant_id IN (SELECT value FROM json_each(?))
+	)
+	WINDOW w AS (PARTITION BY bucket ORDER BY timestamp ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING)
+	ORDER BY bucket ASC
+`
+
+// GetCandles aggregates ticker's quotes in [start, end) into interval-wide
+// buckets aligned to the Unix epoch. Buckets without quotes are omitted.
+func (r *quoteRepository) GetCandles(ctx context.Context, ticker string, start, end int64, interval time.Duration) ([]*database.Candle, error) {
+	width := interval.Milliseconds()
+	if width <= 0 || end <= start {
+		return nil, fmt.Errorf("%w: interval must be positive and end after start", database.ErrInvalidRange)
+	}
+	if (end-start)/width > database.MaxCandles {
+		return nil, fmt.Errorf("%w: range spans more than %d candles", database.ErrInvalidRange, database.MaxCandles)
+	}
+
+	rows, err := r.db.QueryContext(ctx, candlesQuery, width, ticker, start, end, visibleTenants(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+	defer rows.Close()
+
+	var candles []*database.Candle
+	for rows.Next() {
+		candle := database.Candle{Ticker: ticker}
+		if err := rows.Scan(&candle.Start, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candle.End = candle.Start + width
+		candles = append(candles, &candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating candles: %w", err)
+	}
+
+	return candles, nil
+}
+
+// ListQuotes retrieves quotes matching filter, sorted and filtered in SQL
+func (r *quoteRepository) ListQuotes(ctx context.Context, filter database.QuoteFilter) ([]*models.NormalizedTick, error) {
+	order, err := orderClause(filter.ListOptions, quoteSortColumns, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	table := "quotes"
+	if filter.Latest {
+		table = "latest_quotes"
+	}
+
+	var where whereBuilder
+	where.addTenant(ctx)
+	if filter.Ticker != "" {
+		where.add("ticker = ?", filter.Ticker)
+	}
+	if filter.Sector != "" {
+		where.add("sector = ?", filter.Sector)
+	}
+	where.addRange(filter.ListOptions)
+
+	query := fmt.Sprintf(`SELECT ticker, price, timestamp, sector FROM %s %s %s`, table, where.clause(), order)
+
+	quotes, err := r.queryQuotes(ctx, query, where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quotes: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// GetQuoteStats retrieves statistics about quotes
+func (r *quoteRepository) GetQuoteStats(ctx context.Context) (*database.QuoteStats, error) {
+	query := `
+		SELECT
+			COUNT(*),
+			COUNT(DISTINCT ticker),
+			MAX(created_at),
+			COALESCE(AVG(price), 0),
+			COUNT(DISTINCT sector)
+		FROM quotes
+		WHERE tenant_id IN (SELECT value FROM json_each(?))
+	`
+
+	var stats database.QuoteStats
+	err := r.db.QueryRowContext(ctx, query, visibleTenants(ctx)).Scan(
+		&stats.TotalQuotes,
+		&stats.TotalTickers,
+		timeText(&stats.LastUpdate),
+		&stats.AvgPrice,
+		&stats.TotalSectors,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quote stats: %w", err)
+	}
+
+	sectors, err := r.getSectorStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sector stats: %w", err)
+	}
+	stats.Sectors = sectors
+
+	return &stats, nil
+}
+
+// getSectorStats computes per-sector quote statistics
+func (r *quoteRepository) getSectorStats(ctx context.Context) ([]*database.SectorStats, error) {
+	query := `
+		SELECT sector, COUNT(*), COUNT(DISTINCT ticker), AVG(price), MIN(price), MAX(price), MAX(created_at)
+		FROM quotes
+		WHERE tenant_id IN (SELECT value FROM json_each(?))
+		GROUP BY sector
+		ORDER BY sector
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, visibleTenants(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sectors := []*database.SectorStats{}
+	for rows.Next() {
+		var s database.SectorStats
+		if err := rows.Scan(&s.Sector, &s.TotalQuotes, &s.TotalTickers, &s.AvgPrice, &s.MinPrice, &s.MaxPrice, timeText(&s.LastUpdate)); err != nil {
+			return nil, fmt.Errorf("failed to scan sector stats: %w", err)
+		}
+		sectors = append(sectors, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sector stats: %w", err)
+	}
+
+	return sectors, nil
+}
+
+// queryQuotes runs a query selecting ticker, price, timestamp and sector and
+// collects the rows
+func (r *quoteRepository) queryQuotes(ctx context.Context, query string, args ...interface{}) ([]*models.NormalizedTick, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotes []*models.NormalizedTick
+	for rows.Next() {
+		var quote models.NormalizedTick
+		if err := rows.Scan(&quote.Ticker, &quote.Price, &quote.Timestamp, &quote.Sector); err != nil {
+			return nil, fmt.Errorf("failed to scan quote: %w", err)
+		}
+		quotes = append(quotes, &quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quotes: %w", err)
+	}
+
+	return quotes, nil
+}
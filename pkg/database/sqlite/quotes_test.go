@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	db, err := Open(":memory:", "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.RunMigrations(context.Background()); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
+
+func TestSaveQuote_ConflictUpdatesExistingRow(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	repo := NewQuoteRepository(db)
+	ts := time.Now().Add(-time.Minute).UnixMilli()
+
+	first := &models.NormalizedTick{Ticker: "BTCUSD", Price: 100, Timestamp: ts, Sector: "crypto"}
+	if err := repo.SaveQuote(ctx, first); err != nil {
+		t.Fatalf("SaveQuote: %v", err)
+	}
+	second := &models.NormalizedTick{Ticker: "BTCUSD", Price: 105.5, Timestamp: ts, Sector: "crypto"}
+	if err := repo.SaveQuote(ctx, second); err != nil {
+		t.Fatalf("SaveQuote on conflict: %v", err)
+	}
+
+	quotes, err := repo.GetQuotesByTicker(ctx, "BTCUSD", 10)
+	if err != nil {
+		t.Fatalf("GetQuotesByTicker: %v", err)
+	}
+	if len(quotes) != 1 {
+		t.Fatalf("len(quotes) = %d; want 1", len(quotes))
+	}
+	if quotes[0].Price != 105.5 {
+		t.Errorf("Price = %v; want %v", quotes[0].Price, 105.5)
+	}
+}
+
+func TestSaveQuote_TenantsKeepSeparateRows(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQuoteRepository(db)
+	ts := time.Now().Add(-time.Minute).UnixMilli()
+
+	acme := tenant.WithTenant(context.Background(), "acme")
+	globex := tenant.WithTenant(context.Background(), "globex")
+	if err := repo.SaveQuote(acme, &models.NormalizedTick{Ticker: "BTCUSD", Price: 100, Timestamp: ts, Sector: "crypto"}); err != nil {
+		t.Fatalf("SaveQuote acme: %v", err)
+	}
+	if err := repo.SaveQuotes(globex, []*models.NormalizedTick{{Ticker: "BTCUSD", Price: 200, Timestamp: ts, Sector: "crypto"}}); err != nil {
+		t.Fatalf("SaveQuotes globex: %v", err)
+	}
+	if _, err := repo.BackfillQuotes(globex, []*models.NormalizedTick{{Ticker: "BTCUSD", Price: 300, Timestamp: ts, Sector: "crypto"}}); err != nil {
+		t.Fatalf("BackfillQuotes globex: %v", err)
+	}
+
+	for ctx, want := range map[context.Context]float64{acme: 100, globex: 200} {
+		quotes, err := repo.GetQuotesByTicker(ctx, "BTCUSD", 10)
+		if err != nil {
+			t.Fatalf("GetQuotesByTicker: %v", err)
+		}
+		if len(quotes) != 1 || quotes[0].Price != want {
+			t.Errorf("tenant %s quotes = %+v; want one at %v", tenant.FromContext(ctx), quotes, want)
+		}
+	}
+}
+
+func TestSaveQuotes_ConflictLastQuoteWins(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	repo := NewQuoteRepository(db)
+	older := time.Now().Add(-2 * time.Minute).UnixMilli()
+	newer := time.Now().Add(-time.Minute).UnixMilli()
+
+	if err := repo.SaveQuote(ctx, &models.NormalizedTick{Ticker: "ETHUSD", Price: 10, Timestamp: older, Sector: "crypto"}); err != nil {
+		t.Fatalf("SaveQuote: %v", err)
+	}
+
+	batch := []*models.NormalizedTick{
+		{Ticker: "ETHUSD", Price: 11, Timestamp: older, Sector: "crypto"},
+		{Ticker: "ETHUSD", Price: 12, Timestamp: older, Sector: "crypto"},
+		{Ticker: "ETHUSD", Price: 13, Timestamp: newer, Sector: "crypto"},
+	}
+	if err := repo.SaveQuotes(ctx, batch); err != nil {
+		t.Fatalf("SaveQuotes: %v", err)
+	}
+
+	quotes, err := repo.GetQuotesByTicker(ctx, "ETHUSD", 10)
+	if err != nil {
+		t.Fatalf("GetQuotesByTicker: %v", err)
+	}
+	want := map[int64]float64{older: 12, newer: 13}
+	if len(quotes) != len(want) {
+		t.Fatalf("len(quotes) = %d; want %d", len(quotes), len(want))
+	}
+	for _, quote := range quotes {
+		if quote.Price != want[quote.Timestamp] {
+			t.Errorf("Price at %d = %v; want %v", quote.Timestamp, quote.Price, want[quote.Timestamp])
+		}
+	}
+}
+
+func TestBackfillQuotes_KeepsStoredQuotes(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	repo := NewQuoteRepository(db)
+	recent := time.Now().Add(-time.Minute).UnixMilli()
+	old := time.Now().AddDate(0, -1, 0).UnixMilli()
+
+	if err := repo.SaveQuote(ctx, &models.NormalizedTick{Ticker: "BTCUSD", Price: 100, Timestamp: recent, Sector: "crypto"}); err != nil {
+		t.Fatalf("SaveQuote: %v", err)
+	}
+
+	batch := []*models.NormalizedTick{
+		{Ticker: "BTCUSD", Price: 90, Timestamp: old, Sector: "crypto"},
+		{Ticker: "BTCUSD", Price: 99, Timestamp: recent, Sector: "crypto"},
+	}
+	for run := 1; run <= 2; run++ {
+		inserted, err := repo.BackfillQuotes(ctx, batch)
+		if err != nil {
+			t.Fatalf("BackfillQuotes run %d: %v", run, err)
+		}
+		want := int64(1)
+		if run == 2 {
+			want = 0
+		}
+		if inserted != want {
+			t.Errorf("run %d inserted %d; want %d", run, inserted, want)
+		}
+	}
+
+	quotes, err := repo.GetQuotesByTimeRange(ctx, "BTCUSD", old, recent)
+	if err != nil {
+		t.Fatalf("GetQuotesByTimeRange: %v", err)
+	}
+	want := map[int64]float64{old: 90, recent: 100}
+	if len(quotes) != len(want) {
+		t.Fatalf("len(quotes) = %d; want %d", len(quotes), len(want))
+	}
+	for _, quote := range quotes {
+		if quote.Price != want[quote.Timestamp] {
+			t.Errorf("Price at %d = %v; want %v", quote.Timestamp, quote.Price, want[quote.Timestamp])
+		}
+	}
+}
+
+func TestListQuotes_OrderAppliesToDefaultSort(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	repo := NewQuoteRepository(db)
+	ts := time.Now().Add(-time.Hour).UnixMilli()
+
+	for i := int64(0); i < 3; i++ {
+		quote := &models.NormalizedTick{Ticker: "BTCUSD", Price: 100, Timestamp: ts + i*1000, Sector: "crypto"}
+		if err := repo.SaveQuote(ctx, quote); err != nil {
+			t.Fatalf("SaveQuote: %v", err)
+		}
+	}
+
+	quotes, err := repo.ListQuotes(ctx, database.QuoteFilter{ListOptions: database.ListOptions{OrderSet: true}})
+	if err != nil {
+		t.Fatalf("ListQuotes: %v", err)
+	}
+	if len(quotes) != 3 {
+		t.Fatalf("len(quotes) = %d; want 3", len(quotes))
+	}
+	for i, quote := range quotes {
+		if want := ts + int64(i)*1000; quote.Timestamp != want {
+			t.Errorf("quotes[%d].Timestamp = %d; want %d (ascending)", i, quote.Timestamp, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// rawEventRepository implements database.RawEventRepository
+type rawEventRepository struct {
+	db *DB
+}
+
+// NewRawEventRepository creates a new raw event repository
+func NewRawEventRepository(db *DB) database.RawEventRepository {
+	return &rawEventRepository{db: db}
+}
+
+const saveRawEventQuery = `INSERT INTO raw_events (source, symbol, price, timestamp) VALUES (?, ?, ?, ?)`
+
+// SaveRawEvent saves a raw event to the database
+func (r *rawEventRepository) SaveRawEvent(ctx context.Context, event *models.RawTick) error {
+	event.Sanitize()
+	if err := event.Validate(); err != nil {
+		return fmt.Errorf("raw event validation failed: %w", err)
+	}
+
+	_, err := r.db.ExecContext(ctx, saveRawEventQuery, event.Source, event.Symbol, event.Price, event.Timestamp.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save raw event: %w", err)
+	}
+
+	return nil
+}
+
+// SaveRawEvents saves a batch of raw events in one transaction. Nothing is
+// stored if any event is invalid.
+func (r *rawEventRepository) SaveRawEvents(ctx context.Context, events []*models.RawTick) error {
+	for i, event := range events {
+		event.Sanitize()
+		if err := event.Validate(); err != nil {
+			return fmt.Errorf("raw event %d validation failed: %w", i, err)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, saveRawEventQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, event := range events {
+			if _, err := stmt.ExecContext(ctx, event.Source, event.Symbol, event.Price, event.Timestamp.UTC()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save raw events: %w", err)
+	}
+
+	return nil
+}
+
+// GetRawEventsBySource retrieves raw events for a specific source
+func (r *rawEventRepository) GetRawEventsBySource(ctx context.Context, source string, limit int) ([]*models.RawTick, error) {
+	query := `
+		SELECT source, symbol, price, timestamp
+		FROM raw_events
+		WHERE source = ?
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`
+
+	events, err := r.queryRawEvents(ctx, query, source, pageLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw events by source: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetRawEventsByTimeRange retrieves raw events within a time range
+func (r *rawEventRepository) GetRawEventsByTimeRange(ctx context.Context, start, end time.Time) ([]*models.RawTick, error) {
+	query := `
+		SELECT source, symbol, price, timestamp
+		FROM raw_events
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC
+	`
+
+	events, err := r.queryRawEvents(ctx, query, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw events by time range: %w", err)
+	}
+
+	return events, nil
+}
+
+// StreamRawEvents calls fn for each raw event matching filter without
+// buffering the result set. An error from fn stops iteration and is returned
+// unwrapped.
+func (r *rawEventRepository) StreamRawEvents(ctx context.Context, filter database.RawEventFilter, fn func(id int64, event *models.RawTick) error) error {
+	limit := filter.Limit
+	if limit <= 0 || limit > database.MaxRawEventPage {
+		limit = database.MaxRawEventPage
+	}
+
+	var where whereBuilder
+	if filter.AfterID > 0 {
+		where.add("id > ?", filter.AfterID)
+	}
+	if filter.Source != "" {
+		where.add("source = ?", filter.Source)
+	}
+	if filter.Symbol != "" {
+		where.add("symbol = ?", filter.Symbol)
+	}
+	if !filter.Since.IsZero() {
+		where.add("timestamp >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where.add("timestamp <= ?", filter.Until.UTC())
+	}
+
+	query := fmt.Sprintf(`SELECT id, source, symbol, price, timestamp FROM raw_events %s ORDER BY id ASC LIMIT %d`, where.clause(), limit)
+
+	rows, err := r.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream raw events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var event models.RawTick
+		if err := rows.Scan(&id, &event.Source, &event.Symbol, &event.Price, &event.Timestamp); err != nil {
+			return fmt.Errorf("failed to scan raw event: %w", err)
+		}
+		if err := fn(id, &event); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating raw events: %w", err)
+	}
+
+	return nil
+}
+
+// queryRawEvents runs a query selecting source, symbol, price and timestamp
+// and collects the rows
+func (r *rawEventRepository) queryRawEvents(ctx context.Context, query string, args ...interface{}) ([]*models.RawTick, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.RawTick
+	for rows.Next() {
+		var event models.RawTick
+		if err := rows.Scan(&event.Source, &event.Symbol, &event.Price, &event.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan raw event: %w", err)
+		}
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating raw events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,386 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+)
+
+// tickerRepository implements database.TickerRepository
+type tickerRepository struct {
+	db *DB
+}
+
+// NewTickerRepository creates a new ticker repository
+func NewTickerRepository(db *DB) database.TickerRepository {
+	return &tickerRepository{db: db}
+}
+
+// tickerChangeEvent is the outbox payload of a ticker changing sector or
+// being deactivated, as written by package database
+type tickerChangeEvent struct {
+	Symbol string `json:"symbol"`
+	Sector string `json:"sector,omitempty"`
+}
+
+// sectorDeletedEvent is the outbox payload of a sector being deleted,
+// as written by package database
+type sectorDeletedEvent struct {
+	Name string `json:"name"`
+}
+
+// CreateTicker inserts a new active ticker assigned to an existing sector
+func (r *tickerRepository) CreateTicker(ctx context.Context, ticker *models.Ticker) error {
+	ticker.Sanitize()
+	if err := ticker.Validate(); err != nil {
+		return fmt.Errorf("ticker validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO tickers (symbol, name, sector_id, active)
+		SELECT ?, NULLIF(?, ''), s.id, TRUE
+		FROM sectors s
+		WHERE s.name = ?
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, ticker.Symbol, ticker.Name, ticker.Sector).
+			Scan(&ticker.ID, &ticker.CreatedAt, &ticker.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		ticker.Active = true
+		return enqueueOutboxEvent(ctx, tx, database.OutboxReferenceStream, database.EventTickerCreated, ticker)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("sector %q: %w", ticker.Sector, database.ErrNotFound)
+		}
+		if isUniqueViolation(err) {
+			return fmt.Errorf("ticker %q: %w", ticker.Symbol, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to create ticker: %w", err)
+	}
+
+	return nil
+}
+
+// GetTicker retrieves a ticker by symbol, active or not
+func (r *tickerRepository) GetTicker(ctx context.Context, symbol string) (*models.Ticker, error) {
+	query := `
+		SELECT t.id, t.symbol, COALESCE(t.name, ''), COALESCE(s.name, 'unknown'), t.active, t.created_at, t.updated_at
+		FROM tickers t
+		LEFT JOIN sectors s ON s.id = t.sector_id
+		WHERE t.symbol = ?
+	`
+
+	var ticker models.Ticker
+	err := r.db.QueryRowContext(ctx, query, symbol).Scan(&ticker.ID, &ticker.Symbol, &ticker.Name, &ticker.Sector,
+		&ticker.Active, &ticker.CreatedAt, &ticker.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("ticker %q: %w", symbol, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ticker: %w", err)
+	}
+
+	return &ticker, nil
+}
+
+// GetTickers retrieves the ticker reference table, optionally only active tickers
+func (r *tickerRepository) GetTickers(ctx context.Context, activeOnly bool) ([]*models.Ticker, error) {
+	query := `
+		SELECT t.id, t.symbol, COALESCE(t.name, ''), COALESCE(s.name, 'unknown'), t.active, t.created_at, t.updated_at
+		FROM tickers t
+		LEFT JOIN sectors s ON s.id = t.sector_id
+		WHERE ? = FALSE OR t.active
+		ORDER BY t.symbol
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tickers: %w", err)
+	}
+	defer rows.Close()
+
+	var tickers []*models.Ticker
+	for rows.Next() {
+		var ticker models.Ticker
+		if err := rows.Scan(&ticker.ID, &ticker.Symbol, &ticker.Name, &ticker.Sector,
+			&ticker.Active, &ticker.CreatedAt, &ticker.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ticker: %w", err)
+		}
+		tickers = append(tickers, &ticker)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tickers: %w", err)
+	}
+
+	return tickers, nil
+}
+
+// AssignSector moves a ticker to another existing sector
+func (r *tickerRepository) AssignSector(ctx context.Context, symbol, sector string) error {
+	query := `
+		UPDATE tickers SET sector_id = s.id, updated_at = ?
+		FROM sectors s
+		WHERE tickers.symbol = ? AND s.name = ?
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, now(), symbol, sector)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("ticker %q or sector %q: %w", symbol, sector, database.ErrNotFound)
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxReferenceStream, database.EventTickerSectorAssigned, tickerChangeEvent{Symbol: symbol, Sector: sector})
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign sector: %w", err)
+	}
+
+	return nil
+}
+
+// DeactivateTicker marks a ticker inactive so it is no longer normalized
+func (r *tickerRepository) DeactivateTicker(ctx context.Context, symbol string) error {
+	query := `UPDATE tickers SET active = FALSE, updated_at = ? WHERE symbol = ?`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, now(), symbol)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("ticker %q: %w", symbol, database.ErrNotFound)
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxReferenceStream, database.EventTickerDeactivated, tickerChangeEvent{Symbol: symbol})
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to deactivate ticker: %w", err)
+	}
+
+	return nil
+}
+
+// SearchTickers finds active tickers whose symbol or name starts with query
+// or has a word starting with it. Without trigram similarity there are no
+// fuzzy matches, so scores are those of the Postgres prefix matches.
+func (r *tickerRepository) SearchTickers(ctx context.Context, query string, limit int) ([]*database.TickerMatch, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	sqlQuery := `
+		SELECT symbol, name, sector, score FROM (
+			SELECT t.symbol, COALESCE(t.name, '') AS name, COALESCE(s.name, 'unknown') AS sector,
+				CASE
+					WHEN t.symbol = ?1 THEN 1.0
+					WHEN t.symbol LIKE ?2 || '%' ESCAPE '\' THEN 0.9
+					WHEN LOWER(t.name) LIKE ?3 || '%' ESCAPE '\' THEN 0.8
+					ELSE 0.7
+				END AS score
+			FROM tickers t
+			LEFT JOIN sectors s ON s.id = t.sector_id
+			WHERE t.active
+				AND (t.symbol LIKE ?2 || '%' ESCAPE '\'
+					OR LOWER(t.name) LIKE ?3 || '%' ESCAPE '\'
+					OR LOWER(t.name) LIKE '% ' || ?3 || '%' ESCAPE '\')
+		)
+		ORDER BY score DESC, symbol
+		LIMIT ?4
+	`
+
+	pattern := escapeLike(query)
+	rows, err := r.db.QueryContext(ctx, sqlQuery,
+		strings.ToUpper(query),
+		strings.ToUpper(pattern),
+		strings.ToLower(pattern),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search tickers: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []*database.TickerMatch{}
+	for rows.Next() {
+		var match database.TickerMatch
+		if err := rows.Scan(&match.Symbol, &match.Name, &match.Sector, &match.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan ticker match: %w", err)
+		}
+		matches = append(matches, &match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ticker matches: %w", err)
+	}
+
+	return matches, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// sectorRepository implements database.SectorRepository
+type sectorRepository struct {
+	db *DB
+}
+
+// NewSectorRepository creates a new sector repository
+func NewSectorRepository(db *DB) database.SectorRepository {
+	return &sectorRepository{db: db}
+}
+
+// CreateSector inserts a new sector
+func (r *sectorRepository) CreateSector(ctx context.Context, sector *models.Sector) error {
+	sector.Sanitize()
+	if err := sector.Validate(); err != nil {
+		return fmt.Errorf("sector validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO sectors (name, description)
+		VALUES (?, NULLIF(?, ''))
+		RETURNING id, created_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, query, sector.Name, sector.Description).Scan(&sector.ID, &sector.CreatedAt); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxReferenceStream, database.EventSectorCreated, sector)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("sector %q: %w", sector.Name, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to create sector: %w", err)
+	}
+
+	return nil
+}
+
+// GetSector retrieves a sector by name
+func (r *sectorRepository) GetSector(ctx context.Context, name string) (*models.Sector, error) {
+	query := `
+		SELECT id, name, COALESCE(description, ''), created_at
+		FROM sectors
+		WHERE name = ?
+	`
+
+	var sector models.Sector
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&sector.ID, &sector.Name, &sector.Description, &sector.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("sector %q: %w", name, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sector: %w", err)
+	}
+
+	return &sector, nil
+}
+
+// GetSectors retrieves all sectors
+func (r *sectorRepository) GetSectors(ctx context.Context) ([]*models.Sector, error) {
+	query := `
+		SELECT id, name, COALESCE(description, ''), created_at
+		FROM sectors
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sectors: %w", err)
+	}
+	defer rows.Close()
+
+	var sectors []*models.Sector
+	for rows.Next() {
+		var sector models.Sector
+		if err := rows.Scan(&sector.ID, &sector.Name, &sector.Description, &sector.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sector: %w", err)
+		}
+		sectors = append(sectors, &sector)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sectors: %w", err)
+	}
+
+	return sectors, nil
+}
+
+// UpdateSector replaces the description of the sector named sector.Name
+func (r *sectorRepository) UpdateSector(ctx context.Context, sector *models.Sector) error {
+	sector.Sanitize()
+	if err := sector.Validate(); err != nil {
+		return fmt.Errorf("sector validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE sectors SET description = NULLIF(?, '')
+		WHERE name = ?
+		RETURNING id, created_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, query, sector.Description, sector.Name).Scan(&sector.ID, &sector.CreatedAt); err != nil {
+			return err
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxReferenceStream, database.EventSectorUpdated, sector)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("sector %q: %w", sector.Name, database.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update sector: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSector removes a sector. Sectors still assigned to tickers, active or
+// not, are kept and database.ErrConflict is returned.
+func (r *sectorRepository) DeleteSector(ctx context.Context, name string) error {
+	query := `DELETE FROM sectors WHERE name = ?`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, name)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("sector %q: %w", name, database.ErrNotFound)
+		}
+		return enqueueOutboxEvent(ctx, tx, database.OutboxReferenceStream, database.EventSectorDeleted, sectorDeletedEvent{Name: name})
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("sector %q is assigned to tickers: %w", name, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to delete sector: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package sqlite implements the database repositories on SQLite, so the API
+// can run without a Postgres instance for local development and tests. It
+// keeps the repository semantics of package database, including tenant
+// scoping and the outbox, on a reduced schema: quotes are not partitioned,
+// candles are aggregated from quotes on every request, ticker search has no
+// trigram matching and there are no read replicas or per-method metrics.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"go.uber.org/zap"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DB is a SQLite database
+type DB struct {
+	*sql.DB
+	path    string
+	secrets *database.SecretCipher
+}
+
+// Open opens the SQLite database at path, creating it if needed. Writes are
+// serialized by SQLite; transactions take the write lock when they begin so
+// two of them never deadlock upgrading a read lock. The path ":memory:"
+// opens a private in-memory database. Webhook secrets are encrypted with
+// secretKey as database.Config.SecretKey describes.
+func Open(path, secretKey string) (*DB, error) {
+	secrets, err := database.NewSecretCipher(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite&_txlock=immediate"
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	if path == ":memory:" {
+		// Every connection would get its own empty database
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	logger.Log.Info("sqlite database opened", zap.String("path", path))
+	return &DB{DB: sqlDB, path: path, secrets: secrets}, nil
+}
+
+// Close closes the database
+func (db *DB) Close() error {
+	logger.Log.Info("closing sqlite database")
+	return db.DB.Close()
+}
+
+// HealthCheck performs a health check on the database
+func (db *DB) HealthCheck(ctx context.Context) error {
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database health check failed: %w", err)
+	}
+	return nil
+}
+
+// PoolStats returns the statistics of the connection pool
+func (db *DB) PoolStats() database.PoolStats {
+	stats := db.Stats()
+	return database.PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration,
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+// Transaction runs fn in a transaction, committing if it returns nil
+func (db *DB) Transaction(ctx context.Context, fn func(*sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = fn(tx)
+	return err
+}
+
+// now is the current time as it is stored. Times are stored as UTC text so
+// that they compare correctly as strings.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// nullableTime is the query argument for an optional time
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// visibleTenants is the argument for a
+// "tenant_id IN (SELECT value FROM json_each(?))" condition restricting
+// reads to the tenants ctx may see
+func visibleTenants(ctx context.Context) string {
+	return jsonArray(tenant.Visible(ctx))
+}
+
+// jsonArray encodes a string slice as the JSON array it is stored as
+func jsonArray(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// stringArray scans a JSON array column into dst
+func stringArray(dst *[]string) sql.Scanner {
+	return jsonArrayScanner{dst: dst}
+}
+
+type jsonArrayScanner struct {
+	dst *[]string
+}
+
+func (s jsonArrayScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*s.dst = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into a string array", src)
+	}
+	return json.Unmarshal(data, s.dst)
+}
+
+// timeText scans a time computed by an expression, which SQLite returns as
+// text since only columns carry their declared type, into dst
+func timeText(dst *time.Time) sql.Scanner {
+	return timeTextScanner{dst: dst}
+}
+
+type timeTextScanner struct {
+	dst *time.Time
+}
+
+// timeTextLayouts are the formats times are written in: by the driver and by
+// the strftime column defaults
+var timeTextLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+}
+
+func (s timeTextScanner) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s.dst = time.Time{}
+		return nil
+	case time.Time:
+		*s.dst = v
+		return nil
+	case string:
+		for _, layout := range timeTextLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				*s.dst = t
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot parse time %q", v)
+	default:
+		return fmt.Errorf("cannot scan %T into a time", src)
+	}
+}
+
+// isUniqueViolation reports whether err is a SQLite unique or primary key
+// constraint failure
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// isForeignKeyViolation reports whether err is a SQLite foreign key
+// constraint failure
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// placeholders returns n comma-separated "?" placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
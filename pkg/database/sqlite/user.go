@@ -0,0 +1,449 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// userRepository implements database.UserRepository
+type userRepository struct {
+	db *DB
+}
+
+// NewUserRepository creates a new user repository
+func NewUserRepository(db *DB) database.UserRepository {
+	return &userRepository{db: db}
+}
+
+const userColumns = `id, username, COALESCE(email, ''), password_hash,
+	(SELECT json_group_array(role) FROM (SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)),
+	tenant_id, active, created_at, updated_at`
+
+// scanUser scans a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		stringArray(&user.Roles),
+		&user.TenantID,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateUser inserts a new user with its roles. Usernames are unique across
+// tenants and every role must exist.
+func (r *userRepository) CreateUser(ctx context.Context, user *models.User) error {
+	user.Sanitize()
+	if err := user.Validate(); err != nil {
+		return fmt.Errorf("user validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO users (username, email, password_hash, tenant_id, active)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query,
+			user.Username,
+			user.Email,
+			user.PasswordHash,
+			user.TenantID,
+			user.Active,
+		).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return assignRoles(ctx, tx, user.ID, user.Roles)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("user %q: %w", user.Username, database.ErrConflict)
+		}
+		if errors.Is(err, database.ErrUnknownRole) {
+			return err
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// GetUser retrieves a user of the context's tenant, active or not
+func (r *userRepository) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ? AND tenant_id = ?`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user, active or not, by username
+func (r *userRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %q: %w", username, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// CreateRefreshToken stores the hash of a refresh token issued to userID
+func (r *userRepository) CreateRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)`,
+		userID, tokenHash, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken exchanges a live refresh token for newTokenHash and
+// returns the token's user. Unknown and expired tokens, and tokens of
+// inactive users, are reported as ErrNotFound; a token that was already
+// rotated or revoked yields ErrTokenReused. The transaction holds the write
+// lock from its start, so no row lock is needed.
+func (r *userRepository) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (*models.User, error) {
+	var user *models.User
+	reused := false
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		var (
+			id, userID int64
+			expires    time.Time
+			revokedAt  sql.NullTime
+		)
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?`,
+			tokenHash,
+		).Scan(&id, &userID, &expires, &revokedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("refresh token: %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		if revokedAt.Valid {
+			// Commit the family revocation rather than rolling it back
+			reused = true
+			return revokeSessions(ctx, tx, userID)
+		}
+		if time.Now().After(expires) {
+			return fmt.Errorf("refresh token: %w", database.ErrNotFound)
+		}
+
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, userID))
+		if err != nil {
+			return err
+		}
+		if !user.Active {
+			return fmt.Errorf("user %q: %w", user.Username, database.ErrNotFound)
+		}
+
+		var newID int64
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?) RETURNING id`,
+			userID, newTokenHash, expiresAt.UTC(),
+		).Scan(&newID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE refresh_tokens SET revoked_at = ?, replaced_by = ? WHERE id = ?`,
+			now(), newID, id)
+		return err
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if reused {
+		return nil, database.ErrTokenReused
+	}
+
+	return user, nil
+}
+
+// RevokeRefreshToken revokes a live refresh token
+func (r *userRepository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL`,
+		now(), tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("refresh token: %w", database.ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListUsers retrieves every user of the context's tenant
+func (r *userRepository) ListUsers(ctx context.Context) ([]*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE tenant_id = ? ORDER BY username`
+
+	rows, err := r.db.QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+
+	return users, nil
+}
+
+// SetUserActive enables or disables a user of the context's tenant.
+// Disabling also revokes the user's refresh tokens, ending their sessions.
+func (r *userRepository) SetUserActive(ctx context.Context, id int64, active bool) (*models.User, error) {
+	var user *models.User
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := updateUser(ctx, tx, id, `active = ?`, active); err != nil {
+			return err
+		}
+		if !active {
+			if err := revokeSessions(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+		return err
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set user active: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetUserRoles replaces the roles of a user of the context's tenant. Every
+// role must exist. Access tokens already issued keep their permissions until
+// they expire.
+func (r *userRepository) SetUserRoles(ctx context.Context, id int64, roles []string) (*models.User, error) {
+	var user *models.User
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		// Touch the row to check the tenant and bump updated_at
+		if err := updateUser(ctx, tx, id, ``); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+		if err := assignRoles(ctx, tx, id, roles); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+		return err
+	})
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrUnknownRole) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set user roles: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetUserPassword replaces the password hash of a user of the context's
+// tenant and revokes the user's refresh tokens
+func (r *userRepository) SetUserPassword(ctx context.Context, id int64, passwordHash string) error {
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := updateUser(ctx, tx, id, `password_hash = ?`, passwordHash); err != nil {
+			return err
+		}
+		return revokeSessions(ctx, tx, id)
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set user password: %w", err)
+	}
+
+	return nil
+}
+
+// ListSessions retrieves the live sessions of a user of the context's
+// tenant, i.e. its unrevoked and unexpired refresh tokens
+func (r *userRepository) ListSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	query := `
+		SELECT t.id, t.user_id, t.created_at, t.expires_at
+		FROM refresh_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = ? AND u.tenant_id = ? AND t.revoked_at IS NULL AND t.expires_at > ?
+		ORDER BY t.created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, tenant.FromContext(ctx), now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// ListRoles retrieves every role that can be assigned
+func (r *userRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name, COALESCE(description, ''), created_at FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, &role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// CreateRole inserts a new assignable role
+func (r *userRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	role.Sanitize()
+	if err := role.Validate(); err != nil {
+		return fmt.Errorf("role validation failed: %w", err)
+	}
+
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO roles (name, description) VALUES (?, NULLIF(?, '')) RETURNING created_at`,
+		role.Name, role.Description,
+	).Scan(&role.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("role %q: %w", role.Name, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	return nil
+}
+
+// updateUser applies set, whose placeholders take args, to a user of the
+// context's tenant and bumps its updated_at. An empty set only bumps
+// updated_at.
+func updateUser(ctx context.Context, tx *sql.Tx, id int64, set string, args ...interface{}) error {
+	if set != "" {
+		set += ", "
+	}
+	args = append(args, now(), id, tenant.FromContext(ctx))
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET `+set+`updated_at = ? WHERE id = ? AND tenant_id = ?`,
+		args...)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("user %d: %w", id, database.ErrNotFound)
+	}
+	return nil
+}
+
+// assignRoles grants roles to a user, failing with ErrUnknownRole if any is
+// missing from the roles table
+func assignRoles(ctx context.Context, tx *sql.Tx, userID int64, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	var unknown []string
+	err := tx.QueryRowContext(ctx,
+		`SELECT json_group_array(value) FROM json_each(?) WHERE value NOT IN (SELECT name FROM roles)`,
+		jsonArray(roles),
+	).Scan(stringArray(&unknown))
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %v", database.ErrUnknownRole, unknown)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO user_roles (user_id, role) SELECT ?, value FROM json_each(?)`,
+		userID, jsonArray(roles))
+	return err
+}
+
+// revokeSessions revokes every live refresh token of a user
+func revokeSessions(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		now(), userID)
+	return err
+}
@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// watchlistRepository implements database.WatchlistRepository
+type watchlistRepository struct {
+	db *DB
+}
+
+// NewWatchlistRepository creates a new watchlist repository
+func NewWatchlistRepository(db *DB) database.WatchlistRepository {
+	return &watchlistRepository{db: db}
+}
+
+const watchlistColumns = `id, owner_id, tenant_id, name, tickers, created_at, updated_at`
+
+// scanWatchlist scans a row selected with watchlistColumns
+func scanWatchlist(row interface{ Scan(...interface{}) error }) (*models.Watchlist, error) {
+	var watchlist models.Watchlist
+	err := row.Scan(
+		&watchlist.ID,
+		&watchlist.OwnerID,
+		&watchlist.TenantID,
+		&watchlist.Name,
+		stringArray(&watchlist.Tickers),
+		&watchlist.CreatedAt,
+		&watchlist.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &watchlist, nil
+}
+
+// CreateWatchlist inserts a new watchlist for the context's tenant. Names are unique per owner.
+func (r *watchlistRepository) CreateWatchlist(ctx context.Context, watchlist *models.Watchlist) error {
+	watchlist.Sanitize()
+	if err := watchlist.Validate(); err != nil {
+		return fmt.Errorf("watchlist validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO watchlists (owner_id, tenant_id, name, tickers)
+		VALUES (?, ?, ?, ?)
+		RETURNING id, created_at, updated_at
+	`
+
+	watchlist.TenantID = tenant.FromContext(ctx)
+	err := r.db.QueryRowContext(ctx, query,
+		watchlist.OwnerID,
+		watchlist.TenantID,
+		watchlist.Name,
+		jsonArray(watchlist.Tickers),
+	).Scan(&watchlist.ID, &watchlist.CreatedAt, &watchlist.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("watchlist %q: %w", watchlist.Name, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to create watchlist: %w", err)
+	}
+
+	return nil
+}
+
+// GetWatchlist retrieves a single watchlist owned by ownerID
+func (r *watchlistRepository) GetWatchlist(ctx context.Context, ownerID string, id int64) (*models.Watchlist, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE id = ? AND owner_id = ? AND tenant_id = ?`
+
+	watchlist, err := scanWatchlist(r.db.QueryRowContext(ctx, query, id, ownerID, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("watchlist %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watchlist: %w", err)
+	}
+
+	return watchlist, nil
+}
+
+// GetWatchlistsByOwner retrieves all watchlists of ownerID
+func (r *watchlistRepository) GetWatchlistsByOwner(ctx context.Context, ownerID string) ([]*models.Watchlist, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE owner_id = ? AND tenant_id = ? ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watchlists: %w", err)
+	}
+	defer rows.Close()
+
+	watchlists := []*models.Watchlist{}
+	for rows.Next() {
+		watchlist, err := scanWatchlist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan watchlist: %w", err)
+		}
+		watchlists = append(watchlists, watchlist)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating watchlists: %w", err)
+	}
+
+	return watchlists, nil
+}
+
+// UpdateWatchlist replaces the name and tickers of a watchlist owned by watchlist.OwnerID
+func (r *watchlistRepository) UpdateWatchlist(ctx context.Context, watchlist *models.Watchlist) error {
+	watchlist.Sanitize()
+	if err := watchlist.Validate(); err != nil {
+		return fmt.Errorf("watchlist validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE watchlists
+		SET name = ?, tickers = ?, updated_at = ?
+		WHERE id = ? AND owner_id = ? AND tenant_id = ?
+		RETURNING ` + watchlistColumns
+
+	updated, err := scanWatchlist(r.db.QueryRowContext(ctx, query,
+		watchlist.Name,
+		jsonArray(watchlist.Tickers),
+		now(),
+		watchlist.ID,
+		watchlist.OwnerID,
+		tenant.FromContext(ctx),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("watchlist %d: %w", watchlist.ID, database.ErrNotFound)
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("watchlist %q: %w", watchlist.Name, database.ErrConflict)
+		}
+		return fmt.Errorf("failed to update watchlist: %w", err)
+	}
+
+	*watchlist = *updated
+	return nil
+}
+
+// DeleteWatchlist removes a watchlist owned by ownerID
+func (r *watchlistRepository) DeleteWatchlist(ctx context.Context, ownerID string, id int64) error {
+	query := `DELETE FROM watchlists WHERE id = ? AND owner_id = ? AND tenant_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to delete watchlist: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("watchlist %d: %w", id, database.ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/alim08/fin_line/pkg/database"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// webhookRepository implements database.WebhookRepository
+type webhookRepository struct {
+	db *DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *DB) database.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+const webhookColumns = `id, owner_id, tenant_id, url, secret, tickers, severities, active, created_at, updated_at`
+
+// scanWebhook scans a row selected with webhookColumns, decrypting its secret
+func (r *webhookRepository) scanWebhook(row interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.OwnerID,
+		&webhook.TenantID,
+		&webhook.URL,
+		&webhook.Secret,
+		stringArray(&webhook.Tickers),
+		stringArray(&webhook.Severities),
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.Secret, err = r.db.secrets.Open(webhook.Secret); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// CreateWebhook inserts a new webhook subscription for the context's tenant
+func (r *webhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.Sanitize()
+	if err := webhook.Validate(); err != nil {
+		return fmt.Errorf("webhook validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (owner_id, tenant_id, url, secret, tickers, severities, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at, updated_at
+	`
+
+	secret, err := r.db.secrets.Seal(webhook.Secret)
+	if err != nil {
+		return err
+	}
+
+	webhook.TenantID = tenant.FromContext(ctx)
+	err = r.db.QueryRowContext(ctx, query,
+		webhook.OwnerID,
+		webhook.TenantID,
+		webhook.URL,
+		secret,
+		jsonArray(webhook.Tickers),
+		jsonArray(webhook.Severities),
+		webhook.Active,
+	).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return nil
+}
+
+// GetWebhook retrieves a single webhook owned by ownerID
+func (r *webhookRepository) GetWebhook(ctx context.Context, ownerID string, id int64) (*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE id = ? AND owner_id = ? AND tenant_id = ?`
+
+	webhook, err := r.scanWebhook(r.db.QueryRowContext(ctx, query, id, ownerID, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("webhook %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// GetWebhooksByOwner retrieves all webhooks registered by ownerID
+func (r *webhookRepository) GetWebhooksByOwner(ctx context.Context, ownerID string) ([]*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE owner_id = ? AND tenant_id = ? ORDER BY id`
+
+	webhooks, err := r.queryWebhooks(ctx, query, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetActiveWebhooks retrieves every active webhook of all tenants for the alert dispatcher
+func (r *webhookRepository) GetActiveWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE active = TRUE ORDER BY id`
+
+	webhooks, err := r.queryWebhooks(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the URL, filters and active flag of a webhook owned by webhook.OwnerID
+func (r *webhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.Sanitize()
+	if err := webhook.Validate(); err != nil {
+		return fmt.Errorf("webhook validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = ?, tickers = ?, severities = ?, active = ?, updated_at = ?
+		WHERE id = ? AND owner_id = ? AND tenant_id = ?
+		RETURNING ` + webhookColumns
+
+	updated, err := r.scanWebhook(r.db.QueryRowContext(ctx, query,
+		webhook.URL,
+		jsonArray(webhook.Tickers),
+		jsonArray(webhook.Severities),
+		webhook.Active,
+		now(),
+		webhook.ID,
+		webhook.OwnerID,
+		tenant.FromContext(ctx),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("webhook %d: %w", webhook.ID, database.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	*webhook = *updated
+	return nil
+}
+
+// DeleteWebhook removes a webhook owned by ownerID
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, ownerID string, id int64) error {
+	query := `DELETE FROM webhook_subscriptions WHERE id = ? AND owner_id = ? AND tenant_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("webhook %d: %w", id, database.ErrNotFound)
+	}
+
+	return nil
+}
+
+// queryWebhooks runs a query selecting webhookColumns and collects the rows
+func (r *webhookRepository) queryWebhooks(ctx context.Context, query string, args ...interface{}) ([]*models.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		webhook, err := r.scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
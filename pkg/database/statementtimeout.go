@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// defaultStatementTimeouts exempts the archival service's bulk exports and
+// deletes, which run as long as the expired rows take
+var defaultStatementTimeouts = map[string]time.Duration{
+	"retentionRepository.ExportAndPrune": 0,
+	"retentionRepository.Prune":          0,
+}
+
+// parseStatementTimeouts parses per-method statement timeouts such as
+// "quoteRepository.GetCandles=30s,quoteRepository.GetQuoteStats=20s" on top
+// of defaultStatementTimeouts. Malformed entries are ignored.
+func parseStatementTimeouts(s string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration, len(defaultStatementTimeouts))
+	for method, timeout := range defaultStatementTimeouts {
+		timeouts[method] = timeout
+	}
+	for _, entry := range strings.Split(s, ",") {
+		method, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		if timeout, err := time.ParseDuration(strings.TrimSpace(value)); err == nil && timeout >= 0 {
+			timeouts[strings.TrimSpace(method)] = timeout
+		}
+	}
+	return timeouts
+}
+
+// statementTimeout returns the limit on each statement run by method, as
+// named by callerMethod. Only repository methods are limited; migrations and
+// partition and candle view maintenance are not.
+func (c *Config) statementTimeout(method string) time.Duration {
+	receiver, _, ok := strings.Cut(method, ".")
+	if !ok || !strings.HasSuffix(receiver, "Repository") {
+		return 0
+	}
+	if timeout, ok := c.StatementTimeouts[method]; ok {
+		return timeout
+	}
+	return c.StatementTimeout
+}
+
+// localStatementTimeout returns the SET LOCAL statement applying the
+// calling repository method's statement timeout to the current transaction,
+// or "" if the method is not limited. A timeout enforced by the server
+// cancels the statement but keeps its connection.
+func (db *DB) localStatementTimeout() string {
+	timeout := db.config.statementTimeout(callerMethod())
+	if timeout <= 0 {
+		return ""
+	}
+	ms := timeout.Milliseconds()
+	if ms == 0 {
+		// statement_timeout = 0 would disable the limit
+		ms = 1
+	}
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)
+}
+
+// IsStatementTimeout reports whether err is a statement cancelled by its
+// statement timeout
+func IsStatementTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "57014"
+}
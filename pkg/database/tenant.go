@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alim08/fin_line/pkg/logger"
+	"github.com/alim08/fin_line/pkg/tenant"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Tenancy modes, selecting where a tenant's rows are stored
+const (
+	// TenancyColumn keeps every tenant's rows in the public schema, told
+	// apart by their tenant_id column
+	TenancyColumn = "column"
+	// TenancySchema additionally moves the watchlists and webhook
+	// subscriptions of each tenant in Config.Tenants into a schema of its
+	// own. Market data, which tenants share with Default, and users, API
+	// keys and the other tables looked up across tenants stay in public.
+	TenancySchema = "schema"
+)
+
+// TenantSchema returns the name of the schema holding the tables of tenant
+// id in TenancySchema mode
+func TenantSchema(id string) string {
+	return "tenant_" + id
+}
+
+// parseTenants parses a comma-separated list of tenant IDs
+func parseTenants(s string) []string {
+	var tenants []string
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			tenants = append(tenants, id)
+		}
+	}
+	return tenants
+}
+
+// validateTenancy checks the tenancy mode and the tenants given a schema
+func (c *Config) validateTenancy() error {
+	switch c.TenancyMode {
+	case TenancyColumn:
+		return nil
+	case TenancySchema:
+	default:
+		return fmt.Errorf("invalid DB_TENANCY_MODE %q, want %q or %q", c.TenancyMode, TenancyColumn, TenancySchema)
+	}
+
+	for _, id := range c.Tenants {
+		if err := tenant.Validate(id); err != nil {
+			return fmt.Errorf("DB_TENANT_SCHEMAS: %w", err)
+		}
+		if id == tenant.Default {
+			return fmt.Errorf("DB_TENANT_SCHEMAS: tenant %q is stored in public", tenant.Default)
+		}
+	}
+	return nil
+}
+
+// schemaTenants returns the tenants with a schema of their own
+func (db *DB) schemaTenants() []string {
+	if db.config.TenancyMode != TenancySchema {
+		return nil
+	}
+	return db.config.Tenants
+}
+
+// tenantSchema returns the schema of ctx's tenant, if it has one of its own
+func (db *DB) tenantSchema(ctx context.Context) (string, bool) {
+	id := tenant.FromContext(ctx)
+	for _, schemaTenant := range db.schemaTenants() {
+		if schemaTenant == id {
+			return TenantSchema(id), true
+		}
+	}
+	return "", false
+}
+
+// MigrationTenants returns the tenants whose schemas are migrated: Default,
+// whose tables are in public, then every tenant with a schema of its own
+func (db *DB) MigrationTenants() []string {
+	return append([]string{tenant.Default}, db.schemaTenants()...)
+}
+
+// forEachTenantSchema calls fn with ctx scoped to Default and then to each
+// tenant with a schema of its own, for reads spanning every tenant's tables
+func (db *DB) forEachTenantSchema(ctx context.Context, fn func(ctx context.Context) error) error {
+	for _, id := range db.MigrationTenants() {
+		if err := fn(tenant.WithTenant(ctx, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaRouter points the search_path of each connection at the schema of
+// the tenant it is acquired for, falling back to public for the tables a
+// tenant schema does not hold. Tenants without a schema use public alone.
+type schemaRouter struct {
+	paths map[string]string
+	// current is the search_path each pooled connection was last set to
+	current sync.Map
+}
+
+// newSchemaRouter returns the router for TenancySchema mode, or nil
+func newSchemaRouter(config *Config) *schemaRouter {
+	if config.TenancyMode != TenancySchema {
+		return nil
+	}
+
+	r := &schemaRouter{paths: make(map[string]string, len(config.Tenants))}
+	for _, id := range config.Tenants {
+		r.paths[id] = pgx.Identifier{TenantSchema(id)}.Sanitize() + ", public"
+	}
+	return r
+}
+
+// beforeAcquire sets conn's search_path for the tenant of ctx. A connection
+// whose search_path cannot be set is discarded.
+func (r *schemaRouter) beforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	path, ok := r.paths[tenant.FromContext(ctx)]
+	if !ok {
+		path = "public"
+	}
+	if current, ok := r.current.Load(conn); ok && current.(string) == path {
+		return true
+	}
+
+	if _, err := conn.Exec(ctx, `SELECT set_config('search_path', $1, false)`, path); err != nil {
+		logger.Log.Warn("failed to set search_path, discarding connection", zap.Error(err))
+		r.current.Delete(conn)
+		return false
+	}
+	r.current.Store(conn, path)
+	return true
+}
+
+// beforeClose forgets a connection leaving the pool
+func (r *schemaRouter) beforeClose(conn *pgx.Conn) {
+	r.current.Delete(conn)
+}
+
+// visibleTenants is the argument for a "tenant_id = ANY($n)" condition
+// restricting reads to the tenants ctx may see
+func visibleTenants(ctx context.Context) interface{} {
+	return tenant.Visible(ctx)
+}
+
+// addTenant restricts the query to the tenants ctx may see
+func (b *whereBuilder) addTenant(ctx context.Context) {
+	b.add("tenant_id = ANY($%d)", visibleTenants(ctx))
+}
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS update_webhook_subscriptions_updated_at ON webhook_subscriptions;
+DROP TRIGGER IF EXISTS update_watchlists_updated_at ON watchlists;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS watchlists;
@@ -0,0 +1,38 @@
+-- Create the tables a tenant schema holds
+
+-- A tenant with a schema of its own keeps its watchlists and webhook
+-- subscriptions here; everything else stays in public. The tables match
+-- their public counterparts so the same queries run against either.
+CREATE TABLE IF NOT EXISTS watchlists (
+	id BIGSERIAL PRIMARY KEY,
+	owner_id VARCHAR(100) NOT NULL,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	name VARCHAR(100) NOT NULL,
+	tickers TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE (tenant_id, owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id BIGSERIAL PRIMARY KEY,
+	owner_id VARCHAR(100) NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	tickers TEXT[] NOT NULL DEFAULT '{}',
+	severities TEXT[] NOT NULL DEFAULT '{}',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_tenant_owner ON webhook_subscriptions(tenant_id, owner_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_active ON webhook_subscriptions(active);
+
+-- update_updated_at_column is the function migration 1 created in public
+CREATE TRIGGER update_watchlists_updated_at BEFORE UPDATE ON watchlists
+	FOR EACH ROW EXECUTE FUNCTION public.update_updated_at_column();
+
+CREATE TRIGGER update_webhook_subscriptions_updated_at BEFORE UPDATE ON webhook_subscriptions
+	FOR EACH ROW EXECUTE FUNCTION public.update_updated_at_column();
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+func TestValidateTenancy(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		ok     bool
+	}{
+		{Config{TenancyMode: TenancyColumn}, true},
+		{Config{TenancyMode: TenancySchema, Tenants: []string{"acme", "globex"}}, true},
+		{Config{TenancyMode: TenancySchema, Tenants: []string{tenant.Default}}, false},
+		{Config{TenancyMode: TenancySchema, Tenants: []string{"Acme Corp"}}, false},
+		{Config{TenancyMode: "database"}, false},
+	} {
+		if err := tc.config.validateTenancy(); (err == nil) != tc.ok {
+			t.Errorf("validateTenancy(%s %v) = %v; want ok %v", tc.config.TenancyMode, tc.config.Tenants, err, tc.ok)
+		}
+	}
+}
+
+func TestTenantSchema_OnlyForSchemaTenants(t *testing.T) {
+	db := &DB{config: &Config{TenancyMode: TenancySchema, Tenants: []string{"acme"}}}
+
+	if schema, ok := db.tenantSchema(tenant.WithTenant(context.Background(), "acme")); !ok || schema != "tenant_acme" {
+		t.Errorf("tenantSchema(acme) = %q, %v; want tenant_acme", schema, ok)
+	}
+	if schema, ok := db.tenantSchema(tenant.WithTenant(context.Background(), "globex")); ok {
+		t.Errorf("tenantSchema(globex) = %q; want none", schema)
+	}
+
+	column := &DB{config: &Config{TenancyMode: TenancyColumn, Tenants: []string{"acme"}}}
+	if schema, ok := column.tenantSchema(tenant.WithTenant(context.Background(), "acme")); ok {
+		t.Errorf("tenantSchema in column mode = %q; want none", schema)
+	}
+}
@@ -0,0 +1,577 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+var (
+	// ErrTokenReused is returned when an already rotated refresh token is
+	// presented again. Every refresh token of its user is revoked in response,
+	// since the token has most likely been stolen.
+	ErrTokenReused = errors.New("refresh token reused")
+	// ErrUnknownRole is returned when assigning a role missing from the roles table
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// UserRepository defines the interface for user account, role and refresh token access
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id int64) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	SetUserActive(ctx context.Context, id int64, active bool) (*models.User, error)
+	SetUserRoles(ctx context.Context, id int64, roles []string) (*models.User, error)
+	SetUserPassword(ctx context.Context, id int64, passwordHash string) error
+	ListSessions(ctx context.Context, userID int64) ([]*models.Session, error)
+	ListRoles(ctx context.Context) ([]*models.Role, error)
+	CreateRole(ctx context.Context, role *models.Role) error
+	CreateRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (*models.User, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+}
+
+// userRepository implements UserRepository
+type userRepository struct {
+	db *DB
+}
+
+// NewUserRepository creates a new user repository
+func NewUserRepository(db *DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+const userColumns = `id, username, COALESCE(email, ''), password_hash,
+	ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role),
+	tenant_id, active, created_at, updated_at`
+
+// scanUser scans a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		stringArray(&user.Roles),
+		&user.TenantID,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateUser inserts a new user with its roles. Usernames are unique across
+// tenants and every role must exist.
+func (r *userRepository) CreateUser(ctx context.Context, user *models.User) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_user", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	user.Sanitize()
+	if err := user.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_user", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("user validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO users (username, email, password_hash, tenant_id, active)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query,
+			user.Username,
+			user.Email,
+			user.PasswordHash,
+			user.TenantID,
+			user.Active,
+		).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return assignRoles(ctx, tx, user.ID, user.Roles)
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_user", "error").Observe(time.Since(start).Seconds())
+		if isUniqueViolation(err) {
+			return fmt.Errorf("user %q: %w", user.Username, ErrConflict)
+		}
+		if errors.Is(err, ErrUnknownRole) {
+			return err
+		}
+		metrics.DatabaseErrors.WithLabelValues("create_user").Inc()
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_user", "success").Inc()
+	return nil
+}
+
+// GetUser retrieves a user of the context's tenant, active or not
+func (r *userRepository) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_user_by_id", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND tenant_id = $2`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_user_by_id", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_user_by_id").Inc()
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_user_by_id", "success").Inc()
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user, active or not, by username
+func (r *userRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_user", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %q: %w", username, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_user", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_user").Inc()
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_user", "success").Inc()
+	return user, nil
+}
+
+// CreateRefreshToken stores the hash of a refresh token issued to userID
+func (r *userRepository) CreateRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_refresh_token", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`,
+		userID, tokenHash, expiresAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_refresh_token", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("create_refresh_token").Inc()
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_refresh_token", "success").Inc()
+	return nil
+}
+
+// RotateRefreshToken exchanges a live refresh token for newTokenHash and
+// returns the token's user. Unknown and expired tokens, and tokens of
+// inactive users, are reported as ErrNotFound; a token that was already
+// rotated or revoked yields ErrTokenReused.
+func (r *userRepository) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("rotate_refresh_token", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	var user *models.User
+	reused := false
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		var (
+			id, userID int64
+			expires    time.Time
+			revokedAt  sql.NullTime
+		)
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`,
+			tokenHash,
+		).Scan(&id, &userID, &expires, &revokedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("refresh token: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		if revokedAt.Valid {
+			// Commit the family revocation rather than rolling it back
+			reused = true
+			_, err := tx.ExecContext(ctx,
+				`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+				userID)
+			return err
+		}
+		if time.Now().After(expires) {
+			return fmt.Errorf("refresh token: %w", ErrNotFound)
+		}
+
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, userID))
+		if err != nil {
+			return err
+		}
+		if !user.Active {
+			return fmt.Errorf("user %q: %w", user.Username, ErrNotFound)
+		}
+
+		var newID int64
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id`,
+			userID, newTokenHash, expiresAt,
+		).Scan(&newID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $2 WHERE id = $1`,
+			id, newID)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("rotate_refresh_token", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("rotate_refresh_token").Inc()
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if reused {
+		return nil, ErrTokenReused
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("rotate_refresh_token", "success").Inc()
+	return user, nil
+}
+
+// RevokeRefreshToken revokes a live refresh token
+func (r *userRepository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("revoke_refresh_token", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL`,
+		tokenHash)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("revoke_refresh_token", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("revoke_refresh_token").Inc()
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("refresh token: %w", ErrNotFound)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("revoke_refresh_token", "success").Inc()
+	return nil
+}
+
+// ListUsers retrieves every user of the context's tenant
+func (r *userRepository) ListUsers(ctx context.Context) ([]*models.User, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_users", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE tenant_id = $1 ORDER BY username`
+
+	rows, err := r.db.QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_users", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_users").Inc()
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_users", "success").Inc()
+	return users, nil
+}
+
+// SetUserActive enables or disables a user of the context's tenant.
+// Disabling also revokes the user's refresh tokens, ending their sessions.
+func (r *userRepository) SetUserActive(ctx context.Context, id int64, active bool) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("set_user_active", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	var user *models.User
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := updateUser(ctx, tx, id, `active = $3`, active); err != nil {
+			return err
+		}
+		if !active {
+			if err := revokeSessions(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("set_user_active", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("set_user_active").Inc()
+		return nil, fmt.Errorf("failed to set user active: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("set_user_active", "success").Inc()
+	return user, nil
+}
+
+// SetUserRoles replaces the roles of a user of the context's tenant. Every
+// role must exist. Access tokens already issued keep their permissions until
+// they expire.
+func (r *userRepository) SetUserRoles(ctx context.Context, id int64, roles []string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("set_user_roles", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	var user *models.User
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		// Touch the row to check the tenant and bump updated_at
+		if err := updateUser(ctx, tx, id, `updated_at = NOW()`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+		if err := assignRoles(ctx, tx, id, roles); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+		return err
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnknownRole) {
+		return nil, err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("set_user_roles", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("set_user_roles").Inc()
+		return nil, fmt.Errorf("failed to set user roles: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("set_user_roles", "success").Inc()
+	return user, nil
+}
+
+// SetUserPassword replaces the password hash of a user of the context's
+// tenant and revokes the user's refresh tokens
+func (r *userRepository) SetUserPassword(ctx context.Context, id int64, passwordHash string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("set_user_password", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	err := r.db.Transaction(ctx, func(tx *sql.Tx) error {
+		if err := updateUser(ctx, tx, id, `password_hash = $3`, passwordHash); err != nil {
+			return err
+		}
+		return revokeSessions(ctx, tx, id)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("set_user_password", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("set_user_password").Inc()
+		return fmt.Errorf("failed to set user password: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("set_user_password", "success").Inc()
+	return nil
+}
+
+// ListSessions retrieves the live sessions of a user of the context's
+// tenant, i.e. its unrevoked and unexpired refresh tokens
+func (r *userRepository) ListSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_sessions", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `
+		SELECT t.id, t.user_id, t.created_at, t.expires_at
+		FROM refresh_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = $1 AND u.tenant_id = $2 AND t.revoked_at IS NULL AND t.expires_at > NOW()
+		ORDER BY t.created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_sessions", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_sessions").Inc()
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_sessions", "success").Inc()
+	return sessions, nil
+}
+
+// ListRoles retrieves every role that can be assigned
+func (r *userRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_roles", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT name, COALESCE(description, ''), created_at FROM roles ORDER BY name`)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("list_roles", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("list_roles").Inc()
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, &role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating roles: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("list_roles", "success").Inc()
+	return roles, nil
+}
+
+// CreateRole inserts a new assignable role
+func (r *userRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_role", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	role.Sanitize()
+	if err := role.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_role", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("role validation failed: %w", err)
+	}
+
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO roles (name, description) VALUES ($1, NULLIF($2, '')) RETURNING created_at`,
+		role.Name, role.Description,
+	).Scan(&role.CreatedAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_role", "error").Observe(time.Since(start).Seconds())
+		if isUniqueViolation(err) {
+			return fmt.Errorf("role %q: %w", role.Name, ErrConflict)
+		}
+		metrics.DatabaseErrors.WithLabelValues("create_role").Inc()
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_role", "success").Inc()
+	return nil
+}
+
+// updateUser applies set to a user of the context's tenant; set refers to
+// args as $3 onwards
+func updateUser(ctx context.Context, tx *sql.Tx, id int64, set string, args ...interface{}) error {
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET `+set+` WHERE id = $1 AND tenant_id = $2`,
+		append([]interface{}{id, tenant.FromContext(ctx)}, args...)...)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// assignRoles grants roles to a user, failing with ErrUnknownRole if any is
+// missing from the roles table
+func assignRoles(ctx context.Context, tx *sql.Tx, userID int64, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	var unknown []string
+	err := tx.QueryRowContext(ctx,
+		`SELECT ARRAY(SELECT r FROM unnest($1::text[]) r WHERE r NOT IN (SELECT name FROM roles))`,
+		roles,
+	).Scan(stringArray(&unknown))
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %v", ErrUnknownRole, unknown)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_roles (user_id, role) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`,
+		userID, roles)
+	return err
+}
+
+// revokeSessions revokes every live refresh token of a user
+func revokeSessions(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID)
+	return err
+}
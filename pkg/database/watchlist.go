@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// WatchlistRepository defines the interface for user watchlist access
+type WatchlistRepository interface {
+	CreateWatchlist(ctx context.Context, watchlist *models.Watchlist) error
+	GetWatchlist(ctx context.Context, ownerID string, id int64) (*models.Watchlist, error)
+	GetWatchlistsByOwner(ctx context.Context, ownerID string) ([]*models.Watchlist, error)
+	UpdateWatchlist(ctx context.Context, watchlist *models.Watchlist) error
+	DeleteWatchlist(ctx context.Context, ownerID string, id int64) error
+}
+
+// watchlistRepository implements WatchlistRepository
+type watchlistRepository struct {
+	db *DB
+}
+
+// NewWatchlistRepository creates a new watchlist repository
+func NewWatchlistRepository(db *DB) WatchlistRepository {
+	return &watchlistRepository{db: db}
+}
+
+const watchlistColumns = `id, owner_id, tenant_id, name, tickers, created_at, updated_at`
+
+// scanWatchlist scans a row selected with watchlistColumns
+func scanWatchlist(row interface{ Scan(...interface{}) error }) (*models.Watchlist, error) {
+	var watchlist models.Watchlist
+	err := row.Scan(
+		&watchlist.ID,
+		&watchlist.OwnerID,
+		&watchlist.TenantID,
+		&watchlist.Name,
+		stringArray(&watchlist.Tickers),
+		&watchlist.CreatedAt,
+		&watchlist.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &watchlist, nil
+}
+
+// CreateWatchlist inserts a new watchlist for the context's tenant. Names are unique per owner.
+func (r *watchlistRepository) CreateWatchlist(ctx context.Context, watchlist *models.Watchlist) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_watchlist", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	watchlist.Sanitize()
+	if err := watchlist.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_watchlist", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("watchlist validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO watchlists (owner_id, tenant_id, name, tickers)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+
+	watchlist.TenantID = tenant.FromContext(ctx)
+	err := r.db.QueryRowContext(ctx, query,
+		watchlist.OwnerID,
+		watchlist.TenantID,
+		watchlist.Name,
+		watchlist.Tickers,
+	).Scan(&watchlist.ID, &watchlist.CreatedAt, &watchlist.UpdatedAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_watchlist", "error").Observe(time.Since(start).Seconds())
+		if isUniqueViolation(err) {
+			return fmt.Errorf("watchlist %q: %w", watchlist.Name, ErrConflict)
+		}
+		metrics.DatabaseErrors.WithLabelValues("create_watchlist").Inc()
+		return fmt.Errorf("failed to create watchlist: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_watchlist", "success").Inc()
+	return nil
+}
+
+// GetWatchlist retrieves a single watchlist owned by ownerID
+func (r *watchlistRepository) GetWatchlist(ctx context.Context, ownerID string, id int64) (*models.Watchlist, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_watchlist", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE id = $1 AND owner_id = $2 AND tenant_id = $3`
+
+	watchlist, err := scanWatchlist(r.db.QueryRowContext(ctx, query, id, ownerID, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("watchlist %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_watchlist", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_watchlist").Inc()
+		return nil, fmt.Errorf("failed to get watchlist: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_watchlist", "success").Inc()
+	return watchlist, nil
+}
+
+// GetWatchlistsByOwner retrieves all watchlists of ownerID
+func (r *watchlistRepository) GetWatchlistsByOwner(ctx context.Context, ownerID string) ([]*models.Watchlist, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_watchlists_by_owner", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE owner_id = $1 AND tenant_id = $2 ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_watchlists_by_owner", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_watchlists_by_owner").Inc()
+		return nil, fmt.Errorf("failed to get watchlists: %w", err)
+	}
+	defer rows.Close()
+
+	watchlists := []*models.Watchlist{}
+	for rows.Next() {
+		watchlist, err := scanWatchlist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan watchlist: %w", err)
+		}
+		watchlists = append(watchlists, watchlist)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating watchlists: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_watchlists_by_owner", "success").Inc()
+	return watchlists, nil
+}
+
+// UpdateWatchlist replaces the name and tickers of a watchlist owned by watchlist.OwnerID
+func (r *watchlistRepository) UpdateWatchlist(ctx context.Context, watchlist *models.Watchlist) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_watchlist", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	watchlist.Sanitize()
+	if err := watchlist.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_watchlist", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("watchlist validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE watchlists
+		SET name = $4, tickers = $5
+		WHERE id = $1 AND owner_id = $2 AND tenant_id = $3
+		RETURNING ` + watchlistColumns
+
+	updated, err := scanWatchlist(r.db.QueryRowContext(ctx, query,
+		watchlist.ID,
+		watchlist.OwnerID,
+		tenant.FromContext(ctx),
+		watchlist.Name,
+		watchlist.Tickers,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("watchlist %d: %w", watchlist.ID, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_watchlist", "error").Observe(time.Since(start).Seconds())
+		if isUniqueViolation(err) {
+			return fmt.Errorf("watchlist %q: %w", watchlist.Name, ErrConflict)
+		}
+		metrics.DatabaseErrors.WithLabelValues("update_watchlist").Inc()
+		return fmt.Errorf("failed to update watchlist: %w", err)
+	}
+
+	*watchlist = *updated
+	metrics.DatabaseOperations.WithLabelValues("update_watchlist", "success").Inc()
+	return nil
+}
+
+// DeleteWatchlist removes a watchlist owned by ownerID
+func (r *watchlistRepository) DeleteWatchlist(ctx context.Context, ownerID string, id int64) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_watchlist", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `DELETE FROM watchlists WHERE id = $1 AND owner_id = $2 AND tenant_id = $3`
+
+	result, err := r.db.ExecContext(ctx, query, id, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_watchlist", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("delete_watchlist").Inc()
+		return fmt.Errorf("failed to delete watchlist: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("watchlist %d: %w", id, ErrNotFound)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("delete_watchlist", "success").Inc()
+	return nil
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alim08/fin_line/pkg/metrics"
+	"github.com/alim08/fin_line/pkg/models"
+	"github.com/alim08/fin_line/pkg/tenant"
+)
+
+// WebhookRepository defines the interface for webhook subscription access
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, ownerID string, id int64) (*models.Webhook, error)
+	GetWebhooksByOwner(ctx context.Context, ownerID string) ([]*models.Webhook, error)
+	GetActiveWebhooks(ctx context.Context) ([]*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, ownerID string, id int64) error
+}
+
+// webhookRepository implements WebhookRepository
+type webhookRepository struct {
+	db *DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+const webhookColumns = `id, owner_id, tenant_id, url, secret, tickers, severities, active, created_at, updated_at`
+
+// scanWebhook scans a row selected with webhookColumns, decrypting its secret
+func (r *webhookRepository) scanWebhook(row interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.OwnerID,
+		&webhook.TenantID,
+		&webhook.URL,
+		&webhook.Secret,
+		stringArray(&webhook.Tickers),
+		stringArray(&webhook.Severities),
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.Secret, err = r.db.secrets.Open(webhook.Secret); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// CreateWebhook inserts a new webhook subscription for the context's tenant
+func (r *webhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_webhook", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	webhook.Sanitize()
+	if err := webhook.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_webhook", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("webhook validation failed: %w", err)
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (owner_id, tenant_id, url, secret, tickers, severities, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	secret, err := r.db.secrets.Seal(webhook.Secret)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_webhook", "error").Observe(time.Since(start).Seconds())
+		return err
+	}
+
+	webhook.TenantID = tenant.FromContext(ctx)
+	err = r.db.QueryRowContext(ctx, query,
+		webhook.OwnerID,
+		webhook.TenantID,
+		webhook.URL,
+		secret,
+		webhook.Tickers,
+		webhook.Severities,
+		webhook.Active,
+	).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("create_webhook", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("create_webhook").Inc()
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("create_webhook", "success").Inc()
+	return nil
+}
+
+// GetWebhook retrieves a single webhook owned by ownerID
+func (r *webhookRepository) GetWebhook(ctx context.Context, ownerID string, id int64) (*models.Webhook, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_webhook", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE id = $1 AND owner_id = $2 AND tenant_id = $3`
+
+	webhook, err := r.scanWebhook(r.db.QueryRowContext(ctx, query, id, ownerID, tenant.FromContext(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("webhook %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_webhook", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_webhook").Inc()
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_webhook", "success").Inc()
+	return webhook, nil
+}
+
+// GetWebhooksByOwner retrieves all webhooks registered by ownerID
+func (r *webhookRepository) GetWebhooksByOwner(ctx context.Context, ownerID string) ([]*models.Webhook, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_webhooks_by_owner", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE owner_id = $1 AND tenant_id = $2 ORDER BY id`
+
+	webhooks, err := r.queryWebhooks(ctx, query, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_webhooks_by_owner", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_webhooks_by_owner").Inc()
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_webhooks_by_owner", "success").Inc()
+	return webhooks, nil
+}
+
+// GetActiveWebhooks retrieves every active webhook of all tenants for the
+// alert dispatcher, including those of tenants with a schema of their own
+func (r *webhookRepository) GetActiveWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_active_webhooks", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE active = TRUE ORDER BY id`
+
+	var webhooks []*models.Webhook
+	err := r.db.forEachTenantSchema(ctx, func(ctx context.Context) error {
+		schemaWebhooks, err := r.queryWebhooks(ctx, query)
+		webhooks = append(webhooks, schemaWebhooks...)
+		return err
+	})
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("get_active_webhooks", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("get_active_webhooks").Inc()
+		return nil, fmt.Errorf("failed to get active webhooks: %w", err)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("get_active_webhooks", "success").Inc()
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the URL, filters and active flag of a webhook owned by webhook.OwnerID
+func (r *webhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_webhook", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	webhook.Sanitize()
+	if err := webhook.Validate(); err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_webhook", "validation_error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("webhook validation failed: %w", err)
+	}
+
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $3, tickers = $4, severities = $5, active = $6
+		WHERE id = $1 AND owner_id = $2 AND tenant_id = $7
+		RETURNING ` + webhookColumns
+
+	updated, err := r.scanWebhook(r.db.QueryRowContext(ctx, query,
+		webhook.ID,
+		webhook.OwnerID,
+		webhook.URL,
+		webhook.Tickers,
+		webhook.Severities,
+		webhook.Active,
+		tenant.FromContext(ctx),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("webhook %d: %w", webhook.ID, ErrNotFound)
+	}
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("update_webhook", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("update_webhook").Inc()
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	*webhook = *updated
+	metrics.DatabaseOperations.WithLabelValues("update_webhook", "success").Inc()
+	return nil
+}
+
+// DeleteWebhook removes a webhook owned by ownerID
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, ownerID string, id int64) error {
+	start := time.Now()
+	defer func() {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_webhook", "success").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `DELETE FROM webhook_subscriptions WHERE id = $1 AND owner_id = $2 AND tenant_id = $3`
+
+	result, err := r.db.ExecContext(ctx, query, id, ownerID, tenant.FromContext(ctx))
+	if err != nil {
+		metrics.DatabaseOperationDuration.WithLabelValues("delete_webhook", "error").Observe(time.Since(start).Seconds())
+		metrics.DatabaseErrors.WithLabelValues("delete_webhook").Inc()
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("webhook %d: %w", id, ErrNotFound)
+	}
+
+	metrics.DatabaseOperations.WithLabelValues("delete_webhook", "success").Inc()
+	return nil
+}
+
+// queryWebhooks runs a query selecting webhookColumns and collects the rows
+func (r *webhookRepository) queryWebhooks(ctx context.Context, query string, args ...interface{}) ([]*models.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		webhook, err := r.scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
@@ -2,7 +2,6 @@ package metrics
 
 import (
   "github.com/prometheus/client_golang/prometheus"
-  "github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
@@ -60,6 +59,30 @@ var (
       Buckets: prometheus.DefBuckets,
     })
 
+  // DB sink metrics
+  DBSinkCounter = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "pipeline_dbsink_events_total",
+      Help: "Total stream events persisted to Postgres",
+    },
+    []string{"stream"},
+  )
+  DBSinkErrors = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "pipeline_dbsink_errors_total",
+      Help: "DB sink errors, including events dropped as invalid",
+    },
+    []string{"stream"},
+  )
+  DBSinkLatency = prometheus.NewHistogramVec(
+    prometheus.HistogramOpts{
+      Name:    "pipeline_dbsink_batch_latency_seconds",
+      Help:    "Time to persist a batch of stream events",
+      Buckets: prometheus.DefBuckets,
+    },
+    []string{"stream"},
+  )
+
   // Anomaly metrics
   AnomalyErrors = prometheus.NewCounter(
     prometheus.CounterOpts{
@@ -95,6 +118,81 @@ var (
       Help:    "Time to archive data",
       Buckets: prometheus.DefBuckets,
     })
+  ArchivalSinkRecords = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "pipeline_archival_sink_records_total",
+      Help: "Records written by each archive sink, per dataset",
+    },
+    []string{"sink", "dataset"},
+  )
+  ArchivalSinkErrors = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "pipeline_archival_sink_errors_total",
+      Help: "Failed batch writes of each archive sink, per dataset",
+    },
+    []string{"sink", "dataset"},
+  )
+  ArchivalSinkDuration = prometheus.NewHistogramVec(
+    prometheus.HistogramOpts{
+      Name:    "pipeline_archival_sink_write_duration_seconds",
+      Help:    "Time each archive sink takes to write a batch",
+      Buckets: prometheus.DefBuckets,
+    },
+    []string{"sink"},
+  )
+  ArchivalBacklog = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "pipeline_archival_backlog_entries",
+      Help: "Entries of a Redis stream or list not archived yet, after the last archival run",
+    },
+    []string{"stream"},
+  )
+  ArchivalLastSuccess = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "pipeline_archival_last_success_timestamp_seconds",
+      Help: "Unix time of the last successful run of each archival job",
+    },
+    []string{"job"},
+  )
+  ArchivalRunBytes = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "pipeline_archival_run_bytes",
+      Help: "Payload bytes archived by the last run of each archival job",
+    },
+    []string{"job"},
+  )
+  ArchivalStreamLag = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "pipeline_archival_stream_lag_seconds",
+      Help: "Age of the oldest entry of the last continuous archival flush of each stream",
+    },
+    []string{"stream"},
+  )
+  PipelineBackpressure = prometheus.NewGauge(
+    prometheus.GaugeOpts{
+      Name: "pipeline_backpressure_active",
+      Help: "1 while the archival backpressure signal is on, as seen by this service",
+    })
+  IngestThrottled = prometheus.NewCounter(
+    prometheus.CounterOpts{
+      Name: "pipeline_ingest_throttled_total",
+      Help: "Events of low priority feeds dropped under backpressure",
+    })
+
+  // Alert dispatch metrics
+  AlertDeliveries = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "pipeline_alert_deliveries_total",
+      Help: "Webhook alert deliveries by outcome",
+    },
+    []string{"status"},
+  )
+  AlertDeliveryLatency = prometheus.NewHistogram(
+    prometheus.HistogramOpts{
+      Name:    "pipeline_alert_delivery_latency_seconds",
+      Help:    "Time to deliver a webhook alert, including retries",
+      Buckets: prometheus.DefBuckets,
+    })
 
   // API metrics
   APIRequestDuration = prometheus.NewHistogramVec(
@@ -129,6 +227,108 @@ var (
     },
     []string{"operation"},
   )
+  RedisCircuitBreakerState = prometheus.NewGauge(
+    prometheus.GaugeOpts{
+      Name: "redis_circuit_breaker_state",
+      Help: "Redis circuit breaker state (0 closed, 1 open, 2 half-open)",
+    })
+  RedisPubSubMessages = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "redis_pubsub_messages_total",
+      Help: "Messages delivered by managed pub/sub subscriptions",
+    },
+    []string{"channel"},
+  )
+  RedisPubSubGaps = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "redis_pubsub_gaps_total",
+      Help: "Interruptions of managed pub/sub subscriptions, during which messages were missed",
+    },
+    []string{"channel"},
+  )
+  RedisPubSubSequenceGaps = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "redis_pubsub_sequence_gaps_total",
+      Help: "Quotes missed by a subscriber according to their per-ticker sequence numbers",
+    },
+    []string{"channel"},
+  )
+  RedisStreamReaderEntries = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "redis_stream_reader_entries_total",
+      Help: "Stream entries read by consumer groups, by outcome: handled, dead_letter or failed",
+    },
+    []string{"stream", "group", "outcome"},
+  )
+  RedisStreamReaderLag = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_stream_reader_lag_seconds",
+      Help: "Age of the newest stream entry a consumer group handled, 0 once it has caught up",
+    },
+    []string{"stream", "group"},
+  )
+  RedisMemoryUsed = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_memory_used_bytes",
+      Help: "Memory used by Redis, per primary",
+    },
+    []string{"node"},
+  )
+  RedisMemoryMax = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_memory_max_bytes",
+      Help: "Redis maxmemory limit per primary (0 for none)",
+    },
+    []string{"node"},
+  )
+  RedisConnectedClients = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_connected_clients",
+      Help: "Client connections to Redis, per primary",
+    },
+    []string{"node"},
+  )
+  RedisEvictedKeys = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_evicted_keys",
+      Help: "Keys Redis has evicted to stay within maxmemory since it started, per primary",
+    },
+    []string{"node"},
+  )
+  RedisLockLeader = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_lock_leader",
+      Help: "1 for the identity of the replica holding a leader lock, as last seen by this replica",
+    },
+    []string{"lock", "leader"},
+  )
+  RedisLockHeld = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_lock_held",
+      Help: "Whether this replica holds a leader lock (1) or not (0)",
+    },
+    []string{"lock"},
+  )
+  RedisStreamLength = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "redis_stream_length",
+      Help: "Entries in a Redis stream",
+    },
+    []string{"stream"},
+  )
+  RedisClientCacheLookups = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "redis_client_cache_lookups_total",
+      Help: "Reads looked up in the client-side cache, by hit or miss",
+    },
+    []string{"result"},
+  )
+  RedisClientCacheInvalidations = prometheus.NewCounter(
+    prometheus.CounterOpts{
+      Name: "redis_client_cache_invalidations_total",
+      Help: "Keys Redis reported changed to the client-side cache",
+    },
+  )
 
   // Database metrics
   DatabaseHealthCheckDuration = prometheus.NewHistogram(
@@ -169,6 +369,57 @@ var (
     },
     []string{"operation"},
   )
+  DatabaseQueryDuration = prometheus.NewHistogramVec(
+    prometheus.HistogramOpts{
+      Name:    "database_query_duration_seconds",
+      Help:    "Duration of each SQL statement by the repository method issuing it",
+      Buckets: prometheus.DefBuckets,
+    },
+    []string{"method"},
+  )
+  DatabaseSlowQueries = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "database_slow_queries_total",
+      Help: "Total SQL statements slower than the slow query threshold",
+    },
+    []string{"method"},
+  )
+  DatabaseReplicaLag = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "database_replica_lag_seconds",
+      Help: "Replication lag of each read replica",
+    },
+    []string{"replica"},
+  )
+  DatabaseReplicaHealthy = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "database_replica_healthy",
+      Help: "Whether each read replica is serving reads (1) or bypassed (0)",
+    },
+    []string{"replica"},
+  )
+  DatabaseReaderFallbacks = prometheus.NewCounter(
+    prometheus.CounterOpts{
+      Name: "database_reader_fallbacks_total",
+      Help: "Total reads sent to the primary because no replica was healthy",
+    })
+  DatabasePoolConnections = prometheus.NewGaugeVec(
+    prometheus.GaugeOpts{
+      Name: "database_pool_connections",
+      Help: "Database pool connections by state: max, open, in_use and idle",
+    },
+    []string{"state"},
+  )
+  DatabasePoolWaitCount = prometheus.NewGauge(
+    prometheus.GaugeOpts{
+      Name: "database_pool_wait_count",
+      Help: "Cumulative number of connection acquisitions that had to wait for a free connection",
+    })
+  DatabasePoolWaitDuration = prometheus.NewGauge(
+    prometheus.GaugeOpts{
+      Name: "database_pool_wait_duration_seconds",
+      Help: "Cumulative time spent acquiring database connections",
+    })
 
   // Authentication metrics
   AuthOperationDuration = prometheus.NewHistogramVec(
@@ -212,6 +463,36 @@ var (
     []string{"error_type"},
   )
 
+  // Login throttling metrics
+  LoginFailures = prometheus.NewCounter(
+    prometheus.CounterOpts{
+      Name: "auth_login_failures_total",
+      Help: "Total failed login attempts",
+    })
+  LoginLockouts = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "auth_login_lockouts_total",
+      Help: "Lockouts imposed after repeated failed logins",
+    },
+    []string{"scope"},
+  )
+  LoginThrottled = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "auth_login_throttled_total",
+      Help: "Login attempts rejected during a lockout",
+    },
+    []string{"scope"},
+  )
+
+  // Quota metrics
+  APIQuotaRejections = prometheus.NewCounterVec(
+    prometheus.CounterOpts{
+      Name: "api_quota_rejections_total",
+      Help: "Requests rejected for exceeding a principal's quota",
+    },
+    []string{"period"},
+  )
+
   // System metrics
   ActiveConnections = prometheus.NewGauge(
     prometheus.GaugeOpts{
@@ -236,14 +517,28 @@ func init() {
     IngestCounter, IngestErrors, IngestLatency,
     NormalizeLatency, NormalizeErrors, NormalizeCounter,
     CachePubErrors, CachePubCounter, CachePubLatency,
+    DBSinkCounter, DBSinkErrors, DBSinkLatency,
     AnomalyErrors, AnomalyCounter, AnomalyLatency,
     ArchivalSuccessCounter, ArchivalErrorCounter, ArchivalLatency,
+    ArchivalSinkRecords, ArchivalSinkErrors, ArchivalSinkDuration,
+    ArchivalBacklog, ArchivalLastSuccess, ArchivalRunBytes, ArchivalStreamLag,
+    PipelineBackpressure, IngestThrottled,
+    AlertDeliveries, AlertDeliveryLatency,
     APIRequestDuration, APIRequestTotal,
-    RedisOperationDuration, RedisErrors,
+    RedisOperationDuration, RedisErrors, RedisCircuitBreakerState,
+    RedisPubSubMessages, RedisPubSubGaps, RedisPubSubSequenceGaps, RedisStreamReaderEntries, RedisStreamReaderLag,
+    RedisMemoryUsed, RedisMemoryMax, RedisConnectedClients, RedisEvictedKeys, RedisStreamLength,
+    RedisClientCacheLookups, RedisClientCacheInvalidations,
+    RedisLockLeader, RedisLockHeld,
     DatabaseHealthCheckDuration, DatabaseHealthCheckSuccess, DatabaseHealthCheckErrors,
     DatabaseOperationDuration, DatabaseOperations, DatabaseErrors,
+    DatabaseQueryDuration, DatabaseSlowQueries,
+    DatabaseReplicaLag, DatabaseReplicaHealthy, DatabaseReaderFallbacks,
+    DatabasePoolConnections, DatabasePoolWaitCount, DatabasePoolWaitDuration,
     AuthOperationDuration, AuthOperations, AuthErrors,
     AuthMiddlewareDuration, AuthMiddlewareSuccess, AuthMiddlewareErrors,
+    LoginFailures, LoginLockouts, LoginThrottled,
+    APIQuotaRejections,
     ActiveConnections, MemoryUsage, Goroutines,
   )
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+    "time"
+)
+
+// Anomaly severities, see Anomaly.Severity
+const (
+    SeverityLow    = "low"
+    SeverityMedium = "medium"
+    SeverityHigh   = "high"
+)
+
+// AnomalyTypePriceSpike is the type of anomalies flagged by the z-score detector
+const AnomalyTypePriceSpike = "price_spike"
+
+// AnomalyDetectorZScore names the z-score detector of cmd/anomaly
+const AnomalyDetectorZScore = "zscore"
+
+// Anomaly statuses. An anomaly is open until acknowledged and resolved once
+// it no longer needs attention.
+const (
+    AnomalyStatusOpen         = "open"
+    AnomalyStatusAcknowledged = "acknowledged"
+    AnomalyStatusResolved     = "resolved"
+)
+
+// AnomalyRecord is an anomaly as stored in the anomalies table, with the
+// classification and workflow state the API and GraphQL anomaly shapes expose
+type AnomalyRecord struct {
+    ID int64 `json:"id"`
+    Anomaly
+    Type           string     `json:"type"`
+    Severity       string     `json:"severity"`
+    Detector       string     `json:"detector,omitempty"`
+    Status         string     `json:"status"`
+    Source         string     `json:"source"`
+    AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+    AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+    TenantID       string     `json:"tenant_id"`
+    CreatedAt      time.Time  `json:"created_at"`
+}
+
+// IsValidSeverity reports whether s is one of the anomaly severities
+func IsValidSeverity(s string) bool {
+    return s == SeverityLow || s == SeverityMedium || s == SeverityHigh
+}
+
+// IsValidAnomalyStatus reports whether s is one of the anomaly statuses
+func IsValidAnomalyStatus(s string) bool {
+    return s == AnomalyStatusOpen || s == AnomalyStatusAcknowledged || s == AnomalyStatusResolved
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+    "strings"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// APIKey lets a machine client such as an ingestion partner or a script
+// authenticate without logging in. Only a hash of the key is stored; Prefix
+// identifies the key in listings and logs. Scopes are the permissions, such
+// as "quotes:read", granted to requests made with the key.
+type APIKey struct {
+    ID         int64      `json:"id"`
+    Name       string     `json:"name" validate:"required,max=100"`
+    Prefix     string     `json:"prefix"`
+    KeyHash    string     `json:"-"`
+    Scopes     []string   `json:"scopes" validate:"min=1,max=20,dive,required,max=50"`
+    TenantID   string     `json:"tenant_id"`
+    CreatedBy  string     `json:"created_by"`
+    ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+    LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+    RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+    CreatedAt  time.Time  `json:"created_at"`
+    UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Validate validates the APIKey struct
+func (k APIKey) Validate() error {
+    if errors := validation.ValidateStruct(k); len(errors) > 0 {
+        return errors
+    }
+    if k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now()) {
+        return validation.ValidationErrors{{Field: "ExpiresAt", Message: "ExpiresAt must be in the future", Value: k.ExpiresAt.String()}}
+    }
+    return nil
+}
+
+// Sanitize cleans the APIKey data
+func (k *APIKey) Sanitize() {
+    k.Name = validation.SanitizeString(k.Name)
+    for i, scope := range k.Scopes {
+        k.Scopes[i] = strings.ToLower(validation.SanitizeString(scope))
+    }
+}
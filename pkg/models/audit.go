@@ -0,0 +1,53 @@
+package models
+
+import (
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// Anomaly audit actions
+const (
+    AuditActionCreate      = "create"
+    AuditActionDelete      = "delete"
+    AuditActionRestore     = "restore"
+    AuditActionAcknowledge = "acknowledge"
+)
+
+// ManualAnomaly is an anomaly entered through the API rather than by the detector.
+// Deleted anomalies keep their row with DeletedAt set until restored.
+type ManualAnomaly struct {
+    ID int64 `json:"id"`
+    Anomaly
+    Note           string     `json:"note,omitempty" validate:"max=500"`
+    CreatedBy      string     `json:"created_by"`
+    CreatedAt      time.Time  `json:"created_at"`
+    DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+    DeletedBy      string     `json:"deleted_by,omitempty"`
+    AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+    AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+    TenantID       string     `json:"tenant_id"`
+}
+
+// Validate validates the ManualAnomaly struct
+func (m ManualAnomaly) Validate() error {
+    if errors := validation.ValidateStruct(m); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the ManualAnomaly data
+func (m *ManualAnomaly) Sanitize() {
+    m.Anomaly.Sanitize()
+    m.Note = validation.SanitizeString(m.Note)
+}
+
+// AnomalyAuditEntry records who created, deleted, restored or acknowledged an anomaly
+type AnomalyAuditEntry struct {
+    ID        int64     `json:"id"`
+    AnomalyID int64     `json:"anomaly_id"`
+    Action    string    `json:"action"`
+    Actor     string    `json:"actor"`
+    CreatedAt time.Time `json:"created_at"`
+}
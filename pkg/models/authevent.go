@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Auth event types recorded in the auth audit log
+const (
+    AuthEventLoginSuccess     = "login_success"
+    AuthEventLoginFailure     = "login_failure"
+    AuthEventLoginThrottled   = "login_throttled"
+    AuthEventTokenRefresh     = "token_refresh"
+    AuthEventTokenReuse       = "token_reuse"
+    AuthEventLogout           = "logout"
+    AuthEventAuthFailure      = "authentication_failure"
+    AuthEventPermissionDenied = "permission_denied"
+    AuthEventServiceToken     = "service_token_issued"
+)
+
+// AuthEvent records an authentication or authorization decision for
+// compliance review. Principal is the user ID, or the submitted username for
+// failed logins, and is empty when the caller could not be identified.
+type AuthEvent struct {
+    ID        int64     `json:"id"`
+    Type      string    `json:"type"`
+    Principal string    `json:"principal,omitempty"`
+    TenantID  string    `json:"tenant_id,omitempty"`
+    IP        string    `json:"ip"`
+    Method    string    `json:"method"`
+    Route     string    `json:"route"`
+    Detail    string    `json:"detail,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+    "strings"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// DetectorConfig holds anomaly detector parameters, either the global
+// defaults (empty Ticker) or an override for a single ticker.
+type DetectorConfig struct {
+    Ticker     string    `json:"ticker,omitempty" validate:"omitempty,ticker"`
+    Threshold  float64   `json:"threshold" validate:"gt=0,lt=100"`
+    WindowSize int       `json:"window_size" validate:"min=2,max=10000"`
+    UpdatedBy  string    `json:"updated_by,omitempty"`
+    UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Validate validates the DetectorConfig struct
+func (dc DetectorConfig) Validate() error {
+    if errors := validation.ValidateStruct(dc); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the DetectorConfig data
+func (dc *DetectorConfig) Sanitize() {
+    dc.Ticker = strings.ToUpper(validation.SanitizeString(dc.Ticker))
+    dc.UpdatedBy = validation.SanitizeString(dc.UpdatedBy)
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+    "strings"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// Ticker is an entry of the tickers reference table, joined with its sector name.
+type Ticker struct {
+    ID        int64     `json:"id"`
+    Symbol    string    `json:"symbol" validate:"required,ticker"`
+    Name      string    `json:"name,omitempty" validate:"max=100"`
+    Sector    string    `json:"sector" validate:"required,sector"`
+    Active    bool      `json:"active"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate validates the Ticker struct
+func (t Ticker) Validate() error {
+    if errors := validation.ValidateStruct(t); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the Ticker data
+func (t *Ticker) Sanitize() {
+    t.Symbol = strings.ToUpper(validation.SanitizeString(t.Symbol))
+    t.Name = validation.SanitizeString(t.Name)
+    t.Sector = validation.SanitizeString(t.Sector)
+}
+
+// Sector is an entry of the sectors reference table.
+type Sector struct {
+    ID          int64     `json:"id"`
+    Name        string    `json:"name" validate:"required,sector"`
+    Description string    `json:"description,omitempty"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Validate validates the Sector struct
+func (s Sector) Validate() error {
+    if errors := validation.ValidateStruct(s); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the Sector data
+func (s *Sector) Sanitize() {
+    s.Name = validation.SanitizeString(s.Name)
+    s.Description = validation.SanitizeString(s.Description)
+}
@@ -245,6 +245,57 @@ func NormalizedTickFromMap(m map[string]interface{}) (NormalizedTick, error) {
     return nt, nil
 }
 
+// HistoricalTickFromMap creates a NormalizedTick from a stream entry of any
+// age, for replaying streams into storage. Unlike NormalizedTickFromMap it
+// keeps the recorded timestamp instead of replacing one older than a day
+// with the current time.
+func HistoricalTickFromMap(m map[string]interface{}) (NormalizedTick, error) {
+    var ts int64
+    switch v := m["ts_ms"].(type) {
+    case int64:
+        ts = v
+    case string:
+        parsed, err := strconv.ParseInt(v, 10, 64)
+        if err != nil {
+            return NormalizedTick{}, fmt.Errorf("timestamp parse error: %w", err)
+        }
+        ts = parsed
+    case float64:
+        ts = int64(v)
+    default:
+        return NormalizedTick{}, fmt.Errorf("missing or invalid 'ts_ms'")
+    }
+
+    // Parse the other fields as those of a live tick
+    live := make(map[string]interface{}, len(m))
+    for k, v := range m {
+        live[k] = v
+    }
+    live["ts_ms"] = time.Now().UnixMilli()
+    nt, err := NormalizedTickFromMap(live)
+    if err != nil {
+        return nt, err
+    }
+
+    nt.Timestamp = ts
+    if err := nt.ValidateHistorical(); err != nil {
+        return nt, fmt.Errorf("validation failed: %w", err)
+    }
+    return nt, nil
+}
+
+// ValidateHistorical validates nt like Validate, but accepts any timestamp
+// after the epoch and not in the future, for ticks recorded in the past
+func (nt NormalizedTick) ValidateHistorical() error {
+    if nt.Timestamp <= 0 || nt.Timestamp > time.Now().UnixMilli() {
+        return validation.ValidationErrors{{Field: "Timestamp", Message: "Timestamp must be after the epoch and not in the future", Value: nt.Timestamp}}
+    }
+
+    recent := nt
+    recent.Timestamp = time.Now().UnixMilli()
+    return recent.Validate()
+}
+
 // Anomaly represents a detected anomaly event
 type Anomaly struct {
     Ticker    string  `json:"ticker" validate:"required,ticker"`
@@ -276,6 +327,18 @@ func (a *Anomaly) Sanitize() {
     }
 }
 
+// Severity buckets the z-score into "low", "medium" or "high"
+func (a Anomaly) Severity() string {
+    switch {
+    case a.ZScore >= 6:
+        return SeverityHigh
+    case a.ZScore >= 4:
+        return SeverityMedium
+    default:
+        return SeverityLow
+    }
+}
+
 // ToMap converts Anomaly to a map for Redis storage
 func (a Anomaly) ToMap() map[string]interface{} {
     return map[string]interface{}{
@@ -2,6 +2,7 @@ package models
 
 import (
     //"fmt"
+    "strconv"
     "testing"
     "time"
 )
@@ -72,3 +73,48 @@ func TestRawTickFromMap_InvalidCases(t *testing.T) {
         })
     }
 }
+
+func TestHistoricalTickFromMap_KeepsTimestamp(t *testing.T) {
+    old := time.Now().AddDate(0, -1, 0).UnixMilli()
+    m := map[string]interface{}{
+        "ticker": "BTCUSD",
+        "price":  "123.45",
+        "ts_ms":  strconv.FormatInt(old, 10),
+        "sector": "crypto",
+    }
+
+    nt, err := HistoricalTickFromMap(m)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if nt.Timestamp != old {
+        t.Errorf("Timestamp = %d; want %d", nt.Timestamp, old)
+    }
+    if nt.Ticker != "BTCUSD" || nt.Price != 123.45 || nt.Sector != "crypto" {
+        t.Errorf("got %+v", nt)
+    }
+    if m["ts_ms"] != strconv.FormatInt(old, 10) {
+        t.Errorf("input map was modified: ts_ms = %v", m["ts_ms"])
+    }
+}
+
+func TestHistoricalTickFromMap_InvalidCases(t *testing.T) {
+    future := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+    cases := []struct {
+        name  string
+        input map[string]interface{}
+    }{
+        {"missing timestamp", map[string]interface{}{"ticker": "BTCUSD", "price": "1", "sector": "crypto"}},
+        {"bad timestamp", map[string]interface{}{"ticker": "BTCUSD", "price": "1", "ts_ms": "soon", "sector": "crypto"}},
+        {"future timestamp", map[string]interface{}{"ticker": "BTCUSD", "price": "1", "ts_ms": future, "sector": "crypto"}},
+        {"bad price", map[string]interface{}{"ticker": "BTCUSD", "price": "x", "ts_ms": "1000", "sector": "crypto"}},
+    }
+
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if _, err := HistoricalTickFromMap(tc.input); err == nil {
+                t.Errorf("expected error, got nil")
+            }
+        })
+    }
+}
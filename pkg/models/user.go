@@ -0,0 +1,69 @@
+package models
+
+import (
+    "strings"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// User is an account that can log in to the API. The password is only ever
+// held as a bcrypt hash.
+type User struct {
+    ID           int64     `json:"id"`
+    Username     string    `json:"username" validate:"required,min=3,max=100"`
+    Email        string    `json:"email,omitempty" validate:"omitempty,email,max=255"`
+    PasswordHash string    `json:"-"`
+    Roles        []string  `json:"roles" validate:"max=20,dive,required,max=50"`
+    TenantID     string    `json:"tenant_id"`
+    Active       bool      `json:"active"`
+    CreatedAt    time.Time `json:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Validate validates the User struct
+func (u User) Validate() error {
+    if errors := validation.ValidateStruct(u); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the User data. Usernames are matched case-insensitively.
+func (u *User) Sanitize() {
+    u.Username = strings.ToLower(validation.SanitizeString(u.Username))
+    u.Email = validation.SanitizeString(u.Email)
+    for i, role := range u.Roles {
+        u.Roles[i] = strings.ToLower(validation.SanitizeString(role))
+    }
+}
+
+// Role is a named set of permissions that can be assigned to users. What a
+// role grants is defined by the auth policy.
+type Role struct {
+    Name        string    `json:"name" validate:"required,max=50"`
+    Description string    `json:"description,omitempty" validate:"max=500"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Validate validates the Role struct
+func (r Role) Validate() error {
+    if errors := validation.ValidateStruct(r); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the Role data. Role names are lowercase like assigned roles.
+func (r *Role) Sanitize() {
+    r.Name = strings.ToLower(validation.SanitizeString(r.Name))
+    r.Description = validation.SanitizeString(r.Description)
+}
+
+// Session is a live login of a user, backed by its current refresh token
+type Session struct {
+    ID        int64     `json:"id"`
+    UserID    int64     `json:"user_id"`
+    CreatedAt time.Time `json:"created_at"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+    "strings"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// Watchlist is a named list of tickers kept by a user
+type Watchlist struct {
+    ID        int64     `json:"id"`
+    OwnerID   string    `json:"owner_id"`
+    TenantID  string    `json:"tenant_id"`
+    Name      string    `json:"name" validate:"required,max=100"`
+    Tickers   []string  `json:"tickers" validate:"max=200,dive,ticker"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate validates the Watchlist struct
+func (wl Watchlist) Validate() error {
+    if errors := validation.ValidateStruct(wl); len(errors) > 0 {
+        return errors
+    }
+    return nil
+}
+
+// Sanitize cleans the Watchlist data, upper-casing tickers and dropping duplicates
+func (wl *Watchlist) Sanitize() {
+    wl.Name = validation.SanitizeString(wl.Name)
+
+    seen := make(map[string]bool, len(wl.Tickers))
+    tickers := make([]string, 0, len(wl.Tickers))
+    for _, t := range wl.Tickers {
+        t = strings.ToUpper(validation.SanitizeString(t))
+        if t == "" || seen[t] {
+            continue
+        }
+        seen[t] = true
+        tickers = append(tickers, t)
+    }
+    wl.Tickers = tickers
+}
+
+// Contains reports whether ticker is on the watchlist
+func (wl Watchlist) Contains(ticker string) bool {
+    for _, t := range wl.Tickers {
+        if t == ticker {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "net"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/alim08/fin_line/pkg/validation"
+)
+
+// Webhook is a user-registered callback that receives matching anomalies.
+// Empty Tickers or Severities match everything.
+type Webhook struct {
+    ID         int64     `json:"id"`
+    OwnerID    string    `json:"owner_id"`
+    TenantID   string    `json:"tenant_id"`
+    URL        string    `json:"url" validate:"required,url,max=2048"`
+    Secret     string    `json:"secret,omitempty"`
+    Tickers    []string  `json:"tickers" validate:"max=100,dive,ticker"`
+    Severities []string  `json:"severities" validate:"dive,oneof=low medium high"`
+    Active     bool      `json:"active"`
+    CreatedAt  time.Time `json:"created_at"`
+    UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NewWebhookSecret returns a random hex secret used to sign deliveries
+func NewWebhookSecret() (string, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
+
+// Validate validates the Webhook struct. The URL must use https and may
+// not name a loopback, private or link-local host; as a host name can
+// resolve to one later, the alerter checks the addresses it connects to too.
+func (wh Webhook) Validate() error {
+    if errors := validation.ValidateStruct(wh); len(errors) > 0 {
+        return errors
+    }
+    u, err := url.Parse(wh.URL)
+    if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+        return validation.ValidationErrors{{Field: "URL", Message: "URL must use https", Value: wh.URL}}
+    }
+    host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+    if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+        return validation.ValidationErrors{{Field: "URL", Message: "URL must not name a local host", Value: wh.URL}}
+    }
+    if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+        return validation.ValidationErrors{{Field: "URL", Message: "URL must not name a loopback, private or link-local address", Value: wh.URL}}
+    }
+    return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP reports whether webhooks may be delivered to ip: it is none
+// of the unspecified, loopback, private, shared, link-local or multicast
+// addresses, which would let a webhook reach internal services
+func IsPublicIP(ip net.IP) bool {
+    return !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsPrivate() &&
+        !ip.IsLinkLocalUnicast() && !ip.IsMulticast() && !sharedAddressSpace.Contains(ip)
+}
+
+// Sanitize cleans the Webhook data
+func (wh *Webhook) Sanitize() {
+    wh.URL = validation.SanitizeString(wh.URL)
+    for i, t := range wh.Tickers {
+        wh.Tickers[i] = strings.ToUpper(validation.SanitizeString(t))
+    }
+    for i, s := range wh.Severities {
+        wh.Severities[i] = strings.ToLower(validation.SanitizeString(s))
+    }
+}
+
+// Matches reports whether the anomaly passes the webhook's filters
+func (wh Webhook) Matches(a Anomaly) bool {
+    return matchesFilter(wh.Tickers, a.Ticker) && matchesFilter(wh.Severities, a.Severity())
+}
+
+// matchesFilter treats an empty filter as match-all
+func matchesFilter(filter []string, value string) bool {
+    if len(filter) == 0 {
+        return true
+    }
+    for _, f := range filter {
+        if f == value {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+    "testing"
+)
+
+func TestWebhookValidate_URL(t *testing.T) {
+    cases := []struct {
+        url string
+        ok  bool
+    }{
+        {"https://hooks.example.com/fin-line", true},
+        {"https://203.0.113.10/hook", true},
+        {"http://hooks.example.com/fin-line", false},
+        {"ftp://hooks.example.com/fin-line", false},
+        {"https://localhost:8080/hook", false},
+        {"https://127.0.0.1/hook", false},
+        {"https://10.0.0.5/hook", false},
+        {"https://169.254.169.254/latest/meta-data", false},
+        {"https://[::1]/hook", false},
+        {"https://[fe80::1]/hook", false},
+    }
+    for _, c := range cases {
+        err := Webhook{URL: c.url}.Validate()
+        if (err == nil) != c.ok {
+            t.Errorf("Validate(%q) = %v; want ok %v", c.url, err, c.ok)
+        }
+    }
+}
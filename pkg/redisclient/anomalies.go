@@ -0,0 +1,117 @@
+package redisclient
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "strconv"
+
+  "github.com/alim08/fin_line/pkg/models"
+  "github.com/go-redis/redis/v8"
+)
+
+// AnomalyKeyPrefix prefixes the per-ticker sorted sets the anomaly service
+// adds each anomaly to, scored by its timestamp in milliseconds
+const AnomalyKeyPrefix = "anomalies:"
+
+// AnomalyKey returns the sorted set holding the anomalies of ticker
+func AnomalyKey(ticker string) string {
+  return AnomalyKeyPrefix + ticker
+}
+
+// anomalyMember is the JSON encoding of a sorted set member
+type anomalyMember struct {
+  Ticker    string  `json:"ticker"`
+  Price     float64 `json:"price"`
+  ZScore    float64 `json:"z"`
+  Timestamp int64   `json:"ts_ms"`
+}
+
+// EncodeAnomaly returns the sorted set member for a
+func EncodeAnomaly(a models.Anomaly) string {
+  b, _ := json.Marshal(anomalyMember{Ticker: a.Ticker, Price: a.Price, ZScore: a.ZScore, Timestamp: a.Timestamp})
+  return string(b)
+}
+
+// DecodeAnomaly parses a sorted set member of ticker's anomalies
+func DecodeAnomaly(ticker, member string) (models.Anomaly, error) {
+  var m anomalyMember
+  if err := json.Unmarshal([]byte(member), &m); err != nil {
+    return models.Anomaly{}, fmt.Errorf("invalid anomaly member: %w", err)
+  }
+  if m.Ticker == "" {
+    m.Ticker = ticker
+  }
+  return models.Anomaly{Ticker: m.Ticker, Price: m.Price, ZScore: m.ZScore, Timestamp: m.Timestamp}, nil
+}
+
+// AnomalyRange selects a page of a ticker's anomalies by time
+type AnomalyRange struct {
+  // Since and Until bound the timestamps, in milliseconds, inclusively;
+  // zero leaves that end open
+  Since, Until int64
+  // Offset skips that many anomalies of the range, Limit returns at most
+  // that many, all of them when zero
+  Offset, Limit int64
+  // NewestFirst orders the page by descending timestamp
+  NewestFirst bool
+}
+
+// scores returns the score bounds of the time range
+func (r AnomalyRange) scores() (min, max string) {
+  min, max = "-inf", "+inf"
+  if r.Since > 0 {
+    min = strconv.FormatInt(r.Since, 10)
+  }
+  if r.Until > 0 {
+    max = strconv.FormatInt(r.Until, 10)
+  }
+  return min, max
+}
+
+// AnomaliesInRange reads a page of the anomalies of ticker within r. With a
+// fixed Until, pages of a range are stable while anomalies are added, as
+// these land at its newest end. Members that fail to decode are skipped.
+func (c *Client) AnomaliesInRange(ctx context.Context, ticker string, r AnomalyRange) ([]models.Anomaly, error) {
+  min, max := r.scores()
+  by := &redis.ZRangeBy{Min: min, Max: max, Offset: r.Offset, Count: r.Limit}
+  if by.Count == 0 {
+    // LIMIT needs a count, negative returning everything from the offset
+    by.Count = -1
+  }
+
+  var members []string
+  err := c.streamOp(ctx, "zrangebyscore", func() error {
+    var err error
+    if r.NewestFirst {
+      members, err = c.rdb.ZRevRangeByScore(ctx, AnomalyKey(ticker), by).Result()
+    } else {
+      members, err = c.rdb.ZRangeByScore(ctx, AnomalyKey(ticker), by).Result()
+    }
+    return err
+  })
+  if err != nil {
+    return nil, err
+  }
+
+  anomalies := make([]models.Anomaly, 0, len(members))
+  for _, member := range members {
+    if a, err := DecodeAnomaly(ticker, member); err == nil {
+      anomalies = append(anomalies, a)
+    }
+  }
+  return anomalies, nil
+}
+
+// CountAnomaliesInRange counts the anomalies of ticker within the time range
+// of r, ignoring its paging
+func (c *Client) CountAnomaliesInRange(ctx context.Context, ticker string, r AnomalyRange) (int64, error) {
+  min, max := r.scores()
+  var n int64
+  err := c.streamOp(ctx, "zcount", func() error {
+    var err error
+    n, err = c.rdb.ZCount(ctx, AnomalyKey(ticker), min, max).Result()
+    return err
+  })
+  return n, err
+}
@@ -0,0 +1,197 @@
+package redisclient
+
+import (
+  "context"
+  "encoding/json"
+  "strconv"
+  "sync"
+  "sync/atomic"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "github.com/go-redis/redis/v8"
+  "go.uber.org/zap"
+)
+
+const (
+  // BackpressureKey holds the pipeline's backpressure signal while it is
+  // on. It expires unless renewed, so a signal whose publisher died clears
+  // itself.
+  BackpressureKey = "pipeline:backpressure"
+  // BackpressureChannel carries every change of the signal
+  BackpressureChannel = "pipeline:backpressure"
+)
+
+// Backpressure asks producers to slow down: the archival service raises it
+// when it falls behind while Redis nears its memory limit, so that low
+// priority feeds give way before Redis runs out of memory
+type Backpressure struct {
+  Active bool `json:"active"`
+  // Reason says why the signal is on
+  Reason string `json:"reason,omitempty"`
+  // MemoryRatio is used_memory / maxmemory when the signal was last set
+  MemoryRatio float64 `json:"memory_ratio"`
+  // Since is when the signal came on, in milliseconds
+  Since int64 `json:"since_ms,omitempty"`
+}
+
+// SetBackpressure stores the signal, for ttl when it is on, and publishes it
+func (c *Client) SetBackpressure(ctx context.Context, bp Backpressure, ttl time.Duration) error {
+  payload, err := json.Marshal(bp)
+  if err != nil {
+    return err
+  }
+  if bp.Active {
+    err = c.rdb.Set(ctx, BackpressureKey, payload, ttl).Err()
+  } else {
+    err = c.rdb.Del(ctx, BackpressureKey).Err()
+  }
+  if err != nil {
+    return err
+  }
+  return c.rdb.Publish(ctx, BackpressureChannel, payload).Err()
+}
+
+// GetBackpressure returns the signal, inactive if none is stored
+func (c *Client) GetBackpressure(ctx context.Context) (Backpressure, error) {
+  var bp Backpressure
+  payload, err := c.rdb.Get(ctx, BackpressureKey).Bytes()
+  if err == redis.Nil {
+    return bp, nil
+  }
+  if err != nil {
+    return bp, err
+  }
+  if err := json.Unmarshal(payload, &bp); err != nil {
+    return Backpressure{}, err
+  }
+  return bp, nil
+}
+
+// MemoryUsage returns used_memory and maxmemory, in bytes, of Redis or, on
+// a Cluster, of the primary closest to its limit. maxmemory is 0 when
+// memory is not limited.
+func (c *Client) MemoryUsage(ctx context.Context) (used, max int64, err error) {
+  sample := func(ctx context.Context, node redis.UniversalClient) (int64, int64, error) {
+    raw, err := node.Info(ctx, "memory").Result()
+    if err != nil {
+      return 0, 0, err
+    }
+    info := parseInfo(raw)
+    used, _ := strconv.ParseInt(info["used_memory"], 10, 64)
+    max, _ := strconv.ParseInt(info["maxmemory"], 10, 64)
+    return used, max, nil
+  }
+
+  cluster, ok := c.rdb.(*redis.ClusterClient)
+  if !ok {
+    return sample(ctx, c.rdb)
+  }
+
+  var mu sync.Mutex
+  var fullest float64 = -1
+  err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+    u, m, err := sample(ctx, node)
+    if err != nil {
+      return err
+    }
+    ratio := 0.0
+    if m > 0 {
+      ratio = float64(u) / float64(m)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if ratio > fullest {
+      fullest, used, max = ratio, u, m
+    }
+    return nil
+  })
+  return used, max, err
+}
+
+// BackpressureWatcher follows the backpressure signal for a producer,
+// through BackpressureChannel and by polling BackpressureKey, which also
+// notices a signal expiring
+type BackpressureWatcher struct {
+  c        *Client
+  interval time.Duration
+  active   atomic.Bool
+}
+
+// NewBackpressureWatcher creates a watcher polling every
+// BACKPRESSURE_POLL_INTERVAL
+func NewBackpressureWatcher(c *Client) *BackpressureWatcher {
+  return &BackpressureWatcher{
+    c:        c,
+    interval: getEnvDurationOrDefault("BACKPRESSURE_POLL_INTERVAL", 5*time.Second),
+  }
+}
+
+// Active reports whether the signal is on
+func (w *BackpressureWatcher) Active() bool {
+  return w.active.Load()
+}
+
+// Run follows the signal until ctx is done
+func (w *BackpressureWatcher) Run(ctx context.Context) {
+  var messages <-chan Message
+  sub, err := w.c.SubscribeManaged(ctx, BackpressureChannel)
+  if err != nil {
+    logger.Log.Warn("failed to subscribe to backpressure signal, polling only", zap.Error(err))
+  } else {
+    defer sub.Close()
+    messages = sub.Channel()
+  }
+
+  ticker := time.NewTicker(w.interval)
+  defer ticker.Stop()
+  w.reload(ctx)
+  for {
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+      w.reload(ctx)
+    case msg, ok := <-messages:
+      if !ok {
+        messages = nil
+        continue
+      }
+      var bp Backpressure
+      if msg.Gap || json.Unmarshal([]byte(msg.Payload), &bp) != nil {
+        w.reload(ctx)
+        continue
+      }
+      w.set(bp)
+    }
+  }
+}
+
+// reload reads the stored signal
+func (w *BackpressureWatcher) reload(ctx context.Context) {
+  bp, err := w.c.GetBackpressure(ctx)
+  if err != nil {
+    if ctx.Err() == nil {
+      logger.Log.Warn("failed to read backpressure signal", zap.Error(err))
+    }
+    return
+  }
+  w.set(bp)
+}
+
+// set records bp, logging changes
+func (w *BackpressureWatcher) set(bp Backpressure) {
+  if w.active.Swap(bp.Active) != bp.Active {
+    if bp.Active {
+      logger.Log.Warn("backpressure on", zap.String("reason", bp.Reason), zap.Float64("memory_ratio", bp.MemoryRatio))
+    } else {
+      logger.Log.Info("backpressure off")
+    }
+  }
+  if bp.Active {
+    metrics.PipelineBackpressure.Set(1)
+  } else {
+    metrics.PipelineBackpressure.Set(0)
+  }
+}
@@ -0,0 +1,147 @@
+package redisclient
+
+import (
+  "sync/atomic"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "go.uber.org/zap"
+)
+
+// Circuit breaker states, as reported by the redis_circuit_breaker_state
+// gauge
+const (
+  breakerClosed   int32 = 0
+  breakerOpen     int32 = 1
+  breakerHalfOpen int32 = 2
+)
+
+// BreakerConfig configures the circuit breaker failing Redis operations fast
+// while Redis is unreachable. After FailureThreshold consecutive failures
+// the breaker opens and rejects operations with ErrCircuitBreakerOpen. Once
+// Cooldown has passed it turns half-open and lets HalfOpenProbes operations
+// through: if they all succeed it closes, and a single failure opens it for
+// another Cooldown.
+type BreakerConfig struct {
+  FailureThreshold int
+  Cooldown         time.Duration
+  HalfOpenProbes   int
+}
+
+// Breaker defaults, also used for zero BreakerConfig fields
+const (
+  defaultBreakerFailures = 5
+  defaultBreakerCooldown = 5 * time.Second
+  defaultBreakerProbes   = 1
+)
+
+// NewBreakerConfig reads the circuit breaker configuration from environment
+// variables
+func NewBreakerConfig() BreakerConfig {
+  return BreakerConfig{
+    FailureThreshold: getEnvIntOrDefault("REDIS_BREAKER_FAILURES", defaultBreakerFailures),
+    Cooldown:         getEnvDurationOrDefault("REDIS_BREAKER_COOLDOWN", defaultBreakerCooldown),
+    HalfOpenProbes:   getEnvIntOrDefault("REDIS_BREAKER_PROBES", defaultBreakerProbes),
+  }
+}
+
+func (b BreakerConfig) failureThreshold() int64 {
+  if b.FailureThreshold <= 0 {
+    return defaultBreakerFailures
+  }
+  return int64(b.FailureThreshold)
+}
+
+func (b BreakerConfig) cooldown() time.Duration {
+  if b.Cooldown <= 0 {
+    return defaultBreakerCooldown
+  }
+  return b.Cooldown
+}
+
+func (b BreakerConfig) halfOpenProbes() int64 {
+  if b.HalfOpenProbes <= 0 {
+    return defaultBreakerProbes
+  }
+  return int64(b.HalfOpenProbes)
+}
+
+// allowRequest reports whether the breaker lets an operation through,
+// turning an open breaker half-open once its cooldown has passed
+func (c *Client) allowRequest() bool {
+  switch atomic.LoadInt32(&c.state) {
+  case breakerClosed:
+    return true
+  case breakerOpen:
+    if time.Since(time.Unix(0, atomic.LoadInt64(&c.openedAt))) < c.breaker.cooldown() {
+      return false
+    }
+    if atomic.CompareAndSwapInt32(&c.state, breakerOpen, breakerHalfOpen) {
+      atomic.StoreInt64(&c.probes, 0)
+      atomic.StoreInt64(&c.probeSuccesses, 0)
+      atomic.StoreInt64(&c.openedAt, time.Now().UnixNano())
+      c.breakerTransition(breakerHalfOpen)
+    }
+  }
+
+  // Half-open: let a limited number of probes through. Should they never
+  // report back, admit new ones after another cooldown.
+  if atomic.AddInt64(&c.probes, 1) <= c.breaker.halfOpenProbes() {
+    return true
+  }
+  if time.Since(time.Unix(0, atomic.LoadInt64(&c.openedAt))) >= c.breaker.cooldown() {
+    atomic.StoreInt64(&c.openedAt, time.Now().UnixNano())
+    atomic.StoreInt64(&c.probes, 1)
+    return true
+  }
+  return false
+}
+
+// checkCircuitBreaker records the outcome of an operation, opening the
+// breaker after too many consecutive failures or a failed probe and closing
+// it once enough probes succeeded
+func (c *Client) checkCircuitBreaker(err error) {
+  if err != nil {
+    atomic.StoreInt64(&c.lastFailure, time.Now().Unix())
+    failures := atomic.AddInt64(&c.failureCount, 1)
+
+    switch atomic.LoadInt32(&c.state) {
+    case breakerClosed:
+      if failures >= c.breaker.failureThreshold() {
+        c.openBreaker(breakerClosed)
+      }
+    case breakerHalfOpen:
+      c.openBreaker(breakerHalfOpen)
+    }
+    return
+  }
+
+  atomic.StoreInt64(&c.failureCount, 0)
+  if atomic.LoadInt32(&c.state) == breakerHalfOpen &&
+    atomic.AddInt64(&c.probeSuccesses, 1) >= c.breaker.halfOpenProbes() &&
+    atomic.CompareAndSwapInt32(&c.state, breakerHalfOpen, breakerClosed) {
+    c.breakerTransition(breakerClosed)
+  }
+}
+
+// openBreaker opens the breaker if it is still in state from
+func (c *Client) openBreaker(from int32) {
+  atomic.StoreInt64(&c.openedAt, time.Now().UnixNano())
+  if atomic.CompareAndSwapInt32(&c.state, from, breakerOpen) {
+    c.breakerTransition(breakerOpen)
+  }
+}
+
+// breakerTransition logs and exports a new breaker state
+func (c *Client) breakerTransition(state int32) {
+  metrics.RedisCircuitBreakerState.Set(float64(state))
+  switch state {
+  case breakerOpen:
+    logger.Log.Warn("circuit breaker opened", zap.String("operation", "redis"), zap.Duration("cooldown", c.breaker.cooldown()))
+  case breakerHalfOpen:
+    logger.Log.Info("circuit breaker half-open, probing", zap.String("operation", "redis"))
+  case breakerClosed:
+    logger.Log.Info("circuit breaker closed", zap.String("operation", "redis"))
+  }
+}
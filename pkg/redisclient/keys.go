@@ -0,0 +1,188 @@
+package redisclient
+
+import (
+  "context"
+  "strings"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// LatestQuoteKeyPrefix prefixes the per-ticker hash (price, ts_ms) holding
+// the latest quote, maintained by cachepub
+const LatestQuoteKeyPrefix = "quotes:latest:"
+
+// LatestQuoteKey returns the key of ticker's latest-quote hash. On a Cluster
+// the hashes of different tickers land in different slots, so read many of
+// them with Pipelined rather than one multi-key command.
+func LatestQuoteKey(ticker string) string {
+  return LatestQuoteKeyPrefix + ticker
+}
+
+// clusterSlots is the number of hash slots of a Redis Cluster
+const clusterSlots = 16384
+
+// HashTag returns tag as a hash tag. On a Cluster only the hash tag of a
+// key picks its slot, so keys embedding the same tag can be used together
+// in one multi-key command, transaction or script, such as the streams a
+// consumer reads in a single XREAD.
+func HashTag(tag string) string {
+  return "{" + tag + "}"
+}
+
+// KeySlot returns the Cluster hash slot of key
+func KeySlot(key string) int {
+  if start := strings.IndexByte(key, '{'); start >= 0 {
+    if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+      key = key[start+1 : start+1+end]
+    }
+  }
+  return int(crc16(key) % clusterSlots)
+}
+
+// SameSlot reports whether keys all hash to the same Cluster slot, as a
+// multi-key command on a Cluster requires
+func SameSlot(keys ...string) bool {
+  for _, key := range keys[min(1, len(keys)):] {
+    if KeySlot(key) != KeySlot(keys[0]) {
+      return false
+    }
+  }
+  return true
+}
+
+// crc16 is the CRC-16/XMODEM checksum Redis Cluster hashes keys with
+func crc16(s string) uint16 {
+  var crc uint16
+  for i := 0; i < len(s); i++ {
+    crc ^= uint16(s[i]) << 8
+    for bit := 0; bit < 8; bit++ {
+      if crc&0x8000 != 0 {
+        crc = crc<<1 ^ 0x1021
+      } else {
+        crc <<= 1
+      }
+    }
+  }
+  return crc
+}
+
+// Topology returns the kind of deployment c is connected to
+func (c *Client) Topology() Topology {
+  if c.topology == "" {
+    return TopologySingle
+  }
+  return c.topology
+}
+
+// Pipelined runs the commands queued by fn in one round trip per node, with
+// metrics and the circuit breaker. On a Cluster the commands are split by
+// the slot of their key and redirected ones are retried, so their keys may
+// live on different nodes.
+func (c *Client) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+  var cmds []redis.Cmder
+  err := c.withMetrics("pipeline", func() error {
+    if !c.allowRequest() {
+      return ErrCircuitBreakerOpen
+    }
+
+    var err error
+    cmds, err = c.rdb.Pipelined(ctx, fn)
+    if err == redis.Nil {
+      // A missing key fails only its own command
+      err = nil
+    }
+    if ctx.Err() == nil {
+      c.checkCircuitBreaker(err)
+    }
+    return err
+  })
+  return cmds, err
+}
+
+// Keys returns the keys matching pattern, gathered with ScanKeys so Redis
+// is not blocked as KEYS would block it; on a Cluster from every primary.
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+  seen := make(map[string]bool)
+  var keys []string
+  err := c.ScanKeys(ctx, pattern, func(key string) error {
+    if !seen[key] {
+      seen[key] = true
+      keys = append(keys, key)
+    }
+    return nil
+  })
+  return keys, err
+}
+
+// PipelineHGetAll queues an HGETALL of each of keys on pipe, for callers
+// batching them with other commands in one Pipelined call. Read the hashes
+// with Hashes once the pipeline has run.
+func PipelineHGetAll(ctx context.Context, pipe redis.Pipeliner, keys ...string) []*redis.StringStringMapCmd {
+  cmds := make([]*redis.StringStringMapCmd, len(keys))
+  for i, key := range keys {
+    cmds[i] = pipe.HGetAll(ctx, key)
+  }
+  return cmds
+}
+
+// Hashes returns the results of HGETALL commands that have run, in order. A
+// missing key yields an empty hash.
+func Hashes(cmds []*redis.StringStringMapCmd) []map[string]string {
+  hashes := make([]map[string]string, len(cmds))
+  for i, cmd := range cmds {
+    hashes[i] = cmd.Val()
+  }
+  return hashes
+}
+
+// MGetHashes reads the hashes at keys in one pipelined round trip per node,
+// returning them in the order of keys. A missing key yields an empty hash.
+func (c *Client) MGetHashes(ctx context.Context, keys ...string) ([]map[string]string, error) {
+  if len(keys) == 0 {
+    return nil, nil
+  }
+
+  var cmds []*redis.StringStringMapCmd
+  _, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+    cmds = PipelineHGetAll(ctx, pipe, keys...)
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  return Hashes(cmds), nil
+}
+
+// LatestQuoteHash reads the latest-quote hash of ticker, empty without a
+// cached quote. With the client-side cache started the hash may be shared
+// and must not be modified.
+func (c *Client) LatestQuoteHash(ctx context.Context, ticker string) (map[string]string, error) {
+  hashes, err := c.cachedHashes(ctx, []string{LatestQuoteKey(ticker)})
+  if err != nil {
+    return nil, err
+  }
+  return hashes[0], nil
+}
+
+// LatestQuoteHashes reads the latest-quote hashes of tickers in one
+// pipelined round trip per node, keyed by ticker. Tickers without a cached
+// quote are omitted. With the client-side cache started the hashes may be
+// shared and must not be modified.
+func (c *Client) LatestQuoteHashes(ctx context.Context, tickers ...string) (map[string]map[string]string, error) {
+  keys := make([]string, len(tickers))
+  for i, ticker := range tickers {
+    keys[i] = LatestQuoteKey(ticker)
+  }
+  hashes, err := c.cachedHashes(ctx, keys)
+  if err != nil {
+    return nil, err
+  }
+
+  latest := make(map[string]map[string]string, len(hashes))
+  for i, hash := range hashes {
+    if len(hash) > 0 {
+      latest[tickers[i]] = hash
+    }
+  }
+  return latest, nil
+}
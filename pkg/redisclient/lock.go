@@ -0,0 +1,321 @@
+package redisclient
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "errors"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "github.com/go-redis/redis/v8"
+  "go.uber.org/zap"
+)
+
+var (
+  // ErrLockHeld is returned by TryLock when another owner holds the lock
+  ErrLockHeld = errors.New("lock is held by another owner")
+  // ErrLockLost is returned when renewing or releasing a lock whose lease
+  // expired and which may since have been taken by another owner
+  ErrLockLost = errors.New("lock lease lost")
+  // ErrStaleToken is returned by FencedHSet when a later lease has written
+  // the hash, so the writer is no longer the leader
+  ErrStaleToken = errors.New("stale fencing token")
+)
+
+// DefaultLeaseTTL is a lease for RunAsLeader short enough for a standby to
+// take over quickly after the leader dies, and long enough to ride out a
+// brief Redis hiccup
+const DefaultLeaseTTL = 15 * time.Second
+
+// acquireLockScript takes the lock if it is free and issues the next
+// fencing token. KEYS[1] is the lock, KEYS[2] its fencing counter; ARGV
+// holds the owner and the lease in milliseconds.
+var acquireLockScript = RegisterScript("lock_acquire", `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+  return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// renewLockScript extends the lease of KEYS[1] if ARGV[1] still owns it
+var renewLockScript = RegisterScript("lock_renew", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes KEYS[1] if ARGV[1] still owns it
+var releaseLockScript = RegisterScript("lock_release", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// fencedHSetScript sets field ARGV[3] of hash KEYS[1] to ARGV[4] unless a
+// fencing token above ARGV[2] has written it, recording the highest token
+// in field ARGV[1]
+var fencedHSetScript = RegisterScript("fenced_hset", `
+local fence = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local token = tonumber(ARGV[2])
+if token < fence then
+  return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2], ARGV[3], ARGV[4])
+return 1
+`)
+
+// fenceField is the field of a hash written by FencedHSet holding the
+// highest fencing token that wrote it
+const fenceField = "_fence"
+
+// fencingTokenKey keys the fencing token in a context
+type fencingTokenKey struct{}
+
+// WithFencingToken returns a copy of ctx carrying a lease's fencing token,
+// which FencedHSet checks writes against. RunAsLeader attaches it to the
+// context its function runs with.
+func WithFencingToken(ctx context.Context, token int64) context.Context {
+  return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingToken returns the fencing token ctx carries, if any
+func FencingToken(ctx context.Context) (int64, bool) {
+  token, ok := ctx.Value(fencingTokenKey{}).(int64)
+  return token, ok
+}
+
+// FencedHSet sets field of hash key to value, failing with ErrStaleToken if
+// the hash was written under a later lease than the fencing token ctx
+// carries, so a leader that lost its lease cannot overwrite what the new
+// one wrote. Without a token in ctx it is a plain HSET.
+func (c *Client) FencedHSet(ctx context.Context, key, field string, value interface{}) error {
+  token, ok := FencingToken(ctx)
+  if !ok {
+    return c.streamOp(ctx, "hset", func() error {
+      return c.rdb.HSet(ctx, key, field, value).Err()
+    })
+  }
+  result, err := c.RunScript(ctx, fencedHSetScript, []string{key}, fenceField, token, field, value)
+  if err != nil {
+    return err
+  }
+  if written, _ := result.(int64); written == 0 {
+    return ErrStaleToken
+  }
+  return nil
+}
+
+// Lock is a lease on a named lock in Redis, taken with SET NX PX. A lease
+// can outlive its holder's belief that it holds it, e.g. across a long GC
+// pause or a Sentinel failover losing the key, so work guarded by a lock
+// should pass its fencing token to the systems it writes to, which reject
+// tokens lower than one they have seen, e.g. with FencedHSet.
+type Lock struct {
+  c     *Client
+  name  string
+  owner string
+  token int64
+  ttl   time.Duration
+}
+
+// Identity names this process as a lock owner, so other replicas can tell
+// who holds a lock: POD_NAME if set, the hostname otherwise
+var Identity = lockIdentity()
+
+// lockIdentity returns the default Identity
+func lockIdentity() string {
+  if name := os.Getenv("POD_NAME"); name != "" {
+    return name
+  }
+  if host, err := os.Hostname(); err == nil && host != "" {
+    return host
+  }
+  return "unknown"
+}
+
+// lockKeys returns the keys of lock name and its fencing counter, sharing
+// a hash tag so the scripts can use both on a Cluster
+func lockKeys(name string) []string {
+  key := "lock:" + HashTag(name)
+  return []string{key, key + ":fence"}
+}
+
+// TryLock takes lock name for ttl, or fails with ErrLockHeld if another
+// owner holds it
+func (c *Client) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+  nonce := make([]byte, 16)
+  if _, err := rand.Read(nonce); err != nil {
+    return nil, err
+  }
+  // The nonce tells apart leases of processes sharing an identity
+  l := &Lock{c: c, name: name, owner: Identity + "/" + hex.EncodeToString(nonce), ttl: ttl}
+
+  result, err := c.RunScript(ctx, acquireLockScript, lockKeys(name), l.owner, ttl.Milliseconds())
+  if err != nil {
+    return nil, err
+  }
+  token, _ := result.(int64)
+  if token == 0 {
+    return nil, ErrLockHeld
+  }
+  l.token = token
+  return l, nil
+}
+
+// LockHolder returns the identity of the process holding lock name, or ""
+// if it is free
+func (c *Client) LockHolder(ctx context.Context, name string) (string, error) {
+  owner, err := c.rdb.Get(ctx, lockKeys(name)[0]).Result()
+  if err == redis.Nil {
+    return "", nil
+  }
+  if err != nil {
+    return "", err
+  }
+  if i := strings.LastIndex(owner, "/"); i >= 0 {
+    owner = owner[:i]
+  }
+  return owner, nil
+}
+
+// Name returns the name of the lock
+func (l *Lock) Name() string {
+  return l.name
+}
+
+// Token returns the fencing token of this lease, larger than that of every
+// earlier lease of the lock
+func (l *Lock) Token() int64 {
+  return l.token
+}
+
+// Refresh renews the lease for another ttl, failing with ErrLockLost if it
+// has expired
+func (l *Lock) Refresh(ctx context.Context) error {
+  result, err := l.c.RunScript(ctx, renewLockScript, lockKeys(l.name)[:1], l.owner, l.ttl.Milliseconds())
+  if err != nil {
+    return err
+  }
+  if renewed, _ := result.(int64); renewed == 0 {
+    return ErrLockLost
+  }
+  return nil
+}
+
+// Release gives the lock up, failing with ErrLockLost if the lease had
+// already expired
+func (l *Lock) Release(ctx context.Context) error {
+  result, err := l.c.RunScript(ctx, releaseLockScript, lockKeys(l.name)[:1], l.owner)
+  if err != nil {
+    return err
+  }
+  if released, _ := result.(int64); released == 0 {
+    return ErrLockLost
+  }
+  return nil
+}
+
+// RunAsLeader runs fn while this process holds lock name, until ctx is
+// done, so a singleton job can run in several replicas with one active.
+// Replicas campaign every ttl/3; the leader renews its lease as often, and
+// fn's context is cancelled once the lease cannot be renewed before it
+// expires. fn receives the lease's fencing token, also carried by its
+// context for FencedHSet, and should return when its context is done;
+// until it does, its fenced writes fail once a new leader has written. If fn returns on its own the lock is released and the
+// replicas campaign again. Every replica exports the identity of the leader
+// it last saw as redis_lock_leader{lock,leader}.
+func (c *Client) RunAsLeader(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context, token int64)) {
+  interval := ttl / 3
+  var leader string
+  defer func() {
+    if leader != "" {
+      metrics.RedisLockLeader.DeleteLabelValues(name, leader)
+    }
+    metrics.RedisLockHeld.WithLabelValues(name).Set(0)
+  }()
+  observe := func(holder string) {
+    if holder == leader {
+      return
+    }
+    if leader != "" {
+      metrics.RedisLockLeader.DeleteLabelValues(name, leader)
+    }
+    if holder != "" {
+      metrics.RedisLockLeader.WithLabelValues(name, holder).Set(1)
+    }
+    leader = holder
+  }
+
+  for {
+    lock, err := c.TryLock(ctx, name, ttl)
+    switch {
+    case err == nil:
+      logger.Log.Info("elected leader", zap.String("lock", name), zap.String("identity", Identity), zap.Int64("token", lock.Token()))
+      observe(Identity)
+      metrics.RedisLockHeld.WithLabelValues(name).Set(1)
+      c.lead(ctx, lock, fn)
+      metrics.RedisLockHeld.WithLabelValues(name).Set(0)
+      observe("")
+    case errors.Is(err, ErrLockHeld):
+      if holder, err := c.LockHolder(ctx, name); err == nil {
+        observe(holder)
+      }
+    case ctx.Err() == nil:
+      logger.Log.Warn("leader election failed", zap.String("lock", name), zap.Error(err))
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-time.After(interval):
+    }
+  }
+}
+
+// lead runs fn under lock, renewing the lease until fn returns or the
+// lease is lost
+func (c *Client) lead(ctx context.Context, lock *Lock, fn func(ctx context.Context, token int64)) {
+  leaderCtx, cancel := context.WithCancel(WithFencingToken(ctx, lock.Token()))
+  defer cancel()
+  done := make(chan struct{})
+  go func() {
+    defer close(done)
+    fn(leaderCtx, lock.Token())
+  }()
+
+  renew := time.NewTicker(lock.ttl / 3)
+  defer renew.Stop()
+  renewed := time.Now()
+  for {
+    select {
+    case <-done:
+      releaseCtx, cancelRelease := context.WithTimeout(context.Background(), time.Second)
+      defer cancelRelease()
+      if err := lock.Release(releaseCtx); err != nil {
+        logger.Log.Warn("failed to release leadership", zap.String("lock", lock.name), zap.Error(err))
+      }
+      return
+    case <-renew.C:
+      err := lock.Refresh(leaderCtx)
+      if err == nil {
+        renewed = time.Now()
+        continue
+      }
+      // Retry a failed renewal while the lease may still be ours
+      if !errors.Is(err, ErrLockLost) && time.Since(renewed) < lock.ttl-lock.ttl/3 {
+        logger.Log.Warn("failed to renew leadership", zap.String("lock", lock.name), zap.Error(err))
+        continue
+      }
+      logger.Log.Warn("lost leadership", zap.String("lock", lock.name), zap.Error(err))
+      cancel()
+      <-done
+      return
+    }
+  }
+}
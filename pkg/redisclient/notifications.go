@@ -0,0 +1,166 @@
+package redisclient
+
+import (
+  "context"
+  "strconv"
+  "strings"
+  "sync"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// KeyEvent is a keyspace notification: Event, such as expired, del or hset,
+// happened to Key. A Gap event has neither: it reports that notifications
+// were missed while the subscription was interrupted, so consumers tracking
+// keys should rescan them.
+type KeyEvent struct {
+  Key   string
+  Event string
+  Gap   bool
+}
+
+// KeyspaceWatch delivers the keyspace notifications of the keys matching a
+// pattern
+type KeyspaceWatch struct {
+  subs      []*Subscription
+  events    chan KeyEvent
+  closed    chan struct{}
+  closeOnce sync.Once
+  wg        sync.WaitGroup
+}
+
+// EnableKeyspaceNotifications adds flags, such as "Kx" for expirations or
+// "Kh" for hash commands, to the notify-keyspace-events setting of Redis,
+// of every primary on a Cluster. Redis publishes no notifications by
+// default, and managed services may refuse CONFIG SET, in which case the
+// setting must be made in their console instead.
+func (c *Client) EnableKeyspaceNotifications(ctx context.Context, flags string) error {
+  enable := func(ctx context.Context, node redis.UniversalClient) error {
+    current, err := node.ConfigGet(ctx, "notify-keyspace-events").Result()
+    if err != nil {
+      return err
+    }
+    merged := flags
+    if len(current) == 2 {
+      if set, ok := current[1].(string); ok {
+        merged = mergeFlags(set, flags)
+      }
+    }
+    return node.ConfigSet(ctx, "notify-keyspace-events", merged).Err()
+  }
+
+  return c.streamOp(ctx, "config_set", func() error {
+    if cluster, ok := c.rdb.(*redis.ClusterClient); ok {
+      return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+        return enable(ctx, node)
+      })
+    }
+    return enable(ctx, c.rdb)
+  })
+}
+
+// mergeFlags adds the notification flags of extra missing from set
+func mergeFlags(set, extra string) string {
+  for _, flag := range extra {
+    if !strings.ContainsRune(set, flag) {
+      set += string(flag)
+    }
+  }
+  return set
+}
+
+// keyspaceChannelPrefix returns the prefix of the channels Redis publishes
+// the notifications of c's database on
+func (c *Client) keyspaceChannelPrefix() string {
+  return "__keyspace@" + strconv.Itoa(c.db) + "__:"
+}
+
+// WatchKeyspace delivers the notifications of the keys matching pattern,
+// e.g. "quotes:latest:*", until ctx is done or the watch is closed. With
+// events given only those events are delivered, e.g. "expired". Keyspace
+// notifications must be enabled, see EnableKeyspaceNotifications. Redis
+// publishes a notification on the node holding the key only, so on a
+// Cluster every primary is watched; a primary added later is not.
+func (c *Client) WatchKeyspace(ctx context.Context, pattern string, events ...string) (*KeyspaceWatch, error) {
+  prefix := c.keyspaceChannelPrefix()
+  channel := prefix + pattern
+
+  var subs []*Subscription
+  if cluster, ok := c.rdb.(*redis.ClusterClient); ok {
+    var mu sync.Mutex
+    err := cluster.ForEachMaster(ctx, func(_ context.Context, node *redis.Client) error {
+      sub, err := manageSubscription(ctx, node.PSubscribe(ctx, channel), true, []string{channel})
+      if err != nil {
+        return err
+      }
+      mu.Lock()
+      subs = append(subs, sub)
+      mu.Unlock()
+      return nil
+    })
+    if err != nil {
+      for _, sub := range subs {
+        sub.Close()
+      }
+      return nil, err
+    }
+  } else {
+    sub, err := c.PSubscribeManaged(ctx, channel)
+    if err != nil {
+      return nil, err
+    }
+    subs = []*Subscription{sub}
+  }
+
+  wanted := make(map[string]bool, len(events))
+  for _, event := range events {
+    wanted[event] = true
+  }
+
+  w := &KeyspaceWatch{subs: subs, events: make(chan KeyEvent, 100), closed: make(chan struct{})}
+  for _, sub := range subs {
+    w.wg.Add(1)
+    go func(sub *Subscription) {
+      defer w.wg.Done()
+      for msg := range sub.Channel() {
+        event := KeyEvent{Gap: msg.Gap}
+        if !msg.Gap {
+          event.Key = strings.TrimPrefix(msg.Channel, prefix)
+          event.Event = msg.Payload
+          if len(wanted) > 0 && !wanted[event.Event] {
+            continue
+          }
+        }
+        select {
+        case w.events <- event:
+        case <-ctx.Done():
+          return
+        case <-w.closed:
+          return
+        }
+      }
+    }(sub)
+  }
+  go func() {
+    w.wg.Wait()
+    close(w.events)
+  }()
+  return w, nil
+}
+
+// Events returns the channel the notifications are delivered on, closed
+// once the watch ends
+func (w *KeyspaceWatch) Events() <-chan KeyEvent {
+  return w.events
+}
+
+// Close ends the watch
+func (w *KeyspaceWatch) Close() error {
+  w.closeOnce.Do(func() {
+    close(w.closed)
+    for _, sub := range w.subs {
+      sub.Close()
+    }
+  })
+  return nil
+}
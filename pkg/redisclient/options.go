@@ -0,0 +1,152 @@
+package redisclient
+
+import (
+  "context"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/cenkalti/backoff/v4"
+  "github.com/go-redis/redis/v8"
+)
+
+// defaultOperationTimeout bounds each attempt of a wrapped operation
+const defaultOperationTimeout = 100 * time.Millisecond
+
+// defaultOperationTimeouts are the per-operation exceptions to
+// defaultOperationTimeout
+var defaultOperationTimeouts = map[string]time.Duration{
+  "publish": 50 * time.Millisecond,
+}
+
+// defaultOperationRetries is how often a failed write is retried
+const defaultOperationRetries = 3
+
+// PoolConfig holds the connection pool, timeout and retry settings of a
+// Client. The pool settings apply to each node of a Cluster.
+type PoolConfig struct {
+  PoolSize     int
+  MinIdleConns int
+  // MaxRetries is how often go-redis retries a command on a network error
+  MaxRetries   int
+  DialTimeout  time.Duration
+  ReadTimeout  time.Duration
+  WriteTimeout time.Duration
+  IdleTimeout  time.Duration
+
+  // OperationTimeout bounds each attempt of the operations Client wraps,
+  // such as AddToStream, when the caller's context has no deadline of its
+  // own. Zero keeps the built-in timeouts: 100ms, and 50ms for publish.
+  OperationTimeout time.Duration
+  // OperationTimeouts overrides OperationTimeout per operation, keyed by
+  // the operation label of the Redis metrics (xadd, publish, hset, xack)
+  OperationTimeouts map[string]time.Duration
+  // OperationRetries is how often a failed write is retried with
+  // exponential backoff. Zero keeps the default of 3; a negative value
+  // disables retries.
+  OperationRetries int
+  // ScanCount is the COUNT hint of the SCAN family iterators, trading round
+  // trips against the time Redis spends per call. Zero keeps the default
+  // of 500.
+  ScanCount int
+}
+
+// NewPoolConfig reads the pool configuration from environment variables
+func NewPoolConfig() PoolConfig {
+  return PoolConfig{
+    PoolSize:          getEnvIntOrDefault("REDIS_POOL_SIZE", 20),
+    MinIdleConns:      getEnvIntOrDefault("REDIS_MIN_IDLE_CONNS", 5),
+    MaxRetries:        getEnvIntOrDefault("REDIS_MAX_RETRIES", 3),
+    DialTimeout:       getEnvDurationOrDefault("REDIS_DIAL_TIMEOUT", 5*time.Second),
+    ReadTimeout:       getEnvDurationOrDefault("REDIS_READ_TIMEOUT", 3*time.Second),
+    WriteTimeout:      getEnvDurationOrDefault("REDIS_WRITE_TIMEOUT", 3*time.Second),
+    IdleTimeout:       getEnvDurationOrDefault("REDIS_IDLE_TIMEOUT", 5*time.Minute),
+    OperationTimeout:  getEnvDurationOrDefault("REDIS_OP_TIMEOUT", 0),
+    OperationTimeouts: parseOperationTimeouts(os.Getenv("REDIS_OP_TIMEOUTS")),
+    OperationRetries:  getEnvIntOrDefault("REDIS_OP_RETRIES", 0),
+    ScanCount:         getEnvIntOrDefault("REDIS_SCAN_COUNT", 0),
+  }
+}
+
+// parseOperationTimeouts parses "operation=duration" pairs, skipping
+// malformed ones
+func parseOperationTimeouts(s string) map[string]time.Duration {
+  timeouts := make(map[string]time.Duration)
+  for _, pair := range strings.Split(s, ",") {
+    operation, value, ok := strings.Cut(pair, "=")
+    if !ok {
+      continue
+    }
+    timeout, err := time.ParseDuration(strings.TrimSpace(value))
+    if err != nil || timeout <= 0 {
+      continue
+    }
+    timeouts[strings.ToLower(strings.TrimSpace(operation))] = timeout
+  }
+  return timeouts
+}
+
+// apply sets the pool settings of opt
+func (p PoolConfig) apply(opt *redis.UniversalOptions) {
+  opt.PoolSize = p.PoolSize
+  opt.MinIdleConns = p.MinIdleConns
+  opt.MaxRetries = p.MaxRetries
+  opt.DialTimeout = p.DialTimeout
+  opt.ReadTimeout = p.ReadTimeout
+  opt.WriteTimeout = p.WriteTimeout
+  opt.IdleTimeout = p.IdleTimeout
+}
+
+// attemptContext bounds one attempt of operation. A deadline set by the
+// caller is honored as it is, so a caller such as a backfill can allow more
+// time than the defaults; only a ctx without one gets the operation's
+// timeout.
+func (c *Client) attemptContext(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+  if _, ok := ctx.Deadline(); ok {
+    return context.WithCancel(ctx)
+  }
+  return context.WithTimeout(ctx, c.timeout(operation))
+}
+
+// timeout returns the deadline of one attempt of operation when the caller
+// sets none
+func (c *Client) timeout(operation string) time.Duration {
+  if timeout, ok := c.pool.OperationTimeouts[operation]; ok {
+    return timeout
+  }
+  if c.pool.OperationTimeout > 0 {
+    return c.pool.OperationTimeout
+  }
+  if timeout, ok := defaultOperationTimeouts[operation]; ok {
+    return timeout
+  }
+  return defaultOperationTimeout
+}
+
+// retryPolicy returns the backoff retrying a failed write until ctx is done
+func (c *Client) retryPolicy(ctx context.Context) backoff.BackOff {
+  retries := c.pool.OperationRetries
+  if retries == 0 {
+    retries = defaultOperationRetries
+  }
+  return backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(max(retries, 0))), ctx)
+}
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+  if value := os.Getenv(key); value != "" {
+    if parsed, err := strconv.Atoi(value); err == nil {
+      return parsed
+    }
+  }
+  return defaultValue
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+  if value := os.Getenv(key); value != "" {
+    if parsed, err := time.ParseDuration(value); err == nil {
+      return parsed
+    }
+  }
+  return defaultValue
+}
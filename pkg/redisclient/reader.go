@@ -0,0 +1,332 @@
+package redisclient
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "github.com/go-redis/redis/v8"
+  "go.uber.org/zap"
+)
+
+// StreamEntry is a stream entry decoded by a StreamReader
+type StreamEntry[T any] struct {
+  ID     string
+  Value  T
+  Values map[string]interface{}
+}
+
+// permanentError marks a handler error retrying cannot fix
+type permanentError struct {
+  err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err, returned by a RunEach handler, as one retrying the
+// entry cannot fix, such as a tick for an unknown symbol. The entry is sent
+// to the dead-letter stream instead of being redelivered.
+func Permanent(err error) error {
+  return &permanentError{err: err}
+}
+
+// StreamReaderConfig configures a StreamReader
+type StreamReaderConfig[T any] struct {
+  Stream   string
+  Group    string
+  Consumer string
+  // Start is where the group starts reading if it does not exist yet: "0"
+  // for the whole stream, "$" (the default) for entries added from now on
+  Start string
+  // Count is the most entries read at once; 100 by default
+  Count int64
+  // Block is how long a read waits for new entries; 1s by default
+  Block time.Duration
+  // RetryBackoff is how long to wait before redelivering entries a handler
+  // failed on; 1s by default
+  RetryBackoff time.Duration
+  // ClaimIdle is how long an entry may stay pending, delivered to a
+  // consumer that neither acknowledged nor retried it, before this consumer
+  // claims it, e.g. from a replica that died. Zero keeps the default of 1m;
+  // a negative value disables claiming.
+  ClaimIdle time.Duration
+  // MaxDeliveries is how often an entry is delivered before it is sent to
+  // DeadLetterStream as a poison pill, so an entry its handler always fails
+  // on does not block the consumer. Zero keeps the default of 5; a negative
+  // value retries for ever, for handlers whose failures are outages rather
+  // than bad entries.
+  MaxDeliveries int64
+  // FromMap decodes the values of an entry. Entries it rejects are sent to
+  // DeadLetterStream and acknowledged.
+  FromMap func(map[string]interface{}) (T, error)
+  // DeadLetterStream receives the entries that cannot be handled, with
+  // their values and the source_stream, source_id and error fields added.
+  // Empty drops them after logging.
+  DeadLetterStream string
+}
+
+// StreamReader reads a stream as a member of a consumer group, decodes its
+// entries and acknowledges them once handled, so entries a consumer crashed
+// or failed on are redelivered; delivery is at least once. It claims the
+// entries left pending by other consumers, dead-letters entries delivered
+// too often, and exports how many entries were handled, reclaimed,
+// dead-lettered and failed, and how far behind the stream the consumer is.
+type StreamReader[T any] struct {
+  c   *Client
+  cfg StreamReaderConfig[T]
+}
+
+// NewStreamReader creates a reader of cfg.Stream, filling in defaults
+func NewStreamReader[T any](c *Client, cfg StreamReaderConfig[T]) *StreamReader[T] {
+  if cfg.Start == "" {
+    cfg.Start = "$"
+  }
+  if cfg.Count <= 0 {
+    cfg.Count = 100
+  }
+  if cfg.Block <= 0 {
+    cfg.Block = time.Second
+  }
+  if cfg.RetryBackoff <= 0 {
+    cfg.RetryBackoff = time.Second
+  }
+  if cfg.ClaimIdle == 0 {
+    cfg.ClaimIdle = time.Minute
+  }
+  if cfg.MaxDeliveries == 0 {
+    cfg.MaxDeliveries = 5
+  }
+  return &StreamReader[T]{c: c, cfg: cfg}
+}
+
+// Run reads batches of entries and passes the decoded ones to handle until
+// ctx is done, acknowledging a batch once handle returns nil. If handle
+// fails, the whole batch is redelivered after RetryBackoff, so handle must
+// tolerate seeing entries again. It fails only if the group cannot be
+// created.
+func (r *StreamReader[T]) Run(ctx context.Context, handle func(ctx context.Context, entries []StreamEntry[T]) error) error {
+  cfg := r.cfg
+  if err := r.c.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, cfg.Start); err != nil {
+    return err
+  }
+  logger.Log.Info("stream reader started",
+    zap.String("stream", cfg.Stream), zap.String("group", cfg.Group), zap.String("consumer", cfg.Consumer))
+
+  // Start with entries delivered to this consumer but never acknowledged
+  lastID := "0"
+  var lastClaim time.Time
+  for ctx.Err() == nil {
+    if cfg.ClaimIdle > 0 && time.Since(lastClaim) >= cfg.ClaimIdle {
+      lastClaim = time.Now()
+      if err := r.claim(ctx, handle); err != nil && ctx.Err() == nil {
+        logger.Log.Error("failed to handle claimed stream entries, retrying",
+          zap.String("stream", cfg.Stream), zap.String("group", cfg.Group), zap.Error(err))
+        // The claimed entries are now this consumer's pending ones
+        lastID = "0"
+        r.sleep(ctx, cfg.RetryBackoff)
+        continue
+      }
+    }
+
+    res, err := r.c.XReadGroup(ctx, &redis.XReadGroupArgs{
+      Group:    cfg.Group,
+      Consumer: cfg.Consumer,
+      Streams:  []string{cfg.Stream, lastID},
+      Count:    cfg.Count,
+      Block:    cfg.Block,
+    })
+    if err != nil {
+      if ctx.Err() == nil {
+        logger.Log.Warn("XREADGROUP error", zap.String("stream", cfg.Stream), zap.Error(err))
+        r.sleep(ctx, 200*time.Millisecond)
+      }
+      continue
+    }
+
+    if len(res) == 0 || len(res[0].Messages) == 0 {
+      if lastID == ">" {
+        metrics.RedisStreamReaderLag.WithLabelValues(cfg.Stream, cfg.Group).Set(0)
+      }
+      // Pending entries drained; switch to new ones
+      lastID = ">"
+      continue
+    }
+
+    msgs := res[0].Messages
+    if err := r.process(ctx, msgs, lastID != ">", handle); err != nil {
+      if ctx.Err() != nil {
+        continue
+      }
+      logger.Log.Error("failed to handle stream entries, retrying",
+        zap.String("stream", cfg.Stream), zap.String("group", cfg.Group), zap.Error(err))
+      metrics.RedisStreamReaderEntries.WithLabelValues(cfg.Stream, cfg.Group, "failed").Add(float64(len(msgs)))
+      // Re-read the unacknowledged entries after a pause
+      lastID = "0"
+      r.sleep(ctx, cfg.RetryBackoff)
+      continue
+    }
+    metrics.RedisStreamReaderLag.WithLabelValues(cfg.Stream, cfg.Group).Set(entryAge(msgs[len(msgs)-1].ID).Seconds())
+  }
+  logger.Log.Info("stream reader stopped", zap.String("stream", cfg.Stream), zap.String("group", cfg.Group))
+  return nil
+}
+
+// RunEach is Run handling one entry at a time. An entry handle fails on
+// with a Permanent error is sent to the dead-letter stream; any other error
+// redelivers the rest of the batch and the entries before it.
+func (r *StreamReader[T]) RunEach(ctx context.Context, handle func(ctx context.Context, entry StreamEntry[T]) error) error {
+  return r.Run(ctx, func(ctx context.Context, entries []StreamEntry[T]) error {
+    for _, entry := range entries {
+      err := handle(ctx, entry)
+      var permanent *permanentError
+      if errors.As(err, &permanent) {
+        if err := r.deadLetter(ctx, entry.ID, entry.Values, permanent.err); err != nil {
+          return err
+        }
+        continue
+      }
+      if err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+}
+
+// claim takes over the entries pending for longer than ClaimIdle and
+// processes them
+func (r *StreamReader[T]) claim(ctx context.Context, handle func(ctx context.Context, entries []StreamEntry[T]) error) error {
+  start := "0-0"
+  for {
+    msgs, next, err := r.c.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+      Stream:   r.cfg.Stream,
+      Group:    r.cfg.Group,
+      MinIdle:  r.cfg.ClaimIdle,
+      Start:    start,
+      Count:    r.cfg.Count,
+      Consumer: r.cfg.Consumer,
+    })
+    if err != nil {
+      return err
+    }
+    if len(msgs) > 0 {
+      logger.Log.Info("claimed idle stream entries",
+        zap.String("stream", r.cfg.Stream), zap.String("group", r.cfg.Group), zap.Int("entries", len(msgs)))
+      metrics.RedisStreamReaderEntries.WithLabelValues(r.cfg.Stream, r.cfg.Group, "reclaimed").Add(float64(len(msgs)))
+      if err := r.process(ctx, msgs, true, handle); err != nil {
+        return err
+      }
+    }
+    if next == "" || next == "0-0" {
+      return nil
+    }
+    start = next
+  }
+}
+
+// deliveries returns how often each of msgs, entries pending for this
+// consumer, has been delivered
+func (r *StreamReader[T]) deliveries(ctx context.Context, msgs []redis.XMessage) (map[string]int64, error) {
+  pending, err := r.c.XPendingExt(ctx, &redis.XPendingExtArgs{
+    Stream:   r.cfg.Stream,
+    Group:    r.cfg.Group,
+    Start:    msgs[0].ID,
+    End:      msgs[len(msgs)-1].ID,
+    Count:    int64(len(msgs)),
+    Consumer: r.cfg.Consumer,
+  })
+  if err != nil {
+    return nil, err
+  }
+  counts := make(map[string]int64, len(pending))
+  for _, p := range pending {
+    counts[p.ID] = p.RetryCount
+  }
+  return counts, nil
+}
+
+// process decodes msgs, dead-letters the ones that fail to decode and, if
+// they are redelivered, the ones delivered more than MaxDeliveries times,
+// hands the rest to handle and acknowledges them all
+func (r *StreamReader[T]) process(ctx context.Context, msgs []redis.XMessage, redelivered bool, handle func(ctx context.Context, entries []StreamEntry[T]) error) error {
+  var counts map[string]int64
+  if redelivered && r.cfg.MaxDeliveries > 0 {
+    var err error
+    if counts, err = r.deliveries(ctx, msgs); err != nil {
+      return err
+    }
+  }
+
+  entries := make([]StreamEntry[T], 0, len(msgs))
+  for _, msg := range msgs {
+    if n := counts[msg.ID]; n > r.cfg.MaxDeliveries {
+      if err := r.deadLetter(ctx, msg.ID, msg.Values, fmt.Errorf("delivered %d times without being handled", n)); err != nil {
+        return err
+      }
+      continue
+    }
+    value, err := r.cfg.FromMap(msg.Values)
+    if err != nil {
+      if err := r.deadLetter(ctx, msg.ID, msg.Values, err); err != nil {
+        return err
+      }
+      continue
+    }
+    entries = append(entries, StreamEntry[T]{ID: msg.ID, Value: value, Values: msg.Values})
+  }
+
+  if len(entries) > 0 {
+    if err := handle(ctx, entries); err != nil {
+      return err
+    }
+  }
+  metrics.RedisStreamReaderEntries.WithLabelValues(r.cfg.Stream, r.cfg.Group, "handled").Add(float64(len(entries)))
+
+  ids := make([]string, len(msgs))
+  for i, msg := range msgs {
+    ids[i] = msg.ID
+  }
+  return r.c.XAck(ctx, r.cfg.Stream, r.cfg.Group, ids...)
+}
+
+// deadLetter records an entry that cannot be handled
+func (r *StreamReader[T]) deadLetter(ctx context.Context, id string, values map[string]interface{}, cause error) error {
+  logger.Log.Warn("dead-lettering stream entry",
+    zap.String("stream", r.cfg.Stream), zap.String("id", id), zap.Error(cause))
+  metrics.RedisStreamReaderEntries.WithLabelValues(r.cfg.Stream, r.cfg.Group, "dead_letter").Inc()
+  if r.cfg.DeadLetterStream == "" {
+    return nil
+  }
+
+  dead := make(map[string]interface{}, len(values)+3)
+  for field, value := range values {
+    dead[field] = value
+  }
+  dead["source_stream"] = r.cfg.Stream
+  dead["source_id"] = id
+  dead["error"] = cause.Error()
+  return r.c.AddToStream(ctx, r.cfg.DeadLetterStream, dead)
+}
+
+// sleep waits for d or until ctx is done
+func (r *StreamReader[T]) sleep(ctx context.Context, d time.Duration) {
+  select {
+  case <-ctx.Done():
+  case <-time.After(d):
+  }
+}
+
+// entryAge returns how long ago the entry with the given ID was added
+func entryAge(id string) time.Duration {
+  ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+  if err != nil {
+    return 0
+  }
+  return time.Since(time.UnixMilli(ms))
+}
@@ -3,14 +3,13 @@ package redisclient
 import (
   "context"
   "time"
-  "sync/atomic"
   "errors"
+  "fmt"
+  "strings"
 
   "github.com/go-redis/redis/v8"
   "github.com/cenkalti/backoff/v4"
   "github.com/alim08/fin_line/pkg/metrics"
-  "github.com/alim08/fin_line/pkg/logger"
-  "go.uber.org/zap"
 )
 
 var (
@@ -19,29 +18,44 @@ var (
 )
 
 type Client struct {
-  rdb *redis.Client
+  rdb      redis.UniversalClient
+  topology Topology
+  db       int
+  pool     PoolConfig
+  breaker  BreakerConfig
+  // cache holds latest-quote hashes once StartClientCache ran
+  cache *trackedCache
   // Circuit breaker state
-  failureCount int64
-  lastFailure  int64
-  state        int32 // 0: closed, 1: open, 2: half-open
+  failureCount   int64
+  lastFailure    int64
+  state          int32 // 0: closed, 1: open, 2: half-open
+  openedAt       int64 // when the breaker last opened or turned half-open, in ns
+  probes         int64 // operations let through while half-open
+  probeSuccesses int64
 }
 
-// New constructs a Client with sensible defaults & retry logic
+// New constructs a Client with sensible defaults & retry logic. redisURL
+// also selects a Cluster or Sentinel deployment, see ParseURL. Credentials
+// and TLS certificates kept out of the URL, and the pool, timeout and retry
+// settings, are read as NewSecurityConfig and NewPoolConfig describe.
 func New(redisURL string) *Client {
-  opt, err := redis.ParseURL(redisURL)
+  topology, opt, err := ParseURL(redisURL)
   if err != nil {
     panic("invalid REDIS_URL: " + err.Error())
   }
-  // Tune PoolSize to number of CPU cores × factor
-  opt.PoolSize = 20
-  opt.MinIdleConns = 5
-  opt.MaxRetries = 3
-  opt.DialTimeout = 5 * time.Second
-  opt.ReadTimeout = 3 * time.Second
-  opt.WriteTimeout = 3 * time.Second
-  opt.IdleTimeout = 5 * time.Minute
-  rdb := redis.NewClient(opt)
-  return &Client{rdb: rdb}
+  if err := NewSecurityConfig().apply(opt); err != nil {
+    panic("invalid Redis security configuration: " + err.Error())
+  }
+  pool := NewPoolConfig()
+  pool.apply(opt)
+  rdb := newUniversalClient(topology, opt)
+  return &Client{rdb: rdb, topology: topology, db: opt.DB, pool: pool, breaker: NewBreakerConfig()}
+}
+
+// NewFromClient wraps an existing go-redis client, such as a redismock one
+// in the tests of other packages, with the default breaker settings
+func NewFromClient(rdb redis.UniversalClient) *Client {
+  return &Client{rdb: rdb, breaker: NewBreakerConfig()}
 }
 
 // withMetrics wraps operations with metrics collection
@@ -66,35 +80,17 @@ func getStatus(err error) string {
   return "success"
 }
 
-// checkCircuitBreaker checks if circuit breaker should be opened/closed
-func (c *Client) checkCircuitBreaker(err error) {
-  if err != nil {
-    atomic.AddInt64(&c.failureCount, 1)
-    atomic.StoreInt64(&c.lastFailure, time.Now().Unix())
-    
-    // Open circuit breaker after 5 consecutive failures
-    if atomic.LoadInt64(&c.failureCount) >= 5 {
-      atomic.CompareAndSwapInt32(&c.state, 0, 1) // closed -> open
-      logger.Log.Warn("circuit breaker opened", zap.String("operation", "redis"))
-    }
-  } else {
-    // Reset failure count on success
-    atomic.StoreInt64(&c.failureCount, 0)
-    atomic.CompareAndSwapInt32(&c.state, 1, 2) // open -> half-open
-  }
-}
-
 // AddToStream appends into a Redis Stream with retry/backoff
 func (c *Client) AddToStream(ctx context.Context, stream string, values map[string]interface{}) error {
   return c.withMetrics("xadd", func() error {
     // Check circuit breaker
-    if atomic.LoadInt32(&c.state) == 1 {
+    if !c.allowRequest() {
       return ErrCircuitBreakerOpen
     }
     
     op := func() error {
-      // 100ms timeout per attempt
-      ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+      // Bound each attempt, unless the caller already does
+      ctx, cancel := c.attemptContext(ctx, "xadd")
       defer cancel()
       _, err := c.rdb.XAdd(ctx, &redis.XAddArgs{
         Stream: stream,
@@ -104,8 +100,8 @@ func (c *Client) AddToStream(ctx context.Context, stream string, values map[stri
       c.checkCircuitBreaker(err)
       return err
     }
-    // exponential backoff: max 3 retries
-    return backoff.Retry(op, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
+    // exponential backoff: max 3 retries by default
+    return backoff.Retry(op, c.retryPolicy(ctx))
   })
 }
 
@@ -114,14 +110,172 @@ func (c *Client) XRead(ctx context.Context, args *redis.XReadArgs) *redis.XStrea
   return c.rdb.XRead(ctx, args)
 }
 
-// Publish wraps rdb.Publish with a short timeout
+// streamOp runs a stream command with metrics and the circuit
+// breaker. redis.Nil, returned when a blocking read times out empty, and a
+// cancelled ctx are not failures.
+func (c *Client) streamOp(ctx context.Context, operation string, fn func() error) error {
+  return c.withMetrics(operation, func() error {
+    if !c.allowRequest() {
+      return ErrCircuitBreakerOpen
+    }
+
+    err := fn()
+    if err == redis.Nil {
+      err = nil
+    }
+    if ctx.Err() == nil {
+      c.checkCircuitBreaker(err)
+    }
+    return err
+  })
+}
+
+// XGroupCreateMkStream creates a consumer group on stream, and the stream if
+// it does not exist, delivering entries after start. An existing group is
+// left as it is.
+func (c *Client) XGroupCreateMkStream(ctx context.Context, stream, group, start string) error {
+  return c.streamOp(ctx, "xgroup_create", func() error {
+    err := c.rdb.XGroupCreateMkStream(ctx, stream, group, start).Err()
+    if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+      return nil
+    }
+    return err
+  })
+}
+
+// XReadGroup reads entries for a consumer of a group. A blocking read that
+// times out returns no streams and no error.
+func (c *Client) XReadGroup(ctx context.Context, args *redis.XReadGroupArgs) ([]redis.XStream, error) {
+  var streams []redis.XStream
+  err := c.streamOp(ctx, "xreadgroup", func() error {
+    var err error
+    streams, err = c.rdb.XReadGroup(ctx, args).Result()
+    return err
+  })
+  return streams, err
+}
+
+// XAck acknowledges entries of a group with retry
+func (c *Client) XAck(ctx context.Context, stream, group string, ids ...string) error {
+  if len(ids) == 0 {
+    return nil
+  }
+  return c.streamOp(ctx, "xack", func() error {
+    op := func() error {
+      ctx, cancel := c.attemptContext(ctx, "xack")
+      defer cancel()
+      return c.rdb.XAck(ctx, stream, group, ids...).Err()
+    }
+    return backoff.Retry(op, c.retryPolicy(ctx))
+  })
+}
+
+// XPending summarises the entries of a group delivered but not yet
+// acknowledged
+func (c *Client) XPending(ctx context.Context, stream, group string) (*redis.XPending, error) {
+  var pending *redis.XPending
+  err := c.streamOp(ctx, "xpending", func() error {
+    var err error
+    pending, err = c.rdb.XPending(ctx, stream, group).Result()
+    return err
+  })
+  return pending, err
+}
+
+// XPendingExt lists the entries of a group delivered but not yet
+// acknowledged, with how often each was delivered
+func (c *Client) XPendingExt(ctx context.Context, args *redis.XPendingExtArgs) ([]redis.XPendingExt, error) {
+  var pending []redis.XPendingExt
+  err := c.streamOp(ctx, "xpending", func() error {
+    var err error
+    pending, err = c.rdb.XPendingExt(ctx, args).Result()
+    return err
+  })
+  return pending, err
+}
+
+// XAutoClaim transfers entries pending for longer than args.MinIdle to
+// args.Consumer, such as those of a consumer that died. It returns the
+// claimed entries and the ID to resume the scan from, "0-0" once every
+// pending entry has been scanned. It needs Redis 6.2.
+func (c *Client) XAutoClaim(ctx context.Context, args *redis.XAutoClaimArgs) ([]redis.XMessage, string, error) {
+  // go-redis v8 only parses the two element reply of Redis 6.2; Redis 7
+  // appends the IDs of deleted entries, so the reply is parsed here
+  cmd := []interface{}{"XAUTOCLAIM", args.Stream, args.Group, args.Consumer, args.MinIdle.Milliseconds(), args.Start}
+  if args.Count > 0 {
+    cmd = append(cmd, "COUNT", args.Count)
+  }
+
+  var msgs []redis.XMessage
+  var next string
+  err := c.streamOp(ctx, "xautoclaim", func() error {
+    reply, err := c.rdb.Do(ctx, cmd...).Slice()
+    if err != nil {
+      return err
+    }
+    msgs, next, err = parseXAutoClaim(reply)
+    return err
+  })
+  return msgs, next, err
+}
+
+// parseXAutoClaim decodes an XAUTOCLAIM reply: the next start ID, the
+// claimed entries and, from Redis 7, the IDs of pending entries no longer
+// in the stream. Redis 6.2 reports those as nil entries, which are skipped.
+func parseXAutoClaim(reply []interface{}) ([]redis.XMessage, string, error) {
+  if len(reply) < 2 {
+    return nil, "", fmt.Errorf("unexpected XAUTOCLAIM reply %v", reply)
+  }
+  next, ok := reply[0].(string)
+  if !ok {
+    return nil, "", fmt.Errorf("unexpected XAUTOCLAIM start ID %v", reply[0])
+  }
+  entries, ok := reply[1].([]interface{})
+  if !ok {
+    return nil, "", fmt.Errorf("unexpected XAUTOCLAIM entries %v", reply[1])
+  }
+
+  msgs := make([]redis.XMessage, 0, len(entries))
+  for _, item := range entries {
+    if item == nil {
+      continue
+    }
+    entry, ok := item.([]interface{})
+    if !ok || len(entry) != 2 {
+      return nil, "", fmt.Errorf("unexpected XAUTOCLAIM entry %v", item)
+    }
+    id, ok := entry[0].(string)
+    if !ok {
+      return nil, "", fmt.Errorf("unexpected XAUTOCLAIM entry ID %v", entry[0])
+    }
+    if entry[1] == nil {
+      continue
+    }
+    fields, ok := entry[1].([]interface{})
+    if !ok || len(fields)%2 != 0 {
+      return nil, "", fmt.Errorf("unexpected XAUTOCLAIM fields %v", entry[1])
+    }
+    values := make(map[string]interface{}, len(fields)/2)
+    for i := 0; i < len(fields); i += 2 {
+      field, ok := fields[i].(string)
+      if !ok {
+        return nil, "", fmt.Errorf("unexpected XAUTOCLAIM field %v", fields[i])
+      }
+      values[field] = fields[i+1]
+    }
+    msgs = append(msgs, redis.XMessage{ID: id, Values: values})
+  }
+  return msgs, next, nil
+}
+
+// Publish wraps rdb.Publish with a short timeout unless ctx has a deadline
 func (c *Client) Publish(ctx context.Context, channel string, msg interface{}) error {
   return c.withMetrics("publish", func() error {
-    if atomic.LoadInt32(&c.state) == 1 {
+    if !c.allowRequest() {
       return ErrCircuitBreakerOpen
     }
     
-    ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+    ctx, cancel := c.attemptContext(ctx, "publish")
     defer cancel()
     err := c.rdb.Publish(ctx, channel, msg).Err()
     c.checkCircuitBreaker(err)
@@ -132,19 +286,19 @@ func (c *Client) Publish(ctx context.Context, channel string, msg interface{}) e
 // HSet sets a hash with retry
 func (c *Client) HSet(ctx context.Context, key string, values map[string]interface{}) error {
   return c.withMetrics("hset", func() error {
-    if atomic.LoadInt32(&c.state) == 1 {
+    if !c.allowRequest() {
       return ErrCircuitBreakerOpen
     }
     
     // same pattern as AddToStream
     op := func() error {
-      ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+      ctx, cancel := c.attemptContext(ctx, "hset")
       defer cancel()
       err := c.rdb.HSet(ctx, key, values).Err()
       c.checkCircuitBreaker(err)
       return err
     }
-    return backoff.Retry(op, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
+    return backoff.Retry(op, c.retryPolicy(ctx))
   })
 }
 
@@ -163,8 +317,9 @@ func (c *Client) Close() error {
   return c.rdb.Close()
 }
 
-// Client returns the underlying Redis client for direct access
-func (c *Client) Client() *redis.Client {
+// Client returns the underlying Redis client for direct access: a
+// *redis.ClusterClient on a Cluster, a *redis.Client otherwise
+func (c *Client) Client() redis.UniversalClient {
   return c.rdb
 }
 
@@ -2,10 +2,19 @@ package redisclient
 
 import (
     "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
     "testing"
+    "time"
 
+    "github.com/alim08/fin_line/pkg/logger"
+    "github.com/alim08/fin_line/pkg/models"
     "github.com/go-redis/redis/v8"
     redismock "github.com/go-redis/redismock/v8"
+    "go.uber.org/zap"
 )
 
 // TestAddToStream_Success verifies that AddToStream writes to the Redis Stream on first attempt.
@@ -47,3 +56,750 @@ func TestAddToStream_RetryOnError(t *testing.T) {
         t.Errorf("unfulfilled expectations: %v", err)
     }
 }
+
+// TestXGroupCreateMkStream_ExistingGroup ensures an existing group is not an error.
+func TestXGroupCreateMkStream_ExistingGroup(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    mock.ExpectXGroupCreateMkStream("s", "g", "0").SetErr(errors.New("BUSYGROUP Consumer Group name already exists"))
+
+    if err := client.XGroupCreateMkStream(context.Background(), "s", "g", "0"); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestXReadGroup_TimeoutIsEmpty ensures a blocking read that times out is neither an error nor a breaker failure.
+func TestXReadGroup_TimeoutIsEmpty(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    args := &redis.XReadGroupArgs{Group: "g", Consumer: "c", Streams: []string{"s", ">"}, Count: 10}
+    mock.ExpectXReadGroup(args).RedisNil()
+
+    streams, err := client.XReadGroup(context.Background(), args)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(streams) != 0 {
+        t.Errorf("expected no streams, got %d", len(streams))
+    }
+    if client.failureCount != 0 {
+        t.Errorf("expected no breaker failures, got %d", client.failureCount)
+    }
+}
+
+// TestParseURL_Topologies verifies cluster and sentinel URLs select their topology and options.
+func TestParseURL_Topologies(t *testing.T) {
+    topology, opt, err := ParseURL("redis+cluster://:secret@node1:7000,node2?read_only=true")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if topology != TopologyCluster || len(opt.Addrs) != 2 || opt.Addrs[1] != "node2:6379" || opt.Password != "secret" || !opt.ReadOnly {
+        t.Errorf("unexpected cluster options: %s %+v", topology, opt)
+    }
+
+    topology, opt, err = ParseURL("rediss+sentinel://s1:26379,s2:26379/mymaster/2?sentinel_password=pw")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if topology != TopologySentinel || opt.MasterName != "mymaster" || opt.DB != 2 || opt.SentinelPassword != "pw" || opt.TLSConfig == nil {
+        t.Errorf("unexpected sentinel options: %s %+v", topology, opt)
+    }
+
+    for _, bad := range []string{"redis+sentinel://s1:26379", "redis+cluster://node1/3", "redis+cluster://node1?db=1", "memcached://host"} {
+        if _, _, err := ParseURL(bad); err == nil {
+            t.Errorf("expected error for %q", bad)
+        }
+    }
+}
+
+// TestKeySlot_HashTag verifies slots match Redis Cluster and honour hash tags.
+func TestKeySlot_HashTag(t *testing.T) {
+    if slot := KeySlot("foo"); slot != 12182 {
+        t.Errorf("expected slot 12182 for foo, got %d", slot)
+    }
+    if !SameSlot("quota:"+HashTag("u1")+":d:20240101", "quota:"+HashTag("u1")+":m:202401") {
+        t.Error("expected keys with the same hash tag to share a slot")
+    }
+    if KeySlot("{}foo") == KeySlot("{}bar") {
+        t.Error("expected an empty hash tag to be ignored")
+    }
+}
+
+// TestSecurityConfig_Apply verifies secret file credentials and that TLS settings require a rediss URL.
+func TestSecurityConfig_Apply(t *testing.T) {
+    passwordFile := filepath.Join(t.TempDir(), "password")
+    if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    _, opt, err := ParseURL("rediss://redis.internal:6380")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    security := SecurityConfig{Username: "app", PasswordFile: passwordFile, ServerName: "redis.example.com"}
+    if err := security.apply(opt); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if opt.Username != "app" || opt.Password != "s3cret" || opt.TLSConfig.ServerName != "redis.example.com" {
+        t.Errorf("unexpected options: %+v", opt)
+    }
+
+    _, opt, _ = ParseURL("redis://redis.internal:6379")
+    if err := security.apply(opt); err == nil {
+        t.Error("expected TLS settings on a redis:// URL to be rejected")
+    }
+}
+
+// TestTimeout_Overrides verifies per-operation timeouts take precedence over the global one and the defaults.
+func TestTimeout_Overrides(t *testing.T) {
+    client := &Client{}
+    if got := client.timeout("publish"); got != 50*time.Millisecond {
+        t.Errorf("expected default publish timeout of 50ms, got %v", got)
+    }
+
+    client.pool = PoolConfig{
+        OperationTimeout:  time.Second,
+        OperationTimeouts: parseOperationTimeouts("XADD=2s, hset=bogus, publish"),
+    }
+    if got := client.timeout("xadd"); got != 2*time.Second {
+        t.Errorf("expected xadd override of 2s, got %v", got)
+    }
+    if got := client.timeout("hset"); got != time.Second {
+        t.Errorf("expected malformed hset override to be skipped, got %v", got)
+    }
+    if got := client.timeout("publish"); got != time.Second {
+        t.Errorf("expected the global timeout for publish, got %v", got)
+    }
+}
+
+// TestCircuitBreaker_ProbesAndCloses verifies the breaker opens, probes after its cooldown and closes again.
+func TestCircuitBreaker_ProbesAndCloses(t *testing.T) {
+    logger.Log = zap.NewNop()
+    client := &Client{breaker: BreakerConfig{FailureThreshold: 2, Cooldown: 20 * time.Millisecond, HalfOpenProbes: 1}}
+
+    client.checkCircuitBreaker(errors.New("down"))
+    client.checkCircuitBreaker(errors.New("down"))
+    if client.allowRequest() {
+        t.Fatal("expected the breaker to open after 2 failures")
+    }
+
+    time.Sleep(30 * time.Millisecond)
+    if !client.allowRequest() {
+        t.Fatal("expected a probe after the cooldown")
+    }
+    if client.allowRequest() {
+        t.Fatal("expected a single probe while half-open")
+    }
+
+    // A failed probe reopens the breaker
+    client.checkCircuitBreaker(errors.New("still down"))
+    if client.allowRequest() {
+        t.Fatal("expected a failed probe to reopen the breaker")
+    }
+
+    time.Sleep(30 * time.Millisecond)
+    if !client.allowRequest() {
+        t.Fatal("expected a probe after the second cooldown")
+    }
+    client.checkCircuitBreaker(nil)
+    if !client.allowRequest() || !client.allowRequest() {
+        t.Fatal("expected a successful probe to close the breaker")
+    }
+}
+
+// TestParseTrimPolicies verifies count and age limits are parsed and malformed entries skipped.
+func TestParseTrimPolicies(t *testing.T) {
+    policies := parseTrimPolicies("raw:events=1000000/24h, normalized:events=72h,bad,anomalies:stream=lots")
+    if len(policies) != 2 {
+        t.Fatalf("expected 2 policies, got %+v", policies)
+    }
+    if p := policies[0]; p.Stream != "raw:events" || p.MaxLen != 1000000 || p.MaxAge != 24*time.Hour {
+        t.Errorf("unexpected policy: %+v", p)
+    }
+    if p := policies[1]; p.Stream != "normalized:events" || p.MaxLen != 0 || p.MaxAge != 72*time.Hour {
+        t.Errorf("unexpected policy: %+v", p)
+    }
+    if id := MinIDAt(time.UnixMilli(1718000000000)); id != "1718000000000-0" {
+        t.Errorf("unexpected min ID %q", id)
+    }
+}
+
+// TestTrimStream_KeepsEntriesFromFloor verifies an age trim stops at the floor and count bounds are skipped.
+func TestTrimStream_KeepsEntriesFromFloor(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    policy := TrimPolicy{Stream: "normalized:events", MaxLen: 10, MaxAge: time.Hour}
+    floor := func(ctx context.Context, stream string) (string, error) {
+        return "1000-1", nil
+    }
+
+    mock.ExpectXTrimMinIDApprox("normalized:events", "1000-1", 0).SetVal(3)
+    removed, err := client.trimStream(context.Background(), policy, floor)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if removed != 3 {
+        t.Errorf("removed = %d; want 3", removed)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestCompareStreamIDs verifies stream IDs are ordered by millisecond, then sequence.
+func TestCompareStreamIDs(t *testing.T) {
+    for _, tc := range []struct {
+        a, b string
+        want int
+    }{
+        {"1-0", "2-0", -1},
+        {"10-0", "9-5", 1},
+        {"5-2", "5-10", -1},
+        {"5-3", "5-3", 0},
+    } {
+        if got := CompareStreamIDs(tc.a, tc.b); got != tc.want {
+            t.Errorf("CompareStreamIDs(%q, %q) = %d; want %d", tc.a, tc.b, got, tc.want)
+        }
+    }
+}
+
+func TestNextStreamID(t *testing.T) {
+    for id, want := range map[string]string{
+        "5-0":  "5-1",
+        "5-41": "5-42",
+        "5":    "5-1",
+    } {
+        if got := NextStreamID(id); got != want {
+            t.Errorf("NextStreamID(%q) = %q; want %q", id, got, want)
+        }
+    }
+}
+
+// TestRunScript_NoScriptFallback verifies a script unknown to Redis is sent in full.
+func TestRunScript_NoScriptFallback(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    src := "return redis.call('INCR', KEYS[1])"
+    script := RegisterScript("test_incr", src)
+    sha := redis.NewScript(src).Hash()
+    mock.ExpectEvalSha(sha, []string{"k"}).SetErr(errors.New("NOSCRIPT No matching script"))
+    mock.ExpectEval(src, []string{"k"}).SetVal(int64(1))
+
+    result, err := client.RunScript(context.Background(), script, []string{"k"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if result != int64(1) {
+        t.Errorf("expected 1, got %v", result)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestQuoteSeries_CompactedBeyondRetention verifies that a range older than the
+// raw series' retention is read from the compacted series, in whole buckets.
+func TestQuoteSeries_CompactedBeyondRetention(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    cfg := TimeSeriesConfig{Retention: time.Hour, Bucket: time.Minute, BucketRetention: 24 * time.Hour}
+    to := time.Now().UnixMilli()
+    from := to - (2 * time.Hour).Milliseconds()
+    mock.ExpectDo("TS.RANGE", "quotes:ts:{AAPL}:60000", from, to, "AGGREGATION", "last", int64(120000)).
+        SetVal([]interface{}{[]interface{}{int64(1000), "1.5"}})
+
+    samples, err := client.QuoteSeries(context.Background(), "AAPL", from, to, 90*time.Second, cfg)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(samples) != 1 || samples[0] != (TSSample{Timestamp: 1000, Value: 1.5}) {
+        t.Errorf("unexpected samples %v", samples)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestLatestQuoteHashes_SkipsMissing verifies the hashes are read in one pipeline
+// and tickers without a cached quote are left out.
+func TestLatestQuoteHashes_SkipsMissing(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    mock.ExpectHGetAll("quotes:latest:AAPL").SetVal(map[string]string{"price": "1.5", "ts_ms": "1000"})
+    mock.ExpectHGetAll("quotes:latest:MSFT").SetVal(map[string]string{})
+
+    latest, err := client.LatestQuoteHashes(context.Background(), "AAPL", "MSFT")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(latest) != 1 || latest["AAPL"]["price"] != "1.5" {
+        t.Errorf("unexpected hashes %v", latest)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestMergeFlags verifies keyspace notification flags are added without duplicates.
+func TestMergeFlags(t *testing.T) {
+    if got := mergeFlags("Eg", "Kxg"); got != "EgKx" {
+        t.Errorf("expected EgKx, got %q", got)
+    }
+    if got := mergeFlags("", "Kx"); got != "Kx" {
+        t.Errorf("expected Kx, got %q", got)
+    }
+}
+
+// TestParseInfo verifies INFO replies are split into fields, skipping section headers.
+func TestParseInfo(t *testing.T) {
+    info := parseInfo("# Memory\r\nused_memory:1024\r\nmaxmemory:0\r\n\r\n# Stats\r\nevicted_keys:3\r\n")
+    if info["used_memory"] != "1024" || info["maxmemory"] != "0" || info["evicted_keys"] != "3" {
+        t.Errorf("unexpected fields %v", info)
+    }
+    if len(info) != 3 {
+        t.Errorf("expected 3 fields, got %d", len(info))
+    }
+}
+
+// TestStreamReader_DeadLettersUndecodable verifies an entry FromMap rejects goes
+// to the dead-letter stream, the rest to the handler, and all are acknowledged.
+func TestStreamReader_DeadLettersUndecodable(t *testing.T) {
+    logger.Log = zap.NewNop()
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    reader := NewStreamReader(client, StreamReaderConfig[string]{
+        Stream: "s",
+        Group:  "g",
+        FromMap: func(m map[string]interface{}) (string, error) {
+            v, ok := m["v"].(string)
+            if !ok {
+                return "", errors.New("missing v")
+            }
+            return v, nil
+        },
+        DeadLetterStream: "s:dlq",
+    })
+
+    // XADD sends the fields in map order; compare them as a set
+    unordered := func(expected, actual []interface{}) error {
+        fields := func(args []interface{}) map[interface{}]interface{} {
+            m := make(map[interface{}]interface{})
+            for i := 3; i+1 < len(args); i += 2 {
+                m[args[i]] = args[i+1]
+            }
+            return m
+        }
+        if len(expected) != len(actual) || !reflect.DeepEqual(fields(expected), fields(actual)) {
+            return fmt.Errorf("expected %v, got %v", expected, actual)
+        }
+        return nil
+    }
+    mock.CustomMatch(unordered).ExpectXAdd(&redis.XAddArgs{Stream: "s:dlq", Values: map[string]interface{}{
+        "source_stream": "s", "source_id": "1-0", "error": "missing v",
+    }}).SetVal("1-0")
+    mock.ExpectXAck("s", "g", "1-0", "2-0").SetVal(2)
+
+    var handled []string
+    err := reader.process(context.Background(), []redis.XMessage{
+        {ID: "1-0", Values: map[string]interface{}{}},
+        {ID: "2-0", Values: map[string]interface{}{"v": "ok"}},
+    }, false, func(ctx context.Context, entries []StreamEntry[string]) error {
+        for _, entry := range entries {
+            handled = append(handled, entry.Value)
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(handled) != 1 || handled[0] != "ok" {
+        t.Errorf("unexpected entries handled %v", handled)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestAttemptContext_HonorsCallerDeadline verifies a caller's deadline replaces the operation timeout.
+func TestAttemptContext_HonorsCallerDeadline(t *testing.T) {
+    client := &Client{}
+
+    ctx, cancel := client.attemptContext(context.Background(), "xadd")
+    deadline, ok := ctx.Deadline()
+    cancel()
+    if !ok || time.Until(deadline) > defaultOperationTimeout {
+        t.Errorf("expected the default timeout without a caller deadline, got %v", deadline)
+    }
+
+    caller, cancelCaller := context.WithTimeout(context.Background(), time.Minute)
+    defer cancelCaller()
+    ctx, cancel = client.attemptContext(caller, "xadd")
+    defer cancel()
+    if deadline, _ := ctx.Deadline(); time.Until(deadline) < 30*time.Second {
+        t.Errorf("expected the caller's deadline, got %v", deadline)
+    }
+}
+
+// TestStreamReader_DeadLettersPoisonPill verifies a redelivered entry past
+// MaxDeliveries is dead-lettered instead of handled again.
+func TestStreamReader_DeadLettersPoisonPill(t *testing.T) {
+    logger.Log = zap.NewNop()
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    reader := NewStreamReader(client, StreamReaderConfig[string]{
+        Stream:        "s",
+        Group:         "g",
+        Consumer:      "c",
+        MaxDeliveries: 2,
+        FromMap: func(m map[string]interface{}) (string, error) {
+            return "v", nil
+        },
+    })
+
+    mock.ExpectXPendingExt(&redis.XPendingExtArgs{
+        Stream: "s", Group: "g", Start: "1-0", End: "2-0", Count: 2, Consumer: "c",
+    }).SetVal([]redis.XPendingExt{{ID: "1-0", RetryCount: 3}, {ID: "2-0", RetryCount: 2}})
+    mock.ExpectXAck("s", "g", "1-0", "2-0").SetVal(2)
+
+    var handled []string
+    err := reader.process(context.Background(), []redis.XMessage{{ID: "1-0"}, {ID: "2-0"}}, true,
+        func(ctx context.Context, entries []StreamEntry[string]) error {
+            for _, entry := range entries {
+                handled = append(handled, entry.ID)
+            }
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(handled) != 1 || handled[0] != "2-0" {
+        t.Errorf("expected only 2-0 to be handled, got %v", handled)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestClientCache_ServesUntilInvalidated verifies cached hashes are served
+// without Redis until invalidated, and reads racing an invalidation are not cached.
+func TestClientCache_ServesUntilInvalidated(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    cache := &trackedCache{prefix: LatestQuoteKeyPrefix, maxEntries: 10, entries: make(map[string]map[string]string)}
+    cache.enable()
+    client := &Client{rdb: db, cache: cache}
+    ctx := context.Background()
+
+    mock.ExpectHGetAll("quotes:latest:AAPL").SetVal(map[string]string{"price": "1.5", "ts_ms": "1000"})
+    for i := 0; i < 2; i++ {
+        hash, err := client.LatestQuoteHash(ctx, "AAPL")
+        if err != nil || hash["price"] != "1.5" {
+            t.Fatalf("unexpected hash %v, error %v", hash, err)
+        }
+    }
+
+    cache.invalidate([]string{"quotes:latest:AAPL"})
+    mock.ExpectHGetAll("quotes:latest:AAPL").SetVal(map[string]string{"price": "2", "ts_ms": "2000"})
+    hash, err := client.LatestQuoteHash(ctx, "AAPL")
+    if err != nil || hash["price"] != "2" {
+        t.Fatalf("unexpected hash %v, error %v", hash, err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+
+    _, _, epoch := cache.get("quotes:latest:MSFT")
+    cache.invalidate([]string{"quotes:latest:MSFT"})
+    cache.store(epoch, "quotes:latest:MSFT", map[string]string{"price": "3"})
+    if _, ok, _ := cache.get("quotes:latest:MSFT"); ok {
+        t.Error("a read racing an invalidation was cached")
+    }
+
+    cache.disable()
+    if _, ok, _ := cache.get("quotes:latest:AAPL"); ok {
+        t.Error("a disabled cache served a read")
+    }
+}
+
+// TestAnomaliesInRange_PagesNewestFirst verifies time-range pages are read
+// with ZREVRANGEBYSCORE and decoded, skipping undecodable members.
+func TestAnomaliesInRange_PagesNewestFirst(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    a := models.Anomaly{Ticker: "AAPL", Price: 1.5, ZScore: 4.2, Timestamp: 2000}
+    mock.ExpectZRevRangeByScore("anomalies:AAPL", &redis.ZRangeBy{Min: "1000", Max: "+inf", Offset: 10, Count: 10}).
+        SetVal([]string{EncodeAnomaly(a), "not json"})
+
+    anomalies, err := client.AnomaliesInRange(context.Background(), "AAPL",
+        AnomalyRange{Since: 1000, Offset: 10, Limit: 10, NewestFirst: true})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(anomalies) != 1 || anomalies[0] != a {
+        t.Errorf("unexpected anomalies %v", anomalies)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestHScan_FollowsCursor verifies HScan pages until the cursor returns to 0
+// and stops early on ErrStopScan.
+func TestHScan_FollowsCursor(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db, pool: PoolConfig{ScanCount: 2}}
+
+    mock.ExpectHScan("reference:tickers", 0, "", 2).SetVal([]string{"AAPL", "Tech", "MSFT", "Tech"}, 7)
+    mock.ExpectHScan("reference:tickers", 7, "", 2).SetVal([]string{"XOM", "Energy"}, 0)
+
+    fields := make(map[string]string)
+    err := client.HScan(context.Background(), "reference:tickers", "", func(field, value string) error {
+        fields[field] = value
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(fields) != 3 || fields["XOM"] != "Energy" {
+        t.Errorf("unexpected fields %v", fields)
+    }
+
+    mock.ExpectHScan("reference:tickers", 0, "", 2).SetVal([]string{"AAPL", "Tech", "MSFT", "Tech"}, 7)
+    calls := 0
+    err = client.HScan(context.Background(), "reference:tickers", "", func(field, value string) error {
+        calls++
+        return ErrStopScan
+    })
+    if err != nil || calls != 1 {
+        t.Errorf("expected one call and no error, got %d calls and %v", calls, err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestSequenceTracker_Gaps verifies missed, stale and restarted sequence numbers.
+func TestSequenceTracker_Gaps(t *testing.T) {
+    seqs := NewSequenceTracker("quotes:pubsub")
+
+    steps := []struct {
+        seq    int64
+        missed int64
+    }{
+        {5, 0},  // first quote seen
+        {6, 0},  // in order
+        {9, 2},  // 7 and 8 missed
+        {9, -1}, // duplicate
+        {1, 0},  // numbering restarted
+    }
+    for _, step := range steps {
+        if got := seqs.Observe("AAPL", step.seq); got != step.missed {
+            t.Errorf("seq %d: expected %d missed, got %d", step.seq, step.missed, got)
+        }
+    }
+
+    seqs.Seed("AAPL", 10)
+    if got := seqs.Observe("AAPL", 10); got != -1 {
+        t.Errorf("expected a quote covered by the snapshot to be stale, got %d", got)
+    }
+    if got := QuoteSeq(`{"ticker":"AAPL","seq":11}`); got != 11 {
+        t.Errorf("expected seq 11, got %d", got)
+    }
+}
+
+// TestLockHolder_StripsNonce verifies the holder of a lock is reported by identity, and a free lock by "".
+func TestLockHolder_StripsNonce(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    mock.ExpectGet("lock:{archival}").SetVal("archival-7d9f/0123abcd")
+    mock.ExpectGet("lock:{archival}").RedisNil()
+
+    holder, err := client.LockHolder(context.Background(), "archival")
+    if err != nil || holder != "archival-7d9f" {
+        t.Errorf("expected holder archival-7d9f, got %q (%v)", holder, err)
+    }
+    holder, err = client.LockHolder(context.Background(), "archival")
+    if err != nil || holder != "" {
+        t.Errorf("expected free lock, got %q (%v)", holder, err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestGetBackpressure_ExpiredIsInactive verifies a stored signal is read back, and a missing one reads as inactive.
+func TestGetBackpressure_ExpiredIsInactive(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    mock.ExpectGet(BackpressureKey).SetVal(`{"active":true,"reason":"raw:events behind","memory_ratio":0.9}`)
+    mock.ExpectGet(BackpressureKey).RedisNil()
+
+    bp, err := client.GetBackpressure(context.Background())
+    if err != nil || !bp.Active || bp.MemoryRatio != 0.9 {
+        t.Errorf("expected active signal at 0.9, got %+v (%v)", bp, err)
+    }
+    bp, err = client.GetBackpressure(context.Background())
+    if err != nil || bp.Active {
+        t.Errorf("expected inactive signal, got %+v (%v)", bp, err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestXAutoClaim_ParsesRedis7Reply verifies the three element reply of Redis 7,
+// which lists deleted entries last, and the nil entries of Redis 6.2 are parsed.
+func TestXAutoClaim_ParsesRedis7Reply(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    mock.ExpectDo("XAUTOCLAIM", "normalized:events", "dbsink", "c1", int64(60000), "0-0", "COUNT", int64(10)).
+        SetVal([]interface{}{
+            "5-0",
+            []interface{}{
+                []interface{}{"1-0", []interface{}{"ticker", "AAPL"}},
+                nil,
+            },
+            []interface{}{"2-0"},
+        })
+
+    msgs, next, err := client.XAutoClaim(context.Background(), &redis.XAutoClaimArgs{
+        Stream:   "normalized:events",
+        Group:    "dbsink",
+        MinIdle:  time.Minute,
+        Start:    "0-0",
+        Count:    10,
+        Consumer: "c1",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    want := []redis.XMessage{{ID: "1-0", Values: map[string]interface{}{"ticker": "AAPL"}}}
+    if next != "5-0" || !reflect.DeepEqual(msgs, want) {
+        t.Errorf("got %v, %q; want %v, %q", msgs, next, want, "5-0")
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestGroupsFloor_KeepsPendingAndUndelivered verifies the floor is the oldest
+// entry another group has pending or not yet been delivered, skipping except.
+func TestGroupsFloor_KeepsPendingAndUndelivered(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    mock.ExpectDo("XINFO", "GROUPS", "normalized:events").SetVal([]interface{}{
+        []interface{}{"name", "archival", "consumers", int64(1), "pending", int64(0), "last-delivered-id", "1-0"},
+        []interface{}{"name", "dbsink", "consumers", int64(1), "pending", int64(2), "last-delivered-id", "9-0", "entries-read", int64(9), "lag", int64(0)},
+        []interface{}{"name", "cachepub", "consumers", int64(1), "pending", int64(0), "last-delivered-id", "7-3", "entries-read", nil, "lag", nil},
+    })
+    mock.ExpectXPending("normalized:events", "dbsink").SetVal(&redis.XPending{Count: 2, Lower: "8-0", Higher: "9-0"})
+
+    floor, err := client.GroupsFloor(context.Background(), "normalized:events", "archival")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if floor != "7-4" {
+        t.Errorf("floor = %q; want %q", floor, "7-4")
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestTryLock_IssuesFencingToken verifies a free lock is taken with the next
+// fencing token and a held one fails with ErrLockHeld.
+func TestTryLock_IssuesFencingToken(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    // The owner ends in a random nonce
+    sha := acquireLockScript.script.Hash()
+    keys := []string{"lock:{archival}", "lock:{archival}:fence"}
+    mock.Regexp().ExpectEvalSha(sha, keys, Identity+"/.*", int64(15000)).SetVal(int64(4))
+    mock.Regexp().ExpectEvalSha(sha, keys, Identity+"/.*", int64(15000)).SetVal(int64(0))
+
+    lock, err := client.TryLock(context.Background(), "archival", 15*time.Second)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if lock.Token() != 4 {
+        t.Errorf("token = %d; want 4", lock.Token())
+    }
+    if _, err := client.TryLock(context.Background(), "archival", 15*time.Second); !errors.Is(err, ErrLockHeld) {
+        t.Errorf("second TryLock err = %v; want %v", err, ErrLockHeld)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestLead_CancelsOnLostLease verifies the leader's context carries the fencing
+// token and is cancelled once renewing the lease finds it lost.
+func TestLead_CancelsOnLostLease(t *testing.T) {
+    logger.Log = zap.NewNop()
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    lock := &Lock{c: client, name: "archival", owner: "me/1", token: 7, ttl: 30 * time.Millisecond}
+    mock.ExpectEvalSha(renewLockScript.script.Hash(), []string{"lock:{archival}"}, "me/1", int64(30)).SetVal(int64(0))
+
+    var token int64
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        client.lead(context.Background(), lock, func(ctx context.Context, _ int64) {
+            token, _ = FencingToken(ctx)
+            <-ctx.Done()
+        })
+    }()
+
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("lead did not return after losing the lease")
+    }
+    if token != 7 {
+        t.Errorf("fencing token = %d; want 7", token)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
+
+// TestFencedHSet_RejectsStaleToken verifies a write under an earlier lease
+// than the hash has seen fails with ErrStaleToken.
+func TestFencedHSet_RejectsStaleToken(t *testing.T) {
+    db, mock := redismock.NewClientMock()
+    client := &Client{rdb: db}
+
+    sha := fencedHSetScript.script.Hash()
+    keys := []string{"archival:checkpoints"}
+    mock.ExpectEvalSha(sha, keys, "_fence", int64(3), "normalized:events", "5-0").SetVal(int64(0))
+    mock.ExpectEvalSha(sha, keys, "_fence", int64(4), "normalized:events", "5-0").SetVal(int64(1))
+
+    err := client.FencedHSet(WithFencingToken(context.Background(), 3), "archival:checkpoints", "normalized:events", "5-0")
+    if !errors.Is(err, ErrStaleToken) {
+        t.Errorf("err = %v; want %v", err, ErrStaleToken)
+    }
+    if err := client.FencedHSet(WithFencingToken(context.Background(), 4), "archival:checkpoints", "normalized:events", "5-0"); err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("unfulfilled expectations: %v", err)
+    }
+}
@@ -0,0 +1,161 @@
+package redisclient
+
+import (
+  "context"
+  "errors"
+  "sync"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// defaultScanCount is the COUNT hint of the iterators unless
+// REDIS_SCAN_COUNT sets one
+const defaultScanCount = 500
+
+// ErrStopScan may be returned by an iterator's callback to end the
+// iteration early; the iterator then returns nil
+var ErrStopScan = errors.New("stop scan")
+
+// scanCount returns the COUNT hint of the iterators
+func (c *Client) scanCount() int64 {
+  if c.pool.ScanCount > 0 {
+    return int64(c.pool.ScanCount)
+  }
+  return defaultScanCount
+}
+
+// scan drives a SCAN family cursor, handing the elements of each page to
+// each, until the cursor is exhausted, each fails or ctx is done
+func (c *Client) scan(ctx context.Context, op string, page func(cursor uint64) ([]string, uint64, error), each func([]string) error) error {
+  var cursor uint64
+  for {
+    if err := ctx.Err(); err != nil {
+      return err
+    }
+
+    var elems []string
+    var next uint64
+    err := c.streamOp(ctx, op, func() error {
+      var err error
+      elems, next, err = page(cursor)
+      return err
+    })
+    if err != nil {
+      return err
+    }
+    if err := each(elems); err != nil {
+      if err == ErrStopScan {
+        return nil
+      }
+      return err
+    }
+    if next == 0 {
+      return nil
+    }
+    cursor = next
+  }
+}
+
+// ScanKeys calls fn with each key matching pattern, iterating with SCAN so
+// Redis is not blocked the way KEYS blocks it. On a Cluster every primary
+// is scanned, with fn never called concurrently. As with SCAN, a key may be
+// reported twice, and keys added or removed meanwhile may be missed.
+func (c *Client) ScanKeys(ctx context.Context, pattern string, fn func(key string) error) error {
+  each := func(keys []string) error {
+    for _, key := range keys {
+      if err := fn(key); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+
+  cluster, ok := c.rdb.(*redis.ClusterClient)
+  if !ok {
+    return c.scan(ctx, "scan", func(cursor uint64) ([]string, uint64, error) {
+      return c.rdb.Scan(ctx, cursor, pattern, c.scanCount()).Result()
+    }, each)
+  }
+
+  var mu sync.Mutex
+  stopped := false
+  return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+    return c.scan(ctx, "scan", func(cursor uint64) ([]string, uint64, error) {
+      return node.Scan(ctx, cursor, pattern, c.scanCount()).Result()
+    }, func(keys []string) error {
+      mu.Lock()
+      defer mu.Unlock()
+      // Once fn stopped one primary's scan, end the others' too
+      if stopped {
+        return ErrStopScan
+      }
+      err := each(keys)
+      stopped = err == ErrStopScan
+      return err
+    })
+  })
+}
+
+// HScan calls fn with each field of the hash at key matching match, "" for
+// all, iterating with HSCAN
+func (c *Client) HScan(ctx context.Context, key, match string, fn func(field, value string) error) error {
+  return c.scan(ctx, "hscan", func(cursor uint64) ([]string, uint64, error) {
+    return c.rdb.HScan(ctx, key, cursor, match, c.scanCount()).Result()
+  }, func(elems []string) error {
+    for i := 0; i+1 < len(elems); i += 2 {
+      if err := fn(elems[i], elems[i+1]); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+}
+
+// SScan calls fn with each member of the set at key matching match, "" for
+// all, iterating with SSCAN
+func (c *Client) SScan(ctx context.Context, key, match string, fn func(member string) error) error {
+  return c.scan(ctx, "sscan", func(cursor uint64) ([]string, uint64, error) {
+    return c.rdb.SScan(ctx, key, cursor, match, c.scanCount()).Result()
+  }, func(members []string) error {
+    for _, member := range members {
+      if err := fn(member); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+}
+
+// ScanList calls fn with each element of the list at key and its index,
+// reading the list in LRANGE chunks rather than all at once. Elements
+// pushed or removed meanwhile shift the chunks, so an element may be
+// reported twice or missed.
+func (c *Client) ScanList(ctx context.Context, key string, fn func(index int64, element string) error) error {
+  count := c.scanCount()
+  for start := int64(0); ; start += count {
+    if err := ctx.Err(); err != nil {
+      return err
+    }
+
+    var elems []string
+    err := c.streamOp(ctx, "lrange", func() error {
+      var err error
+      elems, err = c.rdb.LRange(ctx, key, start, start+count-1).Result()
+      return err
+    })
+    if err != nil {
+      return err
+    }
+    for i, elem := range elems {
+      if err := fn(start+int64(i), elem); err != nil {
+        if err == ErrStopScan {
+          return nil
+        }
+        return err
+      }
+    }
+    if int64(len(elems)) < count {
+      return nil
+    }
+  }
+}
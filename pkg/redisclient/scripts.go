@@ -0,0 +1,77 @@
+package redisclient
+
+import (
+  "context"
+  "fmt"
+  "sync"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// Script is a Lua script run atomically by Redis. It is sent by SHA1 with
+// EVALSHA and only in full when the server does not have it cached, e.g.
+// after a restart or failover. On a Cluster all its keys must share a slot.
+type Script struct {
+  name   string
+  script *redis.Script
+}
+
+// Name returns the name the script was registered under
+func (s *Script) Name() string {
+  return s.name
+}
+
+var (
+  scriptsMu sync.Mutex
+  scripts   = make(map[string]*Script)
+)
+
+// RegisterScript adds a Lua script to the registry LoadScripts loads.
+// Register scripts in package-level variables; registering a name twice
+// panics.
+func RegisterScript(name, src string) *Script {
+  scriptsMu.Lock()
+  defer scriptsMu.Unlock()
+
+  if _, ok := scripts[name]; ok {
+    panic("redisclient: script " + name + " registered twice")
+  }
+  s := &Script{name: name, script: redis.NewScript(src)}
+  scripts[name] = s
+  return s
+}
+
+// LoadScripts loads every registered script into Redis, every primary on a
+// Cluster, so the first runs need not send them in full. Services call it
+// at startup; running a script that is not loaded still works.
+func (c *Client) LoadScripts(ctx context.Context) error {
+  scriptsMu.Lock()
+  registered := make([]*Script, 0, len(scripts))
+  for _, s := range scripts {
+    registered = append(registered, s)
+  }
+  scriptsMu.Unlock()
+
+  for _, s := range registered {
+    err := c.streamOp(ctx, "script_load", func() error {
+      return s.script.Load(ctx, c.rdb).Err()
+    })
+    if err != nil {
+      return fmt.Errorf("failed to load script %s: %w", s.name, err)
+    }
+  }
+  return nil
+}
+
+// RunScript runs script with keys and args by EVALSHA, falling back to EVAL
+// when Redis answers NOSCRIPT, with metrics and the circuit breaker. A nil
+// reply is returned as a nil result, not redis.Nil.
+func (c *Client) RunScript(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error) {
+  var result interface{}
+  err := c.streamOp(ctx, "script_"+script.name, func() error {
+    var err error
+    result, err = script.script.Run(ctx, c.rdb, keys, args...).Result()
+    return err
+  })
+  return result, err
+}
@@ -0,0 +1,99 @@
+package redisclient
+
+import (
+  "crypto/tls"
+  "crypto/x509"
+  "errors"
+  "fmt"
+  "os"
+  "strings"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// SecurityConfig holds the ACL credentials and TLS settings of Redis
+// connections that are kept out of REDIS_URL, such as those mounted as
+// secret files
+type SecurityConfig struct {
+  // Username and Password, or the contents of PasswordFile, authenticate
+  // when REDIS_URL carries no credentials
+  Username     string
+  Password     string
+  PasswordFile string
+  // CAFile holds the CAs the server certificate must chain to, replacing
+  // the system roots
+  CAFile string
+  // CertFile and KeyFile hold a client certificate for servers requiring
+  // one
+  CertFile string
+  KeyFile  string
+  // ServerName overrides the name the server certificate is verified
+  // against, for nodes reached by IP address
+  ServerName string
+}
+
+// NewSecurityConfig reads the security configuration from environment
+// variables
+func NewSecurityConfig() SecurityConfig {
+  return SecurityConfig{
+    Username:     os.Getenv("REDIS_USERNAME"),
+    Password:     os.Getenv("REDIS_PASSWORD"),
+    PasswordFile: os.Getenv("REDIS_PASSWORD_FILE"),
+    CAFile:       os.Getenv("REDIS_TLS_CA_FILE"),
+    CertFile:     os.Getenv("REDIS_TLS_CERT_FILE"),
+    KeyFile:      os.Getenv("REDIS_TLS_KEY_FILE"),
+    ServerName:   os.Getenv("REDIS_TLS_SERVER_NAME"),
+  }
+}
+
+// tlsEnabled reports whether any TLS setting is given
+func (s SecurityConfig) tlsEnabled() bool {
+  return s.CAFile != "" || s.CertFile != "" || s.KeyFile != "" || s.ServerName != ""
+}
+
+// apply adds the credentials and TLS settings to opt. TLS settings require
+// a rediss URL, so a typo in the scheme cannot silently connect in plain
+// text.
+func (s SecurityConfig) apply(opt *redis.UniversalOptions) error {
+  if opt.Username == "" && opt.Password == "" {
+    opt.Username = s.Username
+    opt.Password = s.Password
+    if s.Password == "" && s.PasswordFile != "" {
+      data, err := os.ReadFile(s.PasswordFile)
+      if err != nil {
+        return fmt.Errorf("failed to read password file: %w", err)
+      }
+      opt.Password = strings.TrimSpace(string(data))
+    }
+  }
+
+  if !s.tlsEnabled() {
+    return nil
+  }
+  if opt.TLSConfig == nil {
+    return errors.New("REDIS_TLS_* settings require a rediss URL")
+  }
+
+  if s.ServerName != "" {
+    opt.TLSConfig.ServerName = s.ServerName
+  }
+  if s.CAFile != "" {
+    pem, err := os.ReadFile(s.CAFile)
+    if err != nil {
+      return fmt.Errorf("failed to read CA file: %w", err)
+    }
+    pool := x509.NewCertPool()
+    if !pool.AppendCertsFromPEM(pem) {
+      return errors.New("CA file contains no certificates")
+    }
+    opt.TLSConfig.RootCAs = pool
+  }
+  if s.CertFile != "" || s.KeyFile != "" {
+    cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+    if err != nil {
+      return fmt.Errorf("failed to load client certificate: %w", err)
+    }
+    opt.TLSConfig.Certificates = []tls.Certificate{cert}
+  }
+  return nil
+}
@@ -0,0 +1,92 @@
+package redisclient
+
+import (
+  "encoding/json"
+  "strconv"
+  "sync"
+
+  "github.com/alim08/fin_line/pkg/metrics"
+)
+
+// QuoteSeq returns the sequence number cachepub adds to each quote it
+// publishes, as its "seq" field, or 0 if payload has none
+func QuoteSeq(payload string) int64 {
+  var seq struct {
+    Seq int64 `json:"seq"`
+  }
+  if err := json.Unmarshal([]byte(payload), &seq); err != nil {
+    return 0
+  }
+  return seq.Seq
+}
+
+// LatestQuoteSeq returns the sequence number of the last quote published
+// for the latest-quote hash, 0 if it has none
+func LatestQuoteSeq(hash map[string]string) int64 {
+  seq, _ := strconv.ParseInt(hash["seq"], 10, 64)
+  return seq
+}
+
+// SequenceTracker follows the per-ticker sequence numbers of the quotes
+// received on a channel to tell when some were missed, e.g. while the
+// subscriber lagged behind, so consumers can read a snapshot of the ticker
+// instead. It is safe for concurrent use.
+type SequenceTracker struct {
+  channel string
+  mu      sync.Mutex
+  last    map[string]int64
+}
+
+// NewSequenceTracker creates a tracker for the quotes received on channel,
+// which labels its metrics
+func NewSequenceTracker(channel string) *SequenceTracker {
+  return &SequenceTracker{channel: channel, last: make(map[string]int64)}
+}
+
+// Observe records seq, the sequence number of a quote of ticker, and
+// returns how many quotes of ticker were missed before it. It returns -1
+// for a stale quote, numbered at or below one already seen or seeded, which
+// should be dropped. The first quote of a ticker and quotes without a
+// number miss nothing; nor does a quote numbered 1, with which the numbering
+// restarts after the ticker's hash was deleted.
+func (t *SequenceTracker) Observe(ticker string, seq int64) int64 {
+  if seq <= 0 {
+    return 0
+  }
+
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  last, seen := t.last[ticker]
+  switch {
+  case !seen || seq == 1:
+    t.last[ticker] = seq
+    return 0
+  case seq <= last:
+    return -1
+  }
+
+  t.last[ticker] = seq
+  missed := seq - last - 1
+  if missed > 0 {
+    metrics.RedisPubSubSequenceGaps.WithLabelValues(t.channel).Add(float64(missed))
+  }
+  return missed
+}
+
+// Seed records that a snapshot of ticker covers the quotes up to seq, so
+// quotes numbered up to it are stale and the next one continues from it
+func (t *SequenceTracker) Seed(ticker string, seq int64) {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  if seq > t.last[ticker] {
+    t.last[ticker] = seq
+  }
+}
+
+// Reset forgets every ticker, for when the subscription was interrupted
+// and the quotes missed meanwhile cannot be counted
+func (t *SequenceTracker) Reset() {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  t.last = make(map[string]int64)
+}
@@ -0,0 +1,148 @@
+package redisclient
+
+import (
+  "context"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "github.com/go-redis/redis/v8"
+  "github.com/prometheus/client_golang/prometheus"
+  "go.uber.org/zap"
+)
+
+// defaultStatsStreams are the streams whose lengths are exported unless
+// REDIS_STATS_STREAMS names others
+var defaultStatsStreams = []string{
+  "raw:events", "normalized:events", "anomalies:stream", "events:anomalies", "events:reference",
+}
+
+// StatsExporter publishes the memory, client and eviction figures of Redis
+// and the lengths of the pipeline's streams as Prometheus gauges, so Redis
+// nearing its memory limit shows before writes to the streams start failing
+type StatsExporter struct {
+  c        *Client
+  streams  []string
+  interval time.Duration
+}
+
+// NewStatsExporter creates an exporter running every REDIS_STATS_INTERVAL
+// and measuring the streams listed, comma-separated, in REDIS_STATS_STREAMS
+func NewStatsExporter(c *Client) *StatsExporter {
+  streams := defaultStatsStreams
+  if v := os.Getenv("REDIS_STATS_STREAMS"); v != "" {
+    streams = nil
+    for _, stream := range strings.Split(v, ",") {
+      if stream = strings.TrimSpace(stream); stream != "" {
+        streams = append(streams, stream)
+      }
+    }
+  }
+  return &StatsExporter{
+    c:        c,
+    streams:  streams,
+    interval: getEnvDurationOrDefault("REDIS_STATS_INTERVAL", 15*time.Second),
+  }
+}
+
+// Run exports the statistics immediately and then every interval until ctx
+// is done
+func (e *StatsExporter) Run(ctx context.Context) {
+  logger.Log.Info("redis stats exporter started", zap.Duration("interval", e.interval))
+
+  ticker := time.NewTicker(e.interval)
+  defer ticker.Stop()
+  for {
+    e.Export(ctx)
+
+    select {
+    case <-ctx.Done():
+      logger.Log.Info("redis stats exporter stopped")
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// Export samples INFO of every primary and the stream lengths once. Failures
+// are logged and leave the gauges at their last values.
+func (e *StatsExporter) Export(ctx context.Context) {
+  ctx, cancel := context.WithTimeout(ctx, e.interval)
+  defer cancel()
+
+  if err := e.exportInfo(ctx); err != nil && ctx.Err() == nil {
+    logger.Log.Warn("failed to sample Redis INFO", zap.Error(err))
+  }
+
+  for _, stream := range e.streams {
+    var length int64
+    err := e.c.streamOp(ctx, "xlen", func() error {
+      var err error
+      length, err = e.c.rdb.XLen(ctx, stream).Result()
+      return err
+    })
+    if err != nil {
+      if ctx.Err() == nil {
+        logger.Log.Warn("failed to sample stream length", zap.String("stream", stream), zap.Error(err))
+      }
+      continue
+    }
+    metrics.RedisStreamLength.WithLabelValues(stream).Set(float64(length))
+  }
+}
+
+// exportInfo sets the INFO gauges of each primary, labelled by its address
+func (e *StatsExporter) exportInfo(ctx context.Context) error {
+  return e.c.streamOp(ctx, "info", func() error {
+    if cluster, ok := e.c.rdb.(*redis.ClusterClient); ok {
+      return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+        return exportNodeInfo(ctx, node, node.Options().Addr)
+      })
+    }
+    node := "redis"
+    if client, ok := e.c.rdb.(*redis.Client); ok {
+      node = client.Options().Addr
+    }
+    return exportNodeInfo(ctx, e.c.rdb, node)
+  })
+}
+
+// exportNodeInfo sets the INFO gauges of one node
+func exportNodeInfo(ctx context.Context, rdb redis.UniversalClient, node string) error {
+  raw, err := rdb.Info(ctx).Result()
+  if err != nil {
+    return err
+  }
+  info := parseInfo(raw)
+
+  gauges := map[string]*prometheus.GaugeVec{
+    "used_memory":       metrics.RedisMemoryUsed,
+    "maxmemory":         metrics.RedisMemoryMax,
+    "connected_clients": metrics.RedisConnectedClients,
+    "evicted_keys":      metrics.RedisEvictedKeys,
+  }
+  for field, gauge := range gauges {
+    if v, err := strconv.ParseFloat(info[field], 64); err == nil {
+      gauge.WithLabelValues(node).Set(v)
+    }
+  }
+  return nil
+}
+
+// parseInfo parses the field:value lines of an INFO reply
+func parseInfo(raw string) map[string]string {
+  info := make(map[string]string)
+  for _, line := range strings.Split(raw, "\n") {
+    line = strings.TrimSpace(line)
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    if field, value, ok := strings.Cut(line, ":"); ok {
+      info[field] = value
+    }
+  }
+  return info
+}
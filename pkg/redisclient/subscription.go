@@ -0,0 +1,174 @@
+package redisclient
+
+import (
+  "context"
+  "errors"
+  "net"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "github.com/cenkalti/backoff/v4"
+  "github.com/go-redis/redis/v8"
+  "go.uber.org/zap"
+)
+
+// subscriptionHealthCheck is how long a subscription may stay quiet before
+// its connection is pinged
+const subscriptionHealthCheck = 30 * time.Second
+
+// Message is a message received by a Subscription. A Gap message has no
+// payload: it reports that the subscription to Channel, or to the channels
+// matching Pattern, was interrupted and has been restored, so messages
+// published meanwhile were missed. Consumers holding state derived from the
+// channel should reload it.
+type Message struct {
+  Channel string
+  // Pattern is the pattern Channel matched, for pattern subscriptions
+  Pattern string
+  Payload string
+  Gap     bool
+}
+
+// Subscription is a pub/sub subscription that survives connection loss. It
+// reconnects with backoff, resubscribes to its channels or patterns, and
+// reports each interruption with a Gap message on every one of them.
+type Subscription struct {
+  pubsub   *redis.PubSub
+  patterns bool
+  channels []string
+  messages chan Message
+  cancel   context.CancelFunc
+  done     chan struct{}
+}
+
+// SubscribeManaged subscribes to channels until ctx is done or the
+// subscription is closed. The first subscription is confirmed before it
+// returns, so an unreachable Redis is reported as an error; later
+// interruptions are recovered from.
+func (c *Client) SubscribeManaged(ctx context.Context, channels ...string) (*Subscription, error) {
+  return manageSubscription(ctx, c.rdb.Subscribe(ctx, channels...), false, channels)
+}
+
+// PSubscribeManaged is SubscribeManaged for the channels matching patterns.
+// Gap messages carry the pattern as both Channel and Pattern.
+func (c *Client) PSubscribeManaged(ctx context.Context, patterns ...string) (*Subscription, error) {
+  return manageSubscription(ctx, c.rdb.PSubscribe(ctx, patterns...), true, patterns)
+}
+
+// manageSubscription confirms pubsub's first subscription and keeps it
+// alive until ctx is done
+func manageSubscription(ctx context.Context, pubsub *redis.PubSub, patterns bool, channels []string) (*Subscription, error) {
+  if _, err := pubsub.Receive(ctx); err != nil {
+    pubsub.Close()
+    return nil, err
+  }
+
+  ctx, cancel := context.WithCancel(ctx)
+  s := &Subscription{
+    pubsub:   pubsub,
+    patterns: patterns,
+    channels: channels,
+    messages: make(chan Message, 100),
+    cancel:   cancel,
+    done:     make(chan struct{}),
+  }
+  go s.run(ctx)
+  return s, nil
+}
+
+// Channel returns the channel messages are delivered on, closed once the
+// subscription ends
+func (s *Subscription) Channel() <-chan Message {
+  return s.messages
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+  s.cancel()
+  <-s.done
+  return nil
+}
+
+// run receives messages until ctx is done. go-redis reconnects and
+// resubscribes a PubSub whose connection failed on the next receive, so
+// run only waits between attempts and tracks which channels have a gap
+// until their subscription is confirmed again.
+func (s *Subscription) run(ctx context.Context) {
+  defer close(s.done)
+  defer close(s.messages)
+
+  // Closing the PubSub unblocks a pending receive
+  go func() {
+    <-ctx.Done()
+    s.pubsub.Close()
+  }()
+
+  retry := backoff.NewExponentialBackOff()
+  retry.MaxInterval = 5 * time.Second
+  retry.MaxElapsedTime = 0
+
+  gaps := make(map[string]bool)
+  for {
+    msg, err := s.pubsub.ReceiveTimeout(ctx, subscriptionHealthCheck)
+    if ctx.Err() != nil {
+      return
+    }
+    if err != nil {
+      var netErr net.Error
+      if errors.As(err, &netErr) && netErr.Timeout() && s.pubsub.Ping(ctx) == nil {
+        // A quiet channel; the ping's reply confirms the connection
+        continue
+      }
+      if len(gaps) == 0 {
+        logger.Log.Warn("pub/sub subscription interrupted, resubscribing", zap.Strings("channels", s.channels), zap.Error(err))
+        for _, channel := range s.channels {
+          gaps[channel] = true
+        }
+      }
+      select {
+      case <-ctx.Done():
+        return
+      case <-time.After(retry.NextBackOff()):
+      }
+      continue
+    }
+    retry.Reset()
+
+    switch m := msg.(type) {
+    case *redis.Subscription:
+      if (m.Kind == "subscribe" || m.Kind == "psubscribe") && gaps[m.Channel] {
+        delete(gaps, m.Channel)
+        metrics.RedisPubSubGaps.WithLabelValues(m.Channel).Inc()
+        logger.Log.Info("pub/sub subscription restored", zap.String("channel", m.Channel))
+        gap := Message{Channel: m.Channel, Gap: true}
+        if s.patterns {
+          gap.Pattern = m.Channel
+        }
+        if !s.deliver(ctx, gap) {
+          return
+        }
+      }
+    case *redis.Message:
+      // Label pattern messages by pattern; their channels may be countless
+      label := m.Channel
+      if m.Pattern != "" {
+        label = m.Pattern
+      }
+      metrics.RedisPubSubMessages.WithLabelValues(label).Inc()
+      if !s.deliver(ctx, Message{Channel: m.Channel, Pattern: m.Pattern, Payload: m.Payload}) {
+        return
+      }
+    }
+  }
+}
+
+// deliver hands msg to the consumer, reporting false if ctx is done first
+func (s *Subscription) deliver(ctx context.Context, msg Message) bool {
+  select {
+  case s.messages <- msg:
+    return true
+  case <-ctx.Done():
+    return false
+  }
+}
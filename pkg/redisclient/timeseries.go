@@ -0,0 +1,222 @@
+package redisclient
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// QuoteSeriesKeyPrefix prefixes the RedisTimeSeries key holding a ticker's
+// quote prices
+const QuoteSeriesKeyPrefix = "quotes:ts:"
+
+// TimeSeriesConfig configures the optional per-ticker quote series kept in
+// RedisTimeSeries. Each ticker has a raw series of every quote and a
+// compacted series holding the last price of each bucket, maintained by
+// the server with a compaction rule.
+type TimeSeriesConfig struct {
+  // Enabled turns the series on; they need the RedisTimeSeries module
+  Enabled bool
+  // Retention is how long the raw series keeps its samples
+  Retention time.Duration
+  // Bucket is the width of the compacted series' samples
+  Bucket time.Duration
+  // BucketRetention is how long the compacted series keeps its samples
+  BucketRetention time.Duration
+}
+
+// NewTimeSeriesConfig reads the quote series configuration from
+// REDIS_TIMESERIES, REDIS_TIMESERIES_RETENTION, REDIS_TIMESERIES_BUCKET and
+// REDIS_TIMESERIES_BUCKET_RETENTION
+func NewTimeSeriesConfig() TimeSeriesConfig {
+  enabled, _ := strconv.ParseBool(os.Getenv("REDIS_TIMESERIES"))
+  cfg := TimeSeriesConfig{
+    Enabled:         enabled,
+    Retention:       getEnvDurationOrDefault("REDIS_TIMESERIES_RETENTION", 24*time.Hour),
+    Bucket:          getEnvDurationOrDefault("REDIS_TIMESERIES_BUCKET", time.Minute),
+    BucketRetention: getEnvDurationOrDefault("REDIS_TIMESERIES_BUCKET_RETENTION", 7*24*time.Hour),
+  }
+  if cfg.Bucket < time.Millisecond {
+    cfg.Bucket = time.Minute
+  }
+  return cfg
+}
+
+// QuoteSeriesKey returns the key of ticker's raw quote series. The ticker is
+// a hash tag so the compacted series lands in the same Cluster slot, which
+// compaction rules require.
+func QuoteSeriesKey(ticker string) string {
+  return QuoteSeriesKeyPrefix + HashTag(ticker)
+}
+
+// QuoteSeriesBucketKey returns the key of ticker's series compacted to
+// buckets of the given width
+func QuoteSeriesBucketKey(ticker string, bucket time.Duration) string {
+  return QuoteSeriesKey(ticker) + ":" + strconv.FormatInt(bucket.Milliseconds(), 10)
+}
+
+// TSSample is a sample of a time series
+type TSSample struct {
+  // Timestamp is in Unix milliseconds
+  Timestamp int64
+  Value     float64
+}
+
+// IsUnknownCommand reports whether err is Redis rejecting a command it does
+// not know, as it does the TS.* commands without the RedisTimeSeries module
+func IsUnknownCommand(err error) bool {
+  return err != nil && strings.HasPrefix(err.Error(), "ERR unknown command")
+}
+
+// isAlreadyExists reports whether err is RedisTimeSeries refusing to create
+// a series or rule that exists
+func isAlreadyExists(err error) bool {
+  return err != nil && strings.Contains(err.Error(), "already")
+}
+
+// tsOp runs a TS.* command like streamOp, except that an error reply, such
+// as that of a server without the RedisTimeSeries module, does not count
+// against the circuit breaker: the server answered.
+func (c *Client) tsOp(ctx context.Context, operation string, fn func() error) error {
+  var replyErr error
+  err := c.streamOp(ctx, operation, func() error {
+    err := fn()
+    var redisErr redis.Error
+    if err != redis.Nil && errors.As(err, &redisErr) {
+      replyErr = err
+      return nil
+    }
+    return err
+  })
+  if err != nil {
+    return err
+  }
+  return replyErr
+}
+
+// TSCreate creates the time series key keeping samples for retention, zero
+// for ever, with the given labels. A later sample for an existing
+// timestamp replaces it. An existing series is left as it is.
+func (c *Client) TSCreate(ctx context.Context, key string, retention time.Duration, labels map[string]string) error {
+  args := []interface{}{"TS.CREATE", key, "RETENTION", retention.Milliseconds(), "DUPLICATE_POLICY", "LAST"}
+  if len(labels) > 0 {
+    args = append(args, "LABELS")
+    for name, value := range labels {
+      args = append(args, name, value)
+    }
+  }
+  return c.tsOp(ctx, "ts_create", func() error {
+    if err := c.rdb.Do(ctx, args...).Err(); err != nil && !isAlreadyExists(err) {
+      return err
+    }
+    return nil
+  })
+}
+
+// TSCreateRule has Redis compact the samples of source into dest, which
+// must exist, aggregating each bucket of the given width with aggregation
+// (avg, first, last, min, max, ...). An existing rule is left as it is.
+func (c *Client) TSCreateRule(ctx context.Context, source, dest, aggregation string, bucket time.Duration) error {
+  return c.tsOp(ctx, "ts_createrule", func() error {
+    err := c.rdb.Do(ctx, "TS.CREATERULE", source, dest, "AGGREGATION", aggregation, bucket.Milliseconds()).Err()
+    if err != nil && !isAlreadyExists(err) {
+      return err
+    }
+    return nil
+  })
+}
+
+// TSAdd appends a sample at timestamp, in Unix milliseconds, to the time
+// series key, replacing one at the same timestamp. The series must exist;
+// see TSCreate.
+func (c *Client) TSAdd(ctx context.Context, key string, timestamp int64, value float64) error {
+  return c.tsOp(ctx, "ts_add", func() error {
+    return c.rdb.Do(ctx, "TS.ADD", key, timestamp, value, "ON_DUPLICATE", "LAST").Err()
+  })
+}
+
+// TSRange returns the samples of the time series key from from to to, in
+// Unix milliseconds and inclusive. With a bucket width above zero the
+// samples of each bucket are aggregated with aggregation.
+func (c *Client) TSRange(ctx context.Context, key string, from, to int64, aggregation string, bucket time.Duration) ([]TSSample, error) {
+  args := []interface{}{"TS.RANGE", key, from, to}
+  if bucket > 0 {
+    args = append(args, "AGGREGATION", aggregation, bucket.Milliseconds())
+  }
+
+  var samples []TSSample
+  err := c.tsOp(ctx, "ts_range", func() error {
+    reply, err := c.rdb.Do(ctx, args...).Slice()
+    if err != nil {
+      return err
+    }
+    samples, err = parseTSSamples(reply)
+    return err
+  })
+  return samples, err
+}
+
+// parseTSSamples decodes a TS.RANGE reply, an array of [timestamp, value]
+// pairs with the value as a string
+func parseTSSamples(reply []interface{}) ([]TSSample, error) {
+  samples := make([]TSSample, 0, len(reply))
+  for _, item := range reply {
+    pair, ok := item.([]interface{})
+    if !ok || len(pair) != 2 {
+      return nil, fmt.Errorf("unexpected TS.RANGE sample %v", item)
+    }
+    timestamp, ok := pair[0].(int64)
+    if !ok {
+      return nil, fmt.Errorf("unexpected TS.RANGE timestamp %v", pair[0])
+    }
+    raw, ok := pair[1].(string)
+    if !ok {
+      return nil, fmt.Errorf("unexpected TS.RANGE value %v", pair[1])
+    }
+    value, err := strconv.ParseFloat(raw, 64)
+    if err != nil {
+      return nil, fmt.Errorf("unexpected TS.RANGE value %q: %w", raw, err)
+    }
+    samples = append(samples, TSSample{Timestamp: timestamp, Value: value})
+  }
+  return samples, nil
+}
+
+// CreateQuoteSeries creates ticker's raw and compacted quote series and the
+// rule compacting one into the other, keeping the last price of each
+// bucket. It is idempotent.
+func (c *Client) CreateQuoteSeries(ctx context.Context, ticker string, cfg TimeSeriesConfig) error {
+  raw := QuoteSeriesKey(ticker)
+  compacted := QuoteSeriesBucketKey(ticker, cfg.Bucket)
+  labels := map[string]string{"ticker": ticker}
+  if err := c.TSCreate(ctx, raw, cfg.Retention, labels); err != nil {
+    return err
+  }
+  if err := c.TSCreate(ctx, compacted, cfg.BucketRetention, labels); err != nil {
+    return err
+  }
+  return c.TSCreateRule(ctx, raw, compacted, "last", cfg.Bucket)
+}
+
+// QuoteSeries returns ticker's prices from from to to, in Unix
+// milliseconds, as the last price of each bucket of width resolution. It
+// reads the raw series when the range lies within its retention and the
+// compacted series otherwise, whose bucket resolution is rounded up to.
+func (c *Client) QuoteSeries(ctx context.Context, ticker string, from, to int64, resolution time.Duration, cfg TimeSeriesConfig) ([]TSSample, error) {
+  key := QuoteSeriesKey(ticker)
+  if from < time.Now().Add(-cfg.Retention).UnixMilli() {
+    key = QuoteSeriesBucketKey(ticker, cfg.Bucket)
+    if resolution < cfg.Bucket {
+      resolution = cfg.Bucket
+    }
+    // Buckets of the compacted series are aligned to its own
+    resolution = (resolution + cfg.Bucket - 1) / cfg.Bucket * cfg.Bucket
+  }
+  return c.TSRange(ctx, key, from, to, "last", resolution)
+}
@@ -0,0 +1,161 @@
+package redisclient
+
+import (
+  "crypto/tls"
+  "fmt"
+  "net"
+  "net/url"
+  "strconv"
+  "strings"
+
+  "github.com/go-redis/redis/v8"
+)
+
+// Topology is the kind of Redis deployment a Client connects to
+type Topology string
+
+const (
+  // TopologySingle is a single node
+  TopologySingle Topology = "single"
+  // TopologyCluster is a Redis Cluster, whose keys are spread over its
+  // nodes by hash slot
+  TopologyCluster Topology = "cluster"
+  // TopologySentinel is a primary with replicas monitored by Sentinel,
+  // which fails over to a promoted replica when the primary goes down
+  TopologySentinel Topology = "sentinel"
+)
+
+// ParseURL parses a Redis URL into the topology it names and the options
+// connecting to it. Besides the single-node redis:// and rediss:// URLs of
+// redis.ParseURL it accepts
+//
+//  redis+cluster://[user:password@]host:port[,host:port...][?read_only=true&route_by_latency=true&route_randomly=true]
+//  redis+sentinel://[user:password@]host:port[,host:port...]/master[/db][?sentinel_username=...&sentinel_password=...]
+//
+// where the hosts are seed nodes of the cluster or the sentinels, and
+// rediss+cluster and rediss+sentinel connect over TLS. The user and password
+// authenticate with the Redis nodes.
+func ParseURL(redisURL string) (Topology, *redis.UniversalOptions, error) {
+  scheme, rest, ok := strings.Cut(redisURL, "://")
+  if !ok {
+    return "", nil, fmt.Errorf("missing scheme")
+  }
+
+  switch scheme {
+  case "redis", "rediss":
+    opt, err := redis.ParseURL(redisURL)
+    if err != nil {
+      return "", nil, err
+    }
+    return TopologySingle, &redis.UniversalOptions{
+      Addrs:     []string{opt.Addr},
+      DB:        opt.DB,
+      Username:  opt.Username,
+      Password:  opt.Password,
+      TLSConfig: opt.TLSConfig,
+    }, nil
+  case "redis+cluster", "rediss+cluster":
+    return parseNodesURL(TopologyCluster, scheme == "rediss+cluster", rest)
+  case "redis+sentinel", "rediss+sentinel":
+    return parseNodesURL(TopologySentinel, scheme == "rediss+sentinel", rest)
+  default:
+    return "", nil, fmt.Errorf("unsupported scheme %q", scheme)
+  }
+}
+
+// parseNodesURL parses what follows the scheme of a cluster or sentinel URL
+func parseNodesURL(topology Topology, useTLS bool, rest string) (Topology, *redis.UniversalOptions, error) {
+  rest, rawQuery, _ := strings.Cut(rest, "?")
+  authority, path, _ := strings.Cut(rest, "/")
+
+  opt := &redis.UniversalOptions{}
+  if i := strings.LastIndex(authority, "@"); i >= 0 {
+    user, password, _ := strings.Cut(authority[:i], ":")
+    var err error
+    if opt.Username, err = url.PathUnescape(user); err != nil {
+      return "", nil, fmt.Errorf("invalid user: %w", err)
+    }
+    if opt.Password, err = url.PathUnescape(password); err != nil {
+      return "", nil, fmt.Errorf("invalid password: %w", err)
+    }
+    authority = authority[i+1:]
+  }
+
+  defaultPort := "6379"
+  if topology == TopologySentinel {
+    defaultPort = "26379"
+  }
+  for _, addr := range strings.Split(authority, ",") {
+    if addr = strings.TrimSpace(addr); addr == "" {
+      continue
+    }
+    if _, _, err := net.SplitHostPort(addr); err != nil {
+      addr = net.JoinHostPort(addr, defaultPort)
+    }
+    opt.Addrs = append(opt.Addrs, addr)
+  }
+  if len(opt.Addrs) == 0 {
+    return "", nil, fmt.Errorf("no %s nodes given", topology)
+  }
+
+  segments := strings.Split(strings.Trim(path, "/"), "/")
+  if topology == TopologySentinel {
+    if segments[0] == "" || len(segments) > 2 {
+      return "", nil, fmt.Errorf("sentinel URL path must be /master or /master/db")
+    }
+    opt.MasterName = segments[0]
+    if len(segments) == 2 {
+      db, err := strconv.Atoi(segments[1])
+      if err != nil {
+        return "", nil, fmt.Errorf("invalid database number %q", segments[1])
+      }
+      opt.DB = db
+    }
+  } else if segments[0] != "" {
+    return "", nil, fmt.Errorf("cluster URL takes no path, a cluster has only database 0")
+  }
+
+  query, err := url.ParseQuery(rawQuery)
+  if err != nil {
+    return "", nil, fmt.Errorf("invalid query: %w", err)
+  }
+  for name, values := range query {
+    value := values[len(values)-1]
+    switch {
+    case topology == TopologyCluster && name == "read_only":
+      opt.ReadOnly, err = strconv.ParseBool(value)
+    case topology == TopologyCluster && name == "route_by_latency":
+      opt.RouteByLatency, err = strconv.ParseBool(value)
+    case topology == TopologyCluster && name == "route_randomly":
+      opt.RouteRandomly, err = strconv.ParseBool(value)
+    case topology == TopologySentinel && name == "sentinel_username":
+      opt.SentinelUsername = value
+    case topology == TopologySentinel && name == "sentinel_password":
+      opt.SentinelPassword = value
+    default:
+      return "", nil, fmt.Errorf("unknown %s URL parameter %q", topology, name)
+    }
+    if err != nil {
+      return "", nil, fmt.Errorf("invalid %s: %w", name, err)
+    }
+  }
+
+  if useTLS {
+    opt.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+  }
+  return topology, opt, nil
+}
+
+// newUniversalClient connects to a deployment of the given topology. Unlike
+// redis.NewUniversalClient it treats a cluster given a single seed node as
+// a cluster.
+func newUniversalClient(topology Topology, opt *redis.UniversalOptions) redis.UniversalClient {
+  switch topology {
+  case TopologyCluster:
+    return redis.NewClusterClient(opt.Cluster())
+  case TopologySentinel:
+    return redis.NewFailoverClient(opt.Failover())
+  default:
+    return redis.NewClient(opt.Simple())
+  }
+}
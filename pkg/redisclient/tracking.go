@@ -0,0 +1,278 @@
+package redisclient
+
+import (
+  "context"
+  "errors"
+  "net"
+  "os"
+  "strconv"
+  "sync"
+  "sync/atomic"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "github.com/alim08/fin_line/pkg/metrics"
+  "github.com/cenkalti/backoff/v4"
+  "github.com/go-redis/redis/v8"
+  "go.uber.org/zap"
+)
+
+// invalidationChannel is where Redis publishes the keys of tracked clients
+// that changed, for clients speaking RESP2
+const invalidationChannel = "__redis__:invalidate"
+
+// trackingHealthCheck is how often the tracking connection is pinged, as
+// the invalidations stop without notice if it drops
+const trackingHealthCheck = 5 * time.Second
+
+// ClientCacheConfig configures the in-process cache of latest-quote hashes
+type ClientCacheConfig struct {
+  // Enabled turns the cache on; it needs Redis 6 and a single-node or
+  // Sentinel deployment
+  Enabled bool
+  // MaxEntries bounds the hashes cached
+  MaxEntries int
+}
+
+// NewClientCacheConfig reads the cache configuration from
+// REDIS_CLIENT_CACHE and REDIS_CLIENT_CACHE_SIZE
+func NewClientCacheConfig() ClientCacheConfig {
+  enabled, _ := strconv.ParseBool(os.Getenv("REDIS_CLIENT_CACHE"))
+  return ClientCacheConfig{
+    Enabled:    enabled,
+    MaxEntries: getEnvIntOrDefault("REDIS_CLIENT_CACHE_SIZE", 10000),
+  }
+}
+
+// trackedCache holds hashes under a key prefix in process memory, kept
+// coherent with server-assisted client-side caching: Redis is asked to
+// track every key under the prefix (CLIENT TRACKING ... BCAST PREFIX) and
+// publishes the keys that change, which are dropped from the cache. The
+// cache only serves reads while tracking is in place; whenever the tracking
+// or invalidation connection fails it is emptied until both are restored.
+type trackedCache struct {
+  prefix     string
+  maxEntries int
+
+  mu      sync.RWMutex
+  entries map[string]map[string]string
+  enabled bool
+  // epoch changes with every invalidation, so a read racing one does not
+  // store what it read
+  epoch uint64
+}
+
+// StartClientCache caches the latest-quote hashes read through
+// LatestQuoteHash and LatestQuoteHashes in process memory, so repeated reads
+// of hot tickers do not reach Redis, until ctx is done. Call it before
+// serving reads; it does nothing unless cfg.Enabled.
+func (c *Client) StartClientCache(ctx context.Context, cfg ClientCacheConfig) {
+  if !cfg.Enabled {
+    return
+  }
+  client, ok := c.rdb.(*redis.Client)
+  if !ok {
+    logger.Log.Warn("client-side caching needs a single-node or Sentinel deployment, disabled",
+      zap.String("topology", string(c.Topology())))
+    return
+  }
+
+  t := &trackedCache{
+    prefix:     LatestQuoteKeyPrefix,
+    maxEntries: cfg.MaxEntries,
+    entries:    make(map[string]map[string]string),
+  }
+  c.cache = t
+  go t.run(ctx, client)
+}
+
+// run keeps tracking in place until ctx is done
+func (t *trackedCache) run(ctx context.Context, client *redis.Client) {
+  retry := backoff.NewExponentialBackOff()
+  retry.MaxInterval = 5 * time.Second
+  retry.MaxElapsedTime = 0
+
+  for {
+    err := t.track(ctx, client, retry)
+    t.disable()
+    if ctx.Err() != nil {
+      return
+    }
+    logger.Log.Warn("client-side cache tracking interrupted, cache disabled until restored", zap.Error(err))
+    select {
+    case <-ctx.Done():
+      return
+    case <-time.After(retry.NextBackOff()):
+    }
+  }
+}
+
+// track subscribes to invalidations, turns tracking on with them redirected
+// to the subscription and serves reads from the cache until either
+// connection fails
+func (t *trackedCache) track(ctx context.Context, client *redis.Client, retry backoff.BackOff) error {
+  // The invalidations are redirected to the subscriber by connection ID,
+  // which it learns as it connects
+  var subscriberID int64
+  opt := *client.Options()
+  opt.PoolSize = 1
+  opt.MinIdleConns = 0
+  onConnect := opt.OnConnect
+  opt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+    if onConnect != nil {
+      if err := onConnect(ctx, cn); err != nil {
+        return err
+      }
+    }
+    id, err := cn.ClientID(ctx).Result()
+    atomic.StoreInt64(&subscriberID, id)
+    return err
+  }
+  subscriber := redis.NewClient(&opt)
+  defer subscriber.Close()
+
+  pubsub := subscriber.Subscribe(ctx, invalidationChannel)
+  defer pubsub.Close()
+  if _, err := pubsub.Receive(ctx); err != nil {
+    return err
+  }
+
+  tracker := client.Conn(ctx)
+  defer tracker.Close()
+  trackCmd := redis.NewStatusCmd(ctx, "CLIENT", "TRACKING", "ON",
+    "REDIRECT", atomic.LoadInt64(&subscriberID), "BCAST", "PREFIX", t.prefix)
+  if err := tracker.Process(ctx, trackCmd); err != nil {
+    return err
+  }
+  t.enable()
+  retry.Reset()
+  logger.Log.Info("client-side cache tracking enabled", zap.String("prefix", t.prefix))
+
+  lastPing := time.Now()
+  for {
+    // A reply go-redis cannot parse, such as the null invalidation sent on
+    // FLUSHALL, fails the receive and so empties the cache too
+    msg, err := pubsub.ReceiveTimeout(ctx, trackingHealthCheck)
+    if ctx.Err() != nil {
+      return nil
+    }
+    var netErr net.Error
+    if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+      return err
+    }
+    if m, ok := msg.(*redis.Message); ok && m.Channel == invalidationChannel {
+      t.invalidate(m.PayloadSlice)
+    }
+
+    if time.Since(lastPing) >= trackingHealthCheck {
+      if err := tracker.Ping(ctx).Err(); err != nil {
+        return err
+      }
+      if err := pubsub.Ping(ctx); err != nil {
+        return err
+      }
+      lastPing = time.Now()
+    }
+  }
+}
+
+// cachedHashes reads the hashes at keys like MGetHashes, serving those the
+// client-side cache holds from it and caching the rest
+func (c *Client) cachedHashes(ctx context.Context, keys []string) ([]map[string]string, error) {
+  t := c.cache
+  if t == nil {
+    return c.MGetHashes(ctx, keys...)
+  }
+
+  hashes := make([]map[string]string, len(keys))
+  var missing []int
+  var missingKeys []string
+  var epoch uint64
+  for i, key := range keys {
+    hash, ok, e := t.get(key)
+    if i == 0 {
+      epoch = e
+    }
+    if ok {
+      hashes[i] = hash
+      continue
+    }
+    missing = append(missing, i)
+    missingKeys = append(missingKeys, key)
+  }
+  if len(missing) == 0 {
+    return hashes, nil
+  }
+
+  fetched, err := c.MGetHashes(ctx, missingKeys...)
+  if err != nil {
+    return nil, err
+  }
+  for j, i := range missing {
+    hashes[i] = fetched[j]
+    t.store(epoch, keys[i], fetched[j])
+  }
+  return hashes, nil
+}
+
+// get returns the cached hash at key, and the epoch to store a hash read
+// from Redis with
+func (t *trackedCache) get(key string) (map[string]string, bool, uint64) {
+  t.mu.RLock()
+  defer t.mu.RUnlock()
+  if !t.enabled {
+    return nil, false, 0
+  }
+  hash, ok := t.entries[key]
+  if ok {
+    metrics.RedisClientCacheLookups.WithLabelValues("hit").Inc()
+  } else {
+    metrics.RedisClientCacheLookups.WithLabelValues("miss").Inc()
+  }
+  return hash, ok, t.epoch
+}
+
+// store caches hash at key if no invalidation happened since epoch
+func (t *trackedCache) store(epoch uint64, key string, hash map[string]string) {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  if !t.enabled || t.epoch != epoch {
+    return
+  }
+  if _, ok := t.entries[key]; !ok && len(t.entries) >= t.maxEntries {
+    // Evict an arbitrary entry
+    for evict := range t.entries {
+      delete(t.entries, evict)
+      break
+    }
+  }
+  t.entries[key] = hash
+}
+
+// invalidate drops keys from the cache
+func (t *trackedCache) invalidate(keys []string) {
+  metrics.RedisClientCacheInvalidations.Add(float64(len(keys)))
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  t.epoch++
+  for _, key := range keys {
+    delete(t.entries, key)
+  }
+}
+
+// enable starts serving reads from the cache
+func (t *trackedCache) enable() {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  t.enabled = true
+  t.epoch++
+}
+
+// disable empties the cache and stops serving reads from it
+func (t *trackedCache) disable() {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  t.enabled = false
+  t.epoch++
+  t.entries = make(map[string]map[string]string)
+}
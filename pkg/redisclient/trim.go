@@ -0,0 +1,249 @@
+package redisclient
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/alim08/fin_line/pkg/logger"
+  "go.uber.org/zap"
+)
+
+// TrimPolicy bounds a stream by entry count, entry age, or both
+type TrimPolicy struct {
+  Stream string
+  // MaxLen caps the stream at about this many entries; 0 for no cap
+  MaxLen int64
+  // MaxAge drops the entries added longer ago than this; 0 for no limit
+  MaxAge time.Duration
+}
+
+// NewTrimPolicies reads stream trim policies from REDIS_STREAM_TRIM, a
+// comma-separated list of stream=limits where limits is an entry count, an
+// age, or both separated by a slash, e.g.
+// "normalized:events=240h,raw:events:dlq=100000/72h". Malformed entries are
+// skipped.
+func NewTrimPolicies() []TrimPolicy {
+  return parseTrimPolicies(os.Getenv("REDIS_STREAM_TRIM"))
+}
+
+// parseTrimPolicies parses a REDIS_STREAM_TRIM value
+func parseTrimPolicies(s string) []TrimPolicy {
+  var policies []TrimPolicy
+  for _, entry := range strings.Split(s, ",") {
+    stream, limits, ok := strings.Cut(strings.TrimSpace(entry), "=")
+    if !ok || stream == "" {
+      continue
+    }
+
+    policy := TrimPolicy{Stream: stream}
+    for _, limit := range strings.Split(limits, "/") {
+      limit = strings.TrimSpace(limit)
+      if n, err := strconv.ParseInt(limit, 10, 64); err == nil && n > 0 {
+        policy.MaxLen = n
+      } else if d, err := time.ParseDuration(limit); err == nil && d > 0 {
+        policy.MaxAge = d
+      }
+    }
+    if policy.MaxLen > 0 || policy.MaxAge > 0 {
+      policies = append(policies, policy)
+    }
+  }
+  return policies
+}
+
+// MinIDAt returns the smallest stream entry ID added at or after t, the
+// minID keeping only entries younger than t
+func MinIDAt(t time.Time) string {
+  return strconv.FormatInt(t.UnixMilli(), 10) + "-0"
+}
+
+// Trim caps stream at about approxMaxLen entries with XTRIM MAXLEN ~,
+// returning how many entries were removed. Redis only drops whole nodes of
+// the stream, so a few more entries than approxMaxLen may remain.
+func (c *Client) Trim(ctx context.Context, stream string, approxMaxLen int64) (int64, error) {
+  var removed int64
+  err := c.streamOp(ctx, "xtrim", func() error {
+    var err error
+    removed, err = c.rdb.XTrimMaxLenApprox(ctx, stream, approxMaxLen, 0).Result()
+    return err
+  })
+  return removed, err
+}
+
+// TrimByAge removes the entries of stream with an ID below minID with
+// XTRIM MINID ~, returning how many were removed. Like Trim it drops whole
+// nodes only, so a few older entries may remain. See MinIDAt.
+func (c *Client) TrimByAge(ctx context.Context, stream, minID string) (int64, error) {
+  var removed int64
+  err := c.streamOp(ctx, "xtrim", func() error {
+    var err error
+    removed, err = c.rdb.XTrimMinIDApprox(ctx, stream, minID, 0).Result()
+    return err
+  })
+  return removed, err
+}
+
+// TrimFloor returns the smallest entry ID of stream a trim must keep, such
+// as the first entry not yet archived, or "" to trim it freely
+type TrimFloor func(ctx context.Context, stream string) (string, error)
+
+// CompareStreamIDs returns -1, 0 or 1 as stream ID a is below, equal to or
+// above b
+func CompareStreamIDs(a, b string) int {
+  ams, aseq := splitStreamID(a)
+  bms, bseq := splitStreamID(b)
+  switch {
+  case ams < bms || (ams == bms && aseq < bseq):
+    return -1
+  case ams == bms && aseq == bseq:
+    return 0
+  default:
+    return 1
+  }
+}
+
+// splitStreamID returns the millisecond and sequence parts of a stream ID
+func splitStreamID(id string) (uint64, uint64) {
+  ms, seq, _ := strings.Cut(id, "-")
+  m, _ := strconv.ParseUint(ms, 10, 64)
+  n, _ := strconv.ParseUint(seq, 10, 64)
+  return m, n
+}
+
+// GroupsFloor returns the smallest entry ID of stream a consumer group
+// other than those in except still needs: its oldest pending entry, or else
+// the entry after the last one delivered to it. It returns "" when no other
+// group reads stream.
+func (c *Client) GroupsFloor(ctx context.Context, stream string, except ...string) (string, error) {
+  var reply []interface{}
+  err := c.streamOp(ctx, "xinfo_groups", func() error {
+    var err error
+    // go-redis v8 only parses the four fields per group of Redis 6
+    reply, err = c.rdb.Do(ctx, "XINFO", "GROUPS", stream).Slice()
+    return err
+  })
+  if err != nil {
+    return "", err
+  }
+
+  var floor string
+  for _, item := range reply {
+    fields, ok := item.([]interface{})
+    if !ok || len(fields)%2 != 0 {
+      return "", fmt.Errorf("unexpected XINFO GROUPS entry %v", item)
+    }
+    info := make(map[string]interface{}, len(fields)/2)
+    for i := 0; i < len(fields); i += 2 {
+      if key, ok := fields[i].(string); ok {
+        info[key] = fields[i+1]
+      }
+    }
+    group, _ := info["name"].(string)
+    if group == "" || containsString(except, group) {
+      continue
+    }
+
+    lastDelivered, _ := info["last-delivered-id"].(string)
+    needs := NextStreamID(lastDelivered)
+    if pending, _ := info["pending"].(int64); pending > 0 {
+      summary, err := c.XPending(ctx, stream, group)
+      if err != nil {
+        return "", err
+      }
+      needs = summary.Lower
+    }
+    if floor == "" || CompareStreamIDs(needs, floor) < 0 {
+      floor = needs
+    }
+  }
+  return floor, nil
+}
+
+// NextStreamID returns the smallest stream ID above id, e.g. to resume an
+// XRANGE after id or to XTRIM MINID everything up to and including it
+func NextStreamID(id string) string {
+  ms, seq := splitStreamID(id)
+  return strconv.FormatUint(ms, 10) + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+// containsString reports whether s is one of values
+func containsString(values []string, s string) bool {
+  for _, v := range values {
+    if v == s {
+      return true
+    }
+  }
+  return false
+}
+
+// trimStream applies policy once. With a floor, entries from it on are
+// kept whatever their age, and the count bound is not applied since XTRIM
+// MAXLEN cannot be limited to the entries below it.
+func (c *Client) trimStream(ctx context.Context, policy TrimPolicy, floor TrimFloor) (int64, error) {
+  var keepFrom string
+  if floor != nil {
+    var err error
+    if keepFrom, err = floor(ctx, policy.Stream); err != nil {
+      return 0, err
+    }
+  }
+
+  var removed int64
+  if policy.MaxAge > 0 {
+    minID := MinIDAt(time.Now().Add(-policy.MaxAge))
+    if keepFrom != "" && CompareStreamIDs(keepFrom, minID) < 0 {
+      minID = keepFrom
+    }
+    n, err := c.TrimByAge(ctx, policy.Stream, minID)
+    if err != nil {
+      return removed, err
+    }
+    removed += n
+  }
+  if policy.MaxLen > 0 && keepFrom == "" {
+    n, err := c.Trim(ctx, policy.Stream, policy.MaxLen)
+    if err != nil {
+      return removed, err
+    }
+    removed += n
+  }
+  return removed, nil
+}
+
+// RunTrimmer applies policies every interval until ctx is done, never
+// trimming past the floor of a stream if floor is non-nil. Any service may
+// run it; trimming is idempotent, so several services trimming the same
+// streams only repeat work. Consumer groups are only respected as far as
+// floor accounts for them.
+func (c *Client) RunTrimmer(ctx context.Context, interval time.Duration, policies []TrimPolicy, floor TrimFloor) {
+  if len(policies) == 0 {
+    return
+  }
+
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  for {
+    for _, policy := range policies {
+      removed, err := c.trimStream(ctx, policy, floor)
+      if err != nil {
+        if ctx.Err() == nil {
+          logger.Log.Warn("failed to trim stream", zap.String("stream", policy.Stream), zap.Error(err))
+        }
+        continue
+      }
+      if removed > 0 {
+        logger.Log.Debug("trimmed stream", zap.String("stream", policy.Stream), zap.Int64("removed", removed))
+      }
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
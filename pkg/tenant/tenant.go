@@ -0,0 +1,51 @@
+// Package tenant carries the tenant a request acts on through contexts.
+//
+// Rows written without a tenant belong to Default, which holds the shared
+// market data produced by the pipeline and is readable by every tenant.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Default is the tenant of unauthenticated requests, background services and
+// tokens without a tenant claim
+const Default = "default"
+
+// idPattern restricts tenant IDs to lowercase slugs
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// contextKey is unexported so only this package can set the tenant
+type contextKey struct{}
+
+// Validate checks that id is a well-formed tenant ID
+func Validate(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("invalid tenant id %q", id)
+	}
+	return nil
+}
+
+// WithTenant returns a copy of ctx scoped to tenant id
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ctx is scoped to, or Default
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Visible returns the tenants whose rows ctx may read: its own and Default
+func Visible(ctx context.Context) []string {
+	id := FromContext(ctx)
+	if id == Default {
+		return []string{Default}
+	}
+	return []string{id, Default}
+}